@@ -15,14 +15,147 @@
 package options
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
 )
 
 const DefaultResyncPeriod = 12 * time.Hour
 
+// DefaultReconcilerSyncPeriod is the default value of --resync-period.
+const DefaultReconcilerSyncPeriod = 15 * time.Second
+
+// DefaultDataAccessLabel is the default value of --data-access-label.
+const DefaultDataAccessLabel = "data-access"
+
+// The values of --pod-template-restart-policy.
+const (
+	// PodTemplateRestartPolicyWarn overrides the restart policy set in a pod
+	// template with the one of its replica spec, and emits a warning event.
+	PodTemplateRestartPolicyWarn = "warn"
+	// PodTemplateRestartPolicyError fails the tfjobs whose pod templates set
+	// a restart policy.
+	PodTemplateRestartPolicyError = "error"
+	// PodTemplateRestartPolicyRespect keeps the restart policy set in a pod
+	// template, and interprets the pod failures according to it.
+	PodTemplateRestartPolicyRespect = "respect"
+)
+
+// The values of --stale-service-endpoints-policy.
+const (
+	// StaleServiceEndpointsPolicyWait does not create the missing pods of a
+	// tfjob while its services route to the pods of a previous tfjob of the
+	// same name, until their endpoints drain.
+	StaleServiceEndpointsPolicyWait = "wait"
+	// StaleServiceEndpointsPolicyRecreate deletes the services routing to
+	// the pods of a previous tfjob, so that they are created again.
+	StaleServiceEndpointsPolicyRecreate = "recreate"
+)
+
+// The values of --ps-failure-policy.
+const (
+	// PSFailurePolicyFail fails the tfjob when one of its PS pods fails,
+	// naming the failed PS replicas.
+	PSFailurePolicyFail = "fail"
+	// PSFailurePolicyRestart recreates the failed PS pods, as the restart
+	// policy ExitCode does for the retryable exit codes.
+	PSFailurePolicyRestart = "restart"
+)
+
+// The values of --ps-anti-affinity.
+const (
+	// PSAntiAffinityNone does not inject a pod anti-affinity into PS pods.
+	PSAntiAffinityNone = "none"
+	// PSAntiAffinityPreferred injects a soft pod anti-affinity which spreads
+	// the PS pods of a tfjob across nodes.
+	PSAntiAffinityPreferred = "preferred"
+	// PSAntiAffinityRequired injects a hard pod anti-affinity, the PS pods of
+	// a tfjob which do not fit on distinct nodes stay pending.
+	PSAntiAffinityRequired = "required"
+)
+
+// The values of --log-format.
+const (
+	// LogFormatJSON outputs the logs as JSON objects, with the fields of
+	// the log lines as keys.
+	LogFormatJSON = "json"
+	// LogFormatText outputs the logs as plain text.
+	LogFormatText = "text"
+)
+
+// DefaultQueueLatencyThreshold is the default value of --queue-latency-warning-threshold.
+const DefaultQueueLatencyThreshold = 10 * time.Minute
+
+// DefaultUnschedulableEventInterval is the default value of --unschedulable-event-interval.
+const DefaultUnschedulableEventInterval = 10 * time.Minute
+
+// DefaultEventDedupeWindow is the default value of --event-dedupe-window.
+const DefaultEventDedupeWindow = 5 * time.Minute
+
+// DefaultExternalDeletionThreshold, DefaultExternalDeletionWindow and
+// DefaultExternalDeletionBackoff are the default values of
+// --external-deletion-threshold, --external-deletion-window and
+// --external-deletion-backoff.
+const (
+	DefaultExternalDeletionThreshold = 5
+	DefaultExternalDeletionWindow    = 10 * time.Minute
+	DefaultExternalDeletionBackoff   = 30 * time.Minute
+)
+
+// DefaultRestartBackoffStabilityWindow is the default value of
+// --restart-backoff-stability-window.
+const DefaultRestartBackoffStabilityWindow = 10 * time.Minute
+
+// DefaultImagePullFailureTimeout is the default value of
+// --image-pull-failure-timeout.
+const DefaultImagePullFailureTimeout = 5 * time.Minute
+
+// DefaultMissingPodTemplateTimeout is the default value of
+// --missing-pod-template-timeout.
+const DefaultMissingPodTemplateTimeout = time.Minute
+
+// DefaultNodeFailureGracePeriod is the default value of
+// --node-failure-grace-period.
+const DefaultNodeFailureGracePeriod = 5 * time.Minute
+
+// DefaultAuditMaxEntries is the default value of --audit-max-entries.
+const DefaultAuditMaxEntries = 1000
+
+// DefaultServiceDNSTimeout is the default value of --service-dns-timeout.
+const DefaultServiceDNSTimeout = 2 * time.Minute
+
+// DefaultInitContainerCPU is the default value of --init-container-cpu.
+const DefaultInitContainerCPU = "10m"
+
+// DefaultInitContainerMemory is the default value of --init-container-memory.
+const DefaultInitContainerMemory = "16Mi"
+
+// DefaultStatusAPIPort is the default value of --status-api-port.
+const DefaultStatusAPIPort = 8081
+
+// DefaultHealthProbeAddress is the default value of --health-probe-address.
+const DefaultHealthProbeAddress = ":8082"
+
+// DefaultRecordExportMaxAttempts is the default value of
+// --record-export-max-attempts.
+const DefaultRecordExportMaxAttempts = 10
+
+// DefaultMaxReplicas is the default value of --max-replicas.
+const DefaultMaxReplicas = 10000
+
 // ServerOption is the main context object for the controller manager.
 type ServerOption struct {
 	Kubeconfig           string
@@ -35,14 +168,193 @@ type ServerOption struct {
 	Namespace            string
 	MonitoringPort       int
 	ResyncPeriod         time.Duration
+	// EnableStatusAPI serves the read-only status API of the tfjobs on
+	// StatusAPIPort.
+	EnableStatusAPI bool
+	StatusAPIPort   int
+	// HealthProbeAddress is the address the health probes are served on. If
+	// empty, they are not served.
+	HealthProbeAddress string
+	// LogFormat is json or text. If empty, it is set by JSONLogFormat.
+	LogFormat string
+	// LogLevel is the minimum level of the logs, e.g. info.
+	LogLevel string
 	// QPS indicates the maximum QPS to the master from this client.
 	// If it's zero, the created RESTClient will use DefaultQPS: 5
 	QPS int
 	// Maximum burst for throttle.
 	// If it's zero, the created RESTClient will use DefaultBurst: 10.
 	Burst int
+	// Namespaces is the set of namespaces to monitor tfjobs in, on top of Namespace.
+	// If both are unset, the operator monitors all namespaces cluster-wide.
+	Namespaces []string
+	// GPUQuotas maps a namespace to the maximum number of GPUs which may be
+	// requested concurrently by the tfjobs in that namespace.
+	GPUQuotas map[string]int64
+	// EnableWorkerAntiAffinity injects a soft pod anti-affinity into worker
+	// pods so that the workers of a tfjob are spread across nodes.
+	EnableWorkerAntiAffinity bool
+	// EnablePodDisruptionBudget protects the pods of all the tfjobs with a
+	// PodDisruptionBudget while they run.
+	EnablePodDisruptionBudget bool
+	// PSAntiAffinity injects a pod anti-affinity into the PS pods of the
+	// tfjobs with several PS replicas so that they are spread across nodes:
+	// none, preferred or required.
+	PSAntiAffinity string
+	// JobLabelSelector restricts the operator to the tfjobs matching the
+	// label selector, so that several operators can shard the tfjobs.
+	JobLabelSelector string
+	// QueueLatencyThreshold is the time a tfjob may wait in the work queue
+	// before its sync starts without a warning being logged.
+	QueueLatencyThreshold time.Duration
+	// MaxPodCreationsPerSync is the maximum number of pods, and of services,
+	// created for a replica type in one sync. It is unbounded if zero.
+	MaxPodCreationsPerSync int
+	// MaxReplicas is the maximum total number of replicas of a tfjob. TFJobs
+	// with more replicas fail instead of creating any pod.
+	MaxReplicas int
+	// StatusUpdateQPS is the rate of the token bucket shared by the status
+	// updates which only change replica counters. It is unbounded if zero.
+	StatusUpdateQPS float64
+	// StatusUpdateBurst is the burst of the status update token bucket.
+	StatusUpdateBurst int
+	// CleanupJitter is the period over which the deletions of the pods and
+	// services of the tfjobs completing together are spread.
+	CleanupJitter time.Duration
+	// RecordExportSink is the URL of the sink the records of the terminated
+	// tfjobs are exported to before they are deleted after their TTL, see
+	// export.NewSink. If empty, the records are not exported.
+	RecordExportSink string
+	// RecordExportMaxAttempts is the number of failed exports of the record
+	// of a tfjob after which it is deleted without its record. It is
+	// unbounded if zero.
+	RecordExportMaxAttempts int
+	// ReconcilerSyncPeriod is the period after which the tfjobs waiting for
+	// a state change, e.g. for the GPU quota, are synced again. A shorter
+	// period makes their status less stale at the cost of more syncs.
+	ReconcilerSyncPeriod time.Duration
+	// PodTemplateRestartPolicy defines how a restart policy set in the pod
+	// template of a replica spec is handled: warn, error or respect.
+	PodTemplateRestartPolicy string
+	// MissingPodTemplateTimeout is the time a tfjob waits for a PodTemplate
+	// it references to exist before it fails.
+	MissingPodTemplateTimeout time.Duration
+	// DefaultPortName and DefaultPort are the port added to the tensorflow
+	// containers which do not declare it. They are recorded in the tfjobs
+	// when they are first reconciled, so changing them only affects the new
+	// tfjobs.
+	DefaultPortName string
+	DefaultPort     int
+	// PropagatedLabels and PropagatedAnnotations are the keys of the labels
+	// and annotations of a tfjob copied to its pods. PropagateAll copies all
+	// the keys outside of the kubeflow.org and kubernetes.io domains.
+	PropagatedLabels      []string
+	PropagatedAnnotations []string
+	// UnschedulableEventThreshold is the time the pods of a tfjob may stay
+	// unschedulable before an event suggests how to schedule them. The
+	// suggestions need to list the nodes, they are disabled if zero.
+	UnschedulableEventThreshold time.Duration
+	// UnschedulableEventInterval is the minimum period between the
+	// unschedulable events of a tfjob.
+	UnschedulableEventInterval time.Duration
+	// ImagePullFailureTimeout is the time a container of a tfjob may keep
+	// failing to pull its image, or to be created, before the tfjob fails.
+	// It is disabled if zero.
+	ImagePullFailureTimeout time.Duration
+	// EventDedupeWindow is the period within which the replica events of the
+	// same reason about the same pod are emitted once on a tfjob.
+	EventDedupeWindow time.Duration
+	// ExternalDeletionThreshold is the number of times the pods of a replica
+	// may be deleted by another agent than the operator within
+	// ExternalDeletionWindow before they are no longer recreated for
+	// ExternalDeletionBackoff. 0 disables it.
+	ExternalDeletionThreshold int
+	ExternalDeletionWindow    time.Duration
+	ExternalDeletionBackoff   time.Duration
+	// MaxRestartBackoff caps the exponential backoff of the recreation of the
+	// pods the operator restarts under the ExitCode restart policy. 0
+	// disables the backoff.
+	MaxRestartBackoff time.Duration
+	// RestartBackoffStabilityWindow is the time a restarted pod must stay
+	// running for the backoff of its replica to be reset.
+	RestartBackoffStabilityWindow time.Duration
+	// ServiceDNSResolver is the address of the DNS server the names of the
+	// PS and chief services of a tfjob are looked up on before its workers
+	// are created, typically the cluster DNS. Empty disables the lookups.
+	ServiceDNSResolver string
+	// ServiceDNSTimeout is the time the workers of a tfjob wait for its
+	// services to resolve before they are created anyway.
+	ServiceDNSTimeout time.Duration
+	// InitContainerImage is the image of the init container injected into
+	// the worker and chief pods of the tfjobs to wait for their PS. Empty
+	// disables the injection.
+	InitContainerImage string
+	// InitContainerCPU and InitContainerMemory are the resources requested
+	// and limited by the init container, as quantities.
+	InitContainerCPU    string
+	InitContainerMemory string
+	// DisableServiceCreation disables the creation of the services of the
+	// tfjobs, whose pods are then reached through the DNS their users manage
+	// under the names of the services in TF_CONFIG.
+	DisableServiceCreation bool
+	// ProgressAnnotation is the annotation the Worker pods of a tfjob report
+	// their training progress in, aggregated in the status of the tfjob.
+	ProgressAnnotation string
+	// PSFailurePolicy defines how a PS pod failing with a non-retryable exit
+	// code is handled: fail or restart.
+	PSFailurePolicy string
+	// StaleServiceEndpointsPolicy defines how the services of a tfjob whose
+	// endpoints reference the pods of a previous tfjob of the same name are
+	// handled: wait or recreate.
+	StaleServiceEndpointsPolicy string
+	// NameTemplate generates the names of the pods and services of the
+	// replicas of the tfjobs from the {job}, {type} and {index} placeholders.
+	NameTemplate string
+	// V1beta2Compatibility manages the pods and services the v1beta2
+	// operator created for the running tfjobs before an in-place upgrade,
+	// without recreating them.
+	V1beta2Compatibility bool
+	// ExemptPreemptions recreates the pods of the tfjobs evicted or preempted
+	// by the cluster without counting them toward the backoff limit.
+	ExemptPreemptions bool
+	// EnableNodeFailureRecovery force deletes the pods of the tfjobs whose
+	// node has not been ready for longer than NodeFailureGracePeriod, so that
+	// they are recreated on another node.
+	EnableNodeFailureRecovery bool
+	NodeFailureGracePeriod    time.Duration
+	// AuditMaxEntries is the number of entries the audit ConfigMaps of the
+	// tfjobs annotated with kubeflow.org/audit keep. Auditing is disabled if
+	// zero.
+	AuditMaxEntries int
+	// PodDefaultsConfigMap is the namespace/name of the ConfigMap holding the
+	// partial pod template merged into the pods of the tfjobs.
+	PodDefaultsConfigMap string
+	// ReplicaNodePools maps replica types to the names of the node pools
+	// their pods are scheduled on, defined in NodePoolsConfigMap.
+	ReplicaNodePools map[string]string
+	// NodePoolsConfigMap is the namespace/name of the ConfigMap holding the
+	// node selector and the tolerations of each node pool.
+	NodePoolsConfigMap string
+	// DataAccessConfigMap is the namespace/name of the ConfigMap holding the
+	// data access profiles, injected into the pods of the tfjobs labeled
+	// with DataAccessLabel.
+	DataAccessConfigMap string
+	DataAccessLabel     string
+	// OperatorSidecarConfigMap is the namespace/name of the ConfigMap holding
+	// the sidecar injected into the pods of the tfjobs.
+	OperatorSidecarConfigMap string
+	// SecurityContextConfigMap is the namespace/name of the ConfigMap holding
+	// the security context defaults merged into the pods of the tfjobs.
+	SecurityContextConfigMap string
+	// SecurityContextStrict rejects the tfjobs conflicting with the security
+	// context defaults instead of keeping their values.
+	SecurityContextStrict bool
 }
 
+// PropagateAll is the key of --propagate-labels and --propagate-annotations
+// which propagates all the labels or annotations of the tfjobs.
+const PropagateAll = "*"
+
 // NewServerOption creates a new CMServer with a default config.
 func NewServerOption() *ServerOption {
 	s := ServerOption{}
@@ -61,23 +373,377 @@ func (s *ServerOption) AddFlags(fs *flag.FlagSet) {
 		`The namespace to monitor tfjobs. If unset, it monitors all namespaces cluster-wide.
                 If set, it only monitors tfjobs in the given namespace.`)
 
+	fs.Var((*stringSliceValue)(&s.Namespaces), "namespaces",
+		`Comma-separated namespaces to monitor tfjobs in, can be repeated.
+                It is merged with --namespace, one informer is started per namespace.`)
+
+	fs.Var((*int64MapValue)(&s.GPUQuotas), "namespace-gpu-quota",
+		`Maximum number of GPUs the running tfjobs of a namespace may request, in the form namespace=count.
+                Can be repeated. TFJobs exceeding the quota are queued until capacity frees.`)
+
 	fs.IntVar(&s.Threadiness, "threadiness", 1,
 		`How many threads to process the main logic`)
 
 	fs.BoolVar(&s.PrintVersion, "version", false, "Show version and quit")
 
 	fs.BoolVar(&s.JSONLogFormat, "json-log-format", true,
-		"Set true to use json style log format. Set false to use plaintext style log format")
+		"Set true to use json style log format. Set false to use plaintext style log format. Deprecated, use --log-format")
+	fs.StringVar(&s.LogFormat, "log-format", "",
+		`The format of the logs, json or text. It overrides --json-log-format.`)
+	fs.StringVar(&s.LogLevel, "log-level", "info",
+		`The minimum level of the logs: trace, debug, info, warning, error, fatal or panic.`)
 
 	fs.BoolVar(&s.EnableGangScheduling, "enable-gang-scheduling", false, "Set true to enable gang scheduling")
-	fs.StringVar(&s.GangSchedulerName, "gang-scheduler-name", "volcano", "The scheduler to gang-schedule tfjobs, defaults to volcano")
+	fs.StringVar(&s.GangSchedulerName, "gang-scheduler-name", "volcano", "The scheduler to gang-schedule tfjobs, defaults to volcano, kube-batch if empty")
+
+	fs.BoolVar(&s.EnableWorkerAntiAffinity, "enable-worker-anti-affinity", false,
+		"Set true to spread the worker pods of a tfjob across nodes with a soft pod anti-affinity")
+	fs.BoolVar(&s.EnablePodDisruptionBudget, "enable-pod-disruption-budget", false,
+		`Set true to protect the pods of all the tfjobs from voluntary disruptions, such as node drains, with a
+                PodDisruptionBudget while they run. A tfjob opts in on its own with its podDisruptionBudget spec or the
+                kubeflow.org/pod-disruption-budget annotation.`)
+	fs.StringVar(&s.PSAntiAffinity, "ps-anti-affinity", PSAntiAffinityNone,
+		`Spread the PS pods of the tfjobs with several PS replicas across nodes, so that they do not saturate the network
+                of a node: none, preferred injects a soft pod anti-affinity, required a hard one.`)
+
+	fs.StringVar(&s.JobLabelSelector, "job-label-selector", "",
+		`Only manage the tfjobs matching this label selector, e.g. shard=0.
+                The labels it refers to are copied to the pods and services of the tfjob.`)
+
+	fs.DurationVar(&s.QueueLatencyThreshold, "queue-latency-warning-threshold", DefaultQueueLatencyThreshold,
+		"Log a warning when a tfjob waits longer than this in the work queue before its sync starts. 0 disables the warning")
+
+	fs.IntVar(&s.MaxPodCreationsPerSync, "max-pod-creations-per-sync", 0,
+		`Maximum number of pods, and of services, created for a replica type of a tfjob in one sync.
+                The rest is created by the following syncs. 0 means no limit.`)
+
+	fs.IntVar(&s.MaxReplicas, "max-replicas", DefaultMaxReplicas,
+		`Maximum total number of replicas of a tfjob, summed over its replica types.
+                TFJobs with more replicas fail with an InvalidSpec condition instead of creating any pod.`)
+
+	fs.Float64Var(&s.StatusUpdateQPS, "status-update-qps", 0,
+		`Rate of the status updates which only change replica counters, shared by all tfjobs.
+                Terminal and other condition changes are not limited. 0 means no limit.`)
+	fs.IntVar(&s.StatusUpdateBurst, "status-update-burst", 10, "Maximum burst of the status updates limited by --status-update-qps.")
+
+	fs.DurationVar(&s.CleanupJitter, "cleanup-jitter", 0,
+		"Spread the deletions of the pods and services of completed tfjobs over this period. 0 deletes them right away")
+	fs.StringVar(&s.RecordExportSink, "record-export-sink", "",
+		`Export a record of each terminated tfjob, with its spec hash, conditions, durations, replica outcomes and image
+                digests, before it is deleted after its ttlSecondsAfterFinished: file:///path writes them to a directory, e.g. a
+                mounted PVC, s3://bucket/prefix?endpoint=https://host&region=region uploads them to an S3-compatible bucket
+                with the credentials of AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY. Empty disables the export.`)
+	fs.IntVar(&s.RecordExportMaxAttempts, "record-export-max-attempts", DefaultRecordExportMaxAttempts,
+		"Failed exports of the record of a tfjob after which it is deleted without its record. 0 retries forever")
+
+	fs.StringVar(&s.PodTemplateRestartPolicy, "pod-template-restart-policy", PodTemplateRestartPolicyWarn,
+		`How to handle a restart policy set in a pod template: warn overrides it with the replica restart policy,
+                error fails the tfjob, respect keeps it. With respect, the ExitCode replica restart policy only applies
+                when the template restart policy is Never, since the kubelet restarts the containers otherwise.`)
+	fs.DurationVar(&s.MissingPodTemplateTimeout, "missing-pod-template-timeout", DefaultMissingPodTemplateTimeout,
+		`Time a tfjob waits for a PodTemplate it references to exist, e.g. when it is created right after the tfjob,
+                before it fails with MissingReference`)
+
+	fs.StringVar(&s.DefaultPortName, "default-port-name", tfv1.DefaultPortName,
+		"Name of the port added to the tensorflow containers which do not declare it, and used in the cluster spec")
+	fs.IntVar(&s.DefaultPort, "default-port", tfv1.DefaultPort,
+		`Port added to the tensorflow containers which do not declare it. The default port is recorded in a tfjob
+                when it is first reconciled, so changing it does not affect the running tfjobs.`)
+
+	fs.Var((*stringSliceValue)(&s.PropagatedLabels), "propagate-labels",
+		`Comma-separated keys of the tfjob labels copied to its pods, can be repeated. "*" copies all the labels
+                outside of the kubeflow.org and kubernetes.io domains. The labels set by the operator are never overridden.`)
+	fs.Var((*stringSliceValue)(&s.PropagatedAnnotations), "propagate-annotations",
+		`Comma-separated keys of the tfjob annotations copied to its pods, can be repeated. "*" copies all the annotations
+                outside of the kubeflow.org and kubernetes.io domains. The annotations set by the operator are never overridden.`)
+
+	fs.DurationVar(&s.UnschedulableEventThreshold, "unschedulable-event-threshold", 0,
+		`Emit an event suggesting how to schedule the pods of a tfjob which have been unschedulable for longer than this,
+                comparing their requests with the resources of the nodes. It requires to list and watch the nodes. 0 disables it.`)
+	fs.DurationVar(&s.UnschedulableEventInterval, "unschedulable-event-interval", DefaultUnschedulableEventInterval,
+		"Minimum period between the unschedulable events of a tfjob")
+	fs.DurationVar(&s.ImagePullFailureTimeout, "image-pull-failure-timeout", DefaultImagePullFailureTimeout,
+		`Fail the tfjobs whose containers have kept failing to pull their image, or to be created, for longer than this,
+                e.g. in ImagePullBackOff or CreateContainerConfigError, instead of leaving them pending. 0 disables it, for the
+                clusters whose registries flake.`)
+	fs.DurationVar(&s.EventDedupeWindow, "event-dedupe-window", DefaultEventDedupeWindow,
+		`Period within which the events of the same reason about the same pod, e.g. the restarts of a crash-looping pod,
+                are emitted once on a tfjob. 0 disables the deduplication.`)
+	fs.IntVar(&s.ExternalDeletionThreshold, "external-deletion-threshold", DefaultExternalDeletionThreshold,
+		`Stop recreating the pods of a replica of a tfjob for --external-deletion-backoff once another agent than the operator
+                deleted them this many times within --external-deletion-window. 0 disables it.`)
+	fs.DurationVar(&s.ExternalDeletionWindow, "external-deletion-window", DefaultExternalDeletionWindow,
+		"Period within which the external deletions of the pods of a replica are counted")
+	fs.DurationVar(&s.ExternalDeletionBackoff, "external-deletion-backoff", DefaultExternalDeletionBackoff,
+		"Period the pods of a replica which keep being deleted externally are not recreated for")
+	fs.DurationVar(&s.MaxRestartBackoff, "max-restart-backoff", 0,
+		`Maximum delay before recreating the pod of a replica which failed with a retryable exit code under the ExitCode
+                restart policy. The delay starts at 10s and doubles with each consecutive restart of the replica, tracked in
+                the restartBackoffs of the tfjob status. 0 disables the backoff, the pods are recreated right away.`)
+	fs.DurationVar(&s.RestartBackoffStabilityWindow, "restart-backoff-stability-window", DefaultRestartBackoffStabilityWindow,
+		"Time a restarted pod must stay running for the restart backoff of its replica to be reset")
+	fs.StringVar(&s.ServiceDNSResolver, "service-dns-resolver", "",
+		`Address of the DNS server, typically the ClusterIP of the cluster DNS, e.g. 10.96.0.10:53, on which the names of
+                the PS and chief services of a tfjob are looked up before its workers are created, so that the workers do not
+                crash on their first connection while the services propagate. Empty disables the lookups.`)
+	fs.DurationVar(&s.ServiceDNSTimeout, "service-dns-timeout", DefaultServiceDNSTimeout,
+		"Time the workers of a tfjob wait for its services to resolve before they are created anyway")
+	fs.StringVar(&s.InitContainerImage, "init-container-image", "",
+		`Image of the init container injected into the Worker and Chief pods of the tfjobs with PS, which waits until the PS
+                services of TF_CONFIG resolve and accept TCP connections, so that the workers do not crash and use up their
+                backoff limit while the PS start. It must provide sh, nslookup and nc, e.g. busybox. Empty disables the injection,
+                as does the kubeflow.org/skip-ps-wait: "true" annotation of a tfjob.`)
+	fs.StringVar(&s.InitContainerCPU, "init-container-cpu", DefaultInitContainerCPU,
+		"CPU requested and limited by the init container of --init-container-image")
+	fs.StringVar(&s.InitContainerMemory, "init-container-memory", DefaultInitContainerMemory,
+		"Memory requested and limited by the init container of --init-container-image")
+	fs.BoolVar(&s.DisableServiceCreation, "disable-service-creation", false,
+		`Do not create the services of the tfjobs, e.g. for clusters whose service mesh or headless DNS is managed by their
+                users. TF_CONFIG still addresses each replica as <tfjob>-<type>-<index>.<namespace>.svc, so these names must
+                resolve, and the tfjobs whose pod templates set a hostname or a subdomain are rejected.`)
+	fs.StringVar(&s.ProgressAnnotation, "progress-annotation", tfv1.AnnotationProgress,
+		`Annotation the Worker pods of a tfjob may set to their training progress, as a fraction between 0 and 1,
+                whose minimum and average over the Workers are published in the trainingProgress of the tfjob status.`)
+
+	fs.StringVar(&s.PSFailurePolicy, "ps-failure-policy", PSFailurePolicyFail,
+		`How to handle a PS pod failing with a non-retryable exit code when the restart policy is Never or ExitCode:
+                fail fails the tfjob naming the failed PS replicas, restart recreates the PS pod for the tfjobs which tolerate it.`)
+	fs.StringVar(&s.StaleServiceEndpointsPolicy, "stale-service-endpoints-policy", StaleServiceEndpointsPolicyWait,
+		`How to handle the services of a tfjob recreated with the same name whose endpoints still reference the terminating
+                pods of the previous tfjob, since the services select the pods by labels: wait does not create the missing pods of
+                the tfjob until the endpoints drain, with a StaleServiceEndpoints condition, recreate deletes the services so that
+                they are created again. It requires to list and watch the endpoints.`)
+	fs.StringVar(&s.NameTemplate, "name-template", jobcontroller.DefaultNameTemplate,
+		`Template of the names of the pods and services of the replicas of the tfjobs, also used in TF_CONFIG, where {job},
+                {type} and {index} are replaced by the name of the tfjob, the lower case replica type and the replica index. Each
+                placeholder must appear once, separated from the others by a literal containing a dash, and the names must be valid
+                DNS-1035 labels. It must not be changed while tfjobs run, since their services keep the names they were created with.`)
+	fs.BoolVar(&s.V1beta2Compatibility, "v1beta2-compatibility", false,
+		`Manage the pods and services the v1beta2 operator created for the running tfjobs before an in-place upgrade, which
+                lack the job-name and controller-name labels, instead of reporting their pods as stranded and recreating their
+                services. The new pods and services follow the v1 conventions, and the MixedMode condition of the tfjobs tells
+                how many legacy ones remain.`)
+	fs.BoolVar(&s.ExemptPreemptions, "exempt-preemptions", true,
+		`Recreate the pods of the tfjobs which failed because they were evicted or preempted, e.g. by higher priority pods,
+                without counting them as failed replicas or restarts, so that they neither exhaust the backoff limit nor fail the tfjob.`)
+	fs.BoolVar(&s.EnableNodeFailureRecovery, "enable-node-failure-recovery", false,
+		`Force delete the pods of the tfjobs whose node has been NotReady or Unknown for longer than --node-failure-grace-period,
+                instead of waiting for the kubelet to confirm their deletion, so that they are recreated on another node.
+                It requires to list and watch the nodes.`)
+	fs.DurationVar(&s.NodeFailureGracePeriod, "node-failure-grace-period", DefaultNodeFailureGracePeriod,
+		"Time the node of a pod may stay NotReady or Unknown before the pod is force deleted, with --enable-node-failure-recovery")
+	fs.IntVar(&s.AuditMaxEntries, "audit-max-entries", DefaultAuditMaxEntries,
+		`Number of entries kept in the <name>-audit ConfigMap of the tfjobs annotated with kubeflow.org/audit: "true", which
+                records the actions of the operator on them, the oldest entries being dropped first. 0 disables the audit.`)
+
+	fs.StringVar(&s.PodDefaultsConfigMap, "pod-defaults-configmap", "",
+		`Namespace/name of a ConfigMap whose podTemplate key holds a partial pod template in YAML, e.g. a priorityClassName,
+                resources or tolerations, merged into the pods of the tfjobs. The values of the tfjob templates take precedence.
+                The changes of the ConfigMap apply to the pods created afterwards.`)
+
+	fs.Var((*stringMapValue)(&s.ReplicaNodePools), "replica-node-config",
+		`Node pools the pods of replica types are scheduled on, in the form Worker=gpu-pool,PS=cpu-pool. Can be repeated.
+                The pools are defined in --node-pools-configmap. The pods requesting GPUs of the other replica types get
+                the toleration of the nvidia.com/gpu taint. The tolerations the tfjob templates specify are kept.`)
+	fs.StringVar(&s.NodePoolsConfigMap, "node-pools-configmap", "",
+		`Namespace/name of a ConfigMap whose keys are node pool names, each holding the nodeSelector and the tolerations
+                of the pool in YAML. The changes of the ConfigMap apply to the pods created afterwards.`)
+	fs.StringVar(&s.DataAccessConfigMap, "data-access-configmap", "",
+		`Namespace/name of a ConfigMap whose keys are data access profile names, each holding in YAML the volumes,
+                volumeMounts and env injected into the tensorflow container of the pods of the tfjobs labeled with
+                --data-access-label, e.g. the projection of cloud storage credentials. The optional replicaTypes limit
+                the injection to the pods of these replica types. The changes of the ConfigMap apply to the pods created afterwards.`)
+	fs.StringVar(&s.DataAccessLabel, "data-access-label", DefaultDataAccessLabel,
+		"Label of the tfjobs whose value is the name of the data access profile injected into their pods")
+	fs.StringVar(&s.OperatorSidecarConfigMap, "sidecar-configmap", "",
+		`Namespace/name of a ConfigMap whose sidecar key holds in YAML the container, e.g. a logging or metrics agent,
+                and its volumes injected into the pods of the tfjobs, optionally only those of the given replicaTypes.
+                The sidecars of the tfjobs of the same name take precedence. The completion of the replicas is still given
+                by their tensorflow container. The changes of the ConfigMap apply to the pods created afterwards.`)
+	fs.StringVar(&s.SecurityContextConfigMap, "security-context-configmap", "",
+		`Namespace/name of a ConfigMap whose securityContext key holds in YAML the podSecurityContext and the
+                containerSecurityContext merged into the pods of the tfjobs and all their containers, e.g. runAsNonRoot and
+                fsGroup, optionally overridden for the given replicaTypes. The tfjobs of the namespaces matching its
+                exemptNamespaceSelector get no defaults, which requires the operator to list the namespaces. The values of
+                the tfjob templates take precedence. The changes of the ConfigMap apply to the pods created afterwards.`)
+	fs.BoolVar(&s.SecurityContextStrict, "security-context-strict", false,
+		`Enforce the defaults of --security-context-configmap: the tfjobs whose templates or sidecars set conflicting
+                values fail with the SecurityContextConflict reason instead of keeping their values.`)
 
 	fs.IntVar(&s.MonitoringPort, "monitoring-port", 8443,
 		`Endpoint port for displaying monitoring metrics. 
 It can be set to "0" to disable the metrics serving.`)
+	fs.BoolVar(&s.EnableStatusAPI, "enable-status-api", false,
+		`Serve the read-only status API on --status-api-port: GET /api/v1/namespaces/<namespace>/tfjobs and
+                /api/v1/namespaces/<namespace>/tfjobs/<name> return the tfjobs with the phases, nodes and restart counts of
+                their pods, from the caches of the operator. The list is paginated by the limit and continue parameters.`)
+	fs.IntVar(&s.StatusAPIPort, "status-api-port", DefaultStatusAPIPort, "Port of the status API")
+	fs.StringVar(&s.HealthProbeAddress, "health-probe-address", DefaultHealthProbeAddress,
+		`Address the health probes are served on: GET /healthz returns 200 while the operator is serving, GET /readyz
+                returns 200 once the caches of the operator are synced and 503 before. It can be set to "" to disable them.`)
 
 	fs.DurationVar(&s.ResyncPeriod, "resyc-period", DefaultResyncPeriod, "Resync interval of the tf-operator")
 
+	fs.DurationVar(&s.ReconcilerSyncPeriod, "resync-period", DefaultReconcilerSyncPeriod,
+		`Period after which the tfjobs waiting for a state change, e.g. queued for the GPU quota, are synced again.
+                A shorter period keeps their status fresher, a longer one avoids bursts of syncs on large clusters.
+                Not to be confused with --resyc-period, the resync interval of the informers.`)
+
 	fs.IntVar(&s.QPS, "qps", 5, "QPS indicates the maximum QPS to the master from this client.")
 	fs.IntVar(&s.Burst, "burst", 10, "Maximum burst for throttle.")
 }
+
+// WatchedNamespaces returns the sorted, deduplicated namespaces the operator
+// is scoped to. An empty result means all namespaces are monitored.
+func (s *ServerOption) WatchedNamespaces() []string {
+	set := make(map[string]bool)
+	if s.Namespace != v1.NamespaceAll {
+		set[s.Namespace] = true
+	}
+	for _, ns := range s.Namespaces {
+		if ns != v1.NamespaceAll {
+			set[ns] = true
+		}
+	}
+	namespaces := make([]string, 0, len(set))
+	for ns := range set {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// redactedValue replaces the sensitive values of the options.
+const redactedValue = "REDACTED"
+
+// Redacted returns a copy of the options whose sensitive values, i.e. the
+// credentials in the master URL, are replaced, so that they can be logged.
+func (s *ServerOption) Redacted() ServerOption {
+	redacted := *s
+	if s.MasterURL == "" {
+		return redacted
+	}
+	u, err := url.Parse(s.MasterURL)
+	if err != nil {
+		redacted.MasterURL = redactedValue
+		return redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redactedValue)
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redactedValue
+	}
+	redacted.MasterURL = u.String()
+	return redacted
+}
+
+// Fields returns the redacted options keyed by their names, to be logged as
+// structured fields. The durations are formatted as strings.
+func (s *ServerOption) Fields() map[string]interface{} {
+	redacted := reflect.ValueOf(s.Redacted())
+	fields := make(map[string]interface{}, redacted.NumField())
+	for i := 0; i < redacted.NumField(); i++ {
+		value := redacted.Field(i).Interface()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		fields[redacted.Type().Field(i).Name] = value
+	}
+	return fields
+}
+
+// ConfigHash returns a short hash of the redacted options, which is the same
+// for the operators running with the same options, across restarts.
+func (s *ServerOption) ConfigHash() string {
+	// The fields are marshaled in their declaration order, and the keys of
+	// the maps sorted.
+	data, err := json.Marshal(s.Redacted())
+	if err != nil {
+		// The options only hold marshalable values.
+		panic(err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// stringSliceValue is a flag.Value which accumulates comma-separated values
+// across repeated flags.
+type stringSliceValue []string
+
+func (v *stringSliceValue) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *stringSliceValue) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
+
+// stringMapValue is a flag.Value which accumulates key=value pairs
+// across repeated flags.
+type stringMapValue map[string]string
+
+func (v *stringMapValue) String() string {
+	pairs := make([]string, 0, len(*v))
+	for key, value := range *v {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v *stringMapValue) Set(value string) error {
+	if *v == nil {
+		*v = make(map[string]string)
+	}
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return fmt.Errorf("invalid pair %q, expected key=value", pair)
+		}
+		(*v)[kv[0]] = kv[1]
+	}
+	return nil
+}
+
+// int64MapValue is a flag.Value which accumulates key=value pairs
+// across repeated flags.
+type int64MapValue map[string]int64
+
+func (v *int64MapValue) String() string {
+	pairs := make([]string, 0, len(*v))
+	for key, value := range *v {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v *int64MapValue) Set(value string) error {
+	if *v == nil {
+		*v = make(map[string]int64)
+	}
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid pair %q, expected key=value", pair)
+		}
+		n, err := strconv.ParseInt(kv[1], 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid value in %q, expected a non-negative integer", pair)
+		}
+		(*v)[kv[0]] = n
+	}
+	return nil
+}
@@ -17,7 +17,9 @@ package app
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
@@ -25,7 +27,10 @@ import (
 	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
 	"github.com/kubeflow/tf-operator/pkg/client/clientset/versioned/scheme"
 	tfjobinformers "github.com/kubeflow/tf-operator/pkg/client/informers/externalversions"
+	tfjobinformersv1 "github.com/kubeflow/tf-operator/pkg/client/informers/externalversions/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
 	controller "github.com/kubeflow/tf-operator/pkg/controller.v1/tensorflow"
+	"github.com/kubeflow/tf-operator/pkg/export"
 	"github.com/kubeflow/tf-operator/pkg/util/signals"
 	"github.com/kubeflow/tf-operator/pkg/version"
 	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
@@ -34,11 +39,16 @@ import (
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/validation"
 	kubeinformers "k8s.io/client-go/informers"
 	kubeclientset "k8s.io/client-go/kubernetes"
 	restclientset "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	election "k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
@@ -63,6 +73,10 @@ var (
 		Name: "tf_operator_is_leader",
 		Help: "Is this client the leader of this tf-operator client set?",
 	})
+	configHash = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tf_operator_config_hash",
+		Help: "Set to 1 for the hash of the options the tf-operator runs with, to detect config drift across operators",
+	}, []string{"hash"})
 )
 
 func Run(opt *options.ServerOption) error {
@@ -76,10 +90,11 @@ func Run(opt *options.ServerOption) error {
 		log.Infof("EnvKubeflowNamespace not set, use default namespace")
 		namespace = metav1.NamespaceDefault
 	}
-	if opt.Namespace == corev1.NamespaceAll {
+	watchedNamespaces := opt.WatchedNamespaces()
+	if len(watchedNamespaces) == 0 {
 		log.Info("Using cluster scoped operator")
 	} else {
-		log.Infof("Scoping operator to namespace %s", opt.Namespace)
+		log.Infof("Scoping operator to namespaces %v", watchedNamespaces)
 	}
 
 	// To help debugging, immediately log version.
@@ -95,6 +110,12 @@ func Run(opt *options.ServerOption) error {
 		opt.Kubeconfig = os.Getenv(RecommendedKubeConfigPathEnv)
 	}
 
+	// Dump the resolved options, since the flags are not always at hand when
+	// comparing the behaviors of operators.
+	hash := opt.ConfigHash()
+	log.WithFields(opt.Fields()).WithField("configHash", hash).Info("Running with the resolved options")
+	configHash.WithLabelValues(hash).Set(1)
+
 	// Get kubernetes config.
 	kcfg, err := clientcmd.BuildConfigFromFlags(opt.MasterURL, opt.Kubeconfig)
 	if err != nil {
@@ -111,26 +132,188 @@ func Run(opt *options.ServerOption) error {
 	if err != nil {
 		return err
 	}
-	if !checkCRDExists(tfJobClientSet, opt.Namespace) {
-		log.Info("CRD doesn't exist. Exiting")
-		os.Exit(1)
+	// An empty namespace means that all namespaces are watched.
+	informerNamespaces := watchedNamespaces
+	if len(informerNamespaces) == 0 {
+		informerNamespaces = []string{corev1.NamespaceAll}
 	}
-	// Create informer factory.
-	kubeInformerFactory := kubeinformers.NewFilteredSharedInformerFactory(kubeClientSet, opt.ResyncPeriod, opt.Namespace, nil)
-	tfJobInformerFactory := tfjobinformers.NewSharedInformerFactory(tfJobClientSet, opt.ResyncPeriod)
-
-	unstructuredInformer := controller.NewUnstructuredTFJobInformer(kcfg, opt.Namespace)
+	for _, namespace := range informerNamespaces {
+		if !checkCRDExists(tfJobClientSet, namespace) {
+			log.Infof("CRD doesn't exist in namespace %q. Exiting", namespace)
+			os.Exit(1)
+		}
+	}
+	// Only list and watch the tfjobs, pods, services and ConfigMaps of this
+	// operator shard.
+	// The other kinds, e.g. the PodTemplates, are not labeled by the operator
+	// and are listed and watched regardless of the selector.
+	var tweakListOptions func(*metav1.ListOptions)
+	if len(opt.JobLabelSelector) > 0 {
+		if _, err := labels.Parse(opt.JobLabelSelector); err != nil {
+			return fmt.Errorf("invalid job label selector %q: %v", opt.JobLabelSelector, err)
+		}
+		log.Infof("Sharding operator by job label selector %q", opt.JobLabelSelector)
+		tweakListOptions = func(options *metav1.ListOptions) {
+			options.LabelSelector = opt.JobLabelSelector
+		}
+	}
+	switch opt.PodTemplateRestartPolicy {
+	case options.PodTemplateRestartPolicyWarn, options.PodTemplateRestartPolicyError, options.PodTemplateRestartPolicyRespect:
+	default:
+		return fmt.Errorf("invalid pod template restart policy %q, expected %s, %s or %s", opt.PodTemplateRestartPolicy,
+			options.PodTemplateRestartPolicyWarn, options.PodTemplateRestartPolicyError, options.PodTemplateRestartPolicyRespect)
+	}
+	switch opt.PSFailurePolicy {
+	case options.PSFailurePolicyFail, options.PSFailurePolicyRestart:
+	default:
+		return fmt.Errorf("invalid PS failure policy %q, expected %s or %s", opt.PSFailurePolicy,
+			options.PSFailurePolicyFail, options.PSFailurePolicyRestart)
+	}
+	switch opt.StaleServiceEndpointsPolicy {
+	case options.StaleServiceEndpointsPolicyWait, options.StaleServiceEndpointsPolicyRecreate:
+	default:
+		return fmt.Errorf("invalid stale service endpoints policy %q, expected %s or %s", opt.StaleServiceEndpointsPolicy,
+			options.StaleServiceEndpointsPolicyWait, options.StaleServiceEndpointsPolicyRecreate)
+	}
+	switch opt.PSAntiAffinity {
+	case options.PSAntiAffinityNone, options.PSAntiAffinityPreferred, options.PSAntiAffinityRequired:
+	default:
+		return fmt.Errorf("invalid PS anti-affinity %q, expected %s, %s or %s", opt.PSAntiAffinity,
+			options.PSAntiAffinityNone, options.PSAntiAffinityPreferred, options.PSAntiAffinityRequired)
+	}
+	if errs := validation.IsValidPortName(opt.DefaultPortName); len(errs) > 0 {
+		return fmt.Errorf("invalid default port name %q: %s", opt.DefaultPortName, strings.Join(errs, ", "))
+	}
+	if errs := validation.IsValidPortNum(opt.DefaultPort); len(errs) > 0 {
+		return fmt.Errorf("invalid default port %d: %s", opt.DefaultPort, strings.Join(errs, ", "))
+	}
+	if err := jobcontroller.ValidateNameTemplate(opt.NameTemplate); err != nil {
+		return fmt.Errorf("invalid name template %q: %v", opt.NameTemplate, err)
+	}
+	if opt.InitContainerImage != "" {
+		if _, err := resource.ParseQuantity(opt.InitContainerCPU); err != nil {
+			return fmt.Errorf("invalid init container cpu %q: %v", opt.InitContainerCPU, err)
+		}
+		if _, err := resource.ParseQuantity(opt.InitContainerMemory); err != nil {
+			return fmt.Errorf("invalid init container memory %q: %v", opt.InitContainerMemory, err)
+		}
+	}
+	if opt.AuditMaxEntries < 0 {
+		return fmt.Errorf("invalid audit max entries %d, expected a non-negative number", opt.AuditMaxEntries)
+	}
+	if opt.EnableNodeFailureRecovery && opt.NodeFailureGracePeriod <= 0 {
+		return fmt.Errorf("invalid node failure grace period %v, expected a positive duration", opt.NodeFailureGracePeriod)
+	}
+	if len(opt.ReplicaNodePools) > 0 && opt.NodePoolsConfigMap == "" {
+		return fmt.Errorf("--replica-node-config requires --node-pools-configmap")
+	}
+	for rtype := range opt.ReplicaNodePools {
+		if !isValidReplicaType(rtype) {
+			return fmt.Errorf("invalid replica type %q in --replica-node-config", rtype)
+		}
+	}
+	if errs := validation.IsQualifiedName(opt.DataAccessLabel); opt.DataAccessConfigMap != "" && len(errs) > 0 {
+		return fmt.Errorf("invalid data access label %q: %s", opt.DataAccessLabel, strings.Join(errs, ", "))
+	}
+	// Create one informer factory per namespace.
+	kubeInformerFactories := make(map[string]kubeinformers.SharedInformerFactory)
+	unstructuredInformers := make(map[string]tfjobinformersv1.TFJobInformer)
+	for _, ns := range informerNamespaces {
+		kubeInformerFactories[ns] = controller.NewShardedKubeInformerFactory(kubeClientSet, opt.ResyncPeriod, ns, tweakListOptions)
+		unstructuredInformers[ns] = controller.NewFilteredUnstructuredTFJobInformer(kcfg, ns, tweakListOptions)
+	}
+	tfJobInformerFactory := tfjobinformers.NewSharedInformerFactoryWithOptions(tfJobClientSet, opt.ResyncPeriod,
+		tfjobinformers.WithTweakListOptions(tweakListOptions))
 
 	// Create tf controller.
-	tc := controller.NewTFController(unstructuredInformer, kubeClientSet, kubeBatchClientSet, tfJobClientSet, kubeInformerFactory, tfJobInformerFactory, *opt)
+	tc := controller.NewMultiNamespaceTFController(unstructuredInformers, kubeClientSet, kubeBatchClientSet, tfJobClientSet, kubeInformerFactories, tfJobInformerFactory, *opt)
+
+	if opt.UnschedulableEventThreshold > 0 || opt.EnableNodeFailureRecovery {
+		// The nodes are listed cluster-wide, regardless of the job label selector.
+		nodeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClientSet, opt.ResyncPeriod)
+		tc.WatchNodes(nodeInformerFactory.Core().V1().Nodes())
+		go nodeInformerFactory.Start(stopCh)
+	}
+
+	if opt.RecordExportSink != "" {
+		sink, err := export.NewSink(opt.RecordExportSink)
+		if err != nil {
+			return fmt.Errorf("invalid record export sink: %v", err)
+		}
+		tc.ExportRecords(sink)
+	}
+
+	if opt.PodDefaultsConfigMap != "" {
+		configMapInformerFactory, namespace, name, err := newConfigMapInformerFactory(kubeClientSet, opt.ResyncPeriod, opt.PodDefaultsConfigMap)
+		if err != nil {
+			return fmt.Errorf("invalid pod defaults ConfigMap: %v", err)
+		}
+		tc.WatchPodDefaults(configMapInformerFactory.Core().V1().ConfigMaps(), namespace, name)
+		go configMapInformerFactory.Start(stopCh)
+	}
+
+	if opt.NodePoolsConfigMap != "" {
+		configMapInformerFactory, namespace, name, err := newConfigMapInformerFactory(kubeClientSet, opt.ResyncPeriod, opt.NodePoolsConfigMap)
+		if err != nil {
+			return fmt.Errorf("invalid node pools ConfigMap: %v", err)
+		}
+		tc.WatchNodePools(configMapInformerFactory.Core().V1().ConfigMaps(), namespace, name)
+		go configMapInformerFactory.Start(stopCh)
+	}
+
+	if opt.DataAccessConfigMap != "" {
+		configMapInformerFactory, namespace, name, err := newConfigMapInformerFactory(kubeClientSet, opt.ResyncPeriod, opt.DataAccessConfigMap)
+		if err != nil {
+			return fmt.Errorf("invalid data access ConfigMap: %v", err)
+		}
+		tc.WatchDataAccess(configMapInformerFactory.Core().V1().ConfigMaps(), namespace, name)
+		go configMapInformerFactory.Start(stopCh)
+	}
+
+	if opt.OperatorSidecarConfigMap != "" {
+		configMapInformerFactory, namespace, name, err := newConfigMapInformerFactory(kubeClientSet, opt.ResyncPeriod, opt.OperatorSidecarConfigMap)
+		if err != nil {
+			return fmt.Errorf("invalid sidecar ConfigMap: %v", err)
+		}
+		tc.WatchOperatorSidecar(configMapInformerFactory.Core().V1().ConfigMaps(), namespace, name)
+		go configMapInformerFactory.Start(stopCh)
+	}
+
+	if opt.SecurityContextConfigMap != "" {
+		configMapInformerFactory, namespace, name, err := newConfigMapInformerFactory(kubeClientSet, opt.ResyncPeriod, opt.SecurityContextConfigMap)
+		if err != nil {
+			return fmt.Errorf("invalid security context ConfigMap: %v", err)
+		}
+		// The namespaces are listed cluster-wide, regardless of the job label selector.
+		namespaceInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClientSet, opt.ResyncPeriod)
+		tc.WatchSecurityContext(configMapInformerFactory.Core().V1().ConfigMaps(), namespaceInformerFactory.Core().V1().Namespaces(), namespace, name)
+		go configMapInformerFactory.Start(stopCh)
+		go namespaceInformerFactory.Start(stopCh)
+	} else if opt.SecurityContextStrict {
+		return fmt.Errorf("--security-context-strict requires --security-context-configmap")
+	}
 
 	// Start informer goroutines.
-	go kubeInformerFactory.Start(stopCh)
+	for ns := range kubeInformerFactories {
+		go kubeInformerFactories[ns].Start(stopCh)
+
+		// We do not use the generated informer because of
+		// https://github.com/kubeflow/tf-operator/issues/561
+		// go tfJobInformerFactory.Start(stopCh)
+		go unstructuredInformers[ns].Informer().Run(stopCh)
+	}
+
+	if opt.HealthProbeAddress != "" {
+		// The probes are served by all the replicas of the operator, since
+		// the standby replicas sync their caches as well.
+		go serveHealthProbes(opt.HealthProbeAddress, tc.HealthHandler())
+	}
 
-	// We do not use the generated informer because of
-	// https://github.com/kubeflow/tf-operator/issues/561
-	// go tfJobInformerFactory.Start(stopCh)
-	go unstructuredInformer.Informer().Run(stopCh)
+	if opt.EnableStatusAPI {
+		// The status API is served from the caches by all the replicas of
+		// the operator, not only the leader.
+		go serveStatusAPI(opt.StatusAPIPort, tc.StatusAPIHandler())
+	}
 
 	// Set leader election start function.
 	run := func(context.Context) {
@@ -184,6 +367,47 @@ func Run(opt *options.ServerOption) error {
 	return nil
 }
 
+// serveStatusAPI serves the read-only status API of the tfjobs on the port.
+func serveStatusAPI(port int, handler http.Handler) {
+	log.Infof("Serving the status API on port %d", port)
+	server := &http.Server{
+		Addr:         fmt.Sprintf(":%d", port),
+		Handler:      handler,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		log.Errorf("Failed to serve the status API: %v", err)
+	}
+}
+
+// newConfigMapInformerFactory returns an informer factory which only watches
+// the ConfigMap of the namespace/name key, with its namespace and name.
+func newConfigMapInformerFactory(kubeClientSet kubeclientset.Interface, resyncPeriod time.Duration, key string) (kubeinformers.SharedInformerFactory, string, string, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil || namespace == "" || name == "" {
+		return nil, "", "", fmt.Errorf("invalid ConfigMap %q, expected namespace/name", key)
+	}
+	factory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClientSet, resyncPeriod,
+		kubeinformers.WithNamespace(namespace),
+		kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}))
+	return factory, namespace, name, nil
+}
+
+// isValidReplicaType returns true if the replica type, in any case, is a
+// replica type of the tfjobs.
+func isValidReplicaType(rtype string) bool {
+	for _, t := range []v1.TFReplicaType{v1.TFReplicaTypePS, v1.TFReplicaTypeWorker, v1.TFReplicaTypeChief,
+		v1.TFReplicaTypeMaster, v1.TFReplicaTypeEval} {
+		if strings.EqualFold(rtype, string(t)) {
+			return true
+		}
+	}
+	return false
+}
+
 func createClientSets(config *restclientset.Config) (kubeclientset.Interface, kubeclientset.Interface, tfjobclientset.Interface, kubebatchclient.Interface, error) {
 
 	kubeClientSet, err := kubeclientset.NewForConfig(restclientset.AddUserAgent(config, "tf-operator"))
@@ -221,3 +445,17 @@ func checkCRDExists(clientset tfjobclientset.Interface, namespace string) bool {
 	}
 	return true
 }
+
+// serveHealthProbes serves the health probes of the operator on the address.
+func serveHealthProbes(addr string, handler http.Handler) {
+	log.Infof("Serving the health probes on %s", addr)
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		log.Errorf("Failed to serve the health probes: %v", err)
+	}
+}
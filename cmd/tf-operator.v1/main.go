@@ -49,15 +49,41 @@ func startMonitoring(monitoringPort int) {
 	}
 }
 
+// configureLogging sets the format and the level of the logs.
+func configureLogging(s *options.ServerOption) error {
+	format := s.LogFormat
+	if format == "" {
+		format = options.LogFormatText
+		if s.JSONLogFormat {
+			format = options.LogFormatJSON
+		}
+	}
+	switch format {
+	case options.LogFormatJSON:
+		// Output logs in a json format so that it can be parsed by services like Stackdriver.
+		log.SetFormatter(&log.JSONFormatter{})
+	case options.LogFormatText:
+		log.SetFormatter(&log.TextFormatter{})
+	default:
+		return fmt.Errorf("invalid log format %q, expected %s or %s", s.LogFormat, options.LogFormatJSON, options.LogFormatText)
+	}
+
+	level, err := log.ParseLevel(s.LogLevel)
+	if err != nil {
+		return fmt.Errorf("invalid log level: %v", err)
+	}
+	log.SetLevel(level)
+	return nil
+}
+
 func main() {
 	s := options.NewServerOption()
 	s.AddFlags(flag.CommandLine)
 
 	flag.Parse()
 
-	if s.JSONLogFormat {
-		// Output logs in a json format so that it can be parsed by services like Stackdriver.
-		log.SetFormatter(&log.JSONFormatter{})
+	if err := configureLogging(s); err != nil {
+		log.Fatalf("%v\n", err)
 	}
 
 	startMonitoring(s.MonitoringPort)
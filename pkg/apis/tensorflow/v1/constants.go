@@ -31,4 +31,187 @@ const (
 	DefaultPort = 2222
 	// DefaultRestartPolicy is default RestartPolicy for TFReplicaSpec.
 	DefaultRestartPolicy = common.RestartPolicyNever
+
+	// ResourceGPU is the name of the GPU resource requested by replicas.
+	ResourceGPU = "nvidia.com/gpu"
+
+	// AnnotationDisableWorkerAntiAffinity disables the worker pod anti-affinity
+	// injected by the operator for a single TFJob when set to "true".
+	AnnotationDisableWorkerAntiAffinity = "kubeflow.org/disable-worker-anti-affinity"
+
+	// AnnotationTopologyKey is the TFJob annotation holding a node label key,
+	// e.g. topology.kubernetes.io/zone, whose value the pods of the TFJob
+	// prefer to share, so that they are co-located in one zone or rack. The
+	// pod affinity is required instead when AnnotationTopologyRequired is
+	// "true". A required affinity is satisfied by the first pod of the TFJob
+	// on its own, so it holds with gang scheduling too.
+	AnnotationTopologyKey      = "kubeflow.org/topology-key"
+	AnnotationTopologyRequired = "kubeflow.org/topology-required"
+
+	// AnnotationPodDisruptionBudget protects the pods of a TFJob with a
+	// PodDisruptionBudget when set to "true", as its PodDisruptionBudget spec
+	// does.
+	AnnotationPodDisruptionBudget = "kubeflow.org/pod-disruption-budget"
+
+	// AnnotationReplicaIdentity is the pod annotation holding the identity of
+	// the replica, which is stable across recreations of the pod.
+	AnnotationReplicaIdentity = "kubeflow.org/replica-identity"
+	// AnnotationAttempt is the pod annotation holding the number of times the
+	// operator has recreated the pod of the replica.
+	AnnotationAttempt = "kubeflow.org/attempt"
+	// EnvReplicaIdentity is ENV for the value of AnnotationReplicaIdentity.
+	EnvReplicaIdentity = "KUBEFLOW_REPLICA_IDENTITY"
+	// EnvAttempt is ENV for the value of AnnotationAttempt.
+	EnvAttempt = "KUBEFLOW_ATTEMPT"
+
+	// AnnotationTFConfigPath is the TFJob annotation holding the absolute path
+	// of a file to write TF_CONFIG to, instead of setting the TF_CONFIG env.
+	// The directory of the file is mounted read-only in the tensorflow container.
+	AnnotationTFConfigPath = "kubeflow.org/tf-config-path"
+	// AnnotationTFConfig is the pod annotation holding TF_CONFIG when it is
+	// written to a file, which is projected by a downward API volume.
+	AnnotationTFConfig = "kubeflow.org/tf-config"
+	// EnvTFConfigFile is ENV for the path of the file holding TF_CONFIG. When
+	// the cluster spec is passed via a ConfigMap, the file only holds the
+	// cluster spec and TF_CONFIG the task, which is merged over the file.
+	EnvTFConfigFile = "TF_CONFIG_FILE"
+
+	// AnnotationSidecars is the pod annotation holding the comma separated
+	// names of the sidecars of the TFJob added to the pod.
+	AnnotationSidecars = "kubeflow.org/sidecars"
+
+	// AnnotationDefaultPortName and AnnotationDefaultPort are the TFJob
+	// annotations recording the default port of its tensorflow container when
+	// it is first reconciled, so that a later change of the default of the
+	// operator does not change the cluster spec of the running TFJob.
+	AnnotationDefaultPortName = "kubeflow.org/default-port-name"
+	AnnotationDefaultPort     = "kubeflow.org/default-port"
+
+	// AnnotationCoordinator is the TFJob annotation recording the replica
+	// elected as its coordinator when it is first reconciled, e.g. chief-0,
+	// or worker-0 if it has no Chief or Master, so that the pods keep the
+	// same master for the lifetime of the TFJob.
+	AnnotationCoordinator = "kubeflow.org/coordinator"
+
+	// AnnotationPaused is the TFJob annotation which, set to "true", stops
+	// the creation of its missing pods, keeping the existing ones, until it
+	// is removed.
+	AnnotationPaused = "kubeflow.org/paused"
+
+	// AnnotationStatusDiff is the annotation of the events recording the
+	// status transitions of a TFJob, holding the changes of its conditions,
+	// replica counters and start and completion times as compact JSON.
+	AnnotationStatusDiff = "kubeflow.org/status-diff"
+
+	// AnnotationDeletedBy is the pod annotation an agent deleting the pods of
+	// a TFJob may set to identify itself, reported when the TFJob stops
+	// recreating the pods it keeps deleting.
+	AnnotationDeletedBy = "kubeflow.org/deleted-by"
+
+	// AnnotationEvacuateNodes is the TFJob annotation holding the comma
+	// separated names of the nodes its pods are evacuated from, e.g. for
+	// their maintenance. The pods on these nodes are deleted and recreated
+	// with a node affinity excluding them. AnnotationEvacuate is the pod
+	// annotation which, set to "true", evacuates the pod from its node.
+	AnnotationEvacuateNodes = "kubeflow.org/evacuate-nodes"
+	AnnotationEvacuate      = "kubeflow.org/evacuate"
+
+	// AnnotationSkipPSWait is the TFJob annotation which, set to "true",
+	// skips the init container the operator injects into the Worker and
+	// Chief pods to wait for the PS.
+	AnnotationSkipPSWait = "kubeflow.org/skip-ps-wait"
+
+	// AnnotationAudit is the TFJob annotation which, set to "true", records
+	// the actions of the operator on the TFJob, such as the creation and
+	// deletion of its pods and services and its status transitions, in its
+	// <name>-audit ConfigMap, dropping the oldest entries beyond a cap.
+	AnnotationAudit = "kubeflow.org/audit"
+
+	// AnnotationProgress is the default annotation the Worker pods of a
+	// TFJob may set to report their training progress, as a fraction
+	// between 0 and 1, e.g. "0.42".
+	AnnotationProgress = "kubeflow.org/progress"
+
+	// AnnotationSyncRequest is the TFJob annotation whose change, to any new
+	// value, syncs the TFJob right away. The value is echoed in the
+	// lastSyncRequest of its status once it has been synced. It is not part
+	// of the spec of the TFJob.
+	AnnotationSyncRequest = "kubeflow.org/sync-request"
+
+	// The annotations of the events emitted when the pods of a replica type
+	// of a TFJob stay unschedulable. AnnotationUnschedulableReplicaType holds
+	// the replica type, AnnotationUnschedulablePods the number of its pods
+	// which are unschedulable, and AnnotationUnschedulableReasons the reasons
+	// reported by the scheduler with the number of pods for each.
+	// AnnotationRequestedResources holds the resources requested per pod, and
+	// AnnotationLargestAllocatable the largest allocatable amount of each of
+	// them on a node the pods may be scheduled to, both as comma separated
+	// name=quantity pairs. AnnotationSchedulingSuggestion holds one of the
+	// SchedulingSuggestion values.
+	AnnotationUnschedulableReplicaType = "kubeflow.org/unschedulable-replica-type"
+	AnnotationUnschedulablePods        = "kubeflow.org/unschedulable-pods"
+	AnnotationUnschedulableReasons     = "kubeflow.org/unschedulable-reasons"
+	AnnotationRequestedResources       = "kubeflow.org/requested-resources"
+	AnnotationLargestAllocatable       = "kubeflow.org/largest-allocatable"
+	AnnotationSchedulingSuggestion     = "kubeflow.org/scheduling-suggestion"
+)
+
+// The values of AnnotationSchedulingSuggestion.
+const (
+	// SchedulingSuggestionReduceRequests means a pod requests more of a
+	// resource than any node it may be scheduled to can allocate.
+	SchedulingSuggestionReduceRequests = "ReduceRequests"
+	// SchedulingSuggestionChangeNodeSelector means no schedulable node
+	// matches the node selector of the pods.
+	SchedulingSuggestionChangeNodeSelector = "ChangeNodeSelector"
+	// SchedulingSuggestionWaitForCapacity means the pods fit on some nodes
+	// once the resources in use there are freed.
+	SchedulingSuggestionWaitForCapacity = "WaitForCapacity"
+)
+
+const (
+	// JobQueued means the TFJob is waiting for its namespace's GPU quota
+	// before any of its pods is created.
+	JobQueued common.JobConditionType = "Queued"
+
+	// JobPodGroupSyncFailed means the PodGroup of the TFJob could not be
+	// synced while gang scheduling is enabled, so its pods may stay pending.
+	JobPodGroupSyncFailed common.JobConditionType = "PodGroupSyncFailed"
+
+	// JobTrainingSucceeded means the training replicas of the TFJob have
+	// succeeded, and its Evaluator replicas which start after training run.
+	JobTrainingSucceeded common.JobConditionType = "TrainingSucceeded"
+
+	// JobPodCreationRampUp means the pods of the TFJob are being created in
+	// batches, as set by its PodCreationRampUp.
+	JobPodCreationRampUp common.JobConditionType = "PodCreationRampUp"
+
+	// JobPodRecreationPaused means some pods of the TFJob are not recreated
+	// for a while because an external agent keeps deleting them.
+	JobPodRecreationPaused common.JobConditionType = "PodRecreationPaused"
+
+	// JobPaused means the missing pods of the TFJob are not created because
+	// of its AnnotationPaused.
+	JobPaused common.JobConditionType = "Paused"
+
+	// JobStaleServiceEndpoints means the Services of the TFJob route to the
+	// pods of a previous TFJob of the same name, and its missing pods are not
+	// created until their endpoints drain.
+	JobStaleServiceEndpoints common.JobConditionType = "StaleServiceEndpoints"
+
+	// JobMixedMode means the TFJob manages pods or services created for it
+	// by the v1beta2 operator before an in-place upgrade, along with the ones
+	// created by the v1 operator.
+	JobMixedMode common.JobConditionType = "MixedMode"
+
+	// JobHookRunning means the Job of the OnSuccess or OnFailure hook of the
+	// TFJob has been created and has not finished yet.
+	JobHookRunning common.JobConditionType = "HookRunning"
+
+	// JobHookSucceeded means the Job of the hook of the TFJob has succeeded.
+	JobHookSucceeded common.JobConditionType = "HookSucceeded"
+
+	// JobHookFailed means the Job of the hook of the TFJob has failed, or has
+	// been deleted before it finished.
+	JobHookFailed common.JobConditionType = "HookFailed"
 )
@@ -15,6 +15,7 @@
 package v1
 
 import (
+	"strconv"
 	"strings"
 
 	common "github.com/kubeflow/common/job_controller/api/v1"
@@ -32,8 +33,27 @@ func addDefaultingFuncs(scheme *runtime.Scheme) error {
 	return RegisterDefaults(scheme)
 }
 
+// GetDefaultPort returns the name and the number of the default port of the
+// tensorflow container of the TFJob. They are the ones recorded in the
+// annotations of the TFJob when it was first reconciled, so that they do not
+// change while the TFJob runs, or DefaultPortName and DefaultPort otherwise.
+func GetDefaultPort(tfJob *TFJob) (string, int32) {
+	name, port := DefaultPortName, int32(DefaultPort)
+	if recorded, ok := tfJob.Annotations[AnnotationDefaultPortName]; ok && recorded != "" {
+		name = recorded
+	}
+	if recorded, err := strconv.ParseInt(tfJob.Annotations[AnnotationDefaultPort], 10, 32); err == nil && recorded > 0 && recorded <= 65535 {
+		port = int32(recorded)
+	}
+	return name, port
+}
+
 // setDefaultPort sets the default ports for tensorflow container.
-func setDefaultPort(spec *v1.PodSpec) {
+func setDefaultPort(spec *v1.PodSpec, name string, port int32) {
+	if len(spec.Containers) == 0 {
+		// The template is referenced and not resolved yet.
+		return
+	}
 	index := 0
 	for i, container := range spec.Containers {
 		if container.Name == DefaultContainerName {
@@ -43,16 +63,16 @@ func setDefaultPort(spec *v1.PodSpec) {
 	}
 
 	hasTFJobPort := false
-	for _, port := range spec.Containers[index].Ports {
-		if port.Name == DefaultPortName {
+	for _, p := range spec.Containers[index].Ports {
+		if p.Name == name {
 			hasTFJobPort = true
 			break
 		}
 	}
 	if !hasTFJobPort {
 		spec.Containers[index].Ports = append(spec.Containers[index].Ports, v1.ContainerPort{
-			Name:          DefaultPortName,
-			ContainerPort: DefaultPort,
+			Name:          name,
+			ContainerPort: port,
 		})
 	}
 }
@@ -66,6 +86,21 @@ func setDefaultReplicas(spec *common.ReplicaSpec) {
 	}
 }
 
+// setDefaultResources sets the resources to the containers which set neither
+// requests nor limits. The containers which set some keep them, so that the
+// defaults are only set once.
+func setDefaultResources(spec *v1.PodSpec, resources *v1.ResourceRequirements) {
+	if resources == nil || (len(resources.Requests) == 0 && len(resources.Limits) == 0) {
+		return
+	}
+	for i := range spec.Containers {
+		container := &spec.Containers[i]
+		if len(container.Resources.Requests) == 0 && len(container.Resources.Limits) == 0 {
+			container.Resources = *resources.DeepCopy()
+		}
+	}
+}
+
 // setTypeNamesToCamelCase sets the name of all replica types from any case to correct case.
 func setTypeNamesToCamelCase(tfJob *TFJob) {
 	setTypeNameToCamelCase(tfJob, TFReplicaTypePS)
@@ -88,6 +123,19 @@ func setTypeNameToCamelCase(tfJob *TFJob, typ TFReplicaType) {
 	}
 }
 
+// setStartupOrderToCamelCase sets the replica types of the startup order from
+// any case to correct case, like the keys of TFReplicaSpecs.
+func setStartupOrderToCamelCase(tfJob *TFJob) {
+	for i, t := range tfJob.Spec.ReplicaStartupOrder {
+		for _, typ := range []TFReplicaType{TFReplicaTypePS, TFReplicaTypeWorker, TFReplicaTypeChief, TFReplicaTypeMaster, TFReplicaTypeEval} {
+			if strings.EqualFold(string(t), string(typ)) {
+				tfJob.Spec.ReplicaStartupOrder[i] = typ
+				break
+			}
+		}
+	}
+}
+
 // SetDefaults_TFJob sets any unspecified values to defaults.
 func SetDefaults_TFJob(tfjob *TFJob) {
 	// Set default cleanpod policy to Running.
@@ -96,13 +144,27 @@ func SetDefaults_TFJob(tfjob *TFJob) {
 		tfjob.Spec.CleanPodPolicy = &running
 	}
 
+	// Set default evaluator start policy to Concurrent.
+	if tfjob.Spec.EvaluatorPolicy != nil && tfjob.Spec.EvaluatorPolicy.StartPolicy == "" {
+		tfjob.Spec.EvaluatorPolicy.StartPolicy = StartPolicyConcurrent
+	}
+
+	// Set default replica startup gate to Running.
+	if len(tfjob.Spec.ReplicaStartupOrder) > 0 && tfjob.Spec.ReplicaStartupGate == "" {
+		tfjob.Spec.ReplicaStartupGate = StartupGateRunning
+	}
+
 	// Update the key of TFReplicaSpecs to camel case.
 	setTypeNamesToCamelCase(tfjob)
+	setStartupOrderToCamelCase(tfjob)
 
+	portName, port := GetDefaultPort(tfjob)
 	for _, spec := range tfjob.Spec.TFReplicaSpecs {
 		// Set default replicas to 1.
 		setDefaultReplicas(spec)
 		// Set default port to tensorFlow container.
-		setDefaultPort(&spec.Template.Spec)
+		setDefaultPort(&spec.Template.Spec, portName, port)
+		// Set the default resources of the TFJob to the containers.
+		setDefaultResources(&spec.Template.Spec, tfjob.Spec.DefaultResources)
 	}
 }
@@ -19,6 +19,7 @@ import (
 	"testing"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 
 	common "github.com/kubeflow/common/job_controller/api/v1"
 	"github.com/kubeflow/tf-operator/pkg/util"
@@ -114,6 +115,81 @@ func TestSetTypeNames(t *testing.T) {
 	}
 }
 
+func TestSetReplicaStartupOrder(t *testing.T) {
+	tfJob := &TFJob{
+		Spec: TFJobSpec{
+			ReplicaStartupOrder: []TFReplicaType{"ps", "CHIEF", "Worker", "Profiler"},
+		},
+	}
+	SetDefaults_TFJob(tfJob)
+	expected := []TFReplicaType{TFReplicaTypePS, TFReplicaTypeChief, TFReplicaTypeWorker, "Profiler"}
+	if !reflect.DeepEqual(tfJob.Spec.ReplicaStartupOrder, expected) {
+		t.Errorf("Expected the startup order %v, got %v", expected, tfJob.Spec.ReplicaStartupOrder)
+	}
+	if tfJob.Spec.ReplicaStartupGate != StartupGateRunning {
+		t.Errorf("Expected the startup gate %s, got %s", StartupGateRunning, tfJob.Spec.ReplicaStartupGate)
+	}
+
+	// The gate is left unset without a startup order.
+	tfJob = &TFJob{}
+	SetDefaults_TFJob(tfJob)
+	if tfJob.Spec.ReplicaStartupGate != "" {
+		t.Errorf("Expected no startup gate, got %s", tfJob.Spec.ReplicaStartupGate)
+	}
+}
+
+func TestSetDefaultResources(t *testing.T) {
+	newReplicaSpec := func(containers ...v1.Container) *common.ReplicaSpec {
+		return &common.ReplicaSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{Containers: containers},
+			},
+		}
+	}
+	defaults := v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+		Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("4Gi")},
+	}
+	override := v1.ResourceRequirements{
+		Limits: v1.ResourceList{v1.ResourceCPU: resource.MustParse("8")},
+	}
+	tfJob := &TFJob{
+		Spec: TFJobSpec{
+			DefaultResources: defaults.DeepCopy(),
+			TFReplicaSpecs: map[TFReplicaType]*common.ReplicaSpec{
+				TFReplicaTypeChief: newReplicaSpec(v1.Container{Name: DefaultContainerName, Image: testImage}),
+				TFReplicaTypeWorker: newReplicaSpec(
+					v1.Container{Name: DefaultContainerName, Image: testImage},
+					v1.Container{Name: "sidecar", Image: testImage},
+				),
+				TFReplicaTypePS: newReplicaSpec(v1.Container{Name: DefaultContainerName, Image: testImage, Resources: override}),
+			},
+		},
+	}
+	SetDefaults_TFJob(tfJob)
+	expected := map[TFReplicaType][]v1.ResourceRequirements{
+		TFReplicaTypeChief:  {defaults},
+		TFReplicaTypeWorker: {defaults, defaults},
+		// The resources of the PS template take precedence.
+		TFReplicaTypePS: {override},
+	}
+	for rtype, resources := range expected {
+		for i, container := range tfJob.Spec.TFReplicaSpecs[rtype].Template.Spec.Containers {
+			if !reflect.DeepEqual(container.Resources, resources[i]) {
+				t.Errorf("Expected the container %s of %s to have the resources %v, got %v",
+					container.Name, rtype, resources[i], container.Resources)
+			}
+		}
+	}
+
+	// The defaulting is idempotent.
+	defaulted := tfJob.DeepCopy()
+	SetDefaults_TFJob(tfJob)
+	if !reflect.DeepEqual(tfJob, defaulted) {
+		t.Errorf("Expected the defaulting to be idempotent, want\n%v; got\n%v", util.Pformat(defaulted), util.Pformat(tfJob))
+	}
+}
+
 func TestSetDefaultTFJob(t *testing.T) {
 	customPortName := "customPort"
 	var customPort int32 = 1234
@@ -30,6 +30,121 @@ import (
 
 func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenAPIDefinition {
 	return map[string]common.OpenAPIDefinition{
+		"github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.EvaluatorPolicy": {
+			Schema: spec.Schema{
+				SchemaProps: spec.SchemaProps{
+					Description: "EvaluatorPolicy describes when the Evaluator replicas of a TFJob run.",
+					Properties: map[string]spec.Schema{
+						"startPolicy": {
+							SchemaProps: spec.SchemaProps{
+								Description: "StartPolicy defines when the Evaluator pods are created. Defaults to Concurrent.",
+								Type:        []string{"string"},
+								Format:      "",
+							},
+						},
+						"keepPS": {
+							SchemaProps: spec.SchemaProps{
+								Description: "KeepPS keeps the PS replicas running until the Evaluator completes when the StartPolicy is AfterTraining. Otherwise the PS pods are deleted once the training succeeded.",
+								Type:        []string{"boolean"},
+								Format:      "",
+							},
+						},
+					},
+				},
+			},
+			Dependencies: []string{},
+		},
+		"github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.PodCreationRampUp": {
+			Schema: spec.Schema{
+				SchemaProps: spec.SchemaProps{
+					Description: "PodCreationRampUp describes how the pods of a TFJob are created in batches.",
+					Properties: map[string]spec.Schema{
+						"batchSize": {
+							SchemaProps: spec.SchemaProps{
+								Description: "BatchSize is the maximum number of pods of the TFJob created in a batch. Must be a positive integer.",
+								Type:        []string{"integer"},
+								Format:      "int32",
+							},
+						},
+						"intervalSeconds": {
+							SchemaProps: spec.SchemaProps{
+								Description: "IntervalSeconds is the minimum number of seconds between two batches.",
+								Type:        []string{"integer"},
+								Format:      "int32",
+							},
+						},
+					},
+					Required: []string{"batchSize"},
+				},
+			},
+			Dependencies: []string{},
+		},
+		"github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.PodDisruptionBudgetSpec": {
+			Schema: spec.Schema{
+				SchemaProps: spec.SchemaProps{
+					Description: "PodDisruptionBudgetSpec describes the PodDisruptionBudget of the pods of a TFJob. At most one of MinAvailable and MaxUnavailable can be set.",
+					Properties: map[string]spec.Schema{
+						"minAvailable": {
+							SchemaProps: spec.SchemaProps{
+								Description: "MinAvailable is the number or percentage of the pods of the TFJob that must stay available. Defaults to the number of replicas of the TFJob, leaving out the ones whose failures are ignored, when MaxUnavailable is not set.",
+								Ref:         ref("k8s.io/apimachinery/pkg/util/intstr.IntOrString"),
+							},
+						},
+						"maxUnavailable": {
+							SchemaProps: spec.SchemaProps{
+								Description: "MaxUnavailable is the number or percentage of the pods of the TFJob that can be unavailable.",
+								Ref:         ref("k8s.io/apimachinery/pkg/util/intstr.IntOrString"),
+							},
+						},
+					},
+				},
+			},
+			Dependencies: []string{
+				"k8s.io/apimachinery/pkg/util/intstr.IntOrString"},
+		},
+		"github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.PodTemplateRef": {
+			Schema: spec.Schema{
+				SchemaProps: spec.SchemaProps{
+					Description: "PodTemplateRef references a PodTemplate in the namespace of the TFJob.",
+					Properties: map[string]spec.Schema{
+						"name": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Name of the PodTemplate.",
+								Type:        []string{"string"},
+								Format:      "",
+							},
+						},
+					},
+					Required: []string{"name"},
+				},
+			},
+			Dependencies: []string{},
+		},
+		"github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.RestartBackoff": {
+			Schema: spec.Schema{
+				SchemaProps: spec.SchemaProps{
+					Description: "RestartBackoff tracks the recent restarts of the pod of a replica, which delay its recreation exponentially.",
+					Properties: map[string]spec.Schema{
+						"restarts": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Restarts is the number of consecutive restarts of the replica, reset once its pod stays running for the stability window of the operator.",
+								Type:        []string{"integer"},
+								Format:      "int32",
+							},
+						},
+						"lastRestartTime": {
+							SchemaProps: spec.SchemaProps{
+								Description: "LastRestartTime is the time the pod of the replica was last deleted to be restarted.",
+								Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+							},
+						},
+					},
+					Required: []string{"restarts", "lastRestartTime"},
+				},
+			},
+			Dependencies: []string{
+				"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+		},
 		"github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.TFJob": {
 			Schema: spec.Schema{
 				SchemaProps: spec.SchemaProps{
@@ -64,14 +179,14 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 						"status": {
 							SchemaProps: spec.SchemaProps{
 								Description: "Most recently observed status of the TFJob. Read-only (modified by the system).",
-								Ref:         ref("github.com/kubeflow/common/job_controller/api/v1.JobStatus"),
+								Ref:         ref("github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.TFJobStatus"),
 							},
 						},
 					},
 				},
 			},
 			Dependencies: []string{
-				"github.com/kubeflow/common/job_controller/api/v1.JobStatus", "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.TFJobSpec", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+				"github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.TFJobSpec", "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.TFJobStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
 		},
 		"github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.TFJobList": {
 			Schema: spec.Schema{
@@ -130,6 +245,13 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 								Format:      "int64",
 							},
 						},
+						"deadlineFrom": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Defines since when the ActiveDeadlineSeconds is measured, e.g. from the first running pod so that the time the TFJob spends queued does not count against its deadline. Defaults to Created.",
+								Type:        []string{"string"},
+								Format:      "",
+							},
+						},
 						"backoffLimit": {
 							SchemaProps: spec.SchemaProps{
 								Description: "Number of retries before marking this job as failed.",
@@ -151,6 +273,206 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 								Format:      "int32",
 							},
 						},
+						"evaluatorPolicy": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Defines when the Evaluator replicas are started. Defaults to starting them along with the other replicas.",
+								Ref:         ref("github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.EvaluatorPolicy"),
+							},
+						},
+						"orderedStart": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Delays the creation of the Worker, Chief and Master pods until a pod of each PS replica is running, so that they do not start before the PS they connect to. The pods already created are not affected. Defaults to creating the pods of all the replica types in parallel.",
+								Type:        []string{"boolean"},
+								Format:      "",
+							},
+						},
+						"replicaStartupOrder": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Creates the pods of the replica types in stages, e.g. [PS, Chief, Worker, Evaluator] for the Chief to initialize the checkpoint directory before the Workers start: the missing pods of a listed replica type are only created once the pods of all the replicas of the types listed before it have started, as defined by ReplicaStartupGate. The replica types which are not listed are not delayed, and the pods already created are not affected. OrderedStart is ignored when it is set.",
+								Type:        []string{"array"},
+								Items: &spec.SchemaOrArray{
+									Schema: &spec.Schema{
+										SchemaProps: spec.SchemaProps{
+											Type:   []string{"string"},
+											Format: "",
+										},
+									},
+								},
+							},
+						},
+						"replicaStartupGate": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Defines when the pods of the replica types listed in ReplicaStartupOrder have started for the next types to be created. Defaults to Running.",
+								Type:        []string{"string"},
+								Format:      "",
+							},
+						},
+						"successPolicy": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Defines which replicas completing makes the TFJob succeed. Defaults to Default.",
+								Type:        []string{"string"},
+								Format:      "",
+							},
+						},
+						"terminationGracePeriodSeconds": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Overrides the termination grace period of the pods of the given replica types, e.g. to give the PS replicas time to checkpoint their state when they are deleted. The pods are created with it, and it is passed when they are deleted once the TFJob terminates.",
+								Type:        []string{"object"},
+								AdditionalProperties: &spec.SchemaOrBool{
+									Schema: &spec.Schema{
+										SchemaProps: spec.SchemaProps{
+											Type:   []string{"integer"},
+											Format: "int64",
+										},
+									},
+								},
+							},
+						},
+						"orderedTeardown": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Deletes the pods of the TFJob once it terminates in order: the Worker and Evaluator pods first, then the PS pods once they are gone, then the Chief and Master pods, so that the PS may checkpoint after the workers stopped updating them. Defaults to deleting all the pods at once.",
+								Type:        []string{"boolean"},
+								Format:      "",
+							},
+						},
+						"failurePolicies": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Defines how the failures of the pods of the given replica types affect the TFJob, e.g. to fail it as soon as a PS pod fails. The replica types not listed default to Restart.",
+								Type:        []string{"object"},
+								AdditionalProperties: &spec.SchemaOrBool{
+									Schema: &spec.Schema{
+										SchemaProps: spec.SchemaProps{
+											Type:   []string{"string"},
+											Format: "",
+										},
+									},
+								},
+							},
+						},
+						"podCreationRampUp": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Limits the number of pods of the TFJob created at once, so that large TFJobs ramp up instead of pulling their images all together. Defaults to creating all the pods at once.",
+								Ref:         ref("github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.PodCreationRampUp"),
+							},
+						},
+						"podDisruptionBudget": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Protects the pods of the TFJob from voluntary disruptions, such as node drains, with a PodDisruptionBudget owned by the TFJob. The budget is deleted once the TFJob is terminated. Defaults to no PodDisruptionBudget, unless the kubeflow.org/pod-disruption-budget annotation or the operator enables the default one.",
+								Ref:         ref("github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.PodDisruptionBudgetSpec"),
+							},
+						},
+						"sidecars": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Containers added to the pods of all the replicas, such as a metrics exporter. A sidecar is not added to the pods whose template already has a container of the same name. Sidecars do not get TF_CONFIG, and their restarts and exit codes do not affect the status of the TFJob. Changing the sidecars only affects the pods created afterwards.",
+								Type:        []string{"array"},
+								Items: &spec.SchemaOrArray{
+									Schema: &spec.Schema{
+										SchemaProps: spec.SchemaProps{
+											Ref: ref("k8s.io/api/core/v1.Container"),
+										},
+									},
+								},
+							},
+						},
+						"sidecarVolumes": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Volumes added to the pods of all the replicas for the sidecars. A volume is not added to the pods whose template already has a volume of the same name.",
+								Type:        []string{"array"},
+								Items: &spec.SchemaOrArray{
+									Schema: &spec.Schema{
+										SchemaProps: spec.SchemaProps{
+											Ref: ref("k8s.io/api/core/v1.Volume"),
+										},
+									},
+								},
+							},
+						},
+						"clusterSpecVia": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Defines how the cluster spec in TF_CONFIG is passed to the pods. With ConfigMap, it is written once to a ConfigMap of the TFJob mounted in the pods, instead of being repeated in the env of every pod, which is too large for TFJobs with thousands of replicas. The ConfigMap is mounted at the kubeflow.org/tf-config-path annotation, or at /etc/tf-config/tf_config.json. Defaults to Env.",
+								Type:        []string{"string"},
+								Format:      "",
+							},
+						},
+						"templateRefs": {
+							SchemaProps: spec.SchemaProps{
+								Description: "References the PodTemplates of the TFJob namespace the pods of the given replica types are created from, instead of the inline templates of their replica specs, which must then be empty. The PodTemplates are resolved when the TFJob is reconciled, and a hash of each one is recorded when it is first resolved, so that a PodTemplate changed while the TFJob runs does not silently alter the pods recreated afterwards: they are not recreated until it is restored. The TFJob fails if a PodTemplate does not exist.",
+								Type:        []string{"object"},
+								AdditionalProperties: &spec.SchemaOrBool{
+									Schema: &spec.Schema{
+										SchemaProps: spec.SchemaProps{
+											Ref: ref("github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.PodTemplateRef"),
+										},
+									},
+								},
+							},
+						},
+						"volumeClaimTemplates": {
+							SchemaProps: spec.SchemaProps{
+								Description: "PersistentVolumeClaims created by the operator for each pod of the given replica types, e.g. a scratch volume per Worker, as the volumeClaimTemplates of a StatefulSet. The claim of a pod is named <claim name>-<pod name> and mounted as the volume of the claim name, replacing the volume of the same name in the pod template. The claims are kept when their pod is recreated, deleted along with it when the TFJob is cleaned up, and garbage-collected with the TFJob.",
+								Type:        []string{"object"},
+								AdditionalProperties: &spec.SchemaOrBool{
+									Schema: &spec.Schema{
+										SchemaProps: spec.SchemaProps{
+											Type: []string{"array"},
+											Items: &spec.SchemaOrArray{
+												Schema: &spec.Schema{
+													SchemaProps: spec.SchemaProps{
+														Ref: ref("k8s.io/api/core/v1.PersistentVolumeClaim"),
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+						"bestEffortReplicaTypes": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Replica types whose failures never affect the outcome of the TFJob, e.g. a profiler. Their pods are created, restarted and cleaned up like the others, and their counts are reported in the status, but their failures neither fail nor restart the TFJob, they do not count against the backoff limit, and the TFJob does not wait for them to succeed. Worker, Chief and Master cannot be best-effort.",
+								Type:        []string{"array"},
+								Items: &spec.SchemaOrArray{
+									Schema: &spec.Schema{
+										SchemaProps: spec.SchemaProps{
+											Type:   []string{"string"},
+											Format: "",
+										},
+									},
+								},
+							},
+						},
+						"defaultResources": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Resource requests and limits set on the containers of the templates of all the replica types which set none, so that they are defined once for the TFJob. The containers which set their own resources in their template keep them. Like the other defaults, they are applied to the templates referenced by TemplateRefs once resolved, and only affect the pods created afterwards.",
+								Ref:         ref("k8s.io/api/core/v1.ResourceRequirements"),
+							},
+						},
+						"tfConfigExtra": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Fields merged into the TF_CONFIG of the pods along with the cluster spec and the task, e.g. rpc_layer to use grpc+verbs. The values are set as JSON strings. The cluster, task and environment fields are generated by the operator and cannot be overridden. Changing them only affects the pods created afterwards.",
+								Type:        []string{"object"},
+								AdditionalProperties: &spec.SchemaOrBool{
+									Schema: &spec.Schema{
+										SchemaProps: spec.SchemaProps{
+											Type:   []string{"string"},
+											Format: "",
+										},
+									},
+								},
+							},
+						},
+						"onSuccess": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Runs a Job from this pod template once the TFJob has succeeded, e.g. to upload the trained model. The Job is created once, owned by the TFJob, and its outcome is recorded in the HookSucceeded or HookFailed condition without changing the outcome of the TFJob. The TTL cleanup of the TFJob waits for the Job to finish. The restart policy of the template defaults to Never and cannot be Always.",
+								Ref:         ref("k8s.io/api/core/v1.PodTemplateSpec"),
+							},
+						},
+						"onFailure": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Runs a Job from this pod template once the TFJob has failed, like OnSuccess.",
+								Ref:         ref("k8s.io/api/core/v1.PodTemplateSpec"),
+							},
+						},
 						"tfReplicaSpecs": {
 							SchemaProps: spec.SchemaProps{
 								Description: "A map of TFReplicaType (type) to ReplicaSpec (value). Specifies the TF cluster configuration. For example,\n  {\n    \"PS\": ReplicaSpec,\n    \"Worker\": ReplicaSpec,\n  }",
@@ -169,7 +491,183 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 				},
 			},
 			Dependencies: []string{
-				"github.com/kubeflow/common/job_controller/api/v1.ReplicaSpec"},
+				"github.com/kubeflow/common/job_controller/api/v1.ReplicaSpec", "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.EvaluatorPolicy", "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.PodCreationRampUp", "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.PodDisruptionBudgetSpec", "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.PodTemplateRef", "k8s.io/api/core/v1.Container", "k8s.io/api/core/v1.PersistentVolumeClaim", "k8s.io/api/core/v1.PodTemplateSpec", "k8s.io/api/core/v1.ResourceRequirements", "k8s.io/api/core/v1.Volume"},
+		},
+		"github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.TFJobStatus": {
+			Schema: spec.Schema{
+				SchemaProps: spec.SchemaProps{
+					Description: "TFJobStatus is the observed state of a TFJob.",
+					Properties: map[string]spec.Schema{
+						"conditions": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Conditions is an array of current observed job conditions.",
+								Type:        []string{"array"},
+								Items: &spec.SchemaOrArray{
+									Schema: &spec.Schema{
+										SchemaProps: spec.SchemaProps{
+											Ref: ref("github.com/kubeflow/common/job_controller/api/v1.JobCondition"),
+										},
+									},
+								},
+							},
+						},
+						"replicaStatuses": {
+							SchemaProps: spec.SchemaProps{
+								Description: "ReplicaStatuses is map of ReplicaType and ReplicaStatus, specifies the status of each replica.",
+								Type:        []string{"object"},
+								AdditionalProperties: &spec.SchemaOrBool{
+									Schema: &spec.Schema{
+										SchemaProps: spec.SchemaProps{
+											Ref: ref("github.com/kubeflow/common/job_controller/api/v1.ReplicaStatus"),
+										},
+									},
+								},
+							},
+						},
+						"startTime": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Represents time when the job was acknowledged by the job controller. It is not guaranteed to be set in happens-before order across separate operations. It is represented in RFC3339 form and is in UTC.",
+								Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+							},
+						},
+						"completionTime": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Represents time when the job was completed. It is not guaranteed to be set in happens-before order across separate operations. It is represented in RFC3339 form and is in UTC.",
+								Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+							},
+						},
+						"lastReconcileTime": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Represents last time when the job was reconciled. It is not guaranteed to be set in happens-before order across separate operations. It is represented in RFC3339 form and is in UTC.",
+								Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+							},
+						},
+						"state": {
+							SchemaProps: spec.SchemaProps{
+								Description: "State is the type of the most recent true condition of the TFJob among Created, Running, Restarting, Succeeded and Failed, e.g. for kubectl to print it. Read-only (modified by the system).",
+								Type:        []string{"string"},
+								Format:      "",
+							},
+						},
+						"phase": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Phase summarizes the conditions of the TFJob. It is empty for the TFJobs whose status has not been written since it was introduced, and it never changes once Succeeded or Failed. Read-only (modified by the system).",
+								Type:        []string{"string"},
+								Format:      "",
+							},
+						},
+						"trainingProgress": {
+							SchemaProps: spec.SchemaProps{
+								Description: "TrainingProgress aggregates the progress the Worker pods report in their progress annotation. It is informational, and nil if no Worker reports its progress. Read-only (modified by the system).",
+								Ref:         ref("github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.TrainingProgress"),
+							},
+						},
+						"lastSyncRequest": {
+							SchemaProps: spec.SchemaProps{
+								Description: "LastSyncRequest is the value of the sync request annotation of the TFJob when it was last synced, so that the callers changing it can confirm the sync happened. Read-only (modified by the system).",
+								Type:        []string{"string"},
+								Format:      "",
+							},
+						},
+						"replicaRestarts": {
+							SchemaProps: spec.SchemaProps{
+								Description: "ReplicaRestarts is the number of times the operator deleted a failed pod of each replica type to recreate it, e.g. under the ExitCode restart policy. It is counted against the BackoffLimit along with the restarts of the containers of the live pods, as it is kept when the pods are recreated. Read-only (modified by the system).",
+								Type:        []string{"object"},
+								AdditionalProperties: &spec.SchemaOrBool{
+									Schema: &spec.Schema{
+										SchemaProps: spec.SchemaProps{
+											Type:   []string{"integer"},
+											Format: "int32",
+										},
+									},
+								},
+							},
+						},
+						"replicaAttempts": {
+							SchemaProps: spec.SchemaProps{
+								Description: "ReplicaAttempts is the number of times the operator recreated the pod of each replica, e.g. worker-0, whether it restarted it after a failure or moved it off a preemption, an evacuation or a failed node. The pods of the replica are given it as their attempt. Read-only (modified by the system).",
+								Type:        []string{"object"},
+								AdditionalProperties: &spec.SchemaOrBool{
+									Schema: &spec.Schema{
+										SchemaProps: spec.SchemaProps{
+											Type:   []string{"integer"},
+											Format: "int32",
+										},
+									},
+								},
+							},
+						},
+						"restartBackoffs": {
+							SchemaProps: spec.SchemaProps{
+								Description: "RestartBackoffs is the backoff of the recreation of the pods of each replica, e.g. worker-0, which the operator deleted to restart them under the ExitCode restart policy. It is only recorded when the operator backs off the restarts. Read-only (modified by the system).",
+								Type:        []string{"object"},
+								AdditionalProperties: &spec.SchemaOrBool{
+									Schema: &spec.Schema{
+										SchemaProps: spec.SchemaProps{
+											Ref: ref("github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.RestartBackoff"),
+										},
+									},
+								},
+							},
+						},
+						"firstRunningTime": {
+							SchemaProps: spec.SchemaProps{
+								Description: "FirstRunningTime is the time the first running pod of the TFJob was observed, which the ActiveDeadlineSeconds is measured from under the FirstRunning DeadlineFrom. Read-only (modified by the system).",
+								Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+							},
+						},
+						"podTemplateHashes": {
+							SchemaProps: spec.SchemaProps{
+								Description: "PodTemplateHashes is the hash of the PodTemplate referenced by each replica type when it was first resolved, so that the pods are not recreated from a PodTemplate changed since. Read-only (modified by the system).",
+								Type:        []string{"object"},
+								AdditionalProperties: &spec.SchemaOrBool{
+									Schema: &spec.Schema{
+										SchemaProps: spec.SchemaProps{
+											Type:   []string{"string"},
+											Format: "",
+										},
+									},
+								},
+							},
+						},
+					},
+					Required: []string{"conditions", "replicaStatuses"},
+				},
+			},
+			Dependencies: []string{
+				"github.com/kubeflow/common/job_controller/api/v1.JobCondition", "github.com/kubeflow/common/job_controller/api/v1.ReplicaStatus", "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.RestartBackoff", "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.TrainingProgress", "k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+		},
+		"github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1.TrainingProgress": {
+			Schema: spec.Schema{
+				SchemaProps: spec.SchemaProps{
+					Description: "TrainingProgress is the progress reported by the Worker pods of a TFJob, each as a fraction between 0 and 1.",
+					Properties: map[string]spec.Schema{
+						"min": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Min is the progress of the Worker the furthest behind, e.g. \"0.42\".",
+								Type:        []string{"string"},
+								Format:      "",
+							},
+						},
+						"average": {
+							SchemaProps: spec.SchemaProps{
+								Description: "Average is the average progress of the Workers reporting it.",
+								Type:        []string{"string"},
+								Format:      "",
+							},
+						},
+						"reportingWorkers": {
+							SchemaProps: spec.SchemaProps{
+								Description: "ReportingWorkers is the number of Workers reporting their progress.",
+								Type:        []string{"integer"},
+								Format:      "int32",
+							},
+						},
+					},
+					Required: []string{"min", "average", "reportingWorkers"},
+				},
+			},
+			Dependencies: []string{},
 		},
 		"k8s.io/api/core/v1.AWSElasticBlockStoreVolumeSource": {
 			Schema: spec.Schema{
@@ -16,12 +16,23 @@ package v1
 
 import (
 	common "github.com/kubeflow/common/job_controller/api/v1"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +resource:path=tfjob
+// +kubebuilder:resource:shortName=tfj
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:printcolumn:name="Desired-Workers",type="integer",JSONPath=".spec.tfReplicaSpecs.Worker.replicas"
+// +kubebuilder:printcolumn:name="Active-Workers",type="integer",JSONPath=".status.replicaStatuses.Worker.active"
+// +kubebuilder:printcolumn:name="Desired-PS",type="integer",JSONPath=".spec.tfReplicaSpecs.PS.replicas",priority=1
+// +kubebuilder:printcolumn:name="Active-PS",type="integer",JSONPath=".status.replicaStatuses.PS.active",priority=1
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[-1:].reason",priority=1
 
 // Represents a TFJob resource.
 type TFJob struct {
@@ -36,9 +47,126 @@ type TFJob struct {
 
 	// Most recently observed status of the TFJob.
 	// Read-only (modified by the system).
-	Status common.JobStatus `json:"status,omitempty"`
+	Status TFJobStatus `json:"status,omitempty"`
 }
 
+// TFJobStatus is the observed state of a TFJob.
+type TFJobStatus struct {
+	common.JobStatus `json:",inline"`
+
+	// State is the type of the most recent true condition of the TFJob
+	// among Created, Running, Restarting, Succeeded and Failed, e.g. for
+	// kubectl to print it.
+	// Read-only (modified by the system).
+	// +optional
+	State common.JobConditionType `json:"state,omitempty"`
+
+	// Phase summarizes the conditions of the TFJob. It is empty for the
+	// TFJobs whose status has not been written since it was introduced, and
+	// it never changes once Succeeded or Failed.
+	// Read-only (modified by the system).
+	// +optional
+	Phase TFJobPhase `json:"phase,omitempty"`
+
+	// TrainingProgress aggregates the progress the Worker pods report in
+	// their progress annotation. It is informational, and nil if no Worker
+	// reports its progress.
+	// Read-only (modified by the system).
+	// +optional
+	TrainingProgress *TrainingProgress `json:"trainingProgress,omitempty"`
+
+	// LastSyncRequest is the value of the sync request annotation of the
+	// TFJob when it was last synced, so that the callers changing it can
+	// confirm the sync happened.
+	// Read-only (modified by the system).
+	// +optional
+	LastSyncRequest string `json:"lastSyncRequest,omitempty"`
+
+	// ReplicaRestarts is the number of times the operator deleted a failed
+	// pod of each replica type to recreate it, e.g. under the ExitCode
+	// restart policy. It is counted against the BackoffLimit along with the
+	// restarts of the containers of the live pods, as it is kept when the
+	// pods are recreated.
+	// Read-only (modified by the system).
+	// +optional
+	ReplicaRestarts map[TFReplicaType]int32 `json:"replicaRestarts,omitempty"`
+
+	// ReplicaAttempts is the number of times the operator recreated the pod
+	// of each replica, e.g. worker-0, whether it restarted it after a
+	// failure or moved it off a preemption, an evacuation or a failed node.
+	// The pods of the replica are given it as their attempt.
+	// Read-only (modified by the system).
+	// +optional
+	ReplicaAttempts map[string]int32 `json:"replicaAttempts,omitempty"`
+
+	// RestartBackoffs is the backoff of the recreation of the pods of each
+	// replica, e.g. worker-0, which the operator deleted to restart them
+	// under the ExitCode restart policy. It is only recorded when the
+	// operator backs off the restarts.
+	// Read-only (modified by the system).
+	// +optional
+	RestartBackoffs map[string]RestartBackoff `json:"restartBackoffs,omitempty"`
+
+	// FirstRunningTime is the time the first running pod of the TFJob was
+	// observed, which the ActiveDeadlineSeconds is measured from under the
+	// FirstRunning DeadlineFrom.
+	// Read-only (modified by the system).
+	// +optional
+	FirstRunningTime *metav1.Time `json:"firstRunningTime,omitempty"`
+
+	// PodTemplateHashes is the hash of the PodTemplate referenced by each
+	// replica type when it was first resolved, so that the pods are not
+	// recreated from a PodTemplate changed since.
+	// Read-only (modified by the system).
+	// +optional
+	PodTemplateHashes map[TFReplicaType]string `json:"podTemplateHashes,omitempty"`
+}
+
+// RestartBackoff tracks the recent restarts of the pod of a replica, which
+// delay its recreation exponentially.
+type RestartBackoff struct {
+	// Restarts is the number of consecutive restarts of the replica, reset
+	// once its pod stays running for the stability window of the operator.
+	Restarts int32 `json:"restarts"`
+
+	// LastRestartTime is the time the pod of the replica was last deleted to
+	// be restarted.
+	LastRestartTime metav1.Time `json:"lastRestartTime"`
+}
+
+// TrainingProgress is the progress reported by the Worker pods of a TFJob,
+// each as a fraction between 0 and 1.
+type TrainingProgress struct {
+	// Min is the progress of the Worker the furthest behind, e.g. "0.42".
+	Min string `json:"min"`
+
+	// Average is the average progress of the Workers reporting it.
+	Average string `json:"average"`
+
+	// ReportingWorkers is the number of Workers reporting their progress.
+	ReportingWorkers int32 `json:"reportingWorkers"`
+}
+
+// TFJobPhase is the phase of a TFJob, derived from its conditions.
+type TFJobPhase string
+
+const (
+	// TFJobPhaseCreated means the TFJob has been accepted, none of its pods
+	// is running yet.
+	TFJobPhaseCreated TFJobPhase = "Created"
+	// TFJobPhaseRunning means the replicas of the TFJob are running.
+	TFJobPhaseRunning TFJobPhase = "Running"
+	// TFJobPhaseRestarting means some pods of the TFJob are being restarted.
+	TFJobPhaseRestarting TFJobPhase = "Restarting"
+	// TFJobPhaseSuspended means the missing pods of the TFJob are not
+	// created because it is paused.
+	TFJobPhaseSuspended TFJobPhase = "Suspended"
+	// TFJobPhaseSucceeded means the TFJob has succeeded. It is terminal.
+	TFJobPhaseSucceeded TFJobPhase = "Succeeded"
+	// TFJobPhaseFailed means the TFJob has failed. It is terminal.
+	TFJobPhaseFailed TFJobPhase = "Failed"
+)
+
 // TFJobSpec is a desired state description of the TFJob.
 type TFJobSpec struct {
 	// Specifies the duration (in seconds) since startTime during which the job can remain active
@@ -47,6 +175,13 @@ type TFJobSpec struct {
 	// +optional
 	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
 
+	// Defines since when the ActiveDeadlineSeconds is measured, e.g. from
+	// the first running pod so that the time the TFJob spends queued does
+	// not count against its deadline.
+	// Defaults to Created.
+	// +optional
+	DeadlineFrom *DeadlineFrom `json:"deadlineFrom,omitempty"`
+
 	// Number of retries before marking this job as failed.
 	// +optional
 	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
@@ -62,6 +197,159 @@ type TFJobSpec struct {
 	// Defaults to infinite.
 	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
 
+	// Defines when the Evaluator replicas are started.
+	// Defaults to starting them along with the other replicas.
+	// +optional
+	EvaluatorPolicy *EvaluatorPolicy `json:"evaluatorPolicy,omitempty"`
+
+	// Delays the creation of the Worker, Chief and Master pods until a pod of
+	// each PS replica is running, so that they do not start before the PS
+	// they connect to. The pods already created are not affected.
+	// Defaults to creating the pods of all the replica types in parallel.
+	// +optional
+	OrderedStart *bool `json:"orderedStart,omitempty"`
+
+	// Creates the pods of the replica types in stages, e.g. [PS, Chief,
+	// Worker, Evaluator] for the Chief to initialize the checkpoint directory
+	// before the Workers start: the missing pods of a listed replica type are
+	// only created once the pods of all the replicas of the types listed
+	// before it have started, as defined by ReplicaStartupGate. The replica
+	// types which are not listed are not delayed, and the pods already
+	// created are not affected. OrderedStart is ignored when it is set.
+	// +optional
+	ReplicaStartupOrder []TFReplicaType `json:"replicaStartupOrder,omitempty"`
+
+	// Defines when the pods of the replica types listed in
+	// ReplicaStartupOrder have started for the next types to be created.
+	// Defaults to Running.
+	// +optional
+	ReplicaStartupGate StartupGate `json:"replicaStartupGate,omitempty"`
+
+	// Defines which replicas completing makes the TFJob succeed.
+	// Defaults to Default.
+	// +optional
+	SuccessPolicy *SuccessPolicy `json:"successPolicy,omitempty"`
+
+	// Overrides the termination grace period of the pods of the given replica
+	// types, e.g. to give the PS replicas time to checkpoint their state when
+	// they are deleted. The pods are created with it, and it is passed when
+	// they are deleted once the TFJob terminates.
+	// +optional
+	TerminationGracePeriodSeconds map[TFReplicaType]int64 `json:"terminationGracePeriodSeconds,omitempty"`
+
+	// Deletes the pods of the TFJob once it terminates in order: the Worker
+	// and Evaluator pods first, then the PS pods once they are gone, then the
+	// Chief and Master pods, so that the PS may checkpoint after the workers
+	// stopped updating them. Defaults to deleting all the pods at once.
+	// +optional
+	OrderedTeardown *bool `json:"orderedTeardown,omitempty"`
+
+	// Defines how the failures of the pods of the given replica types affect
+	// the TFJob, e.g. to fail it as soon as a PS pod fails. The replica types
+	// not listed default to Restart.
+	// +optional
+	FailurePolicies map[TFReplicaType]FailurePolicy `json:"failurePolicies,omitempty"`
+
+	// Limits the number of pods of the TFJob created at once, so that large
+	// TFJobs ramp up instead of pulling their images all together.
+	// Defaults to creating all the pods at once.
+	// +optional
+	PodCreationRampUp *PodCreationRampUp `json:"podCreationRampUp,omitempty"`
+
+	// Protects the pods of the TFJob from voluntary disruptions, such as node
+	// drains, with a PodDisruptionBudget owned by the TFJob. The budget is
+	// deleted once the TFJob is terminated.
+	// Defaults to no PodDisruptionBudget, unless the
+	// kubeflow.org/pod-disruption-budget annotation or the operator enables
+	// the default one.
+	// +optional
+	PodDisruptionBudget *PodDisruptionBudgetSpec `json:"podDisruptionBudget,omitempty"`
+
+	// Containers added to the pods of all the replicas, such as a metrics
+	// exporter. A sidecar is not added to the pods whose template already has
+	// a container of the same name. Sidecars do not get TF_CONFIG, and their
+	// restarts and exit codes do not affect the status of the TFJob. Changing
+	// the sidecars only affects the pods created afterwards.
+	// +optional
+	Sidecars []v1.Container `json:"sidecars,omitempty"`
+
+	// Volumes added to the pods of all the replicas for the sidecars. A volume
+	// is not added to the pods whose template already has a volume of the
+	// same name.
+	// +optional
+	SidecarVolumes []v1.Volume `json:"sidecarVolumes,omitempty"`
+
+	// Defines how the cluster spec in TF_CONFIG is passed to the pods. With
+	// ConfigMap, it is written once to a ConfigMap of the TFJob mounted in
+	// the pods, instead of being repeated in the env of every pod, which is
+	// too large for TFJobs with thousands of replicas. The ConfigMap is
+	// mounted at the kubeflow.org/tf-config-path annotation, or at
+	// /etc/tf-config/tf_config.json.
+	// Defaults to Env.
+	// +optional
+	ClusterSpecVia *ClusterSpecVia `json:"clusterSpecVia,omitempty"`
+
+	// References the PodTemplates of the TFJob namespace the pods of the given
+	// replica types are created from, instead of the inline templates of their
+	// replica specs, which must then be empty. The PodTemplates are resolved
+	// when the TFJob is reconciled, and a hash of each one is recorded when
+	// it is first resolved, so that a PodTemplate changed while the TFJob
+	// runs does not silently alter the pods recreated afterwards: they are
+	// not recreated until it is restored. The TFJob fails if a PodTemplate
+	// does not exist.
+	// +optional
+	TemplateRefs map[TFReplicaType]PodTemplateRef `json:"templateRefs,omitempty"`
+
+	// PersistentVolumeClaims created by the operator for each pod of the
+	// given replica types, e.g. a scratch volume per Worker, as the
+	// volumeClaimTemplates of a StatefulSet. The claim of a pod is named
+	// <claim name>-<pod name> and mounted as the volume of the claim name,
+	// replacing the volume of the same name in the pod template. The claims
+	// are kept when their pod is recreated, deleted along with it when the
+	// TFJob is cleaned up, and garbage-collected with the TFJob.
+	// +optional
+	VolumeClaimTemplates map[TFReplicaType][]v1.PersistentVolumeClaim `json:"volumeClaimTemplates,omitempty"`
+
+	// Replica types whose failures never affect the outcome of the TFJob,
+	// e.g. a profiler. Their pods are created, restarted and cleaned up like
+	// the others, and their counts are reported in the status, but their
+	// failures neither fail nor restart the TFJob, they do not count against
+	// the backoff limit, and the TFJob does not wait for them to succeed.
+	// Worker, Chief and Master cannot be best-effort.
+	// +optional
+	BestEffortReplicaTypes []TFReplicaType `json:"bestEffortReplicaTypes,omitempty"`
+
+	// Resource requests and limits set on the containers of the templates of
+	// all the replica types which set none, so that they are defined once for
+	// the TFJob. The containers which set their own resources in their
+	// template keep them. Like the other defaults, they are applied to the
+	// templates referenced by TemplateRefs once resolved, and only affect the
+	// pods created afterwards.
+	// +optional
+	DefaultResources *v1.ResourceRequirements `json:"defaultResources,omitempty"`
+
+	// Fields merged into the TF_CONFIG of the pods along with the cluster
+	// spec and the task, e.g. rpc_layer to use grpc+verbs. The values are
+	// set as JSON strings. The cluster, task and environment fields are
+	// generated by the operator and cannot be overridden. Changing them only
+	// affects the pods created afterwards.
+	// +optional
+	TFConfigExtra map[string]string `json:"tfConfigExtra,omitempty"`
+
+	// Runs a Job from this pod template once the TFJob has succeeded, e.g. to
+	// upload the trained model. The Job is created once, owned by the TFJob,
+	// and its outcome is recorded in the HookSucceeded or HookFailed
+	// condition without changing the outcome of the TFJob. The TTL cleanup of
+	// the TFJob waits for the Job to finish. The restart policy of the
+	// template defaults to Never and cannot be Always.
+	// +optional
+	OnSuccess *v1.PodTemplateSpec `json:"onSuccess,omitempty"`
+
+	// Runs a Job from this pod template once the TFJob has failed, like
+	// OnSuccess.
+	// +optional
+	OnFailure *v1.PodTemplateSpec `json:"onFailure,omitempty"`
+
 	// A map of TFReplicaType (type) to ReplicaSpec (value). Specifies the TF cluster configuration.
 	// For example,
 	//   {
@@ -71,6 +359,142 @@ type TFJobSpec struct {
 	TFReplicaSpecs map[TFReplicaType]*common.ReplicaSpec `json:"tfReplicaSpecs"`
 }
 
+// PodCreationRampUp describes how the pods of a TFJob are created in batches.
+type PodCreationRampUp struct {
+	// BatchSize is the maximum number of pods of the TFJob created in a batch.
+	// Must be a positive integer.
+	BatchSize int32 `json:"batchSize"`
+
+	// IntervalSeconds is the minimum number of seconds between two batches.
+	// +optional
+	IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
+}
+
+// PodDisruptionBudgetSpec describes the PodDisruptionBudget of the pods of a
+// TFJob. At most one of MinAvailable and MaxUnavailable can be set.
+type PodDisruptionBudgetSpec struct {
+	// MinAvailable is the number or percentage of the pods of the TFJob that
+	// must stay available. Defaults to the number of replicas of the TFJob,
+	// leaving out the ones whose failures are ignored, when MaxUnavailable is
+	// not set.
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// MaxUnavailable is the number or percentage of the pods of the TFJob that
+	// can be unavailable.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// PodTemplateRef references a PodTemplate in the namespace of the TFJob.
+type PodTemplateRef struct {
+	// Name of the PodTemplate.
+	Name string `json:"name"`
+}
+
+// EvaluatorPolicy describes when the Evaluator replicas of a TFJob run.
+type EvaluatorPolicy struct {
+	// StartPolicy defines when the Evaluator pods are created.
+	// Defaults to Concurrent.
+	StartPolicy StartPolicy `json:"startPolicy,omitempty"`
+
+	// KeepPS keeps the PS replicas running until the Evaluator completes when
+	// the StartPolicy is AfterTraining. Otherwise the PS pods are deleted once
+	// the training succeeded.
+	// +optional
+	KeepPS *bool `json:"keepPS,omitempty"`
+}
+
+// StartPolicy describes when the pods of a replica type are created.
+type StartPolicy string
+
+const (
+	// StartPolicyConcurrent creates the pods along with the other replicas.
+	StartPolicyConcurrent StartPolicy = "Concurrent"
+
+	// StartPolicyAfterTraining creates the pods once the training replicas,
+	// i.e. the Chief/Master or the Workers, have succeeded. The TFJob succeeds
+	// once they have completed as well.
+	StartPolicyAfterTraining StartPolicy = "AfterTraining"
+)
+
+// StartupGate describes when the pods of a replica type have started for the
+// replica types after it in the ReplicaStartupOrder of a TFJob to be created.
+type StartupGate string
+
+const (
+	// StartupGateRunning waits for the pods to be running, or to have
+	// succeeded.
+	StartupGateRunning StartupGate = "Running"
+
+	// StartupGateScheduled waits for the pods to be scheduled to a node.
+	StartupGateScheduled StartupGate = "Scheduled"
+)
+
+// ClusterSpecVia describes how the cluster spec is passed to the pods of a TFJob.
+type ClusterSpecVia string
+
+const (
+	// ClusterSpecViaEnv sets the whole TF_CONFIG, including the cluster spec,
+	// in the env of every pod.
+	ClusterSpecViaEnv ClusterSpecVia = "Env"
+
+	// ClusterSpecViaConfigMap writes the cluster spec to a ConfigMap of the
+	// TFJob, mounted in the tensorflow container as the TF_CONFIG file set in
+	// the TF_CONFIG_FILE env. TF_CONFIG only holds the task of the pod.
+	ClusterSpecViaConfigMap ClusterSpecVia = "ConfigMap"
+)
+
+// SuccessPolicy describes when a TFJob without Chief/Master succeeds.
+// Whatever the policy, the Evaluator replicas do not hold back the success
+// unless the EvaluatorPolicy starts them after training, and their pods still
+// running are deleted once the TFJob succeeded.
+type SuccessPolicy string
+
+const (
+	// SuccessPolicyDefault makes the TFJob succeed when worker 0 has
+	// succeeded, or when all the Workers have succeeded.
+	SuccessPolicyDefault SuccessPolicy = "Default"
+
+	// SuccessPolicyAllWorkers makes the TFJob succeed only when all the
+	// Workers have succeeded, whichever Worker completes first.
+	SuccessPolicyAllWorkers SuccessPolicy = "AllWorkers"
+)
+
+// DeadlineFrom describes since when the ActiveDeadlineSeconds of a TFJob is
+// measured.
+type DeadlineFrom string
+
+const (
+	// DeadlineFromCreated measures the deadline from the startTime of the
+	// TFJob, set when the operator first reconciles it.
+	DeadlineFromCreated DeadlineFrom = "Created"
+
+	// DeadlineFromFirstRunning measures the deadline from the time the
+	// first pod of the TFJob is observed running, recorded in the
+	// firstRunningTime of its status. The deadline does not apply until then.
+	DeadlineFromFirstRunning DeadlineFrom = "FirstRunning"
+)
+
+// FailurePolicy describes how the failures of the pods of a replica type
+// affect the TFJob.
+type FailurePolicy string
+
+const (
+	// FailurePolicyRestart restarts the failed pods according to the restart
+	// policy of the replicas, counting them against the BackoffLimit.
+	FailurePolicyRestart FailurePolicy = "Restart"
+
+	// FailurePolicyFailJob fails the TFJob as soon as a pod of the replicas
+	// fails, whatever its exit code.
+	FailurePolicyFailJob FailurePolicy = "FailJob"
+
+	// FailurePolicyIgnore restarts the failed pods according to the restart
+	// policy of the replicas, but their failures neither fail nor restart the
+	// TFJob and are not counted against the BackoffLimit.
+	FailurePolicyIgnore FailurePolicy = "Ignore"
+)
+
 // TFReplicaType is the type for TFReplica. Can be one of: "Chief"/"Master" (semantically equivalent),
 // "Worker", "PS", or "Evaluator".
 type TFReplicaType common.ReplicaType
@@ -20,9 +20,107 @@ package v1
 
 import (
 	apiv1 "github.com/kubeflow/common/job_controller/api/v1"
+	corev1 "k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	intstr "k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EvaluatorPolicy) DeepCopyInto(out *EvaluatorPolicy) {
+	*out = *in
+	if in.KeepPS != nil {
+		in, out := &in.KeepPS, &out.KeepPS
+		*out = new(bool)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EvaluatorPolicy.
+func (in *EvaluatorPolicy) DeepCopy() *EvaluatorPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(EvaluatorPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodCreationRampUp) DeepCopyInto(out *PodCreationRampUp) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodCreationRampUp.
+func (in *PodCreationRampUp) DeepCopy() *PodCreationRampUp {
+	if in == nil {
+		return nil
+	}
+	out := new(PodCreationRampUp)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodDisruptionBudgetSpec) DeepCopyInto(out *PodDisruptionBudgetSpec) {
+	*out = *in
+	if in.MinAvailable != nil {
+		in, out := &in.MinAvailable, &out.MinAvailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodDisruptionBudgetSpec.
+func (in *PodDisruptionBudgetSpec) DeepCopy() *PodDisruptionBudgetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PodDisruptionBudgetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodTemplateRef) DeepCopyInto(out *PodTemplateRef) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodTemplateRef.
+func (in *PodTemplateRef) DeepCopy() *PodTemplateRef {
+	if in == nil {
+		return nil
+	}
+	out := new(PodTemplateRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestartBackoff) DeepCopyInto(out *RestartBackoff) {
+	*out = *in
+	in.LastRestartTime.DeepCopyInto(&out.LastRestartTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestartBackoff.
+func (in *RestartBackoff) DeepCopy() *RestartBackoff {
+	if in == nil {
+		return nil
+	}
+	out := new(RestartBackoff)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TFJob) DeepCopyInto(out *TFJob) {
 	*out = *in
@@ -92,6 +190,11 @@ func (in *TFJobSpec) DeepCopyInto(out *TFJobSpec) {
 		*out = new(int64)
 		**out = **in
 	}
+	if in.DeadlineFrom != nil {
+		in, out := &in.DeadlineFrom, &out.DeadlineFrom
+		*out = new(DeadlineFrom)
+		**out = **in
+	}
 	if in.BackoffLimit != nil {
 		in, out := &in.BackoffLimit, &out.BackoffLimit
 		*out = new(int32)
@@ -107,6 +210,125 @@ func (in *TFJobSpec) DeepCopyInto(out *TFJobSpec) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.EvaluatorPolicy != nil {
+		in, out := &in.EvaluatorPolicy, &out.EvaluatorPolicy
+		*out = new(EvaluatorPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OrderedStart != nil {
+		in, out := &in.OrderedStart, &out.OrderedStart
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ReplicaStartupOrder != nil {
+		in, out := &in.ReplicaStartupOrder, &out.ReplicaStartupOrder
+		*out = make([]TFReplicaType, len(*in))
+		copy(*out, *in)
+	}
+	if in.SuccessPolicy != nil {
+		in, out := &in.SuccessPolicy, &out.SuccessPolicy
+		*out = new(SuccessPolicy)
+		**out = **in
+	}
+	if in.TerminationGracePeriodSeconds != nil {
+		in, out := &in.TerminationGracePeriodSeconds, &out.TerminationGracePeriodSeconds
+		*out = make(map[TFReplicaType]int64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.OrderedTeardown != nil {
+		in, out := &in.OrderedTeardown, &out.OrderedTeardown
+		*out = new(bool)
+		**out = **in
+	}
+	if in.FailurePolicies != nil {
+		in, out := &in.FailurePolicies, &out.FailurePolicies
+		*out = make(map[TFReplicaType]FailurePolicy, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PodCreationRampUp != nil {
+		in, out := &in.PodCreationRampUp, &out.PodCreationRampUp
+		*out = new(PodCreationRampUp)
+		**out = **in
+	}
+	if in.PodDisruptionBudget != nil {
+		in, out := &in.PodDisruptionBudget, &out.PodDisruptionBudget
+		*out = new(PodDisruptionBudgetSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Sidecars != nil {
+		in, out := &in.Sidecars, &out.Sidecars
+		*out = make([]corev1.Container, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SidecarVolumes != nil {
+		in, out := &in.SidecarVolumes, &out.SidecarVolumes
+		*out = make([]corev1.Volume, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ClusterSpecVia != nil {
+		in, out := &in.ClusterSpecVia, &out.ClusterSpecVia
+		*out = new(ClusterSpecVia)
+		**out = **in
+	}
+	if in.TemplateRefs != nil {
+		in, out := &in.TemplateRefs, &out.TemplateRefs
+		*out = make(map[TFReplicaType]PodTemplateRef, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.VolumeClaimTemplates != nil {
+		in, out := &in.VolumeClaimTemplates, &out.VolumeClaimTemplates
+		*out = make(map[TFReplicaType][]corev1.PersistentVolumeClaim, len(*in))
+		for key, val := range *in {
+			var outVal []corev1.PersistentVolumeClaim
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make([]corev1.PersistentVolumeClaim, len(*in))
+				for i := range *in {
+					(*in)[i].DeepCopyInto(&(*out)[i])
+				}
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.BestEffortReplicaTypes != nil {
+		in, out := &in.BestEffortReplicaTypes, &out.BestEffortReplicaTypes
+		*out = make([]TFReplicaType, len(*in))
+		copy(*out, *in)
+	}
+	if in.DefaultResources != nil {
+		in, out := &in.DefaultResources, &out.DefaultResources
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TFConfigExtra != nil {
+		in, out := &in.TFConfigExtra, &out.TFConfigExtra
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.OnSuccess != nil {
+		in, out := &in.OnSuccess, &out.OnSuccess
+		*out = new(corev1.PodTemplateSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OnFailure != nil {
+		in, out := &in.OnFailure, &out.OnFailure
+		*out = new(corev1.PodTemplateSpec)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.TFReplicaSpecs != nil {
 		in, out := &in.TFReplicaSpecs, &out.TFReplicaSpecs
 		*out = make(map[TFReplicaType]*apiv1.ReplicaSpec, len(*in))
@@ -134,3 +356,73 @@ func (in *TFJobSpec) DeepCopy() *TFJobSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TFJobStatus) DeepCopyInto(out *TFJobStatus) {
+	*out = *in
+	in.JobStatus.DeepCopyInto(&out.JobStatus)
+	if in.TrainingProgress != nil {
+		in, out := &in.TrainingProgress, &out.TrainingProgress
+		*out = new(TrainingProgress)
+		**out = **in
+	}
+	if in.ReplicaRestarts != nil {
+		in, out := &in.ReplicaRestarts, &out.ReplicaRestarts
+		*out = make(map[TFReplicaType]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ReplicaAttempts != nil {
+		in, out := &in.ReplicaAttempts, &out.ReplicaAttempts
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.RestartBackoffs != nil {
+		in, out := &in.RestartBackoffs, &out.RestartBackoffs
+		*out = make(map[string]RestartBackoff, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.FirstRunningTime != nil {
+		in, out := &in.FirstRunningTime, &out.FirstRunningTime
+		*out = (*in).DeepCopy()
+	}
+	if in.PodTemplateHashes != nil {
+		in, out := &in.PodTemplateHashes, &out.PodTemplateHashes
+		*out = make(map[TFReplicaType]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TFJobStatus.
+func (in *TFJobStatus) DeepCopy() *TFJobStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TFJobStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrainingProgress) DeepCopyInto(out *TrainingProgress) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrainingProgress.
+func (in *TrainingProgress) DeepCopy() *TrainingProgress {
+	if in == nil {
+		return nil
+	}
+	out := new(TrainingProgress)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -15,9 +15,13 @@
 package validation
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	commonv1 "github.com/kubeflow/common/job_controller/api/v1"
 	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
@@ -25,49 +29,409 @@ import (
 
 // ValidateV1TFJobSpec checks that the v1.TFJobSpec is valid.
 func ValidateV1TFJobSpec(c *tfv1.TFJobSpec) error {
-	return validateV1ReplicaSpecs(c.TFReplicaSpecs)
+	if err := validateV1TemplateRefs(c.TemplateRefs, c.TFReplicaSpecs); err != nil {
+		return err
+	}
+	if err := validateV1ReplicaSpecs(c.TFReplicaSpecs, c.TemplateRefs); err != nil {
+		return err
+	}
+	if err := validateV1EvaluatorPolicy(c.EvaluatorPolicy); err != nil {
+		return err
+	}
+	if err := validateV1TerminationGracePeriods(c.TerminationGracePeriodSeconds, c.TFReplicaSpecs); err != nil {
+		return err
+	}
+	if err := validateV1FailurePolicies(c.FailurePolicies, c.TFReplicaSpecs, c.BestEffortReplicaTypes); err != nil {
+		return err
+	}
+	if err := validateV1VolumeClaimTemplates(c.VolumeClaimTemplates, c.TFReplicaSpecs); err != nil {
+		return err
+	}
+	if err := validateV1BestEffortReplicaTypes(c.BestEffortReplicaTypes, c.TFReplicaSpecs, c.EvaluatorPolicy); err != nil {
+		return err
+	}
+	if err := validateV1ReplicaStartupOrder(c.ReplicaStartupOrder, c.ReplicaStartupGate, c.TFReplicaSpecs); err != nil {
+		return err
+	}
+	if err := validateV1PodCreationRampUp(c.PodCreationRampUp); err != nil {
+		return err
+	}
+	if err := validateV1PodDisruptionBudget(c.PodDisruptionBudget); err != nil {
+		return err
+	}
+	if err := validateV1Sidecars(c.Sidecars, c.SidecarVolumes); err != nil {
+		return err
+	}
+	if err := validateV1ClusterSpecVia(c.ClusterSpecVia); err != nil {
+		return err
+	}
+	if err := validateV1TFConfigExtra(c.TFConfigExtra); err != nil {
+		return err
+	}
+	if err := validateV1Hook("onSuccess", c.OnSuccess); err != nil {
+		return err
+	}
+	if err := validateV1Hook("onFailure", c.OnFailure); err != nil {
+		return err
+	}
+	if err := validateV1DeadlineFrom(c.DeadlineFrom); err != nil {
+		return err
+	}
+	return validateV1SuccessPolicy(c.SuccessPolicy)
+}
+
+func validateV1TerminationGracePeriods(periods map[tfv1.TFReplicaType]int64, specs map[tfv1.TFReplicaType]*commonv1.ReplicaSpec) error {
+	for rType, seconds := range periods {
+		if _, ok := specs[rType]; !ok {
+			return fmt.Errorf("TFJobSpec is not valid: termination grace period of unknown replica type %v", rType)
+		}
+		if seconds < 0 {
+			return fmt.Errorf("TFJobSpec is not valid: termination grace period of %v must not be negative, got %d", rType, seconds)
+		}
+	}
+	return nil
+}
+
+func validateV1FailurePolicies(policies map[tfv1.TFReplicaType]tfv1.FailurePolicy, specs map[tfv1.TFReplicaType]*commonv1.ReplicaSpec, bestEffort []tfv1.TFReplicaType) error {
+	for rType, policy := range policies {
+		if _, ok := specs[rType]; !ok {
+			return fmt.Errorf("TFJobSpec is not valid: failure policy of unknown replica type %v", rType)
+		}
+		switch policy {
+		case tfv1.FailurePolicyRestart:
+		case tfv1.FailurePolicyFailJob:
+			for _, r := range bestEffort {
+				if r == rType {
+					return fmt.Errorf("TFJobSpec is not valid: the failures of the best-effort %v cannot fail the job", rType)
+				}
+			}
+		case tfv1.FailurePolicyIgnore:
+			// The TFJob cannot complete without its training replicas.
+			if tfv1.IsWorker(rType) || tfv1.IsChieforMaster(rType) {
+				return fmt.Errorf("TFJobSpec is not valid: the failures of %v cannot be ignored", rType)
+			}
+		default:
+			return fmt.Errorf("TFJobSpec is not valid: unknown failure policy %q of %v", policy, rType)
+		}
+	}
+	return nil
+}
+
+func validateV1VolumeClaimTemplates(templates map[tfv1.TFReplicaType][]v1.PersistentVolumeClaim, specs map[tfv1.TFReplicaType]*commonv1.ReplicaSpec) error {
+	for rType, claims := range templates {
+		if _, ok := specs[rType]; !ok {
+			return fmt.Errorf("TFJobSpec is not valid: volume claim templates of unknown replica type %v", rType)
+		}
+		names := make(map[string]bool, len(claims))
+		for _, claim := range claims {
+			if claim.Name == "" {
+				return fmt.Errorf("TFJobSpec is not valid: volume claim template name is undefined in %v", rType)
+			}
+			if names[claim.Name] {
+				return fmt.Errorf("TFJobSpec is not valid: volume claim template %s is defined twice in %v", claim.Name, rType)
+			}
+			names[claim.Name] = true
+		}
+	}
+	return nil
+}
+
+func validateV1BestEffortReplicaTypes(rTypes []tfv1.TFReplicaType, specs map[tfv1.TFReplicaType]*commonv1.ReplicaSpec, policy *tfv1.EvaluatorPolicy) error {
+	for _, rType := range rTypes {
+		if _, ok := specs[rType]; !ok {
+			return fmt.Errorf("TFJobSpec is not valid: unknown best-effort replica type %v", rType)
+		}
+		if tfv1.IsWorker(rType) || tfv1.IsChieforMaster(rType) {
+			return fmt.Errorf("TFJobSpec is not valid: %v cannot be best-effort", rType)
+		}
+		// The TFJob succeeds once the Evaluator which starts after training
+		// has completed.
+		if tfv1.IsEvaluator(rType) && policy != nil && policy.StartPolicy == tfv1.StartPolicyAfterTraining {
+			return fmt.Errorf("TFJobSpec is not valid: %v cannot be best-effort when it starts after training", rType)
+		}
+	}
+	return nil
+}
+
+func validateV1ReplicaStartupOrder(order []tfv1.TFReplicaType, gate tfv1.StartupGate, specs map[tfv1.TFReplicaType]*commonv1.ReplicaSpec) error {
+	// The keys of the specs are not set to camel case until the TFJob is
+	// defaulted.
+	listed := make(map[string]bool)
+	for _, rType := range order {
+		found := false
+		for specType := range specs {
+			if strings.EqualFold(string(specType), string(rType)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("TFJobSpec is not valid: unknown replica type %v in the replica startup order", rType)
+		}
+		if listed[strings.ToLower(string(rType))] {
+			return fmt.Errorf("TFJobSpec is not valid: replica type %v is listed twice in the replica startup order", rType)
+		}
+		listed[strings.ToLower(string(rType))] = true
+	}
+	switch gate {
+	case "", tfv1.StartupGateRunning, tfv1.StartupGateScheduled:
+		return nil
+	default:
+		return fmt.Errorf("TFJobSpec is not valid: unknown replica startup gate %q", gate)
+	}
+}
+
+func validateV1TemplateRefs(refs map[tfv1.TFReplicaType]tfv1.PodTemplateRef, specs map[tfv1.TFReplicaType]*commonv1.ReplicaSpec) error {
+	for rType, ref := range refs {
+		spec, ok := specs[rType]
+		if !ok {
+			return fmt.Errorf("TFJobSpec is not valid: template reference of unknown replica type %v", rType)
+		}
+		if ref.Name == "" {
+			return fmt.Errorf("TFJobSpec is not valid: template reference name is undefined in %v", rType)
+		}
+		if spec != nil && len(spec.Template.Spec.Containers) > 0 {
+			return fmt.Errorf("TFJobSpec is not valid: %v has both a template and a template reference", rType)
+		}
+	}
+	return nil
+}
+
+func validateV1PodCreationRampUp(rampUp *tfv1.PodCreationRampUp) error {
+	if rampUp == nil {
+		return nil
+	}
+	if rampUp.BatchSize <= 0 {
+		return fmt.Errorf("TFJobSpec is not valid: pod creation ramp-up batch size must be positive, got %d", rampUp.BatchSize)
+	}
+	if rampUp.IntervalSeconds < 0 {
+		return fmt.Errorf("TFJobSpec is not valid: pod creation ramp-up interval must not be negative, got %d", rampUp.IntervalSeconds)
+	}
+	return nil
 }
 
-func validateV1ReplicaSpecs(specs map[tfv1.TFReplicaType]*commonv1.ReplicaSpec) error {
+func validateV1PodDisruptionBudget(pdb *tfv1.PodDisruptionBudgetSpec) error {
+	if pdb == nil {
+		return nil
+	}
+	if pdb.MinAvailable != nil && pdb.MaxUnavailable != nil {
+		return fmt.Errorf("TFJobSpec is not valid: pod disruption budget must not set both minAvailable and maxUnavailable")
+	}
+	for _, value := range []*intstr.IntOrString{pdb.MinAvailable, pdb.MaxUnavailable} {
+		if value == nil {
+			continue
+		}
+		if _, err := intstr.GetValueFromIntOrPercent(value, 100, false); err != nil {
+			return fmt.Errorf("TFJobSpec is not valid: pod disruption budget: %v", err)
+		}
+		if value.Type == intstr.Int && value.IntVal < 0 {
+			return fmt.Errorf("TFJobSpec is not valid: pod disruption budget must not be negative, got %d", value.IntVal)
+		}
+	}
+	return nil
+}
+
+func validateV1Sidecars(sidecars []v1.Container, volumes []v1.Volume) error {
+	names := make(map[string]bool, len(sidecars))
+	for _, sidecar := range sidecars {
+		if sidecar.Name == "" {
+			return fmt.Errorf("TFJobSpec is not valid: sidecar name is undefined")
+		}
+		if sidecar.Name == tfv1.DefaultContainerName {
+			return fmt.Errorf("TFJobSpec is not valid: sidecar must not be named %s", tfv1.DefaultContainerName)
+		}
+		if names[sidecar.Name] {
+			return fmt.Errorf("TFJobSpec is not valid: duplicate sidecar %s", sidecar.Name)
+		}
+		names[sidecar.Name] = true
+		if sidecar.Image == "" {
+			return fmt.Errorf("TFJobSpec is not valid: Image is undefined in the sidecar %s", sidecar.Name)
+		}
+	}
+	volumeNames := make(map[string]bool, len(volumes))
+	for _, volume := range volumes {
+		if volume.Name == "" {
+			return fmt.Errorf("TFJobSpec is not valid: sidecar volume name is undefined")
+		}
+		if volumeNames[volume.Name] {
+			return fmt.Errorf("TFJobSpec is not valid: duplicate sidecar volume %s", volume.Name)
+		}
+		volumeNames[volume.Name] = true
+	}
+	return nil
+}
+
+func validateV1ClusterSpecVia(via *tfv1.ClusterSpecVia) error {
+	if via == nil {
+		return nil
+	}
+	switch *via {
+	case "", tfv1.ClusterSpecViaEnv, tfv1.ClusterSpecViaConfigMap:
+		return nil
+	default:
+		return fmt.Errorf("TFJobSpec is not valid: unknown cluster spec via %q", *via)
+	}
+}
+
+// reservedTFConfigFields are the fields of TF_CONFIG generated by the
+// operator.
+var reservedTFConfigFields = []string{"cluster", "task", "environment"}
+
+func validateV1TFConfigExtra(extra map[string]string) error {
+	for _, field := range reservedTFConfigFields {
+		if _, ok := extra[field]; ok {
+			return fmt.Errorf("TFJobSpec is not valid: TF_CONFIG field %s is generated by the operator and cannot be overridden", field)
+		}
+	}
+	for field := range extra {
+		if field == "" {
+			return fmt.Errorf("TFJobSpec is not valid: TF_CONFIG field name is undefined")
+		}
+	}
+	return nil
+}
+
+func validateV1SuccessPolicy(policy *tfv1.SuccessPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	switch *policy {
+	case "", tfv1.SuccessPolicyDefault, tfv1.SuccessPolicyAllWorkers:
+		return nil
+	default:
+		return fmt.Errorf("TFJobSpec is not valid: unknown success policy %q", *policy)
+	}
+}
+
+func validateV1DeadlineFrom(deadlineFrom *tfv1.DeadlineFrom) error {
+	if deadlineFrom == nil {
+		return nil
+	}
+	switch *deadlineFrom {
+	case "", tfv1.DeadlineFromCreated, tfv1.DeadlineFromFirstRunning:
+		return nil
+	default:
+		return fmt.Errorf("TFJobSpec is not valid: unknown deadlineFrom %q", *deadlineFrom)
+	}
+}
+
+func validateV1Hook(name string, template *v1.PodTemplateSpec) error {
+	if template == nil {
+		return nil
+	}
+	if len(template.Spec.Containers) == 0 {
+		return fmt.Errorf("TFJobSpec is not valid: containers definition expected in the %s hook", name)
+	}
+	for _, container := range template.Spec.Containers {
+		if container.Image == "" {
+			return fmt.Errorf("TFJobSpec is not valid: Image is undefined in the container %s of the %s hook", container.Name, name)
+		}
+	}
+	// The hook runs as a Job, whose pods cannot restart always.
+	if template.Spec.RestartPolicy == v1.RestartPolicyAlways {
+		return fmt.Errorf("TFJobSpec is not valid: the restart policy of the %s hook cannot be %s", name, v1.RestartPolicyAlways)
+	}
+	return nil
+}
+
+func validateV1EvaluatorPolicy(policy *tfv1.EvaluatorPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	switch policy.StartPolicy {
+	case "", tfv1.StartPolicyConcurrent, tfv1.StartPolicyAfterTraining:
+		return nil
+	default:
+		return fmt.Errorf("TFJobSpec is not valid: unknown evaluator start policy %q", policy.StartPolicy)
+	}
+}
+
+func validateV1ReplicaSpecs(specs map[tfv1.TFReplicaType]*commonv1.ReplicaSpec, refs map[tfv1.TFReplicaType]tfv1.PodTemplateRef) error {
 	if specs == nil {
 		return fmt.Errorf("TFJobSpec is not valid")
 	}
-	foundChief := 0
 	var foundEvaluator int32 = 0
 	for rType, value := range specs {
-		if value == nil || len(value.Template.Spec.Containers) == 0 {
+		if value == nil {
 			return fmt.Errorf("TFJobSpec is not valid: containers definition expected in %v", rType)
 		}
-		if tfv1.IsChieforMaster(rType) {
-			foundChief++
-		}
 		if tfv1.IsEvaluator(rType) {
 			foundEvaluator = foundEvaluator + *value.Replicas
 		}
-		// Make sure the image is defined in the container.
-		numNamedTensorflow := 0
-		for _, container := range value.Template.Spec.Containers {
-			if container.Image == "" {
-				msg := fmt.Sprintf("TFJobSpec is not valid: Image is undefined in the container of %v", rType)
-				log.Error(msg)
-				return fmt.Errorf(msg)
-			}
-			if container.Name == tfv1.DefaultContainerName {
-				numNamedTensorflow++
-			}
+		if _, ok := refs[rType]; ok {
+			// The containers of the referenced template are checked once
+			// it is resolved.
+			continue
 		}
-		// Make sure there has at least one container named "tensorflow".
-		if numNamedTensorflow == 0 {
-			msg := fmt.Sprintf("TFJobSpec is not valid: There is no container named %s in %v", tfv1.DefaultContainerName, rType)
-			log.Error(msg)
-			return fmt.Errorf(msg)
+		if err := ValidateV1PodTemplate(rType, &value.Template); err != nil {
+			return err
 		}
 	}
-	if foundChief > 1 {
-		return fmt.Errorf("TFJobSpec is not valid: more than 1 chief/master found")
-	}
 	if foundEvaluator > 1 {
 		return fmt.Errorf("TFJobSpec is not valid: more than 1 evaluator found")
 	}
 	return nil
 }
+
+// ValidateV1ChiefAndMaster checks that the v1.TFJobSpec does not define both
+// Chief and Master replicas, whose pods would both claim the coordinator role
+// in TF_CONFIG. It is not part of ValidateV1TFJobSpec so that the TFJobs which
+// already run with both are still reconciled, it is enforced by the operator
+// on the TFJobs which have not started yet.
+func ValidateV1ChiefAndMaster(c *tfv1.TFJobSpec) error {
+	_, hasChief := c.TFReplicaSpecs[tfv1.TFReplicaTypeChief]
+	_, hasMaster := c.TFReplicaSpecs[tfv1.TFReplicaTypeMaster]
+	if hasChief && hasMaster {
+		return fmt.Errorf("TFJobSpec is not valid: both %s and %s are defined, remove %s, which is the legacy name of %s",
+			tfv1.TFReplicaTypeChief, tfv1.TFReplicaTypeMaster, tfv1.TFReplicaTypeMaster, tfv1.TFReplicaTypeChief)
+	}
+	return nil
+}
+
+// ValidateV1PSResources checks that the PS replicas of the defaulted
+// v1.TFJobSpec do not request GPUs, which they almost never use, e.g. when
+// the DefaultResources meant for the workers are set on them. It is not part
+// of ValidateV1TFJobSpec so that such TFJobs still run, the operator only
+// warns about them.
+func ValidateV1PSResources(c *tfv1.TFJobSpec) error {
+	spec, ok := c.TFReplicaSpecs[tfv1.TFReplicaTypePS]
+	if !ok || spec == nil {
+		return nil
+	}
+	for _, container := range spec.Template.Spec.Containers {
+		for _, resources := range []v1.ResourceList{container.Resources.Requests, container.Resources.Limits} {
+			if gpus, ok := resources[tfv1.ResourceGPU]; ok && !gpus.IsZero() {
+				return fmt.Errorf("TFJobSpec is not valid: the container %s of %v requests %s %s, which the PS replicas do not use",
+					container.Name, tfv1.TFReplicaTypePS, gpus.String(), tfv1.ResourceGPU)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateV1PodTemplate checks that the pod template of the replica type is
+// valid, including the templates referenced by the TFJobSpec once resolved.
+func ValidateV1PodTemplate(rType tfv1.TFReplicaType, template *v1.PodTemplateSpec) error {
+	if len(template.Spec.Containers) == 0 {
+		return fmt.Errorf("TFJobSpec is not valid: containers definition expected in %v", rType)
+	}
+	// Make sure the image is defined in the container.
+	numNamedTensorflow := 0
+	for _, container := range template.Spec.Containers {
+		if container.Image == "" {
+			msg := fmt.Sprintf("TFJobSpec is not valid: Image is undefined in the container of %v", rType)
+			log.Error(msg)
+			return errors.New(msg)
+		}
+		if container.Name == tfv1.DefaultContainerName {
+			numNamedTensorflow++
+		}
+	}
+	// Make sure there has at least one container named "tensorflow".
+	if numNamedTensorflow == 0 {
+		msg := fmt.Sprintf("TFJobSpec is not valid: There is no container named %s in %v", tfv1.DefaultContainerName, rType)
+		log.Error(msg)
+		return errors.New(msg)
+	}
+	return nil
+}
@@ -15,6 +15,7 @@
 package validation
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/golang/protobuf/proto"
@@ -22,9 +23,18 @@ import (
 	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func TestValidateV1TFJobSpec(t *testing.T) {
+	chiefOnly := tfv1.SuccessPolicy("ChiefOnly")
+	secret := tfv1.ClusterSpecVia("Secret")
+	scheduled := tfv1.DeadlineFrom("Scheduled")
+	minAvailable := intstr.FromInt(1)
+	maxUnavailable := intstr.FromString("50%")
+	negative := intstr.FromInt(-1)
 	testCases := []tfv1.TFJobSpec{
 		{
 			TFReplicaSpecs: nil,
@@ -106,6 +116,403 @@ func TestValidateV1TFJobSpec(t *testing.T) {
 				},
 			},
 		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeEval: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			EvaluatorPolicy: &tfv1.EvaluatorPolicy{
+				StartPolicy: "Later",
+			},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			SuccessPolicy: &chiefOnly,
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			TerminationGracePeriodSeconds: map[tfv1.TFReplicaType]int64{
+				tfv1.TFReplicaTypePS: 300,
+			},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			TerminationGracePeriodSeconds: map[tfv1.TFReplicaType]int64{
+				tfv1.TFReplicaTypeWorker: -1,
+			},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			PodCreationRampUp: &tfv1.PodCreationRampUp{BatchSize: 0},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			PodCreationRampUp: &tfv1.PodCreationRampUp{BatchSize: 10, IntervalSeconds: -1},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			PodDisruptionBudget: &tfv1.PodDisruptionBudgetSpec{MinAvailable: &minAvailable, MaxUnavailable: &maxUnavailable},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			PodDisruptionBudget: &tfv1.PodDisruptionBudgetSpec{MinAvailable: &negative},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			Sidecars: []v1.Container{{Name: "tensorflow", Image: "exporter:1.0"}},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			Sidecars: []v1.Container{{Name: "exporter", Image: "exporter:1.0"}, {Name: "exporter", Image: "exporter:1.0"}},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			Sidecars: []v1.Container{{Name: "exporter"}},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			SidecarVolumes: []v1.Volume{{Name: "metrics"}, {Name: "metrics"}},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			ClusterSpecVia: &secret,
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			DeadlineFrom: &scheduled,
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			TFConfigExtra: map[string]string{"rpc_layer": "grpc+verbs", "cluster": "{}"},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			TFConfigExtra: map[string]string{"rpc_layer": "grpc+verbs", "task": "{}"},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			TemplateRefs: map[tfv1.TFReplicaType]tfv1.PodTemplateRef{
+				tfv1.TFReplicaTypeWorker: {Name: "worker"},
+			},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Replicas: proto.Int32(1),
+				},
+			},
+			TemplateRefs: map[tfv1.TFReplicaType]tfv1.PodTemplateRef{
+				tfv1.TFReplicaTypeWorker: {Name: ""},
+			},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Replicas: proto.Int32(1),
+				},
+			},
+			TemplateRefs: map[tfv1.TFReplicaType]tfv1.PodTemplateRef{
+				tfv1.TFReplicaTypePS: {Name: "ps"},
+			},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			VolumeClaimTemplates: map[tfv1.TFReplicaType][]v1.PersistentVolumeClaim{
+				tfv1.TFReplicaTypePS: {{ObjectMeta: metav1.ObjectMeta{Name: "scratch"}}},
+			},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			VolumeClaimTemplates: map[tfv1.TFReplicaType][]v1.PersistentVolumeClaim{
+				tfv1.TFReplicaTypeWorker: {{}},
+			},
+		},
+		{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			VolumeClaimTemplates: map[tfv1.TFReplicaType][]v1.PersistentVolumeClaim{
+				tfv1.TFReplicaTypeWorker: {
+					{ObjectMeta: metav1.ObjectMeta{Name: "scratch"}},
+					{ObjectMeta: metav1.ObjectMeta{Name: "scratch"}},
+				},
+			},
+		},
 	}
 	for _, c := range testCases {
 		err := ValidateV1TFJobSpec(&c)
@@ -114,3 +521,293 @@ func TestValidateV1TFJobSpec(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateV1ChiefAndMaster(t *testing.T) {
+	newReplicaSpec := func() *commonv1.ReplicaSpec {
+		return &commonv1.ReplicaSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						v1.Container{
+							Name:  "tensorflow",
+							Image: "kubeflow/tf-dist-mnist-test:1.0",
+						},
+					},
+				},
+			},
+			Replicas: proto.Int32(1),
+		}
+	}
+	spec := tfv1.TFJobSpec{
+		TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+			tfv1.TFReplicaTypeChief:  newReplicaSpec(),
+			tfv1.TFReplicaTypeWorker: newReplicaSpec(),
+		},
+	}
+	if err := ValidateV1ChiefAndMaster(&spec); err != nil {
+		t.Errorf("Expected no error for a Chief only, got %v", err)
+	}
+	// The TFJobs which already run with both are still accepted by
+	// ValidateV1TFJobSpec.
+	spec.TFReplicaSpecs[tfv1.TFReplicaTypeMaster] = newReplicaSpec()
+	if err := ValidateV1TFJobSpec(&spec); err != nil {
+		t.Errorf("Expected no error from ValidateV1TFJobSpec, got %v", err)
+	}
+	err := ValidateV1ChiefAndMaster(&spec)
+	if err == nil || !strings.Contains(err.Error(), "remove Master") {
+		t.Errorf("Expected an error explaining to remove Master, got %v", err)
+	}
+}
+
+func TestValidateV1BestEffortReplicaTypes(t *testing.T) {
+	newReplicaSpec := func() *commonv1.ReplicaSpec {
+		return &commonv1.ReplicaSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						v1.Container{
+							Name:  "tensorflow",
+							Image: "kubeflow/tf-dist-mnist-test:1.0",
+						},
+					},
+				},
+			},
+			Replicas: proto.Int32(1),
+		}
+	}
+	testCases := []struct {
+		description   string
+		rTypes        []tfv1.TFReplicaType
+		startPolicy   tfv1.StartPolicy
+		expectedError string
+	}{
+		{"A custom replica type", []tfv1.TFReplicaType{"Profiler"}, "", ""},
+		{"The PS and the concurrent Evaluator", []tfv1.TFReplicaType{tfv1.TFReplicaTypePS, tfv1.TFReplicaTypeEval}, "", ""},
+		{"An unknown replica type", []tfv1.TFReplicaType{"DataEcho"}, "", "unknown best-effort replica type"},
+		{"The Worker", []tfv1.TFReplicaType{tfv1.TFReplicaTypeWorker}, "", "Worker cannot be best-effort"},
+		{"The Chief", []tfv1.TFReplicaType{tfv1.TFReplicaTypeChief}, "", "Chief cannot be best-effort"},
+		{"The Evaluator starting after training", []tfv1.TFReplicaType{tfv1.TFReplicaTypeEval}, tfv1.StartPolicyAfterTraining,
+			"Evaluator cannot be best-effort when it starts after training"},
+	}
+	for _, c := range testCases {
+		spec := tfv1.TFJobSpec{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeChief:  newReplicaSpec(),
+				tfv1.TFReplicaTypeWorker: newReplicaSpec(),
+				tfv1.TFReplicaTypePS:     newReplicaSpec(),
+				tfv1.TFReplicaTypeEval:   newReplicaSpec(),
+				"Profiler":               newReplicaSpec(),
+			},
+			BestEffortReplicaTypes: c.rTypes,
+		}
+		if c.startPolicy != "" {
+			spec.EvaluatorPolicy = &tfv1.EvaluatorPolicy{StartPolicy: c.startPolicy}
+		}
+		err := ValidateV1TFJobSpec(&spec)
+		if c.expectedError == "" && err != nil {
+			t.Errorf("%s: expected no error, got %v", c.description, err)
+		}
+		if c.expectedError != "" && (err == nil || !strings.Contains(err.Error(), c.expectedError)) {
+			t.Errorf("%s: expected an error containing %q, got %v", c.description, c.expectedError, err)
+		}
+	}
+}
+
+func TestValidateV1ReplicaStartupOrder(t *testing.T) {
+	newReplicaSpec := func() *commonv1.ReplicaSpec {
+		return &commonv1.ReplicaSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						v1.Container{
+							Name:  "tensorflow",
+							Image: "kubeflow/tf-dist-mnist-test:1.0",
+						},
+					},
+				},
+			},
+			Replicas: proto.Int32(1),
+		}
+	}
+	testCases := []struct {
+		description   string
+		order         []tfv1.TFReplicaType
+		gate          tfv1.StartupGate
+		expectedError string
+	}{
+		{"No startup order", nil, "", ""},
+		{"The PS, then the Chief, then the Workers", []tfv1.TFReplicaType{"PS", "Chief", "Worker"}, tfv1.StartupGateScheduled, ""},
+		{"The replica types in any case", []tfv1.TFReplicaType{"ps", "CHIEF"}, tfv1.StartupGateRunning, ""},
+		{"An unknown replica type", []tfv1.TFReplicaType{"PS", "Evaluator"}, "", "unknown replica type Evaluator in the replica startup order"},
+		{"A replica type listed twice", []tfv1.TFReplicaType{"PS", "Worker", "ps"}, "", "replica type ps is listed twice"},
+		{"An unknown gate", []tfv1.TFReplicaType{"PS", "Worker"}, "Ready", "unknown replica startup gate \"Ready\""},
+	}
+	for _, c := range testCases {
+		spec := tfv1.TFJobSpec{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				"chief":                  newReplicaSpec(),
+				tfv1.TFReplicaTypeWorker: newReplicaSpec(),
+				tfv1.TFReplicaTypePS:     newReplicaSpec(),
+			},
+			ReplicaStartupOrder: c.order,
+			ReplicaStartupGate:  c.gate,
+		}
+		err := ValidateV1TFJobSpec(&spec)
+		if c.expectedError == "" && err != nil {
+			t.Errorf("%s: expected no error, got %v", c.description, err)
+		}
+		if c.expectedError != "" && (err == nil || !strings.Contains(err.Error(), c.expectedError)) {
+			t.Errorf("%s: expected an error containing %q, got %v", c.description, c.expectedError, err)
+		}
+	}
+}
+
+func TestValidateV1PSResources(t *testing.T) {
+	newReplicaSpec := func(resources v1.ResourceRequirements) *commonv1.ReplicaSpec {
+		return &commonv1.ReplicaSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						v1.Container{
+							Name:      "tensorflow",
+							Image:     "kubeflow/tf-dist-mnist-test:1.0",
+							Resources: resources,
+						},
+					},
+				},
+			},
+			Replicas: proto.Int32(1),
+		}
+	}
+	gpu := v1.ResourceRequirements{Limits: v1.ResourceList{tfv1.ResourceGPU: resource.MustParse("1")}}
+	cpu := v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}}
+	testCases := []struct {
+		description   string
+		ps, worker    v1.ResourceRequirements
+		expectedError string
+	}{
+		{"The workers request GPUs", cpu, gpu, ""},
+		{"The PS request GPUs", gpu, gpu, "the container tensorflow of PS requests 1 nvidia.com/gpu"},
+		{"The PS request no GPUs", v1.ResourceRequirements{Limits: v1.ResourceList{tfv1.ResourceGPU: resource.MustParse("0")}}, gpu, ""},
+	}
+	for _, c := range testCases {
+		spec := tfv1.TFJobSpec{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: newReplicaSpec(c.worker),
+				tfv1.TFReplicaTypePS:     newReplicaSpec(c.ps),
+			},
+		}
+		err := ValidateV1PSResources(&spec)
+		if c.expectedError == "" && err != nil {
+			t.Errorf("%s: expected no error, got %v", c.description, err)
+		}
+		if c.expectedError != "" && (err == nil || !strings.Contains(err.Error(), c.expectedError)) {
+			t.Errorf("%s: expected an error containing %q, got %v", c.description, c.expectedError, err)
+		}
+	}
+}
+
+func TestValidateV1FailurePolicies(t *testing.T) {
+	newReplicaSpec := func() *commonv1.ReplicaSpec {
+		return &commonv1.ReplicaSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						v1.Container{
+							Name:  "tensorflow",
+							Image: "kubeflow/tf-dist-mnist-test:1.0",
+						},
+					},
+				},
+			},
+			Replicas: proto.Int32(1),
+		}
+	}
+	testCases := []struct {
+		description   string
+		policies      map[tfv1.TFReplicaType]tfv1.FailurePolicy
+		bestEffort    []tfv1.TFReplicaType
+		expectedError string
+	}{
+		{"The PS failing the job and the Evaluator ignored", map[tfv1.TFReplicaType]tfv1.FailurePolicy{
+			tfv1.TFReplicaTypePS:   tfv1.FailurePolicyFailJob,
+			tfv1.TFReplicaTypeEval: tfv1.FailurePolicyIgnore,
+		}, nil, ""},
+		{"The Worker restarted", map[tfv1.TFReplicaType]tfv1.FailurePolicy{tfv1.TFReplicaTypeWorker: tfv1.FailurePolicyRestart}, nil, ""},
+		{"An unknown policy", map[tfv1.TFReplicaType]tfv1.FailurePolicy{tfv1.TFReplicaTypePS: "Retry"}, nil, `unknown failure policy "Retry" of PS`},
+		{"An unknown replica type", map[tfv1.TFReplicaType]tfv1.FailurePolicy{"DataEcho": tfv1.FailurePolicyIgnore}, nil,
+			"failure policy of unknown replica type DataEcho"},
+		{"The Worker ignored", map[tfv1.TFReplicaType]tfv1.FailurePolicy{tfv1.TFReplicaTypeWorker: tfv1.FailurePolicyIgnore}, nil,
+			"the failures of Worker cannot be ignored"},
+		{"A best-effort replica type failing the job", map[tfv1.TFReplicaType]tfv1.FailurePolicy{tfv1.TFReplicaTypePS: tfv1.FailurePolicyFailJob},
+			[]tfv1.TFReplicaType{tfv1.TFReplicaTypePS}, "the failures of the best-effort PS cannot fail the job"},
+	}
+	for _, c := range testCases {
+		spec := tfv1.TFJobSpec{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: newReplicaSpec(),
+				tfv1.TFReplicaTypePS:     newReplicaSpec(),
+				tfv1.TFReplicaTypeEval:   newReplicaSpec(),
+			},
+			FailurePolicies:        c.policies,
+			BestEffortReplicaTypes: c.bestEffort,
+		}
+		err := ValidateV1TFJobSpec(&spec)
+		if c.expectedError == "" && err != nil {
+			t.Errorf("%s: expected no error, got %v", c.description, err)
+		}
+		if c.expectedError != "" && (err == nil || !strings.Contains(err.Error(), c.expectedError)) {
+			t.Errorf("%s: expected an error containing %q, got %v", c.description, c.expectedError, err)
+		}
+	}
+}
+
+func TestValidateV1Hooks(t *testing.T) {
+	testCases := []struct {
+		description   string
+		onSuccess     *v1.PodTemplateSpec
+		onFailure     *v1.PodTemplateSpec
+		expectedError string
+	}{
+		{"No hooks", nil, nil, ""},
+		{"An upload on success", &v1.PodTemplateSpec{Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "upload", Image: "uploader"}},
+		}}, nil, ""},
+		{"A hook without containers", nil, &v1.PodTemplateSpec{}, "containers definition expected in the onFailure hook"},
+		{"A hook without image", &v1.PodTemplateSpec{Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "upload"}},
+		}}, nil, "Image is undefined in the container upload of the onSuccess hook"},
+		{"A hook restarting always", &v1.PodTemplateSpec{Spec: v1.PodSpec{
+			Containers:    []v1.Container{{Name: "upload", Image: "uploader"}},
+			RestartPolicy: v1.RestartPolicyAlways,
+		}}, nil, "the restart policy of the onSuccess hook cannot be Always"},
+	}
+	for _, c := range testCases {
+		spec := tfv1.TFJobSpec{
+			TFReplicaSpecs: map[tfv1.TFReplicaType]*commonv1.ReplicaSpec{
+				tfv1.TFReplicaTypeWorker: &commonv1.ReplicaSpec{
+					Template: v1.PodTemplateSpec{
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								v1.Container{
+									Name:  "tensorflow",
+									Image: "kubeflow/tf-dist-mnist-test:1.0",
+								},
+							},
+						},
+					},
+					Replicas: proto.Int32(1),
+				},
+			},
+			OnSuccess: c.onSuccess,
+			OnFailure: c.onFailure,
+		}
+		err := ValidateV1TFJobSpec(&spec)
+		if c.expectedError == "" && err != nil {
+			t.Errorf("%s: expected no error, got %v", c.description, err)
+		}
+		if c.expectedError != "" && (err == nil || !strings.Contains(err.Error(), c.expectedError)) {
+			t.Errorf("%s: expected an error containing %q, got %v", c.description, c.expectedError, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobcontroller
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/kubernetes/pkg/controller"
+)
+
+// TimestampedExpectations is an expectations store which also tells since
+// when the expectations of each key have been set, which the expectations of
+// the controller package keep to themselves.
+type TimestampedExpectations interface {
+	controller.ControllerExpectationsInterface
+	// GetExpectationsTimestamp returns the time the expectations of the key
+	// were last set, and false if it has none.
+	GetExpectationsTimestamp(controllerKey string) (time.Time, bool)
+	// ListKeys returns the keys which have expectations.
+	ListKeys() []string
+}
+
+// timestampedExpectations records the time the expectations of each key are
+// set along with the controller expectations.
+type timestampedExpectations struct {
+	*controller.ControllerExpectations
+	clock clock.Clock
+
+	mu         sync.Mutex
+	timestamps map[string]time.Time
+}
+
+// NewTimestampedExpectations returns an empty expectations store recording the
+// time the expectations are set with the clock.
+func NewTimestampedExpectations(clock clock.Clock) TimestampedExpectations {
+	return &timestampedExpectations{
+		ControllerExpectations: controller.NewControllerExpectations(),
+		clock:                  clock,
+		timestamps:             make(map[string]time.Time),
+	}
+}
+
+func (e *timestampedExpectations) GetExpectationsTimestamp(controllerKey string) (time.Time, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	timestamp, ok := e.timestamps[controllerKey]
+	return timestamp, ok
+}
+
+func (e *timestampedExpectations) SetExpectations(controllerKey string, add, del int) error {
+	e.mu.Lock()
+	e.timestamps[controllerKey] = e.clock.Now()
+	e.mu.Unlock()
+	return e.ControllerExpectations.SetExpectations(controllerKey, add, del)
+}
+
+// ExpectCreations and ExpectDeletions set the expectations through the store,
+// so that they are timestamped as well.
+func (e *timestampedExpectations) ExpectCreations(controllerKey string, adds int) error {
+	return e.SetExpectations(controllerKey, adds, 0)
+}
+
+func (e *timestampedExpectations) ExpectDeletions(controllerKey string, dels int) error {
+	return e.SetExpectations(controllerKey, 0, dels)
+}
+
+func (e *timestampedExpectations) DeleteExpectations(controllerKey string) {
+	e.mu.Lock()
+	delete(e.timestamps, controllerKey)
+	e.mu.Unlock()
+	e.ControllerExpectations.DeleteExpectations(controllerKey)
+}
@@ -13,8 +13,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/apimachinery/pkg/util/intstr"
-	kubeinformers "k8s.io/client-go/informers"
 	kubeclientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
@@ -60,6 +60,10 @@ type ControllerInterface interface {
 	GetJobFromAPIClient(namespace, name string) (metav1.Object, error)
 }
 
+// DefaultGangSchedulerName is the scheduler the pods are gang-scheduled by
+// when no gang scheduler name is configured.
+const DefaultGangSchedulerName = "kube-batch"
+
 // JobControllerConfiguration contains configuration of operator.
 type JobControllerConfiguration struct {
 	// ReconcilerSyncLoopPeriod is the amount of time the reconciler sync states loop
@@ -121,6 +125,8 @@ type JobController struct {
 	// - "tf-operator/tfjob-abc/ps/pods", expects 2 adds.
 	// - "tf-operator/tfjob-abc/worker/services", expects 4 adds.
 	// - "tf-operator/tfjob-abc/worker/pods", expects 4 adds.
+	// It is a TimestampedExpectations, which also tells since when the
+	// expectations have been set, unless it is replaced.
 	Expectations controller.ControllerExpectationsInterface
 
 	// workQueue is a rate limited work queue. This is used to queue work to be
@@ -153,7 +159,8 @@ func NewJobController(
 	gangSchedulerName string,
 	kubeClientSet kubeclientset.Interface,
 	kubeBatchClientSet kubebatchclient.Interface,
-	kubeInformerFactory kubeinformers.SharedInformerFactory,
+	podLister corelisters.PodLister,
+	serviceLister corelisters.ServiceLister,
 	workQueueName string) JobController {
 
 	log.Debug("Creating event broadcaster")
@@ -172,6 +179,9 @@ func NewJobController(
 		Recorder:   eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: controllerImpl.ControllerName()}),
 	}
 
+	if gangSchedulerName == "" {
+		gangSchedulerName = DefaultGangSchedulerName
+	}
 	jobControllerConfig := JobControllerConfiguration{
 		ReconcilerSyncLoopPeriod: reconcilerSyncPeriod,
 		EnableGangScheduling:     enableGangScheduling,
@@ -185,7 +195,9 @@ func NewJobController(
 		ServiceControl:     realServiceControl,
 		KubeClientSet:      kubeClientSet,
 		KubeBatchClientSet: kubeBatchClientSet,
-		Expectations:       controller.NewControllerExpectations(),
+		PodLister:          podLister,
+		ServiceLister:      serviceLister,
+		Expectations:       NewTimestampedExpectations(clock.RealClock{}),
 		WorkQueue:          workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), workQueueName),
 		Recorder:           recorder,
 	}
@@ -297,3 +309,38 @@ func (jc *JobController) resolveControllerRef(namespace string, controllerRef *m
 	}
 	return job
 }
+
+// resolveOrphanJob returns the job an orphan pod or service with the given
+// labels may be adopted by, or nil if the labels do not name a live job of
+// this controller. Whether the job adopts it is decided when it is synced.
+func (jc *JobController) resolveOrphanJob(namespace string, objLabels map[string]string) metav1.Object {
+	if objLabels[jc.Controller.GetGroupNameLabelKey()] != jc.Controller.GetGroupNameLabelValue() {
+		return nil
+	}
+	jobName, ok := objLabels[JobNameLabel]
+	if !ok {
+		return nil
+	}
+	job, err := jc.Controller.GetJobFromInformerCache(namespace, jobName)
+	if err != nil || job.GetDeletionTimestamp() != nil {
+		return nil
+	}
+	return job
+}
+
+// canAdoptFunc returns the check run before the job adopts any pod or
+// service. It rereads the job with an uncached quorum read, so that a job
+// which was deleted, or deleted and recreated with the same name, does not
+// adopt the objects of its successor.
+func (jc *JobController) canAdoptFunc(job metav1.Object) func() error {
+	return RecheckDeletionTimestamp(func() (metav1.Object, error) {
+		fresh, err := jc.Controller.GetJobFromAPIClient(job.GetNamespace(), job.GetName())
+		if err != nil {
+			return nil, err
+		}
+		if fresh.GetUID() != job.GetUID() {
+			return nil, fmt.Errorf("original Job %v/%v is gone: got uid %v, wanted %v", job.GetNamespace(), job.GetName(), fresh.GetUID(), job.GetUID())
+		}
+		return fresh, nil
+	})
+}
@@ -61,6 +61,15 @@ func (jc *JobController) AddPod(obj interface{}) {
 		return
 	}
 
+	// Otherwise, it's an orphan. Sync the job its labels match, if any, so
+	// that it can be adopted.
+	if job := jc.resolveOrphanJob(pod.Namespace, pod.Labels); job != nil {
+		jobKey, err := controller.KeyFunc(job)
+		if err != nil {
+			return
+		}
+		jc.WorkQueue.Add(jobKey)
+	}
 }
 
 // When a pod is updated, figure out what tfjob/s manage it and wake them up.
@@ -107,6 +116,20 @@ func (jc *JobController) UpdatePod(old, cur interface{}) {
 		jc.WorkQueue.Add(jobKey)
 		return
 	}
+
+	// Otherwise, it's an orphan. If anything changed, sync the job its labels
+	// match, if any, so that it can be adopted.
+	labelChanged := !reflect.DeepEqual(curPod.Labels, oldPod.Labels)
+	if labelChanged || controllerRefChanged {
+		if job := jc.resolveOrphanJob(curPod.Namespace, curPod.Labels); job != nil {
+			logger.Debugf("orphan pod updated: %v, %v", curPod, oldPod)
+			jobKey, err := controller.KeyFunc(job)
+			if err != nil {
+				return
+			}
+			jc.WorkQueue.Add(jobKey)
+		}
+	}
 }
 
 // When a pod is deleted, enqueue the job that manages the pod and update its expectations.
@@ -163,13 +186,9 @@ func (jc *JobController) DeletePod(obj interface{}) {
 // It also reconciles ControllerRef by adopting/orphaning.
 // Note that the returned Pods are pointers into the cache.
 func (jc *JobController) GetPodsForJob(job metav1.Object) ([]*v1.Pod, error) {
-	// Create selector.
-	selector, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
-		MatchLabels: jc.GenLabels(job.GetName()),
-	})
-
+	cm, err := jc.NewPodControllerRefManager(job)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't convert Job selector: %v", err)
+		return nil, err
 	}
 	// List all pods to include those that don't match the selector anymore
 	// but have a ControllerRef pointing to this controller.
@@ -177,22 +196,25 @@ func (jc *JobController) GetPodsForJob(job metav1.Object) ([]*v1.Pod, error) {
 	if err != nil {
 		return nil, err
 	}
+	return cm.ClaimPods(pods)
+}
+
+// NewPodControllerRefManager returns the manager which adopts and orphans the
+// pods of the job. Its ClaimPods can be called on several subsets of the pods
+// of the job, the deletion of the job is only rechecked once.
+func (jc *JobController) NewPodControllerRefManager(job metav1.Object) (*controller.PodControllerRefManager, error) {
+	// Create selector.
+	selector, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
+		MatchLabels: jc.GenLabels(job.GetName()),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't convert Job selector: %v", err)
+	}
 
 	// If any adoptions are attempted, we should first recheck for deletion
 	// with an uncached quorum read sometime after listing Pods (see #42639).
-
-	canAdoptFunc := RecheckDeletionTimestamp(func() (metav1.Object, error) {
-		fresh, err := jc.Controller.GetJobFromAPIClient(job.GetNamespace(), job.GetName())
-		if err != nil {
-			return nil, err
-		}
-		if fresh.GetUID() != job.GetUID() {
-			return nil, fmt.Errorf("original Job %v/%v is gone: got uid %v, wanted %v", job.GetNamespace(), job.GetName(), fresh.GetUID(), job.GetUID())
-		}
-		return fresh, nil
-	})
-	cm := controller.NewPodControllerRefManager(jc.PodControl, job, selector, jc.Controller.GetAPIGroupVersionKind(), canAdoptFunc)
-	return cm.ClaimPods(pods)
+	return controller.NewPodControllerRefManager(jc.PodControl, job, selector, jc.Controller.GetAPIGroupVersionKind(), jc.canAdoptFunc(job)), nil
 }
 
 // FilterPodsForReplicaType returns pods belong to a replicaType.
@@ -2,12 +2,15 @@ package jobcontroller
 
 import (
 	"fmt"
+	"reflect"
 	"strconv"
 
 	log "github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/kubernetes/pkg/controller"
 
 	"github.com/kubeflow/tf-operator/pkg/control"
@@ -50,25 +53,135 @@ func (jc *JobController) AddService(obj interface{}) {
 		return
 	}
 
+	// Otherwise, it's an orphan. Sync the job its labels match, if any, so
+	// that it can be adopted.
+	if job := jc.resolveOrphanJob(service.Namespace, service.Labels); job != nil {
+		jobKey, err := controller.KeyFunc(job)
+		if err != nil {
+			return
+		}
+		jc.WorkQueue.Add(jobKey)
+	}
 }
 
 // When a service is updated, figure out what job/s manage it and wake them up.
 // If the labels of the service have changed we need to awaken both the old
 // and new replica set. old and cur must be *v1.Service types.
 func (jc *JobController) UpdateService(old, cur interface{}) {
-	// TODO(CPH): handle this gracefully.
+	curService := cur.(*v1.Service)
+	oldService := old.(*v1.Service)
+	if curService.ResourceVersion == oldService.ResourceVersion {
+		// Periodic resync will send update events for all known services.
+		// Two different versions of the same service will always have different RVs.
+		return
+	}
+
+	curControllerRef := metav1.GetControllerOf(curService)
+	oldControllerRef := metav1.GetControllerOf(oldService)
+	controllerRefChanged := !reflect.DeepEqual(curControllerRef, oldControllerRef)
+	if controllerRefChanged && oldControllerRef != nil {
+		// The ControllerRef was changed. Sync the old controller, if any.
+		if job := jc.resolveControllerRef(oldService.Namespace, oldControllerRef); job != nil {
+			jobKey, err := controller.KeyFunc(job)
+			if err != nil {
+				return
+			}
+			jc.WorkQueue.Add(jobKey)
+		}
+	}
+
+	// If it has a ControllerRef, that's all that matters.
+	if curControllerRef != nil {
+		job := jc.resolveControllerRef(curService.Namespace, curControllerRef)
+		if job == nil {
+			return
+		}
+		jobKey, err := controller.KeyFunc(job)
+		if err != nil {
+			return
+		}
+		jc.WorkQueue.Add(jobKey)
+		return
+	}
+
+	// Otherwise, it's an orphan. If anything changed, sync the job its labels
+	// match, if any, so that it can be adopted.
+	labelChanged := !reflect.DeepEqual(curService.Labels, oldService.Labels)
+	if labelChanged || controllerRefChanged {
+		if job := jc.resolveOrphanJob(curService.Namespace, curService.Labels); job != nil {
+			jobKey, err := controller.KeyFunc(job)
+			if err != nil {
+				return
+			}
+			jc.WorkQueue.Add(jobKey)
+		}
+	}
 }
 
 // When a service is deleted, enqueue the job that manages the service and update its expectations.
 // obj could be an *v1.Service, or a DeletionFinalStateUnknown marker item.
 func (jc *JobController) DeleteService(obj interface{}) {
-	// TODO(CPH): handle this gracefully.
+	service, ok := obj.(*v1.Service)
+
+	// When a delete is dropped, the relist will notice a service in the store not
+	// in the list, leading to the insertion of a tombstone object which contains
+	// the deleted key/value. Note that this value might be stale.
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("couldn't get object from tombstone %+v", obj))
+			return
+		}
+		service, ok = tombstone.Obj.(*v1.Service)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("tombstone contained object that is not a service %+v", obj))
+			return
+		}
+	}
+
+	controllerRef := metav1.GetControllerOf(service)
+	if controllerRef == nil {
+		// No controller should care about orphans being deleted.
+		return
+	}
+	job := jc.resolveControllerRef(service.Namespace, controllerRef)
+	if job == nil {
+		return
+	}
+	jobKey, err := controller.KeyFunc(job)
+	if err != nil {
+		return
+	}
+
+	if _, ok := service.Labels[jc.Controller.GetReplicaTypeLabelKey()]; !ok {
+		log.Infof("This service maybe not created by %v", jc.Controller.ControllerName())
+		return
+	}
+
+	rtype := service.Labels[jc.Controller.GetReplicaTypeLabelKey()]
+	expectationServicesKey := GenExpectationServicesKey(jobKey, rtype)
+
+	jc.Expectations.DeletionObserved(expectationServicesKey)
+	// TODO: we may need add backoff here
+	jc.WorkQueue.Add(jobKey)
 }
 
 // getServicesForJob returns the set of services that this job should manage.
 // It also reconciles ControllerRef by adopting/orphaning.
 // Note that the returned services are pointers into the cache.
 func (jc *JobController) GetServicesForJob(job metav1.Object) ([]*v1.Service, error) {
+	// List all services to include those that don't match the selector anymore
+	// but have a ControllerRef pointing to this controller.
+	services, err := jc.ServiceLister.Services(job.GetNamespace()).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	return jc.ClaimServices(job, services)
+}
+
+// ClaimServices reconciles ControllerRef on the given services by
+// adopting/orphaning, for the controllers which list them themselves.
+func (jc *JobController) ClaimServices(job metav1.Object, services []*v1.Service) ([]*v1.Service, error) {
 	// Create selector
 	selector, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
 		MatchLabels: jc.GenLabels(job.GetName()),
@@ -77,26 +190,10 @@ func (jc *JobController) GetServicesForJob(job metav1.Object) ([]*v1.Service, er
 	if err != nil {
 		return nil, fmt.Errorf("couldn't convert Job selector: %v", err)
 	}
-	// List all services to include those that don't match the selector anymore
-	// but have a ControllerRef pointing to this controller.
-	services, err := jc.ServiceLister.Services(job.GetNamespace()).List(labels.Everything())
-	if err != nil {
-		return nil, err
-	}
 
 	// If any adoptions are attempted, we should first recheck for deletion
 	// with an uncached quorum read sometime after listing services (see #42639).
-	canAdoptFunc := RecheckDeletionTimestamp(func() (metav1.Object, error) {
-		fresh, err := jc.Controller.GetJobFromInformerCache(job.GetNamespace(), job.GetName())
-		if err != nil {
-			return nil, err
-		}
-		if fresh.GetUID() != job.GetUID() {
-			return nil, fmt.Errorf("original Job %v/%v is gone: got uid %v, wanted %v", job.GetNamespace(), job.GetName(), fresh.GetUID(), job.GetUID())
-		}
-		return fresh, nil
-	})
-	cm := control.NewServiceControllerRefManager(jc.ServiceControl, job, selector, jc.Controller.GetAPIGroupVersionKind(), canAdoptFunc)
+	cm := control.NewServiceControllerRefManager(jc.ServiceControl, job, selector, jc.Controller.GetAPIGroupVersionKind(), jc.canAdoptFunc(job))
 	return cm.ClaimServices(services)
 }
 
@@ -16,16 +16,84 @@ package jobcontroller
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
+const (
+	// The placeholders of a NameTemplate.
+	NameTemplateJob         = "{job}"
+	NameTemplateReplicaType = "{type}"
+	NameTemplateIndex       = "{index}"
+
+	// DefaultNameTemplate is the NameTemplate of GenGeneralName.
+	DefaultNameTemplate = NameTemplateJob + "-" + NameTemplateReplicaType + "-" + NameTemplateIndex
+)
+
+// nameTemplatePlaceholders matches the placeholders of a NameTemplate.
+var nameTemplatePlaceholders = regexp.MustCompile(`\{[^}]*\}`)
+
 func GenGeneralName(jobName, rtype, index string) string {
 	n := jobName + "-" + rtype + "-" + index
 	return strings.Replace(n, "/", "-", -1)
 }
 
+// NameTemplate generates the names of the pods and services of the replicas
+// of a job from its placeholders, e.g. "{job}-{type}-{index}". The empty
+// template is the one of GenGeneralName.
+type NameTemplate string
+
+// GenName returns the name of the replica of the given type and index of the
+// job.
+func (t NameTemplate) GenName(jobName, rtype, index string) string {
+	if t == "" {
+		return GenGeneralName(jobName, rtype, index)
+	}
+	n := strings.NewReplacer(NameTemplateJob, jobName, NameTemplateReplicaType, rtype, NameTemplateIndex, index).Replace(string(t))
+	return strings.Replace(n, "/", "-", -1)
+}
+
+// ValidateNameTemplate checks that the names generated by the template are
+// unique and valid service names. It must contain each placeholder once,
+// separated by literals containing a dash: as the replica types and indexes
+// never contain one, the names of distinct replicas cannot collide. Its
+// literals are restricted to the characters of a DNS-1035 label, so that the
+// names are valid as long as they are not too long, which depends on the
+// name of the job.
+func ValidateNameTemplate(tmpl string) error {
+	for _, placeholder := range nameTemplatePlaceholders.FindAllString(tmpl, -1) {
+		if placeholder != NameTemplateJob && placeholder != NameTemplateReplicaType && placeholder != NameTemplateIndex {
+			return fmt.Errorf("unknown placeholder %s, expected %s, %s or %s",
+				placeholder, NameTemplateJob, NameTemplateReplicaType, NameTemplateIndex)
+		}
+	}
+	for _, placeholder := range []string{NameTemplateJob, NameTemplateReplicaType, NameTemplateIndex} {
+		if n := strings.Count(tmpl, placeholder); n != 1 {
+			return fmt.Errorf("expected the placeholder %s once, got it %d times", placeholder, n)
+		}
+	}
+	literals := nameTemplatePlaceholders.Split(tmpl, -1)
+	for _, literal := range literals[1 : len(literals)-1] {
+		if !strings.Contains(literal, "-") {
+			return fmt.Errorf("expected the placeholders to be separated by a dash")
+		}
+	}
+	for _, literal := range literals {
+		for _, c := range literal {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return fmt.Errorf("invalid character %q, expected lower case alphanumeric characters or '-'", c)
+			}
+		}
+	}
+	if name := NameTemplate(tmpl).GenName("job", "worker", "0"); len(validation.IsDNS1035Label(name)) > 0 {
+		return fmt.Errorf("the names must start with a letter and end with an alphanumeric character, e.g. %s", name)
+	}
+	return nil
+}
+
 // RecheckDeletionTimestamp returns a CanAdopt() function to recheck deletion.
 //
 // The CanAdopt() function calls getObject() to fetch the latest value,
@@ -30,3 +30,46 @@ func TestGenGeneralName(t *testing.T) {
 		t.Errorf("Expected name %s, got %s", expectedName, name)
 	}
 }
+
+func TestNameTemplate(t *testing.T) {
+	testCases := []struct {
+		template string
+		expected string
+	}{
+		{"", "tfjob-worker-1"},
+		{DefaultNameTemplate, "tfjob-worker-1"},
+		{"tf-{type}-{index}-{job}", "tf-worker-1-tfjob"},
+	}
+	for _, c := range testCases {
+		if name := NameTemplate(c.template).GenName("tfjob", "worker", "1"); name != c.expected {
+			t.Errorf("%q: expected name %s, got %s", c.template, c.expected, name)
+		}
+	}
+}
+
+func TestValidateNameTemplate(t *testing.T) {
+	testCases := []struct {
+		template string
+		valid    bool
+	}{
+		{DefaultNameTemplate, true},
+		{"tf-{type}-{index}-{job}", true},
+		{"{job}--{type}-x-{index}", true},
+		// The names of distinct replicas could collide.
+		{"{job}-{type}{index}", false},
+		{"{job}-{type}-{type}-{index}", false},
+		{"{job}-{index}", false},
+		{"{job}-{type}-{replica}", false},
+		// The names would not be valid service names.
+		{"{index}-{type}-{job}", false},
+		{"{job}-{type}-{index}-", false},
+		{"{job}_{type}_{index}", false},
+		{"{job}.{type}.{index}", false},
+		{"Job-{job}-{type}-{index}", false},
+	}
+	for _, c := range testCases {
+		if err := ValidateNameTemplate(c.template); (err == nil) != c.valid {
+			t.Errorf("%q: expected valid %v, got %v", c.template, c.valid, err)
+		}
+	}
+}
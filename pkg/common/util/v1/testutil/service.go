@@ -40,6 +40,20 @@ func NewService(tfJob *tfv1.TFJob, typ string, index int, t *testing.T) *v1.Serv
 	service := NewBaseService(fmt.Sprintf("%s-%d", typ, index), tfJob, t)
 	service.Labels[tfReplicaTypeLabel] = typ
 	service.Labels[tfReplicaIndexLabel] = fmt.Sprintf("%d", index)
+	// The spec of the headless service created by the operator.
+	service.Spec = v1.ServiceSpec{
+		ClusterIP: "None",
+		Selector:  make(map[string]string, len(service.Labels)),
+		Ports: []v1.ServicePort{
+			{
+				Name: tfv1.DefaultPortName,
+				Port: tfv1.DefaultPort,
+			},
+		},
+	}
+	for key, value := range service.Labels {
+		service.Spec.Selector[key] = value
+	}
 	return service
 }
 
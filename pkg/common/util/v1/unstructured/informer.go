@@ -14,6 +14,7 @@ import (
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/tools/cache"
 
+	"github.com/kubeflow/tf-operator/pkg/client/informers/externalversions/internalinterfaces"
 	informer "github.com/kubeflow/tf-operator/pkg/client/informers/externalversions/tensorflow/v1"
 	lister "github.com/kubeflow/tf-operator/pkg/client/listers/tensorflow/v1"
 )
@@ -28,6 +29,14 @@ func NewTFJobInformer(resource schema.GroupVersionResource, client dynamic.Inter
 	}
 }
 
+// NewFilteredTFJobInformer is like NewTFJobInformer, but tweakListOptions
+// is applied to the list and watch requests, e.g. to set a label selector.
+func NewFilteredTFJobInformer(resource schema.GroupVersionResource, client dynamic.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers, tweakListOptions internalinterfaces.TweakListOptionsFunc) informer.TFJobInformer {
+	return &UnstructuredInformer{
+		informer: newFilteredUnstructuredInformer(resource, client, namespace, resyncPeriod, indexers, tweakListOptions),
+	}
+}
+
 func (f *UnstructuredInformer) Informer() cache.SharedIndexInformer {
 	return f.informer
 }
@@ -40,19 +49,25 @@ func (f *UnstructuredInformer) Lister() lister.TFJobLister {
 // Always prefer using an informer factory to get a shared informer instead of getting an independent
 // one. This reduces memory footprint and number of connections to the server.
 func newUnstructuredInformer(resource schema.GroupVersionResource, client dynamic.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
-	return newFilteredUnstructuredInformer(resource, client, namespace, resyncPeriod, indexers)
+	return newFilteredUnstructuredInformer(resource, client, namespace, resyncPeriod, indexers, nil)
 }
 
 // newFilteredUnstructuredInformer constructs a new informer for Unstructured type.
 // Always prefer using an informer factory to get a shared informer instead of getting an independent
 // one. This reduces memory footprint and number of connections to the server.
-func newFilteredUnstructuredInformer(resource schema.GroupVersionResource, client dynamic.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+func newFilteredUnstructuredInformer(resource schema.GroupVersionResource, client dynamic.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers, tweakListOptions internalinterfaces.TweakListOptionsFunc) cache.SharedIndexInformer {
 	return cache.NewSharedIndexInformer(
 		&cache.ListWatch{
 			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
 				return client.Resource(resource).Namespace(namespace).List(options)
 			},
 			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
 				return client.Resource(resource).Namespace(namespace).Watch(options)
 			},
 		},
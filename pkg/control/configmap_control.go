@@ -0,0 +1,163 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	FailedCreateConfigMapReason     = "FailedCreateConfigMap"
+	SuccessfulCreateConfigMapReason = "SuccessfulCreateConfigMap"
+	FailedUpdateConfigMapReason     = "FailedUpdateConfigMap"
+	SuccessfulUpdateConfigMapReason = "SuccessfulUpdateConfigMap"
+	FailedDeleteConfigMapReason     = "FailedDeleteConfigMap"
+	SuccessfulDeleteConfigMapReason = "SuccessfulDeleteConfigMap"
+)
+
+// ConfigMapControlInterface is an interface that knows how to get, apply or
+// delete ConfigMaps, created as an interface to allow testing.
+type ConfigMapControlInterface interface {
+	// GetConfigMap returns the ConfigMap identified by name.
+	GetConfigMap(namespace, name string) (*v1.ConfigMap, error)
+	// ApplyConfigMap creates the ConfigMap with object as its controller, or
+	// updates its data if it already exists and is controlled by object.
+	ApplyConfigMap(namespace string, configMap *v1.ConfigMap, object runtime.Object, controllerRef *metav1.OwnerReference) error
+	// DeleteConfigMap deletes the ConfigMap identified by name.
+	DeleteConfigMap(namespace, name string, object runtime.Object) error
+}
+
+// RealConfigMapControl is the default implementation of ConfigMapControlInterface.
+type RealConfigMapControl struct {
+	KubeClient clientset.Interface
+	Recorder   record.EventRecorder
+}
+
+func (r RealConfigMapControl) GetConfigMap(namespace, name string) (*v1.ConfigMap, error) {
+	return r.KubeClient.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+}
+
+func (r RealConfigMapControl) ApplyConfigMap(namespace string, configMap *v1.ConfigMap, object runtime.Object, controllerRef *metav1.OwnerReference) error {
+	if err := validateControllerRef(controllerRef); err != nil {
+		return err
+	}
+	existing, err := r.KubeClient.CoreV1().ConfigMaps(namespace).Get(configMap.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		configMapWithOwner := configMap.DeepCopy()
+		configMapWithOwner.OwnerReferences = append(configMapWithOwner.OwnerReferences, *controllerRef)
+		if _, err := r.KubeClient.CoreV1().ConfigMaps(namespace).Create(configMapWithOwner); err != nil {
+			r.Recorder.Eventf(object, v1.EventTypeWarning, FailedCreateConfigMapReason, "Error creating: %v", err)
+			return fmt.Errorf("unable to create configmap: %w", err)
+		}
+		log.Infof("Controller %v created configmap %v/%v", controllerRef.Name, namespace, configMap.Name)
+		r.Recorder.Eventf(object, v1.EventTypeNormal, SuccessfulCreateConfigMapReason, "Created configmap: %v", configMap.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if owner := metav1.GetControllerOf(existing); owner == nil || owner.UID != controllerRef.UID {
+		return fmt.Errorf("configmap %s/%s already exists and is not controlled by %s", namespace, configMap.Name, controllerRef.Name)
+	}
+	if apiequality.Semantic.DeepEqual(existing.Data, configMap.Data) {
+		return nil
+	}
+	existing = existing.DeepCopy()
+	existing.Data = configMap.Data
+	if _, err := r.KubeClient.CoreV1().ConfigMaps(namespace).Update(existing); err != nil {
+		r.Recorder.Eventf(object, v1.EventTypeWarning, FailedUpdateConfigMapReason, "Error updating: %v", err)
+		return fmt.Errorf("unable to update configmap: %w", err)
+	}
+	log.Infof("Controller %v updated configmap %v/%v", controllerRef.Name, namespace, configMap.Name)
+	r.Recorder.Eventf(object, v1.EventTypeNormal, SuccessfulUpdateConfigMapReason, "Updated configmap: %v", configMap.Name)
+	return nil
+}
+
+// DeleteConfigMap deletes the ConfigMap identified by name, if it exists.
+func (r RealConfigMapControl) DeleteConfigMap(namespace, name string, object runtime.Object) error {
+	err := r.KubeClient.CoreV1().ConfigMaps(namespace).Delete(name, nil)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		r.Recorder.Eventf(object, v1.EventTypeWarning, FailedDeleteConfigMapReason, "Error deleting: %v", err)
+		return fmt.Errorf("unable to delete configmap: %v", err)
+	}
+	r.Recorder.Eventf(object, v1.EventTypeNormal, SuccessfulDeleteConfigMapReason, "Deleted configmap: %v", name)
+	return nil
+}
+
+type FakeConfigMapControl struct {
+	sync.Mutex
+	Templates           []v1.ConfigMap
+	ControllerRefs      []metav1.OwnerReference
+	DeleteConfigMapName []string
+	Err                 error
+}
+
+var _ ConfigMapControlInterface = &FakeConfigMapControl{}
+
+// GetConfigMap returns the last ConfigMap applied with the given name, owned
+// by its controller, as if it had been created.
+func (f *FakeConfigMapControl) GetConfigMap(namespace, name string) (*v1.ConfigMap, error) {
+	f.Lock()
+	defer f.Unlock()
+	for i := len(f.Templates) - 1; i >= 0; i-- {
+		if f.Templates[i].Name == name {
+			configMap := f.Templates[i].DeepCopy()
+			configMap.OwnerReferences = []metav1.OwnerReference{f.ControllerRefs[i]}
+			return configMap, nil
+		}
+	}
+	return nil, errors.NewNotFound(v1.Resource("configmaps"), name)
+}
+
+func (f *FakeConfigMapControl) ApplyConfigMap(namespace string, configMap *v1.ConfigMap, object runtime.Object, controllerRef *metav1.OwnerReference) error {
+	f.Lock()
+	defer f.Unlock()
+	f.Templates = append(f.Templates, *configMap)
+	f.ControllerRefs = append(f.ControllerRefs, *controllerRef)
+	if f.Err != nil {
+		return f.Err
+	}
+	return nil
+}
+
+func (f *FakeConfigMapControl) DeleteConfigMap(namespace, name string, object runtime.Object) error {
+	f.Lock()
+	defer f.Unlock()
+	f.DeleteConfigMapName = append(f.DeleteConfigMapName, name)
+	if f.Err != nil {
+		return f.Err
+	}
+	return nil
+}
+
+func (f *FakeConfigMapControl) Clear() {
+	f.Lock()
+	defer f.Unlock()
+	f.Templates = []v1.ConfigMap{}
+	f.ControllerRefs = []metav1.OwnerReference{}
+	f.DeleteConfigMapName = []string{}
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	FailedCreateJobReason     = "FailedCreateJob"
+	SuccessfulCreateJobReason = "SuccessfulCreateJob"
+)
+
+// JobControlInterface is an interface that knows how to create Jobs, created
+// as an interface to allow testing.
+type JobControlInterface interface {
+	// CreateJob creates the Job with object as its controller, unless it
+	// already exists and is controlled by object.
+	CreateJob(namespace string, job *batchv1.Job, object runtime.Object, controllerRef *metav1.OwnerReference) error
+}
+
+// RealJobControl is the default implementation of JobControlInterface.
+type RealJobControl struct {
+	KubeClient clientset.Interface
+	Recorder   record.EventRecorder
+}
+
+func (r RealJobControl) CreateJob(namespace string, job *batchv1.Job, object runtime.Object, controllerRef *metav1.OwnerReference) error {
+	if err := validateControllerRef(controllerRef); err != nil {
+		return err
+	}
+	jobWithOwner := job.DeepCopy()
+	jobWithOwner.OwnerReferences = append(jobWithOwner.OwnerReferences, *controllerRef)
+	_, err := r.KubeClient.BatchV1().Jobs(namespace).Create(jobWithOwner)
+	if errors.IsAlreadyExists(err) {
+		existing, err := r.KubeClient.BatchV1().Jobs(namespace).Get(job.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if owner := metav1.GetControllerOf(existing); owner == nil || owner.UID != controllerRef.UID {
+			return fmt.Errorf("job %s/%s already exists and is not controlled by %s", namespace, job.Name, controllerRef.Name)
+		}
+		return nil
+	} else if err != nil {
+		r.Recorder.Eventf(object, v1.EventTypeWarning, FailedCreateJobReason, "Error creating: %v", err)
+		return fmt.Errorf("unable to create job: %w", err)
+	}
+	log.Infof("Controller %v created job %v/%v", controllerRef.Name, namespace, job.Name)
+	r.Recorder.Eventf(object, v1.EventTypeNormal, SuccessfulCreateJobReason, "Created job: %v", job.Name)
+	return nil
+}
+
+type FakeJobControl struct {
+	sync.Mutex
+	Templates      []batchv1.Job
+	ControllerRefs []metav1.OwnerReference
+	Err            error
+}
+
+var _ JobControlInterface = &FakeJobControl{}
+
+func (f *FakeJobControl) CreateJob(namespace string, job *batchv1.Job, object runtime.Object, controllerRef *metav1.OwnerReference) error {
+	f.Lock()
+	defer f.Unlock()
+	f.Templates = append(f.Templates, *job)
+	f.ControllerRefs = append(f.ControllerRefs, *controllerRef)
+	if f.Err != nil {
+		return f.Err
+	}
+	return nil
+}
+
+func (f *FakeJobControl) Clear() {
+	f.Lock()
+	defer f.Unlock()
+	f.Templates = []batchv1.Job{}
+	f.ControllerRefs = []metav1.OwnerReference{}
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	FailedCreatePodDisruptionBudgetReason     = "FailedCreatePodDisruptionBudget"
+	SuccessfulCreatePodDisruptionBudgetReason = "SuccessfulCreatePodDisruptionBudget"
+	FailedUpdatePodDisruptionBudgetReason     = "FailedUpdatePodDisruptionBudget"
+	SuccessfulUpdatePodDisruptionBudgetReason = "SuccessfulUpdatePodDisruptionBudget"
+	FailedDeletePodDisruptionBudgetReason     = "FailedDeletePodDisruptionBudget"
+	SuccessfulDeletePodDisruptionBudgetReason = "SuccessfulDeletePodDisruptionBudget"
+)
+
+// PodDisruptionBudgetControlInterface is an interface that knows how to apply
+// or delete PodDisruptionBudgets, created as an interface to allow testing.
+type PodDisruptionBudgetControlInterface interface {
+	// ApplyPodDisruptionBudget creates the PodDisruptionBudget with object as
+	// its controller, or updates its spec if it already exists and is
+	// controlled by object.
+	ApplyPodDisruptionBudget(namespace string, pdb *policyv1beta1.PodDisruptionBudget, object runtime.Object, controllerRef *metav1.OwnerReference) error
+	// DeletePodDisruptionBudget deletes the PodDisruptionBudget identified by name.
+	DeletePodDisruptionBudget(namespace, name string, object runtime.Object) error
+}
+
+// RealPodDisruptionBudgetControl is the default implementation of
+// PodDisruptionBudgetControlInterface.
+type RealPodDisruptionBudgetControl struct {
+	KubeClient clientset.Interface
+	Recorder   record.EventRecorder
+}
+
+func (r RealPodDisruptionBudgetControl) ApplyPodDisruptionBudget(namespace string, pdb *policyv1beta1.PodDisruptionBudget, object runtime.Object, controllerRef *metav1.OwnerReference) error {
+	if err := validateControllerRef(controllerRef); err != nil {
+		return err
+	}
+	existing, err := r.KubeClient.PolicyV1beta1().PodDisruptionBudgets(namespace).Get(pdb.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		pdbWithOwner := pdb.DeepCopy()
+		pdbWithOwner.OwnerReferences = append(pdbWithOwner.OwnerReferences, *controllerRef)
+		if _, err := r.KubeClient.PolicyV1beta1().PodDisruptionBudgets(namespace).Create(pdbWithOwner); err != nil {
+			r.Recorder.Eventf(object, v1.EventTypeWarning, FailedCreatePodDisruptionBudgetReason, "Error creating: %v", err)
+			return fmt.Errorf("unable to create poddisruptionbudget: %w", err)
+		}
+		log.Infof("Controller %v created poddisruptionbudget %v/%v", controllerRef.Name, namespace, pdb.Name)
+		r.Recorder.Eventf(object, v1.EventTypeNormal, SuccessfulCreatePodDisruptionBudgetReason, "Created poddisruptionbudget: %v", pdb.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if owner := metav1.GetControllerOf(existing); owner == nil || owner.UID != controllerRef.UID {
+		return fmt.Errorf("poddisruptionbudget %s/%s already exists and is not controlled by %s", namespace, pdb.Name, controllerRef.Name)
+	}
+	if apiequality.Semantic.DeepEqual(existing.Spec, pdb.Spec) {
+		return nil
+	}
+	existing = existing.DeepCopy()
+	existing.Spec = pdb.Spec
+	if _, err := r.KubeClient.PolicyV1beta1().PodDisruptionBudgets(namespace).Update(existing); err != nil {
+		r.Recorder.Eventf(object, v1.EventTypeWarning, FailedUpdatePodDisruptionBudgetReason, "Error updating: %v", err)
+		return fmt.Errorf("unable to update poddisruptionbudget: %w", err)
+	}
+	log.Infof("Controller %v updated poddisruptionbudget %v/%v", controllerRef.Name, namespace, pdb.Name)
+	r.Recorder.Eventf(object, v1.EventTypeNormal, SuccessfulUpdatePodDisruptionBudgetReason, "Updated poddisruptionbudget: %v", pdb.Name)
+	return nil
+}
+
+// DeletePodDisruptionBudget deletes the PodDisruptionBudget identified by
+// name, if it exists.
+func (r RealPodDisruptionBudgetControl) DeletePodDisruptionBudget(namespace, name string, object runtime.Object) error {
+	err := r.KubeClient.PolicyV1beta1().PodDisruptionBudgets(namespace).Delete(name, nil)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		r.Recorder.Eventf(object, v1.EventTypeWarning, FailedDeletePodDisruptionBudgetReason, "Error deleting: %v", err)
+		return fmt.Errorf("unable to delete poddisruptionbudget: %v", err)
+	}
+	r.Recorder.Eventf(object, v1.EventTypeNormal, SuccessfulDeletePodDisruptionBudgetReason, "Deleted poddisruptionbudget: %v", name)
+	return nil
+}
+
+type FakePodDisruptionBudgetControl struct {
+	sync.Mutex
+	Templates                     []policyv1beta1.PodDisruptionBudget
+	ControllerRefs                []metav1.OwnerReference
+	DeletePodDisruptionBudgetName []string
+	Err                           error
+}
+
+var _ PodDisruptionBudgetControlInterface = &FakePodDisruptionBudgetControl{}
+
+func (f *FakePodDisruptionBudgetControl) ApplyPodDisruptionBudget(namespace string, pdb *policyv1beta1.PodDisruptionBudget, object runtime.Object, controllerRef *metav1.OwnerReference) error {
+	f.Lock()
+	defer f.Unlock()
+	f.Templates = append(f.Templates, *pdb)
+	f.ControllerRefs = append(f.ControllerRefs, *controllerRef)
+	if f.Err != nil {
+		return f.Err
+	}
+	return nil
+}
+
+func (f *FakePodDisruptionBudgetControl) DeletePodDisruptionBudget(namespace, name string, object runtime.Object) error {
+	f.Lock()
+	defer f.Unlock()
+	f.DeletePodDisruptionBudgetName = append(f.DeletePodDisruptionBudgetName, name)
+	if f.Err != nil {
+		return f.Err
+	}
+	return nil
+}
+
+func (f *FakePodDisruptionBudgetControl) Clear() {
+	f.Lock()
+	defer f.Unlock()
+	f.Templates = []policyv1beta1.PodDisruptionBudget{}
+	f.ControllerRefs = []metav1.OwnerReference{}
+	f.DeletePodDisruptionBudgetName = []string{}
+}
@@ -0,0 +1,89 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"fmt"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+// PodForceDeleteControlInterface is an interface that knows how to force
+// delete pods, created as an interface to allow testing.
+type PodForceDeleteControlInterface interface {
+	// ForceDeletePod deletes the pod identified by name and uid without
+	// waiting for the kubelet to confirm that its containers stopped.
+	ForceDeletePod(namespace, name string, uid types.UID, object runtime.Object) error
+}
+
+// RealPodForceDeleteControl is the default implementation of
+// PodForceDeleteControlInterface.
+type RealPodForceDeleteControl struct {
+	KubeClient clientset.Interface
+	Recorder   record.EventRecorder
+}
+
+// ForceDeletePod deletes the pod with a grace period of 0. The uid is a
+// precondition of the deletion, so that a pod recreated with the same name
+// in the meantime is not deleted.
+func (r RealPodForceDeleteControl) ForceDeletePod(namespace, name string, uid types.UID, object runtime.Object) error {
+	gracePeriod := int64(0)
+	err := r.KubeClient.CoreV1().Pods(namespace).Delete(name, &metav1.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+		Preconditions:      &metav1.Preconditions{UID: &uid},
+	})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		r.Recorder.Eventf(object, v1.EventTypeWarning, FailedDeletePodReason, "Error force deleting: %v", err)
+		return fmt.Errorf("unable to force delete pod: %v", err)
+	}
+	r.Recorder.Eventf(object, v1.EventTypeNormal, SuccessfulDeletePodReason, "Force deleted pod: %v", name)
+	return nil
+}
+
+type FakePodForceDeleteControl struct {
+	sync.Mutex
+	DeletePodName []string
+	DeletePodUID  []types.UID
+	Err           error
+}
+
+var _ PodForceDeleteControlInterface = &FakePodForceDeleteControl{}
+
+func (f *FakePodForceDeleteControl) ForceDeletePod(namespace, name string, uid types.UID, object runtime.Object) error {
+	f.Lock()
+	defer f.Unlock()
+	f.DeletePodName = append(f.DeletePodName, name)
+	f.DeletePodUID = append(f.DeletePodUID, uid)
+	if f.Err != nil {
+		return f.Err
+	}
+	return nil
+}
+
+func (f *FakePodForceDeleteControl) Clear() {
+	f.Lock()
+	defer f.Unlock()
+	f.DeletePodName = []string{}
+	f.DeletePodUID = []types.UID{}
+}
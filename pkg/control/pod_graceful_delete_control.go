@@ -0,0 +1,90 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"fmt"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+// PodGracefulDeleteControlInterface is an interface that knows how to delete
+// pods with a given grace period, created as an interface to allow testing.
+type PodGracefulDeleteControlInterface interface {
+	// DeletePodWithGracePeriod deletes the pod identified by name and uid,
+	// giving its containers gracePeriodSeconds to stop after SIGTERM.
+	DeletePodWithGracePeriod(namespace, name string, uid types.UID, gracePeriodSeconds int64, object runtime.Object) error
+}
+
+// RealPodGracefulDeleteControl is the default implementation of
+// PodGracefulDeleteControlInterface.
+type RealPodGracefulDeleteControl struct {
+	KubeClient clientset.Interface
+	Recorder   record.EventRecorder
+}
+
+// DeletePodWithGracePeriod passes the grace period in the DeleteOptions, so
+// that it applies whatever the grace period of the pod spec. The uid is a
+// precondition of the deletion, so that a pod recreated with the same name
+// in the meantime is not deleted.
+func (r RealPodGracefulDeleteControl) DeletePodWithGracePeriod(namespace, name string, uid types.UID, gracePeriodSeconds int64, object runtime.Object) error {
+	err := r.KubeClient.CoreV1().Pods(namespace).Delete(name, &metav1.DeleteOptions{
+		GracePeriodSeconds: &gracePeriodSeconds,
+		Preconditions:      &metav1.Preconditions{UID: &uid},
+	})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		r.Recorder.Eventf(object, v1.EventTypeWarning, FailedDeletePodReason, "Error deleting: %v", err)
+		return fmt.Errorf("unable to delete pod: %v", err)
+	}
+	r.Recorder.Eventf(object, v1.EventTypeNormal, SuccessfulDeletePodReason, "Deleted pod: %v with a grace period of %ds",
+		name, gracePeriodSeconds)
+	return nil
+}
+
+type FakePodGracefulDeleteControl struct {
+	sync.Mutex
+	DeletePodName      []string
+	GracePeriodSeconds []int64
+	Err                error
+}
+
+var _ PodGracefulDeleteControlInterface = &FakePodGracefulDeleteControl{}
+
+func (f *FakePodGracefulDeleteControl) DeletePodWithGracePeriod(namespace, name string, uid types.UID, gracePeriodSeconds int64, object runtime.Object) error {
+	f.Lock()
+	defer f.Unlock()
+	f.DeletePodName = append(f.DeletePodName, name)
+	f.GracePeriodSeconds = append(f.GracePeriodSeconds, gracePeriodSeconds)
+	if f.Err != nil {
+		return f.Err
+	}
+	return nil
+}
+
+func (f *FakePodGracefulDeleteControl) Clear() {
+	f.Lock()
+	defer f.Unlock()
+	f.DeletePodName = []string{}
+	f.GracePeriodSeconds = []int64{}
+}
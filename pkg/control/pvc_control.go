@@ -0,0 +1,129 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	FailedCreatePVCReason     = "FailedCreatePersistentVolumeClaim"
+	SuccessfulCreatePVCReason = "SuccessfulCreatePersistentVolumeClaim"
+	FailedDeletePVCReason     = "FailedDeletePersistentVolumeClaim"
+	SuccessfulDeletePVCReason = "SuccessfulDeletePersistentVolumeClaim"
+)
+
+// PVCControlInterface is an interface that knows how to create or delete
+// PersistentVolumeClaims, created as an interface to allow testing.
+type PVCControlInterface interface {
+	// CreatePVC creates the PersistentVolumeClaim with object as its
+	// controller, unless it already exists and is controlled by object.
+	CreatePVC(namespace string, pvc *v1.PersistentVolumeClaim, object runtime.Object, controllerRef *metav1.OwnerReference) error
+	// DeletePVC deletes the PersistentVolumeClaim identified by name.
+	DeletePVC(namespace, name string, object runtime.Object) error
+}
+
+// RealPVCControl is the default implementation of PVCControlInterface.
+type RealPVCControl struct {
+	KubeClient clientset.Interface
+	Recorder   record.EventRecorder
+}
+
+func (r RealPVCControl) CreatePVC(namespace string, pvc *v1.PersistentVolumeClaim, object runtime.Object, controllerRef *metav1.OwnerReference) error {
+	if err := validateControllerRef(controllerRef); err != nil {
+		return err
+	}
+	pvcWithOwner := pvc.DeepCopy()
+	pvcWithOwner.OwnerReferences = append(pvcWithOwner.OwnerReferences, *controllerRef)
+	_, err := r.KubeClient.CoreV1().PersistentVolumeClaims(namespace).Create(pvcWithOwner)
+	if errors.IsAlreadyExists(err) {
+		existing, err := r.KubeClient.CoreV1().PersistentVolumeClaims(namespace).Get(pvc.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if owner := metav1.GetControllerOf(existing); owner == nil || owner.UID != controllerRef.UID {
+			return fmt.Errorf("persistentvolumeclaim %s/%s already exists and is not controlled by %s", namespace, pvc.Name, controllerRef.Name)
+		}
+		return nil
+	} else if err != nil {
+		r.Recorder.Eventf(object, v1.EventTypeWarning, FailedCreatePVCReason, "Error creating: %v", err)
+		return fmt.Errorf("unable to create persistentvolumeclaim: %w", err)
+	}
+	log.Infof("Controller %v created persistentvolumeclaim %v/%v", controllerRef.Name, namespace, pvc.Name)
+	r.Recorder.Eventf(object, v1.EventTypeNormal, SuccessfulCreatePVCReason, "Created persistentvolumeclaim: %v", pvc.Name)
+	return nil
+}
+
+// DeletePVC deletes the PersistentVolumeClaim identified by name, if it
+// exists.
+func (r RealPVCControl) DeletePVC(namespace, name string, object runtime.Object) error {
+	err := r.KubeClient.CoreV1().PersistentVolumeClaims(namespace).Delete(name, nil)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		r.Recorder.Eventf(object, v1.EventTypeWarning, FailedDeletePVCReason, "Error deleting: %v", err)
+		return fmt.Errorf("unable to delete persistentvolumeclaim: %v", err)
+	}
+	r.Recorder.Eventf(object, v1.EventTypeNormal, SuccessfulDeletePVCReason, "Deleted persistentvolumeclaim: %v", name)
+	return nil
+}
+
+type FakePVCControl struct {
+	sync.Mutex
+	Templates      []v1.PersistentVolumeClaim
+	ControllerRefs []metav1.OwnerReference
+	DeletePVCName  []string
+	Err            error
+}
+
+var _ PVCControlInterface = &FakePVCControl{}
+
+func (f *FakePVCControl) CreatePVC(namespace string, pvc *v1.PersistentVolumeClaim, object runtime.Object, controllerRef *metav1.OwnerReference) error {
+	f.Lock()
+	defer f.Unlock()
+	f.Templates = append(f.Templates, *pvc)
+	f.ControllerRefs = append(f.ControllerRefs, *controllerRef)
+	if f.Err != nil {
+		return f.Err
+	}
+	return nil
+}
+
+func (f *FakePVCControl) DeletePVC(namespace, name string, object runtime.Object) error {
+	f.Lock()
+	defer f.Unlock()
+	f.DeletePVCName = append(f.DeletePVCName, name)
+	if f.Err != nil {
+		return f.Err
+	}
+	return nil
+}
+
+func (f *FakePVCControl) Clear() {
+	f.Lock()
+	defer f.Unlock()
+	f.Templates = []v1.PersistentVolumeClaim{}
+	f.ControllerRefs = []metav1.OwnerReference{}
+	f.DeletePVCName = []string{}
+}
@@ -0,0 +1,204 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+// auditKey is the key of the audit trail in the audit ConfigMap.
+const auditKey = "audit.log"
+
+// auditTrail is the audit trail of a tfjob. The entries of a sync are
+// pending until they are written together at its end.
+type auditTrail struct {
+	uid types.UID
+	// loaded is true once the entries written before the operator started
+	// have been read from the ConfigMap.
+	loaded  bool
+	entries []string
+	pending []string
+	// podGroupUID is the UID of the PodGroup of the tfjob last observed,
+	// so that it is only recorded when it changes.
+	podGroupUID types.UID
+}
+
+// auditEnabled returns true if the actions of the controller on the tfjob
+// are recorded in its audit ConfigMap.
+func (tc *TFController) auditEnabled(tfjob *tfv1.TFJob) bool {
+	return tc.auditMaxEntries > 0 && tfjob.Annotations[tfv1.AnnotationAudit] == "true"
+}
+
+// genAuditConfigMapName returns the name of the audit ConfigMap of the tfjob.
+func genAuditConfigMapName(tfjob *tfv1.TFJob) string {
+	return tfjob.Name + "-audit"
+}
+
+// getAuditTrail returns the audit trail of the tfjob, creating it if needed.
+// The caller must hold auditLock.
+func (tc *TFController) getAuditTrail(key string, tfjob *tfv1.TFJob) *auditTrail {
+	trail, ok := tc.auditTrails[key]
+	if !ok || trail.uid != tfjob.UID {
+		// The tfjob was recreated with the same name.
+		trail = &auditTrail{uid: tfjob.UID}
+		tc.auditTrails[key] = trail
+	}
+	return trail
+}
+
+// audit records an action of the controller on the tfjob, if it is audited.
+// The entry is written at the end of the sync.
+func (tc *TFController) audit(tfjob *tfv1.TFJob, format string, args ...interface{}) {
+	if !tc.auditEnabled(tfjob) {
+		return
+	}
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return
+	}
+	entry := tc.clock.Now().UTC().Format(time.RFC3339) + " " + fmt.Sprintf(format, args...)
+	tc.auditLock.Lock()
+	defer tc.auditLock.Unlock()
+	trail := tc.getAuditTrail(key, tfjob)
+	trail.pending = append(trail.pending, entry)
+	if len(trail.pending) > tc.auditMaxEntries {
+		// The entries which cannot be written are bounded as well.
+		trail.pending = trail.pending[len(trail.pending)-tc.auditMaxEntries:]
+	}
+}
+
+// auditPodGroup records the PodGroup of the tfjob when it differs from the
+// one last observed, e.g. when it is created or recreated.
+func (tc *TFController) auditPodGroup(tfjob *tfv1.TFJob, uid types.UID, minMember int32) {
+	if !tc.auditEnabled(tfjob) {
+		return
+	}
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return
+	}
+	tc.auditLock.Lock()
+	trail := tc.getAuditTrail(key, tfjob)
+	changed := trail.podGroupUID != uid
+	trail.podGroupUID = uid
+	tc.auditLock.Unlock()
+	if changed {
+		tc.audit(tfjob, "sync podgroup %s minMember=%d", tfjob.Name, minMember)
+	}
+}
+
+// auditPodGroupDeleted records the deletion of the PodGroup of the tfjob, if
+// it was observed.
+func (tc *TFController) auditPodGroupDeleted(tfjob *tfv1.TFJob) {
+	if !tc.auditEnabled(tfjob) {
+		return
+	}
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return
+	}
+	tc.auditLock.Lock()
+	trail := tc.getAuditTrail(key, tfjob)
+	observed := trail.podGroupUID != ""
+	trail.podGroupUID = ""
+	tc.auditLock.Unlock()
+	if observed {
+		tc.audit(tfjob, "delete podgroup %s", tfjob.Name)
+	}
+}
+
+// flushAudit writes the entries recorded during the sync of the tfjob to its
+// audit ConfigMap at once, owned by the tfjob. The ConfigMap is a ring
+// buffer: the oldest entries are dropped beyond the maximum number of
+// entries. The entries are kept pending if they cannot be written, and
+// written along with the ones of the next sync.
+func (tc *TFController) flushAudit(tfjob *tfv1.TFJob) {
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return
+	}
+	tc.auditLock.Lock()
+	defer tc.auditLock.Unlock()
+	trail, ok := tc.auditTrails[key]
+	if !ok || trail.uid != tfjob.UID || len(trail.pending) == 0 {
+		return
+	}
+	logger := tflogger.LoggerForJob(tfjob)
+	name := genAuditConfigMapName(tfjob)
+	if !trail.loaded {
+		entries, err := tc.loadAuditEntries(tfjob, name)
+		if err != nil {
+			logger.Warnf("Failed to read the audit configmap %s: %v", name, err)
+			return
+		}
+		trail.entries = entries
+		trail.loaded = true
+	}
+
+	entries := append(append([]string{}, trail.entries...), trail.pending...)
+	if len(entries) > tc.auditMaxEntries {
+		entries = entries[len(entries)-tc.auditMaxEntries:]
+	}
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: tfjob.Namespace,
+			Labels:    tc.genLabels(tfjob),
+		},
+		Data: map[string]string{auditKey: strings.Join(entries, "\n") + "\n"},
+	}
+	if err := tc.ConfigMapControl.ApplyConfigMap(tfjob.Namespace, configMap, tfjob, tc.GenOwnerReference(tfjob)); err != nil {
+		logger.Warnf("Failed to write the audit configmap %s: %v", name, err)
+		return
+	}
+	trail.entries = entries
+	trail.pending = nil
+}
+
+// loadAuditEntries returns the entries of the audit ConfigMap of the tfjob,
+// or none if it does not exist or is not controlled by the tfjob.
+func (tc *TFController) loadAuditEntries(tfjob *tfv1.TFJob, name string) ([]string, error) {
+	configMap, err := tc.ConfigMapControl.GetConfigMap(tfjob.Namespace, name)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if owner := metav1.GetControllerOf(configMap); owner == nil || owner.UID != tfjob.UID {
+		return nil, nil
+	}
+	data := strings.TrimSuffix(configMap.Data[auditKey], "\n")
+	if data == "" {
+		return nil, nil
+	}
+	return strings.Split(data, "\n"), nil
+}
+
+// forgetAudit forgets the audit trail of the tfjob.
+func (tc *TFController) forgetAudit(key string) {
+	tc.auditLock.Lock()
+	defer tc.auditLock.Unlock()
+	delete(tc.auditTrails, key)
+}
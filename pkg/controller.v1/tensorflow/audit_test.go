@@ -0,0 +1,190 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/kubernetes/pkg/controller"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
+)
+
+// newAuditTestController returns a controller keeping up to maxEntries in
+// the audit ConfigMaps of the audited tfjobs, listing the services of the
+// returned indexer.
+func newAuditTestController(maxEntries int) (*TFController, *controller.FakePodControl, *control.FakeConfigMapControl, cache.Indexer) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	serviceIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	ctr.ServiceLister = corelisters.NewServiceLister(serviceIndexer)
+	ctr.clock = clock.NewFakeClock(time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC))
+	fakeConfigMapControl := &control.FakeConfigMapControl{}
+	ctr.ConfigMapControl = fakeConfigMapControl
+	ctr.auditMaxEntries = maxEntries
+	// The status written is observed by the next sync.
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			return err
+		}
+		return ctr.tfJobInformer.GetIndexer().Update(unstructured)
+	}
+	return ctr, fakePodControl, fakeConfigMapControl, serviceIndexer
+}
+
+func newAuditedTFJob() *tfv1.TFJob {
+	tfJob := testutil.NewTFJob(1, 0)
+	tfJob.UID = types.UID("audited")
+	tfJob.Annotations = map[string]string{tfv1.AnnotationAudit: "true"}
+	return tfJob
+}
+
+// auditEntries returns the entries of the audit ConfigMaps applied, without
+// their timestamp.
+func auditEntries(fakeConfigMapControl *control.FakeConfigMapControl, tfJob *tfv1.TFJob) [][]string {
+	var applied [][]string
+	for _, configMap := range fakeConfigMapControl.Templates {
+		if configMap.Name != genAuditConfigMapName(tfJob) {
+			continue
+		}
+		var entries []string
+		for _, line := range strings.Split(strings.TrimSuffix(configMap.Data[auditKey], "\n"), "\n") {
+			entries = append(entries, strings.SplitN(line, " ", 2)[1])
+		}
+		applied = append(applied, entries)
+	}
+	return applied
+}
+
+func TestAuditLifecycle(t *testing.T) {
+	ctr, fakePodControl, fakeConfigMapControl, serviceIndexer := newAuditTestController(100)
+	tfJob := newAuditedTFJob()
+	unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Fatalf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+		t.Fatalf("Failed to add the tfjob: %v", err)
+	}
+	key := testutil.GetKey(tfJob, t)
+
+	// The actions of a sync are written at once.
+	if _, err := ctr.syncTFJob(key); err != nil {
+		t.Fatalf("Unexpected error when syncing the tfjob: %v", err)
+	}
+	applied := auditEntries(fakeConfigMapControl, tfJob)
+	if len(applied) != 1 {
+		t.Fatalf("Expected the audit ConfigMap to be applied once, got %d", len(applied))
+	}
+	if len(fakePodControl.Templates) != 1 {
+		t.Fatalf("Expected a pod to be created, got %d", len(fakePodControl.Templates))
+	}
+	podName := fakePodControl.Templates[0].Name
+	expected := []string{
+		fmt.Sprintf("create pod %s", podName),
+		fmt.Sprintf("create service %s", podName),
+		fmt.Sprintf("TFJob %s status changed", tfJob.Name),
+	}
+	if strings.Join(applied[0], "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the entries %q, got %q", expected, applied[0])
+	}
+	if ref := fakeConfigMapControl.ControllerRefs[0]; ref.UID != tfJob.UID {
+		t.Errorf("Expected the audit ConfigMap to be owned by the tfjob, got %v", ref)
+	}
+
+	// The entries of the next actions are appended.
+	ctr.deleteExpectations(key)
+	testutil.SetPodsStatuses(ctr.podIndexer, tfJob, testutil.LabelWorker, 0, 1, 0, 0, nil, t)
+	testutil.SetServices(serviceIndexer, tfJob, testutil.LabelWorker, 1, t)
+	if _, err := ctr.syncTFJob(key); err != nil {
+		t.Fatalf("Unexpected error when syncing the tfjob: %v", err)
+	}
+	applied = auditEntries(fakeConfigMapControl, tfJob)
+	if len(applied) != 2 {
+		t.Fatalf("Expected the audit ConfigMap to be applied twice, got %d", len(applied))
+	}
+	expected = append(expected, fmt.Sprintf("TFJob %s status changed: Running=True", tfJob.Name))
+	if strings.Join(applied[1], "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the entries %q, got %q", expected, applied[1])
+	}
+
+	// Nothing is written by the syncs which do nothing.
+	if _, err := ctr.syncTFJob(key); err != nil {
+		t.Fatalf("Unexpected error when syncing the tfjob: %v", err)
+	}
+	if applied := auditEntries(fakeConfigMapControl, tfJob); len(applied) != 2 {
+		t.Errorf("Expected the audit ConfigMap not to be applied again, got %q", applied)
+	}
+}
+
+func TestAuditRingBuffer(t *testing.T) {
+	ctr, _, fakeConfigMapControl, _ := newAuditTestController(3)
+	tfJob := newAuditedTFJob()
+	lastEntries := func() []string {
+		applied := auditEntries(fakeConfigMapControl, tfJob)
+		if len(applied) == 0 {
+			return nil
+		}
+		return applied[len(applied)-1]
+	}
+
+	// The oldest entries are dropped beyond the cap.
+	for i := 0; i < 2; i++ {
+		ctr.audit(tfJob, "action %d", i)
+	}
+	ctr.flushAudit(tfJob)
+	for i := 2; i < 4; i++ {
+		ctr.audit(tfJob, "action %d", i)
+	}
+	ctr.flushAudit(tfJob)
+	if expected, actual := "action 1,action 2,action 3", strings.Join(lastEntries(), ","); actual != expected {
+		t.Errorf("Expected the entries %s, got %s", expected, actual)
+	}
+
+	// The entries written before are read back once the trail is forgotten,
+	// e.g. when the operator restarts.
+	ctr.forgetAudit(testutil.GetKey(tfJob, t))
+	ctr.audit(tfJob, "action 4")
+	ctr.flushAudit(tfJob)
+	if expected, actual := "action 2,action 3,action 4", strings.Join(lastEntries(), ","); actual != expected {
+		t.Errorf("Expected the entries %s, got %s", expected, actual)
+	}
+
+	// The entries of a previous tfjob with the same name are not kept.
+	tfJob.UID = types.UID("recreated")
+	ctr.audit(tfJob, "action 5")
+	ctr.flushAudit(tfJob)
+	if expected, actual := "action 5", strings.Join(lastEntries(), ","); actual != expected {
+		t.Errorf("Expected the entries %s, got %s", expected, actual)
+	}
+
+	// The tfjobs which are not annotated are not audited.
+	fakeConfigMapControl.Clear()
+	delete(tfJob.Annotations, tfv1.AnnotationAudit)
+	ctr.audit(tfJob, "action 6")
+	ctr.flushAudit(tfJob)
+	if len(fakeConfigMapControl.Templates) != 0 {
+		t.Errorf("Expected no audit ConfigMap, got %v", fakeConfigMapControl.Templates)
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// isBestEffort returns true if the failures of the replicas of the given type
+// do not affect the outcome of the tfjob.
+func isBestEffort(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType) bool {
+	for _, bestEffort := range tfjob.Spec.BestEffortReplicaTypes {
+		if bestEffort == rtype {
+			return true
+		}
+	}
+	return false
+}
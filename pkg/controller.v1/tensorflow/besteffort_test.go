@@ -0,0 +1,87 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func TestBestEffortReplicas(t *testing.T) {
+	const profiler = tfv1.TFReplicaType("Profiler")
+	testCases := []struct {
+		description       string
+		restartPolicy     common.RestartPolicy
+		succeededWorkers  int32
+		failedProfilers   int32
+		restartedProfiler int32
+		expectedCondition common.JobConditionType
+	}{
+		{"The workers run while the profiler crashed", common.RestartPolicyNever, 0, 1, 0, common.JobRunning},
+		{"The workers succeed while the profiler crashed", common.RestartPolicyNever, 2, 1, 0, common.JobSucceeded},
+		{"The profiler is restarted past the backoff limit", common.RestartPolicyOnFailure, 0, 0, 3, common.JobRunning},
+	}
+
+	for _, tc := range testCases {
+		ctr, _, _ := newErrorsTestController()
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			return nil
+		}
+		tfJob := testutil.NewTFJob(2, 0)
+		// A single failure of the other replicas would fail the tfjob.
+		backoffLimit := int32(1)
+		tfJob.Spec.BackoffLimit = &backoffLimit
+		replicas := int32(1)
+		tfJob.Spec.TFReplicaSpecs[profiler] = &common.ReplicaSpec{
+			Replicas:      &replicas,
+			Template:      testutil.NewTFReplicaSpecTemplate(),
+			RestartPolicy: tc.restartPolicy,
+		}
+		tfJob.Spec.BestEffortReplicaTypes = []tfv1.TFReplicaType{profiler}
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			t.Fatalf("Failed to convert the TFJob to Unstructured: %v", err)
+		}
+		if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+			t.Fatalf("Failed to add tfjob to tfJobIndexer: %v", err)
+		}
+
+		testutil.SetPodsStatuses(ctr.podIndexer, tfJob, testutil.LabelWorker, 0, 2-tc.succeededWorkers, tc.succeededWorkers, 0, nil, t)
+		var restartCounts []int32
+		if tc.failedProfilers == 0 {
+			restartCounts = []int32{tc.restartedProfiler}
+		}
+		testutil.SetPodsStatuses(ctr.podIndexer, tfJob, "profiler", 0, 1-tc.failedProfilers, 0, tc.failedProfilers, restartCounts, t)
+
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", tc.description, err)
+		}
+		if !hasCondition(tfJob.Status.JobStatus, tc.expectedCondition) {
+			t.Errorf("%s: expected the condition %s, got %v", tc.description, tc.expectedCondition, tfJob.Status.Conditions)
+		}
+		for _, condType := range []common.JobConditionType{common.JobFailed, common.JobRestarting} {
+			if hasCondition(tfJob.Status.JobStatus, condType) {
+				t.Errorf("%s: expected no %s condition, got %v", tc.description, condType, tfJob.Status.Conditions)
+			}
+		}
+		// The failures are still reported.
+		if status := tfJob.Status.ReplicaStatuses[common.ReplicaType(profiler)]; status == nil || status.Failed != tc.failedProfilers {
+			t.Errorf("%s: expected %d failed profiler replicas, got %v", tc.description, tc.failedProfilers, status)
+		}
+	}
+}
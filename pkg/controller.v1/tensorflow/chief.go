@@ -0,0 +1,74 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/apis/tensorflow/validation"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+// duplicateChiefReason is the warning reason when a tfjob which already
+// started defines both Chief and Master replicas.
+const duplicateChiefReason = "DuplicateChief"
+
+// invalidChiefAndMaster returns a message if the tfjob defines both Chief and
+// Master replicas and has not started yet, or an empty string otherwise. The
+// tfjobs which started with both, e.g. before the operator was upgraded, keep
+// running with a warning event, as failing them would delete their pods.
+func (tc *TFController) invalidChiefAndMaster(tfjob *tfv1.TFJob) string {
+	err := validation.ValidateV1ChiefAndMaster(&tfjob.Spec)
+	if err == nil {
+		return ""
+	}
+	msg := fmt.Sprintf("TFJob %s cannot run both Chief and Master pods, as both claim the coordinator role in TF_CONFIG: %v", tfjob.Name, err)
+	if tfjob.Status.StartTime == nil {
+		return msg
+	}
+	tflogger.LoggerForJob(tfjob).Warn(msg)
+	tc.Recorder.Eventf(tfjob, v1.EventTypeWarning, duplicateChiefReason,
+		"%s. It keeps running since it started before both were rejected.", msg)
+	return ""
+}
+
+// foldMasterReplicaStatus counts the Master replicas of a tfjob which defines
+// both Chief and Master in the replica status of the Chief, so that the
+// status has a single coordinator.
+func foldMasterReplicaStatus(tfjob *tfv1.TFJob) {
+	if validation.ValidateV1ChiefAndMaster(&tfjob.Spec) == nil {
+		return
+	}
+	master, ok := tfjob.Status.ReplicaStatuses[common.ReplicaType(tfv1.TFReplicaTypeMaster)]
+	if !ok {
+		return
+	}
+	delete(tfjob.Status.ReplicaStatuses, common.ReplicaType(tfv1.TFReplicaTypeMaster))
+	chief, ok := tfjob.Status.ReplicaStatuses[common.ReplicaType(tfv1.TFReplicaTypeChief)]
+	if !ok || chief == nil {
+		tfjob.Status.ReplicaStatuses[common.ReplicaType(tfv1.TFReplicaTypeChief)] = master
+		return
+	}
+	if master == nil {
+		return
+	}
+	chief.Active += master.Active
+	chief.Succeeded += master.Succeeded
+	chief.Failed += master.Failed
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+// newTFJobWithChiefAndMaster returns a tfjob which defines both Chief and
+// Master replicas.
+func newTFJobWithChiefAndMaster() *tfv1.TFJob {
+	tfJob := testutil.NewTFJobWithChief(1, 0)
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeMaster] = &common.ReplicaSpec{
+		Template: testutil.NewTFReplicaSpecTemplate(),
+	}
+	scheme.Scheme.Default(tfJob)
+	return tfJob
+}
+
+func TestChiefAndMaster(t *testing.T) {
+	type testCase struct {
+		description    string
+		started        bool
+		expectedPods   int
+		expectedFailed bool
+		expectedEvents int
+	}
+	testCases := []testCase{
+		{"A new tfjob with both fails before creating its pods", false, 0, true, 0},
+		{"A tfjob which already started with both keeps running", true, 3, false, 1},
+	}
+	for _, c := range testCases {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		recorder := record.NewFakeRecorder(10)
+		ctr.Recorder = recorder
+		var actual *tfv1.TFJob
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			actual = tfJob
+			return nil
+		}
+		tfJob := newTFJobWithChiefAndMaster()
+		if c.started {
+			now := metav1.Now()
+			tfJob.Status.StartTime = &now
+		}
+
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", c.description, err)
+		}
+		if len(fakePodControl.Templates) != c.expectedPods {
+			t.Errorf("%s: expected %d pods, got %d", c.description, c.expectedPods, len(fakePodControl.Templates))
+		}
+		if actual == nil {
+			t.Fatalf("%s: expected the status to be updated", c.description)
+		}
+		if failed := testutil.CheckCondition(actual, common.JobFailed, tfJobInvalidSpecReason); failed != c.expectedFailed {
+			t.Errorf("%s: expected the tfjob failed %v, got %v", c.description, c.expectedFailed, failed)
+		}
+		if failed := isFailed(actual.Status.JobStatus); failed && !strings.Contains(actual.Status.Conditions[len(actual.Status.Conditions)-1].Message, "remove Master") {
+			t.Errorf("%s: expected the condition to explain to remove Master, got %v", c.description, actual.Status.Conditions)
+		}
+		if events := countEvents(recorder, duplicateChiefReason); events != c.expectedEvents {
+			t.Errorf("%s: expected %d events, got %d", c.description, c.expectedEvents, events)
+		}
+		if _, ok := actual.Status.ReplicaStatuses[common.ReplicaType(tfv1.TFReplicaTypeMaster)]; ok {
+			t.Errorf("%s: expected no Master replica status, got %v", c.description, actual.Status.ReplicaStatuses)
+		}
+	}
+}
+
+func TestFoldMasterReplicaStatus(t *testing.T) {
+	tfJob := newTFJobWithChiefAndMaster()
+	tfJob.Status.ReplicaStatuses = map[common.ReplicaType]*common.ReplicaStatus{
+		common.ReplicaType(tfv1.TFReplicaTypeChief):  {Active: 1},
+		common.ReplicaType(tfv1.TFReplicaTypeMaster): {Active: 1, Failed: 1},
+		common.ReplicaType(tfv1.TFReplicaTypeWorker): {Active: 1},
+	}
+	foldMasterReplicaStatus(tfJob)
+	chief := tfJob.Status.ReplicaStatuses[common.ReplicaType(tfv1.TFReplicaTypeChief)]
+	if chief.Active != 2 || chief.Failed != 1 || len(tfJob.Status.ReplicaStatuses) != 2 {
+		t.Errorf("Expected the Master replicas to be counted in the Chief status, got %v", tfJob.Status.ReplicaStatuses)
+	}
+
+	// The Master of a tfjob without Chief keeps its own status.
+	tfJob = testutil.NewTFJob(1, 0)
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeMaster] = &common.ReplicaSpec{
+		Template: testutil.NewTFReplicaSpecTemplate(),
+	}
+	tfJob.Status.ReplicaStatuses = map[common.ReplicaType]*common.ReplicaStatus{
+		common.ReplicaType(tfv1.TFReplicaTypeMaster): {Active: 1},
+	}
+	foldMasterReplicaStatus(tfJob)
+	if _, ok := tfJob.Status.ReplicaStatuses[common.ReplicaType(tfv1.TFReplicaTypeMaster)]; !ok {
+		t.Errorf("Expected the Master replica status to be kept, got %v", tfJob.Status.ReplicaStatuses)
+	}
+}
+
+func TestLeaderReplicaType(t *testing.T) {
+	type testCase struct {
+		description    string
+		tfJob          *tfv1.TFJob
+		expectedLeader tfv1.TFReplicaType
+	}
+	testCases := []testCase{
+		{"The Master is preferred over the Chief", newTFJobWithChiefAndMaster(), tfv1.TFReplicaTypeMaster},
+		{"The Chief is preferred over the workers", testutil.NewTFJobWithChief(1, 0), tfv1.TFReplicaTypeChief},
+		{"The workers lead without Chief or Master", testutil.NewTFJob(2, 1), tfv1.TFReplicaTypeWorker},
+		{"A tfjob with PS only has no leader", testutil.NewTFJob(0, 1), ""},
+	}
+	for _, c := range testCases {
+		if leader := leaderReplicaType(c.tfJob); leader != c.expectedLeader {
+			t.Errorf("%s: expected the leader %q, got %q", c.description, c.expectedLeader, leader)
+		}
+	}
+}
+
+func TestChiefAndMasterCompletion(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	for _, rtype := range []tfv1.TFReplicaType{tfv1.TFReplicaTypeChief, tfv1.TFReplicaTypeMaster} {
+		tfJob := newTFJobWithChiefAndMaster()
+		now := metav1.Now()
+		tfJob.Status.StartTime = &now
+		initializeTFReplicaStatuses(tfJob, rtype)
+		tfJob.Status.ReplicaStatuses[common.ReplicaType(rtype)].Succeeded = 1
+
+		if err := ctr.updateStatusSingle(tfJob, rtype, 1, false, false); err != nil {
+			t.Fatalf("Unexpected error when updating the status of the %s replicas: %v", rtype, err)
+		}
+		// Only the Master completes a tfjob which defines both.
+		expected := rtype == tfv1.TFReplicaTypeMaster
+		if succeeded := isSucceeded(tfJob.Status.JobStatus); succeeded != expected {
+			t.Errorf("Expected the tfjob succeeded %v once the %s replicas completed, got %v", expected, rtype, succeeded)
+		}
+	}
+}
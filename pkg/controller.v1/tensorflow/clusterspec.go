@@ -0,0 +1,149 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"encoding/json"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+// tfConfigKey is the key of the shared part of TF_CONFIG in the cluster spec
+// ConfigMap.
+const tfConfigKey = "tf_config.json"
+
+// clusterSpecViaConfigMap returns true if the cluster spec of the tfjob is
+// passed to its pods via a ConfigMap.
+func clusterSpecViaConfigMap(tfjob *tfv1.TFJob) bool {
+	return tfjob.Spec.ClusterSpecVia != nil && *tfjob.Spec.ClusterSpecVia == tfv1.ClusterSpecViaConfigMap
+}
+
+// genClusterSpecConfigMapName returns the name of the cluster spec ConfigMap
+// of the tfjob.
+func genClusterSpecConfigMapName(tfjob *tfv1.TFJob) string {
+	return tfjob.Name + "-cluster-spec"
+}
+
+// newClusterSpecConfigMap returns the ConfigMap holding the part of TF_CONFIG
+// shared by the pods of the tfjob, i.e. its cluster spec.
+func (tc *TFController) newClusterSpecConfigMap(tfjob *tfv1.TFJob) (*v1.ConfigMap, error) {
+	cluster, err := genClusterSpec(tfjob, tc.nameTemplate)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(map[string]ClusterSpec{"cluster": cluster})
+	if err != nil {
+		return nil, err
+	}
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      genClusterSpecConfigMapName(tfjob),
+			Namespace: tfjob.Namespace,
+			Labels:    tc.genLabels(tfjob),
+		},
+		Data: map[string]string{tfConfigKey: string(data)},
+	}, nil
+}
+
+// syncClusterSpecConfigMap creates the cluster spec ConfigMap of the tfjob if
+// it does not exist, and updates it to follow the changes of the replicas
+// until the pods of the tfjob are created. The running pods keep the cluster
+// spec they were created with.
+func (tc *TFController) syncClusterSpecConfigMap(tfjob *tfv1.TFJob, pods []*v1.Pod) error {
+	if !clusterSpecViaConfigMap(tfjob) || !isDistributed(tfjob) {
+		return nil
+	}
+	configMap, err := tc.newClusterSpecConfigMap(tfjob)
+	if err != nil {
+		return err
+	}
+
+	existing, err := tc.configMapLister.ConfigMaps(tfjob.Namespace).Get(configMap.Name)
+	if err == nil {
+		if len(pods) > 0 || existing.Data[tfConfigKey] == configMap.Data[tfConfigKey] {
+			return nil
+		}
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+	return tc.ConfigMapControl.ApplyConfigMap(tfjob.Namespace, configMap, tfjob, tc.GenOwnerReference(tfjob))
+}
+
+// deleteClusterSpecConfigMap deletes the cluster spec ConfigMap of the
+// terminated tfjob, if it exists.
+func (tc *TFController) deleteClusterSpecConfigMap(tfjob *tfv1.TFJob) error {
+	if !clusterSpecViaConfigMap(tfjob) {
+		return nil
+	}
+	name := genClusterSpecConfigMapName(tfjob)
+	if _, err := tc.configMapLister.ConfigMaps(tfjob.Namespace).Get(name); errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	tflogger.LoggerForJob(tfjob).Infof("Deleting the cluster spec configmap %s", name)
+	return tc.ConfigMapControl.DeleteConfigMap(tfjob.Namespace, name, tfjob)
+}
+
+// handleDeletedConfigMap syncs the tfjob whose cluster spec ConfigMap was
+// deleted, so that it is recreated while the tfjob runs.
+func (tc *TFController) handleDeletedConfigMap(obj interface{}) {
+	configMap, ok := obj.(*v1.ConfigMap)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
+		}
+		if configMap, ok = tombstone.Obj.(*v1.ConfigMap); !ok {
+			return
+		}
+	}
+	controllerRef := metav1.GetControllerOf(configMap)
+	if controllerRef == nil || controllerRef.Kind != tfv1.Kind {
+		return
+	}
+	tc.WorkQueue.Add(configMap.Namespace + "/" + controllerRef.Name)
+}
+
+// setClusterSpecConfigMap mounts the cluster spec ConfigMap of the tfjob as
+// the TF_CONFIG file, at the path annotation of the tfjob or
+// defaultTFConfigPath, and sets TF_CONFIG to the task of the pod. TF_CONFIG
+// is merged over the TF_CONFIG file by the pods.
+func setClusterSpecConfigMap(podTemplateSpec *v1.PodTemplateSpec, tfjob *tfv1.TFJob, rt, index string) error {
+	taskConfigStr, err := genTaskTFConfigJSONStr(tfjob, rt, index)
+	if err != nil {
+		return err
+	}
+
+	path := defaultTFConfigPath
+	if p, ok := tfjob.Annotations[tfv1.AnnotationTFConfigPath]; ok {
+		path = p
+	}
+	return mountTFConfigFile(podTemplateSpec, path, func(file string) v1.VolumeSource {
+		return v1.VolumeSource{
+			ConfigMap: &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{Name: genClusterSpecConfigMapName(tfjob)},
+				Items:                []v1.KeyToPath{{Key: tfConfigKey, Path: file}},
+			},
+		}
+	}, v1.EnvVar{Name: tfConfig, Value: taskConfigStr})
+}
@@ -0,0 +1,167 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"encoding/json"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
+)
+
+func newTFJobWithClusterSpecConfigMap(worker, ps int) *tfv1.TFJob {
+	tfJob := testutil.NewTFJob(worker, ps)
+	via := tfv1.ClusterSpecViaConfigMap
+	tfJob.Spec.ClusterSpecVia = &via
+	return tfJob
+}
+
+func TestSyncClusterSpecConfigMap(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	fakeConfigMapControl := &control.FakeConfigMapControl{}
+	ctr.ConfigMapControl = fakeConfigMapControl
+	configMapIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	ctr.configMapLister = corelisters.NewConfigMapLister(configMapIndexer)
+	tfJob := newTFJobWithClusterSpecConfigMap(2, 1)
+	pods := []*v1.Pod{testutil.NewBasePod("pod", tfJob, t)}
+
+	type step struct {
+		description string
+		workers     int32
+		pods        []*v1.Pod
+		deleted     bool
+		applied     bool
+	}
+	steps := []step{
+		{"The ConfigMap is created", 2, nil, false, true},
+		{"The unchanged ConfigMap is not applied again", 2, nil, false, false},
+		{"The ConfigMap follows the replicas before the pods are created", 3, nil, false, true},
+		{"The ConfigMap is not updated once the pods are created", 4, pods, false, false},
+		{"The ConfigMap deleted by others is created again", 4, pods, true, true},
+	}
+	for _, s := range steps {
+		fakeConfigMapControl.Clear()
+		if s.deleted {
+			clearIndexer(configMapIndexer)
+		}
+		*tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Replicas = s.workers
+		if err := ctr.syncClusterSpecConfigMap(tfJob, s.pods); err != nil {
+			t.Fatalf("%s: unexpected error: %v", s.description, err)
+		}
+		if applied := len(fakeConfigMapControl.Templates) == 1; applied != s.applied {
+			t.Fatalf("%s: expected the ConfigMap applied %v, got %d", s.description, s.applied, len(fakeConfigMapControl.Templates))
+		}
+		if !s.applied {
+			continue
+		}
+		configMap := fakeConfigMapControl.Templates[0]
+		if configMap.Name != genClusterSpecConfigMapName(tfJob) || fakeConfigMapControl.ControllerRefs[0].UID != tfJob.UID {
+			t.Errorf("%s: expected the ConfigMap %s owned by the tfjob, got %s owned by %v", s.description,
+				genClusterSpecConfigMapName(tfJob), configMap.Name, fakeConfigMapControl.ControllerRefs[0])
+		}
+		var config TFConfig
+		if err := json.Unmarshal([]byte(configMap.Data[tfConfigKey]), &config); err != nil {
+			t.Fatalf("%s: unexpected error when parsing the cluster spec: %v", s.description, err)
+		}
+		if len(config.Cluster[testutil.LabelWorker]) != int(s.workers) || len(config.Cluster[testutil.LabelPS]) != 1 {
+			t.Errorf("%s: expected %d workers and 1 PS in the cluster spec, got %v", s.description, s.workers, config.Cluster)
+		}
+		configMapIndexer.Update(&configMap)
+	}
+
+	// The ConfigMap is deleted when the tfjob is terminated, unless it is
+	// already gone.
+	now := metav1.Now()
+	tfJob.Status.CompletionTime = &now
+	tfJob.Status.Conditions = []common.JobCondition{newCondition(common.JobSucceeded, tfJobSucceededReason, "")}
+	for _, deleted := range []bool{false, true} {
+		fakeConfigMapControl.Clear()
+		if deleted {
+			clearIndexer(configMapIndexer)
+		}
+		if err := ctr.cleanupTFJob(tfJob); err != nil {
+			t.Fatalf("Unexpected error when cleaning up the tfjob: %v", err)
+		}
+		if expected := !deleted; (len(fakeConfigMapControl.DeleteConfigMapName) == 1) != expected {
+			t.Errorf("Expected the ConfigMap deleted %v, got %v", expected, fakeConfigMapControl.DeleteConfigMapName)
+		}
+	}
+}
+
+// clearIndexer deletes all the objects of the indexer.
+func clearIndexer(indexer cache.Indexer) {
+	for _, obj := range indexer.List() {
+		indexer.Delete(obj)
+	}
+}
+
+func TestClusterSpecConfigMapPod(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	tfJob := newTFJobWithClusterSpecConfigMap(2, 1)
+
+	if err := ctr.createNewPod(tfJob, testutil.LabelWorker, "1", tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker], false); err != nil {
+		t.Fatalf("Unexpected error when creating the pod: %v", err)
+	}
+	podTemplate := fakePodControl.Templates[0]
+	container := findContainer(podTemplate.Spec.Containers, tfv1.DefaultContainerName)
+
+	env := make(map[string]string)
+	for _, e := range container.Env {
+		env[e.Name] = e.Value
+	}
+	var config TFConfig
+	if err := json.Unmarshal([]byte(env[tfConfig]), &config); err != nil {
+		t.Fatalf("Unexpected error when parsing %s: %v", tfConfig, err)
+	}
+	if config.Cluster != nil || config.Task != (TaskSpec{Type: testutil.LabelWorker, Index: 1}) {
+		t.Errorf("Expected %s to only hold the task of the pod, got %s", tfConfig, env[tfConfig])
+	}
+	if env[tfv1.EnvTFConfigFile] != defaultTFConfigPath {
+		t.Errorf("Expected %s to be %s, got %q", tfv1.EnvTFConfigFile, defaultTFConfigPath, env[tfv1.EnvTFConfigFile])
+	}
+
+	var volume *v1.Volume
+	for i := range podTemplate.Spec.Volumes {
+		if podTemplate.Spec.Volumes[i].Name == tfConfigVolumeName {
+			volume = &podTemplate.Spec.Volumes[i]
+		}
+	}
+	if volume == nil || volume.ConfigMap == nil || volume.ConfigMap.Name != genClusterSpecConfigMapName(tfJob) ||
+		len(volume.ConfigMap.Items) != 1 || volume.ConfigMap.Items[0] != (v1.KeyToPath{Key: tfConfigKey, Path: "tf_config.json"}) {
+		t.Errorf("Expected the cluster spec ConfigMap to be mounted, got %v", podTemplate.Spec.Volumes)
+	}
+	if len(container.VolumeMounts) != 1 || container.VolumeMounts[0].MountPath != "/etc/tf-config/" {
+		t.Errorf("Expected the cluster spec to be mounted at /etc/tf-config/, got %v", container.VolumeMounts)
+	}
+
+	// The ConfigMap is mounted at the TF_CONFIG file path of the tfjob.
+	fakePodControl.Clear()
+	tfJob.Annotations = map[string]string{tfv1.AnnotationTFConfigPath: "/opt/tf/config.json"}
+	if err := ctr.createNewPod(tfJob, testutil.LabelWorker, "1", tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker], false); err != nil {
+		t.Fatalf("Unexpected error when creating the pod: %v", err)
+	}
+	container = findContainer(fakePodControl.Templates[0].Spec.Containers, tfv1.DefaultContainerName)
+	if len(container.VolumeMounts) != 1 || container.VolumeMounts[0].MountPath != "/opt/tf/" {
+		t.Errorf("Expected the cluster spec to be mounted at /opt/tf/, got %v", container.VolumeMounts)
+	}
+}
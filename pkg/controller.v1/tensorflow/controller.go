@@ -16,20 +16,32 @@
 package tensorflow
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
 	log "github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	kubeinformers "k8s.io/client-go/informers"
 	kubeclientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	policylisters "k8s.io/client-go/listers/policy/v1beta1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/workqueue"
 
 	common "github.com/kubeflow/common/job_controller/api/v1"
 	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
@@ -40,6 +52,8 @@ import (
 	tfjobinformersv1 "github.com/kubeflow/tf-operator/pkg/client/informers/externalversions/tensorflow/v1"
 	tfjoblisters "github.com/kubeflow/tf-operator/pkg/client/listers/tensorflow/v1"
 	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
+	"github.com/kubeflow/tf-operator/pkg/control"
+	"github.com/kubeflow/tf-operator/pkg/export"
 	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
 	"github.com/kubeflow/tf-operator/pkg/util/k8sutil"
 	"github.com/prometheus/client_golang/prometheus"
@@ -51,6 +65,10 @@ import (
 const (
 	controllerName = "tf-operator"
 
+	// maxConcurrentReplicaTypes bounds the replica types of a tfjob which
+	// are reconciled concurrently.
+	maxConcurrentReplicaTypes = 3
+
 	// labels for pods and servers.
 	tfReplicaTypeLabel  = "tf-replica-type"
 	tfReplicaIndexLabel = "tf-replica-index"
@@ -69,6 +87,11 @@ var (
 		Name: "tf_operator_jobs_deleted_total",
 		Help: "Counts number of TF jobs deleted",
 	})
+
+	expectationsCount = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "tf_operator_expectations",
+		Help: "Number of entries in the expectations store of the tf-operator",
+	})
 )
 
 // TFController is the type for TFJob Controller, which manages
@@ -91,6 +114,372 @@ type TFController struct {
 	// tfJobInformer is a temporary field for unstructured informer support.
 	tfJobInformer cache.SharedIndexInformer
 
+	// tfJobInformers maps each watched namespace to its tfjob informer.
+	// In cluster scoped mode it only contains tfJobInformer.
+	tfJobInformers map[string]cache.SharedIndexInformer
+
+	// podIndexer is the pod indexer of the first namespace, podIndexers maps
+	// each watched namespace to its pod indexer. They index the pods by
+	// replica type, see podReplicaTypeIndex.
+	podIndexer  cache.Indexer
+	podIndexers map[string]cache.Indexer
+
+	// watchedNamespaces is the set of namespaces the operator is scoped to.
+	// It is empty if the operator is cluster scoped.
+	watchedNamespaces sets.String
+
+	// gpuQuotas maps a namespace to the maximum number of GPUs its tfjobs
+	// may request concurrently.
+	gpuQuotas map[string]int64
+
+	// enableWorkerAntiAffinity spreads the worker pods of a tfjob across nodes.
+	enableWorkerAntiAffinity bool
+	// enablePodDisruptionBudget protects the pods of all the tfjobs with a
+	// PodDisruptionBudget.
+	enablePodDisruptionBudget bool
+	// psAntiAffinity spreads the PS pods of a tfjob across nodes, see
+	// options.ServerOption.
+	psAntiAffinity string
+
+	// jobLabelSelector selects the tfjobs managed by this operator shard.
+	jobLabelSelector labels.Selector
+
+	// configHash is the hash of the options of the operator, logged with the
+	// summary of the syncs at debug level.
+	configHash string
+
+	// syncLatencyQueue is the work queue, which records how long the tfjobs wait in it.
+	syncLatencyQueue *syncLatencyQueue
+
+	// queueLatencyThreshold is the queue wait time above which a warning is logged.
+	queueLatencyThreshold time.Duration
+
+	// statusUpdateLimiter is the token bucket shared by the counter-only
+	// status updates of all tfjobs. It is nil if they are not rate limited.
+	statusUpdateLimiter flowcontrol.RateLimiter
+
+	// cleanupJitter is the period over which the deletions of the pods and
+	// services of terminal tfjobs are spread.
+	cleanupJitter time.Duration
+
+	// podTemplateRestartPolicy defines how a restart policy set in a pod
+	// template is handled, see options.ServerOption.
+	podTemplateRestartPolicy string
+
+	// maxCreationsPerSync bounds the pods, and the services, created for a
+	// replica type in one sync. It is unbounded if zero.
+	maxCreationsPerSync int
+	// creationThrottle further bounds the creations per sync while the API
+	// server throttles them.
+	creationThrottle creationThrottle
+
+	// psFailurePolicy defines how a PS pod failing with a non-retryable exit
+	// code is handled, see options.ServerOption.
+	psFailurePolicy string
+
+	// nameTemplate generates the names of the pods and services of the
+	// tfjobs.
+	nameTemplate jobcontroller.NameTemplate
+
+	// v1beta2Compatibility manages the pods and services created by the
+	// v1beta2 operator before an in-place upgrade, see options.ServerOption.
+	v1beta2Compatibility bool
+
+	// exemptPreemptions recreates the pods evicted or preempted by the cluster
+	// without counting them as failures, see options.ServerOption.
+	exemptPreemptions bool
+
+	// maxReplicas is the maximum total number of replicas of a tfjob.
+	maxReplicas int64
+
+	// defaultPortName and defaultPort are the default port recorded in the
+	// tfjobs first reconciled by the operator.
+	defaultPortName string
+	defaultPort     int32
+
+	// progressAnnotation is the annotation the Worker pods report their
+	// training progress in.
+	progressAnnotation string
+
+	// propagatedLabels and propagatedAnnotations are the keys of the labels
+	// and annotations of the tfjobs copied to their pods.
+	propagatedLabels      []string
+	propagatedAnnotations []string
+
+	// clock is the clock the pod creation ramp-ups and the unschedulable pods
+	// are timed with.
+	clock clock.Clock
+
+	// rampUpLock guards lastRampUpBatches.
+	rampUpLock sync.Mutex
+	// lastRampUpBatches is the time the last batch of pods of each tfjob
+	// ramping up was created, keyed by the key of the tfjob.
+	lastRampUpBatches map[string]time.Time
+
+	// ConfigMapControl applies and deletes the cluster spec ConfigMaps.
+	ConfigMapControl control.ConfigMapControlInterface
+
+	// PDBControl applies and deletes the PodDisruptionBudgets of the tfjobs.
+	PDBControl control.PodDisruptionBudgetControlInterface
+
+	// PVCControl creates and deletes the claims of the volume claim
+	// templates.
+	PVCControl control.PVCControlInterface
+
+	// ForceDeleteControl force deletes the pods stuck on failed nodes.
+	ForceDeleteControl control.PodForceDeleteControlInterface
+
+	// GracefulDeleteControl deletes the pods of the terminated tfjobs with
+	// the termination grace period of their replica type.
+	GracefulDeleteControl control.PodGracefulDeleteControlInterface
+
+	// JobControl creates the Jobs of the OnSuccess and OnFailure hooks.
+	JobControl control.JobControlInterface
+	// hookJobLister lists the Jobs of the hooks of the tfjobs.
+	hookJobLister batchlisters.JobLister
+
+	// pdbLister lists the PodDisruptionBudgets of the tfjobs.
+	pdbLister policylisters.PodDisruptionBudgetLister
+
+	// endpointsLister lists the endpoints of the services of the tfjobs, to
+	// find the ones which route to the pods of a previous tfjob.
+	endpointsLister corelisters.EndpointsLister
+	// staleServiceEndpointsPolicy defines how the services routing to the
+	// pods of a previous tfjob of the same name are handled: wait or
+	// recreate.
+	staleServiceEndpointsPolicy string
+
+	// nodeLister lists the nodes the unschedulable pods are compared with,
+	// and the nodes whose failure is recovered from. It is nil if neither
+	// the unschedulable pods are reported nor the node failures recovered.
+	nodeLister corelisters.NodeLister
+	// nodeInformerSynced returns true if the node store has been synced.
+	nodeInformerSynced cache.InformerSynced
+
+	// unschedulableEventThreshold is the time the pods of a tfjob may stay
+	// unschedulable before they are reported, and unschedulableEventInterval
+	// the minimum period between the reports of a tfjob.
+	unschedulableEventThreshold time.Duration
+	unschedulableEventInterval  time.Duration
+
+	// enableNodeFailureRecovery force deletes the pods whose node has not
+	// been ready for longer than nodeFailureGracePeriod.
+	enableNodeFailureRecovery bool
+	nodeFailureGracePeriod    time.Duration
+	// nodeFailureDeletionsLock guards nodeFailureDeletions.
+	nodeFailureDeletionsLock sync.Mutex
+	// nodeFailureDeletions is the UIDs of the pods of each tfjob force
+	// deleted because of their node, as long as they are in the cache, keyed
+	// by the key of the tfjob.
+	nodeFailureDeletions map[string]sets.String
+
+	// auditMaxEntries is the number of entries the audit ConfigMaps keep.
+	auditMaxEntries int
+	// auditLock guards auditTrails.
+	auditLock sync.Mutex
+	// auditTrails is the audit trail of each audited tfjob, keyed by the key
+	// of the tfjob.
+	auditTrails map[string]*auditTrail
+
+	// unschedulableLock guards lastUnschedulableEvents.
+	unschedulableLock sync.Mutex
+	// lastUnschedulableEvents is the time the unschedulable pods of each
+	// tfjob were last reported, keyed by the key of the tfjob.
+	lastUnschedulableEvents map[string]time.Time
+
+	// eventDedupeWindow is the period within which the events of the same
+	// reason about the same pod are emitted once on a tfjob.
+	eventDedupeWindow time.Duration
+	// recentEventsLock guards recentEvents.
+	recentEventsLock sync.Mutex
+	// recentEvents is the time the replica events of each tfjob were last
+	// emitted, keyed by the key of the tfjob.
+	recentEvents map[string]map[replicaEvent]time.Time
+
+	// externalDeletionThreshold is the number of times the pods of a replica
+	// may be deleted externally within externalDeletionWindow before they
+	// are no longer recreated for externalDeletionBackoff. The external
+	// deletions are not tracked if it is zero.
+	externalDeletionThreshold int
+	externalDeletionWindow    time.Duration
+	externalDeletionBackoff   time.Duration
+	// externalDeletionsLock guards externalDeletions.
+	externalDeletionsLock sync.Mutex
+	// externalDeletions is the pods of each tfjob deleted externally, keyed
+	// by the key of the tfjob.
+	externalDeletions map[string]*externalDeletions
+
+	// maxRestartBackoff caps the backoff of the recreation of the pods
+	// restarted under the ExitCode restart policy, which is disabled if it
+	// is 0, and restartBackoffStabilityWindow is the time a restarted pod
+	// must stay running for the backoff of its replica to be reset.
+	maxRestartBackoff             time.Duration
+	restartBackoffStabilityWindow time.Duration
+
+	// serviceResolver looks up the names of the PS and chief services of the
+	// tfjobs before their workers are created. The lookups are disabled if
+	// it is nil.
+	serviceResolver serviceResolver
+	// serviceDNSTimeout is the time the workers of a tfjob wait for its
+	// services to resolve.
+	serviceDNSTimeout time.Duration
+	// serviceDNSLock guards serviceDNSGates.
+	serviceDNSLock sync.Mutex
+	// serviceDNSGates is the lookups of the services of each tfjob, keyed by
+	// the key of the tfjob.
+	serviceDNSGates map[string]*serviceDNSGate
+	// psWaitInitContainer is the init container injected into the worker
+	// and chief pods of the tfjobs to wait for their PS, nil if disabled.
+	psWaitInitContainer *v1.Container
+
+	// disableServiceCreation is true if the services of the tfjobs are not
+	// created, see options.ServerOption.
+	disableServiceCreation bool
+
+	// imagePullFailureTimeout is the time a container may keep failing to
+	// pull its image before its tfjob fails, disabled if zero.
+	imagePullFailureTimeout time.Duration
+	// imagePullFailuresLock guards imagePullFailures.
+	imagePullFailuresLock sync.Mutex
+	// imagePullFailures is since when each pod failing to pull an image has
+	// been observed failing, keyed by the key of its tfjob and its UID.
+	imagePullFailures map[string]map[types.UID]time.Time
+
+	// recordSink is the sink the records of the terminated tfjobs are
+	// exported to before they are deleted after their TTL, nil if they are
+	// not exported.
+	recordSink export.Sink
+	// recordExportMaxAttempts is the failed exports of the record of a tfjob
+	// after which it is deleted anyway, unbounded if zero.
+	recordExportMaxAttempts int
+	// recordExportQueue is the keys of the tfjobs whose record is to be
+	// exported by the record export workers.
+	recordExportQueue workqueue.RateLimitingInterface
+	// recordExportsLock guards recordExports.
+	recordExportsLock sync.Mutex
+	// recordExports is the export of the record of each terminated tfjob,
+	// keyed by the key of the tfjob.
+	recordExports map[string]*recordExport
+
+	// strandedPodsLock guards strandedPods.
+	strandedPodsLock sync.Mutex
+	// strandedPods is the number of pods controlled by each tfjob which do
+	// not match its selector, keyed by the key of the tfjob.
+	strandedPods map[string]int
+
+	// observedReplicasLock guards observedReplicas.
+	observedReplicasLock sync.Mutex
+	// observedReplicas is the number of replicas of each replica type of
+	// each tfjob last reconciled, keyed by the key of the tfjob.
+	observedReplicas map[string]map[tfv1.TFReplicaType]int
+
+	// podDefaultsLock guards podDefaults.
+	podDefaultsLock sync.Mutex
+	// podDefaults is the partial pod template merged into the pods of the
+	// tfjobs, it is nil if there are none.
+	podDefaults *v1.PodTemplateSpec
+	// podDefaultsInformerSynced returns true if the pod defaults ConfigMap
+	// store has been synced. It is nil if no pod defaults are watched.
+	podDefaultsInformerSynced cache.InformerSynced
+
+	// replicaNodePools is the name of the node pool each replica type is
+	// mapped to, keyed by the lower case replica type.
+	replicaNodePools map[string]string
+	// nodePoolsLock guards nodePools.
+	nodePoolsLock sync.Mutex
+	// nodePools is the node pools the replica types are mapped to, keyed by
+	// name.
+	nodePools map[string]nodePool
+	// nodePoolsInformerSynced returns true if the node pools ConfigMap store
+	// has been synced. It is nil if no node pools are watched.
+	nodePoolsInformerSynced cache.InformerSynced
+
+	// dataAccessLabel is the label of the tfjobs naming the data access
+	// profile injected into their pods.
+	dataAccessLabel string
+	// dataAccessLock guards dataAccessProfiles.
+	dataAccessLock sync.Mutex
+	// dataAccessProfiles is the data access profiles keyed by name.
+	dataAccessProfiles map[string]dataAccessProfile
+	// dataAccessInformerSynced returns true if the data access ConfigMap
+	// store has been synced. It is nil if no data access profiles are
+	// watched.
+	dataAccessInformerSynced cache.InformerSynced
+
+	// operatorSidecarLock guards operatorSidecar.
+	operatorSidecarLock sync.Mutex
+	// operatorSidecar is the sidecar injected into the pods of the tfjobs, it
+	// is nil if there is none.
+	operatorSidecar *operatorSidecar
+	// operatorSidecarInformerSynced returns true if the operator sidecar
+	// ConfigMap store has been synced. It is nil if no operator sidecar is
+	// watched.
+	operatorSidecarInformerSynced cache.InformerSynced
+
+	// securityContextLock guards securityContextConfig.
+	securityContextLock sync.Mutex
+	// securityContextConfig is the security context defaults merged into the
+	// pods of the tfjobs, it is nil if there are none.
+	securityContextConfig *securityContextConfig
+	// securityContextStrict rejects the tfjobs whose pod templates set values
+	// conflicting with the security context defaults.
+	securityContextStrict bool
+	// securityContextInformerSynced returns true if the security context
+	// ConfigMap store has been synced. It is nil if no security context
+	// defaults are watched.
+	securityContextInformerSynced cache.InformerSynced
+	// namespaceLister lists the namespaces exempted from the security context
+	// defaults. It is nil if no security context defaults are watched.
+	namespaceLister corelisters.NamespaceLister
+	// namespaceInformerSynced returns true if the namespace store has been
+	// synced.
+	namespaceInformerSynced cache.InformerSynced
+
+	// podTemplateLister lists the PodTemplates referenced by the tfjobs. Its
+	// store is synced along with the pod store, as the pods are created from
+	// them.
+	podTemplateLister corelisters.PodTemplateLister
+
+	// missingPodTemplateTimeout is the time a tfjob waits for a PodTemplate
+	// it references to exist before it fails.
+	missingPodTemplateTimeout time.Duration
+	// podTemplateLock guards changedPodTemplates and missingPodTemplates.
+	podTemplateLock sync.Mutex
+	// changedPodTemplates is the replica types of each tfjob whose referenced
+	// PodTemplate changed since it was first resolved, keyed by the key of
+	// the tfjob.
+	changedPodTemplates map[string]sets.String
+	// missingPodTemplates is since when each tfjob has been waiting for a
+	// PodTemplate it references to exist, keyed by the key of the tfjob.
+	missingPodTemplates map[string]time.Time
+
+	// replicaAttemptsLock guards replicaAttempts.
+	replicaAttemptsLock sync.Mutex
+	// replicaAttempts is the attempts of the replicas of each tfjob recorded
+	// by the syncs of this operator, keyed by the key of the tfjob, so that
+	// the pods recreated before the cache has the updated status get the
+	// right attempt.
+	replicaAttempts map[string]map[string]int32
+
+	// firstPodRunningLock guards firstPodRunningObserved.
+	firstPodRunningLock sync.Mutex
+	// firstPodRunningObserved is the keys of the tfjobs whose first running
+	// pod has been observed.
+	firstPodRunningObserved sets.String
+
+	// syncCountsLock guards syncCounts.
+	syncCountsLock sync.Mutex
+	// syncCounts is the syncs of the tfjobs until they terminate, keyed by
+	// their UID.
+	syncCounts map[types.UID]*syncCount
+	// operatorStartTime is when the controller was created, the tfjobs
+	// created before were likely synced by a previous operator.
+	operatorStartTime time.Time
+
+	// configMapLister lists the cluster spec ConfigMaps of the tfjobs. Its
+	// store is synced along with the pod store, as the pods mount them.
+	configMapLister corelisters.ConfigMapLister
+
 	// Listers for TFJob, Pod and Service
 	// tfJobLister can list/get tfjobs from the shared informer's store.
 	tfJobLister tfjoblisters.TFJobLister
@@ -112,69 +501,319 @@ func NewTFController(
 	tfJobInformerFactory tfjobinformers.SharedInformerFactory,
 	option options.ServerOption) *TFController {
 
+	return NewMultiNamespaceTFController(
+		map[string]tfjobinformersv1.TFJobInformer{option.Namespace: tfJobInformer},
+		kubeClientSet, kubeBatchClientSet, tfJobClientSet,
+		map[string]kubeinformers.SharedInformerFactory{option.Namespace: kubeInformerFactory},
+		tfJobInformerFactory, option)
+}
+
+// NewMultiNamespaceTFController returns a new TFJob controller which watches
+// several namespaces, with one TFJob informer and one kube informer factory
+// per namespace. The informers are keyed by namespace.
+func NewMultiNamespaceTFController(
+	tfJobInformers map[string]tfjobinformersv1.TFJobInformer,
+	kubeClientSet kubeclientset.Interface,
+	kubeBatchClientSet kubebatchclient.Interface,
+	tfJobClientSet tfjobclientset.Interface,
+	kubeInformerFactories map[string]kubeinformers.SharedInformerFactory,
+	tfJobInformerFactory tfjobinformers.SharedInformerFactory,
+	option options.ServerOption) *TFController {
+
 	err := tfjobscheme.AddToScheme(scheme.Scheme)
 	if err != nil {
 		log.Fatalf("Failed to add tfjob scheme: %v", err)
 	}
 
+	jobLabelSelector, err := labels.Parse(option.JobLabelSelector)
+	if err != nil {
+		log.Fatalf("Failed to parse the job label selector %q: %v", option.JobLabelSelector, err)
+	}
+
 	log.Info("Creating TFJob controller")
 	// Create new TFController.
 	tc := &TFController{
-		tfJobClientSet: tfJobClientSet,
+		tfJobClientSet:    tfJobClientSet,
+		tfJobInformers:    make(map[string]cache.SharedIndexInformer),
+		podIndexers:       make(map[string]cache.Indexer),
+		watchedNamespaces: sets.NewString(option.WatchedNamespaces()...),
+		gpuQuotas:         option.GPUQuotas,
+		jobLabelSelector:  jobLabelSelector,
+		configHash:        option.ConfigHash(),
+
+		enablePodDisruptionBudget: option.EnablePodDisruptionBudget,
+		exemptPreemptions:         option.ExemptPreemptions,
+		nameTemplate:              jobcontroller.NameTemplate(option.NameTemplate),
+		v1beta2Compatibility:      option.V1beta2Compatibility,
+
+		enableWorkerAntiAffinity: option.EnableWorkerAntiAffinity,
+		psAntiAffinity:           option.PSAntiAffinity,
+		queueLatencyThreshold:    option.QueueLatencyThreshold,
+		maxCreationsPerSync:      option.MaxPodCreationsPerSync,
+		cleanupJitter:            option.CleanupJitter,
+		podTemplateRestartPolicy: option.PodTemplateRestartPolicy,
+		psFailurePolicy:          option.PSFailurePolicy,
+		replicaNodePools:         lowerKeys(option.ReplicaNodePools),
+		dataAccessLabel:          option.DataAccessLabel,
+		securityContextStrict:    option.SecurityContextStrict,
+		maxReplicas:              maxReplicasOption(option.MaxReplicas),
+		defaultPortName:          tfv1.DefaultPortName,
+		defaultPort:              tfv1.DefaultPort,
+		progressAnnotation:       tfv1.AnnotationProgress,
+		propagatedLabels:         option.PropagatedLabels,
+		propagatedAnnotations:    option.PropagatedAnnotations,
+		clock:                    clock.RealClock{},
+		lastRampUpBatches:        make(map[string]time.Time),
+		changedPodTemplates:      make(map[string]sets.String),
+		missingPodTemplates:      make(map[string]time.Time),
+		replicaAttempts:          make(map[string]map[string]int32),
+		firstPodRunningObserved:  sets.NewString(),
+		syncCounts:               make(map[types.UID]*syncCount),
+		operatorStartTime:        time.Now(),
+
+		missingPodTemplateTimeout: option.MissingPodTemplateTimeout,
+
+		unschedulableEventThreshold: option.UnschedulableEventThreshold,
+		unschedulableEventInterval:  option.UnschedulableEventInterval,
+		lastUnschedulableEvents:     make(map[string]time.Time),
+
+		enableNodeFailureRecovery: option.EnableNodeFailureRecovery,
+		nodeFailureGracePeriod:    option.NodeFailureGracePeriod,
+		nodeFailureDeletions:      make(map[string]sets.String),
+
+		auditMaxEntries: option.AuditMaxEntries,
+		auditTrails:     make(map[string]*auditTrail),
+
+		eventDedupeWindow: option.EventDedupeWindow,
+		recentEvents:      make(map[string]map[replicaEvent]time.Time),
+
+		externalDeletionThreshold: option.ExternalDeletionThreshold,
+		externalDeletionWindow:    option.ExternalDeletionWindow,
+		externalDeletionBackoff:   option.ExternalDeletionBackoff,
+		externalDeletions:         make(map[string]*externalDeletions),
+
+		maxRestartBackoff:             option.MaxRestartBackoff,
+		restartBackoffStabilityWindow: option.RestartBackoffStabilityWindow,
+
+		serviceDNSTimeout: option.ServiceDNSTimeout,
+		serviceDNSGates:   make(map[string]*serviceDNSGate),
+
+		disableServiceCreation:      option.DisableServiceCreation,
+		staleServiceEndpointsPolicy: option.StaleServiceEndpointsPolicy,
+
+		strandedPods: make(map[string]int),
+
+		observedReplicas: make(map[string]map[tfv1.TFReplicaType]int),
+
+		imagePullFailureTimeout: option.ImagePullFailureTimeout,
+		imagePullFailures:       make(map[string]map[types.UID]time.Time),
+
+		recordExportMaxAttempts: option.RecordExportMaxAttempts,
+		recordExportQueue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "record-exports"),
+		recordExports:           make(map[string]*recordExport),
+	}
+	if option.ServiceDNSResolver != "" {
+		tc.serviceResolver = newServiceResolver(option.ServiceDNSResolver)
+	}
+	if option.InitContainerImage != "" {
+		tc.psWaitInitContainer, err = newPSWaitInitContainer(option.InitContainerImage,
+			option.InitContainerCPU, option.InitContainerMemory)
+		if err != nil {
+			log.Fatalf("Failed to create the PS wait init container: %v", err)
+		}
+	}
+	if option.ProgressAnnotation != "" {
+		tc.progressAnnotation = option.ProgressAnnotation
+	}
+	if option.DefaultPortName != "" {
+		tc.defaultPortName = option.DefaultPortName
+	}
+	if option.DefaultPort > 0 {
+		tc.defaultPort = int32(option.DefaultPort)
+	}
+	if option.StatusUpdateQPS > 0 {
+		tc.statusUpdateLimiter = flowcontrol.NewTokenBucketRateLimiter(float32(option.StatusUpdateQPS), option.StatusUpdateBurst)
+	}
+
+	namespaces := make([]string, 0, len(tfJobInformers))
+	for namespace := range tfJobInformers {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	var informersSynced []cache.InformerSynced
+	var podInformerSynced, serviceInformerSynced cache.InformerSynced
+	podListers := make(map[string]corelisters.PodLister)
+	serviceListers := make(map[string]corelisters.ServiceLister)
+	podTemplateListers := make(map[string]corelisters.PodTemplateLister)
+	hookJobListers := make(map[string]batchlisters.JobLister)
+	pdbListers := make(map[string]policylisters.PodDisruptionBudgetLister)
+	endpointsListers := make(map[string]corelisters.EndpointsLister)
+	configMapListers := make(map[string]corelisters.ConfigMapLister)
+	for _, namespace := range namespaces {
+		tfJobInformer := tfJobInformers[namespace]
+		// Set up an event handler for when tfjob resources change.
+		tfJobInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    tc.addTFJob,
+			UpdateFunc: tc.updateTFJob,
+			DeleteFunc: tc.handleDeletedTFJob,
+		})
+		tc.tfJobInformers[namespace] = tfJobInformer.Informer()
+		informersSynced = append(informersSynced, tfJobInformer.Informer().HasSynced)
+
+		// The informer of the first namespace is the default one.
+		if tc.tfJobInformer == nil {
+			tc.tfJobInformer = tfJobInformer.Informer()
+			tc.tfJobLister = tfJobInformer.Lister()
+		}
+
+		kubeInformerFactory, ok := kubeInformerFactories[namespace]
+		if !ok {
+			log.Fatalf("No kube informer factory for namespace %q", namespace)
+		}
+
+		// Create pod informer.
+		podInformer := kubeInformerFactory.Core().V1().Pods()
+
+		// Set up an event handler for when pod resources change
+		podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    tc.AddPod,
+			UpdateFunc: tc.UpdatePod,
+			DeleteFunc: tc.handleDeletedPod,
+		})
+		podListers[namespace] = podInformer.Lister()
+		if err := podInformer.Informer().AddIndexers(podIndexers()); err != nil {
+			// The pods of the namespace are then listed without the index.
+			log.Warnf("Failed to add the pod indexers for namespace %q: %v", namespace, err)
+		} else {
+			tc.podIndexers[namespace] = podInformer.Informer().GetIndexer()
+			if tc.podIndexer == nil {
+				tc.podIndexer = podInformer.Informer().GetIndexer()
+			}
+		}
+
+		// Create service informer.
+		serviceInformer := kubeInformerFactory.Core().V1().Services()
+
+		// Set up an event handler for when service resources change.
+		serviceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    tc.AddService,
+			UpdateFunc: tc.UpdateService,
+			DeleteFunc: tc.DeleteService,
+		})
+		serviceListers[namespace] = serviceInformer.Lister()
+
+		// Create endpoints informer, so that the tfjobs waiting for the
+		// endpoints of their services to drain are synced again.
+		endpointsInformer := kubeInformerFactory.Core().V1().Endpoints()
+		endpointsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    tc.addEndpoints,
+			UpdateFunc: tc.updateEndpoints,
+		})
+		endpointsListers[namespace] = endpointsInformer.Lister()
+
+		// Create PodTemplate informer, for the templates referenced by the tfjobs.
+		podTemplateInformer := kubeInformerFactory.Core().V1().PodTemplates()
+		podTemplateListers[namespace] = podTemplateInformer.Lister()
+
+		// Create ConfigMap informer, so that the cluster spec ConfigMaps
+		// deleted by others are created again.
+		configMapInformer := kubeInformerFactory.Core().V1().ConfigMaps()
+		configMapInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			DeleteFunc: tc.handleDeletedConfigMap,
+		})
+		configMapListers[namespace] = configMapInformer.Lister()
+
+		// Create Job informer, for the Jobs of the hooks of the tfjobs.
+		hookJobInformer := kubeInformerFactory.Batch().V1().Jobs()
+		hookJobInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    tc.addHookJob,
+			UpdateFunc: tc.updateHookJob,
+			DeleteFunc: tc.deleteHookJob,
+		})
+		hookJobListers[namespace] = hookJobInformer.Lister()
+
+		// Create PodDisruptionBudget informer, so that the budgets deleted or
+		// changed by others are applied again.
+		pdbInformer := kubeInformerFactory.Policy().V1beta1().PodDisruptionBudgets()
+		pdbInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: tc.updatePodDisruptionBudget,
+			DeleteFunc: tc.handleDeletedPodDisruptionBudget,
+		})
+		pdbListers[namespace] = pdbInformer.Lister()
+
+		podInformerSynced = allSynced(podInformerSynced, podInformer.Informer().HasSynced,
+			podTemplateInformer.Informer().HasSynced, hookJobInformer.Informer().HasSynced,
+			pdbInformer.Informer().HasSynced, configMapInformer.Informer().HasSynced)
+		serviceInformerSynced = allSynced(serviceInformerSynced, serviceInformer.Informer().HasSynced,
+			endpointsInformer.Informer().HasSynced)
+	}
+	tc.tfJobInformerSynced = allSynced(informersSynced...)
+
+	var podLister corelisters.PodLister
+	var serviceLister corelisters.ServiceLister
+	if len(namespaces) == 1 {
+		podLister = podListers[namespaces[0]]
+		serviceLister = serviceListers[namespaces[0]]
+		tc.podTemplateLister = podTemplateListers[namespaces[0]]
+		tc.hookJobLister = hookJobListers[namespaces[0]]
+		tc.pdbLister = pdbListers[namespaces[0]]
+		tc.endpointsLister = endpointsListers[namespaces[0]]
+		tc.configMapLister = configMapListers[namespaces[0]]
+	} else {
+		podLister = k8sutil.NewMultiNamespacePodLister(podListers)
+		serviceLister = k8sutil.NewMultiNamespaceServiceLister(serviceListers)
+		tc.podTemplateLister = k8sutil.NewMultiNamespacePodTemplateLister(podTemplateListers)
+		tc.hookJobLister = k8sutil.NewMultiNamespaceJobLister(hookJobListers)
+		tc.pdbLister = k8sutil.NewMultiNamespacePodDisruptionBudgetLister(pdbListers)
+		tc.endpointsLister = k8sutil.NewMultiNamespaceEndpointsLister(endpointsListers)
+		tc.configMapLister = k8sutil.NewMultiNamespaceConfigMapLister(configMapListers)
 	}
 
 	// Create base controller
 	log.Info("Creating Job controller")
-	jc := jobcontroller.NewJobController(tc, metav1.Duration{Duration: 15 * time.Second},
-		option.EnableGangScheduling, option.GangSchedulerName, kubeClientSet, kubeBatchClientSet, kubeInformerFactory, tfv1.Plural)
+	reconcilerSyncPeriod := option.ReconcilerSyncPeriod
+	if reconcilerSyncPeriod <= 0 {
+		reconcilerSyncPeriod = options.DefaultReconcilerSyncPeriod
+	}
+	jc := jobcontroller.NewJobController(tc, metav1.Duration{Duration: reconcilerSyncPeriod},
+		option.EnableGangScheduling, option.GangSchedulerName, kubeClientSet, kubeBatchClientSet,
+		podLister, serviceLister, tfv1.Plural)
+	jc.PodInformerSynced = podInformerSynced
+	jc.ServiceInformerSynced = serviceInformerSynced
+	// Replace the work queue to measure how long the tfjobs wait in it.
+	jc.WorkQueue.ShutDown()
+	tc.syncLatencyQueue = newSyncLatencyQueue(workqueue.DefaultControllerRateLimiter(), tfv1.Plural, tc.clock)
+	jc.WorkQueue = tc.syncLatencyQueue
 	tc.JobController = jc
+	tc.ConfigMapControl = control.RealConfigMapControl{KubeClient: kubeClientSet, Recorder: jc.Recorder}
+	tc.PDBControl = control.RealPodDisruptionBudgetControl{KubeClient: kubeClientSet, Recorder: jc.Recorder}
+	tc.PVCControl = control.RealPVCControl{KubeClient: kubeClientSet, Recorder: jc.Recorder}
+	tc.ForceDeleteControl = control.RealPodForceDeleteControl{KubeClient: kubeClientSet, Recorder: jc.Recorder}
+	tc.GracefulDeleteControl = control.RealPodGracefulDeleteControl{KubeClient: kubeClientSet, Recorder: jc.Recorder}
+	tc.JobControl = control.RealJobControl{KubeClient: kubeClientSet, Recorder: jc.Recorder}
 	// Set sync handler.
 	tc.syncHandler = tc.syncTFJob
 	tc.updateStatusHandler = tc.updateTFJobStatus
 	// set delete handler.
 	tc.deleteTFJobHandler = tc.deleteTFJob
-	// Set up an event handler for when tfjob resources change.
-	tfJobInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    tc.addTFJob,
-		UpdateFunc: tc.updateTFJob,
-		// This will enter the sync loop and no-op,
-		// because the tfjob has been deleted from the store.
-		DeleteFunc: tc.enqueueTFJob,
-	})
-
-	tc.tfJobInformer = tfJobInformer.Informer()
-	tc.tfJobLister = tfJobInformer.Lister()
-	tc.tfJobInformerSynced = tfJobInformer.Informer().HasSynced
-
-	// Create pod informer.
-	podInformer := kubeInformerFactory.Core().V1().Pods()
-
-	// Set up an event handler for when pod resources change
-	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    jc.AddPod,
-		UpdateFunc: jc.UpdatePod,
-		DeleteFunc: jc.DeletePod,
-	})
-
-	tc.PodLister = podInformer.Lister()
-	tc.PodInformerSynced = podInformer.Informer().HasSynced
-
-	// Create service informer.
-	serviceInformer := kubeInformerFactory.Core().V1().Services()
-
-	// Set up an event handler for when service resources change.
-	serviceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    jc.AddService,
-		UpdateFunc: jc.UpdateService,
-		DeleteFunc: jc.DeleteService,
-	})
-
-	tc.ServiceLister = serviceInformer.Lister()
-	tc.ServiceInformerSynced = serviceInformer.Informer().HasSynced
 
 	return tc
 }
 
+// allSynced returns an InformerSynced which reports true only once
+// all of the given non-nil InformerSynced functions do.
+func allSynced(synced ...cache.InformerSynced) cache.InformerSynced {
+	return func() bool {
+		for _, s := range synced {
+			if s != nil && !s() {
+				return false
+			}
+		}
+		return true
+	}
+}
+
 // Run will set up the event handlers for types we are interested in, as well
 // as syncing informer caches and starting workers. It will block until stopCh
 // is closed, at which point it will shutdown the workqueue and wait for
@@ -182,6 +821,7 @@ func NewTFController(
 func (tc *TFController) Run(threadiness int, stopCh <-chan struct{}) error {
 	defer utilruntime.HandleCrash()
 	defer tc.WorkQueue.ShutDown()
+	defer tc.recordExportQueue.ShutDown()
 
 	// Start the informer factories to begin populating the informer caches.
 	log.Info("Starting TFJob controller")
@@ -189,15 +829,21 @@ func (tc *TFController) Run(threadiness int, stopCh <-chan struct{}) error {
 	// Wait for the caches to be synced before starting workers.
 	log.Info("Waiting for informer caches to sync")
 
-	if ok := cache.WaitForCacheSync(stopCh, tc.tfJobInformerSynced,
-		tc.PodInformerSynced, tc.ServiceInformerSynced); !ok {
+	if ok := cache.WaitForCacheSync(stopCh, tc.informersSynced()...); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
+	tc.checkStrandedPods()
 	log.Infof("Starting %v workers", threadiness)
 	// Launch workers to process TFJob resources.
 	for i := 0; i < threadiness; i++ {
 		go wait.Until(tc.runWorker, time.Second, stopCh)
 	}
+	if tc.recordSink != nil {
+		// Launch workers to export the records of the terminated tfjobs.
+		for i := 0; i < threadiness; i++ {
+			go wait.Until(tc.runRecordExportWorker, time.Second, stopCh)
+		}
+	}
 
 	log.Info("Started workers")
 	<-stopCh
@@ -206,6 +852,31 @@ func (tc *TFController) Run(threadiness int, stopCh <-chan struct{}) error {
 	return nil
 }
 
+// informersSynced returns the functions telling whether the caches of the
+// informers the controller reads from have been synced.
+func (tc *TFController) informersSynced() []cache.InformerSynced {
+	informersSynced := []cache.InformerSynced{tc.tfJobInformerSynced, tc.PodInformerSynced, tc.ServiceInformerSynced}
+	if tc.nodeInformerSynced != nil {
+		informersSynced = append(informersSynced, tc.nodeInformerSynced)
+	}
+	if tc.podDefaultsInformerSynced != nil {
+		informersSynced = append(informersSynced, tc.podDefaultsInformerSynced)
+	}
+	if tc.nodePoolsInformerSynced != nil {
+		informersSynced = append(informersSynced, tc.nodePoolsInformerSynced)
+	}
+	if tc.dataAccessInformerSynced != nil {
+		informersSynced = append(informersSynced, tc.dataAccessInformerSynced)
+	}
+	if tc.operatorSidecarInformerSynced != nil {
+		informersSynced = append(informersSynced, tc.operatorSidecarInformerSynced)
+	}
+	if tc.securityContextInformerSynced != nil {
+		informersSynced = append(informersSynced, tc.securityContextInformerSynced, tc.namespaceInformerSynced)
+	}
+	return informersSynced
+}
+
 // runWorker is a long-running function that will continually call the
 // processNextWorkItem function in order to read and process a message on the
 // workqueue.
@@ -222,6 +893,7 @@ func (tc *TFController) processNextWorkItem() bool {
 		return false
 	}
 	defer tc.WorkQueue.Done(obj)
+	waited, hasWaited := tc.syncLatencyQueue.waitTime(obj)
 
 	var key string
 	var ok bool
@@ -240,6 +912,7 @@ func (tc *TFController) processNextWorkItem() bool {
 		if err == errNotExists {
 			logger.Infof("TFJob has been deleted: %v", key)
 			tfJobsDeletedCount.Inc()
+			tc.forgetTFJob(key)
 			return true
 		}
 
@@ -254,6 +927,11 @@ func (tc *TFController) processNextWorkItem() bool {
 		return true
 	}
 
+	// Terminal tfjobs are not expected to be synced promptly.
+	if hasWaited && !isSucceeded(tfJob.Status.JobStatus) && !isFailed(tfJob.Status.JobStatus) {
+		tc.observeQueueLatency(key, waited)
+	}
+
 	// Sync TFJob to match the actual state to this desired state.
 	forget, err := tc.syncHandler(key)
 	if err == nil {
@@ -263,6 +941,31 @@ func (tc *TFController) processNextWorkItem() bool {
 		return true
 	}
 
+	observeReconcileError(err)
+	if errors.Is(err, ErrPermanent) {
+		// Retrying cannot help, leave the failure in the tfjob instead.
+		tc.WorkQueue.Forget(key)
+		tfJob = tfJob.DeepCopy()
+		oldStatus := tfJob.Status.DeepCopy()
+		msg := fmt.Sprintf("TFJob %s cannot be reconciled: %v", tfJob.Name, err)
+		if err := tc.failInvalidSpec(tfJob, msg); err == nil {
+			if err := tc.updateStatusHandler(tfJob); err != nil {
+				utilruntime.HandleError(fmt.Errorf("error updating the status of tfjob %s: %v", key, err))
+			} else {
+				tc.recordStatusTransition(tfJob, oldStatus)
+			}
+		}
+		return true
+	}
+
+	if delay, throttled := throttleDelay(err); throttled {
+		// The API server is overloaded, retrying sooner would add to its load.
+		throttledOperationsCount.WithLabelValues(errorCategory(err)).Inc()
+		logger.Warnf("Throttled by the API server, syncing tfjob %s again in %v: %v", key, delay, err)
+		tc.WorkQueue.AddAfter(key, delay)
+		return true
+	}
+
 	utilruntime.HandleError(fmt.Errorf("error syncing tfjob: %v", err))
 	tc.WorkQueue.AddRateLimited(key)
 
@@ -286,8 +989,19 @@ func (tc *TFController) enqueueTFJob(tfjob interface{}) {
 func (tc *TFController) syncTFJob(key string) (bool, error) {
 	startTime := time.Now()
 	logger := tflogger.LoggerForKey(key)
+	// noOp is why the sync took no action, if so.
+	var noOp *syncNoOp
 	defer func() {
-		logger.Infof("Finished syncing tfjob %q (%v)", key, time.Since(startTime))
+		summary := logger
+		if log.IsLevelEnabled(log.DebugLevel) {
+			// Tell which options the tfjob was synced with.
+			summary = logger.WithField("configHash", tc.configHash)
+		}
+		if noOp != nil {
+			summary.Infof("Finished syncing tfjob %q (%v), no action: %v", key, time.Since(startTime), noOp)
+			return
+		}
+		summary.Infof("Finished syncing tfjob %q (%v)", key, time.Since(startTime))
 	}()
 
 	namespace, name, err := cache.SplitMetaNamespaceKey(key)
@@ -297,31 +1011,60 @@ func (tc *TFController) syncTFJob(key string) (bool, error) {
 	if len(namespace) == 0 || len(name) == 0 {
 		return false, fmt.Errorf("invalid tfjob key %q: either namespace or name is missing", key)
 	}
+	if !tc.isWatchedNamespace(namespace) {
+		// The informers only watch the namespaces of the operator, but the
+		// key may have been enqueued from elsewhere.
+		logger.Warnf("Ignoring tfjob %s outside of the watched namespaces", key)
+		return true, nil
+	}
 
 	sharedTFJob, err := tc.getTFJobFromName(namespace, name)
 	if err != nil {
 		if err == errNotExists {
 			logger.Infof("TFJob has been deleted: %v", key)
 			tfJobsDeletedCount.Inc()
-			// jm.expectations.DeleteExpectations(key)
+			tc.forgetTFJob(key)
 			return true, nil
 		}
 		return false, err
 	}
 
+	// The sync works on a single copy of the tfjob, taken once here, which is
+	// never shared with the cache nor the event handlers: the defaults below
+	// rename the keys of its TFReplicaSpecs.
 	tfjob := sharedTFJob.DeepCopy()
-	tfjobNeedsSync := tc.satisfiedExpectations(tfjob)
-
-	// Set default for the new tfjob.
+	// The sync is counted with the status it reconciles the tfjob to.
+	defer tc.countSync(tfjob)
+	// The actions of the sync are audited at once.
+	defer tc.flushAudit(tfjob)
+	expectations := tc.satisfiedExpectations(tfjob)
+
+	// Set default for the new tfjob, with the default port it was first
+	// reconciled with. The defaults are set before the replica types are
+	// reconciled concurrently, which only read the TFReplicaSpecs.
+	tc.recordDefaultPort(tfjob)
 	scheme.Scheme.Default(tfjob)
 
-	var reconcileTFJobsErr error
-	if tfjobNeedsSync && tfjob.DeletionTimestamp == nil {
-		reconcileTFJobsErr = tc.reconcileTFJobs(tfjob)
+	switch {
+	case tfjob.DeletionTimestamp != nil:
+		noOp = &syncNoOp{reason: noOpDeletionInProgress}
+	case !expectations.satisfied():
+		noOp = &syncNoOp{reason: noOpExpectationsUnsatisfied, detail: expectations.pending()}
+		tc.observeExpectationsSkip(expectations)
+	default:
+		oldStatus := tfjob.Status.DeepCopy()
+		reconcileTFJobsErr := tc.reconcileTFJobs(tfjob)
+		tc.updateExpectationsCount()
+		if reconcileTFJobsErr != nil {
+			return false, reconcileTFJobsErr
+		}
+		noOp = tc.reconcileNoOp(tfjob, oldStatus, expectations)
 	}
-
-	if reconcileTFJobsErr != nil {
-		return false, reconcileTFJobsErr
+	if noOp != nil {
+		logger.WithFields(log.Fields{
+			"noop_reason": noOp.reason,
+			"noop_detail": noOp.detail,
+		}).Debugf("No action taken when syncing tfjob %q: %v", key, noOp)
 	}
 
 	return true, err
@@ -339,27 +1082,39 @@ func (tc *TFController) reconcileTFJobs(tfjob *tfv1.TFJob) error {
 	logger.Infof("Reconcile TFJobs %s", tfjob.Name)
 
 	oldStatus := tfjob.Status.DeepCopy()
+	echoSyncRequest(tfjob)
 
-	pods, err := tc.GetPodsForJob(tfjob)
+	pods, podsByType, err := tc.getPodsForTFJob(tfjob)
 
 	if err != nil {
 		logger.Warnf("getPodsForTFJob error %v", err)
 		return err
 	}
 
-	services, err := tc.GetServicesForJob(tfjob)
+	services, err := tc.getServicesForTFJob(tfjob)
 
 	if err != nil {
 		logger.Warnf("getServicesForTFJob error %v", err)
 		return err
 	}
+	tc.updateMixedModeCondition(tfjob, pods, services)
 
 	// If the TFJob is terminated, delete all pods and services.
-	if isSucceeded(tfjob.Status) || isFailed(tfjob.Status) {
+	if isSucceeded(tfjob.Status.JobStatus) || isFailed(tfjob.Status.JobStatus) {
+		if delay := tc.cleanupDelay(tfjob); delay > 0 {
+			// Spread the deletions of the tfjobs which completed together.
+			// The cleanup, the hook and the TTL deletion are all postponed.
+			tc.WorkQueue.AddAfter(tfjobKey, delay)
+			return nil
+		}
 		if err := tc.deletePodsAndServices(tfjob, pods); err != nil {
 			return err
 		}
 
+		if err := tc.reconcileHook(tfjob); err != nil {
+			return err
+		}
+
 		if err := tc.cleanupTFJob(tfjob); err != nil {
 			return err
 		}
@@ -368,11 +1123,12 @@ func (tc *TFController) reconcileTFJobs(tfjob *tfv1.TFJob) error {
 			if err := tc.DeletePodGroup(tfjob); err != nil {
 				return err
 			}
+			tc.auditPodGroupDeleted(tfjob)
 		}
 
 		// At this point the pods may have been deleted, so if the job succeeded, we need to manually set the replica status.
 		// If any replicas are still Active, set their status to succeeded.
-		if isSucceeded(tfjob.Status) {
+		if isSucceeded(tfjob.Status.JobStatus) {
 			for rtype := range tfjob.Status.ReplicaStatuses {
 				tfjob.Status.ReplicaStatuses[rtype].Succeeded += tfjob.Status.ReplicaStatuses[rtype].Active
 				tfjob.Status.ReplicaStatuses[rtype].Active = 0
@@ -381,21 +1137,34 @@ func (tc *TFController) reconcileTFJobs(tfjob *tfv1.TFJob) error {
 		// no need to update the tfjob if the status hasn't changed since last time even the tfjob is not running.
 
 		if !apiequality.Semantic.DeepEqual(*oldStatus, tfjob.Status) {
-			return tc.updateStatusHandler(tfjob)
+			return tc.updateStatus(tfjob, oldStatus)
 		}
 		return nil
 	}
 
+	// Resolve the PodTemplates referenced by the tfjob before its templates
+	// are used.
+	changedPodTemplates, missingPodTemplate, err := tc.resolvePodTemplates(tfjob)
+	if err != nil {
+		return err
+	}
+	tc.setChangedPodTemplates(tfjobKey, changedPodTemplates, missingPodTemplate != "")
+
 	// retrieve the previous number of retry
 	previousRetry := tc.WorkQueue.NumRequeues(tfjobKey)
 
-	activePods := k8sutil.FilterActivePods(pods)
-	active := int32(len(activePods))
-	failed := k8sutil.FilterPodCount(pods, v1.PodFailed)
-	totalReplicas := getTotalReplicas(tfjob)
+	// The failures of the best-effort replicas, and of the replicas with the
+	// Ignore failure policy, do not count against the backoff limit.
+	// Neither do the preemptions when they are exempted.
+	trackedPods := tc.excludePreemptedPods(excludeIgnoredPods(tfjob, pods))
+	activePods := k8sutil.FilterActivePods(trackedPods)
+	active := int64(len(activePods))
+	failed := int64(k8sutil.FilterPodCount(trackedPods, v1.PodFailed))
+	totalReplicas := getTotalReplicas(tfjob) - getTotalIgnoredReplicas(tfjob)
 	prevReplicasFailedNum := getTotalFailedReplicas(tfjob)
 
 	var failureMessage string
+	failureReason := tfJobFailedReason
 	tfJobExceedsLimit := false
 	exceedsBackoffLimit := false
 	pastBackoffLimit := false
@@ -406,7 +1175,7 @@ func (tc *TFController) reconcileTFJobs(tfjob *tfv1.TFJob) error {
 		// is different than parallelism, otherwise the previous controller loop
 		// failed updating status so even if we pick up failure it is not a new one
 		exceedsBackoffLimit = jobHasNewFailure && (active != totalReplicas) &&
-			(int32(previousRetry)+1 > *tfjob.Spec.BackoffLimit)
+			(int64(previousRetry)+1 > int64(*tfjob.Spec.BackoffLimit))
 
 		pastBackoffLimit, err = tc.pastBackoffLimit(tfjob, pods)
 		if err != nil {
@@ -419,9 +1188,23 @@ func (tc *TFController) reconcileTFJobs(tfjob *tfv1.TFJob) error {
 		// OR if the number of failed jobs increased since the last syncJob
 		tfJobExceedsLimit = true
 		failureMessage = fmt.Sprintf("TFJob %s has failed because it has reached the specified backoff limit", tfjob.Name)
+		if pastBackoffLimit {
+			failureReason = tfJobBackoffLimitExceededReason
+			failureMessage = tc.backoffLimitMessage(tfjob, pods)
+		}
 	} else if tc.pastActiveDeadline(tfjob) {
 		failureMessage = fmt.Sprintf("TFJob %s has failed because it was active longer than specified deadline", tfjob.Name)
 		tfJobExceedsLimit = true
+	} else if msg := tc.imagePullFailure(tfjob, pods); msg != "" {
+		failureReason = tfJobImagePullFailedReason
+		failureMessage = msg
+		tfJobExceedsLimit = true
+	}
+
+	if remaining, ok := tc.activeDeadlineRemaining(tfjob); ok && remaining > 0 && !tfJobExceedsLimit {
+		// Fail the tfjob right at its deadline rather than on the next
+		// resync or event.
+		tc.WorkQueue.AddAfter(tfjobKey, remaining)
 	}
 
 	if tfJobExceedsLimit {
@@ -439,76 +1222,261 @@ func (tc *TFController) reconcileTFJobs(tfjob *tfv1.TFJob) error {
 			if err := tc.DeletePodGroup(tfjob); err != nil {
 				return err
 			}
+			tc.auditPodGroupDeleted(tfjob)
 		}
 
-		tc.Recorder.Event(tfjob, v1.EventTypeNormal, tfJobFailedReason, failureMessage)
+		tc.Recorder.Event(tfjob, v1.EventTypeNormal, failureReason, failureMessage)
 		if tfjob.Status.CompletionTime == nil {
 			now := metav1.Now()
 			tfjob.Status.CompletionTime = &now
 		}
 		if err := updateTFJobConditions(
-			tfjob, common.JobFailed, tfJobFailedReason, failureMessage); err != nil {
+			tfjob, common.JobFailed, failureReason, failureMessage); err != nil {
 			tflogger.LoggerForJob(tfjob).Infof("Append tfjob condition error: %v", err)
 			return err
 		}
+	} else if missingPodTemplate != "" && tc.waitForMissingPodTemplate(tfjob, tfjobKey) {
+		// The PodTemplate may be created right after the tfjob, or not be in
+		// the cache yet. Check again later.
+		tc.WorkQueue.AddAfter(tfjobKey, missingPodTemplateRecheckInterval)
+	} else if missingPodTemplate != "" {
+		if err := tc.failWithReason(tfjob, tfJobMissingReferenceReason, missingPodTemplate); err != nil {
+			return err
+		}
+	} else if msg := invalidPodTemplateRefs(tfjob); msg != "" {
+		if err := tc.failInvalidSpec(tfjob, msg); err != nil {
+			return err
+		}
+	} else if msg := tc.invalidChiefAndMaster(tfjob); msg != "" {
+		if err := tc.failInvalidSpec(tfjob, msg); err != nil {
+			return err
+		}
+	} else if msg := tc.invalidReplicaCount(tfjob); msg != "" {
+		if err := tc.failInvalidSpec(tfjob, msg); err != nil {
+			return err
+		}
+	} else if msg := tc.invalidPodCreationRampUp(tfjob); msg != "" {
+		if err := tc.failInvalidSpec(tfjob, msg); err != nil {
+			return err
+		}
+	} else if msg := tc.invalidPodTemplateRestartPolicy(tfjob); msg != "" {
+		if err := tc.failInvalidSpec(tfjob, msg); err != nil {
+			return err
+		}
+	} else if msg := tc.invalidServiceNames(tfjob); msg != "" {
+		if err := tc.failInvalidSpec(tfjob, msg); err != nil {
+			return err
+		}
+	} else if msg := tc.securityContextConflicts(tfjob); msg != "" {
+		if err := tc.failWithReason(tfjob, tfJobSecurityContextConflictReason, msg); err != nil {
+			return err
+		}
 	} else {
+		tc.keepCoordinator(tfjob)
+		admitted, msg, err := tc.admitByGPUQuota(tfjob, pods)
+		if err != nil {
+			return err
+		}
+		updateQueuedCondition(tfjob, admitted, msg)
+		if !admitted {
+			// Check again later whether the quota has freed.
+			tc.WorkQueue.AddAfter(tfjobKey, tc.Config.ReconcilerSyncLoopPeriod.Duration)
+			if !apiequality.Semantic.DeepEqual(*oldStatus, tfjob.Status) {
+				return tc.updateStatus(tfjob, oldStatus)
+			}
+			return nil
+		}
+
 		if tc.Config.EnableGangScheduling {
-			minAvailableReplicas := getTotalReplicas(tfjob)
-			_, err := tc.SyncPodGroup(tfjob, minAvailableReplicas)
+			// The total is bounded by maxReplicas, which fits in an int32.
+			minAvailableReplicas := int32(getTotalReplicas(tfjob))
+			podGroup, err := tc.SyncPodGroup(tfjob, minAvailableReplicas)
+			if err == nil && podGroup != nil {
+				tc.auditPodGroup(tfjob, podGroup.UID, podGroup.Spec.MinMember)
+			}
 			if err != nil {
+				// Keep reconciling, but make the failure visible since
+				// the pods may stay pending without their PodGroup.
+				observeReconcileError(newReconcileError(ErrPodGroupSync, err))
 				logger.Warnf("Sync PodGroup %v: %v", tfjob.Name, err)
+				tc.Recorder.Eventf(tfjob, v1.EventTypeWarning, podGroupSyncFailedReason,
+					"Failed to sync PodGroup %s: %v", jobcontroller.GenPodGroupName(tfjob.Name), err)
 			}
+			updatePodGroupSyncCondition(tfjob, err)
 		}
 
-		// Save the current state of the replicas
-		replicasStatus := make(map[string]v1.PodPhase)
+		if err := tc.syncPodDisruptionBudget(tfjob); err != nil {
+			// The pods are created without their budget, which is only
+			// needed against voluntary disruptions.
+			logger.Warnf("Sync PodDisruptionBudget %v: %v", tfjob.Name, err)
+			tc.Recorder.Eventf(tfjob, v1.EventTypeWarning, podDisruptionBudgetSyncFailedReason,
+				"Failed to sync PodDisruptionBudget %s: %v", tfjob.Name, err)
+		}
 
-		// Diff current active pods/services with replicas.
-		for rtype, spec := range tfjob.Spec.TFReplicaSpecs {
-			err = tc.reconcilePods(tfjob, pods, rtype, spec, replicasStatus)
-			if err != nil {
-				logger.Warnf("reconcilePods error %v", err)
-				return err
-			}
+		// The cluster spec ConfigMap is mounted by the pods to be created.
+		if err := tc.syncClusterSpecConfigMap(tfjob, pods); err != nil {
+			return newReconcileError(ErrPodCreation, err)
+		}
 
-			err = tc.reconcileServices(tfjob, services, rtype, spec)
+		// The services routing to the pods of a previous tfjob of the same
+		// name are handled before the missing pods are created.
+		services, err = tc.handleStaleServiceEndpoints(tfjob, services)
+		if err != nil {
+			return err
+		}
 
-			if err != nil {
-				logger.Warnf("reconcileServices error %v", err)
-				return err
-			}
+		// Diff current active pods/services with replicas.
+		if err := tc.reconcileReplicaTypes(tfjob, podsByType, services); err != nil {
+			return err
+		}
+
+		tc.reportUnschedulablePods(tfjob, pods)
+		if err := tc.recoverNodeFailures(tfjob, pods); err != nil {
+			return err
 		}
 	}
 
 	// no need to update the tfjob if the status hasn't changed since last time.
 	if !apiequality.Semantic.DeepEqual(*oldStatus, tfjob.Status) {
-		return tc.updateStatusHandler(tfjob)
+		return tc.updateStatus(tfjob, oldStatus)
+	}
+	return nil
+}
+
+// reconcileReplicaTypes reconciles the pods and services of the replica types
+// of the tfjob concurrently, so that slow API calls for a type do not delay
+// the others. The pods are keyed by their lower case replica type. The replica
+// statuses are initialized up front and each type only counts its pods in its
+// own status. The conditions are then updated serially once all the types have
+// been reconciled, and the Master replicas of a tfjob which also has a Chief
+// are counted in the status of the Chief.
+func (tc *TFController) reconcileReplicaTypes(tfjob *tfv1.TFJob, podsByType map[string][]*v1.Pod, services []*v1.Service) error {
+	logger := tflogger.LoggerForJob(tfjob)
+
+	rtypes := make([]tfv1.TFReplicaType, 0, len(tfjob.Spec.TFReplicaSpecs))
+	for rtype := range tfjob.Spec.TFReplicaSpecs {
+		rtypes = append(rtypes, rtype)
+		initializeTFReplicaStatuses(tfjob, rtype)
+	}
+	sort.Slice(rtypes, func(i, j int) bool { return rtypes[i] < rtypes[j] })
+	// The specs are looked up before the fan-out, so that the goroutines do
+	// not index the map of the tfjob.
+	specs := make([]*common.ReplicaSpec, len(rtypes))
+	for i, rtype := range rtypes {
+		specs[i] = tfjob.Spec.TFReplicaSpecs[rtype]
+	}
+
+	// The replica types share the pods the ramp-up allows to create.
+	budget := tc.newPodCreationBudget(tfjob)
+	results := make([]*replicaPodsResult, len(rtypes))
+	errs := make([]error, len(rtypes))
+	sem := make(chan struct{}, maxConcurrentReplicaTypes)
+	var wg sync.WaitGroup
+	for i, rtype := range rtypes {
+		wg.Add(1)
+		go func(i int, rtype tfv1.TFReplicaType) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			spec := specs[i]
+			rt := strings.ToLower(string(rtype))
+			if isReleasedAfterTraining(tfjob, rtype) {
+				// The training is over and the evaluator does not need these replicas.
+				results[i] = &replicaPodsResult{released: true}
+				errs[i] = tc.deleteReleasedPods(tfjob, podsByType[rt])
+			} else {
+				podsByIndex := tc.bucketPodsByIndex(tfjob, podsByType[rt], rt, int(*spec.Replicas))
+				results[i], errs[i] = tc.reconcileReplicaPods(tfjob, podsByIndex, rtype, spec, budget)
+			}
+			if errs[i] != nil {
+				logger.Warnf("reconcilePods error %v", errs[i])
+				return
+			}
+			if tc.disableServiceCreation {
+				return
+			}
+			if errs[i] = tc.reconcileServices(tfjob, services, rtype, spec); errs[i] != nil {
+				logger.Warnf("reconcileServices error %v", errs[i])
+			}
+		}(i, rtype)
+	}
+	wg.Wait()
+	for i, rtype := range rtypes {
+		if results[i] != nil {
+			addReplicaRestarts(tfjob, rtype, results[i].restarts)
+			tc.recordReplicaAttempts(tfjob, results[i].recreatedPods)
+			tc.updateRestartBackoffs(tfjob, strings.ToLower(string(rtype)), results[i])
+			tc.recordFirstRunningTime(tfjob, results[i].runningTime)
+		}
+	}
+	tc.finishPodCreationRampUp(tfjob, budget)
+	tc.updatePodRecreationCondition(tfjob)
+	updatePausedCondition(tfjob)
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	// The replica types which do not hold back the success of the tfjob are
+	// updated last, so that they see whether the others made it succeed.
+	for _, ignoredForSuccess := range []bool{false, true} {
+		for i, rtype := range rtypes {
+			if results[i].released || isIgnoredForSuccess(tfjob, rtype) != ignoredForSuccess {
+				continue
+			}
+			if rtype == tfv1.TFReplicaTypeWorker {
+				tfjob.Status.TrainingProgress = results[i].progress
+			}
+			if err := tc.failOnReplicaFailure(tfjob, rtype, results[i].failed); err != nil {
+				return err
+			}
+			if err := tc.failOnPSFailure(tfjob, rtype, results[i].failedPS); err != nil {
+				return err
+			}
+			if err := tc.updateStatusSingle(tfjob, rtype, results[i].replicas, results[i].restart, results[i].worker0Completed); err != nil {
+				return err
+			}
+		}
 	}
+	tc.updateRestartingCondition(tfjob, rtypes, results)
+	foldMasterReplicaStatus(tfjob)
 	return nil
 }
 
-// satisfiedExpectations returns true if the required adds/dels for the given tfjob have been observed.
+// satisfiedExpectations returns the state of the expectations of each key of
+// the given tfjob, sorted by key. The tfjob needs to be synced if the
+// required adds/dels of one of them have been observed.
 // Add/del counts are established by the controller at sync time, and updated as controllees are observed by the controller
 // manager.
-func (tc *TFController) satisfiedExpectations(tfjob *tfv1.TFJob) bool {
-	satisfied := false
+func (tc *TFController) satisfiedExpectations(tfjob *tfv1.TFJob) tfJobExpectations {
 	tfjobKey, err := KeyFunc(tfjob)
 	if err != nil {
 		utilruntime.HandleError(fmt.Errorf("couldn't get key for tfjob object %#v: %v", tfjob, err))
-		return false
+		return nil
 	}
 
+	timestamped, _ := tc.Expectations.(jobcontroller.TimestampedExpectations)
+	var expectations tfJobExpectations
 	for rtype := range tfjob.Spec.TFReplicaSpecs {
-		// Check the expectations of the pods.
-		expectationPodsKey := jobcontroller.GenExpectationPodsKey(tfjobKey, string(rtype))
-		satisfied = satisfied || tc.Expectations.SatisfiedExpectations(expectationPodsKey)
-
-		// Check the expectations of the services.
-		expectationServicesKey := jobcontroller.GenExpectationServicesKey(tfjobKey, string(rtype))
-		satisfied = satisfied || tc.Expectations.SatisfiedExpectations(expectationServicesKey)
+		// Check the expectations of the pods and of the services.
+		for _, exp := range []keyExpectations{
+			{key: jobcontroller.GenExpectationPodsKey(tfjobKey, string(rtype)), resource: expectationsResourcePods},
+			{key: jobcontroller.GenExpectationServicesKey(tfjobKey, string(rtype)), resource: expectationsResourceServices},
+		} {
+			exp.satisfied = tc.Expectations.SatisfiedExpectations(exp.key)
+			if controllee, exists, err := tc.Expectations.GetExpectations(exp.key); err == nil && exists {
+				exp.add, exp.del = controllee.GetExpectations()
+			}
+			if timestamped != nil {
+				exp.since, _ = timestamped.GetExpectationsTimestamp(exp.key)
+			}
+			expectations = append(expectations, exp)
+		}
 	}
-
-	return satisfied
+	sort.Slice(expectations, func(i, j int) bool { return expectations[i].key < expectations[j].key })
+	return expectations
 }
 
 // pastBackoffLimit checks if container restartCounts sum exceeds BackoffLimit
@@ -518,10 +1486,17 @@ func (tc *TFController) pastBackoffLimit(tfjob *tfv1.TFJob, pods []*v1.Pod) (boo
 		return false, nil
 	}
 	logger := tflogger.LoggerForJob(tfjob)
-	result := int32(0)
+	result := int64(0)
 	for rtype, spec := range tfjob.Spec.TFReplicaSpecs {
-		if spec.RestartPolicy != common.RestartPolicyOnFailure && spec.RestartPolicy != common.RestartPolicyAlways {
-			logger.Warnf("The restart policy of replica %v of the job %v is not OnFailure or Always. Not counted in backoff limit.", rtype, tfjob.Name)
+		if ignoresFailures(tfjob, rtype) {
+			continue
+		}
+		// The pods the operator recreated are counted whatever the restart
+		// policy, since the restart counts of their containers are lost.
+		result += int64(tfjob.Status.ReplicaRestarts[rtype])
+		restartPolicy := tc.effectiveRestartPolicy(spec)
+		if restartPolicy != common.RestartPolicyOnFailure && restartPolicy != common.RestartPolicyAlways {
+			logger.Warnf("The restart policy of replica %v of the job %v is not OnFailure or Always. Only its recreated pods are counted in backoff limit.", rtype, tfjob.Name)
 			continue
 		}
 		// Convert TFReplicaType to lower string.
@@ -535,11 +1510,15 @@ func (tc *TFController) pastBackoffLimit(tfjob *tfv1.TFJob, pods []*v1.Pod) (boo
 			if po.Status.Phase == v1.PodRunning || po.Status.Phase == v1.PodPending {
 				for j := range po.Status.InitContainerStatuses {
 					stat := po.Status.InitContainerStatuses[j]
-					result += stat.RestartCount
+					result += int64(stat.RestartCount)
 				}
 				for j := range po.Status.ContainerStatuses {
 					stat := po.Status.ContainerStatuses[j]
-					result += stat.RestartCount
+					// The restarts of the sidecars do not fail the tfjob.
+					if isSidecar(po, stat.Name) {
+						continue
+					}
+					result += int64(stat.RestartCount)
 				}
 			}
 		}
@@ -548,19 +1527,98 @@ func (tc *TFController) pastBackoffLimit(tfjob *tfv1.TFJob, pods []*v1.Pod) (boo
 	if *tfjob.Spec.BackoffLimit == 0 {
 		return result > 0, nil
 	}
-	return result >= *tfjob.Spec.BackoffLimit, nil
+	return result >= int64(*tfjob.Spec.BackoffLimit), nil
+}
+
+// backoffLimitMessage explains why the tfjob is failed by pastBackoffLimit,
+// naming the container which restarted the most. Under the OnFailure and
+// Always restart policies the kubelet restarts the crashing containers in
+// place, e.g. when their liveness probe fails, so their pods never fail and
+// the tfjob would otherwise look running forever.
+func (tc *TFController) backoffLimitMessage(tfjob *tfv1.TFJob, pods []*v1.Pod) string {
+	msg := fmt.Sprintf("TFJob %s has failed because its containers restarted past the backoff limit of %d",
+		tfjob.Name, *tfjob.Spec.BackoffLimit)
+
+	rtypes := make([]tfv1.TFReplicaType, 0, len(tfjob.Spec.TFReplicaSpecs))
+	for rtype := range tfjob.Spec.TFReplicaSpecs {
+		rtypes = append(rtypes, rtype)
+	}
+	sort.Slice(rtypes, func(i, j int) bool { return rtypes[i] < rtypes[j] })
+
+	podsByType := groupPodsByReplicaType(pods)
+	var restartedPod *v1.Pod
+	var restarted *v1.ContainerStatus
+	for _, rtype := range rtypes {
+		restartPolicy := tc.effectiveRestartPolicy(tfjob.Spec.TFReplicaSpecs[rtype])
+		if ignoresFailures(tfjob, rtype) ||
+			restartPolicy != common.RestartPolicyOnFailure && restartPolicy != common.RestartPolicyAlways {
+			continue
+		}
+		for _, pod := range podsByType[strings.ToLower(string(rtype))] {
+			if pod.Status.Phase != v1.PodRunning && pod.Status.Phase != v1.PodPending {
+				continue
+			}
+			for i := range pod.Status.ContainerStatuses {
+				status := &pod.Status.ContainerStatuses[i]
+				if isSidecar(pod, status.Name) {
+					continue
+				}
+				if status.RestartCount > 0 && (restarted == nil || status.RestartCount > restarted.RestartCount) {
+					restartedPod, restarted = pod, status
+				}
+			}
+		}
+	}
+	if restarted == nil {
+		// The pods were recreated by the operator instead.
+		var recreated tfv1.TFReplicaType
+		for _, rtype := range rtypes {
+			if !ignoresFailures(tfjob, rtype) && tfjob.Status.ReplicaRestarts[rtype] > tfjob.Status.ReplicaRestarts[recreated] {
+				recreated = rtype
+			}
+		}
+		if recreated != "" {
+			msg += fmt.Sprintf(": the failed pods of %s were recreated %d times", recreated, tfjob.Status.ReplicaRestarts[recreated])
+		}
+		return msg
+	}
+
+	msg += fmt.Sprintf(": container %s of pod %s restarted %d times", restarted.Name, restartedPod.Name, restarted.RestartCount)
+	if terminated := restarted.LastTerminationState.Terminated; terminated != nil {
+		msg += fmt.Sprintf(", last exited with code %d (%s)", terminated.ExitCode, terminated.Reason)
+	}
+	if waiting := restarted.State.Waiting; waiting != nil && waiting.Reason != "" {
+		msg += fmt.Sprintf(", now %s", waiting.Reason)
+	}
+	return msg
 }
 
 // pastActiveDeadline checks if job has ActiveDeadlineSeconds field set and if it is exceeded.
 func (tc *TFController) pastActiveDeadline(tfjob *tfv1.TFJob) bool {
-	if tfjob.Spec.ActiveDeadlineSeconds == nil || tfjob.Status.StartTime == nil {
-		return false
+	remaining, ok := tc.activeDeadlineRemaining(tfjob)
+	return ok && remaining <= 0
+}
+
+// activeDeadlineRemaining returns the time left until the tfjob is past its
+// ActiveDeadlineSeconds, and false if it has none or its deadline has not
+// started yet.
+func (tc *TFController) activeDeadlineRemaining(tfjob *tfv1.TFJob) (time.Duration, bool) {
+	baseline := activeDeadlineBaseline(tfjob)
+	if tfjob.Spec.ActiveDeadlineSeconds == nil || baseline == nil {
+		return 0, false
 	}
-	now := metav1.Now()
-	start := tfjob.Status.StartTime.Time
-	duration := now.Time.Sub(start)
 	allowedDuration := time.Duration(*tfjob.Spec.ActiveDeadlineSeconds) * time.Second
-	return duration >= allowedDuration
+	return allowedDuration - tc.clock.Since(baseline.Time), true
+}
+
+// activeDeadlineBaseline returns the time the ActiveDeadlineSeconds of the
+// tfjob is measured from according to its DeadlineFrom, or nil if the
+// deadline has not started yet.
+func activeDeadlineBaseline(tfjob *tfv1.TFJob) *metav1.Time {
+	if tfjob.Spec.DeadlineFrom != nil && *tfjob.Spec.DeadlineFrom == tfv1.DeadlineFromFirstRunning {
+		return tfjob.Status.FirstRunningTime
+	}
+	return tfjob.Status.StartTime
 }
 
 func (tc *TFController) GetJobFromInformerCache(namespace, name string) (metav1.Object, error) {
@@ -579,6 +1637,49 @@ func (tc *TFController) GetAPIGroupVersion() schema.GroupVersion {
 	return tfv1.SchemeGroupVersion
 }
 
+// genLabels returns the labels of the pods and services of the tfjob. Besides
+// the labels of GenLabels, the tfjob labels referred to by the job label
+// selector are copied, so that the pod and service informers of an operator
+// shard can be filtered by the same selector.
+func (tc *TFController) genLabels(tfjob *tfv1.TFJob) map[string]string {
+	jobLabels := tc.GenLabels(tfjob.Name)
+	for _, key := range tc.shardLabelKeys() {
+		if value, ok := tfjob.Labels[key]; ok {
+			jobLabels[key] = value
+		}
+	}
+	return jobLabels
+}
+
+// shardLabelKeys returns the keys of the tfjob labels referred to by the job
+// label selector.
+func (tc *TFController) shardLabelKeys() []string {
+	if tc.jobLabelSelector == nil {
+		return nil
+	}
+	requirements, _ := tc.jobLabelSelector.Requirements()
+	keys := make([]string, 0, len(requirements))
+	for _, r := range requirements {
+		keys = append(keys, r.Key())
+	}
+	return keys
+}
+
+// withoutShardLabels returns a copy of the labels without the ones referred
+// to by the job label selector. The selectors of the services leave them out,
+// so that enabling the sharding or relabeling a tfjob does not change which
+// pods the services route to.
+func (tc *TFController) withoutShardLabels(jobLabels map[string]string) map[string]string {
+	filtered := make(map[string]string, len(jobLabels))
+	for key, value := range jobLabels {
+		filtered[key] = value
+	}
+	for _, key := range tc.shardLabelKeys() {
+		delete(filtered, key)
+	}
+	return filtered
+}
+
 func (tc *TFController) GetGroupNameLabelKey() string {
 	return labelGroupName
 }
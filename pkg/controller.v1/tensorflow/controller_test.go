@@ -16,15 +16,21 @@
 package tensorflow
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
 	kubeinformers "k8s.io/client-go/informers"
 	kubeclientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/kubernetes/pkg/controller"
 
 	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
@@ -32,6 +38,7 @@ import (
 	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
 	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
 	tfjobinformers "github.com/kubeflow/tf-operator/pkg/client/informers/externalversions"
+	tfjobinformersv1 "github.com/kubeflow/tf-operator/pkg/client/informers/externalversions/tensorflow/v1"
 	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
 	"github.com/kubeflow/tf-operator/pkg/control"
 )
@@ -400,3 +407,328 @@ func TestRun(t *testing.T) {
 		t.Errorf("Failed to run: %v", err)
 	}
 }
+
+func TestMultiNamespaceController(t *testing.T) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+
+	namespaces := []string{"team-a", "team-b"}
+	tfJobInformers := make(map[string]tfjobinformersv1.TFJobInformer)
+	kubeInformerFactories := make(map[string]kubeinformers.SharedInformerFactory)
+	for _, ns := range namespaces {
+		tfJobInformers[ns] = NewUnstructuredTFJobInformer(config, ns)
+		kubeInformerFactories[ns] = kubeinformers.NewFilteredSharedInformerFactory(kubeClientSet, 0, ns, nil)
+	}
+	tfJobInformerFactory := tfjobinformers.NewSharedInformerFactory(tfJobClientSet, 0)
+	option := options.ServerOption{Namespaces: namespaces}
+	ctr := NewMultiNamespaceTFController(tfJobInformers, kubeClientSet, kubeBatchClientSet, tfJobClientSet, kubeInformerFactories, tfJobInformerFactory, option)
+	fakeRecorder := record.NewFakeRecorder(10)
+	ctr.Recorder = fakeRecorder
+
+	for _, ns := range namespaces {
+		tfJob := testutil.NewTFJobWithNamespace(1, 0, ns)
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+		}
+		if err := ctr.tfJobInformers[ns].GetIndexer().Add(unstructured); err != nil {
+			t.Errorf("Failed to add tfjob to tfJobIndexer: %v", err)
+		}
+		podIndexer := kubeInformerFactories[ns].Core().V1().Pods().Informer().GetIndexer()
+		testutil.SetPodsStatuses(podIndexer, tfJob, testutil.LabelWorker, 0, 1, 0, 0, nil, t)
+
+		if _, err := ctr.getTFJobFromKey(testutil.GetKey(tfJob, t)); err != nil {
+			t.Errorf("Failed to get TFJob %s from the informer of namespace %s: %v", tfJob.Name, ns, err)
+		}
+		pods, err := ctr.PodLister.Pods(ns).List(labels.Everything())
+		if err != nil {
+			t.Errorf("Failed to list pods in namespace %s: %v", ns, err)
+		}
+		if len(pods) != 1 {
+			t.Errorf("Expected 1 pod in namespace %s, got %d", ns, len(pods))
+		}
+	}
+
+	pods, err := ctr.PodLister.List(labels.Everything())
+	if err != nil {
+		t.Errorf("Failed to list pods: %v", err)
+	}
+	if len(pods) != len(namespaces) {
+		t.Errorf("Expected %d pods across namespaces, got %d", len(namespaces), len(pods))
+	}
+
+	// TFJobs outside of the watched namespaces are rejected with a warning event.
+	tfJob := testutil.NewTFJobWithNamespace(1, 0, "team-c")
+	unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	ctr.addTFJob(unstructured)
+	if ctr.WorkQueue.Len() != 0 {
+		t.Errorf("Expected the TFJob outside of the watched namespaces not to be enqueued")
+	}
+	select {
+	case event := <-fakeRecorder.Events:
+		if !strings.Contains(event, namespaceNotWatchedReason) {
+			t.Errorf("Unexpected event %q", event)
+		}
+	default:
+		t.Errorf("Expected a %s event", namespaceNotWatchedReason)
+	}
+}
+
+func TestSyncTFJobOutsideWatchedNamespace(t *testing.T) {
+	ctr, fakePodControl, fakeServiceControl := newErrorsTestController()
+	ctr.watchedNamespaces = sets.NewString("team-a")
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		t.Errorf("Expected the status of the tfjob outside of the watched namespaces not to be updated")
+		return nil
+	}
+
+	// The tfjob is enqueued although it is not watched, e.g. by a stale event.
+	tfJob := testutil.NewTFJobWithNamespace(1, 0, "team-b")
+	unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+		t.Errorf("Failed to add tfjob to tfJobIndexer: %v", err)
+	}
+
+	forget, err := ctr.syncTFJob(testutil.GetKey(tfJob, t))
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !forget {
+		t.Errorf("Expected the tfjob outside of the watched namespaces to be forgotten")
+	}
+	if len(fakePodControl.Templates) != 0 || len(fakeServiceControl.Templates) != 0 {
+		t.Errorf("Expected no pod or service to be created outside of the watched namespaces, got %d pods and %d services",
+			len(fakePodControl.Templates), len(fakeServiceControl.Templates))
+	}
+}
+
+func TestPodGroupSyncFailed(t *testing.T) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare a kube-batch clientset whose requests are all forbidden.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "podgroups are forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: server.URL,
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	option := options.ServerOption{
+		EnableGangScheduling: true,
+		GangSchedulerName:    "volcano",
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, _, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, option)
+	fakePodControl := &controller.FakePodControl{}
+	ctr.PodControl = fakePodControl
+	ctr.ServiceControl = &control.FakeServiceControl{}
+	recorder := record.NewFakeRecorder(10)
+	ctr.Recorder = recorder
+	tfJobIndexer := ctr.tfJobInformer.GetIndexer()
+
+	var actual *tfv1.TFJob
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		actual = tfJob
+		return nil
+	}
+
+	tfJob := testutil.NewTFJob(2, 0)
+	unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	if err := tfJobIndexer.Add(unstructured); err != nil {
+		t.Errorf("Failed to add tfjob to tfJobIndexer: %v", err)
+	}
+
+	if _, err := ctr.syncTFJob(testutil.GetKey(tfJob, t)); err != nil {
+		t.Errorf("Unexpected error when syncing the TFJob: %v", err)
+	}
+	// The reconcile goes on without the PodGroup.
+	if len(fakePodControl.Templates) != 2 {
+		t.Errorf("Expected 2 pod creations, got %d", len(fakePodControl.Templates))
+	}
+	if actual == nil || !testutil.CheckCondition(actual, tfv1.JobPodGroupSyncFailed, podGroupSyncFailedReason) {
+		t.Errorf("Expected a PodGroupSyncFailed condition, got %v", actual)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, podGroupSyncFailedReason) {
+			t.Errorf("Expected a %s event, got %q", podGroupSyncFailedReason, event)
+		}
+	default:
+		t.Errorf("Expected a %s event", podGroupSyncFailedReason)
+	}
+}
+
+func TestReconcileReplicaTypesConcurrently(t *testing.T) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, kubeInformerFactory, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, options.ServerOption{})
+	fakePodControl := &controller.FakePodControl{}
+	ctr.PodControl = fakePodControl
+	fakeServiceControl := &control.FakeServiceControl{}
+	ctr.ServiceControl = fakeServiceControl
+	ctr.Recorder = &record.FakeRecorder{}
+	tfJobIndexer := ctr.tfJobInformer.GetIndexer()
+	podIndexer := kubeInformerFactory.Core().V1().Pods().Informer().GetIndexer()
+
+	var actual *tfv1.TFJob
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		actual = tfJob
+		return nil
+	}
+
+	// A tfjob with all the replica types, whose PS and first workers are running.
+	tfJob := testutil.NewTFJobWithEvaluator(4, 2, 1)
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeChief] = &common.ReplicaSpec{
+		Template: testutil.NewTFReplicaSpecTemplate(),
+	}
+	unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	if err := tfJobIndexer.Add(unstructured); err != nil {
+		t.Errorf("Failed to add tfjob to tfJobIndexer: %v", err)
+	}
+	testutil.SetPodsStatuses(podIndexer, tfJob, testutil.LabelPS, 0, 2, 0, 0, nil, t)
+	testutil.SetPodsStatuses(podIndexer, tfJob, testutil.LabelWorker, 0, 2, 0, 0, nil, t)
+
+	if _, err := ctr.syncTFJob(testutil.GetKey(tfJob, t)); err != nil {
+		t.Errorf("Unexpected error when syncing the TFJob: %v", err)
+	}
+
+	// The chief, the evaluator and the last 2 workers are created.
+	if len(fakePodControl.Templates) != 4 {
+		t.Errorf("Expected 4 pod creations, got %d", len(fakePodControl.Templates))
+	}
+	if len(fakeServiceControl.Templates) != 8 {
+		t.Errorf("Expected 8 service creations, got %d", len(fakeServiceControl.Templates))
+	}
+	// The status is updated once, with the pods of every type.
+	if actual == nil {
+		t.Fatalf("Expected the status to be updated")
+	}
+	expectedActive := map[tfv1.TFReplicaType]int32{
+		tfv1.TFReplicaTypePS:     2,
+		tfv1.TFReplicaTypeWorker: 2,
+		tfv1.TFReplicaTypeChief:  0,
+		tfv1.TFReplicaTypeEval:   0,
+	}
+	for rtype, active := range expectedActive {
+		status := actual.Status.ReplicaStatuses[common.ReplicaType(rtype)]
+		if status == nil || status.Active != active {
+			t.Errorf("Expected %d active %s replicas, got %v", active, rtype, status)
+		}
+	}
+}
+
+func TestReconcilerSyncPeriod(t *testing.T) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+
+	testCases := map[time.Duration]time.Duration{
+		0:               options.DefaultReconcilerSyncPeriod,
+		2 * time.Minute: 2 * time.Minute,
+	}
+	for period, expected := range testCases {
+		option := options.ServerOption{ReconcilerSyncPeriod: period}
+		ctr, _, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, option)
+		if actual := ctr.Config.ReconcilerSyncLoopPeriod.Duration; actual != expected {
+			t.Errorf("Expected a sync period of %v for %v, got %v", expected, period, actual)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+const (
+	// coordinatorScaleDownReason is the warning reason when the replicas of
+	// the coordinator are not scaled down below it.
+	coordinatorScaleDownReason = "CoordinatorScaleDownClamped"
+	// coordinatorChangedReason is the warning reason when the coordinator of
+	// a tfjob is elected again because its replica type was removed.
+	coordinatorChangedReason = "CoordinatorChanged"
+)
+
+// electCoordinator returns the replica elected as the coordinator of the
+// tfjob, in the form of its lower case replica type and index. The Master is
+// preferred over the Chief, which is preferred over worker-0, so that the
+// tfjobs which started with both Master and Chief, before both were
+// rejected, still have a single coordinator. It returns an empty string if
+// the tfjob has none of them.
+func electCoordinator(tfjob *tfv1.TFJob) string {
+	for _, rtype := range []tfv1.TFReplicaType{tfv1.TFReplicaTypeMaster, tfv1.TFReplicaTypeChief, tfv1.TFReplicaTypeWorker} {
+		if _, ok := tfjob.Spec.TFReplicaSpecs[rtype]; ok {
+			return coordinatorName(rtype, 0)
+		}
+	}
+	return ""
+}
+
+// coordinatorName returns the name of the replica as recorded in the tfjob.
+func coordinatorName(rtype tfv1.TFReplicaType, index int) string {
+	return fmt.Sprintf("%s-%d", strings.ToLower(string(rtype)), index)
+}
+
+// parseCoordinator returns the replica type and the index of the recorded
+// coordinator of the tfjob, and false if it is malformed or its replica type
+// is no longer in the spec.
+func parseCoordinator(tfjob *tfv1.TFJob, name string) (tfv1.TFReplicaType, int, bool) {
+	i := strings.LastIndex(name, "-")
+	if i < 0 {
+		return "", 0, false
+	}
+	index, err := strconv.Atoi(name[i+1:])
+	if err != nil || index < 0 {
+		return "", 0, false
+	}
+	for rtype := range tfjob.Spec.TFReplicaSpecs {
+		if strings.EqualFold(string(rtype), name[:i]) {
+			return rtype, index, true
+		}
+	}
+	return "", 0, false
+}
+
+// keepCoordinator records the coordinator of the tfjob the first time it is
+// reconciled, and keeps the replicas of its replica type from being scaled
+// down below it, with a warning event, so that the master does not change
+// for the lifetime of the tfjob. The coordinator is elected again if its
+// replica type was removed.
+func (tc *TFController) keepCoordinator(tfjob *tfv1.TFJob) {
+	recorded, ok := tfjob.Annotations[tfv1.AnnotationCoordinator]
+	if !ok {
+		if elected := electCoordinator(tfjob); elected != "" {
+			if tfjob.Annotations == nil {
+				tfjob.Annotations = make(map[string]string)
+			}
+			tfjob.Annotations[tfv1.AnnotationCoordinator] = elected
+		}
+		return
+	}
+	rtype, index, ok := parseCoordinator(tfjob, recorded)
+	if !ok {
+		elected := electCoordinator(tfjob)
+		msg := fmt.Sprintf("The coordinator %s of TFJob %s is no longer in its spec, %s is elected instead", recorded, tfjob.Name, elected)
+		tflogger.LoggerForJob(tfjob).Warn(msg)
+		tc.Recorder.Event(tfjob, v1.EventTypeWarning, coordinatorChangedReason, msg)
+		if elected == "" {
+			delete(tfjob.Annotations, tfv1.AnnotationCoordinator)
+		} else {
+			tfjob.Annotations[tfv1.AnnotationCoordinator] = elected
+		}
+		return
+	}
+	spec := tfjob.Spec.TFReplicaSpecs[rtype]
+	if spec == nil || spec.Replicas == nil || int(*spec.Replicas) > index {
+		return
+	}
+	replicas := int32(index + 1)
+	tc.Recorder.Eventf(tfjob, v1.EventTypeWarning, coordinatorScaleDownReason,
+		"TFJob %s keeps %d %s replica(s) instead of %d, as %s is its coordinator", tfjob.Name, replicas, rtype, *spec.Replicas, recorded)
+	spec.Replicas = &replicas
+}
+
+// isCoordinator returns true if the replica is the coordinator of the tfjob,
+// whose pod has the master role.
+func isCoordinator(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType, index int) bool {
+	coordinator, ok := tfjob.Annotations[tfv1.AnnotationCoordinator]
+	if !ok {
+		coordinator = electCoordinator(tfjob)
+	}
+	return coordinator == coordinatorName(rtype, index)
+}
+
+// leaderReplicaType returns the replica type of the coordinator of the tfjob,
+// the recorded one or else the elected one, whose replicas complete the
+// tfjob. It returns an empty string if the tfjob has no coordinator.
+func leaderReplicaType(tfjob *tfv1.TFJob) tfv1.TFReplicaType {
+	coordinator, ok := tfjob.Annotations[tfv1.AnnotationCoordinator]
+	if !ok {
+		coordinator = electCoordinator(tfjob)
+	}
+	rtype, _, ok := parseCoordinator(tfjob, coordinator)
+	if !ok {
+		return ""
+	}
+	return rtype
+}
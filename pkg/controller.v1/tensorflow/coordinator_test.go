@@ -0,0 +1,151 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func TestKeepCoordinator(t *testing.T) {
+	type testCase struct {
+		description string
+		tfJob       *tfv1.TFJob
+		// recorded is the coordinator recorded before the reconcile, if any.
+		recorded string
+		// runningWorkers are the indexes of the running worker pods.
+		runningWorkers      []int
+		expectedCoordinator string
+		// expectedMasterPods are the names of the pods created with the
+		// master role.
+		expectedMasterPods []string
+		expectedWorkerPods int
+		expectedEvents     int
+	}
+	testCases := []testCase{
+		{
+			description:         "Worker-0 is elected and recorded without Chief",
+			tfJob:               testutil.NewTFJob(2, 1),
+			expectedCoordinator: "worker-0",
+			expectedMasterPods:  []string{"worker-0"},
+			expectedWorkerPods:  2,
+		},
+		{
+			description:         "The Chief is elected and recorded",
+			tfJob:               testutil.NewTFJobWithChief(2, 1),
+			expectedCoordinator: "chief-0",
+			expectedMasterPods:  []string{"chief-0"},
+			expectedWorkerPods:  2,
+		},
+		{
+			description:         "A scale-down removing worker-0 is clamped",
+			tfJob:               newTFJobWithWorkers(0),
+			recorded:            "worker-0",
+			expectedCoordinator: "worker-0",
+			expectedMasterPods:  []string{"worker-0"},
+			expectedWorkerPods:  1,
+			expectedEvents:      1,
+		},
+		{
+			description:         "The restarted coordinator keeps the master role",
+			tfJob:               testutil.NewTFJob(3, 1),
+			recorded:            "worker-0",
+			runningWorkers:      []int{1, 2},
+			expectedCoordinator: "worker-0",
+			expectedMasterPods:  []string{"worker-0"},
+			expectedWorkerPods:  1,
+		},
+		{
+			description:         "The recorded coordinator is kept when a Chief is added",
+			tfJob:               testutil.NewTFJobWithChief(2, 1),
+			recorded:            "worker-0",
+			expectedCoordinator: "worker-0",
+			expectedMasterPods:  []string{"worker-0"},
+			expectedWorkerPods:  2,
+		},
+		{
+			description:         "Worker-0 is elected when the Chief is removed",
+			tfJob:               testutil.NewTFJob(2, 1),
+			recorded:            "chief-0",
+			expectedCoordinator: "worker-0",
+			expectedMasterPods:  []string{"worker-0"},
+			expectedWorkerPods:  2,
+		},
+	}
+	for _, c := range testCases {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		recorder := record.NewFakeRecorder(10)
+		ctr.Recorder = recorder
+		var actual *tfv1.TFJob
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			actual = tfJob
+			return nil
+		}
+		tfJob := c.tfJob
+		tfv1.SetObjectDefaults_TFJob(tfJob)
+		if c.recorded != "" {
+			tfJob.Annotations = map[string]string{tfv1.AnnotationCoordinator: c.recorded}
+		}
+		for _, index := range c.runningWorkers {
+			if err := ctr.podIndexer.Add(runningPod(testutil.NewPod(tfJob, testutil.LabelWorker, index, t))); err != nil {
+				t.Fatalf("%s: unexpected error when adding the pod: %v", c.description, err)
+			}
+		}
+
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", c.description, err)
+		}
+		if actual == nil {
+			t.Fatalf("%s: expected the status to be updated", c.description)
+		}
+		if coordinator := actual.Annotations[tfv1.AnnotationCoordinator]; coordinator != c.expectedCoordinator {
+			t.Errorf("%s: expected the coordinator %s to be recorded, got %q", c.description, c.expectedCoordinator, coordinator)
+		}
+
+		var masterPods []string
+		workerPods := 0
+		for _, template := range fakePodControl.Templates {
+			rt, index := template.Labels[tfReplicaTypeLabel], template.Labels[tfReplicaIndexLabel]
+			if template.Labels[jobcontroller.JobRoleLabel] == "master" {
+				masterPods = append(masterPods, rt+"-"+index)
+			}
+			if rt == testutil.LabelWorker {
+				workerPods++
+			}
+		}
+		if len(masterPods) != len(c.expectedMasterPods) || (len(masterPods) > 0 && masterPods[0] != c.expectedMasterPods[0]) {
+			t.Errorf("%s: expected the master pods %v, got %v", c.description, c.expectedMasterPods, masterPods)
+		}
+		if workerPods != c.expectedWorkerPods {
+			t.Errorf("%s: expected %d worker pods created, got %d", c.description, c.expectedWorkerPods, workerPods)
+		}
+		if events := countEvents(recorder, coordinatorScaleDownReason); events != c.expectedEvents {
+			t.Errorf("%s: expected %d events, got %d", c.description, c.expectedEvents, events)
+		}
+	}
+}
+
+// newTFJobWithWorkers returns a tfjob with one PS whose Worker replicas are
+// scaled to the given number.
+func newTFJobWithWorkers(worker int32) *tfv1.TFJob {
+	tfJob := testutil.NewTFJob(1, 1)
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Replicas = &worker
+	return tfJob
+}
@@ -0,0 +1,167 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+// dataAccessMountConflictReason is the warning reason when a volume mount of
+// a data access profile is not injected, as the tensorflow container already
+// mounts a volume at its path.
+const dataAccessMountConflictReason = "DataAccessMountConflict"
+
+// dataAccessProfile is the volumes, volume mounts and environment variables
+// injected into the tensorflow container of the pods of the tfjobs labeled
+// with its name, e.g. the projection of the credentials of a bucket. Each key
+// of the data access ConfigMap is the name of a profile holding it in YAML.
+type dataAccessProfile struct {
+	// ReplicaTypes is the replica types whose pods get the injections, all of
+	// them if it is empty.
+	ReplicaTypes []string         `json:"replicaTypes,omitempty"`
+	Volumes      []v1.Volume      `json:"volumes,omitempty"`
+	VolumeMounts []v1.VolumeMount `json:"volumeMounts,omitempty"`
+	Env          []v1.EnvVar      `json:"env,omitempty"`
+}
+
+// appliesTo returns true if the profile is injected into the pods of the
+// replica type.
+func (p dataAccessProfile) appliesTo(rt string) bool {
+	if len(p.ReplicaTypes) == 0 {
+		return true
+	}
+	for _, rtype := range p.ReplicaTypes {
+		if strings.EqualFold(rtype, rt) {
+			return true
+		}
+	}
+	return false
+}
+
+// WatchDataAccess sets the informer of the ConfigMap holding the data access
+// profiles, so that they are updated along with the ConfigMap. The caller is
+// responsible for starting the informer.
+func (tc *TFController) WatchDataAccess(configMapInformer coreinformers.ConfigMapInformer, namespace, name string) {
+	configMapInformer.Informer().AddEventHandler(newConfigMapEventHandler(namespace, name, tc.setDataAccessProfiles, func() {
+		log.Warnf("Data access ConfigMap %s/%s deleted, no data access profiles are injected", namespace, name)
+		tc.dataAccessLock.Lock()
+		defer tc.dataAccessLock.Unlock()
+		tc.dataAccessProfiles = nil
+	}))
+	tc.dataAccessInformerSynced = configMapInformer.Informer().HasSynced
+}
+
+// setDataAccessProfiles sets the data access profiles from the ConfigMap. The
+// previous profiles are kept if one of them cannot be parsed.
+func (tc *TFController) setDataAccessProfiles(configMap *v1.ConfigMap) {
+	profiles, err := parseDataAccessProfiles(configMap)
+	if err != nil {
+		log.Errorf("Failed to parse the data access ConfigMap %s/%s, the previous profiles are kept: %v",
+			configMap.Namespace, configMap.Name, err)
+		return
+	}
+	log.Infof("Data access profiles updated from ConfigMap %s/%s", configMap.Namespace, configMap.Name)
+	tc.dataAccessLock.Lock()
+	defer tc.dataAccessLock.Unlock()
+	tc.dataAccessProfiles = profiles
+}
+
+// parseDataAccessProfiles returns the data access profiles of the ConfigMap
+// keyed by name.
+func parseDataAccessProfiles(configMap *v1.ConfigMap) (map[string]dataAccessProfile, error) {
+	profiles := make(map[string]dataAccessProfile, len(configMap.Data))
+	for name, data := range configMap.Data {
+		var profile dataAccessProfile
+		if err := yaml.Unmarshal([]byte(data), &profile); err != nil {
+			return nil, fmt.Errorf("invalid data access profile %s: %v", name, err)
+		}
+		for _, mount := range profile.VolumeMounts {
+			if !hasVolume(profile.Volumes, mount.Name) {
+				return nil, fmt.Errorf("invalid data access profile %s: volume mount %s refers to no volume of the profile", name, mount.Name)
+			}
+		}
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
+
+// getDataAccessProfile returns the data access profile of the given name.
+func (tc *TFController) getDataAccessProfile(name string) (dataAccessProfile, bool) {
+	tc.dataAccessLock.Lock()
+	defer tc.dataAccessLock.Unlock()
+	profile, ok := tc.dataAccessProfiles[name]
+	return profile, ok
+}
+
+// injectDataAccess injects the data access profile the tfjob is labeled with
+// into the tensorflow container of the pod template, if it applies to the
+// replica type. The volumes and the environment variables the pod template
+// specifies are kept, and a volume mount at a path the tensorflow container
+// already mounts is skipped with a warning event.
+func (tc *TFController) injectDataAccess(podTemplate *v1.PodTemplateSpec, tfjob *tfv1.TFJob, rt string) {
+	name, ok := tfjob.Labels[tc.dataAccessLabel]
+	if !ok || tc.dataAccessLabel == "" {
+		return
+	}
+	profile, ok := tc.getDataAccessProfile(name)
+	if !ok {
+		tflogger.LoggerForReplica(tfjob, rt).Warnf("Data access profile %s not found, it is not injected", name)
+		return
+	}
+	if !profile.appliesTo(rt) {
+		return
+	}
+	var container *v1.Container
+	for i := range podTemplate.Spec.Containers {
+		if podTemplate.Spec.Containers[i].Name == tfv1.DefaultContainerName {
+			container = &podTemplate.Spec.Containers[i]
+			break
+		}
+	}
+	if container == nil {
+		return
+	}
+
+	mounted := make(map[string]bool)
+	for _, mount := range profile.VolumeMounts {
+		if hasVolumeMount(container.VolumeMounts, mount.MountPath) {
+			tc.Recorder.Eventf(tfjob, v1.EventTypeWarning, dataAccessMountConflictReason,
+				"Volume %s of data access profile %s is not mounted into the %s pods, as %s is already mounted",
+				mount.Name, name, rt, mount.MountPath)
+			continue
+		}
+		container.VolumeMounts = append(container.VolumeMounts, *mount.DeepCopy())
+		mounted[mount.Name] = true
+	}
+	for _, volume := range profile.Volumes {
+		if mounted[volume.Name] && !hasVolume(podTemplate.Spec.Volumes, volume.Name) {
+			podTemplate.Spec.Volumes = append(podTemplate.Spec.Volumes, *volume.DeepCopy())
+		}
+	}
+	for _, env := range profile.Env {
+		if !hasEnvVar(container.Env, env.Name) {
+			container.Env = append(container.Env, *env.DeepCopy())
+		}
+	}
+}
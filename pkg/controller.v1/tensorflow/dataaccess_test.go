@@ -0,0 +1,202 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+const testGCSReadOnly = `
+volumes:
+- name: gcs-credentials
+  projected:
+    sources:
+    - secret:
+        name: gcs-readonly
+volumeMounts:
+- name: gcs-credentials
+  mountPath: /var/secrets/gcs
+  readOnly: true
+env:
+- name: GOOGLE_APPLICATION_CREDENTIALS
+  value: /var/secrets/gcs/key.json
+`
+
+const testS3Workers = `
+replicaTypes: [Worker]
+volumes:
+- name: s3-credentials
+  secret:
+    secretName: s3
+volumeMounts:
+- name: s3-credentials
+  mountPath: /var/secrets/s3
+`
+
+func newDataAccessConfigMap(data map[string]string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "data-access", Namespace: "kubeflow"},
+		Data:       data,
+	}
+}
+
+func TestInjectDataAccess(t *testing.T) {
+	userMount := v1.VolumeMount{Name: "user-credentials", MountPath: "/var/secrets/gcs"}
+
+	type testCase struct {
+		description    string
+		profile        string
+		rt             string
+		mounts         []v1.VolumeMount
+		expectedMounts []string
+		expectedEnv    bool
+		expectedEvents int
+	}
+	testCases := []testCase{
+		{
+			description:    "The profile is injected into the tensorflow container",
+			profile:        "gcs-readonly",
+			rt:             "ps",
+			expectedMounts: []string{"gcs-credentials"},
+			expectedEnv:    true,
+		},
+		{
+			description:    "The profile limited to the workers is injected into them",
+			profile:        "s3-workers",
+			rt:             "worker",
+			expectedMounts: []string{"s3-credentials"},
+		},
+		{
+			description: "The profile limited to the workers is not injected into the PS",
+			profile:     "s3-workers",
+			rt:          "ps",
+		},
+		{
+			description:    "A mount at the same path is kept",
+			profile:        "gcs-readonly",
+			rt:             "worker",
+			mounts:         []v1.VolumeMount{userMount},
+			expectedMounts: []string{"user-credentials"},
+			expectedEnv:    true,
+			expectedEvents: 1,
+		},
+		{
+			description: "A missing profile is not injected",
+			profile:     "missing",
+			rt:          "worker",
+		},
+	}
+
+	for _, c := range testCases {
+		ctr, _, _ := newErrorsTestController()
+		recorder := record.NewFakeRecorder(10)
+		ctr.Recorder = recorder
+		ctr.dataAccessLabel = options.DefaultDataAccessLabel
+		ctr.setDataAccessProfiles(newDataAccessConfigMap(map[string]string{
+			"gcs-readonly": testGCSReadOnly,
+			"s3-workers":   testS3Workers,
+		}))
+		tfJob := testutil.NewTFJob(1, 1)
+		tfJob.Labels = map[string]string{options.DefaultDataAccessLabel: c.profile}
+		podTemplate := &v1.PodTemplateSpec{
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{
+					{Name: tfv1.DefaultContainerName, VolumeMounts: c.mounts},
+					{Name: "sidecar"},
+				},
+			},
+		}
+
+		ctr.injectDataAccess(podTemplate, tfJob, c.rt)
+		var mounts []string
+		for _, mount := range podTemplate.Spec.Containers[0].VolumeMounts {
+			mounts = append(mounts, mount.Name)
+		}
+		if len(mounts) != len(c.expectedMounts) || (len(mounts) > 0 && mounts[0] != c.expectedMounts[0]) {
+			t.Errorf("%s: expected the volume mounts %v, got %v", c.description, c.expectedMounts, mounts)
+		}
+		// Only the volumes of the injected mounts are added.
+		injected := len(mounts) - len(c.mounts)
+		if len(podTemplate.Spec.Volumes) != injected {
+			t.Errorf("%s: expected %d volumes, got %v", c.description, injected, podTemplate.Spec.Volumes)
+		}
+		if env := hasEnvVar(podTemplate.Spec.Containers[0].Env, "GOOGLE_APPLICATION_CREDENTIALS"); env != c.expectedEnv {
+			t.Errorf("%s: expected the credentials env %v, got %v", c.description, c.expectedEnv, env)
+		}
+		if len(podTemplate.Spec.Containers[1].VolumeMounts) != 0 || len(podTemplate.Spec.Containers[1].Env) != 0 {
+			t.Errorf("%s: expected the sidecar to be unchanged, got %v", c.description, podTemplate.Spec.Containers[1])
+		}
+		if events := countEvents(recorder, dataAccessMountConflictReason); events != c.expectedEvents {
+			t.Errorf("%s: expected %d events, got %d", c.description, c.expectedEvents, events)
+		}
+	}
+}
+
+func TestReloadDataAccess(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	ctr.setDataAccessProfiles(newDataAccessConfigMap(map[string]string{"gcs-readonly": testGCSReadOnly}))
+	if _, ok := ctr.getDataAccessProfile("gcs-readonly"); !ok {
+		t.Fatalf("Expected the profile gcs-readonly")
+	}
+
+	// The updated ConfigMap replaces the profiles.
+	ctr.setDataAccessProfiles(newDataAccessConfigMap(map[string]string{"s3-workers": testS3Workers}))
+	if _, ok := ctr.getDataAccessProfile("gcs-readonly"); ok {
+		t.Errorf("Expected the profile gcs-readonly to be removed")
+	}
+	if profile, ok := ctr.getDataAccessProfile("s3-workers"); !ok || !profile.appliesTo("worker") || profile.appliesTo("ps") {
+		t.Errorf("Expected the profile s3-workers limited to the workers, got %v", profile)
+	}
+
+	// An invalid ConfigMap keeps the previous profiles.
+	ctr.setDataAccessProfiles(newDataAccessConfigMap(map[string]string{
+		"dangling": "volumeMounts:\n- name: missing\n  mountPath: /data\n",
+	}))
+	if _, ok := ctr.getDataAccessProfile("s3-workers"); !ok {
+		t.Errorf("Expected the previous profiles to be kept")
+	}
+}
+
+func TestCreatePodWithDataAccess(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+	ctr.dataAccessLabel = options.DefaultDataAccessLabel
+	ctr.setDataAccessProfiles(newDataAccessConfigMap(map[string]string{"s3-workers": testS3Workers}))
+	tfJob := testutil.NewTFJob(1, 1)
+	tfJob.Labels = map[string]string{options.DefaultDataAccessLabel: "s3-workers"}
+
+	if err := ctr.reconcileTFJobs(tfJob); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if len(fakePodControl.Templates) != 2 {
+		t.Fatalf("Expected 2 pods, got %d", len(fakePodControl.Templates))
+	}
+	for _, template := range fakePodControl.Templates {
+		injected := hasVolume(template.Spec.Volumes, "s3-credentials")
+		if expected := template.Labels[tfReplicaTypeLabel] == testutil.LabelWorker; injected != expected {
+			t.Errorf("Expected the %s pod to be injected %v, got %v", template.Labels[tfReplicaTypeLabel], expected, injected)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The categories of the errors returned by the reconcile paths of a tfjob.
+// A ReconcileError matches its category with errors.Is.
+var (
+	ErrPodCreation     = errors.New("pod creation failed")
+	ErrServiceCreation = errors.New("service creation failed")
+	ErrStatusUpdate    = errors.New("status update failed")
+	ErrPodGroupSync    = errors.New("pod group sync failed")
+)
+
+// ErrTransient and ErrPermanent tell whether retrying the sync of the tfjob
+// may help. Every ReconcileError matches exactly one of them with errors.Is.
+// Errors which are not ReconcileErrors are treated as transient.
+var (
+	ErrTransient = errors.New("transient error")
+	ErrPermanent = errors.New("permanent error")
+)
+
+// errorCategoryLabels maps the error categories to their metric label.
+var errorCategoryLabels = map[error]string{
+	ErrPodCreation:     "PodCreation",
+	ErrServiceCreation: "ServiceCreation",
+	ErrStatusUpdate:    "StatusUpdate",
+	ErrPodGroupSync:    "PodGroupSync",
+}
+
+// unknownErrorCategory is the metric label of the errors without a category.
+const unknownErrorCategory = "Unknown"
+
+var reconcileErrorsCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "tf_operator_reconcile_errors_total",
+	Help: "Counts number of errors while reconciling tfjobs, by category",
+}, []string{"category"})
+
+// ReconcileError is an error of a reconcile step of a tfjob, wrapping the
+// error which caused it.
+type ReconcileError struct {
+	// Category is the sentinel of the failed step, such as ErrPodCreation.
+	Category error
+	// Permanent is true if retrying the step cannot succeed.
+	Permanent bool
+	// Err is the cause of the error.
+	Err error
+}
+
+func (e *ReconcileError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Category, e.Err)
+}
+
+func (e *ReconcileError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the category of the error, and ErrPermanent or ErrTransient.
+func (e *ReconcileError) Is(target error) bool {
+	switch target {
+	case e.Category:
+		return true
+	case ErrPermanent:
+		return e.Permanent
+	case ErrTransient:
+		return !e.Permanent
+	}
+	return false
+}
+
+// newReconcileError wraps err in a ReconcileError of the given category. The
+// error is permanent if it is marked so with ErrPermanent or if the API
+// server rejected the request as invalid. It returns nil if err is nil.
+func newReconcileError(category, err error) error {
+	if err == nil {
+		return nil
+	}
+	var rerr *ReconcileError
+	if errors.As(err, &rerr) {
+		// The error has already been categorized by a nested step.
+		return err
+	}
+	return &ReconcileError{
+		Category:  category,
+		Permanent: isPermanentError(err),
+		Err:       err,
+	}
+}
+
+// isPermanentError returns true if retrying the request which failed with err
+// cannot succeed.
+func isPermanentError(err error) bool {
+	if errors.Is(err, ErrPermanent) {
+		return true
+	}
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		return false
+	}
+	switch status.Status().Reason {
+	case metav1.StatusReasonInvalid, metav1.StatusReasonBadRequest:
+		return true
+	}
+	return false
+}
+
+// errorCategory returns the metric label of the category of err.
+func errorCategory(err error) string {
+	var rerr *ReconcileError
+	if errors.As(err, &rerr) {
+		if label, ok := errorCategoryLabels[rerr.Category]; ok {
+			return label
+		}
+	}
+	return unknownErrorCategory
+}
+
+// observeReconcileError counts err in the reconcile errors metric.
+func observeReconcileError(err error) {
+	reconcileErrorsCount.WithLabelValues(errorCategory(err)).Inc()
+}
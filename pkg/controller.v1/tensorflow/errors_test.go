@@ -0,0 +1,187 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	kubeclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/kubernetes/pkg/controller"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
+)
+
+func newErrorsTestController() (*TFController, *controller.FakePodControl, *control.FakeServiceControl) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, _, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, options.ServerOption{})
+	fakePodControl := &controller.FakePodControl{}
+	ctr.PodControl = fakePodControl
+	fakeServiceControl := &control.FakeServiceControl{}
+	ctr.ServiceControl = fakeServiceControl
+	ctr.Recorder = &record.FakeRecorder{}
+	return ctr, fakePodControl, fakeServiceControl
+}
+
+func TestReconcileErrorCategories(t *testing.T) {
+	invalid := apierrors.NewInvalid(schema.GroupKind{Kind: "Pod"}, "worker-0",
+		field.ErrorList{field.Required(field.NewPath("spec"), "")})
+	transient := fmt.Errorf("fake error")
+
+	type testCase struct {
+		description string
+		reconcile   func(*TFController, *controller.FakePodControl, *control.FakeServiceControl, *tfv1.TFJob) error
+		category    error
+		permanent   bool
+	}
+	reconcilePods := func(cause error) func(*TFController, *controller.FakePodControl, *control.FakeServiceControl, *tfv1.TFJob) error {
+		return func(ctr *TFController, podControl *controller.FakePodControl, _ *control.FakeServiceControl, tfJob *tfv1.TFJob) error {
+			podControl.Err = cause
+			return ctr.reconcileReplicaTypes(tfJob, nil, nil)
+		}
+	}
+	testCases := []testCase{
+		{
+			description: "A failed pod creation is transient",
+			reconcile:   reconcilePods(transient),
+			category:    ErrPodCreation,
+		},
+		{
+			description: "An invalid pod is permanent",
+			reconcile:   reconcilePods(invalid),
+			category:    ErrPodCreation,
+			permanent:   true,
+		},
+		{
+			description: "A relative TF_CONFIG path is permanent",
+			reconcile: func(ctr *TFController, _ *controller.FakePodControl, _ *control.FakeServiceControl, tfJob *tfv1.TFJob) error {
+				tfJob.Annotations = map[string]string{tfv1.AnnotationTFConfigPath: "tf-config.json"}
+				return ctr.reconcileReplicaTypes(tfJob, nil, nil)
+			},
+			category:  ErrPodCreation,
+			permanent: true,
+		},
+		{
+			description: "A failed service creation is transient",
+			reconcile: func(ctr *TFController, _ *controller.FakePodControl, serviceControl *control.FakeServiceControl, tfJob *tfv1.TFJob) error {
+				serviceControl.Err = transient
+				return ctr.reconcileServices(tfJob, nil, tfv1.TFReplicaTypeWorker, tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker])
+			},
+			category: ErrServiceCreation,
+		},
+		{
+			description: "A failed status update is transient",
+			reconcile: func(ctr *TFController, _ *controller.FakePodControl, _ *control.FakeServiceControl, tfJob *tfv1.TFJob) error {
+				ctr.updateStatusHandler = func(*tfv1.TFJob) error {
+					return apierrors.NewConflict(schema.GroupResource{Resource: tfv1.Plural}, tfJob.Name, transient)
+				}
+				return ctr.updateStatus(tfJob, tfJob.Status.DeepCopy())
+			},
+			category: ErrStatusUpdate,
+		},
+	}
+	for _, c := range testCases {
+		ctr, fakePodControl, fakeServiceControl := newErrorsTestController()
+		tfJob := testutil.NewTFJob(2, 1)
+		err := c.reconcile(ctr, fakePodControl, fakeServiceControl, tfJob)
+		if !errors.Is(err, c.category) {
+			t.Errorf("%s: expected an error of category %v, got %v", c.description, c.category, err)
+		}
+		if errors.Is(err, ErrPermanent) != c.permanent || errors.Is(err, ErrTransient) == c.permanent {
+			t.Errorf("%s: expected a permanent error %v, got %v", c.description, c.permanent, err)
+		}
+	}
+}
+
+func TestPermanentErrorIsNotRequeued(t *testing.T) {
+	for _, permanent := range []bool{false, true} {
+		ctr, _, _ := newErrorsTestController()
+		defer ctr.WorkQueue.ShutDown()
+		tfJob := testutil.NewTFJob(1, 0)
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+		}
+		if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+			t.Errorf("Failed to add tfjob to tfJobIndexer: %v", err)
+		}
+
+		ctr.syncHandler = func(string) (bool, error) {
+			return false, &ReconcileError{Category: ErrPodCreation, Permanent: permanent, Err: fmt.Errorf("fake error")}
+		}
+		var actual *tfv1.TFJob
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			actual = tfJob
+			return nil
+		}
+
+		key := testutil.GetKey(tfJob, t)
+		ctr.WorkQueue.Add(key)
+		ctr.processNextWorkItem()
+
+		if permanent {
+			if requeues := ctr.WorkQueue.NumRequeues(key); requeues != 0 {
+				t.Errorf("Expected the permanent error to be forgotten, got %d requeues", requeues)
+			}
+			if actual == nil || !testutil.CheckCondition(actual, common.JobFailed, tfJobInvalidSpecReason) {
+				t.Errorf("Expected the permanent error to fail the tfjob, got %v", actual)
+			}
+		} else {
+			if requeues := ctr.WorkQueue.NumRequeues(key); requeues != 1 {
+				t.Errorf("Expected the transient error to be retried, got %d requeues", requeues)
+			}
+			if actual != nil {
+				t.Errorf("Expected the status of the tfjob not to be updated, got %v", actual.Status)
+			}
+		}
+	}
+}
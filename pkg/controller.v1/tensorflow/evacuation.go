@@ -0,0 +1,98 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// podEvacuatedReason is the reason of the event emitted when a pod is
+// deleted to be recreated away from its node.
+const podEvacuatedReason = "PodEvacuated"
+
+// nodeNameField is the field of the nodes their name is selected by.
+const nodeNameField = "metadata.name"
+
+// evacuatedNodes returns the names of the nodes listed in the
+// AnnotationEvacuateNodes of the tfjob.
+func evacuatedNodes(tfjob *tfv1.TFJob) sets.String {
+	nodes := sets.NewString()
+	for _, name := range strings.Split(tfjob.Annotations[tfv1.AnnotationEvacuateNodes], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			nodes.Insert(name)
+		}
+	}
+	return nodes
+}
+
+// evacuationMessage returns why the active pod of the tfjob is evacuated from
+// its node, or "" if it is not. The terminated pods are kept, so that the
+// replicas which completed are not run again.
+func evacuationMessage(tfjob *tfv1.TFJob, pod *v1.Pod) string {
+	if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil ||
+		(pod.Status.Phase != v1.PodPending && pod.Status.Phase != v1.PodRunning) {
+		return ""
+	}
+	if pod.Annotations[tfv1.AnnotationEvacuate] == "true" {
+		return fmt.Sprintf("Evacuating pod %s/%s annotated with %s from node %q",
+			pod.Namespace, pod.Name, tfv1.AnnotationEvacuate, pod.Spec.NodeName)
+	}
+	if evacuatedNodes(tfjob).Has(pod.Spec.NodeName) {
+		return fmt.Sprintf("Evacuating pod %s/%s from node %q listed in %s",
+			pod.Namespace, pod.Name, pod.Spec.NodeName, tfv1.AnnotationEvacuateNodes)
+	}
+	return ""
+}
+
+// setEvacuatedNodesAffinity adds a required node affinity which keeps the pod
+// off the nodes the tfjob is evacuated from. The requirement is added to each
+// node selector term of the affinity set by the user, since the terms are
+// ORed. The endpoints of TF_CONFIG are the services of the replicas, so the
+// recreated pods do not change them.
+func setEvacuatedNodesAffinity(podTemplateSpec *v1.PodTemplateSpec, tfjob *tfv1.TFJob) {
+	nodes := evacuatedNodes(tfjob)
+	if nodes.Len() == 0 {
+		return
+	}
+	requirement := v1.NodeSelectorRequirement{
+		Key:      nodeNameField,
+		Operator: v1.NodeSelectorOpNotIn,
+		Values:   nodes.List(),
+	}
+	if podTemplateSpec.Spec.Affinity == nil {
+		podTemplateSpec.Spec.Affinity = &v1.Affinity{}
+	}
+	if podTemplateSpec.Spec.Affinity.NodeAffinity == nil {
+		podTemplateSpec.Spec.Affinity.NodeAffinity = &v1.NodeAffinity{}
+	}
+	affinity := podTemplateSpec.Spec.Affinity.NodeAffinity
+	if affinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		affinity.RequiredDuringSchedulingIgnoredDuringExecution = &v1.NodeSelector{}
+	}
+	selector := affinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(selector.NodeSelectorTerms) == 0 {
+		selector.NodeSelectorTerms = []v1.NodeSelectorTerm{{}}
+	}
+	for i := range selector.NodeSelectorTerms {
+		term := &selector.NodeSelectorTerms[i]
+		term.MatchFields = append(term.MatchFields, requirement)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func TestEvacuatePods(t *testing.T) {
+	type testCase struct {
+		description     string
+		jobAnnotation   string
+		podAnnotation   string
+		phase           v1.PodPhase
+		expectedDeleted bool
+	}
+	testCases := []testCase{
+		{"The pods are kept by default", "", "", v1.PodRunning, false},
+		{"The pod on a listed node is evacuated", "node-b, node-a", "", v1.PodRunning, true},
+		{"The pending pod on a listed node is evacuated", "node-a", "", v1.PodPending, true},
+		{"The succeeded pod on a listed node is kept", "node-a", "", v1.PodSucceeded, false},
+		{"The pods on the other nodes are kept", "node-b", "", v1.PodRunning, false},
+		{"The annotated pod is evacuated", "", "true", v1.PodRunning, true},
+	}
+	for _, c := range testCases {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		tfJob := testutil.NewTFJob(1, 0)
+		if c.jobAnnotation != "" {
+			tfJob.Annotations = map[string]string{tfv1.AnnotationEvacuateNodes: c.jobAnnotation}
+		}
+		pod := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+		pod.Spec.NodeName = "node-a"
+		pod.Status.Phase = c.phase
+		if c.podAnnotation != "" {
+			pod.Annotations = map[string]string{tfv1.AnnotationEvacuate: c.podAnnotation}
+		}
+		if err := ctr.reconcileReplicaTypes(tfJob, map[string][]*v1.Pod{testutil.LabelWorker: {pod}}, nil); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling pods: %v", c.description, err)
+		}
+		if deleted := len(fakePodControl.DeletePodName) == 1; deleted != c.expectedDeleted {
+			t.Errorf("%s: expected the pod deleted %v, got %v", c.description, c.expectedDeleted, fakePodControl.DeletePodName)
+		}
+		if len(fakePodControl.Templates) != 0 {
+			t.Errorf("%s: expected the pod to be recreated once its deletion is observed, got %d pods created",
+				c.description, len(fakePodControl.Templates))
+		}
+		if restarts := tfJob.Status.ReplicaRestarts[tfv1.TFReplicaTypeWorker]; restarts != 0 {
+			t.Errorf("%s: expected no restarts recorded, got %d", c.description, restarts)
+		}
+	}
+}
+
+func TestSetEvacuatedNodesAffinity(t *testing.T) {
+	tfJob := testutil.NewTFJob(1, 0)
+	tfJob.Annotations = map[string]string{tfv1.AnnotationEvacuateNodes: "node-b,node-a"}
+	excluded := v1.NodeSelectorRequirement{
+		Key:      nodeNameField,
+		Operator: v1.NodeSelectorOpNotIn,
+		Values:   []string{"node-a", "node-b"},
+	}
+	zone := v1.NodeSelectorRequirement{
+		Key:      "zone",
+		Operator: v1.NodeSelectorOpIn,
+		Values:   []string{"a"},
+	}
+
+	podTemplate := &v1.PodTemplateSpec{}
+	setEvacuatedNodesAffinity(podTemplate, tfJob)
+	expected := []v1.NodeSelectorTerm{{MatchFields: []v1.NodeSelectorRequirement{excluded}}}
+	if actual := podTemplate.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected the node selector terms %v, got %v", expected, actual)
+	}
+
+	// The nodes are excluded from each of the terms of the user.
+	podTemplate = &v1.PodTemplateSpec{Spec: v1.PodSpec{Affinity: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{
+			{MatchExpressions: []v1.NodeSelectorRequirement{zone}},
+			{MatchFields: []v1.NodeSelectorRequirement{{Key: nodeNameField, Operator: v1.NodeSelectorOpIn, Values: []string{"node-c"}}}},
+		}},
+	}}}}
+	setEvacuatedNodesAffinity(podTemplate, tfJob)
+	for i, term := range podTemplate.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		if last := term.MatchFields[len(term.MatchFields)-1]; !reflect.DeepEqual(last, excluded) {
+			t.Errorf("Expected the term %d to exclude the nodes, got %v", i, term)
+		}
+	}
+
+	// The affinity is left unset without evacuated nodes.
+	podTemplate = &v1.PodTemplateSpec{}
+	setEvacuatedNodesAffinity(podTemplate, testutil.NewTFJob(1, 0))
+	if podTemplate.Spec.Affinity != nil {
+		t.Errorf("Expected no affinity, got %v", podTemplate.Spec.Affinity)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+// evaluatorStartsAfterTraining returns true if the evaluator of the tfjob is
+// only started once the training replicas have succeeded.
+func evaluatorStartsAfterTraining(tfjob *tfv1.TFJob) bool {
+	if tfjob.Spec.EvaluatorPolicy == nil ||
+		tfjob.Spec.EvaluatorPolicy.StartPolicy != tfv1.StartPolicyAfterTraining {
+		return false
+	}
+	_, ok := tfjob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeEval]
+	return ok
+}
+
+// isIgnoredForSuccess returns true if the replicas of the given type do not
+// hold back the success of the tfjob, i.e. the Evaluator replicas running
+// concurrently with the training and the best-effort replicas. The tfjob
+// succeeds without waiting for them, and their pods still running are deleted
+// when it does. An Evaluator which starts after training completes the tfjob
+// instead.
+func isIgnoredForSuccess(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType) bool {
+	return isBestEffort(tfjob, rtype) || tfv1.IsEvaluator(rtype) && !evaluatorStartsAfterTraining(tfjob)
+}
+
+// isIgnoredForSuccessPod returns true if the pod is a replica which does not
+// hold back the success of the tfjob.
+func isIgnoredForSuccessPod(tfjob *tfv1.TFJob, pod *v1.Pod) bool {
+	for rtype := range tfjob.Spec.TFReplicaSpecs {
+		if strings.ToLower(string(rtype)) == pod.Labels[tfReplicaTypeLabel] {
+			return isIgnoredForSuccess(tfjob, rtype)
+		}
+	}
+	return false
+}
+
+// isTrainingSucceeded returns true if the training replicas of a tfjob whose
+// evaluator starts after training have succeeded.
+func isTrainingSucceeded(status common.JobStatus) bool {
+	return hasCondition(status, tfv1.JobTrainingSucceeded)
+}
+
+// isWaitingForTraining returns true if the pods of the given type must not be
+// created until the training has succeeded.
+func isWaitingForTraining(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType) bool {
+	return tfv1.IsEvaluator(rtype) && evaluatorStartsAfterTraining(tfjob) &&
+		!isTrainingSucceeded(tfjob.Status.JobStatus)
+}
+
+// isReleasedAfterTraining returns true if the replicas of the given type are
+// no longer needed once the training has succeeded, i.e. the PS replicas
+// when the evaluator does not keep them.
+func isReleasedAfterTraining(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType) bool {
+	if rtype != tfv1.TFReplicaTypePS || !evaluatorStartsAfterTraining(tfjob) ||
+		!isTrainingSucceeded(tfjob.Status.JobStatus) {
+		return false
+	}
+	keepPS := tfjob.Spec.EvaluatorPolicy.KeepPS
+	return keepPS == nil || !*keepPS
+}
+
+// deleteReleasedPods deletes the pods of a replica type which is no longer
+// needed by the evaluator.
+func (tc *TFController) deleteReleasedPods(tfjob *tfv1.TFJob, pods []*v1.Pod) error {
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		tflogger.LoggerForJob(tfjob).Infof("Deleting pod %s/%s which is not needed by the evaluator",
+			pod.Namespace, pod.Name)
+		if err := tc.deletePod(tfjob, pod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
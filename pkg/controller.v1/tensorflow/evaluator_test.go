@@ -0,0 +1,235 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+	"testing"
+
+	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
+	v1 "k8s.io/api/core/v1"
+	kubeclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/kubernetes/pkg/controller"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
+)
+
+const labelEvaluator = "evaluator"
+
+// evaluatorTestController syncs a tfjob whose evaluator starts after training.
+type evaluatorTestController struct {
+	*TFController
+	fakePodControl *controller.FakePodControl
+	podIndexer     cache.Indexer
+	tfJob          *tfv1.TFJob
+}
+
+func newEvaluatorTestController(t *testing.T) *evaluatorTestController {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, kubeInformerFactory, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, options.ServerOption{})
+	tc := &evaluatorTestController{
+		TFController:   ctr,
+		fakePodControl: &controller.FakePodControl{},
+		podIndexer:     kubeInformerFactory.Core().V1().Pods().Informer().GetIndexer(),
+	}
+	ctr.PodControl = tc.fakePodControl
+	ctr.ServiceControl = &control.FakeServiceControl{}
+	ctr.Recorder = &record.FakeRecorder{}
+	tfJobIndexer := ctr.tfJobInformer.GetIndexer()
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		tc.tfJob = tfJob
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			return err
+		}
+		return tfJobIndexer.Update(unstructured)
+	}
+
+	tfJob := testutil.NewTFJobWithEvaluator(1, 1, 1)
+	tfJob.Spec.EvaluatorPolicy = &tfv1.EvaluatorPolicy{
+		StartPolicy: tfv1.StartPolicyAfterTraining,
+	}
+	unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	if err := tfJobIndexer.Add(unstructured); err != nil {
+		t.Errorf("Failed to add tfjob to tfJobIndexer: %v", err)
+	}
+	tc.tfJob = tfJob
+	return tc
+}
+
+// sync syncs the tfjob, forgetting the expectations of the previous syncs.
+func (tc *evaluatorTestController) sync(t *testing.T) {
+	key := testutil.GetKey(tc.tfJob, t)
+	tc.deleteExpectations(key)
+	if _, err := tc.syncTFJob(key); err != nil {
+		t.Errorf("Unexpected error when syncing the TFJob: %v", err)
+	}
+}
+
+// setPod adds or updates the pod of the given type and index.
+func (tc *evaluatorTestController) setPod(t *testing.T, typ string, phase v1.PodPhase) {
+	pod := testutil.NewPod(tc.tfJob, typ, 0, t)
+	pod.Status.Phase = phase
+	if err := tc.podIndexer.Update(pod); err != nil {
+		t.Errorf("Unexpected error when setting pod %v", err)
+	}
+}
+
+// createdTypes returns the replica types of the created pods.
+func (tc *evaluatorTestController) createdTypes() []string {
+	var types []string
+	for _, template := range tc.fakePodControl.Templates {
+		types = append(types, template.Labels[tfReplicaTypeLabel])
+	}
+	return types
+}
+
+func TestEvaluatorStartsAfterTraining(t *testing.T) {
+	tc := newEvaluatorTestController(t)
+
+	// The evaluator is not created along with the training replicas.
+	tc.sync(t)
+	if types := strings.Join(tc.createdTypes(), ","); strings.Contains(types, labelEvaluator) {
+		t.Errorf("Expected the evaluator to wait for the training, got pods of types %s", types)
+	}
+
+	// The training succeeds, the evaluator is created and the PS is released.
+	tc.setPod(t, testutil.LabelWorker, v1.PodSucceeded)
+	tc.setPod(t, testutil.LabelPS, v1.PodRunning)
+	tc.sync(t)
+	if !testutil.CheckCondition(tc.tfJob, tfv1.JobTrainingSucceeded, tfJobTrainingSucceededReason) {
+		t.Errorf("Expected a training succeeded condition, got %v", tc.tfJob.Status.Conditions)
+	}
+	if isSucceeded(tc.tfJob.Status.JobStatus) {
+		t.Errorf("Expected the success to wait for the evaluator")
+	}
+	tc.sync(t)
+	if types := strings.Join(tc.createdTypes(), ","); !strings.Contains(types, labelEvaluator) {
+		t.Errorf("Expected the evaluator to be created, got pods of types %s", types)
+	}
+	if deleted := strings.Join(tc.fakePodControl.DeletePodName, ","); !strings.Contains(deleted, testutil.LabelPS+"-0") {
+		t.Errorf("Expected the PS to be deleted, got %s", deleted)
+	}
+
+	// The evaluator completes the tfjob.
+	tc.setPod(t, labelEvaluator, v1.PodSucceeded)
+	tc.sync(t)
+	if !testutil.CheckCondition(tc.tfJob, common.JobSucceeded, tfJobSucceededReason) {
+		t.Errorf("Expected the TFJob to succeed, got %v", tc.tfJob.Status.Conditions)
+	}
+}
+
+func TestEvaluatorFailsAfterTraining(t *testing.T) {
+	tc := newEvaluatorTestController(t)
+	keepPS := true
+	tc.tfJob.Spec.EvaluatorPolicy.KeepPS = &keepPS
+	if err := tc.updateStatusHandler(tc.tfJob); err != nil {
+		t.Errorf("Unexpected error when updating the TFJob: %v", err)
+	}
+
+	tc.setPod(t, testutil.LabelWorker, v1.PodSucceeded)
+	tc.setPod(t, testutil.LabelPS, v1.PodRunning)
+	tc.sync(t)
+	if len(tc.fakePodControl.DeletePodName) != 0 {
+		t.Errorf("Expected the PS to be kept for the evaluator, got deletions %v", tc.fakePodControl.DeletePodName)
+	}
+	tc.setPod(t, labelEvaluator, v1.PodFailed)
+	tc.sync(t)
+	if !testutil.CheckCondition(tc.tfJob, common.JobFailed, tfJobEvaluatorFailedReason) {
+		t.Errorf("Expected the TFJob to fail because of the evaluator, got %v", tc.tfJob.Status.Conditions)
+	}
+}
+
+func TestConcurrentEvaluatorDoesNotBlockSuccess(t *testing.T) {
+	tc := newEvaluatorTestController(t)
+	// A chief, a worker and an evaluator running concurrently which never
+	// exits, whose pods are otherwise kept.
+	tfJob := testutil.NewTFJobWithEvaluator(1, 0, 1)
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeChief] = &common.ReplicaSpec{
+		Template: testutil.NewTFReplicaSpecTemplate(),
+	}
+	policy := common.CleanPodPolicyNone
+	tfJob.Spec.CleanPodPolicy = &policy
+	if err := tc.updateStatusHandler(tfJob); err != nil {
+		t.Fatalf("Unexpected error when updating the TFJob: %v", err)
+	}
+
+	labelChief := strings.ToLower(string(tfv1.TFReplicaTypeChief))
+	for _, typ := range []string{labelChief, testutil.LabelWorker, labelEvaluator} {
+		tc.setPod(t, typ, v1.PodRunning)
+	}
+	tc.sync(t)
+	if !testutil.CheckCondition(tc.tfJob, common.JobRunning, tfJobRunningReason) {
+		t.Errorf("Expected the TFJob to be running, got %v", tc.tfJob.Status.Conditions)
+	}
+
+	// The chief completes the tfjob while the evaluator is still running.
+	tc.setPod(t, labelChief, v1.PodSucceeded)
+	tc.sync(t)
+	if !testutil.CheckCondition(tc.tfJob, common.JobSucceeded, tfJobSucceededReason) {
+		t.Fatalf("Expected the TFJob to succeed without waiting for the evaluator, got %v", tc.tfJob.Status.Conditions)
+	}
+
+	// Only the evaluator pod is deleted, the cleanPodPolicy keeps the others.
+	tc.sync(t)
+	if deleted := tc.fakePodControl.DeletePodName; len(deleted) != 1 || !strings.Contains(deleted[0], labelEvaluator) {
+		t.Errorf("Expected only the evaluator pod to be deleted, got %v", deleted)
+	}
+
+	// The deleted evaluator does not fail the tfjob.
+	tc.setPod(t, labelEvaluator, v1.PodFailed)
+	tc.sync(t)
+	if isFailed(tc.tfJob.Status.JobStatus) || !isSucceeded(tc.tfJob.Status.JobStatus) {
+		t.Errorf("Expected the TFJob to stay succeeded, got %v", tc.tfJob.Status.Conditions)
+	}
+	if status := tc.tfJob.Status.ReplicaStatuses[common.ReplicaType(tfv1.TFReplicaTypeEval)]; status == nil || status.Failed != 0 {
+		t.Errorf("Expected the evaluator not to be counted as failed, got %v", status)
+	}
+}
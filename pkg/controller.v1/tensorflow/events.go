@@ -0,0 +1,102 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"time"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+const (
+	// replicaPodCreatedReason is the normal reason when the first pod of a
+	// replica type is created.
+	replicaPodCreatedReason = "ReplicaPodCreated"
+	// replicasRunningReason is the normal reason when all the replicas of a
+	// replica type are running.
+	replicasRunningReason = "ReplicasRunning"
+	// replicaFailedReason is the warning reason when the pod of a replica
+	// failed.
+	replicaFailedReason = "ReplicaFailed"
+	// replicaRestartedReason is the warning reason when the failed pod of a
+	// replica is restarted.
+	replicaRestartedReason = "ReplicaRestarted"
+)
+
+// replicaEvent is the key of an event emitted on a tfjob, for the events of
+// the same reason about the same object to be deduplicated.
+type replicaEvent struct {
+	reason string
+	// object is the pod or the replica type the event is about.
+	object string
+}
+
+// recordReplicaEvent emits the event on the tfjob, unless an event of the
+// same reason about the same object was emitted within the event dedupe
+// window, so that a crash-looping pod does not flood the events. A window of
+// zero disables the deduplication.
+func (tc *TFController) recordReplicaEvent(tfjob *tfv1.TFJob, eventType, reason, object, messageFmt string, args ...interface{}) {
+	tc.recordEvent(tfjob, replicaEvent{reason, object}, tc.eventDedupeWindow, eventType, messageFmt, args...)
+}
+
+// recordReplicaTransition emits the event on the tfjob the first time the
+// object enters the state of the reason, until forgetReplicaTransition is
+// called when it leaves it.
+func (tc *TFController) recordReplicaTransition(tfjob *tfv1.TFJob, eventType, reason, object, messageFmt string, args ...interface{}) {
+	// The event of a transition is never emitted again until it is forgotten.
+	tc.recordEvent(tfjob, replicaEvent{reason, object}, -1, eventType, messageFmt, args...)
+}
+
+// recordEvent emits the event unless the same one was emitted within the
+// window, forever if it is negative.
+func (tc *TFController) recordEvent(tfjob *tfv1.TFJob, event replicaEvent, window time.Duration, eventType, messageFmt string, args ...interface{}) {
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		tc.Recorder.Eventf(tfjob, eventType, event.reason, messageFmt, args...)
+		return
+	}
+	now := tc.clock.Now()
+	tc.recentEventsLock.Lock()
+	last, ok := tc.recentEvents[key][event]
+	if ok && (window < 0 || now.Sub(last) < window) {
+		tc.recentEventsLock.Unlock()
+		return
+	}
+	if tc.recentEvents[key] == nil {
+		tc.recentEvents[key] = make(map[replicaEvent]time.Time)
+	}
+	tc.recentEvents[key][event] = now
+	tc.recentEventsLock.Unlock()
+	tc.Recorder.Eventf(tfjob, eventType, event.reason, messageFmt, args...)
+}
+
+// forgetReplicaTransition forgets that the object entered the state of the
+// reason, so that the event is emitted again when it enters it again.
+func (tc *TFController) forgetReplicaTransition(tfjob *tfv1.TFJob, reason, object string) {
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return
+	}
+	tc.recentEventsLock.Lock()
+	defer tc.recentEventsLock.Unlock()
+	delete(tc.recentEvents[key], replicaEvent{reason, object})
+}
+
+// forgetRecentEvents forgets the events emitted on the tfjob.
+func (tc *TFController) forgetRecentEvents(key string) {
+	tc.recentEventsLock.Lock()
+	defer tc.recentEventsLock.Unlock()
+	delete(tc.recentEvents, key)
+}
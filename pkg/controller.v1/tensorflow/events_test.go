@@ -0,0 +1,108 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/record"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+// replicaEventReasons returns the reasons of the replica events recorded,
+// in order.
+func replicaEventReasons(recorder *record.FakeRecorder) []string {
+	var reasons []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			for _, reason := range []string{replicaPodCreatedReason, replicasRunningReason, replicaFailedReason, replicaRestartedReason, exitedWithCodeReason} {
+				if strings.Contains(event, " "+reason+" ") {
+					reasons = append(reasons, reason)
+				}
+			}
+		default:
+			return reasons
+		}
+	}
+}
+
+func TestReplicaEvents(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	recorder := record.NewFakeRecorder(100)
+	ctr.Recorder = recorder
+	fakeClock := clock.NewFakeClock(time.Now())
+	ctr.clock = fakeClock
+	ctr.eventDedupeWindow = 5 * time.Minute
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+	tfJob := testutil.NewTFJob(2, 0)
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].RestartPolicy = common.RestartPolicyExitCode
+
+	setWorker := func(index int, phase v1.PodPhase, exitCode int32) {
+		pod := testutil.NewPod(tfJob, testutil.LabelWorker, index, t)
+		pod.Spec.NodeName = "node-1"
+		pod.Status.Phase = phase
+		if phase == v1.PodFailed {
+			pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+				Name:  tfv1.DefaultContainerName,
+				State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: exitCode}},
+			}}
+		}
+		if err := ctr.podIndexer.Update(pod); err != nil {
+			t.Fatalf("Unexpected error when updating the pod: %v", err)
+		}
+	}
+	reconcile := func(description string, expected ...string) {
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", description, err)
+		}
+		if reasons := replicaEventReasons(recorder); !reflect.DeepEqual(reasons, expected) {
+			t.Errorf("%s: expected the events %v, got %v", description, expected, reasons)
+		}
+	}
+
+	reconcile("The pods are created", replicaPodCreatedReason)
+
+	setWorker(0, v1.PodRunning, 0)
+	setWorker(1, v1.PodRunning, 0)
+	reconcile("All the replicas are running", replicasRunningReason)
+	reconcile("The replicas keep running")
+
+	setWorker(1, v1.PodFailed, 137)
+	reconcile("A replica failed with a retryable exit code", exitedWithCodeReason, replicaFailedReason, replicaRestartedReason)
+	reconcile("The crash-looping replica is deduplicated")
+
+	fakeClock.Step(5 * time.Minute)
+	reconcile("The replica still fails past the window", exitedWithCodeReason, replicaFailedReason, replicaRestartedReason)
+
+	setWorker(1, v1.PodRunning, 0)
+	reconcile("All the replicas are running again", replicasRunningReason)
+
+	key := testutil.GetKey(tfJob, t)
+	ctr.forgetRecentEvents(key)
+	if _, ok := ctr.recentEvents[key]; ok {
+		t.Errorf("Expected the events of the deleted tfjob to be forgotten")
+	}
+}
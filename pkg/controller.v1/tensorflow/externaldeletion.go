@@ -0,0 +1,310 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+const (
+	// podRecreationPausedReason is the reason when the pods of a replica are
+	// no longer recreated because an external agent keeps deleting them.
+	podRecreationPausedReason = "PodRecreationPaused"
+	// podRecreationResumedReason is the reason when the pods of all the
+	// replicas are recreated again.
+	podRecreationResumedReason = "PodRecreationResumed"
+	// unknownDeleter is the deleter reported when the deleted pods give no
+	// hint of it.
+	unknownDeleter = "unknown"
+)
+
+// externalDeletions tracks the pods of a tfjob deleted by agents other than
+// the operator.
+type externalDeletions struct {
+	// operatorDeleted is the UIDs of the pods the operator deleted, until
+	// their deletion is observed.
+	operatorDeleted sets.String
+	// deleted is the time of the recent external deletions of the pods of
+	// each replica, keyed by replica, e.g. worker-0.
+	deleted map[string][]time.Time
+	// paused is the pause of the recreation of the pods of each replica,
+	// keyed by replica.
+	paused map[string]recreationPause
+}
+
+// recreationPause is the pause of the recreation of the pods of a replica.
+type recreationPause struct {
+	until time.Time
+	// deleter is the suspected external deleter of the pods.
+	deleter string
+}
+
+// genReplicaName returns the name of the replica of the given type, in lower
+// case, and index, e.g. worker-0.
+func genReplicaName(rt, index string) string {
+	return rt + "-" + index
+}
+
+// externalDeletionGuardEnabled returns true if the pods deleted externally
+// are tracked.
+func (tc *TFController) externalDeletionGuardEnabled() bool {
+	return tc.externalDeletionThreshold > 0
+}
+
+// getExternalDeletions returns the external deletions of the tfjob with the
+// given key, creating them if needed. The caller must hold
+// externalDeletionsLock.
+func (tc *TFController) getExternalDeletions(key string) *externalDeletions {
+	deletions, ok := tc.externalDeletions[key]
+	if !ok {
+		deletions = &externalDeletions{
+			operatorDeleted: sets.NewString(),
+			deleted:         make(map[string][]time.Time),
+			paused:          make(map[string]recreationPause),
+		}
+		tc.externalDeletions[key] = deletions
+	}
+	return deletions
+}
+
+// deletePod deletes the pod of the tfjob, remembering that the operator
+// deleted it so that its deletion is not taken for an external one.
+func (tc *TFController) deletePod(tfjob *tfv1.TFJob, pod *v1.Pod) error {
+	if err := tc.trackPodDeletion(tfjob, pod, func() error {
+		return tc.PodControl.DeletePod(pod.Namespace, pod.Name, tfjob)
+	}); err != nil {
+		return err
+	}
+	tc.audit(tfjob, "delete pod %s", pod.Name)
+	return nil
+}
+
+// forceDeletePod force deletes the pod of the tfjob, remembering that the
+// operator deleted it as deletePod does.
+func (tc *TFController) forceDeletePod(tfjob *tfv1.TFJob, pod *v1.Pod) error {
+	if err := tc.trackPodDeletion(tfjob, pod, func() error {
+		return tc.ForceDeleteControl.ForceDeletePod(pod.Namespace, pod.Name, pod.UID, tfjob)
+	}); err != nil {
+		return err
+	}
+	tc.audit(tfjob, "force delete pod %s", pod.Name)
+	return nil
+}
+
+// gracefulDeletePod deletes the pod of the tfjob with the given grace period,
+// remembering that the operator deleted it as deletePod does.
+func (tc *TFController) gracefulDeletePod(tfjob *tfv1.TFJob, pod *v1.Pod, gracePeriodSeconds int64) error {
+	if err := tc.trackPodDeletion(tfjob, pod, func() error {
+		return tc.GracefulDeleteControl.DeletePodWithGracePeriod(pod.Namespace, pod.Name, pod.UID, gracePeriodSeconds, tfjob)
+	}); err != nil {
+		return err
+	}
+	tc.audit(tfjob, "delete pod %s with a grace period of %ds", pod.Name, gracePeriodSeconds)
+	return nil
+}
+
+// trackPodDeletion remembers that the operator deletes the pod of the tfjob
+// with the given function, unless the deletion fails.
+func (tc *TFController) trackPodDeletion(tfjob *tfv1.TFJob, pod *v1.Pod, deleteFunc func() error) error {
+	if !tc.externalDeletionGuardEnabled() {
+		return deleteFunc()
+	}
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return deleteFunc()
+	}
+	uid := string(pod.UID)
+	tc.externalDeletionsLock.Lock()
+	tc.getExternalDeletions(key).operatorDeleted.Insert(uid)
+	tc.externalDeletionsLock.Unlock()
+
+	if err := deleteFunc(); err != nil {
+		tc.externalDeletionsLock.Lock()
+		tc.getExternalDeletions(key).operatorDeleted.Delete(uid)
+		tc.externalDeletionsLock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// handleDeletedPod is the delete handler of the pods. On top of observing
+// the deletion, it tracks the pods of the running tfjobs deleted by another
+// agent than the operator.
+func (tc *TFController) handleDeletedPod(obj interface{}) {
+	tc.JobController.DeletePod(obj)
+	if !tc.externalDeletionGuardEnabled() {
+		return
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
+		}
+		if pod, ok = tombstone.Obj.(*v1.Pod); !ok {
+			return
+		}
+	}
+	tc.observePodDeletion(pod)
+}
+
+// observePodDeletion records the deletion of the pod if an external agent
+// deleted it. Once the pods of a replica have been deleted externally
+// externalDeletionThreshold times within externalDeletionWindow, they are
+// not recreated for externalDeletionBackoff, rather than fighting the agent.
+func (tc *TFController) observePodDeletion(pod *v1.Pod) {
+	controllerRef := metav1.GetControllerOf(pod)
+	if controllerRef == nil || controllerRef.Kind != tfv1.Kind {
+		return
+	}
+	tfjob, err := tc.getTFJobFromName(pod.Namespace, controllerRef.Name)
+	if err != nil || tfjob.UID != controllerRef.UID {
+		return
+	}
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("couldn't get key for tfjob object %#v: %v", tfjob, err))
+		return
+	}
+	rt, index := pod.Labels[tfReplicaTypeLabel], pod.Labels[tfReplicaIndexLabel]
+
+	tc.externalDeletionsLock.Lock()
+	deletions := tc.getExternalDeletions(key)
+	if deletions.operatorDeleted.Has(string(pod.UID)) {
+		deletions.operatorDeleted.Delete(string(pod.UID))
+		tc.externalDeletionsLock.Unlock()
+		return
+	}
+	// The pods of the tfjobs being deleted or done are expected to go away.
+	if tfjob.DeletionTimestamp != nil || isSucceeded(tfjob.Status.JobStatus) || isFailed(tfjob.Status.JobStatus) || rt == "" || index == "" {
+		tc.externalDeletionsLock.Unlock()
+		return
+	}
+	replica := genReplicaName(rt, index)
+	now := tc.clock.Now()
+	var recent []time.Time
+	for _, deleted := range deletions.deleted[replica] {
+		if now.Sub(deleted) < tc.externalDeletionWindow {
+			recent = append(recent, deleted)
+		}
+	}
+	recent = append(recent, now)
+	deletions.deleted[replica] = recent
+	if len(recent) < tc.externalDeletionThreshold {
+		tc.externalDeletionsLock.Unlock()
+		return
+	}
+	pause := recreationPause{until: now.Add(tc.externalDeletionBackoff), deleter: suspectedDeleter(pod)}
+	deletions.paused[replica] = pause
+	delete(deletions.deleted, replica)
+	tc.externalDeletionsLock.Unlock()
+
+	msg := fmt.Sprintf("The pods of %s of TFJob %s were deleted %d times within %v by %s, they are not recreated until %s",
+		replica, tfjob.Name, len(recent), tc.externalDeletionWindow, pause.deleter, pause.until.Format(time.RFC3339))
+	tflogger.LoggerForReplica(tfjob, rt).Warning(msg)
+	tc.Recorder.Event(tfjob, v1.EventTypeWarning, podRecreationPausedReason, msg)
+	tc.WorkQueue.AddAfter(key, tc.externalDeletionBackoff)
+}
+
+// suspectedDeleter returns the agent which likely deleted the pod: the one
+// named by its AnnotationDeletedBy, else the reason of its status, such as
+// Evicted or Preempting.
+func suspectedDeleter(pod *v1.Pod) string {
+	if deleter := pod.Annotations[tfv1.AnnotationDeletedBy]; deleter != "" {
+		return deleter
+	}
+	if pod.Status.Reason != "" {
+		return pod.Status.Reason
+	}
+	return unknownDeleter
+}
+
+// isRecreationPaused returns true if the pods of the replica of the tfjob
+// are not recreated. The pause of a replica ends after the backoff.
+func (tc *TFController) isRecreationPaused(tfjob *tfv1.TFJob, rt, index string) bool {
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return false
+	}
+	replica := genReplicaName(rt, index)
+	tc.externalDeletionsLock.Lock()
+	defer tc.externalDeletionsLock.Unlock()
+	deletions, ok := tc.externalDeletions[key]
+	if !ok {
+		return false
+	}
+	pause, ok := deletions.paused[replica]
+	if !ok {
+		return false
+	}
+	if !tc.clock.Now().Before(pause.until) {
+		delete(deletions.paused, replica)
+		return false
+	}
+	return true
+}
+
+// updatePodRecreationCondition sets the PodRecreationPaused condition of the
+// tfjob while the pods of some of its replicas are not recreated, and clears
+// it once they all are.
+func (tc *TFController) updatePodRecreationCondition(tfjob *tfv1.TFJob) {
+	var paused []string
+	if key, err := KeyFunc(tfjob); err == nil {
+		now := tc.clock.Now()
+		tc.externalDeletionsLock.Lock()
+		if deletions, ok := tc.externalDeletions[key]; ok {
+			for replica, pause := range deletions.paused {
+				if now.Before(pause.until) {
+					paused = append(paused, fmt.Sprintf("%s (deleted by %s, until %s)",
+						replica, pause.deleter, pause.until.Format(time.RFC3339)))
+				}
+			}
+		}
+		tc.externalDeletionsLock.Unlock()
+	}
+
+	if len(paused) > 0 {
+		sort.Strings(paused)
+		msg := fmt.Sprintf("TFJob %s does not recreate the pods of %s, an external agent keeps deleting them.",
+			tfjob.Name, strings.Join(paused, ", "))
+		setCondition(&tfjob.Status.JobStatus, newCondition(tfv1.JobPodRecreationPaused, podRecreationPausedReason, msg))
+		return
+	}
+	if hasCondition(tfjob.Status.JobStatus, tfv1.JobPodRecreationPaused) {
+		msg := fmt.Sprintf("TFJob %s recreates its pods again.", tfjob.Name)
+		condition := newCondition(tfv1.JobPodRecreationPaused, podRecreationResumedReason, msg)
+		condition.Status = v1.ConditionFalse
+		setCondition(&tfjob.Status.JobStatus, condition)
+	}
+}
+
+// forgetExternalDeletions forgets the pods of the tfjob deleted externally.
+func (tc *TFController) forgetExternalDeletions(key string) {
+	tc.externalDeletionsLock.Lock()
+	defer tc.externalDeletionsLock.Unlock()
+	delete(tc.externalDeletions, key)
+}
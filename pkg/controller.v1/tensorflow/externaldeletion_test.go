@@ -0,0 +1,146 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/record"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func TestExternalDeletionGuard(t *testing.T) {
+	testCases := []struct {
+		description string
+		threshold   int
+		// expectPaused is true if worker 0 is expected not to be recreated
+		// after the external deletions.
+		expectPaused bool
+	}{
+		{"The recreation is paused past the threshold", 3, true},
+		{"The guard is disabled", 0, false},
+	}
+
+	for _, tc := range testCases {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		recorder := record.NewFakeRecorder(100)
+		ctr.Recorder = recorder
+		fakeClock := clock.NewFakeClock(time.Now())
+		ctr.clock = fakeClock
+		ctr.externalDeletionThreshold = tc.threshold
+		ctr.externalDeletionWindow = 10 * time.Minute
+		ctr.externalDeletionBackoff = 30 * time.Minute
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			return nil
+		}
+		tfJob := testutil.NewTFJob(2, 0)
+		tfJob.UID = types.UID("tfjob")
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			t.Fatalf("Failed to convert the TFJob to Unstructured: %v", err)
+		}
+		if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+			t.Fatalf("Failed to add tfjob to tfJobIndexer: %v", err)
+		}
+
+		deleted := 0
+		deleteWorker0 := func(external bool) {
+			pod := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+			pod.UID = types.UID(fmt.Sprintf("worker-0-%d", deleted))
+			deleted++
+			if external {
+				pod.Annotations = map[string]string{tfv1.AnnotationDeletedBy: "cleanup-bot"}
+			} else if err := ctr.deletePod(tfJob, pod); err != nil {
+				t.Fatalf("%s: unexpected error when deleting the pod: %v", tc.description, err)
+			}
+			ctr.handleDeletedPod(pod)
+			fakeClock.Step(time.Minute)
+		}
+		// reconcile returns the names of the pods created.
+		reconcile := func() []string {
+			fakePodControl.Clear()
+			if err := ctr.reconcileTFJobs(tfJob); err != nil {
+				t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", tc.description, err)
+			}
+			var created []string
+			for _, template := range fakePodControl.Templates {
+				created = append(created, template.Name)
+			}
+			sort.Strings(created)
+			return created
+		}
+		worker0 := fmt.Sprintf("%s-worker-0", tfJob.Name)
+		worker1 := fmt.Sprintf("%s-worker-1", tfJob.Name)
+
+		// The deletions of the operator and the ones outside of the window
+		// are not counted.
+		deleteWorker0(true)
+		fakeClock.Step(10 * time.Minute)
+		deleteWorker0(false)
+		deleteWorker0(true)
+		deleteWorker0(false)
+		deleteWorker0(true)
+		if created := reconcile(); !reflect.DeepEqual(created, []string{worker0, worker1}) {
+			t.Errorf("%s: expected the pods to be recreated below the threshold, got %v", tc.description, created)
+		}
+
+		deleteWorker0(true)
+		expected := []string{worker0, worker1}
+		if tc.expectPaused {
+			expected = []string{worker1}
+		}
+		if created := reconcile(); !reflect.DeepEqual(created, expected) {
+			t.Errorf("%s: expected the pods %v to be created, got %v", tc.description, expected, created)
+		}
+		condition := getCondition(tfJob.Status.JobStatus, tfv1.JobPodRecreationPaused)
+		if tc.expectPaused {
+			if condition == nil || condition.Status != v1.ConditionTrue || !strings.Contains(condition.Message, "worker-0 (deleted by cleanup-bot") {
+				t.Errorf("%s: expected the recreation of worker 0 to be reported paused, got %v", tc.description, condition)
+			}
+			if count := countEvents(recorder, podRecreationPausedReason); count != 1 {
+				t.Errorf("%s: expected 1 %s event, got %d", tc.description, podRecreationPausedReason, count)
+			}
+		} else if condition != nil {
+			t.Errorf("%s: expected no condition, got %v", tc.description, condition)
+		}
+
+		// The pods are recreated again after the backoff.
+		fakeClock.Step(30 * time.Minute)
+		if created := reconcile(); !reflect.DeepEqual(created, []string{worker0, worker1}) {
+			t.Errorf("%s: expected the pods to be recreated after the backoff, got %v", tc.description, created)
+		}
+		condition = getCondition(tfJob.Status.JobStatus, tfv1.JobPodRecreationPaused)
+		if tc.expectPaused && (condition == nil || condition.Status != v1.ConditionFalse || condition.Reason != podRecreationResumedReason) {
+			t.Errorf("%s: expected the recreation to be reported resumed, got %v", tc.description, condition)
+		}
+
+		key := testutil.GetKey(tfJob, t)
+		ctr.forgetExternalDeletions(key)
+		if _, ok := ctr.externalDeletions[key]; ok {
+			t.Errorf("%s: expected the deletions of the deleted tfjob to be forgotten", tc.description)
+		}
+		ctr.WorkQueue.ShutDown()
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// tfJobReplicaFailedReason is added in a tfjob when it fails because a pod
+// of a replica type with the FailJob failure policy failed.
+const tfJobReplicaFailedReason = "ReplicaTypeFailed"
+
+// failurePolicy returns the failure policy of the replica type, which
+// defaults to Restart.
+func failurePolicy(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType) tfv1.FailurePolicy {
+	if policy, ok := tfjob.Spec.FailurePolicies[rtype]; ok {
+		return policy
+	}
+	return tfv1.FailurePolicyRestart
+}
+
+// ignoresFailures returns true if the failures of the replicas of the given
+// type neither fail nor restart the tfjob, and do not count against its
+// backoff limit.
+func ignoresFailures(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType) bool {
+	return isBestEffort(tfjob, rtype) || failurePolicy(tfjob, rtype) == tfv1.FailurePolicyIgnore
+}
+
+// failOnReplicaFailure fails the tfjob if some pods of a replica type with
+// the FailJob failure policy failed. The failed pods are described by failed.
+func (tc *TFController) failOnReplicaFailure(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType, failed []string) error {
+	if len(failed) == 0 || isFailed(tfjob.Status.JobStatus) {
+		return nil
+	}
+	msg := fmt.Sprintf("TFJob %s has failed because the %s replica(s) %s failed.",
+		tfjob.Name, rtype, strings.Join(failed, ", "))
+	return tc.failWithReason(tfjob, tfJobReplicaFailedReason, msg)
+}
+
+// excludeIgnoredPods returns the pods which are not replicas of the types
+// whose failures are ignored.
+func excludeIgnoredPods(tfjob *tfv1.TFJob, pods []*v1.Pod) []*v1.Pod {
+	ignored := make(map[string]bool)
+	for rtype := range tfjob.Spec.TFReplicaSpecs {
+		if ignoresFailures(tfjob, rtype) {
+			ignored[strings.ToLower(string(rtype))] = true
+		}
+	}
+	if len(ignored) == 0 {
+		return pods
+	}
+	var filtered []*v1.Pod
+	for _, pod := range pods {
+		if !ignored[pod.Labels[tfReplicaTypeLabel]] {
+			filtered = append(filtered, pod)
+		}
+	}
+	return filtered
+}
+
+// getTotalIgnoredReplicas returns the number of replicas of the types whose
+// failures are ignored.
+func getTotalIgnoredReplicas(tfjob *tfv1.TFJob) int64 {
+	total := int64(0)
+	for rtype, spec := range tfjob.Spec.TFReplicaSpecs {
+		if ignoresFailures(tfjob, rtype) && spec.Replicas != nil {
+			total += int64(*spec.Replicas)
+		}
+	}
+	return total
+}
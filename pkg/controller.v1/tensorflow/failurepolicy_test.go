@@ -0,0 +1,116 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func TestFailurePolicy(t *testing.T) {
+	type testCase struct {
+		description     string
+		psPolicy        tfv1.FailurePolicy
+		failedType      string
+		exitCode        int32
+		expectedFailed  bool
+		expectedReason  string
+		expectedDeleted int
+	}
+	testCases := []testCase{
+		{"A worker failing does not fail the tfjob whose PS fail it", tfv1.FailurePolicyFailJob, testutil.LabelWorker, 130, false, "", 1},
+		{"A PS failing with a retryable exit code fails the tfjob", tfv1.FailurePolicyFailJob, testutil.LabelPS, 137, true, tfJobReplicaFailedReason, 0},
+		{"A PS failing with a retryable exit code is restarted by default", "", testutil.LabelPS, 137, false, "", 1},
+		{"A PS failing with a non-retryable exit code fails the tfjob by default", tfv1.FailurePolicyRestart, testutil.LabelPS, 1, true, tfJobPSFailedReason, 0},
+		{"A PS failing is ignored", tfv1.FailurePolicyIgnore, testutil.LabelPS, 1, false, "", 0},
+	}
+	for _, c := range testCases {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		podIndexer := ctr.podIndexer
+		var actual *tfv1.TFJob
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			actual = tfJob
+			return nil
+		}
+
+		tfJob := testutil.NewTFJob(2, 1)
+		tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].RestartPolicy = common.RestartPolicyExitCode
+		tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypePS].RestartPolicy = common.RestartPolicyExitCode
+		if c.psPolicy != "" {
+			tfJob.Spec.FailurePolicies = map[tfv1.TFReplicaType]tfv1.FailurePolicy{tfv1.TFReplicaTypePS: c.psPolicy}
+		}
+		// Worker 0 is running, and either worker 1 or PS 0 failed.
+		testutil.SetPodsStatuses(podIndexer, tfJob, testutil.LabelWorker, 0, 1, 0, 0, nil, t)
+		index := 1
+		if c.failedType == testutil.LabelPS {
+			index = 0
+		} else {
+			testutil.SetPodsStatuses(podIndexer, tfJob, testutil.LabelPS, 0, 1, 0, 0, nil, t)
+		}
+		pod := testutil.NewPod(tfJob, c.failedType, index, t)
+		pod.Status.Phase = v1.PodFailed
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+			Name: tfv1.DefaultContainerName,
+			State: v1.ContainerState{
+				Terminated: &v1.ContainerStateTerminated{ExitCode: c.exitCode},
+			},
+		}}
+		if err := podIndexer.Add(pod); err != nil {
+			t.Fatalf("%s: unexpected error when adding the pod: %v", c.description, err)
+		}
+
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", c.description, err)
+		}
+		if actual == nil {
+			t.Fatalf("%s: expected the status to be updated", c.description)
+		}
+		if failed := hasCondition(actual.Status.JobStatus, common.JobFailed); failed != c.expectedFailed {
+			t.Errorf("%s: expected the tfjob failed %v, got %v", c.description, c.expectedFailed, actual.Status.Conditions)
+		}
+		if c.expectedFailed && !testutil.CheckCondition(actual, common.JobFailed, c.expectedReason) {
+			t.Errorf("%s: expected the tfjob failed with reason %s, got %v", c.description, c.expectedReason, actual.Status.Conditions)
+		}
+		if c.expectedReason == tfJobReplicaFailedReason &&
+			!strings.Contains(actual.Status.Conditions[len(actual.Status.Conditions)-1].Message, "PS replica(s) 0 (pod "+pod.Name) {
+			t.Errorf("%s: expected the condition to name the PS replica, got %v", c.description, actual.Status.Conditions)
+		}
+		if deleted := len(fakePodControl.DeletePodName); deleted != c.expectedDeleted {
+			t.Errorf("%s: expected %d deleted pods, got %d", c.description, c.expectedDeleted, deleted)
+		}
+	}
+}
+
+func TestIgnoredFailuresPastBackoffLimit(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	tfJob := testutil.NewTFJob(1, 1)
+	backoffLimit := int32(1)
+	tfJob.Spec.BackoffLimit = &backoffLimit
+	tfJob.Status.ReplicaRestarts = map[tfv1.TFReplicaType]int32{tfv1.TFReplicaTypePS: 3}
+
+	if past, err := ctr.pastBackoffLimit(tfJob, nil); err != nil || !past {
+		t.Errorf("Expected the recreated PS pods to be past the backoff limit, got %v, %v", past, err)
+	}
+	tfJob.Spec.FailurePolicies = map[tfv1.TFReplicaType]tfv1.FailurePolicy{tfv1.TFReplicaTypePS: tfv1.FailurePolicyIgnore}
+	if past, err := ctr.pastBackoffLimit(tfJob, nil); err != nil || past {
+		t.Errorf("Expected the ignored PS failures not to count against the backoff limit, got %v, %v", past, err)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+var firstPodRunningLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "tf_operator_jobs_first_pod_running_seconds",
+	Help:    "Time from the start of TF jobs to their first running pod, by whether gang scheduling is enabled",
+	Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+}, []string{"gang_scheduling"})
+
+// observeFirstPodRunning observes the time from the start of the tfjob to its
+// first running pod, once per tfjob.
+func (tc *TFController) observeFirstPodRunning(tfjob *tfv1.TFJob) {
+	if tfjob.Status.StartTime == nil {
+		return
+	}
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return
+	}
+	tc.firstPodRunningLock.Lock()
+	defer tc.firstPodRunningLock.Unlock()
+	if tc.firstPodRunningObserved.Has(key) {
+		return
+	}
+	tc.firstPodRunningObserved.Insert(key)
+	latency := tc.clock.Since(tfjob.Status.StartTime.Time)
+	firstPodRunningLatency.WithLabelValues(strconv.FormatBool(tc.Config.EnableGangScheduling)).Observe(latency.Seconds())
+}
+
+// recordFirstRunningTime records in the status of the tfjob the time its
+// first running pod was observed, if it was, and schedules the check of its
+// deadline if the deadline is measured from it. It is called once the replica
+// types have been reconciled, which observe the running pods concurrently.
+func (tc *TFController) recordFirstRunningTime(tfjob *tfv1.TFJob, runningTime *metav1.Time) {
+	if runningTime == nil || tfjob.Status.FirstRunningTime != nil {
+		return
+	}
+	tfjob.Status.FirstRunningTime = runningTime.DeepCopy()
+	ads := tfjob.Spec.ActiveDeadlineSeconds
+	if ads == nil || tfjob.Spec.DeadlineFrom == nil || *tfjob.Spec.DeadlineFrom != tfv1.DeadlineFromFirstRunning {
+		return
+	}
+	if key, err := KeyFunc(tfjob); err == nil {
+		tflogger.LoggerForJob(tfjob).Infof("Job with ActiveDeadlineSeconds from its first running pod will sync after %d seconds", *ads)
+		tc.WorkQueue.AddAfter(key, time.Duration(*ads)*time.Second)
+	}
+}
+
+// forgetFirstPodRunning forgets whether the first running pod of the tfjob
+// has been observed.
+func (tc *TFController) forgetFirstPodRunning(key string) {
+	tc.firstPodRunningLock.Lock()
+	defer tc.firstPodRunningLock.Unlock()
+	tc.firstPodRunningObserved.Delete(key)
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+	"time"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func collectFirstPodRunningLatency(t *testing.T, gangScheduling string) (uint64, float64) {
+	var m dto.Metric
+	observer := firstPodRunningLatency.WithLabelValues(gangScheduling)
+	if err := observer.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("Failed to write the metric: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestObserveFirstPodRunning(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	fakeClock := clock.NewFakeClock(time.Now())
+	ctr.clock = fakeClock
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+	// The observations of the other tests are dropped, so that the ones of
+	// this test are compared exactly.
+	firstPodRunningLatency.Reset()
+
+	tfJob := testutil.NewTFJob(2, 0)
+	startTime := metav1.NewTime(fakeClock.Now())
+	tfJob.Status.StartTime = &startTime
+	fakeClock.Step(30 * time.Second)
+	testutil.SetPodsStatuses(ctr.podIndexer, tfJob, testutil.LabelWorker, 0, 2, 0, 0, nil, t)
+
+	// The latency is observed once, however many pods are running and
+	// however many times the tfjob is reconciled.
+	for i := 0; i < 2; i++ {
+		if err := ctr.reconcileTFJobs(tfJob.DeepCopy()); err != nil {
+			t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+		}
+		fakeClock.Step(time.Minute)
+	}
+	if count, sum := collectFirstPodRunningLatency(t, "false"); count != 1 || sum != 30 {
+		t.Errorf("Expected a single observation of 30s, got %d observations summing to %vs", count, sum)
+	}
+
+	// The latency is observed again once the tfjob is forgotten.
+	ctr.forgetFirstPodRunning(testutil.GetKey(tfJob, t))
+	if err := ctr.reconcileTFJobs(tfJob.DeepCopy()); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if count, _ := collectFirstPodRunningLatency(t, "false"); count != 2 {
+		t.Errorf("Expected the latency to be observed again, got %d observations", count)
+	}
+}
+
+func TestActiveDeadlineFromFirstRunning(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	fakeClock := clock.NewFakeClock(time.Now())
+	ctr.clock = fakeClock
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+
+	ads := int64(60)
+	tfJob := testutil.NewTFJobWithActiveDeadlineSeconds(0, 2, 0, &ads)
+	// The tfjob has been queued for longer than its deadline.
+	startTime := metav1.NewTime(time.Now().Add(-time.Hour))
+	tfJob.Status.StartTime = &startTime
+	if !ctr.pastActiveDeadline(tfJob) {
+		t.Errorf("Expected the deadline measured from the start time to be exceeded")
+	}
+	firstRunning := tfv1.DeadlineFromFirstRunning
+	tfJob.Spec.DeadlineFrom = &firstRunning
+	if ctr.pastActiveDeadline(tfJob) {
+		t.Errorf("Expected the deadline not to apply before a pod runs")
+	}
+
+	testutil.SetPodsStatuses(ctr.podIndexer, tfJob, testutil.LabelWorker, 0, 2, 0, 0, nil, t)
+	if err := ctr.reconcileTFJobs(tfJob); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if tfJob.Status.FirstRunningTime == nil || !tfJob.Status.FirstRunningTime.Time.Equal(fakeClock.Now()) {
+		t.Fatalf("Expected the first running time %v, got %v", fakeClock.Now(), tfJob.Status.FirstRunningTime)
+	}
+	if ctr.pastActiveDeadline(tfJob) || testutil.CheckCondition(tfJob, common.JobFailed, tfJobFailedReason) {
+		t.Errorf("Expected the tfjob to keep running within its deadline, got %v", tfJob.Status.Conditions)
+	}
+
+	// The first running time is kept by the next syncs.
+	fakeClock.Step(time.Minute)
+	if err := ctr.reconcileTFJobs(tfJob); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if !tfJob.Status.FirstRunningTime.Time.Equal(fakeClock.Now().Add(-time.Minute)) {
+		t.Errorf("Expected the first running time to be kept, got %v", tfJob.Status.FirstRunningTime)
+	}
+
+	past := metav1.NewTime(time.Now().Add(-2 * time.Minute))
+	tfJob.Status.FirstRunningTime = &past
+	if !ctr.pastActiveDeadline(tfJob) {
+		t.Errorf("Expected the deadline measured from the first running pod to be exceeded")
+	}
+}
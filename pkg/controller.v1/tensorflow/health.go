@@ -0,0 +1,51 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// HealthHandler returns the handler of the health probes of the operator:
+//
+//	GET /healthz returns 200 while the operator is serving.
+//	GET /readyz returns 200 once the caches of the informers have been
+//	synced, and 503 before, since the tfjobs cannot be reconciled yet.
+func (tc *TFController) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !tc.hasSynced() {
+			http.Error(w, "the informer caches are not synced", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
+
+// hasSynced returns true if the caches of all the informers the controller
+// reads from have been synced.
+func (tc *TFController) hasSynced() bool {
+	for _, synced := range tc.informersSynced() {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
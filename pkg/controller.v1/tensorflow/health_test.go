@@ -0,0 +1,52 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthHandler(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	synced := false
+	ctr.PodInformerSynced = func() bool {
+		return synced
+	}
+	ctr.tfJobInformerSynced = func() bool {
+		return true
+	}
+	ctr.ServiceInformerSynced = func() bool {
+		return true
+	}
+
+	// probe returns the status code of the probe.
+	probe := func(path string) int {
+		recorder := httptest.NewRecorder()
+		ctr.HealthHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code
+	}
+	if code := probe("/healthz"); code != http.StatusOK {
+		t.Errorf("Expected /healthz to return %d, got %d", http.StatusOK, code)
+	}
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to return %d before the caches are synced, got %d", http.StatusServiceUnavailable, code)
+	}
+	synced = true
+	if code := probe("/readyz"); code != http.StatusOK {
+		t.Errorf("Expected /readyz to return %d once the caches are synced, got %d", http.StatusOK, code)
+	}
+}
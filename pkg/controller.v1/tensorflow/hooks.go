@@ -0,0 +1,217 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+const (
+	// hookRunningReason is added in a tfjob when the Job of its hook is
+	// created.
+	hookRunningReason = "HookRunning"
+	// hookSucceededReason is added in a tfjob when the Job of its hook
+	// succeeded.
+	hookSucceededReason = "HookSucceeded"
+	// hookFailedReason is added in a tfjob when the Job of its hook failed,
+	// or could not be created because another Job has its name.
+	hookFailedReason = "HookFailed"
+	// hookJobDeletedReason is added in a tfjob when the Job of its hook was
+	// deleted before it finished.
+	hookJobDeletedReason = "HookJobDeleted"
+)
+
+// hookExpectationsKey returns the key of the expectations of the creation of
+// the hook Job of the tfjob of the given key.
+func hookExpectationsKey(tfjobKey string) string {
+	return tfjobKey + "/hook"
+}
+
+// hookFor returns the name of the Job and the template of the hook run for
+// the outcome of the completed tfjob. The template is nil if the tfjob has no
+// such hook or is not completed.
+func hookFor(tfjob *tfv1.TFJob) (string, *v1.PodTemplateSpec) {
+	switch jobState(tfjob.Status.JobStatus) {
+	case common.JobSucceeded:
+		return tfjob.Name + "-on-success", tfjob.Spec.OnSuccess
+	case common.JobFailed:
+		return tfjob.Name + "-on-failure", tfjob.Spec.OnFailure
+	}
+	return "", nil
+}
+
+// isHookPending returns true if the completed tfjob has a hook whose outcome
+// has not been recorded yet.
+func isHookPending(tfjob *tfv1.TFJob) bool {
+	_, template := hookFor(tfjob)
+	return template != nil &&
+		!hasCondition(tfjob.Status.JobStatus, tfv1.JobHookSucceeded) &&
+		!hasCondition(tfjob.Status.JobStatus, tfv1.JobHookFailed)
+}
+
+// reconcileHook creates the Job of the hook of the completed tfjob once, and
+// records its outcome in the hook conditions of the tfjob, which do not
+// change the outcome of the tfjob itself. The Job is named after the tfjob,
+// so that it is not created twice if the operator restarts before the
+// HookRunning condition is persisted.
+func (tc *TFController) reconcileHook(tfjob *tfv1.TFJob) error {
+	if !isHookPending(tfjob) {
+		return nil
+	}
+	tfjobKey, err := KeyFunc(tfjob)
+	if err != nil {
+		return err
+	}
+	name, template := hookFor(tfjob)
+	job, err := tc.hookJobLister.Jobs(tfjob.Namespace).Get(name)
+	if errors.IsNotFound(err) {
+		if !hasCondition(tfjob.Status.JobStatus, tfv1.JobHookRunning) {
+			return tc.createHookJob(tfjob, tfjobKey, name, template)
+		}
+		if !tc.Expectations.SatisfiedExpectations(hookExpectationsKey(tfjobKey)) {
+			// The Job has just been created and is not in the cache yet.
+			return nil
+		}
+		tc.setHookCondition(tfjob, v1.EventTypeWarning, tfv1.JobHookFailed, hookJobDeletedReason,
+			fmt.Sprintf("The Job %s of the hook of TFJob %s was deleted before it finished.", name, tfjob.Name))
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if owner := metav1.GetControllerOf(job); owner == nil || owner.UID != tfjob.UID {
+		tc.setHookCondition(tfjob, v1.EventTypeWarning, tfv1.JobHookFailed, hookFailedReason,
+			fmt.Sprintf("The Job %s of the hook of TFJob %s already exists and is not controlled by it.", name, tfjob.Name))
+		return nil
+	}
+	if condition := getHookJobCondition(job, batchv1.JobComplete); condition != nil {
+		tc.setHookCondition(tfjob, v1.EventTypeNormal, tfv1.JobHookSucceeded, hookSucceededReason,
+			fmt.Sprintf("The Job %s of the hook of TFJob %s succeeded.", name, tfjob.Name))
+	} else if condition := getHookJobCondition(job, batchv1.JobFailed); condition != nil {
+		tc.setHookCondition(tfjob, v1.EventTypeWarning, tfv1.JobHookFailed, hookFailedReason,
+			fmt.Sprintf("The Job %s of the hook of TFJob %s failed: %s", name, tfjob.Name, condition.Message))
+	} else if !hasCondition(tfjob.Status.JobStatus, tfv1.JobHookRunning) {
+		// The Job was created before the operator restarted.
+		replaceCondition(&tfjob.Status.JobStatus, newCondition(tfv1.JobHookRunning, hookRunningReason,
+			fmt.Sprintf("The Job %s of the hook of TFJob %s is running.", name, tfjob.Name)))
+	}
+	return nil
+}
+
+// createHookJob creates the Job of the hook of the tfjob from its template.
+// The Job is labeled like the pods of the tfjob, but not its pods, so that
+// they are not mistaken for replicas of the tfjob.
+func (tc *TFController) createHookJob(tfjob *tfv1.TFJob, tfjobKey, name string, template *v1.PodTemplateSpec) error {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: tc.genLabels(tfjob),
+		},
+		Spec: batchv1.JobSpec{
+			Template: *template.DeepCopy(),
+		},
+	}
+	if job.Spec.Template.Spec.RestartPolicy == "" {
+		job.Spec.Template.Spec.RestartPolicy = v1.RestartPolicyNever
+	}
+	expectationsKey := hookExpectationsKey(tfjobKey)
+	if err := tc.Expectations.ExpectCreations(expectationsKey, 1); err != nil {
+		return err
+	}
+	if err := tc.JobControl.CreateJob(tfjob.Namespace, job, tfjob, tc.GenOwnerReference(tfjob)); err != nil {
+		tc.Expectations.CreationObserved(expectationsKey)
+		return err
+	}
+	tc.setHookCondition(tfjob, v1.EventTypeNormal, tfv1.JobHookRunning, hookRunningReason,
+		fmt.Sprintf("The Job %s of the hook of TFJob %s is running.", name, tfjob.Name))
+	return nil
+}
+
+// setHookCondition records the state of the hook of the completed tfjob in
+// its conditions, with an event.
+func (tc *TFController) setHookCondition(tfjob *tfv1.TFJob, eventType string, conditionType common.JobConditionType, reason, msg string) {
+	tc.Recorder.Event(tfjob, eventType, reason, msg)
+	replaceCondition(&tfjob.Status.JobStatus, newCondition(conditionType, reason, msg))
+}
+
+// getHookJobCondition returns the true condition of the given type of the
+// Job, or nil.
+func getHookJobCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		if job.Status.Conditions[i].Type == conditionType && job.Status.Conditions[i].Status == v1.ConditionTrue {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// hookJobTFJobKey returns the key of the tfjob controlling the Job, if any.
+func hookJobTFJobKey(job *batchv1.Job) (string, bool) {
+	controllerRef := metav1.GetControllerOf(job)
+	if controllerRef == nil || controllerRef.Kind != tfv1.Kind {
+		return "", false
+	}
+	return job.Namespace + "/" + controllerRef.Name, true
+}
+
+// addHookJob observes the creation of the Job of the hook of a tfjob, and
+// syncs the tfjob.
+func (tc *TFController) addHookJob(obj interface{}) {
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		return
+	}
+	if key, ok := hookJobTFJobKey(job); ok {
+		tc.Expectations.CreationObserved(hookExpectationsKey(key))
+		tc.WorkQueue.Add(key)
+	}
+}
+
+// updateHookJob syncs the tfjob whose hook Job changed, e.g. finished.
+func (tc *TFController) updateHookJob(old, cur interface{}) {
+	job, ok := cur.(*batchv1.Job)
+	if !ok {
+		return
+	}
+	if key, ok := hookJobTFJobKey(job); ok {
+		tc.WorkQueue.Add(key)
+	}
+}
+
+// deleteHookJob syncs the tfjob whose hook Job was deleted.
+func (tc *TFController) deleteHookJob(obj interface{}) {
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
+		}
+		if job, ok = tombstone.Obj.(*batchv1.Job); !ok {
+			return
+		}
+	}
+	if key, ok := hookJobTFJobKey(job); ok {
+		tc.WorkQueue.Add(key)
+	}
+}
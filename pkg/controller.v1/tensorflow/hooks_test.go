@@ -0,0 +1,211 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
+)
+
+// newHookTestController returns a controller whose hook Jobs are created by
+// the returned fake and listed from the returned indexer.
+func newHookTestController() (*TFController, *control.FakeJobControl, cache.Indexer) {
+	ctr, _, _ := newErrorsTestController()
+	fakeJobControl := &control.FakeJobControl{}
+	ctr.JobControl = fakeJobControl
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	ctr.hookJobLister = batchlisters.NewJobLister(indexer)
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+	return ctr, fakeJobControl, indexer
+}
+
+// newHookTFJob returns a tfjob with both hooks, completed with the given
+// condition.
+func newHookTFJob(outcome common.JobConditionType, t *testing.T) *tfv1.TFJob {
+	tfJob := testutil.NewTFJob(1, 0)
+	tfJob.UID = "tfjob-uid"
+	for _, hook := range []**v1.PodTemplateSpec{&tfJob.Spec.OnSuccess, &tfJob.Spec.OnFailure} {
+		*hook = &v1.PodTemplateSpec{
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{{Name: "upload", Image: "uploader"}},
+			},
+		}
+	}
+	completionTime := metav1.NewTime(time.Now().Add(-time.Minute))
+	tfJob.Status.CompletionTime = &completionTime
+	if err := updateTFJobConditions(tfJob, outcome, "", ""); err != nil {
+		t.Fatalf("Unexpected error when completing the tfjob: %v", err)
+	}
+	return tfJob
+}
+
+// newHookJob returns the hook Job of the tfjob with the given condition.
+func newHookJob(ctr *TFController, tfJob *tfv1.TFJob, name string, conditionType batchv1.JobConditionType) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       tfJob.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*ctr.GenOwnerReference(tfJob)},
+		},
+	}
+	if conditionType != "" {
+		job.Status.Conditions = []batchv1.JobCondition{{Type: conditionType, Status: v1.ConditionTrue, Message: "BackoffLimitExceeded"}}
+	}
+	return job
+}
+
+func TestSuccessHook(t *testing.T) {
+	ctr, fakeJobControl, indexer := newHookTestController()
+	deleted := false
+	ctr.deleteTFJobHandler = func(tfJob *tfv1.TFJob) error {
+		deleted = true
+		return nil
+	}
+	tfJob := newHookTFJob(common.JobSucceeded, t)
+	ttl := int32(0)
+	tfJob.Spec.TTLSecondsAfterFinished = &ttl
+
+	// The Job is created once, even if the tfjob is synced again before the
+	// Job is in the cache.
+	for i := 0; i < 2; i++ {
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+		}
+	}
+	if len(fakeJobControl.Templates) != 1 {
+		t.Fatalf("Expected the hook Job to be created once, got %d", len(fakeJobControl.Templates))
+	}
+	job := fakeJobControl.Templates[0]
+	if job.Name != tfJob.Name+"-on-success" || job.Spec.Template.Spec.RestartPolicy != v1.RestartPolicyNever {
+		t.Errorf("Expected the Job %s-on-success never restarting its pods, got %s restarting %s",
+			tfJob.Name, job.Name, job.Spec.Template.Spec.RestartPolicy)
+	}
+	if fakeJobControl.ControllerRefs[0].UID != tfJob.UID {
+		t.Errorf("Expected the hook Job to be owned by the tfjob, got %v", fakeJobControl.ControllerRefs[0])
+	}
+	if expected := ctr.genLabels(tfJob); !reflect.DeepEqual(job.Labels, expected) || len(job.Spec.Template.Labels) != 0 {
+		t.Errorf("Expected the hook Job labeled %v but not its pods, got %v and %v", expected, job.Labels, job.Spec.Template.Labels)
+	}
+	if !testutil.CheckCondition(tfJob, tfv1.JobHookRunning, hookRunningReason) {
+		t.Errorf("Expected the HookRunning condition, got %v", tfJob.Status.Conditions)
+	}
+	if deleted {
+		t.Errorf("Expected the TTL cleanup to wait for the hook to finish")
+	}
+
+	if err := indexer.Add(newHookJob(ctr, tfJob, job.Name, batchv1.JobComplete)); err != nil {
+		t.Fatalf("Unexpected error when adding the Job: %v", err)
+	}
+	if err := ctr.reconcileTFJobs(tfJob); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if !testutil.CheckCondition(tfJob, tfv1.JobHookSucceeded, hookSucceededReason) || hasCondition(tfJob.Status.JobStatus, tfv1.JobHookRunning) {
+		t.Errorf("Expected the HookSucceeded condition only, got %v", tfJob.Status.Conditions)
+	}
+	if state := jobState(tfJob.Status.JobStatus); state != common.JobSucceeded {
+		t.Errorf("Expected the tfjob to stay succeeded, got %s", state)
+	}
+	if !deleted {
+		t.Errorf("Expected the tfjob to be cleaned up once the hook finished")
+	}
+}
+
+func TestFailureHook(t *testing.T) {
+	ctr, fakeJobControl, indexer := newHookTestController()
+	tfJob := newHookTFJob(common.JobFailed, t)
+
+	if err := ctr.reconcileTFJobs(tfJob); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if len(fakeJobControl.Templates) != 1 || fakeJobControl.Templates[0].Name != tfJob.Name+"-on-failure" {
+		t.Fatalf("Expected the Job %s-on-failure to be created, got %v", tfJob.Name, fakeJobControl.Templates)
+	}
+
+	if err := indexer.Add(newHookJob(ctr, tfJob, tfJob.Name+"-on-failure", batchv1.JobFailed)); err != nil {
+		t.Fatalf("Unexpected error when adding the Job: %v", err)
+	}
+	if err := ctr.reconcileTFJobs(tfJob); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	condition := getCondition(tfJob.Status.JobStatus, tfv1.JobHookFailed)
+	if condition == nil || condition.Reason != hookFailedReason {
+		t.Fatalf("Expected the HookFailed condition, got %v", tfJob.Status.Conditions)
+	}
+	if state := jobState(tfJob.Status.JobStatus); state != common.JobFailed || isSucceeded(tfJob.Status.JobStatus) {
+		t.Errorf("Expected the tfjob to stay failed, got %v", tfJob.Status.Conditions)
+	}
+	// The outcome is only recorded once.
+	if err := ctr.reconcileTFJobs(tfJob); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if len(fakeJobControl.Templates) != 1 {
+		t.Errorf("Expected the hook Job not to be recreated, got %d creations", len(fakeJobControl.Templates))
+	}
+}
+
+func TestHookAfterOperatorRestart(t *testing.T) {
+	type testCase struct {
+		description string
+		// hookRunning is whether the HookRunning condition was persisted
+		// before the operator restarted, and jobCreated whether the Job was.
+		hookRunning       bool
+		jobCreated        bool
+		expectedCreations int
+		expectedCondition common.JobConditionType
+		expectedReason    string
+	}
+	testCases := []testCase{
+		{"The operator restarted before creating the Job", false, false, 1, tfv1.JobHookRunning, hookRunningReason},
+		{"The operator restarted before recording the Job", false, true, 0, tfv1.JobHookRunning, hookRunningReason},
+		{"The Job was deleted while the operator restarted", true, false, 0, tfv1.JobHookFailed, hookJobDeletedReason},
+	}
+	for _, c := range testCases {
+		// The new operator starts with no expectations.
+		ctr, fakeJobControl, indexer := newHookTestController()
+		tfJob := newHookTFJob(common.JobSucceeded, t)
+		if c.hookRunning {
+			replaceCondition(&tfJob.Status.JobStatus, newCondition(tfv1.JobHookRunning, hookRunningReason, ""))
+		}
+		if c.jobCreated {
+			if err := indexer.Add(newHookJob(ctr, tfJob, tfJob.Name+"-on-success", "")); err != nil {
+				t.Fatalf("%s: unexpected error when adding the Job: %v", c.description, err)
+			}
+		}
+
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", c.description, err)
+		}
+		if len(fakeJobControl.Templates) != c.expectedCreations {
+			t.Errorf("%s: expected %d creations of the hook Job, got %d", c.description, c.expectedCreations, len(fakeJobControl.Templates))
+		}
+		if !testutil.CheckCondition(tfJob, c.expectedCondition, c.expectedReason) {
+			t.Errorf("%s: expected the %s condition with reason %s, got %v", c.description, c.expectedCondition, c.expectedReason, tfJob.Status.Conditions)
+		}
+	}
+}
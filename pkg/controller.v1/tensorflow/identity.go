@@ -0,0 +1,126 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// genReplicaIdentity returns the identity of a replica, which is stable
+// across recreations of its pod.
+func genReplicaIdentity(tfjob *tfv1.TFJob, rt, index string) string {
+	return fmt.Sprintf("%s-%s-%s", tfjob.UID, rt, index)
+}
+
+// getReplicaAttempt returns the attempt of the next pod of the replica, or 0
+// if its pod has never been recreated. The attempts recorded by the previous
+// syncs are taken into account, since the status of the tfjob in the cache
+// may not have them yet.
+func (tc *TFController) getReplicaAttempt(tfjob *tfv1.TFJob, rt, index string) int {
+	replica := genReplicaName(rt, index)
+	attempt := tfjob.Status.ReplicaAttempts[replica]
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return int(attempt)
+	}
+	tc.replicaAttemptsLock.Lock()
+	defer tc.replicaAttemptsLock.Unlock()
+	if recorded := tc.replicaAttempts[key][replica]; recorded > attempt {
+		attempt = recorded
+	}
+	return int(attempt)
+}
+
+// recordReplicaAttempts records in the status of the tfjob the attempt of
+// the next pod of the replicas whose pod was deleted to be recreated, i.e.
+// the attempt of the deleted pod plus one. Recording the same pod again,
+// e.g. when it is still in the cache on the next sync, does not change it.
+func (tc *TFController) recordReplicaAttempts(tfjob *tfv1.TFJob, pods []*v1.Pod) {
+	if len(pods) == 0 {
+		return
+	}
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return
+	}
+	tc.replicaAttemptsLock.Lock()
+	defer tc.replicaAttemptsLock.Unlock()
+	for _, pod := range pods {
+		replica := genReplicaName(pod.Labels[tfReplicaTypeLabel], pod.Labels[tfReplicaIndexLabel])
+		attempt, err := strconv.Atoi(pod.Annotations[tfv1.AnnotationAttempt])
+		if err != nil {
+			// The pods created before the attempts were recorded are
+			// given the recorded one.
+			attempt = int(tfjob.Status.ReplicaAttempts[replica])
+		}
+		next := int32(attempt + 1)
+		if tfjob.Status.ReplicaAttempts == nil {
+			tfjob.Status.ReplicaAttempts = make(map[string]int32)
+		}
+		if next > tfjob.Status.ReplicaAttempts[replica] {
+			tfjob.Status.ReplicaAttempts[replica] = next
+		}
+		if tc.replicaAttempts[key] == nil {
+			tc.replicaAttempts[key] = make(map[string]int32)
+		}
+		if next > tc.replicaAttempts[key][replica] {
+			tc.replicaAttempts[key][replica] = next
+		}
+	}
+}
+
+// forgetReplicaAttempts forgets the attempts recorded for the tfjob.
+func (tc *TFController) forgetReplicaAttempts(key string) {
+	tc.replicaAttemptsLock.Lock()
+	defer tc.replicaAttemptsLock.Unlock()
+	delete(tc.replicaAttempts, key)
+}
+
+// addReplicaRestarts adds the failed pods of the replica type deleted to be
+// recreated to the restarts recorded in the status of the tfjob.
+func addReplicaRestarts(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType, restarts int32) {
+	if restarts == 0 {
+		return
+	}
+	if tfjob.Status.ReplicaRestarts == nil {
+		tfjob.Status.ReplicaRestarts = make(map[tfv1.TFReplicaType]int32)
+	}
+	tfjob.Status.ReplicaRestarts[rtype] += restarts
+}
+
+// setReplicaIdentity sets the identity and attempt of the replica in the
+// annotations of the pod and the environment of the tensorflow container.
+func setReplicaIdentity(podTemplateSpec *v1.PodTemplateSpec, identity string, attempt int) {
+	if podTemplateSpec.Annotations == nil {
+		podTemplateSpec.Annotations = map[string]string{}
+	}
+	podTemplateSpec.Annotations[tfv1.AnnotationReplicaIdentity] = identity
+	podTemplateSpec.Annotations[tfv1.AnnotationAttempt] = strconv.Itoa(attempt)
+
+	for i := range podTemplateSpec.Spec.Containers {
+		if podTemplateSpec.Spec.Containers[i].Name == tfv1.DefaultContainerName {
+			podTemplateSpec.Spec.Containers[i].Env = append(podTemplateSpec.Spec.Containers[i].Env,
+				v1.EnvVar{Name: tfv1.EnvReplicaIdentity, Value: identity},
+				v1.EnvVar{Name: tfv1.EnvAttempt, Value: strconv.Itoa(attempt)},
+			)
+			break
+		}
+	}
+}
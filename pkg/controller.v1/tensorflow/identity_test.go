@@ -0,0 +1,137 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strconv"
+	"testing"
+
+	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
+	v1 "k8s.io/api/core/v1"
+	kubeclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/kubernetes/pkg/controller"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
+)
+
+func TestReplicaIdentity(t *testing.T) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, _, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, options.ServerOption{})
+	fakePodControl := &controller.FakePodControl{}
+	ctr.PodControl = fakePodControl
+	fakeServiceControl := &control.FakeServiceControl{}
+	ctr.ServiceControl = fakeServiceControl
+	ctr.Recorder = &record.FakeRecorder{}
+	ctr.exemptPreemptions = true
+
+	tfJob := testutil.NewTFJob(1, 0)
+	spec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker]
+	spec.RestartPolicy = common.RestartPolicyExitCode
+
+	if err := ctr.reconcileReplicaTypes(tfJob, nil, nil); err != nil {
+		t.Errorf("Unexpected error when reconciling pods: %v", err)
+	}
+	identity := fakePodControl.Templates[0].Annotations[tfv1.AnnotationReplicaIdentity]
+	if identity != genReplicaIdentity(tfJob, testutil.LabelWorker, "0") {
+		t.Errorf("Unexpected replica identity %q", identity)
+	}
+	checkReplicaIdentity(t, fakePodControl.Templates[0], identity, 0)
+
+	// Recreate the pod of the index after a failure, then a preemption.
+	for attempt := 1; attempt <= 2; attempt++ {
+		template := fakePodControl.Templates[len(fakePodControl.Templates)-1]
+		pod := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+		pod.Name = template.Name
+		pod.Annotations = template.Annotations
+		pod.Status.Phase = v1.PodFailed
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+			Name: tfv1.DefaultContainerName,
+			State: v1.ContainerState{
+				Terminated: &v1.ContainerStateTerminated{ExitCode: 130},
+			},
+		}}
+		if attempt == 2 {
+			pod.Status.Reason = "Preempted"
+		}
+		// The tfjob in the cache does not have the updated status yet.
+		stale := tfJob.DeepCopy()
+		if err := ctr.reconcileReplicaTypes(tfJob, map[string][]*v1.Pod{testutil.LabelWorker: {pod}}, nil); err != nil {
+			t.Errorf("Unexpected error when reconciling pods: %v", err)
+		}
+		if len(fakePodControl.DeletePodName) != 2*attempt-1 {
+			t.Fatalf("Expected the failed pod to be deleted, got %v", fakePodControl.DeletePodName)
+		}
+		// Seeing the deleted pod again does not count it twice.
+		if err := ctr.reconcileReplicaTypes(tfJob, map[string][]*v1.Pod{testutil.LabelWorker: {pod}}, nil); err != nil {
+			t.Errorf("Unexpected error when reconciling pods: %v", err)
+		}
+
+		if got := tfJob.Status.ReplicaAttempts["worker-0"]; got != int32(attempt) {
+			t.Errorf("Expected attempt %d to be recorded in the status, got %d", attempt, got)
+		}
+
+		if err := ctr.reconcileReplicaTypes(stale, nil, nil); err != nil {
+			t.Errorf("Unexpected error when reconciling pods: %v", err)
+		}
+		checkReplicaIdentity(t, fakePodControl.Templates[len(fakePodControl.Templates)-1], identity, attempt)
+	}
+}
+
+func checkReplicaIdentity(t *testing.T, template v1.PodTemplateSpec, identity string, attempt int) {
+	if got := template.Annotations[tfv1.AnnotationReplicaIdentity]; got != identity {
+		t.Errorf("Expected replica identity %q, got %q", identity, got)
+	}
+	if got := template.Annotations[tfv1.AnnotationAttempt]; got != strconv.Itoa(attempt) {
+		t.Errorf("Expected attempt %d, got %q", attempt, got)
+	}
+	env := map[string]string{}
+	for _, e := range template.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	if env[tfv1.EnvReplicaIdentity] != identity || env[tfv1.EnvAttempt] != strconv.Itoa(attempt) {
+		t.Errorf("Expected the identity env of attempt %d, got %v", attempt, env)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+const (
+	// tfJobImagePullFailedReason is the reason of the Failed condition when
+	// a container of the tfjob has kept failing to pull its image.
+	tfJobImagePullFailedReason = "ImagePullFailed"
+)
+
+// imagePullFailureReasons is the waiting reasons of the containers which do
+// not recover before their image or their config is fixed.
+var imagePullFailureReasons = sets.NewString(
+	"ErrImagePull",
+	"ImagePullBackOff",
+	"InvalidImageName",
+	"CreateContainerConfigError",
+)
+
+// imagePullFailure returns the message the tfjob fails with if a container of
+// its pods has kept failing to pull its image, or to be created, for longer
+// than the timeout, and an empty string otherwise. A pod is failing since the
+// first sync which observed it so, and is forgotten by the first sync which
+// does not, so that only consecutive observations count. The tfjob is
+// requeued for the pods which are yet to cross the timeout.
+func (tc *TFController) imagePullFailure(tfjob *tfv1.TFJob, pods []*v1.Pod) string {
+	if tc.imagePullFailureTimeout <= 0 {
+		return ""
+	}
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return ""
+	}
+	now := tc.clock.Now()
+
+	tc.imagePullFailuresLock.Lock()
+	defer tc.imagePullFailuresLock.Unlock()
+	last := tc.imagePullFailures[key]
+	failing := make(map[types.UID]time.Time)
+	msg := ""
+	var nextCheck time.Duration
+	for _, pod := range pods {
+		status := imagePullFailureStatus(pod)
+		if status == nil {
+			continue
+		}
+		since, ok := last[pod.UID]
+		if !ok {
+			since = now
+		}
+		failing[pod.UID] = since
+		if remaining := tc.imagePullFailureTimeout - now.Sub(since); remaining > 0 {
+			if nextCheck == 0 || remaining < nextCheck {
+				nextCheck = remaining
+			}
+			continue
+		}
+		if msg == "" {
+			waiting := status.State.Waiting
+			msg = fmt.Sprintf("TFJob %s has failed because container %s of pod %s could not start image %q for %v: %s: %s",
+				tfjob.Name, status.Name, pod.Name, status.Image, tc.imagePullFailureTimeout, waiting.Reason, waiting.Message)
+		}
+	}
+	if len(failing) == 0 {
+		delete(tc.imagePullFailures, key)
+	} else {
+		tc.imagePullFailures[key] = failing
+	}
+	if msg == "" && nextCheck > 0 {
+		tc.WorkQueue.AddAfter(key, nextCheck)
+	}
+	return msg
+}
+
+// imagePullFailureStatus returns the status of the first container of the
+// pod, init containers included, which is waiting for a reason it does not
+// recover from by itself, or nil if there is none.
+func imagePullFailureStatus(pod *v1.Pod) *v1.ContainerStatus {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != v1.PodPending {
+		return nil
+	}
+	for _, statuses := range [][]v1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for i := range statuses {
+			waiting := statuses[i].State.Waiting
+			if waiting != nil && imagePullFailureReasons.Has(waiting.Reason) {
+				return &statuses[i]
+			}
+		}
+	}
+	return nil
+}
+
+// forgetImagePullFailures forgets the pods of the tfjob failing to pull
+// their image.
+func (tc *TFController) forgetImagePullFailures(key string) {
+	tc.imagePullFailuresLock.Lock()
+	defer tc.imagePullFailuresLock.Unlock()
+	delete(tc.imagePullFailures, key)
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+const imagePullBackOffMessage = `Back-off pulling image "tensorflow/tensorflow:missing"`
+
+// newImagePullPod returns a pending worker pod of the tfjob whose container
+// is waiting for the given reason, or is not waiting if it is empty.
+func newImagePullPod(tfJob *tfv1.TFJob, index int, reason string, t *testing.T) *v1.Pod {
+	pod := testutil.NewPod(tfJob, testutil.LabelWorker, index, t)
+	pod.UID = types.UID(pod.Name)
+	pod.Status.Phase = v1.PodPending
+	status := v1.ContainerStatus{Name: tfv1.DefaultContainerName, Image: "tensorflow/tensorflow:missing"}
+	if reason != "" {
+		status.State.Waiting = &v1.ContainerStateWaiting{Reason: reason, Message: imagePullBackOffMessage}
+	}
+	pod.Status.ContainerStatuses = []v1.ContainerStatus{status}
+	return pod
+}
+
+func TestImagePullFailure(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	defer ctr.WorkQueue.ShutDown()
+	fakeClock := clock.NewFakeClock(time.Now())
+	ctr.clock = fakeClock
+	ctr.imagePullFailureTimeout = 5 * time.Minute
+	var actual *tfv1.TFJob
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		actual = tfJob
+		return nil
+	}
+	tfJob := testutil.NewTFJobWithCleanPolicy(0, 1, 0, common.CleanPodPolicyAll)
+
+	type step struct {
+		description    string
+		elapsed        time.Duration
+		reason         string
+		expectedFailed bool
+	}
+	steps := []step{
+		{"The tfjob does not fail as soon as the image pull fails", 0, "ErrImagePull", false},
+		{"The tfjob does not fail before the timeout", 3 * time.Minute, "ImagePullBackOff", false},
+		{"The pod pulling its image resets the timeout", time.Minute, "", false},
+		{"The tfjob does not fail before the timeout since the pod failed again", 3 * time.Minute, "ImagePullBackOff", false},
+		{"The tfjob fails once the pod has failed for longer than the timeout", 5 * time.Minute, "ImagePullBackOff", true},
+	}
+	for _, s := range steps {
+		fakeClock.Step(s.elapsed)
+		if err := ctr.podIndexer.Update(newImagePullPod(tfJob, 0, s.reason, t)); err != nil {
+			t.Fatalf("%s: unexpected error when adding the pod: %v", s.description, err)
+		}
+		actual = nil
+		if err := ctr.reconcileTFJobs(tfJob.DeepCopy()); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", s.description, err)
+		}
+		failed := actual != nil && hasCondition(actual.Status.JobStatus, common.JobFailed)
+		if failed != s.expectedFailed {
+			t.Errorf("%s: expected the tfjob failed %v, got %v", s.description, s.expectedFailed, failed)
+		}
+	}
+	if !testutil.CheckCondition(actual, common.JobFailed, tfJobImagePullFailedReason) {
+		t.Fatalf("Expected the tfjob failed with reason %s, got %v", tfJobImagePullFailedReason, actual.Status.Conditions)
+	}
+	msg := getCondition(actual.Status.JobStatus, common.JobFailed).Message
+	if !strings.Contains(msg, "tensorflow/tensorflow:missing") || !strings.Contains(msg, imagePullBackOffMessage) {
+		t.Errorf("Expected the condition to name the image and the message of the kubelet, got %q", msg)
+	}
+	if deleted := len(fakePodControl.DeletePodName); deleted != 1 {
+		t.Errorf("Expected the pod of the failed tfjob to be deleted, got %d deletions", deleted)
+	}
+}
+
+func TestImagePullFailureDisabled(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	defer ctr.WorkQueue.ShutDown()
+	fakeClock := clock.NewFakeClock(time.Now())
+	ctr.clock = fakeClock
+	tfJob := testutil.NewTFJob(1, 0)
+	pods := []*v1.Pod{newImagePullPod(tfJob, 0, "CreateContainerConfigError", t)}
+
+	ctr.imagePullFailure(tfJob, pods)
+	fakeClock.Step(time.Hour)
+	if msg := ctr.imagePullFailure(tfJob, pods); msg != "" {
+		t.Errorf("Expected the tfjob not to fail when the timeout is disabled, got %q", msg)
+	}
+
+	// Init containers are checked too.
+	ctr.imagePullFailureTimeout = time.Minute
+	pod := newImagePullPod(tfJob, 0, "", t)
+	pod.Status.InitContainerStatuses = []v1.ContainerStatus{{
+		Name:  "init",
+		Image: "busybox:missing",
+		State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "InvalidImageName"}},
+	}}
+	pods = []*v1.Pod{pod}
+	ctr.imagePullFailure(tfJob, pods)
+	fakeClock.Step(2 * time.Minute)
+	if msg := ctr.imagePullFailure(tfJob, pods); !strings.Contains(msg, "busybox:missing") {
+		t.Errorf("Expected the tfjob to fail on the image of the init container, got %q", msg)
+	}
+}
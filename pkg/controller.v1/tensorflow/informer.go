@@ -5,16 +5,23 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	metav1unstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
+	kubeinformers "k8s.io/client-go/informers"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	kubeclientset "k8s.io/client-go/kubernetes"
 	restclientset "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 
 	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
 	"github.com/kubeflow/tf-operator/pkg/apis/tensorflow/validation"
 	tfjobinformers "github.com/kubeflow/tf-operator/pkg/client/informers/externalversions"
+	"github.com/kubeflow/tf-operator/pkg/client/informers/externalversions/internalinterfaces"
 	tfjobinformersv1 "github.com/kubeflow/tf-operator/pkg/client/informers/externalversions/tensorflow/v1"
 	"github.com/kubeflow/tf-operator/pkg/common/util/v1/unstructured"
 	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
@@ -32,6 +39,12 @@ var (
 )
 
 func NewUnstructuredTFJobInformer(restConfig *restclientset.Config, namespace string) tfjobinformersv1.TFJobInformer {
+	return NewFilteredUnstructuredTFJobInformer(restConfig, namespace, nil)
+}
+
+// NewFilteredUnstructuredTFJobInformer returns an unstructured TFJob informer
+// whose list and watch requests are tweaked by tweakListOptions.
+func NewFilteredUnstructuredTFJobInformer(restConfig *restclientset.Config, namespace string, tweakListOptions internalinterfaces.TweakListOptionsFunc) tfjobinformersv1.TFJobInformer {
 	dclient, err := dynamic.NewForConfig(restConfig)
 	if err != nil {
 		panic(err)
@@ -43,16 +56,41 @@ func NewUnstructuredTFJobInformer(restConfig *restclientset.Config, namespace st
 		Resource: tfv1.Plural,
 	}
 
-	informer := unstructured.NewTFJobInformer(
+	informer := unstructured.NewFilteredTFJobInformer(
 		resource,
 		dclient,
 		namespace,
 		resyncPeriod,
 		cache.Indexers{},
+		tweakListOptions,
 	)
 	return informer
 }
 
+// NewShardedKubeInformerFactory returns a kube informer factory of the
+// namespace whose pod, service and ConfigMap informers are tweaked by
+// tweakListOptions, e.g. to only list and watch those of an operator shard.
+// The other informers of the factory, e.g. of the PodTemplates, the hook
+// Jobs or the Endpoints, are not filtered, since their objects do not carry
+// the labels of the tfjob.
+func NewShardedKubeInformerFactory(kubeClientSet kubeclientset.Interface, defaultResync time.Duration, namespace string, tweakListOptions func(*metav1.ListOptions)) kubeinformers.SharedInformerFactory {
+	factory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClientSet, defaultResync, kubeinformers.WithNamespace(namespace))
+	if tweakListOptions == nil {
+		return factory
+	}
+	indexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	factory.InformerFor(&v1.Pod{}, func(client kubeclientset.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredPodInformer(client, namespace, resyncPeriod, indexers, tweakListOptions)
+	})
+	factory.InformerFor(&v1.Service{}, func(client kubeclientset.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredServiceInformer(client, namespace, resyncPeriod, indexers, tweakListOptions)
+	})
+	factory.InformerFor(&v1.ConfigMap{}, func(client kubeclientset.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredConfigMapInformer(client, namespace, resyncPeriod, indexers, tweakListOptions)
+	})
+	return factory
+}
+
 // NewTFJobInformer returns TFJobInformer from the given factory.
 func (tc *TFController) NewTFJobInformer(tfJobInformerFactory tfjobinformers.SharedInformerFactory) tfjobinformersv1.TFJobInformer {
 	return tfJobInformerFactory.Kubeflow().V1().TFJobs()
@@ -64,9 +102,14 @@ func (tc *TFController) getTFJobFromName(namespace, name string) (*tfv1.TFJob, e
 }
 
 func (tc *TFController) getTFJobFromKey(key string) (*tfv1.TFJob, error) {
-	// Check if the key exists.
-	obj, exists, err := tc.tfJobInformer.GetIndexer().GetByKey(key)
 	logger := tflogger.LoggerForKey(key)
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		logger.Errorf("Failed to split TFJob key '%s': %+v", key, err)
+		return nil, errGetFromKey
+	}
+	// Check if the key exists.
+	obj, exists, err := tc.tfJobIndexerFor(namespace).GetByKey(key)
 	if err != nil {
 		logger.Errorf("Failed to get TFJob '%s' from informer index: %+v", key, err)
 		return nil, errGetFromKey
@@ -79,6 +122,38 @@ func (tc *TFController) getTFJobFromKey(key string) (*tfv1.TFJob, error) {
 	return tfJobFromUnstructured(obj)
 }
 
+// tfJobIndexerFor returns the indexer of the tfjob informer which watches the
+// given namespace, falling back to the default informer.
+func (tc *TFController) tfJobIndexerFor(namespace string) cache.Indexer {
+	if informer, ok := tc.tfJobInformers[namespace]; ok {
+		return informer.GetIndexer()
+	}
+	return tc.tfJobInformer.GetIndexer()
+}
+
+// isWatchedNamespace returns true if the operator is allowed to manage
+// tfjobs in the given namespace.
+func (tc *TFController) isWatchedNamespace(namespace string) bool {
+	return tc.watchedNamespaces.Len() == 0 || tc.watchedNamespaces.Has(namespace)
+}
+
+// matchesJobLabelSelector returns true if the tfjob belongs to the shard of
+// this operator. The informers already filter by the selector, this guards
+// the event handlers against tfjobs whose labels changed in the meantime.
+//
+// A tfjob which is relabeled from one operator shard to another is deleted
+// from the informer of the old shard and added to the one of the new shard,
+// since the informers are filtered by the API server. The old shard forgets
+// the expectations and the state of the tfjob with the deletion, and the new
+// shard starts without any. The pods and services keep the labels of the old
+// shard, so the new shard only sees them once they are relabeled together
+// with the tfjob, otherwise it fails to create them again because their
+// names are already taken. The services keep routing to the pods meanwhile,
+// since the shard labels are left out of their selectors.
+func (tc *TFController) matchesJobLabelSelector(tfjob *tfv1.TFJob) bool {
+	return tc.jobLabelSelector == nil || tc.jobLabelSelector.Matches(labels.Set(tfjob.Labels))
+}
+
 func tfJobFromUnstructured(obj interface{}) (*tfv1.TFJob, error) {
 	// Check if the spec is valid.
 	un, ok := obj.(*metav1unstructured.Unstructured)
@@ -2,16 +2,22 @@ package tensorflow
 
 import (
 	"fmt"
+	"math"
+	"sort"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	metav1unstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
 
 	common "github.com/kubeflow/common/job_controller/api/v1"
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
 	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/apis/tensorflow/validation"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
 	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
 	"github.com/kubeflow/tf-operator/pkg/util/k8sutil"
 	"github.com/prometheus/client_golang/prometheus"
@@ -21,9 +27,24 @@ import (
 
 const (
 	failedMarshalTFJobReason = "InvalidTFJobSpec"
+	// namespaceNotWatchedReason is the warning reason when a tfjob is observed
+	// outside of the namespaces the operator is scoped to.
+	namespaceNotWatchedReason = "NamespaceNotWatched"
+	// psGPURequestReason is the warning reason when the PS replicas of a
+	// tfjob request GPUs.
+	psGPURequestReason = "PSGPURequest"
 )
 
 var (
+	// tfReplicaTypes are all the replica types of a tfjob.
+	tfReplicaTypes = []tfv1.TFReplicaType{
+		tfv1.TFReplicaTypePS,
+		tfv1.TFReplicaTypeWorker,
+		tfv1.TFReplicaTypeChief,
+		tfv1.TFReplicaTypeMaster,
+		tfv1.TFReplicaTypeEval,
+	}
+
 	tfJobsCreatedCount = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "tf_operator_jobs_created_total",
 		Help: "Counts number of TF jobs created",
@@ -86,11 +107,29 @@ func (tc *TFController) addTFJob(obj interface{}) {
 		return
 	}
 
+	logger := tflogger.LoggerForJob(tfJob)
+	if !tc.isWatchedNamespace(tfJob.Namespace) {
+		msg := fmt.Sprintf("TFJob %s is ignored because namespace %s is not watched by the operator.",
+			tfJob.Name, tfJob.Namespace)
+		logger.Warn(msg)
+		tc.Recorder.Event(tfJob, v1.EventTypeWarning, namespaceNotWatchedReason, msg)
+		return
+	}
+	if !tc.matchesJobLabelSelector(tfJob) {
+		logger.Debugf("TFJob %s is ignored because it does not match the job label selector %q.",
+			tfJob.Name, tc.jobLabelSelector)
+		return
+	}
+
 	// Set default for the new tfjob.
 	scheme.Scheme.Default(tfJob)
+	if err := validation.ValidateV1PSResources(&tfJob.Spec); err != nil {
+		msg := fmt.Sprintf("TFJob %s requests GPUs for its PS replicas: %v", tfJob.Name, err)
+		logger.Warn(msg)
+		tc.Recorder.Event(tfJob, v1.EventTypeWarning, psGPURequestReason, msg)
+	}
 
 	msg := fmt.Sprintf("TFJob %s is created.", tfJob.Name)
-	logger := tflogger.LoggerForJob(tfJob)
 	logger.Info(msg)
 
 	// Add a created condition.
@@ -127,11 +166,20 @@ func (tc *TFController) updateTFJob(old, cur interface{}) {
 		return
 	}
 
+	if !tc.isWatchedNamespace(curTFJob.Namespace) {
+		log.Warnf("Ignoring update of tfjob %s outside of the watched namespaces", key)
+		return
+	}
+
 	log.Infof("Updating tfjob: %s", oldTFJob.Name)
-	tc.enqueueTFJob(cur)
+	if isSyncRequested(oldTFJob, curTFJob) {
+		tc.requestSync(key, curTFJob.Annotations[tfv1.AnnotationSyncRequest])
+	} else {
+		tc.enqueueTFJob(cur)
+	}
 
 	// check if need to add a new rsync for ActiveDeadlineSeconds
-	if curTFJob.Status.StartTime != nil {
+	if baseline := activeDeadlineBaseline(curTFJob); baseline != nil {
 		curTFJobADS := curTFJob.Spec.ActiveDeadlineSeconds
 		if curTFJobADS == nil {
 			return
@@ -139,7 +187,7 @@ func (tc *TFController) updateTFJob(old, cur interface{}) {
 		oldTFJobADS := oldTFJob.Spec.ActiveDeadlineSeconds
 		if oldTFJobADS == nil || *oldTFJobADS != *curTFJobADS {
 			now := metav1.Now()
-			start := curTFJob.Status.StartTime.Time
+			start := baseline.Time
 			passed := now.Time.Sub(start)
 			total := time.Duration(*curTFJobADS) * time.Second
 			// AddAfter will handle total < passed
@@ -149,32 +197,119 @@ func (tc *TFController) updateTFJob(old, cur interface{}) {
 	}
 }
 
-func (tc *TFController) deletePodsAndServices(tfJob *tfv1.TFJob, pods []*v1.Pod) error {
-	if len(pods) == 0 {
-		return nil
+// When a tfjob is deleted, drop its expectations and in-memory state and
+// enqueue it.
+// obj could be an *unstructured.Unstructured, or a DeletionFinalStateUnknown marker item.
+func (tc *TFController) handleDeletedTFJob(obj interface{}) {
+	key, err := KeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("couldn't get key for tfjob object %#v: %v", obj, err))
+		return
 	}
+	tc.forgetTFJob(key)
+	// This will enter the sync loop and no-op,
+	// because the tfjob has been deleted from the store.
+	tc.enqueueTFJob(obj)
+}
+
+// forgetTFJob drops the expectations and all the in-memory state the
+// controller keeps for the tfjob with the given key, once it is deleted.
+func (tc *TFController) forgetTFJob(key string) {
+	tc.deleteExpectations(key)
+	tc.forgetPodCreationRampUp(key)
+	tc.forgetUnschedulablePods(key)
+	tc.forgetChangedPodTemplates(key)
+	tc.forgetFirstPodRunning(key)
+	tc.forgetRecentEvents(key)
+	tc.forgetExternalDeletions(key)
+	tc.forgetServiceDNS(key)
+	tc.forgetStrandedPods(key)
+	tc.forgetImagePullFailures(key)
+	tc.forgetRecordExports(key)
+	tc.forgetSyncCounts(key)
+	tc.forgetAudit(key)
+	tc.forgetObservedReplicas(key)
+	tc.forgetReplicaAttempts(key)
+	tc.forgetNodeFailureDeletions(key)
+}
 
-	// Delete nothing when the cleanPodPolicy is None.
-	if *tfJob.Spec.CleanPodPolicy == common.CleanPodPolicyNone {
+// deleteExpectations removes the pod and service expectations of every
+// replica type of the tfjob with the given key. The spec of a deleted tfjob
+// may no longer be available, so all the replica types are covered.
+func (tc *TFController) deleteExpectations(key string) {
+	for _, rtype := range tfReplicaTypes {
+		tc.Expectations.DeleteExpectations(jobcontroller.GenExpectationPodsKey(key, string(rtype)))
+		tc.Expectations.DeleteExpectations(jobcontroller.GenExpectationServicesKey(key, string(rtype)))
+	}
+	tc.Expectations.DeleteExpectations(hookExpectationsKey(key))
+	tc.updateExpectationsCount()
+}
+
+// updateExpectationsCount reports the size of the expectations store.
+func (tc *TFController) updateExpectationsCount() {
+	if store, ok := tc.Expectations.(jobcontroller.TimestampedExpectations); ok {
+		expectationsCount.Set(float64(len(store.ListKeys())))
+	}
+}
+
+func (tc *TFController) deletePodsAndServices(tfJob *tfv1.TFJob, pods []*v1.Pod) error {
+	if len(pods) == 0 {
 		return nil
 	}
 
-	for _, pod := range pods {
-		if *tfJob.Spec.CleanPodPolicy == common.CleanPodPolicyRunning && pod.Status.Phase != v1.PodRunning {
-			continue
-		}
-		if err := tc.PodControl.DeletePod(pod.Namespace, pod.Name, tfJob); err != nil {
+	for _, pod := range podsToTearDown(tfJob, pods) {
+		if seconds, ok := terminationGracePeriod(tfJob, pod.Labels[tfReplicaTypeLabel]); ok {
+			// The grace period is passed explicitly, so that it applies to
+			// the pods created before it was set as well.
+			if err := tc.gracefulDeletePod(tfJob, pod, seconds); err != nil {
+				return err
+			}
+		} else if err := tc.deletePod(tfJob, pod); err != nil {
 			return err
 		}
 		// Pod and service have the same name, thus the service could be deleted using pod's name.
 		if err := tc.ServiceControl.DeleteService(pod.Namespace, pod.Name, tfJob); err != nil {
 			return err
 		}
+		tc.audit(tfJob, "delete service %s", pod.Name)
+		if err := tc.deleteVolumeClaims(tfJob, pod); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// shouldCleanPod returns true if the pod of the terminated tfjob is deleted
+// according to its cleanPodPolicy. The running replicas which do not hold back
+// the success of the tfjob, e.g. an Evaluator which never exits, are deleted
+// whatever the cleanPodPolicy once it succeeded.
+func shouldCleanPod(tfJob *tfv1.TFJob, pod *v1.Pod) bool {
+	if pod.Status.Phase == v1.PodRunning && isSucceeded(tfJob.Status.JobStatus) && isIgnoredForSuccessPod(tfJob, pod) {
+		return true
+	}
+	switch *tfJob.Spec.CleanPodPolicy {
+	case common.CleanPodPolicyNone:
+		return false
+	case common.CleanPodPolicyRunning:
+		return pod.Status.Phase == v1.PodRunning
+	}
+	return true
+}
+
 func (tc *TFController) cleanupTFJob(tfJob *tfv1.TFJob) error {
+	// The cluster spec is not needed anymore once the tfjob is terminated.
+	if err := tc.deleteClusterSpecConfigMap(tfJob); err != nil {
+		tflogger.LoggerForJob(tfJob).Warnf("Cleanup cluster spec configmap error: %v.", err)
+		return err
+	}
+	if err := tc.deletePodDisruptionBudget(tfJob); err != nil {
+		tflogger.LoggerForJob(tfJob).Warnf("Cleanup poddisruptionbudget error: %v.", err)
+		return err
+	}
+	if isHookPending(tfJob) {
+		// The tfjob is cleaned up once its hook has finished, which syncs it.
+		return nil
+	}
 	currentTime := time.Now()
 	ttl := tfJob.Spec.TTLSecondsAfterFinished
 	if ttl == nil {
@@ -183,6 +318,13 @@ func (tc *TFController) cleanupTFJob(tfJob *tfv1.TFJob) error {
 	}
 	duration := time.Second * time.Duration(*ttl)
 	if currentTime.After(tfJob.Status.CompletionTime.Add(duration)) {
+		// The tfjob is synced again once its record is exported.
+		if exported, err := tc.exportRecord(tfJob); err != nil {
+			tflogger.LoggerForJob(tfJob).Warnf("Export TFJob record error: %v.", err)
+			return err
+		} else if !exported {
+			return nil
+		}
 		err := tc.deleteTFJobHandler(tfJob)
 		if err != nil {
 			tflogger.LoggerForJob(tfJob).Warnf("Cleanup TFJob error: %v.", err)
@@ -204,18 +346,61 @@ func (tc *TFController) deleteTFJob(tfJob *tfv1.TFJob) error {
 	return tc.tfJobClientSet.KubeflowV1().TFJobs(tfJob.Namespace).Delete(tfJob.Name, &metav1.DeleteOptions{})
 }
 
-func getTotalReplicas(tfjob *tfv1.TFJob) int32 {
-	tfjobReplicas := int32(0)
+// getTotalReplicas returns the number of replicas of the tfjob. It is summed
+// as an int64 so that it cannot overflow, whatever the replicas of the spec.
+func getTotalReplicas(tfjob *tfv1.TFJob) int64 {
+	tfjobReplicas := int64(0)
 	for _, r := range tfjob.Spec.TFReplicaSpecs {
-		tfjobReplicas += *r.Replicas
+		if r.Replicas != nil {
+			tfjobReplicas += int64(*r.Replicas)
+		}
 	}
 	return tfjobReplicas
 }
 
-func getTotalFailedReplicas(tfjob *tfv1.TFJob) int32 {
-	totalFailedReplicas := int32(0)
+// getTotalFailedReplicas returns the number of failed replicas of the tfjob,
+// leaving out the ones whose failures are ignored.
+func getTotalFailedReplicas(tfjob *tfv1.TFJob) int64 {
+	totalFailedReplicas := int64(0)
 	for rtype := range tfjob.Status.ReplicaStatuses {
-		totalFailedReplicas += tfjob.Status.ReplicaStatuses[rtype].Failed
+		if ignoresFailures(tfjob, tfv1.TFReplicaType(rtype)) {
+			continue
+		}
+		totalFailedReplicas += int64(tfjob.Status.ReplicaStatuses[rtype].Failed)
 	}
 	return totalFailedReplicas
 }
+
+// maxReplicasOption returns the maximum total number of replicas of a tfjob
+// from --max-replicas, which is at most math.MaxInt32 so that the total fits
+// in the int32 fields of the API, and the default if it is not positive.
+func maxReplicasOption(maxReplicas int) int64 {
+	if maxReplicas <= 0 {
+		return options.DefaultMaxReplicas
+	}
+	if int64(maxReplicas) > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int64(maxReplicas)
+}
+
+// invalidReplicaCount returns why the tfjob is rejected if one of its replica
+// types has a negative number of replicas, or if it has more replicas in
+// total than the operator allows, or an empty string otherwise.
+func (tc *TFController) invalidReplicaCount(tfjob *tfv1.TFJob) string {
+	rtypes := make([]string, 0, len(tfjob.Spec.TFReplicaSpecs))
+	for rtype := range tfjob.Spec.TFReplicaSpecs {
+		rtypes = append(rtypes, string(rtype))
+	}
+	sort.Strings(rtypes)
+	for _, rtype := range rtypes {
+		spec := tfjob.Spec.TFReplicaSpecs[tfv1.TFReplicaType(rtype)]
+		if spec.Replicas != nil && *spec.Replicas < 0 {
+			return fmt.Sprintf("TFJob %s is invalid: %s has %d replicas.", tfjob.Name, rtype, *spec.Replicas)
+		}
+	}
+	if total := getTotalReplicas(tfjob); total > tc.maxReplicas {
+		return fmt.Sprintf("TFJob %s is invalid: it has %d replicas, more than the maximum of %d.", tfjob.Name, total, tc.maxReplicas)
+	}
+	return ""
+}
@@ -15,14 +15,23 @@
 package tensorflow
 
 import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"strings"
 	"testing"
 	"time"
 
 	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/sets"
 	kubeclientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/kubernetes/pkg/controller"
 
@@ -30,6 +39,7 @@ import (
 	common "github.com/kubeflow/common/job_controller/api/v1"
 	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
 	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
 	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
 	"github.com/kubeflow/tf-operator/pkg/control"
 )
@@ -105,6 +115,206 @@ func TestAddTFJob(t *testing.T) {
 	close(stopCh)
 }
 
+func TestJobLabelSelector(t *testing.T) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	option := options.ServerOption{
+		JobLabelSelector: "shard=0",
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, _, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, option)
+	fakePodControl := &controller.FakePodControl{}
+	ctr.PodControl = fakePodControl
+	fakeServiceControl := &control.FakeServiceControl{}
+	ctr.ServiceControl = fakeServiceControl
+
+	other := testutil.NewTFJob(1, 0)
+	other.Labels = map[string]string{"shard": "1"}
+	unstructured, err := testutil.ConvertTFJobToUnstructured(other)
+	if err != nil {
+		t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	ctr.addTFJob(unstructured)
+	if ctr.WorkQueue.Len() != 0 {
+		t.Errorf("Expected the TFJob of another shard to be ignored, got %d queued", ctr.WorkQueue.Len())
+	}
+
+	tfJob := other.DeepCopy()
+	tfJob.Labels["shard"] = "0"
+	unstructured, err = testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	ctr.addTFJob(unstructured)
+	if ctr.WorkQueue.Len() != 1 {
+		t.Errorf("Expected the TFJob of the shard to be queued, got %d queued", ctr.WorkQueue.Len())
+	}
+
+	// The shard label is propagated to the pods and services.
+	spec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker]
+	if err := ctr.createNewPod(tfJob, testutil.LabelWorker, "0", spec, false); err != nil {
+		t.Errorf("Unexpected error when creating the pod: %v", err)
+	}
+	if err := ctr.createNewService(tfJob, tfv1.TFReplicaTypeWorker, "0", spec); err != nil {
+		t.Errorf("Unexpected error when creating the service: %v", err)
+	}
+	if len(fakePodControl.Templates) != 1 || fakePodControl.Templates[0].Labels["shard"] != "0" {
+		t.Errorf("Expected the pod to carry the shard label, got %v", fakePodControl.Templates)
+	}
+	if len(fakeServiceControl.Templates) != 1 || fakeServiceControl.Templates[0].Labels["shard"] != "0" {
+		t.Errorf("Expected the service to carry the shard label, got %v", fakeServiceControl.Templates)
+	}
+
+	// The shard label is left out of the service selector, and a service
+	// selecting it is not recreated.
+	desired := ctr.newService(tfJob, tfv1.TFReplicaTypeWorker, "0")
+	if _, ok := desired.Spec.Selector["shard"]; ok {
+		t.Errorf("Expected the service selector without the shard label, got %v", desired.Spec.Selector)
+	}
+	service := desired.DeepCopy()
+	service.Spec.Selector = desired.Labels
+	if drift := ctr.serviceDrift(tfJob, service, desired); drift != "" {
+		t.Errorf("Expected no drift of a service selecting the shard label, got %s", drift)
+	}
+}
+
+func TestDeleteExpectations(t *testing.T) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, _, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, options.ServerOption{})
+
+	for i := 0; i < 100; i++ {
+		tfJob := testutil.NewTFJob(2, 1)
+		tfJob.Name = fmt.Sprintf("tfjob-%d", i)
+		key := testutil.GetKey(tfJob, t)
+		for _, rt := range []string{testutil.LabelWorker, testutil.LabelPS} {
+			if err := ctr.Expectations.ExpectCreations(jobcontroller.GenExpectationPodsKey(key, rt), 1); err != nil {
+				t.Errorf("Unexpected error when setting expectations: %v", err)
+			}
+			if err := ctr.Expectations.ExpectCreations(jobcontroller.GenExpectationServicesKey(key, rt), 1); err != nil {
+				t.Errorf("Unexpected error when setting expectations: %v", err)
+			}
+		}
+
+		// Half of the deletions are observed by the informer, the other half
+		// are only noticed when the tfjob is synced.
+		if i%2 == 0 {
+			unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+			if err != nil {
+				t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+			}
+			ctr.handleDeletedTFJob(cache.DeletedFinalStateUnknown{Key: key, Obj: unstructured})
+		} else if _, err := ctr.syncTFJob(key); err != nil {
+			t.Errorf("Unexpected error when syncing the deleted TFJob: %v", err)
+		}
+	}
+
+	store := ctr.Expectations.(jobcontroller.TimestampedExpectations)
+	if keys := store.ListKeys(); len(keys) != 0 {
+		t.Errorf("Expected the expectations store to be empty, got %d entries: %v", len(keys), keys)
+	}
+}
+
+func TestForgetTFJob(t *testing.T) {
+	for _, informer := range []bool{true, false} {
+		ctr, _, _ := newErrorsTestController()
+		tfJob := testutil.NewTFJob(2, 1)
+		key := testutil.GetKey(tfJob, t)
+
+		ctr.lastRampUpBatches[key] = time.Now()
+		ctr.lastUnschedulableEvents[key] = time.Now()
+		ctr.changedPodTemplates[key] = sets.NewString(testutil.LabelWorker)
+		ctr.firstPodRunningObserved.Insert(key)
+		ctr.recentEvents[key] = map[replicaEvent]time.Time{}
+		ctr.externalDeletions[key] = &externalDeletions{}
+		ctr.serviceDNSGates[key] = &serviceDNSGate{}
+		ctr.strandedPods[key] = 1
+		ctr.imagePullFailures[key] = map[types.UID]time.Time{}
+		ctr.recordExports[key] = &recordExport{}
+		ctr.syncCounts[tfJob.UID] = &syncCount{key: key}
+		ctr.auditTrails[key] = &auditTrail{}
+		ctr.observedReplicas[key] = map[tfv1.TFReplicaType]int{}
+
+		// The deletion is either observed by the informer, or only noticed
+		// when the tfjob is processed.
+		if informer {
+			unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+			if err != nil {
+				t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+			}
+			ctr.handleDeletedTFJob(cache.DeletedFinalStateUnknown{Key: key, Obj: unstructured})
+		} else {
+			ctr.WorkQueue.Add(key)
+			ctr.processNextWorkItem()
+		}
+
+		for name, size := range map[string]int{
+			"lastRampUpBatches":       len(ctr.lastRampUpBatches),
+			"lastUnschedulableEvents": len(ctr.lastUnschedulableEvents),
+			"changedPodTemplates":     len(ctr.changedPodTemplates),
+			"firstPodRunningObserved": ctr.firstPodRunningObserved.Len(),
+			"recentEvents":            len(ctr.recentEvents),
+			"externalDeletions":       len(ctr.externalDeletions),
+			"serviceDNSGates":         len(ctr.serviceDNSGates),
+			"strandedPods":            len(ctr.strandedPods),
+			"imagePullFailures":       len(ctr.imagePullFailures),
+			"recordExports":           len(ctr.recordExports),
+			"syncCounts":              len(ctr.syncCounts),
+			"auditTrails":             len(ctr.auditTrails),
+			"observedReplicas":        len(ctr.observedReplicas),
+		} {
+			if size != 0 {
+				t.Errorf("informer %v: expected %s to be empty after the deletion, got %d entries", informer, name, size)
+			}
+		}
+	}
+}
+
 func TestCopyLabelsAndAnnotation(t *testing.T) {
 	// Prepare the clientset and controller for the test.
 	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
@@ -694,6 +904,52 @@ func TestActiveDeadlineSeconds(t *testing.T) {
 	}
 }
 
+func TestRequeueAtActiveDeadline(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	defer ctr.WorkQueue.ShutDown()
+	queue := &delayRecordingQueue{RateLimitingInterface: ctr.WorkQueue, delays: make(map[interface{}]time.Duration)}
+	ctr.WorkQueue = queue
+	fakeClock := clock.NewFakeClock(time.Now())
+	ctr.clock = fakeClock
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+
+	ads := int64(60)
+	tfJob := testutil.NewTFJobWithActiveDeadlineSeconds(0, 2, 0, &ads)
+	startTime := metav1.NewTime(fakeClock.Now().Add(-45 * time.Second))
+	tfJob.Status.StartTime = &startTime
+	testutil.SetPodsStatuses(ctr.podIndexer, tfJob, testutil.LabelWorker, 0, 2, 0, 0, nil, t)
+	key := testutil.GetKey(tfJob, t)
+
+	// The tfjob is synced again when its deadline passes.
+	if err := ctr.reconcileTFJobs(tfJob); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if delay := queue.delays[key]; delay != 15*time.Second {
+		t.Errorf("Expected the tfjob to be requeued after 15s, got %v", delay)
+	}
+	if testutil.CheckCondition(tfJob, common.JobFailed, tfJobFailedReason) {
+		t.Fatalf("Expected the tfjob to run within its deadline, got %v", tfJob.Status.Conditions)
+	}
+
+	// The sync at the deadline fails the tfjob.
+	delete(queue.delays, key)
+	fakeClock.Step(15 * time.Second)
+	if err := ctr.reconcileTFJobs(tfJob); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if !testutil.CheckCondition(tfJob, common.JobFailed, tfJobFailedReason) {
+		t.Errorf("Expected the tfjob to fail at its deadline, got %v", tfJob.Status.Conditions)
+	}
+	if len(fakePodControl.DeletePodName) != 2 {
+		t.Errorf("Expected the pods to be deleted, got %v", fakePodControl.DeletePodName)
+	}
+	if delay, ok := queue.delays[key]; ok {
+		t.Errorf("Expected no requeue for the deadline once past, got %v", delay)
+	}
+}
+
 func TestBackoffForOnFailure(t *testing.T) {
 	type testCase struct {
 		description string
@@ -814,3 +1070,286 @@ func TestBackoffForOnFailure(t *testing.T) {
 		}
 	}
 }
+
+func TestBackoffForAlways(t *testing.T) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, kubeInformerFactory, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, options.ServerOption{})
+	fakePodControl := &controller.FakePodControl{}
+	ctr.PodControl = fakePodControl
+	ctr.ServiceControl = &control.FakeServiceControl{}
+	ctr.Recorder = &record.FakeRecorder{}
+	var actual *tfv1.TFJob
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		actual = tfJob
+		return nil
+	}
+
+	backoffLimit := int32(3)
+	tfJob := testutil.NewTFJob(2, 0)
+	tfJob.Spec.BackoffLimit = &backoffLimit
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].RestartPolicy = common.RestartPolicyAlways
+	unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+		t.Errorf("Failed to add tfjob to tfJobIndexer: %v", err)
+	}
+
+	// The kubelet keeps restarting the crashing container of worker 1.
+	podIndexer := kubeInformerFactory.Core().V1().Pods().Informer().GetIndexer()
+	testutil.SetPodsStatuses(podIndexer, tfJob, testutil.LabelWorker, 0, 1, 0, 0, []int32{1}, t)
+	crashing := testutil.NewPod(tfJob, testutil.LabelWorker, 1, t)
+	crashing.Status.Phase = v1.PodRunning
+	crashing.Status.ContainerStatuses = []v1.ContainerStatus{{
+		Name:         tfv1.DefaultContainerName,
+		RestartCount: 2,
+		State: v1.ContainerState{
+			Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+		},
+		LastTerminationState: v1.ContainerState{
+			Terminated: &v1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"},
+		},
+	}}
+	if err := podIndexer.Add(crashing); err != nil {
+		t.Errorf("Unexpected error when adding pod %v", err)
+	}
+
+	if _, err := ctr.syncTFJob(testutil.GetKey(tfJob, t)); err != nil {
+		t.Errorf("Unexpected error when syncing jobs %v", err)
+	}
+	if actual == nil || !testutil.CheckCondition(actual, common.JobFailed, tfJobBackoffLimitExceededReason) {
+		t.Fatalf("Expected the tfjob to fail with reason %s, got %v", tfJobBackoffLimitExceededReason, actual)
+	}
+	cond := getCondition(actual.Status.JobStatus, common.JobFailed)
+	expected := "container tensorflow of pod worker-1 restarted 2 times, last exited with code 1 (Error), now CrashLoopBackOff"
+	if !strings.Contains(cond.Message, expected) {
+		t.Errorf("Expected the failed condition to explain the restarts, got %q", cond.Message)
+	}
+	if len(fakePodControl.DeletePodName) != 2 {
+		t.Errorf("Expected the 2 pods to be deleted, got %v", fakePodControl.DeletePodName)
+	}
+}
+
+func TestReplicaAccountingExtremeValues(t *testing.T) {
+	extremes := []int32{0, 1, 2, math.MaxInt32 - 1, math.MaxInt32}
+	rtypes := []tfv1.TFReplicaType{
+		tfv1.TFReplicaTypeChief, tfv1.TFReplicaTypeWorker, tfv1.TFReplicaTypePS, tfv1.TFReplicaTypeEval,
+	}
+	ctr := &TFController{maxReplicas: options.DefaultMaxReplicas}
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		tfJob := testutil.NewTFJob(0, 0)
+		tfJob.Spec.TFReplicaSpecs = make(map[tfv1.TFReplicaType]*common.ReplicaSpec)
+		tfJob.Status.ReplicaStatuses = make(map[common.ReplicaType]*common.ReplicaStatus)
+		expectedReplicas := new(big.Int)
+		expectedFailed := new(big.Int)
+		for _, rtype := range rtypes {
+			if random.Intn(4) == 0 {
+				continue
+			}
+			replicas := extremes[random.Intn(len(extremes))]
+			if random.Intn(2) == 0 {
+				replicas = random.Int31()
+			}
+			failed := extremes[random.Intn(len(extremes))]
+			tfJob.Spec.TFReplicaSpecs[rtype] = &common.ReplicaSpec{Replicas: &replicas}
+			tfJob.Status.ReplicaStatuses[common.ReplicaType(rtype)] = &common.ReplicaStatus{Failed: failed}
+			expectedReplicas.Add(expectedReplicas, big.NewInt(int64(replicas)))
+			expectedFailed.Add(expectedFailed, big.NewInt(int64(failed)))
+		}
+
+		total := getTotalReplicas(tfJob)
+		if total != expectedReplicas.Int64() {
+			t.Fatalf("Expected %v replicas in total, got %d", expectedReplicas, total)
+		}
+		if failed := getTotalFailedReplicas(tfJob); failed != expectedFailed.Int64() {
+			t.Fatalf("Expected %v failed replicas in total, got %d", expectedFailed, failed)
+		}
+		msg := ctr.invalidReplicaCount(tfJob)
+		if (msg != "") != (total > options.DefaultMaxReplicas) {
+			t.Fatalf("Unexpected decision %q for %d replicas", msg, total)
+		}
+	}
+
+	// A negative number of replicas is rejected as well.
+	tfJob := testutil.NewTFJob(1, 0)
+	negative := int32(math.MinInt32)
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypePS] = &common.ReplicaSpec{Replicas: &negative}
+	if msg := ctr.invalidReplicaCount(tfJob); msg == "" {
+		t.Errorf("Expected %d replicas to be rejected", negative)
+	}
+}
+
+func TestMaxReplicasOption(t *testing.T) {
+	testCases := []struct {
+		option   int
+		expected int64
+	}{
+		{option: 0, expected: options.DefaultMaxReplicas},
+		{option: -1, expected: options.DefaultMaxReplicas},
+		{option: 3, expected: 3},
+		{option: math.MaxInt32, expected: math.MaxInt32},
+		{option: math.MaxInt64, expected: math.MaxInt32},
+	}
+	for _, c := range testCases {
+		if actual := maxReplicasOption(c.option); actual != c.expected {
+			t.Errorf("Expected --max-replicas=%d to allow %d replicas, got %d", c.option, c.expected, actual)
+		}
+	}
+}
+
+func TestMaxReplicas(t *testing.T) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+
+	testCases := []struct {
+		description string
+		maxReplicas int
+		worker      int32
+		ps          int32
+		rejected    bool
+	}{
+		{"A tfjob at the maximum is created", 3, 2, 1, false},
+		{"A tfjob above the maximum is rejected", 3, 3, 1, true},
+		{"A tfjob with the largest replicas is rejected", 0, math.MaxInt32, math.MaxInt32, true},
+	}
+	for _, c := range testCases {
+		tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+		ctr, _, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, options.ServerOption{
+			MaxReplicas: c.maxReplicas,
+		})
+		fakePodControl := &controller.FakePodControl{}
+		ctr.PodControl = fakePodControl
+		ctr.ServiceControl = &control.FakeServiceControl{}
+		ctr.Recorder = &record.FakeRecorder{}
+		var actual *tfv1.TFJob
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			actual = tfJob
+			return nil
+		}
+
+		tfJob := testutil.NewTFJob(1, 1)
+		tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Replicas = &c.worker
+		tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypePS].Replicas = &c.ps
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+		}
+		if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+			t.Errorf("Failed to add tfjob to tfJobIndexer: %v", err)
+		}
+
+		if _, err := ctr.syncTFJob(testutil.GetKey(tfJob, t)); err != nil {
+			t.Errorf("%s: unexpected error when syncing jobs %v", c.description, err)
+		}
+		if c.rejected {
+			if actual == nil || !testutil.CheckCondition(actual, common.JobFailed, tfJobInvalidSpecReason) {
+				t.Errorf("%s: expected the tfjob to fail with reason %s, got %v", c.description, tfJobInvalidSpecReason, actual)
+			}
+			if len(fakePodControl.Templates) != 0 {
+				t.Errorf("%s: expected no pod to be created, got %d", c.description, len(fakePodControl.Templates))
+			}
+		} else if len(fakePodControl.Templates) != int(c.worker+c.ps) {
+			t.Errorf("%s: expected %d pods to be created, got %d", c.description, c.worker+c.ps, len(fakePodControl.Templates))
+		}
+	}
+}
+
+func TestBackoffLimitCountsRecreatedPods(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+
+	backoffLimit := int32(2)
+	tfJob := testutil.NewTFJob(1, 0)
+	tfJob.Spec.BackoffLimit = &backoffLimit
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].RestartPolicy = common.RestartPolicyExitCode
+
+	// The worker fails with a retryable exit code and is recreated each time,
+	// so that the restart count of its container stays 0.
+	for restarts := int32(1); restarts <= backoffLimit; restarts++ {
+		pod := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+		pod.Status.Phase = v1.PodFailed
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+			Name: tfv1.DefaultContainerName,
+			State: v1.ContainerState{
+				Terminated: &v1.ContainerStateTerminated{ExitCode: 130},
+			},
+		}}
+		if err := ctr.podIndexer.Add(pod); err != nil {
+			t.Fatalf("Unexpected error when adding pod %v", err)
+		}
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+		}
+		if got := tfJob.Status.ReplicaRestarts[tfv1.TFReplicaTypeWorker]; got != restarts {
+			t.Errorf("Expected %d recorded restarts, got %d", restarts, got)
+		}
+		if hasCondition(tfJob.Status.JobStatus, common.JobFailed) {
+			t.Fatalf("Expected the tfjob not to fail after %d restarts, got %v", restarts, tfJob.Status.Conditions)
+		}
+		if err := ctr.podIndexer.Delete(pod); err != nil {
+			t.Fatalf("Unexpected error when deleting pod %v", err)
+		}
+	}
+
+	// The restarts survive the recreations and reach the backoff limit.
+	if err := ctr.reconcileTFJobs(tfJob); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if !testutil.CheckCondition(tfJob, common.JobFailed, tfJobBackoffLimitExceededReason) {
+		t.Fatalf("Expected the tfjob to fail with reason %s, got %v", tfJobBackoffLimitExceededReason, tfJob.Status.Conditions)
+	}
+	cond := getCondition(tfJob.Status.JobStatus, common.JobFailed)
+	if expected := "the failed pods of Worker were recreated 2 times"; !strings.Contains(cond.Message, expected) {
+		t.Errorf("Expected the failed condition to explain the recreations, got %q", cond.Message)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
+)
+
+const (
+	// tfJobMixedModeReason is added in a tfjob while it manages pods or
+	// services created by the v1beta2 operator.
+	tfJobMixedModeReason = "LegacyReplicasAdopted"
+	// tfJobMixedModeEndedReason is added in a tfjob once the pods and
+	// services created by the v1beta2 operator are gone.
+	tfJobMixedModeEndedReason = "LegacyReplicasGone"
+)
+
+// isLegacyObject returns true if the pod or service was created for the
+// tfjob by the v1beta2 operator: it is controlled by the tfjob, but only
+// labeled with the group name and the deprecated tfjob name, without the job
+// and controller names the v1 operator adds. The v1beta2 operator labeled the
+// replica types and indexes, and named the pods, the services and the
+// tensorflow containers, like the v1 operator, so that its pods are sliced,
+// their restarts counted and their success detected like the others.
+func isLegacyObject(tfjob *tfv1.TFJob, obj metav1.Object) bool {
+	objLabels := obj.GetLabels()
+	if _, ok := objLabels[jobcontroller.JobNameLabel]; ok {
+		return false
+	}
+	return metav1.IsControlledBy(obj, tfjob) && objLabels[labelGroupName] == tfv1.GroupName &&
+		objLabels[labelTFJobName] == tfjob.Name
+}
+
+// genLegacyLabels returns the labels the v1beta2 operator set on the pods
+// and services of the tfjob, which their services select.
+func genLegacyLabels(tfjob *tfv1.TFJob) map[string]string {
+	return map[string]string{
+		labelGroupName: tfv1.GroupName,
+		labelTFJobName: tfjob.Name,
+	}
+}
+
+// excludeLegacyPods returns the pods which were not created by the v1beta2
+// operator, unless the v1beta2 compatibility mode is disabled.
+func (tc *TFController) excludeLegacyPods(tfjob *tfv1.TFJob, pods []*v1.Pod) []*v1.Pod {
+	if !tc.v1beta2Compatibility {
+		return pods
+	}
+	var kept []*v1.Pod
+	for _, pod := range pods {
+		if !isLegacyObject(tfjob, pod) {
+			kept = append(kept, pod)
+		}
+	}
+	return kept
+}
+
+// getServicesForTFJob returns the services of the tfjob, see
+// GetServicesForJob. In the v1beta2 compatibility mode, the services created
+// by the v1beta2 operator are kept instead of being released because they
+// do not match the selector of the tfjob.
+func (tc *TFController) getServicesForTFJob(tfjob *tfv1.TFJob) ([]*v1.Service, error) {
+	if !tc.v1beta2Compatibility {
+		return tc.GetServicesForJob(tfjob)
+	}
+	candidates, err := tc.ServiceLister.Services(tfjob.Namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var legacy []*v1.Service
+	others := make([]*v1.Service, 0, len(candidates))
+	for _, service := range candidates {
+		if isLegacyObject(tfjob, service) {
+			legacy = append(legacy, service)
+			continue
+		}
+		others = append(others, service)
+	}
+	services, err := tc.ClaimServices(tfjob, others)
+	if err != nil {
+		return nil, err
+	}
+	return append(services, legacy...), nil
+}
+
+// desiredServiceSelector returns the selector the service of the replica
+// must have: the one the v1beta2 operator gave it for its own services in the
+// v1beta2 compatibility mode, so that they are not recreated, else the one of
+// the desired service.
+func (tc *TFController) desiredServiceSelector(tfjob *tfv1.TFJob, service, desired *v1.Service) map[string]string {
+	if !tc.v1beta2Compatibility || !isLegacyObject(tfjob, service) {
+		return desired.Spec.Selector
+	}
+	selector := genLegacyLabels(tfjob)
+	selector[tfReplicaTypeLabel] = desired.Labels[tfReplicaTypeLabel]
+	selector[tfReplicaIndexLabel] = desired.Labels[tfReplicaIndexLabel]
+	return selector
+}
+
+// updateMixedModeCondition sets the MixedMode condition of the tfjob while
+// it manages pods or services created by the v1beta2 operator, and clears it
+// once they are all gone.
+func (tc *TFController) updateMixedModeCondition(tfjob *tfv1.TFJob, pods []*v1.Pod, services []*v1.Service) {
+	if !tc.v1beta2Compatibility {
+		return
+	}
+	legacyPods, legacyServices := 0, 0
+	for _, pod := range pods {
+		if isLegacyObject(tfjob, pod) {
+			legacyPods++
+		}
+	}
+	for _, service := range services {
+		if isLegacyObject(tfjob, service) {
+			legacyServices++
+		}
+	}
+	if legacyPods > 0 || legacyServices > 0 {
+		msg := fmt.Sprintf("TFJob %s manages %d pod(s) and %d service(s) created by the v1beta2 operator, its new pods and services follow the v1 conventions.",
+			tfjob.Name, legacyPods, legacyServices)
+		setCondition(&tfjob.Status.JobStatus, newCondition(tfv1.JobMixedMode, tfJobMixedModeReason, msg))
+		return
+	}
+	if hasCondition(tfjob.Status.JobStatus, tfv1.JobMixedMode) {
+		msg := fmt.Sprintf("TFJob %s no longer manages pods or services created by the v1beta2 operator.", tfjob.Name)
+		condition := newCondition(tfv1.JobMixedMode, tfJobMixedModeEndedReason, msg)
+		condition.Status = v1.ConditionFalse
+		setCondition(&tfjob.Status.JobStatus, condition)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/controller"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
+)
+
+// legacyObjectMeta returns the metadata the v1beta2 operator gave to the pod
+// and the service of the replica of the tfjob.
+func legacyObjectMeta(tfJob *tfv1.TFJob, rt string, index int) metav1.ObjectMeta {
+	labels := genLegacyLabels(tfJob)
+	labels[tfReplicaTypeLabel] = rt
+	labels[tfReplicaIndexLabel] = strconv.Itoa(index)
+	isController := true
+	return metav1.ObjectMeta{
+		Name:      tfJob.Name + "-" + rt + "-" + strconv.Itoa(index),
+		Namespace: tfJob.Namespace,
+		Labels:    labels,
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: "kubeflow.org/v1beta2",
+			Kind:       tfv1.Kind,
+			Name:       tfJob.Name,
+			UID:        tfJob.UID,
+			Controller: &isController,
+		}},
+	}
+}
+
+func TestV1beta2Compatibility(t *testing.T) {
+	type testCase struct {
+		description    string
+		compatibility  bool
+		worker0Exited  bool
+		expectedChurn  bool
+		expectedStatus common.JobConditionType
+	}
+	testCases := []testCase{
+		{"The running legacy replicas are managed without churn", true, false, false, common.JobRunning},
+		{"The success of a legacy worker is detected", true, true, false, common.JobSucceeded},
+		{"The legacy services are released without the compatibility mode", false, false, true, common.JobRunning},
+	}
+	for _, c := range testCases {
+		ctr, kubeInformerFactory := newNoOpTestController()
+		ctr.v1beta2Compatibility = c.compatibility
+		fakePodControl := ctr.PodControl.(*controller.FakePodControl)
+		fakeServiceControl := ctr.ServiceControl.(*control.FakeServiceControl)
+		var status *tfv1.TFJobStatus
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			status = tfJob.Status.DeepCopy()
+			return nil
+		}
+		podIndexer := kubeInformerFactory.Core().V1().Pods().Informer().GetIndexer()
+		serviceIndexer := kubeInformerFactory.Core().V1().Services().Informer().GetIndexer()
+
+		// A tfjob which was running when the v1beta2 operator was replaced.
+		tfJob := testutil.NewTFJob(2, 1)
+		tfJob.UID = "legacy-tfjob"
+		now := metav1.Now()
+		tfJob.Status.StartTime = &now
+		if err := updateTFJobConditions(tfJob, common.JobRunning, tfJobRunningReason, ""); err != nil {
+			t.Fatalf("%s: unexpected error when setting the condition: %v", c.description, err)
+		}
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			t.Fatalf("%s: failed to convert the TFJob to Unstructured: %v", c.description, err)
+		}
+		if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+			t.Fatalf("%s: failed to add the tfjob: %v", c.description, err)
+		}
+		for rtype, spec := range tfJob.Spec.TFReplicaSpecs {
+			rt := strings.ToLower(string(rtype))
+			for index := 0; index < int(*spec.Replicas); index++ {
+				pod := &v1.Pod{
+					ObjectMeta: legacyObjectMeta(tfJob, rt, index),
+					Spec:       spec.Template.Spec,
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						ContainerStatuses: []v1.ContainerStatus{{
+							Name:  tfv1.DefaultContainerName,
+							State: v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+						}},
+					},
+				}
+				if c.worker0Exited && rtype == tfv1.TFReplicaTypeWorker && index == 0 {
+					pod.Status.Phase = v1.PodSucceeded
+					pod.Status.ContainerStatuses[0].State = v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 0}}
+				}
+				if err := podIndexer.Add(pod); err != nil {
+					t.Fatalf("%s: failed to add the pod: %v", c.description, err)
+				}
+				service := ctr.newService(tfJob, rtype, strconv.Itoa(index))
+				service.ObjectMeta = legacyObjectMeta(tfJob, rt, index)
+				service.Spec.Selector = service.Labels
+				if err := serviceIndexer.Add(service); err != nil {
+					t.Fatalf("%s: failed to add the service: %v", c.description, err)
+				}
+			}
+		}
+
+		for i := 0; i < 2; i++ {
+			if _, err := ctr.syncTFJob(testutil.GetKey(tfJob, t)); err != nil {
+				t.Fatalf("%s: unexpected error when syncing the tfjob: %v", c.description, err)
+			}
+		}
+
+		if len(fakePodControl.Templates) != 0 || len(fakePodControl.DeletePodName) != 0 || len(fakePodControl.Patches) != 0 {
+			t.Errorf("%s: expected no pod churn, got %d created, %v deleted and %d patched", c.description,
+				len(fakePodControl.Templates), fakePodControl.DeletePodName, len(fakePodControl.Patches))
+		}
+		churn := len(fakeServiceControl.Templates) != 0 || len(fakeServiceControl.DeleteServiceName) != 0 || len(fakeServiceControl.Patches) != 0
+		if churn != c.expectedChurn {
+			t.Errorf("%s: expected the service churn %v, got %d created, %v deleted and %d patched", c.description, c.expectedChurn,
+				len(fakeServiceControl.Templates), fakeServiceControl.DeleteServiceName, len(fakeServiceControl.Patches))
+		}
+		if stranded := ctr.strandedPods[testutil.GetKey(tfJob, t)]; (stranded == 0) != c.compatibility {
+			t.Errorf("%s: expected the legacy pods reported stranded %v, got %d", c.description, !c.compatibility, stranded)
+		}
+		if status == nil {
+			t.Fatalf("%s: expected the status to be updated", c.description)
+		}
+		if !hasCondition(status.JobStatus, c.expectedStatus) {
+			t.Errorf("%s: expected the tfjob %s, got %v", c.description, c.expectedStatus, status.Conditions)
+		}
+		if mixed := hasCondition(status.JobStatus, tfv1.JobMixedMode); mixed != c.compatibility {
+			t.Errorf("%s: expected the mixed mode %v, got %v", c.description, c.compatibility, status.Conditions)
+		}
+	}
+}
+
+func TestMixedModeConditionCleared(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	ctr.v1beta2Compatibility = true
+	tfJob := testutil.NewTFJob(1, 0)
+	tfJob.UID = "legacy-tfjob"
+	legacy := &v1.Pod{ObjectMeta: legacyObjectMeta(tfJob, testutil.LabelWorker, 0)}
+
+	ctr.updateMixedModeCondition(tfJob, []*v1.Pod{legacy}, nil)
+	if !testutil.CheckCondition(tfJob, tfv1.JobMixedMode, tfJobMixedModeReason) {
+		t.Errorf("Expected the tfjob in mixed mode, got %v", tfJob.Status.Conditions)
+	}
+	// The legacy pod is replaced by a pod of the v1 operator.
+	ctr.updateMixedModeCondition(tfJob, []*v1.Pod{testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)}, nil)
+	if hasCondition(tfJob.Status.JobStatus, tfv1.JobMixedMode) {
+		t.Errorf("Expected the mixed mode to be cleared, got %v", tfJob.Status.Conditions)
+	}
+}
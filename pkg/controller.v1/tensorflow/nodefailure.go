@@ -0,0 +1,135 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+// podNodeFailedReason is the warning reason when a pod whose node has not
+// been ready for too long is force deleted.
+const podNodeFailedReason = "PodNodeFailed"
+
+// recoverNodeFailures force deletes the active pods of the tfjob whose node
+// has been NotReady or Unknown for longer than the grace period, so that they
+// are recreated on another node, as the next attempt of their replica, rather
+// than waiting for the failed kubelet to confirm their deletion. A pod is
+// force deleted, and counted as an attempt of its replica, once: the pods
+// still in the cache after their deletion are skipped. The tfjob is
+// requeued for the pods whose node is yet to cross the grace period; a node
+// which gets ready again in the meantime restarts its grace period the next
+// time it fails.
+func (tc *TFController) recoverNodeFailures(tfjob *tfv1.TFJob, pods []*v1.Pod) error {
+	if tc.nodeLister == nil || !tc.enableNodeFailureRecovery {
+		return nil
+	}
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return err
+	}
+	logger := tflogger.LoggerForJob(tfjob)
+	now := tc.clock.Now()
+
+	tc.nodeFailureDeletionsLock.Lock()
+	defer tc.nodeFailureDeletionsLock.Unlock()
+	deleted := sets.NewString()
+	for _, pod := range pods {
+		if uid := string(pod.UID); tc.nodeFailureDeletions[key].Has(uid) {
+			deleted.Insert(uid)
+		}
+	}
+	// The pods whose deletion has been observed are forgotten.
+	if deleted.Len() > 0 {
+		tc.nodeFailureDeletions[key] = deleted
+	} else {
+		delete(tc.nodeFailureDeletions, key)
+	}
+
+	var nextCheck time.Duration
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" || (pod.Status.Phase != v1.PodPending && pod.Status.Phase != v1.PodRunning) {
+			continue
+		}
+		if deleted.Has(string(pod.UID)) {
+			continue
+		}
+		node, err := tc.nodeLister.Get(pod.Spec.NodeName)
+		if errors.IsNotFound(err) {
+			// The pods of the deleted nodes are garbage collected.
+			continue
+		} else if err != nil {
+			return err
+		}
+		since, ok := notReadySince(node)
+		if !ok {
+			continue
+		}
+		if remaining := tc.nodeFailureGracePeriod - now.Sub(since); remaining > 0 {
+			if nextCheck == 0 || remaining < nextCheck {
+				nextCheck = remaining
+			}
+			continue
+		}
+		logger.Infof("Force deleting pod %s/%s whose node %s has not been ready since %v",
+			pod.Namespace, pod.Name, node.Name, since)
+		if err := tc.forceDeletePod(tfjob, pod); err != nil {
+			return err
+		}
+		deleted.Insert(string(pod.UID))
+		tc.nodeFailureDeletions[key] = deleted
+		tc.recordReplicaAttempts(tfjob, []*v1.Pod{pod})
+		tc.recordReplicaEvent(tfjob, v1.EventTypeWarning, podNodeFailedReason, pod.Name,
+			"Force deleted pod %s/%s of %s replica %s whose node %q has not been ready for %v",
+			pod.Namespace, pod.Name, pod.Labels[tfReplicaTypeLabel], pod.Labels[tfReplicaIndexLabel],
+			node.Name, now.Sub(since).Round(time.Second))
+	}
+	if nextCheck > 0 {
+		tc.WorkQueue.AddAfter(key, nextCheck)
+	}
+	return nil
+}
+
+// forgetNodeFailureDeletions forgets the pods of the tfjob force deleted
+// because of their node.
+func (tc *TFController) forgetNodeFailureDeletions(key string) {
+	tc.nodeFailureDeletionsLock.Lock()
+	defer tc.nodeFailureDeletionsLock.Unlock()
+	delete(tc.nodeFailureDeletions, key)
+}
+
+// notReadySince returns since when the node is NotReady or Unknown, and false
+// if it is ready or does not report its readiness.
+func notReadySince(node *v1.Node) (time.Time, bool) {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type != v1.NodeReady {
+			continue
+		}
+		if condition.Status == v1.ConditionTrue {
+			return time.Time{}, false
+		}
+		if condition.LastTransitionTime.IsZero() {
+			return node.CreationTimestamp.Time, true
+		}
+		return condition.LastTransitionTime.Time, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,160 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
+)
+
+// newNodeFailureTestController returns a controller recovering from the
+// failures of the nodes of the returned indexer after a grace period of 5
+// minutes.
+func newNodeFailureTestController(enabled bool) (*TFController, *control.FakePodForceDeleteControl, cache.Indexer, *clock.FakeClock) {
+	ctr, _, _ := newErrorsTestController()
+	fakeClock := clock.NewFakeClock(time.Now())
+	ctr.clock = fakeClock
+	fakeForceDeleteControl := &control.FakePodForceDeleteControl{}
+	ctr.ForceDeleteControl = fakeForceDeleteControl
+	ctr.enableNodeFailureRecovery = enabled
+	ctr.nodeFailureGracePeriod = 5 * time.Minute
+	nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	ctr.nodeLister = corelisters.NewNodeLister(nodeIndexer)
+	return ctr, fakeForceDeleteControl, nodeIndexer, fakeClock
+}
+
+// setNodeReady sets the Ready condition of the node, which transitioned at
+// the given time.
+func setNodeReady(t *testing.T, nodeIndexer cache.Indexer, name string, status v1.ConditionStatus, since time.Time) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{
+				Type:               v1.NodeReady,
+				Status:             status,
+				LastTransitionTime: metav1.NewTime(since),
+			}},
+		},
+	}
+	if err := nodeIndexer.Update(node); err != nil {
+		t.Fatalf("Failed to update the node: %v", err)
+	}
+}
+
+func newPodOnNode(tfJob *tfv1.TFJob, index int, nodeName string, t *testing.T) *v1.Pod {
+	pod := testutil.NewPod(tfJob, testutil.LabelWorker, index, t)
+	pod.UID = types.UID(pod.Name)
+	pod.Spec.NodeName = nodeName
+	pod.Status.Phase = v1.PodRunning
+	return pod
+}
+
+func TestRecoverNodeFailures(t *testing.T) {
+	ctr, fakeForceDeleteControl, nodeIndexer, fakeClock := newNodeFailureTestController(true)
+	defer ctr.WorkQueue.ShutDown()
+	tfJob := testutil.NewTFJob(2, 0)
+	pod := newPodOnNode(tfJob, 0, "node-a", t)
+	healthy := newPodOnNode(tfJob, 1, "node-b", t)
+	pods := []*v1.Pod{pod, healthy}
+	setNodeReady(t, nodeIndexer, "node-b", v1.ConditionTrue, fakeClock.Now())
+
+	type step struct {
+		description string
+		elapsed     time.Duration
+		// status is the new status of the Ready condition of node-a, which
+		// transitions when the step starts, if set.
+		status   v1.ConditionStatus
+		expected bool
+	}
+	steps := []step{
+		{"The pod is kept when the node fails", 0, v1.ConditionFalse, false},
+		{"The pod is kept within the grace period", 3 * time.Minute, "", false},
+		{"The pod is kept when the node flaps back to ready", time.Minute, v1.ConditionTrue, false},
+		{"The grace period restarts when the node fails again", time.Minute, v1.ConditionUnknown, false},
+		{"The pod is kept within the new grace period", 4 * time.Minute, "", false},
+		{"The pod is force deleted after the grace period", 2 * time.Minute, "", true},
+	}
+	for _, s := range steps {
+		fakeForceDeleteControl.Clear()
+		fakeClock.Step(s.elapsed)
+		if s.status != "" {
+			setNodeReady(t, nodeIndexer, "node-a", s.status, fakeClock.Now())
+		}
+		if err := ctr.recoverNodeFailures(tfJob, pods); err != nil {
+			t.Fatalf("%s: unexpected error: %v", s.description, err)
+		}
+		if deleted := len(fakeForceDeleteControl.DeletePodName) > 0; deleted != s.expected {
+			t.Fatalf("%s: expected the pod force deleted %v, got %v", s.description, s.expected, fakeForceDeleteControl.DeletePodName)
+		}
+	}
+	if len(fakeForceDeleteControl.DeletePodName) != 1 || fakeForceDeleteControl.DeletePodName[0] != pod.Name ||
+		fakeForceDeleteControl.DeletePodUID[0] != pod.UID {
+		t.Errorf("Expected only the pod %s (%s) to be force deleted, got %v %v", pod.Name, pod.UID,
+			fakeForceDeleteControl.DeletePodName, fakeForceDeleteControl.DeletePodUID)
+	}
+	// The pod still in the cache on the next sync is not deleted nor counted
+	// again.
+	fakeForceDeleteControl.Clear()
+	if err := ctr.recoverNodeFailures(tfJob, pods); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(fakeForceDeleteControl.DeletePodName) != 0 {
+		t.Errorf("Expected the deleted pod not to be force deleted again, got %v", fakeForceDeleteControl.DeletePodName)
+	}
+	// The pod is recreated as the next attempt of its replica.
+	if expected := map[string]int32{"worker-0": 1}; !reflect.DeepEqual(tfJob.Status.ReplicaAttempts, expected) {
+		t.Errorf("Expected the replica attempts %v, got %v", expected, tfJob.Status.ReplicaAttempts)
+	}
+}
+
+func TestRecoverNodeFailuresSkippedPods(t *testing.T) {
+	type testCase struct {
+		description string
+		enabled     bool
+		phase       v1.PodPhase
+		nodeName    string
+	}
+	testCases := []testCase{
+		{"Nothing is deleted without the option", false, v1.PodRunning, "node-a"},
+		{"The terminated pods are kept", true, v1.PodSucceeded, "node-a"},
+		{"The pods of the deleted nodes are left to the garbage collector", true, v1.PodRunning, "deleted"},
+	}
+	for _, c := range testCases {
+		ctr, fakeForceDeleteControl, nodeIndexer, fakeClock := newNodeFailureTestController(c.enabled)
+		setNodeReady(t, nodeIndexer, "node-a", v1.ConditionFalse, fakeClock.Now().Add(-time.Hour))
+		tfJob := testutil.NewTFJob(1, 0)
+		pod := newPodOnNode(tfJob, 0, c.nodeName, t)
+		pod.Status.Phase = c.phase
+		if err := ctr.recoverNodeFailures(tfJob, []*v1.Pod{pod}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.description, err)
+		}
+		if len(fakeForceDeleteControl.DeletePodName) != 0 {
+			t.Errorf("%s: expected no pod force deleted, got %v", c.description, fakeForceDeleteControl.DeletePodName)
+		}
+		ctr.WorkQueue.ShutDown()
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+// gpuToleration is the toleration of the taint of the GPU nodes, added to the
+// pods requesting GPUs whose replica type is not mapped to a node pool.
+var gpuToleration = v1.Toleration{
+	Key:      tfv1.ResourceGPU,
+	Operator: v1.TolerationOpExists,
+	Effect:   v1.TaintEffectNoSchedule,
+}
+
+// nodePool is the node selector and the tolerations of the pods scheduled on
+// a pool of nodes. Each key of the node pools ConfigMap is the name of a node
+// pool holding it in YAML.
+type nodePool struct {
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	Tolerations  []v1.Toleration   `json:"tolerations,omitempty"`
+}
+
+// WatchNodePools sets the informer of the ConfigMap holding the node pools
+// the replica types are mapped to, so that they are updated along with the
+// ConfigMap. The caller is responsible for starting the informer.
+func (tc *TFController) WatchNodePools(configMapInformer coreinformers.ConfigMapInformer, namespace, name string) {
+	configMapInformer.Informer().AddEventHandler(newConfigMapEventHandler(namespace, name, tc.setNodePools, func() {
+		log.Warnf("Node pools ConfigMap %s/%s deleted, the replica types are not mapped to node pools", namespace, name)
+		tc.nodePoolsLock.Lock()
+		defer tc.nodePoolsLock.Unlock()
+		tc.nodePools = nil
+	}))
+	tc.nodePoolsInformerSynced = configMapInformer.Informer().HasSynced
+}
+
+// setNodePools sets the node pools from the ConfigMap. The previous node pools
+// are kept if one of them cannot be parsed.
+func (tc *TFController) setNodePools(configMap *v1.ConfigMap) {
+	pools, err := parseNodePools(configMap)
+	if err != nil {
+		log.Errorf("Failed to parse the node pools ConfigMap %s/%s, the previous node pools are kept: %v",
+			configMap.Namespace, configMap.Name, err)
+		return
+	}
+	log.Infof("Node pools updated from ConfigMap %s/%s", configMap.Namespace, configMap.Name)
+	tc.nodePoolsLock.Lock()
+	defer tc.nodePoolsLock.Unlock()
+	tc.nodePools = pools
+}
+
+// parseNodePools returns the node pools of the ConfigMap keyed by name.
+func parseNodePools(configMap *v1.ConfigMap) (map[string]nodePool, error) {
+	pools := make(map[string]nodePool, len(configMap.Data))
+	for name, data := range configMap.Data {
+		var pool nodePool
+		if err := yaml.Unmarshal([]byte(data), &pool); err != nil {
+			return nil, fmt.Errorf("invalid node pool %s: %v", name, err)
+		}
+		pools[name] = pool
+	}
+	return pools, nil
+}
+
+// getNodePool returns the node pool of the given name.
+func (tc *TFController) getNodePool(name string) (nodePool, bool) {
+	tc.nodePoolsLock.Lock()
+	defer tc.nodePoolsLock.Unlock()
+	pool, ok := tc.nodePools[name]
+	return pool, ok
+}
+
+// setReplicaNodePool adds the node selector and the tolerations of the node
+// pool the replica type is mapped to, or the GPU toleration if it is not
+// mapped and the pod requests GPUs. The node selector keys and the
+// tolerations the pod template specifies are kept.
+func (tc *TFController) setReplicaNodePool(podTemplate *v1.PodTemplateSpec, tfjob *tfv1.TFJob, rt string) {
+	name, ok := tc.replicaNodePools[rt]
+	if !ok {
+		if getPodGPURequests(&podTemplate.Spec) > 0 {
+			addTolerations(&podTemplate.Spec, gpuToleration)
+		}
+		return
+	}
+	pool, ok := tc.getNodePool(name)
+	if !ok {
+		tflogger.LoggerForReplica(tfjob, rt).Warnf("Node pool %s of the %s replicas not found, the pod is not scheduled on it", name, rt)
+		return
+	}
+	podTemplate.Spec.NodeSelector = mergeStringMap(podTemplate.Spec.NodeSelector, pool.NodeSelector)
+	addTolerations(&podTemplate.Spec, pool.Tolerations...)
+}
+
+// addTolerations adds the tolerations to the pod spec, unless it already
+// specifies a toleration with the same key and effect.
+func addTolerations(spec *v1.PodSpec, tolerations ...v1.Toleration) {
+	for _, toleration := range tolerations {
+		if !hasToleration(spec.Tolerations, toleration.Key, toleration.Effect) {
+			spec.Tolerations = append(spec.Tolerations, *toleration.DeepCopy())
+		}
+	}
+}
+
+// lowerKeys returns the map with its keys in lower case.
+func lowerKeys(m map[string]string) map[string]string {
+	lowered := make(map[string]string, len(m))
+	for key, value := range m {
+		lowered[strings.ToLower(key)] = value
+	}
+	return lowered
+}
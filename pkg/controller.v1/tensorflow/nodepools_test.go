@@ -0,0 +1,149 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+const testGPUPool = `
+nodeSelector:
+  pool: gpu
+tolerations:
+- key: nvidia.com/gpu
+  operator: Exists
+  effect: NoSchedule
+- key: dedicated
+  operator: Equal
+  value: training
+  effect: NoSchedule
+`
+
+func newNodePoolsConfigMap() *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-pools", Namespace: "kubeflow"},
+		Data: map[string]string{
+			"gpu-pool": testGPUPool,
+			"cpu-pool": "nodeSelector:\n  pool: cpu\n",
+		},
+	}
+}
+
+func TestSetReplicaNodePool(t *testing.T) {
+	gpuRequest := v1.ResourceRequirements{
+		Limits: v1.ResourceList{tfv1.ResourceGPU: resource.MustParse("1")},
+	}
+	userToleration := v1.Toleration{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "research", Effect: v1.TaintEffectNoSchedule}
+
+	type testCase struct {
+		description          string
+		rt                   string
+		resources            v1.ResourceRequirements
+		tolerations          []v1.Toleration
+		expectedNodeSelector map[string]string
+		expectedTolerations  []v1.Toleration
+	}
+	testCases := []testCase{
+		{
+			"The workers get the GPU pool, keeping the toleration of the user",
+			"worker", gpuRequest, []v1.Toleration{userToleration},
+			map[string]string{"pool": "gpu"},
+			[]v1.Toleration{userToleration, gpuToleration},
+		},
+		{
+			"The PS get the CPU pool",
+			"ps", v1.ResourceRequirements{}, nil,
+			map[string]string{"pool": "cpu"},
+			nil,
+		},
+		{
+			"An unmapped replica type requesting GPUs gets the GPU toleration",
+			"evaluator", gpuRequest, nil,
+			nil,
+			[]v1.Toleration{gpuToleration},
+		},
+		{
+			"The GPU toleration of the user is kept",
+			"evaluator", gpuRequest, []v1.Toleration{{Key: tfv1.ResourceGPU, Operator: v1.TolerationOpEqual, Value: "v100", Effect: v1.TaintEffectNoSchedule}},
+			nil,
+			[]v1.Toleration{{Key: tfv1.ResourceGPU, Operator: v1.TolerationOpEqual, Value: "v100", Effect: v1.TaintEffectNoSchedule}},
+		},
+		{
+			"An unmapped replica type without GPUs is unchanged",
+			"evaluator", v1.ResourceRequirements{}, nil,
+			nil,
+			nil,
+		},
+		{
+			"A replica type mapped to a missing pool is unchanged",
+			"chief", gpuRequest, nil,
+			nil,
+			nil,
+		},
+	}
+
+	ctr, _, _ := newErrorsTestController()
+	ctr.replicaNodePools = lowerKeys(map[string]string{"Worker": "gpu-pool", "PS": "cpu-pool", "Chief": "missing-pool"})
+	ctr.setNodePools(newNodePoolsConfigMap())
+	tfJob := testutil.NewTFJob(1, 1)
+	for _, c := range testCases {
+		podTemplate := &v1.PodTemplateSpec{
+			Spec: v1.PodSpec{
+				Tolerations: c.tolerations,
+				Containers:  []v1.Container{{Name: tfv1.DefaultContainerName, Resources: c.resources}},
+			},
+		}
+		ctr.setReplicaNodePool(podTemplate, tfJob, c.rt)
+		if !reflect.DeepEqual(podTemplate.Spec.NodeSelector, c.expectedNodeSelector) {
+			t.Errorf("%s: expected node selector %v, got %v", c.description, c.expectedNodeSelector, podTemplate.Spec.NodeSelector)
+		}
+		if !reflect.DeepEqual(podTemplate.Spec.Tolerations, c.expectedTolerations) {
+			t.Errorf("%s: expected tolerations %v, got %v", c.description, c.expectedTolerations, podTemplate.Spec.Tolerations)
+		}
+	}
+}
+
+func TestCreatePodOnNodePool(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+	ctr.replicaNodePools = lowerKeys(map[string]string{"Worker": "gpu-pool", "PS": "cpu-pool"})
+	ctr.setNodePools(newNodePoolsConfigMap())
+
+	if err := ctr.reconcileTFJobs(testutil.NewTFJob(1, 1)); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if len(fakePodControl.Templates) != 2 {
+		t.Fatalf("Expected 2 pods, got %d", len(fakePodControl.Templates))
+	}
+	for _, template := range fakePodControl.Templates {
+		expectedPool := "gpu"
+		if template.Labels[tfReplicaTypeLabel] == testutil.LabelPS {
+			expectedPool = "cpu"
+		}
+		if template.Spec.NodeSelector["pool"] != expectedPool {
+			t.Errorf("Expected the %s pod on the %s pool, got %v", template.Labels[tfReplicaTypeLabel], expectedPool, template.Spec.NodeSelector)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// The resources whose expectations are counted, the label of the expectations
+// metrics.
+const (
+	expectationsResourcePods     = "pods"
+	expectationsResourceServices = "services"
+)
+
+var (
+	expectationsSkippedSyncsCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tf_operator_syncs_skipped_on_expectations_total",
+		Help: "Counts number of TF job syncs skipped because the expectations of their pods or services are unsatisfied",
+	}, []string{"resource"})
+	unsatisfiedExpectationsAge = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tf_operator_unsatisfied_expectations_age_seconds",
+		Help:    "Age of the oldest unsatisfied expectations of the pods or services of the TF jobs whose syncs are skipped",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"resource"})
+)
+
+// The reasons why a sync of a tfjob took no action.
+const (
+	// noOpExpectationsUnsatisfied is when the pods and services the tfjob
+	// created or deleted have not all been observed yet.
+	noOpExpectationsUnsatisfied = "ExpectationsUnsatisfied"
+	// noOpDeletionInProgress is when the tfjob is being deleted.
+	noOpDeletionInProgress = "DeletionInProgress"
+	// noOpTerminal is when the tfjob already succeeded or failed, in which
+	// case only its resources are cleaned up.
+	noOpTerminal = "Terminal"
+	// noOpReplicasSatisfied is when the replicas of the running tfjob match
+	// its spec and its status did not change.
+	noOpReplicasSatisfied = "ReplicasSatisfied"
+)
+
+// keyExpectations is the state of the expectations of an expectation key of
+// a tfjob.
+type keyExpectations struct {
+	key string
+	// resource is pods or services.
+	resource  string
+	satisfied bool
+	// add and del are the adds and deletes not observed yet.
+	add, del int64
+	// since is the time the expectations were set, zero if it is unknown.
+	since time.Time
+}
+
+// tfJobExpectations is the state of the expectations of the pods and services
+// of each replica type of a tfjob.
+type tfJobExpectations []keyExpectations
+
+// satisfied returns true if the tfjob needs to be synced, i.e. the
+// expectations of one of its keys are satisfied.
+func (e tfJobExpectations) satisfied() bool {
+	for _, exp := range e {
+		if exp.satisfied {
+			return true
+		}
+	}
+	return false
+}
+
+// pending describes the unsatisfied expectations with their pending counts.
+func (e tfJobExpectations) pending() string {
+	var pending []string
+	for _, exp := range e {
+		if !exp.satisfied {
+			pending = append(pending, fmt.Sprintf("%s: %d adds, %d deletes", exp.key, exp.add, exp.del))
+		}
+	}
+	return strings.Join(pending, "; ")
+}
+
+// observeExpectationsSkip counts the skipped sync of the tfjob whose
+// expectations are unsatisfied, and observes the age of its oldest
+// unsatisfied expectations, for the pods and the services.
+func (tc *TFController) observeExpectationsSkip(e tfJobExpectations) {
+	skipped := make(map[string]bool)
+	oldest := make(map[string]time.Time)
+	for _, exp := range e {
+		if exp.satisfied {
+			continue
+		}
+		skipped[exp.resource] = true
+		if since, ok := oldest[exp.resource]; !exp.since.IsZero() && (!ok || exp.since.Before(since)) {
+			oldest[exp.resource] = exp.since
+		}
+	}
+	for resource := range skipped {
+		expectationsSkippedSyncsCount.WithLabelValues(resource).Inc()
+	}
+	for resource, since := range oldest {
+		unsatisfiedExpectationsAge.WithLabelValues(resource).Observe(tc.clock.Since(since).Seconds())
+	}
+}
+
+// syncNoOp is why a sync of a tfjob took no action.
+type syncNoOp struct {
+	reason string
+	detail string
+}
+
+func (n *syncNoOp) String() string {
+	if n.detail == "" {
+		return n.reason
+	}
+	return fmt.Sprintf("%s (%s)", n.reason, n.detail)
+}
+
+// reconcileNoOp returns why reconciling the tfjob took no action, by
+// comparing its status and its expectations with those before it was
+// reconciled, or nil if it created or deleted pods or services, or updated
+// its status.
+func (tc *TFController) reconcileNoOp(tfjob *tfv1.TFJob, oldStatus *tfv1.TFJobStatus, oldExpectations tfJobExpectations) *syncNoOp {
+	if !apiequality.Semantic.DeepEqual(*oldStatus, tfjob.Status) {
+		return nil
+	}
+	if isSucceeded(oldStatus.JobStatus) || isFailed(oldStatus.JobStatus) {
+		return &syncNoOp{reason: noOpTerminal}
+	}
+	// The pods and services created or deleted raised the expectations.
+	if !reflect.DeepEqual(oldExpectations, tc.satisfiedExpectations(tfjob)) {
+		return nil
+	}
+	return &syncNoOp{reason: noOpReplicasSatisfied}
+}
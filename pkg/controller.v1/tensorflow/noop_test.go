@@ -0,0 +1,259 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	kubeinformers "k8s.io/client-go/informers"
+	kubeclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/kubernetes/pkg/controller"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
+)
+
+func TestSyncNoOpReason(t *testing.T) {
+	type testCase struct {
+		description string
+		// setup prepares the tfjob, its pods and services, and the
+		// expectations before it is synced.
+		setup          func(ctr *TFController, tfJob *tfv1.TFJob, podIndexer, serviceIndexer cache.Indexer)
+		expectedReason string
+	}
+	testCases := []testCase{
+		{
+			"A tfjob creating its pods takes action",
+			func(ctr *TFController, tfJob *tfv1.TFJob, podIndexer, serviceIndexer cache.Indexer) {
+			},
+			"",
+		},
+		{
+			"A tfjob waiting for its pods to be observed",
+			func(ctr *TFController, tfJob *tfv1.TFJob, podIndexer, serviceIndexer cache.Indexer) {
+				key := testutil.GetKey(tfJob, t)
+				ctr.Expectations.ExpectCreations(jobcontroller.GenExpectationPodsKey(key, string(tfv1.TFReplicaTypeWorker)), 2)
+				ctr.Expectations.ExpectCreations(jobcontroller.GenExpectationServicesKey(key, string(tfv1.TFReplicaTypeWorker)), 2)
+			},
+			noOpExpectationsUnsatisfied,
+		},
+		{
+			"A tfjob being deleted",
+			func(ctr *TFController, tfJob *tfv1.TFJob, podIndexer, serviceIndexer cache.Indexer) {
+				now := metav1.Now()
+				tfJob.DeletionTimestamp = &now
+			},
+			noOpDeletionInProgress,
+		},
+		{
+			"A tfjob which succeeded",
+			func(ctr *TFController, tfJob *tfv1.TFJob, podIndexer, serviceIndexer cache.Indexer) {
+				now := metav1.Now()
+				tfJob.Status.CompletionTime = &now
+				if err := updateTFJobConditions(tfJob, common.JobSucceeded, tfJobSucceededReason, "succeeded"); err != nil {
+					t.Fatalf("Unexpected error when setting the condition: %v", err)
+				}
+			},
+			noOpTerminal,
+		},
+		{
+			"A running tfjob whose replicas are satisfied",
+			func(ctr *TFController, tfJob *tfv1.TFJob, podIndexer, serviceIndexer cache.Indexer) {
+				if err := podIndexer.Add(runningPod(testutil.NewPod(tfJob, testutil.LabelWorker, 0, t))); err != nil {
+					t.Fatalf("Unexpected error when adding the pod: %v", err)
+				}
+				if err := serviceIndexer.Add(testutil.NewService(tfJob, testutil.LabelWorker, 0, t)); err != nil {
+					t.Fatalf("Unexpected error when adding the service: %v", err)
+				}
+				// The status is the one the previous sync left.
+				if err := ctr.reconcileTFJobs(tfJob); err != nil {
+					t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+				}
+			},
+			noOpReplicasSatisfied,
+		},
+	}
+
+	for _, c := range testCases {
+		ctr, kubeInformerFactory := newNoOpTestController()
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			return nil
+		}
+		podIndexer := kubeInformerFactory.Core().V1().Pods().Informer().GetIndexer()
+		serviceIndexer := kubeInformerFactory.Core().V1().Services().Informer().GetIndexer()
+		tfJob := testutil.NewTFJob(1, 0)
+		c.setup(ctr, tfJob, podIndexer, serviceIndexer)
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			t.Fatalf("%s: failed to convert the TFJob to Unstructured: %v", c.description, err)
+		}
+		if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+			t.Fatalf("%s: failed to add the tfjob: %v", c.description, err)
+		}
+
+		var buf bytes.Buffer
+		out, level := log.StandardLogger().Out, log.GetLevel()
+		log.SetOutput(&buf)
+		log.SetLevel(log.DebugLevel)
+		_, err = ctr.syncTFJob(testutil.GetKey(tfJob, t))
+		log.SetOutput(out)
+		log.SetLevel(level)
+		if err != nil {
+			t.Fatalf("%s: unexpected error when syncing the tfjob: %v", c.description, err)
+		}
+
+		logged := strings.Contains(buf.String(), "noop_reason=")
+		if c.expectedReason == "" && logged {
+			t.Errorf("%s: expected no no-op reason, got %q", c.description, buf.String())
+		}
+		if c.expectedReason != "" && !strings.Contains(buf.String(), "noop_reason="+c.expectedReason) {
+			t.Errorf("%s: expected the no-op reason %s, got %q", c.description, c.expectedReason, buf.String())
+		}
+		if c.expectedReason == noOpExpectationsUnsatisfied && !strings.Contains(buf.String(), "2 adds, 0 deletes") {
+			t.Errorf("%s: expected the pending expectations to be reported, got %q", c.description, buf.String())
+		}
+		if c.expectedReason != "" && !strings.Contains(buf.String(), "no action: "+c.expectedReason) {
+			t.Errorf("%s: expected the no-op reason in the sync summary, got %q", c.description, buf.String())
+		}
+	}
+}
+
+func newNoOpTestController() (*TFController, kubeinformers.SharedInformerFactory) {
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	})
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	})
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, kubeInformerFactory, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, options.ServerOption{})
+	ctr.PodControl = &controller.FakePodControl{}
+	ctr.ServiceControl = &control.FakeServiceControl{}
+	return ctr, kubeInformerFactory
+}
+
+func runningPod(pod *v1.Pod) *v1.Pod {
+	pod.Status.Phase = v1.PodRunning
+	return pod
+}
+
+// collectExpectationsSkipMetrics returns the skipped syncs, and the count and
+// sum of the ages observed, for the resource.
+func collectExpectationsSkipMetrics(t *testing.T, resource string) (float64, uint64, float64) {
+	var counter, histogram dto.Metric
+	if err := expectationsSkippedSyncsCount.WithLabelValues(resource).Write(&counter); err != nil {
+		t.Fatalf("Failed to write the metric: %v", err)
+	}
+	if err := unsatisfiedExpectationsAge.WithLabelValues(resource).(prometheus.Metric).Write(&histogram); err != nil {
+		t.Fatalf("Failed to write the metric: %v", err)
+	}
+	return counter.GetCounter().GetValue(), histogram.GetHistogram().GetSampleCount(), histogram.GetHistogram().GetSampleSum()
+}
+
+func TestExpectationsSkipMetrics(t *testing.T) {
+	ctr, _ := newNoOpTestController()
+	fakeClock := clock.NewFakeClock(time.Now())
+	ctr.clock = fakeClock
+	ctr.Expectations = jobcontroller.NewTimestampedExpectations(fakeClock)
+	tfJob := testutil.NewTFJob(1, 1)
+	unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Fatalf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+		t.Fatalf("Failed to add the tfjob: %v", err)
+	}
+	key := testutil.GetKey(tfJob, t)
+
+	// The oldest expectations of the pods are 60s old, those of the services
+	// 30s old.
+	ctr.Expectations.ExpectCreations(jobcontroller.GenExpectationPodsKey(key, string(tfv1.TFReplicaTypePS)), 1)
+	fakeClock.Step(10 * time.Second)
+	ctr.Expectations.ExpectCreations(jobcontroller.GenExpectationPodsKey(key, string(tfv1.TFReplicaTypeWorker)), 1)
+	fakeClock.Step(20 * time.Second)
+	ctr.Expectations.ExpectCreations(jobcontroller.GenExpectationServicesKey(key, string(tfv1.TFReplicaTypePS)), 1)
+	ctr.Expectations.ExpectCreations(jobcontroller.GenExpectationServicesKey(key, string(tfv1.TFReplicaTypeWorker)), 1)
+	fakeClock.Step(30 * time.Second)
+
+	expectedAges := map[string]float64{expectationsResourcePods: 60, expectationsResourceServices: 30}
+	type observations struct {
+		skipped float64
+		count   uint64
+		sum     float64
+	}
+	before := make(map[string]observations)
+	for resource := range expectedAges {
+		skipped, count, sum := collectExpectationsSkipMetrics(t, resource)
+		before[resource] = observations{skipped, count, sum}
+	}
+
+	if _, err := ctr.syncTFJob(key); err != nil {
+		t.Fatalf("Unexpected error when syncing the tfjob: %v", err)
+	}
+	for resource, age := range expectedAges {
+		skipped, count, sum := collectExpectationsSkipMetrics(t, resource)
+		if skipped-before[resource].skipped != 1 {
+			t.Errorf("Expected 1 skipped sync for the %s, got %v", resource, skipped-before[resource].skipped)
+		}
+		if count-before[resource].count != 1 || math.Abs(sum-before[resource].sum-age) > 1e-6 {
+			t.Errorf("Expected the age %vs to be observed once for the %s, got %d observations summing to %vs",
+				age, resource, count-before[resource].count, sum-before[resource].sum)
+		}
+	}
+
+	// Once the expectations are satisfied, the sync is no longer skipped.
+	for _, rtype := range []tfv1.TFReplicaType{tfv1.TFReplicaTypePS, tfv1.TFReplicaTypeWorker} {
+		ctr.Expectations.CreationObserved(jobcontroller.GenExpectationPodsKey(key, string(rtype)))
+	}
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+	if _, err := ctr.syncTFJob(key); err != nil {
+		t.Fatalf("Unexpected error when syncing the tfjob: %v", err)
+	}
+	if skipped, _, _ := collectExpectationsSkipMetrics(t, expectationsResourcePods); skipped-before[expectationsResourcePods].skipped != 1 {
+		t.Errorf("Expected no skipped sync once the expectations are satisfied, got %v", skipped-before[expectationsResourcePods].skipped-1)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// OperatorSidecarKey is the key of the operator sidecar ConfigMap holding the
+// sidecar injected into the pods of the tfjobs.
+const OperatorSidecarKey = "sidecar"
+
+// operatorSidecar is the sidecar container the operator injects into the pods
+// of the tfjobs, e.g. to ship their logs or metrics, along with its volumes.
+type operatorSidecar struct {
+	Container v1.Container `json:"container"`
+	Volumes   []v1.Volume  `json:"volumes,omitempty"`
+	// ReplicaTypes is the replica types whose pods get the sidecar, all of
+	// them if it is empty.
+	ReplicaTypes []string `json:"replicaTypes,omitempty"`
+}
+
+// WatchOperatorSidecar sets the informer of the ConfigMap holding the operator
+// sidecar, so that it is updated along with the ConfigMap. The caller is
+// responsible for starting the informer.
+func (tc *TFController) WatchOperatorSidecar(configMapInformer coreinformers.ConfigMapInformer, namespace, name string) {
+	configMapInformer.Informer().AddEventHandler(newConfigMapEventHandler(namespace, name, tc.setOperatorSidecar, func() {
+		log.Infof("Operator sidecar ConfigMap %s/%s deleted, no sidecar is injected", namespace, name)
+		tc.operatorSidecarLock.Lock()
+		defer tc.operatorSidecarLock.Unlock()
+		tc.operatorSidecar = nil
+	}))
+	tc.operatorSidecarInformerSynced = configMapInformer.Informer().HasSynced
+}
+
+// setOperatorSidecar sets the operator sidecar from the ConfigMap. The
+// previous sidecar is kept if it cannot be parsed.
+func (tc *TFController) setOperatorSidecar(configMap *v1.ConfigMap) {
+	sidecar, err := parseOperatorSidecar(configMap)
+	if err != nil {
+		log.Errorf("Failed to parse the operator sidecar ConfigMap %s/%s, the previous sidecar is kept: %v",
+			configMap.Namespace, configMap.Name, err)
+		return
+	}
+	log.Infof("Operator sidecar updated from ConfigMap %s/%s", configMap.Namespace, configMap.Name)
+	tc.operatorSidecarLock.Lock()
+	defer tc.operatorSidecarLock.Unlock()
+	tc.operatorSidecar = sidecar
+}
+
+// parseOperatorSidecar returns the sidecar of the ConfigMap, or nil if it has
+// none. The sidecar cannot be named after the tensorflow container, whose
+// exit code completes the replicas.
+func parseOperatorSidecar(configMap *v1.ConfigMap) (*operatorSidecar, error) {
+	data, ok := configMap.Data[OperatorSidecarKey]
+	if !ok {
+		return nil, nil
+	}
+	sidecar := &operatorSidecar{}
+	if err := yaml.Unmarshal([]byte(data), sidecar); err != nil {
+		return nil, err
+	}
+	switch sidecar.Container.Name {
+	case "":
+		return nil, fmt.Errorf("the sidecar has no name")
+	case tfv1.DefaultContainerName:
+		return nil, fmt.Errorf("the sidecar cannot be named %s", tfv1.DefaultContainerName)
+	}
+	if sidecar.Container.Image == "" {
+		return nil, fmt.Errorf("the sidecar %s has no image", sidecar.Container.Name)
+	}
+	return sidecar, nil
+}
+
+// getOperatorSidecar returns the operator sidecar, or nil if there is none.
+func (tc *TFController) getOperatorSidecar() *operatorSidecar {
+	tc.operatorSidecarLock.Lock()
+	defer tc.operatorSidecarLock.Unlock()
+	return tc.operatorSidecar
+}
+
+// addOperatorSidecar adds the operator sidecar and its volumes to the pod
+// template of the replica type, unless the template or the sidecars of the
+// tfjob already define a container of the same name.
+func (tc *TFController) addOperatorSidecar(podTemplateSpec *v1.PodTemplateSpec, rt string) {
+	sidecar := tc.getOperatorSidecar()
+	if sidecar == nil {
+		return
+	}
+	if len(sidecar.ReplicaTypes) > 0 {
+		found := false
+		for _, rtype := range sidecar.ReplicaTypes {
+			if strings.EqualFold(rtype, rt) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return
+		}
+	}
+	injectSidecars(podTemplateSpec, []v1.Container{sidecar.Container}, sidecar.Volumes)
+}
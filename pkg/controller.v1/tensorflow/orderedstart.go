@@ -0,0 +1,124 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// waitsForPS returns true if the missing pods of the given type are only
+// created once the PS pods of the tfjob run.
+func waitsForPS(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType) bool {
+	if tfjob.Spec.OrderedStart == nil || !*tfjob.Spec.OrderedStart || len(tfjob.Spec.ReplicaStartupOrder) > 0 {
+		return false
+	}
+	if rtype != tfv1.TFReplicaTypeWorker && !tfv1.IsChieforMaster(rtype) {
+		return false
+	}
+	spec, ok := tfjob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypePS]
+	return ok && spec.Replicas != nil && *spec.Replicas > 0
+}
+
+// psRunning returns true if a pod of each PS replica of the tfjob is running.
+func (tc *TFController) psRunning(tfjob *tfv1.TFJob) (bool, error) {
+	return tc.replicasStarted(tfjob, tfv1.TFReplicaTypePS, func(pod *v1.Pod) bool {
+		return replicaPodPhase(pod) == v1.PodRunning
+	})
+}
+
+// startupPredecessors returns the replica types listed before the given type
+// in the ReplicaStartupOrder of the tfjob, which must have started for the
+// missing pods of the type to be created. The types without replicas, and
+// the ones the evaluator policy does not run yet or no longer runs, are left
+// out. It returns none if the type is not listed.
+func startupPredecessors(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType) []tfv1.TFReplicaType {
+	var predecessors []tfv1.TFReplicaType
+	for _, t := range tfjob.Spec.ReplicaStartupOrder {
+		if t == rtype {
+			return predecessors
+		}
+		spec, ok := tfjob.Spec.TFReplicaSpecs[t]
+		if !ok || spec == nil || spec.Replicas == nil || *spec.Replicas == 0 ||
+			isWaitingForTraining(tfjob, t) || isReleasedAfterTraining(tfjob, t) {
+			continue
+		}
+		predecessors = append(predecessors, t)
+	}
+	return nil
+}
+
+// startedPod returns true if the pod has started as defined by the startup
+// gate of the tfjob. The pods which succeeded have started.
+func startedPod(tfjob *tfv1.TFJob, pod *v1.Pod) bool {
+	switch replicaPodPhase(pod) {
+	case v1.PodRunning, v1.PodSucceeded:
+		return true
+	case v1.PodPending:
+		return tfjob.Spec.ReplicaStartupGate == tfv1.StartupGateScheduled && pod.Spec.NodeName != ""
+	}
+	return false
+}
+
+// waitingForStartup returns the first replica type listed before the given
+// type in the ReplicaStartupOrder of the tfjob whose pods have not all
+// started, or "" if the missing pods of the type may be created.
+func (tc *TFController) waitingForStartup(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType) (tfv1.TFReplicaType, error) {
+	for _, predecessor := range startupPredecessors(tfjob, rtype) {
+		started, err := tc.replicasStarted(tfjob, predecessor, func(pod *v1.Pod) bool {
+			return startedPod(tfjob, pod)
+		})
+		if err != nil {
+			return "", err
+		}
+		if !started {
+			return predecessor, nil
+		}
+	}
+	return "", nil
+}
+
+// replicasStarted returns true if a pod of each replica of the given type of
+// the tfjob has started. It reads the pods from the cache, since the replica
+// types are reconciled concurrently. The tfjob is requeued when the pods it
+// waits for are updated, so the pods waiting for them are created then.
+func (tc *TFController) replicasStarted(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType, started func(*v1.Pod) bool) (bool, error) {
+	rt := strings.ToLower(string(rtype))
+	replicas := int(*tfjob.Spec.TFReplicaSpecs[rtype].Replicas)
+	selector := labels.SelectorFromSet(tc.GenLabels(tfjob.Name))
+	pods, err := tc.PodLister.Pods(tfjob.Namespace).List(selector)
+	if err != nil {
+		return false, err
+	}
+	indexes := sets.NewString()
+	for _, pod := range pods {
+		if !metav1.IsControlledBy(pod, tfjob) || pod.Labels[tfReplicaTypeLabel] != rt ||
+			pod.DeletionTimestamp != nil || !started(pod) {
+			continue
+		}
+		// The pods left behind by a scale-down do not count.
+		if index, err := strconv.Atoi(pod.Labels[tfReplicaIndexLabel]); err == nil && index < replicas {
+			indexes.Insert(pod.Labels[tfReplicaIndexLabel])
+		}
+	}
+	return indexes.Len() == replicas, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/controller"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func TestOrderedStart(t *testing.T) {
+	enabled, disabled := true, false
+	testCases := []struct {
+		description  string
+		orderedStart *bool
+		// pendingPS and runningPS are the PS pods.
+		pendingPS, runningPS int32
+		expectedWorkers      int
+	}{
+		{"The workers are created along with the PS by default", nil, 0, 0, 2},
+		{"The workers are created along with the PS when disabled", &disabled, 0, 0, 2},
+		{"The workers wait for the PS pods to be created", &enabled, 0, 0, 0},
+		{"The workers wait for all the PS pods to run", &enabled, 1, 1, 0},
+		{"The workers are created once the PS pods run", &enabled, 0, 2, 2},
+	}
+
+	for _, tc := range testCases {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			return nil
+		}
+		tfJob := testutil.NewTFJob(2, 2)
+		tfJob.Spec.OrderedStart = tc.orderedStart
+		testutil.SetPodsStatuses(ctr.podIndexer, tfJob, testutil.LabelPS, tc.pendingPS, tc.runningPS, 0, 0, nil, t)
+
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", tc.description, err)
+		}
+		if count := countWorkerPods(fakePodControl); count != tc.expectedWorkers {
+			t.Errorf("%s: expected %d workers to be created, got %d", tc.description, tc.expectedWorkers, count)
+		}
+	}
+}
+
+// countPods returns the number of pods of the given lower case replica type
+// created.
+func countPods(fakePodControl *controller.FakePodControl, rt string) int {
+	count := 0
+	for _, template := range fakePodControl.Templates {
+		if template.Labels[tfReplicaTypeLabel] == rt {
+			count++
+		}
+	}
+	return count
+}
+
+func TestReplicaStartupOrder(t *testing.T) {
+	psChiefWorker := []tfv1.TFReplicaType{tfv1.TFReplicaTypePS, tfv1.TFReplicaTypeChief, tfv1.TFReplicaTypeWorker}
+	testCases := []struct {
+		description string
+		order       []tfv1.TFReplicaType
+		gate        tfv1.StartupGate
+		// psPhase and chiefPhase are the phases of the existing PS and
+		// Chief pods, which are scheduled if chiefNode is set.
+		psPhase, chiefPhase v1.PodPhase
+		chiefNode           string
+		// expectedPS, expectedChief and expectedWorkers are the pods created.
+		expectedPS, expectedChief, expectedWorkers int
+	}{
+		{"All the pods are created at once by default", nil, "", "", "", "", 1, 1, 2},
+		{"Only the PS pods are created first", psChiefWorker, tfv1.StartupGateRunning, "", "", "", 1, 0, 0},
+		{"The Chief waits for the PS pods to run", psChiefWorker, tfv1.StartupGateRunning, v1.PodPending, "", "", 0, 0, 0},
+		{"The Chief is created once the PS pods run", psChiefWorker, tfv1.StartupGateRunning, v1.PodRunning, "", "", 0, 1, 0},
+		{"The Workers wait for the Chief to run", psChiefWorker, tfv1.StartupGateRunning, v1.PodRunning, v1.PodPending, "node-a", 0, 0, 0},
+		{"The Workers are created once the Chief runs", psChiefWorker, tfv1.StartupGateRunning, v1.PodRunning, v1.PodRunning, "node-a", 0, 0, 2},
+		{"The Workers are created once the Chief completed", psChiefWorker, tfv1.StartupGateRunning, v1.PodRunning, v1.PodSucceeded, "node-a", 0, 0, 2},
+		{"The Workers wait for the Chief to be scheduled", psChiefWorker, tfv1.StartupGateScheduled, v1.PodRunning, v1.PodPending, "", 0, 0, 0},
+		{"The Workers are created once the Chief is scheduled", psChiefWorker, tfv1.StartupGateScheduled, v1.PodRunning, v1.PodPending, "node-a", 0, 0, 2},
+		{"The types which are not listed are not delayed", []tfv1.TFReplicaType{tfv1.TFReplicaTypeChief, tfv1.TFReplicaTypeWorker}, tfv1.StartupGateRunning, "", "", "", 1, 1, 0},
+	}
+
+	var chiefReplicas int32 = 1
+	for _, c := range testCases {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			return nil
+		}
+		tfJob := testutil.NewTFJobWithChief(2, 1)
+		tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeChief].Replicas = &chiefReplicas
+		tfJob.Spec.ReplicaStartupOrder = c.order
+		tfJob.Spec.ReplicaStartupGate = c.gate
+		if c.psPhase != "" {
+			pod := testutil.NewPod(tfJob, testutil.LabelPS, 0, t)
+			pod.Status.Phase = c.psPhase
+			if err := ctr.podIndexer.Add(pod); err != nil {
+				t.Fatalf("%s: unexpected error when adding pod %v", c.description, err)
+			}
+		}
+		if c.chiefPhase != "" {
+			pod := testutil.NewPod(tfJob, "chief", 0, t)
+			pod.Status.Phase = c.chiefPhase
+			pod.Spec.NodeName = c.chiefNode
+			if err := ctr.podIndexer.Add(pod); err != nil {
+				t.Fatalf("%s: unexpected error when adding pod %v", c.description, err)
+			}
+		}
+
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", c.description, err)
+		}
+		if count := countPods(fakePodControl, testutil.LabelPS); count != c.expectedPS {
+			t.Errorf("%s: expected %d PS to be created, got %d", c.description, c.expectedPS, count)
+		}
+		if count := countPods(fakePodControl, "chief"); count != c.expectedChief {
+			t.Errorf("%s: expected %d chiefs to be created, got %d", c.description, c.expectedChief, count)
+		}
+		if count := countWorkerPods(fakePodControl); count != c.expectedWorkers {
+			t.Errorf("%s: expected %d workers to be created, got %d", c.description, c.expectedWorkers, count)
+		}
+	}
+}
+
+func TestReplicaStartupOrderOverridesOrderedStart(t *testing.T) {
+	enabled := true
+	tfJob := testutil.NewTFJob(2, 1)
+	tfJob.Spec.OrderedStart = &enabled
+	if !waitsForPS(tfJob, tfv1.TFReplicaTypeWorker) {
+		t.Errorf("Expected the workers to wait for the PS")
+	}
+	tfJob.Spec.ReplicaStartupOrder = []tfv1.TFReplicaType{tfv1.TFReplicaTypeWorker, tfv1.TFReplicaTypePS}
+	if waitsForPS(tfJob, tfv1.TFReplicaTypeWorker) {
+		t.Errorf("Expected the startup order to override the ordered start")
+	}
+	if predecessors := startupPredecessors(tfJob, tfv1.TFReplicaTypePS); len(predecessors) != 1 || predecessors[0] != tfv1.TFReplicaTypeWorker {
+		t.Errorf("Expected the PS to wait for the workers, got %v", predecessors)
+	}
+}
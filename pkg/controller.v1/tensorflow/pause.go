@@ -0,0 +1,52 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+const (
+	// tfJobPausedReason is added in a tfjob when it is paused.
+	tfJobPausedReason = "TFJobPaused"
+	// tfJobResumedReason is added in a tfjob when it is resumed.
+	tfJobResumedReason = "TFJobResumed"
+)
+
+// isPaused returns true if the missing pods of the tfjob are not created.
+func isPaused(tfjob *tfv1.TFJob) bool {
+	return tfjob.Annotations[tfv1.AnnotationPaused] == "true"
+}
+
+// updatePausedCondition sets the Paused condition of the tfjob while it is
+// paused, and clears it once it is resumed.
+func updatePausedCondition(tfjob *tfv1.TFJob) {
+	if isPaused(tfjob) {
+		msg := fmt.Sprintf("TFJob %s is paused, its missing pods are not created until the annotation %s is removed.",
+			tfjob.Name, tfv1.AnnotationPaused)
+		setCondition(&tfjob.Status.JobStatus, newCondition(tfv1.JobPaused, tfJobPausedReason, msg))
+		return
+	}
+	if hasCondition(tfjob.Status.JobStatus, tfv1.JobPaused) {
+		msg := fmt.Sprintf("TFJob %s is resumed.", tfjob.Name)
+		condition := newCondition(tfv1.JobPaused, tfJobResumedReason, msg)
+		condition.Status = v1.ConditionFalse
+		setCondition(&tfjob.Status.JobStatus, condition)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func TestPauseTFJob(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+	tfJob := testutil.NewTFJob(2, 1)
+	tfJob.Annotations = map[string]string{tfv1.AnnotationPaused: "true"}
+	// Worker 0 is running, the other pods are missing.
+	pod := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+	pod.Status.Phase = v1.PodRunning
+	if err := ctr.podIndexer.Add(pod); err != nil {
+		t.Fatalf("Unexpected error when adding the pod: %v", err)
+	}
+
+	if err := ctr.reconcileTFJobs(tfJob); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if len(fakePodControl.Templates) != 0 || len(fakePodControl.DeletePodName) != 0 {
+		t.Errorf("Expected the paused tfjob to neither create nor delete pods, got %d created and %v deleted",
+			len(fakePodControl.Templates), fakePodControl.DeletePodName)
+	}
+	if !testutil.CheckCondition(tfJob, tfv1.JobPaused, tfJobPausedReason) {
+		t.Errorf("Expected the tfjob to be paused, got %v", tfJob.Status.Conditions)
+	}
+
+	delete(tfJob.Annotations, tfv1.AnnotationPaused)
+	if err := ctr.reconcileTFJobs(tfJob); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if len(fakePodControl.Templates) != 2 {
+		t.Errorf("Expected the missing pods to be created once resumed, got %d", len(fakePodControl.Templates))
+	}
+	cond := getCondition(tfJob.Status.JobStatus, tfv1.JobPaused)
+	if cond == nil || cond.Status != v1.ConditionFalse || cond.Reason != tfJobResumedReason {
+		t.Errorf("Expected the tfjob to be resumed, got %v", cond)
+	}
+}
@@ -17,14 +17,21 @@ package tensorflow
 
 import (
 	"fmt"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 
 	common "github.com/kubeflow/common/job_controller/api/v1"
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
 	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
 	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
 	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
@@ -34,69 +41,176 @@ import (
 const (
 	// tfConfig is the environment variable name of TensorFlow cluster spec.
 	tfConfig = "TF_CONFIG"
+	// tfConfigVolumeName is the name of the volume holding the TF_CONFIG file.
+	tfConfigVolumeName = "tf-config"
+	// defaultTFConfigPath is the path of the TF_CONFIG file of the tfjobs
+	// whose cluster spec is passed via a ConfigMap without the path
+	// annotation.
+	defaultTFConfigPath = "/etc/tf-config/tf_config.json"
 
 	gangSchedulingPodGroupAnnotation = "scheduling.k8s.io/group-name"
+	// podDeletionCostAnnotation is the annotation of the pods ranking them
+	// for deletion, as for the pods of a ReplicaSet: the pods of the lowest
+	// cost are deleted first.
+	podDeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
 
 	// podTemplateRestartPolicyReason is the warning reason when the restart
 	// policy is set in pod template.
 	podTemplateRestartPolicyReason = "SettedPodTemplateRestartPolicy"
 	// exitedWithCodeReason is the normal reason when the pod is exited because of the exit code.
 	exitedWithCodeReason = "ExitedWithCode"
+	// restartPolicyPreventsCompletionReason is the warning reason when the
+	// restart policy of the pods keeps the tfjob from ever completing.
+	restartPolicyPreventsCompletionReason = "RestartPolicyPreventsCompletion"
 	// podTemplateSchedulerNameReason is the warning reason when other scheduler name is set
 	// in pod templates with gang-scheduling enabled
 	podTemplateSchedulerNameReason = "SettedPodTemplateSchedulerName"
+	// duplicatePodReason is the warning reason when a pod is deleted because
+	// another pod has the same replica index.
+	duplicatePodReason = "DuplicatePod"
+	// outOfRangePodReason is the warning reason when a pod is deleted because
+	// its replica index is not lower than the number of replicas.
+	outOfRangePodReason = "OutOfRangePod"
+
+	// replicaAntiAffinityWeight is the weight of the injected worker and PS
+	// pod anti-affinity.
+	replicaAntiAffinityWeight = 100
+	// topologyAffinityWeight is the weight of the pod affinity injected for
+	// the AnnotationTopologyKey of the tfjob.
+	topologyAffinityWeight = 100
+	// hostnameTopologyKey is the node label used to spread pods across nodes.
+	hostnameTopologyKey = "kubernetes.io/hostname"
 )
 
-// reconcilePods checks and updates pods for each given TFReplicaSpec.
-// It will requeue the tfjob in case of an error while creating/deleting pods.
-func (tc *TFController) reconcilePods(
+var exitCodeRestartsCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "tf_operator_exit_code_restarts_total",
+	Help: "Counts number of pods restarted for a retryable exit code, by replica type and exit code bucket",
+}, []string{"replica_type", "exit_code"})
+
+// replicaPodsResult is the outcome of the reconciliation of the pods of a
+// replica type, from which the status of the tfjob is updated.
+type replicaPodsResult struct {
+	replicas         int
+	restart          bool
+	worker0Completed bool
+	// restarts is the number of failed pods deleted to be recreated.
+	restarts int32
+	// restartedIndexes is the indexes whose failed pod was deleted to be
+	// recreated, stableIndexes the indexes whose pod has been running for
+	// the restart backoff stability window, and restartDelay the shortest
+	// time before a pod delayed by its restart backoff may be recreated.
+	restartedIndexes []int
+	stableIndexes    []int
+	restartDelay     time.Duration
+	// released is true if the pods have been deleted because the replica
+	// type is no longer needed, in which case the status is not updated.
+	released bool
+	// failedPS describes the failed PS pods which fail the tfjob.
+	failedPS []string
+	// failed describes the failed pods which fail the tfjob by the FailJob
+	// failure policy of the replica type.
+	failed []string
+	// progress is the training progress reported by the Worker pods.
+	progress *tfv1.TrainingProgress
+	// recreatedPods is the pods deleted to be recreated, after a failure, a
+	// preemption or an evacuation.
+	recreatedPods []*v1.Pod
+	// scaledDown is the names of the pods deleted, or being deleted, because
+	// their index was scaled away.
+	scaledDown []string
+	// runningTime is the time a running pod was observed, nil if none is
+	// running.
+	runningTime *metav1.Time
+}
+
+// reconcileReplicaPods creates and deletes the pods of the replica type, and
+// counts them in its replica status, which must have been initialized. It
+// does not modify the rest of the tfjob, so that several replica types can be
+// reconciled concurrently. The pods created are bounded by the budget.
+func (tc *TFController) reconcileReplicaPods(
 	tfjob *tfv1.TFJob,
-	pods []*v1.Pod,
+	podsByIndex map[int][]*v1.Pod,
 	rtype tfv1.TFReplicaType,
-	spec *common.ReplicaSpec, rstatus map[string]v1.PodPhase) error {
+	spec *common.ReplicaSpec,
+	budget *podCreationBudget) (*replicaPodsResult, error) {
 
+	// The spec is copied, so that its template is not read while the caller
+	// sets defaults on the tfjob it belongs to.
+	spec = spec.DeepCopy()
 	// Convert TFReplicaType to lower string.
 	rt := strings.ToLower(string(rtype))
 	logger := tflogger.LoggerForReplica(tfjob, rt)
-	// Get all pods for the type rt.
-	pods, err := tc.FilterPodsForReplicaType(pods, rt)
-	if err != nil {
-		return err
-	}
-	replicas := int(*spec.Replicas)
-	restart := false
-	worker0Completed := false
-	masterRole := false
-
-	initializeTFReplicaStatuses(tfjob, rtype)
+	result := &replicaPodsResult{replicas: int(*spec.Replicas)}
+	// The indexes whose pod needs to be created.
+	var missing []int
+	// The pods which share their index with the pod kept for it.
+	var duplicates []*v1.Pod
+	// Whether a missing pod is not created because its PodTemplate changed.
+	templateChanged := false
+	// The running pods of the replica type.
+	running := 0
+	// The missing pods which are not created while the tfjob is paused.
+	paused := 0
+	// The pods kept for their index.
+	var current []*v1.Pod
 
-	podSlices := tc.GetPodSlices(pods, replicas, logger)
-	for index, podSlice := range podSlices {
-		masterRole = false
+	for index := 0; index < result.replicas; index++ {
+		podSlice := podsByIndex[index]
 		if len(podSlice) > 1 {
 			logger.Warningf("We have too many pods for %s %d", rt, index)
-			// TODO(gaocegege): Kill some pods.
-		} else if len(podSlice) == 0 {
-			logger.Infof("Need to create new pod: %s-%d", rt, index)
-
-			// if master pod is present, select the master pod
-			// if master is not present, first worker pod is selected as the master.
-			if ContainChieforMasterSpec(tfjob) {
-				if tfv1.IsChieforMaster(rtype) {
-					masterRole = true
-				}
-			} else {
-				if tfv1.IsWorker(rtype) && (index == 0) {
-					masterRole = true
-				}
+			// The other pods are deleted once the missing pods are created,
+			// which resets the expectations.
+			podSlice = sortDuplicatePods(podSlice)
+			duplicates = append(duplicates, podSlice[1:]...)
+			podSlice = podSlice[:1]
+		}
+		if len(podSlice) == 0 {
+			if isWaitingForTraining(tfjob, rtype) {
+				logger.Infof("Waiting for the training to succeed to create pod: %s-%d", rt, index)
+				continue
+			}
+			if tc.isPodTemplateChanged(tfjob, rtype) {
+				logger.Infof("Waiting for the PodTemplate to be restored to create pod: %s-%d", rt, index)
+				templateChanged = true
+				continue
+			}
+			if isPaused(tfjob) {
+				paused++
+				continue
 			}
-			err = tc.createNewPod(tfjob, rt, strconv.Itoa(index), spec, masterRole)
-			if err != nil {
-				return err
+			if tc.isRecreationPaused(tfjob, rt, strconv.Itoa(index)) {
+				logger.Infof("Not recreating pod %s-%d which keeps being deleted externally", rt, index)
+				continue
 			}
+			if delay := tc.restartBackoffRemaining(tfjob, genReplicaName(rt, strconv.Itoa(index))); delay > 0 {
+				logger.Infof("Backing off the recreation of pod %s-%d for %v", rt, index, delay)
+				if result.restartDelay == 0 || delay < result.restartDelay {
+					result.restartDelay = delay
+				}
+				continue
+			}
+			logger.Infof("Need to create new pod: %s-%d", rt, index)
+			missing = append(missing, index)
 		} else {
 			// Check the status of the current pod.
 			pod := podSlice[0]
+			if reason := preemptionReason(pod); reason != "" && tc.exemptPreemptions {
+				if err := tc.recreatePreemptedPod(tfjob, rtype, index, pod, reason); err != nil {
+					return nil, err
+				}
+				result.recreatedPods = append(result.recreatedPods, pod)
+				continue
+			}
+			if msg := evacuationMessage(tfjob, pod); msg != "" {
+				// The pod is recreated once its deletion is observed,
+				// without being counted as a restart.
+				if err := tc.deletePodWithExpectations(tfjob, rt, pod, podEvacuatedReason, msg); err != nil {
+					return nil, err
+				}
+				result.recreatedPods = append(result.recreatedPods, pod)
+				continue
+			}
+			current = append(current, pod)
 			// Get the exit code of the tensorflow container.
 			var exitCode int32 = 0xbeef // magic number
 			for _, status := range pod.Status.ContainerStatuses {
@@ -104,50 +218,256 @@ func (tc *TFController) reconcilePods(
 				if status.Name == tfv1.DefaultContainerName && state.Terminated != nil {
 					exitCode = state.Terminated.ExitCode
 					logger.Infof("Pod: %v.%v exited with code %v", pod.Namespace, pod.Name, exitCode)
-					tc.Recorder.Eventf(tfjob, v1.EventTypeNormal, exitedWithCodeReason, "Pod: %v.%v exited with code %v", pod.Namespace, pod.Name, exitCode)
+					tc.recordReplicaEvent(tfjob, v1.EventTypeNormal, exitedWithCodeReason, pod.Name, "Pod: %v.%v exited with code %v", pod.Namespace, pod.Name, exitCode)
 				}
 			}
 			// Check if the pod is retryable.
-			if spec.RestartPolicy == common.RestartPolicyExitCode {
-				if pod.Status.Phase == v1.PodFailed && train_util.IsRetryableExitCode(exitCode) {
-					logger.Infof("Need to restart the pod: %v.%v", pod.Namespace, pod.Name)
-					if err := tc.PodControl.DeletePod(pod.Namespace, pod.Name, tfjob); err != nil {
-						return err
-					}
-					restart = true
+			restartPolicy := tc.effectiveRestartPolicy(spec)
+			retryable := restartPolicy == common.RestartPolicyExitCode && train_util.IsRetryableExitCode(exitCode)
+			if replicaPodPhase(pod) == v1.PodFailed && restartPolicy != common.RestartPolicyAlways &&
+				restartPolicy != common.RestartPolicyOnFailure && rtype == tfv1.TFReplicaTypePS && !retryable {
+				if tc.psFailurePolicy == options.PSFailurePolicyRestart {
+					// The PS churn is tolerated, the pod is recreated below.
+					retryable = true
+				} else {
+					result.failedPS = append(result.failedPS, fmt.Sprintf("%d (pod %s, exit code %d)", index, pod.Name, exitCode))
+				}
+			}
+			if replicaPodPhase(pod) == v1.PodFailed && failurePolicy(tfjob, rtype) == tfv1.FailurePolicyFailJob {
+				// The pod is not restarted, its failure fails the tfjob.
+				retryable = false
+				result.failed = append(result.failed, fmt.Sprintf("%d (pod %s, exit code %d)", index, pod.Name, exitCode))
+			}
+			if replicaPodPhase(pod) == v1.PodFailed {
+				tc.recordReplicaEvent(tfjob, v1.EventTypeWarning, replicaFailedReason, pod.Name,
+					"Pod %s/%s of %s replica %d failed on node %q", pod.Namespace, pod.Name, rtype, index, pod.Spec.NodeName)
+			}
+			if replicaPodPhase(pod) == v1.PodFailed && retryable {
+				logger.Infof("Need to restart the pod: %v.%v", pod.Namespace, pod.Name)
+				tc.recordReplicaEvent(tfjob, v1.EventTypeWarning, replicaRestartedReason, pod.Name,
+					"Restarting pod %s/%s of %s replica %d which exited with code %d", pod.Namespace, pod.Name, rtype, index, exitCode)
+				if err := tc.deletePod(tfjob, pod); err != nil {
+					return nil, err
+				}
+				exitCodeRestartsCount.WithLabelValues(rt, exitCodeBucket(exitCode)).Inc()
+				result.restart = true
+				result.restarts++
+				result.restartedIndexes = append(result.restartedIndexes, index)
+				result.recreatedPods = append(result.recreatedPods, pod)
+			}
+
+			if replicaPodPhase(pod) == v1.PodRunning {
+				tc.observeFirstPodRunning(tfjob)
+				if result.runningTime == nil {
+					now := metav1.NewTime(tc.clock.Now())
+					result.runningTime = &now
+				}
+				running++
+				if tc.isRunningStably(pod) {
+					result.stableIndexes = append(result.stableIndexes, index)
 				}
 			}
 
 			// Check whether worker 0 is exited without error.
 			if rtype == tfv1.TFReplicaTypeWorker && index == 0 &&
-				exitCode == 0 && pod.Status.Phase == v1.PodSucceeded {
-				worker0Completed = true
+				exitCode == 0 && replicaPodPhase(pod) == v1.PodSucceeded {
+				result.worker0Completed = true
 			}
 			updateTFJobReplicaStatuses(tfjob, rtype, pod)
 		}
 	}
 
-	return tc.updateStatusSingle(tfjob, rtype, replicas, restart, worker0Completed)
+	if rtype == tfv1.TFReplicaTypeWorker {
+		result.progress = tc.trainingProgress(current)
+	}
+
+	if result.replicas > 0 && running == result.replicas {
+		tc.recordReplicaTransition(tfjob, v1.EventTypeNormal, replicasRunningReason, rt,
+			"All %d %s replica(s) of TFJob %s are running", result.replicas, rtype, tfjob.Name)
+	} else {
+		tc.forgetReplicaTransition(tfjob, replicasRunningReason, rt)
+	}
+
+	if paused > 0 {
+		logger.Infof("TFJob is paused, not creating its %d missing %s pod(s)", paused, rt)
+	}
+
+	if templateChanged {
+		tc.Recorder.Eventf(tfjob, v1.EventTypeWarning, podTemplateChangedReason,
+			"The PodTemplate %s of %s changed since TFJob %s first used it, its missing pods are not created until it is restored",
+			tfjob.Spec.TemplateRefs[rtype].Name, rtype, tfjob.Name)
+	}
+
+	if len(missing) > 0 && hasCondition(tfjob.Status.JobStatus, tfv1.JobStaleServiceEndpoints) {
+		logger.Infof("Waiting for the stale endpoints of the services of TFJob %s to drain to create %d %s pod(s)", tfjob.Name, len(missing), rt)
+		missing = nil
+	}
+	if len(missing) > 0 && rtype == tfv1.TFReplicaTypeWorker && !tc.serviceDNSReady(tfjob) {
+		logger.Infof("Waiting for the services of TFJob %s to resolve to create %d %s pod(s)", tfjob.Name, len(missing), rt)
+		missing = nil
+	}
+	if len(missing) > 0 && waitsForPS(tfjob, rtype) {
+		running, err := tc.psRunning(tfjob)
+		if err != nil {
+			return nil, err
+		}
+		if !running {
+			logger.Infof("Waiting for the PS pods of TFJob %s to run to create %d %s pod(s)", tfjob.Name, len(missing), rt)
+			missing = nil
+		}
+	}
+	if len(missing) > 0 {
+		predecessor, err := tc.waitingForStartup(tfjob, rtype)
+		if err != nil {
+			return nil, err
+		}
+		if predecessor != "" {
+			logger.Infof("Waiting for the %s pods of TFJob %s to start to create %d %s pod(s)", predecessor, tfjob.Name, len(missing), rt)
+			missing = nil
+		}
+	}
+
+	missing = budget.take(missing)
+	err := tc.createReplicas(tfjob, rt, jobcontroller.GenExpectationPodsKey, missing, func(index int) error {
+		// The coordinator recorded for the tfjob has the master role.
+		masterRole := isCoordinator(tfjob, rtype, index)
+		return tc.createNewPod(tfjob, rt, strconv.Itoa(index), spec, masterRole)
+	})
+	if err != nil {
+		return nil, newReconcileError(ErrPodCreation, err)
+	}
+	if len(missing) > 0 && len(podsByIndex) == 0 {
+		tc.recordReplicaTransition(tfjob, v1.EventTypeNormal, replicaPodCreatedReason, rt,
+			"Created the first %s pod of TFJob %s", rtype, tfjob.Name)
+	}
+
+	for _, pod := range duplicates {
+		msg := fmt.Sprintf("Deleting pod %s/%s which has the same index as another %s pod", pod.Namespace, pod.Name, rt)
+		if err := tc.deletePodWithExpectations(tfjob, rt, pod, duplicatePodReason, msg); err != nil {
+			return nil, err
+		}
+	}
+	// Delete the pods left behind by indexes which have been scaled away.
+	if result.scaledDown, err = tc.deleteOutOfRangePods(tfjob, rt, podsByIndex, result.replicas); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-// createNewPod creates a new pod for the given index and type.
-func (tc *TFController) createNewPod(tfjob *tfv1.TFJob, rt, index string, spec *common.ReplicaSpec, masterRole bool) error {
+// sortDuplicatePods sorts the pods sharing a replica index by the preference
+// to keep them: running pods first, then the pods of the highest deletion
+// cost, then the most recently created ones.
+func sortDuplicatePods(pods []*v1.Pod) []*v1.Pod {
+	sorted := make([]*v1.Pod, len(pods))
+	copy(sorted, pods)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		iRunning, jRunning := sorted[i].Status.Phase == v1.PodRunning, sorted[j].Status.Phase == v1.PodRunning
+		if iRunning != jRunning {
+			return iRunning
+		}
+		if ci, cj := podDeletionCost(sorted[i]), podDeletionCost(sorted[j]); ci != cj {
+			return ci > cj
+		}
+		ti, tj := sorted[i].CreationTimestamp, sorted[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return tj.Before(&ti)
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// podDeletionCost returns the deletion cost of the pod, 0 if it is unset or
+// invalid.
+func podDeletionCost(pod *v1.Pod) int32 {
+	cost, err := strconv.ParseInt(pod.Annotations[podDeletionCostAnnotation], 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(cost)
+}
+
+// deleteOutOfRangePods deletes the pods of the given type whose index is
+// not lower than the current number of replicas. The pods of the lowest
+// deletion cost are deleted first, then those of the highest index, so that
+// the most valuable pods are the last to go when the scale-down is cut short.
+// It returns the names of the pods of these indexes, including the ones which
+// were already being deleted.
+func (tc *TFController) deleteOutOfRangePods(tfjob *tfv1.TFJob, rt string, podsByIndex map[int][]*v1.Pod, replicas int) ([]string, error) {
+	type indexedPod struct {
+		index int
+		pod   *v1.Pod
+	}
+	var surplus []indexedPod
+	for index, podSlice := range podsByIndex {
+		if index < 0 || index >= replicas {
+			for _, pod := range podSlice {
+				surplus = append(surplus, indexedPod{index, pod})
+			}
+		}
+	}
+	sort.Slice(surplus, func(i, j int) bool {
+		if ci, cj := podDeletionCost(surplus[i].pod), podDeletionCost(surplus[j].pod); ci != cj {
+			return ci < cj
+		}
+		if surplus[i].index != surplus[j].index {
+			return surplus[i].index > surplus[j].index
+		}
+		return surplus[i].pod.Name < surplus[j].pod.Name
+	})
+
+	var deleted []string
+	for _, p := range surplus {
+		pod := p.pod
+		deleted = append(deleted, pod.Name)
+		msg := fmt.Sprintf("Deleting pod %s/%s with index %d, the replicas are %d", pod.Namespace, pod.Name, p.index, replicas)
+		if err := tc.deletePodWithExpectations(tfjob, rt, pod, outOfRangePodReason, msg); err != nil {
+			return nil, err
+		}
+	}
+	return deleted, nil
+}
+
+// deletePodWithExpectations deletes the pod unless it is already being
+// deleted, raising the deletion expectations of its replica type on top of
+// the expectations already set in this sync.
+func (tc *TFController) deletePodWithExpectations(tfjob *tfv1.TFJob, rt string, pod *v1.Pod, reason, msg string) error {
+	if pod.DeletionTimestamp != nil {
+		return nil
+	}
 	tfjobKey, err := KeyFunc(tfjob)
 	if err != nil {
 		utilruntime.HandleError(fmt.Errorf("couldn't get key for tfjob object %#v: %v", tfjob, err))
 		return err
 	}
 	expectationPodsKey := jobcontroller.GenExpectationPodsKey(tfjobKey, rt)
-	err = tc.Expectations.ExpectCreations(expectationPodsKey, 1)
-	if err != nil {
+
+	tflogger.LoggerForReplica(tfjob, rt).Info(msg)
+	if _, exists, err := tc.Expectations.GetExpectations(expectationPodsKey); err != nil {
+		return err
+	} else if exists {
+		tc.Expectations.RaiseExpectations(expectationPodsKey, 0, 1)
+	} else if err := tc.Expectations.ExpectDeletions(expectationPodsKey, 1); err != nil {
 		return err
 	}
-	logger := tflogger.LoggerForReplica(tfjob, rt)
+	if err := tc.deletePod(tfjob, pod); err != nil {
+		// The deletion is not going to be observed.
+		tc.Expectations.DeletionObserved(expectationPodsKey)
+		return err
+	}
+	tc.Recorder.Event(tfjob, v1.EventTypeWarning, reason, msg)
+	return nil
+}
+
+// createNewPod creates a new pod for the given index and type.
+// The caller is responsible for raising the creation expectations.
+func (tc *TFController) createNewPod(tfjob *tfv1.TFJob, rt, index string, spec *common.ReplicaSpec, masterRole bool) error {
+	logger := tflogger.LoggerForReplicaIndex(tfjob, rt, index)
 	// Create OwnerReference.
 	controllerRef := tc.GenOwnerReference(tfjob)
 
 	// Set type and index for the worker.
-	labels := tc.GenLabels(tfjob.Name)
+	labels := tc.genLabels(tfjob)
 	labels[tfReplicaTypeLabel] = rt
 	labels[tfReplicaIndexLabel] = index
 
@@ -158,32 +478,79 @@ func (tc *TFController) createNewPod(tfjob *tfv1.TFJob, rt, index string, spec *
 	podTemplate := spec.Template.DeepCopy()
 
 	// Set name for the template.
-	podTemplate.Name = jobcontroller.GenGeneralName(tfjob.Name, rt, index)
+	podTemplate.Name = tc.nameTemplate.GenName(tfjob.Name, rt, index)
+	// The pod defaults of the operator are merged before TF_CONFIG is set,
+	// the values of the pod template take precedence.
+	applyPodDefaults(podTemplate, tc.getPodDefaults())
+	tc.setReplicaNodePool(podTemplate, tfjob, rt)
+	tc.injectDataAccess(podTemplate, tfjob, rt)
+	if err := tc.createVolumeClaims(podTemplate, tfjob, rt, index); err != nil {
+		return err
+	}
 
 	if podTemplate.Labels == nil {
 		podTemplate.Labels = make(map[string]string)
 	}
+	if podTemplate.Annotations == nil {
+		podTemplate.Annotations = make(map[string]string)
+	}
+	// The metadata of the tfjob is copied first, so that the labels of the
+	// operator and the metadata of the pod template take precedence.
+	propagateMetadata(podTemplate.Labels, tfjob.Labels, tc.propagatedLabels)
+	propagateMetadata(podTemplate.Annotations, tfjob.Annotations, tc.propagatedAnnotations)
 
 	for key, value := range labels {
 		podTemplate.Labels[key] = value
 	}
 
-	if err := setClusterSpec(podTemplate, tfjob, rt, index); err != nil {
+	if err := setClusterSpec(podTemplate, tfjob, tc.nameTemplate, rt, index); err != nil {
+		return err
+	}
+	if err := tc.injectPSWaitInitContainer(podTemplate, tfjob, rt); err != nil {
 		return err
 	}
+	// The sidecars are added after TF_CONFIG, which is only for the tensorflow
+	// container. The sidecars of the tfjob take precedence over the one of
+	// the operator.
+	addSidecars(podTemplate, tfjob)
+	tc.addOperatorSidecar(podTemplate, rt)
+	// The security context defaults apply to the sidecars as well.
+	tc.applySecurityContextDefaults(podTemplate, tfjob, rt)
+
+	setReplicaIdentity(podTemplate, genReplicaIdentity(tfjob, rt, index), tc.getReplicaAttempt(tfjob, rt, index))
 
 	// Submit a warning event if the user specifies restart policy for
 	// the pod template. We recommend to set it from the replica level.
-	if podTemplate.Spec.RestartPolicy != v1.RestartPolicy("") {
+	if podTemplate.Spec.RestartPolicy == v1.RestartPolicy("") {
+		setRestartPolicy(podTemplate, spec)
+	} else if !tc.respectsPodTemplateRestartPolicy() {
 		errMsg := "Restart policy in pod template will be overwritten by restart policy in replica spec"
 		logger.Warning(errMsg)
 		tc.Recorder.Event(tfjob, v1.EventTypeWarning, podTemplateRestartPolicyReason, errMsg)
+		setRestartPolicy(podTemplate, spec)
+	}
+	if msg := restartPolicyPreventsCompletion(tfjob, rt, podTemplate.Spec.RestartPolicy); msg != "" {
+		logger.Warning(msg)
+		tc.Recorder.Event(tfjob, v1.EventTypeWarning, restartPolicyPreventsCompletionReason, msg)
 	}
-	setRestartPolicy(podTemplate, spec)
+
+	setTerminationGracePeriod(podTemplate, tfjob, rt)
+
+	if tc.enableWorkerAntiAffinity && rt == strings.ToLower(string(tfv1.TFReplicaTypeWorker)) &&
+		tfjob.Annotations[tfv1.AnnotationDisableWorkerAntiAffinity] != "true" {
+		setReplicaAntiAffinity(podTemplate, tfjob, rt, false)
+	}
+	if tc.psAntiAffinity != options.PSAntiAffinityNone && tc.psAntiAffinity != "" &&
+		rt == strings.ToLower(string(tfv1.TFReplicaTypePS)) && spec.Replicas != nil && *spec.Replicas > 1 {
+		setReplicaAntiAffinity(podTemplate, tfjob, rt, tc.psAntiAffinity == options.PSAntiAffinityRequired)
+	}
+	setTopologyAffinity(podTemplate, tfjob, tc.GenLabels(tfjob.Name))
+	setEvacuatedNodesAffinity(podTemplate, tfjob)
 
 	// if gang-scheduling is enabled:
 	// 1. if user has specified other scheduler, we report a warning without overriding any fields.
-	// 2. if no SchedulerName is set for pods, then we set the SchedulerName to "kube-batch".
+	// 2. if no SchedulerName is set for pods, then we set the SchedulerName to the gang scheduler name,
+	//    "kube-batch" unless configured otherwise.
 	if tc.Config.EnableGangScheduling {
 		if tc.isNonGangSchedulerSet(tfjob) {
 			errMsg := "Another scheduler is specified when gang-scheduling is enabled and it will not be overwritten"
@@ -193,14 +560,11 @@ func (tc *TFController) createNewPod(tfjob *tfv1.TFJob, rt, index string, spec *
 			podTemplate.Spec.SchedulerName = tc.Config.GangSchedulerName
 		}
 
-		if podTemplate.Annotations == nil {
-			podTemplate.Annotations = map[string]string{}
-		}
 		podTemplate.Annotations[gangSchedulingPodGroupAnnotation] =
 			jobcontroller.GenPodGroupName(tfjob.Name)
 	}
 
-	err = tc.PodControl.CreatePodsWithControllerRef(tfjob.Namespace, podTemplate, tfjob, controllerRef)
+	err := tc.PodControl.CreatePodsWithControllerRef(tfjob.Namespace, podTemplate, tfjob, controllerRef)
 	if err != nil && errors.IsTimeout(err) {
 		// Pod is created but its initialization has timed out.
 		// If the initialization is successful eventually, the
@@ -209,21 +573,26 @@ func (tc *TFController) createNewPod(tfjob *tfv1.TFJob, rt, index string, spec *
 		// uninitialized for a long time, the informer will not
 		// receive any update, and the controller will create a new
 		// pod when the expectation expires.
+		tc.audit(tfjob, "create pod %s", podTemplate.Name)
 		return nil
 	} else if err != nil {
 		return err
 	}
+	tc.audit(tfjob, "create pod %s", podTemplate.Name)
 	return nil
 }
 
 // setClusterSpec generates and sets TF_CONFIG for the given podTemplateSpec.
-func setClusterSpec(podTemplateSpec *v1.PodTemplateSpec, tfjob *tfv1.TFJob, rt, index string) error {
+func setClusterSpec(podTemplateSpec *v1.PodTemplateSpec, tfjob *tfv1.TFJob, nameTemplate jobcontroller.NameTemplate, rt, index string) error {
 	// Do not set TF_CONFIG for local training jobs.
 	if !isDistributed(tfjob) {
 		return nil
 	}
+	if clusterSpecViaConfigMap(tfjob) {
+		return setClusterSpecConfigMap(podTemplateSpec, tfjob, rt, index)
+	}
 	// Generate TF_CONFIG JSON string.
-	tfConfigStr, err := genTFConfigJSONStr(tfjob, rt, index)
+	tfConfigStr, err := genTFConfigJSONStr(tfjob, nameTemplate, rt, index)
 	if err != nil {
 		return err
 	}
@@ -231,6 +600,9 @@ func setClusterSpec(podTemplateSpec *v1.PodTemplateSpec, tfjob *tfv1.TFJob, rt,
 	if tfConfigStr == "" {
 		return nil
 	}
+	if _, ok := tfjob.Annotations[tfv1.AnnotationTFConfigPath]; ok {
+		return setClusterSpecFile(podTemplateSpec, tfjob, tfConfigStr)
+	}
 	// Add TF_CONFIG environment variable to tensorflow container in the pod.
 	for i := range podTemplateSpec.Spec.Containers {
 		if podTemplateSpec.Spec.Containers[i].Name == tfv1.DefaultContainerName {
@@ -247,6 +619,65 @@ func setClusterSpec(podTemplateSpec *v1.PodTemplateSpec, tfjob *tfv1.TFJob, rt,
 	return nil
 }
 
+// setClusterSpecFile writes TF_CONFIG to the file at the path annotation of
+// the tfjob, which avoids the size limits of env vars in large clusters. The
+// file is projected from a pod annotation by a downward API volume.
+func setClusterSpecFile(podTemplateSpec *v1.PodTemplateSpec, tfjob *tfv1.TFJob, tfConfigStr string) error {
+	err := mountTFConfigFile(podTemplateSpec, tfjob.Annotations[tfv1.AnnotationTFConfigPath], func(file string) v1.VolumeSource {
+		return v1.VolumeSource{
+			DownwardAPI: &v1.DownwardAPIVolumeSource{
+				Items: []v1.DownwardAPIVolumeFile{{
+					Path: file,
+					FieldRef: &v1.ObjectFieldSelector{
+						FieldPath: fmt.Sprintf("metadata.annotations['%s']", tfv1.AnnotationTFConfig),
+					},
+				}},
+			},
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if podTemplateSpec.Annotations == nil {
+		podTemplateSpec.Annotations = make(map[string]string)
+	}
+	podTemplateSpec.Annotations[tfv1.AnnotationTFConfig] = tfConfigStr
+	return nil
+}
+
+// mountTFConfigFile mounts the volume of the TF_CONFIG file at the given path
+// of the tensorflow container, and points TF_CONFIG_FILE to it along with the
+// given env vars. The volume is returned by source for the name of the file.
+func mountTFConfigFile(podTemplateSpec *v1.PodTemplateSpec, path string, source func(file string) v1.VolumeSource, env ...v1.EnvVar) error {
+	dir, file := filepath.Split(filepath.Clean(path))
+	if !filepath.IsAbs(path) || file == "" {
+		return fmt.Errorf("annotation %s must be an absolute file path, got %q: %w", tfv1.AnnotationTFConfigPath, path, ErrPermanent)
+	}
+
+	podTemplateSpec.Spec.Volumes = append(podTemplateSpec.Spec.Volumes, v1.Volume{
+		Name:         tfConfigVolumeName,
+		VolumeSource: source(file),
+	})
+	for i := range podTemplateSpec.Spec.Containers {
+		container := &podTemplateSpec.Spec.Containers[i]
+		if container.Name == tfv1.DefaultContainerName {
+			container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+				Name:      tfConfigVolumeName,
+				MountPath: dir,
+				ReadOnly:  true,
+			})
+			container.Env = append(container.Env, v1.EnvVar{
+				Name:  tfv1.EnvTFConfigFile,
+				Value: filepath.Join(dir, file),
+			})
+			container.Env = append(container.Env, env...)
+			break
+		}
+	}
+	return nil
+}
+
 // isDistributed returns if the TFJob is a distributed training job.
 // Ref https://github.com/kubeflow/tf-operator/issues/1078.
 func isDistributed(tfjob *tfv1.TFJob) bool {
@@ -272,6 +703,24 @@ func isDistributed(tfjob *tfv1.TFJob) bool {
 	return distributionCount != 1
 }
 
+// exitCodeBucket returns the metric label of the exit code of a restarted pod.
+// The exit codes of the signals which kill the containers most often, i.e.
+// SIGKILL, e.g. from the OOM killer, and SIGTERM, e.g. on preemption, are kept
+// as is, the others are grouped so that the cardinality stays low.
+func exitCodeBucket(exitCode int32) string {
+	switch {
+	case exitCode == 128+9 || exitCode == 128+15:
+		return strconv.Itoa(int(exitCode))
+	case exitCode > 128 && exitCode <= 128+64:
+		return "signal"
+	case exitCode >= 0 && exitCode <= 255:
+		return "error"
+	default:
+		// The tensorflow container has not terminated.
+		return "unknown"
+	}
+}
+
 func setRestartPolicy(podTemplateSpec *v1.PodTemplateSpec, spec *common.ReplicaSpec) {
 	if spec.RestartPolicy == common.RestartPolicyExitCode {
 		podTemplateSpec.Spec.RestartPolicy = v1.RestartPolicyNever
@@ -280,6 +729,89 @@ func setRestartPolicy(podTemplateSpec *v1.PodTemplateSpec, spec *common.ReplicaS
 	}
 }
 
+// setTerminationGracePeriod overrides the termination grace period of the pod
+// template with the one of its replica type in the tfjob spec, if any. The
+// operator deletes pods without a grace period of its own, so the pods get
+// this one when they are deleted, e.g. to be restarted or cleaned up.
+func setTerminationGracePeriod(podTemplateSpec *v1.PodTemplateSpec, tfjob *tfv1.TFJob, rt string) {
+	if seconds, ok := terminationGracePeriod(tfjob, rt); ok {
+		podTemplateSpec.Spec.TerminationGracePeriodSeconds = &seconds
+	}
+}
+
+// terminationGracePeriod returns the termination grace period of the replica
+// type in the tfjob spec, and false if it has none.
+func terminationGracePeriod(tfjob *tfv1.TFJob, rt string) (int64, bool) {
+	for rtype, seconds := range tfjob.Spec.TerminationGracePeriodSeconds {
+		if strings.EqualFold(string(rtype), rt) {
+			return seconds, true
+		}
+	}
+	return 0, false
+}
+
+// setReplicaAntiAffinity adds a pod anti-affinity which spreads the pods of
+// the replica type across nodes, soft unless required. It only selects the
+// pods of the tfjob, by its job name label, so that the pods of other tfjobs
+// are not repelled. It is merged with the affinity set by the user.
+func setReplicaAntiAffinity(podTemplateSpec *v1.PodTemplateSpec, tfjob *tfv1.TFJob, rt string, required bool) {
+	if podTemplateSpec.Spec.Affinity == nil {
+		podTemplateSpec.Spec.Affinity = &v1.Affinity{}
+	}
+	if podTemplateSpec.Spec.Affinity.PodAntiAffinity == nil {
+		podTemplateSpec.Spec.Affinity.PodAntiAffinity = &v1.PodAntiAffinity{}
+	}
+	antiAffinity := podTemplateSpec.Spec.Affinity.PodAntiAffinity
+	term := v1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				labelTFJobName:     strings.Replace(tfjob.Name, "/", "-", -1),
+				tfReplicaTypeLabel: rt,
+			},
+		},
+		TopologyKey: hostnameTopologyKey,
+	}
+	if required {
+		antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+			antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, term)
+		return
+	}
+	antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+		antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+		v1.WeightedPodAffinityTerm{Weight: replicaAntiAffinityWeight, PodAffinityTerm: term})
+}
+
+// setTopologyAffinity adds a pod affinity which co-locates all the pods of the
+// tfjob, selected by their job labels, in the topology domain of the
+// AnnotationTopologyKey of the tfjob, if any. The affinity is preferred unless
+// AnnotationTopologyRequired is "true". It is merged with the affinity set by
+// the user.
+func setTopologyAffinity(podTemplateSpec *v1.PodTemplateSpec, tfjob *tfv1.TFJob, jobLabels map[string]string) {
+	topologyKey := tfjob.Annotations[tfv1.AnnotationTopologyKey]
+	if topologyKey == "" {
+		return
+	}
+	if podTemplateSpec.Spec.Affinity == nil {
+		podTemplateSpec.Spec.Affinity = &v1.Affinity{}
+	}
+	if podTemplateSpec.Spec.Affinity.PodAffinity == nil {
+		podTemplateSpec.Spec.Affinity.PodAffinity = &v1.PodAffinity{}
+	}
+	affinity := podTemplateSpec.Spec.Affinity.PodAffinity
+	term := v1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: jobLabels},
+		TopologyKey:   topologyKey,
+	}
+	if tfjob.Annotations[tfv1.AnnotationTopologyRequired] == "true" {
+		affinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+			affinity.RequiredDuringSchedulingIgnoredDuringExecution, term)
+		return
+	}
+	affinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+		affinity.PreferredDuringSchedulingIgnoredDuringExecution,
+		v1.WeightedPodAffinityTerm{Weight: topologyAffinityWeight, PodAffinityTerm: term})
+}
+
 func (tc *TFController) isNonGangSchedulerSet(tfjob *tfv1.TFJob) bool {
 	for _, spec := range tfjob.Spec.TFReplicaSpecs {
 		if spec.Template.Spec.SchedulerName != "" && spec.Template.Spec.SchedulerName != tc.Config.GangSchedulerName {
@@ -288,3 +820,43 @@ func (tc *TFController) isNonGangSchedulerSet(tfjob *tfv1.TFJob) bool {
 	}
 	return false
 }
+
+// propagateMetadata copies the given keys of the tfjob labels or annotations
+// to the ones of the pod, unless the pod already sets them. All the keys are
+// copied if keys holds options.PropagateAll, except the ones in the
+// kubeflow.org and kubernetes.io domains, which belong to the operators and
+// to the tools managing the tfjob.
+func propagateMetadata(podMetadata, tfjobMetadata map[string]string, keys []string) {
+	for _, key := range keys {
+		if key == options.PropagateAll {
+			for key, value := range tfjobMetadata {
+				if _, ok := podMetadata[key]; !ok && !isReservedMetadataKey(key) {
+					podMetadata[key] = value
+				}
+			}
+			return
+		}
+	}
+	for _, key := range keys {
+		value, ok := tfjobMetadata[key]
+		if _, set := podMetadata[key]; ok && !set {
+			podMetadata[key] = value
+		}
+	}
+}
+
+// isReservedMetadataKey returns true if the label or annotation key is in the
+// kubeflow.org or kubernetes.io domains, or one of their subdomains.
+func isReservedMetadataKey(key string) bool {
+	i := strings.Index(key, "/")
+	if i < 0 {
+		return false
+	}
+	domain := key[:i]
+	for _, reserved := range []string{"kubeflow.org", "kubernetes.io", "k8s.io"} {
+		if domain == reserved || strings.HasSuffix(domain, "."+reserved) {
+			return true
+		}
+	}
+	return false
+}
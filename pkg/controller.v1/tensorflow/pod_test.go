@@ -16,19 +16,28 @@
 package tensorflow
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
+	dto "github.com/prometheus/client_model/go"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeclientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/kubernetes/pkg/controller"
 
 	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
 	common "github.com/kubeflow/common/job_controller/api/v1"
 	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
 	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
 	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
 )
 
@@ -153,7 +162,7 @@ func TestClusterSpec(t *testing.T) {
 	for _, c := range testCase {
 		os.Setenv(EnvCustomClusterDomain, c.customClusterDomain)
 		demoTemplateSpec := c.tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template
-		if err := setClusterSpec(&demoTemplateSpec, c.tfJob, c.rt, c.index); err != nil {
+		if err := setClusterSpec(&demoTemplateSpec, c.tfJob, "", c.rt, c.index); err != nil {
 			t.Errorf("Failed to set cluster spec: %v", err)
 		}
 		// The expected cluster spec is nil, which means that we should not set TF_CONFIG.
@@ -171,6 +180,116 @@ func TestClusterSpec(t *testing.T) {
 	}
 }
 
+func TestGenClusterSpec(t *testing.T) {
+	os.Setenv(EnvCustomClusterDomain, "")
+	tfJob := testutil.NewTFJobWithEvaluatorAndNamespace(2, 1, 1, "ns0")
+	// A tfjob read from the API server has no defaults.
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypePS].Replicas = nil
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypePS].Template.Spec.Containers[0].Ports = nil
+
+	var actual map[string][]string
+	actual, err := GenClusterSpec(tfJob)
+	if err != nil {
+		t.Fatalf("Failed to generate the cluster spec: %v", err)
+	}
+	expected := map[string][]string{
+		"ps": {testutil.TestTFJobName + "-ps-0.ns0.svc:2222"},
+		"worker": {
+			testutil.TestTFJobName + "-worker-0.ns0.svc:2222",
+			testutil.TestTFJobName + "-worker-1.ns0.svc:2222",
+		},
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected cluster spec %v, got %v", expected, actual)
+	}
+	if tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypePS].Replicas != nil {
+		t.Errorf("Expected the tfjob not to be defaulted in place")
+	}
+
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypePS].Template.Spec.Containers = nil
+	if _, err := GenClusterSpec(tfJob); err == nil {
+		t.Errorf("Expected an error for a replica spec without containers")
+	}
+}
+
+func TestClusterSpecFile(t *testing.T) {
+	tfJob := testutil.NewTFJob(1, 1)
+	tfJob.Annotations = map[string]string{
+		tfv1.AnnotationTFConfigPath: "/etc/tf-config/tf_config.json",
+	}
+	demoTemplateSpec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template
+	if err := setClusterSpec(&demoTemplateSpec, tfJob, "", "worker", "0"); err != nil {
+		t.Errorf("Failed to set cluster spec: %v", err)
+	}
+	expectedClusterSpec, err := genTFConfigJSONStr(tfJob, "", "worker", "0")
+	if err != nil {
+		t.Errorf("Failed to generate cluster spec: %v", err)
+	}
+	if actual := demoTemplateSpec.Annotations[tfv1.AnnotationTFConfig]; actual != expectedClusterSpec {
+		t.Errorf("Expected %s, got %s", expectedClusterSpec, actual)
+	}
+
+	container := demoTemplateSpec.Spec.Containers[0]
+	if len(container.Env) != 1 || container.Env[0].Name != tfv1.EnvTFConfigFile ||
+		container.Env[0].Value != "/etc/tf-config/tf_config.json" {
+		t.Errorf("Expected only %s to be set, got %v", tfv1.EnvTFConfigFile, container.Env)
+	}
+	if len(container.VolumeMounts) != 1 || container.VolumeMounts[0].MountPath != "/etc/tf-config/" {
+		t.Errorf("Unexpected volume mounts %v", container.VolumeMounts)
+	}
+	volumes := demoTemplateSpec.Spec.Volumes
+	if len(volumes) != 1 || volumes[0].DownwardAPI == nil ||
+		volumes[0].DownwardAPI.Items[0].Path != "tf_config.json" {
+		t.Errorf("Unexpected volumes %v", volumes)
+	}
+
+	// Relative paths are rejected.
+	tfJob.Annotations[tfv1.AnnotationTFConfigPath] = "tf_config.json"
+	demoTemplateSpec = tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template
+	if err := setClusterSpec(&demoTemplateSpec, tfJob, "", "worker", "0"); err == nil {
+		t.Errorf("Expected an error for a relative TF_CONFIG path")
+	}
+}
+
+func TestTFConfigExtra(t *testing.T) {
+	tfJob := testutil.NewTFJob(1, 1)
+	tfJob.Spec.TFConfigExtra = map[string]string{
+		"rpc_layer": "grpc+verbs",
+		// The fields generated by the operator are not overridden.
+		"task": `{"type":"ps","index":1}`,
+	}
+
+	tfConfigStr, err := genTFConfigJSONStr(tfJob, "", "worker", "0")
+	if err != nil {
+		t.Fatalf("Failed to generate TF_CONFIG: %v", err)
+	}
+	var tfConfig struct {
+		TFConfig
+		RPCLayer string `json:"rpc_layer"`
+	}
+	if err := json.Unmarshal([]byte(tfConfigStr), &tfConfig); err != nil {
+		t.Fatalf("Failed to parse TF_CONFIG %s: %v", tfConfigStr, err)
+	}
+	if tfConfig.RPCLayer != "grpc+verbs" {
+		t.Errorf("Expected rpc_layer grpc+verbs, got %q", tfConfig.RPCLayer)
+	}
+	if expected := (TaskSpec{Type: "worker", Index: 0}); tfConfig.Task != expected {
+		t.Errorf("Expected the task %v, got %v", expected, tfConfig.Task)
+	}
+	if len(tfConfig.Cluster["ps"]) != 1 || len(tfConfig.Cluster["worker"]) != 1 || tfConfig.Environment != "cloud" {
+		t.Errorf("Expected the generated cluster spec and environment, got %s", tfConfigStr)
+	}
+
+	// The fields are merged when the cluster spec is passed via a ConfigMap.
+	taskConfigStr, err := genTaskTFConfigJSONStr(tfJob, "worker", "0")
+	if err != nil {
+		t.Fatalf("Failed to generate TF_CONFIG: %v", err)
+	}
+	if expected := `{"environment":"cloud","rpc_layer":"grpc+verbs","task":{"type":"worker","index":0}}`; taskConfigStr != expected {
+		t.Errorf("Expected TF_CONFIG %s, got %s", expected, taskConfigStr)
+	}
+}
+
 func TestIsDistributed(t *testing.T) {
 	type tc struct {
 		tfJob    *tfv1.TFJob
@@ -332,10 +451,21 @@ func TestExitCode(t *testing.T) {
 	if err := podIndexer.Add(pod); err != nil {
 		t.Errorf("%s: unexpected error when adding pod %v", tfJob.Name, err)
 	}
+	restarts := exitCodeRestartsCount.WithLabelValues(testutil.LabelWorker, "signal")
+	var before, after dto.Metric
+	if err := restarts.Write(&before); err != nil {
+		t.Fatalf("Failed to read the exit code restarts counter: %v", err)
+	}
 	_, err = ctr.syncTFJob(testutil.GetKey(tfJob, t))
 	if err != nil {
 		t.Errorf("%s: unexpected error when syncing jobs %v", tfJob.Name, err)
 	}
+	if err := restarts.Write(&after); err != nil {
+		t.Fatalf("Failed to read the exit code restarts counter: %v", err)
+	}
+	if delta := after.GetCounter().GetValue() - before.GetCounter().GetValue(); delta != 1 {
+		t.Errorf("Expected the restart to be counted once in the signal bucket, got %v", delta)
+	}
 
 	found := false
 	for _, deletedPodName := range fakePodControl.DeletePodName {
@@ -348,3 +478,482 @@ func TestExitCode(t *testing.T) {
 	}
 	close(stopCh)
 }
+
+func TestExitCodeBucket(t *testing.T) {
+	testCases := map[int32]string{
+		1:      "error",
+		130:    "signal",
+		137:    "137",
+		143:    "143",
+		0xbeef: "unknown",
+	}
+	for exitCode, expected := range testCases {
+		if actual := exitCodeBucket(exitCode); actual != expected {
+			t.Errorf("Expected exit code %d in bucket %s, got %s", exitCode, expected, actual)
+		}
+	}
+}
+
+func TestSetWorkerAntiAffinity(t *testing.T) {
+	tfJob := testutil.NewTFJob(2, 0)
+	userTerm := v1.WeightedPodAffinityTerm{
+		Weight: 10,
+		PodAffinityTerm: v1.PodAffinityTerm{
+			TopologyKey: "failure-domain.beta.kubernetes.io/zone",
+		},
+	}
+	testCase := []struct {
+		affinity      *v1.Affinity
+		expectedTerms int
+	}{
+		{
+			affinity:      nil,
+			expectedTerms: 1,
+		},
+		{
+			affinity: &v1.Affinity{
+				NodeAffinity: &v1.NodeAffinity{},
+				PodAntiAffinity: &v1.PodAntiAffinity{
+					PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{userTerm},
+				},
+			},
+			expectedTerms: 2,
+		},
+	}
+	for _, c := range testCase {
+		podTemplate := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template.DeepCopy()
+		podTemplate.Spec.Affinity = c.affinity
+		setReplicaAntiAffinity(podTemplate, tfJob, testutil.LabelWorker, false)
+
+		terms := podTemplate.Spec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+		if len(terms) != c.expectedTerms {
+			t.Fatalf("Expected %d anti-affinity terms, got %d", c.expectedTerms, len(terms))
+		}
+		if c.affinity != nil && podTemplate.Spec.Affinity.NodeAffinity == nil {
+			t.Errorf("Expected the user provided node affinity to be kept")
+		}
+		injected := terms[len(terms)-1]
+		if injected.PodAffinityTerm.TopologyKey != hostnameTopologyKey {
+			t.Errorf("Expected topology key %s, got %s", hostnameTopologyKey, injected.PodAffinityTerm.TopologyKey)
+		}
+		if injected.PodAffinityTerm.LabelSelector.MatchLabels[labelTFJobName] != tfJob.Name {
+			t.Errorf("Expected the anti-affinity to select the pods of tfjob %s, got %v",
+				tfJob.Name, injected.PodAffinityTerm.LabelSelector.MatchLabels)
+		}
+	}
+}
+
+func TestSetTopologyAffinity(t *testing.T) {
+	const zoneKey = "topology.kubernetes.io/zone"
+	userTerm := v1.PodAffinityTerm{TopologyKey: hostnameTopologyKey}
+	testCases := []struct {
+		description       string
+		annotations       map[string]string
+		affinity          *v1.Affinity
+		expectedPreferred int
+		expectedRequired  int
+	}{
+		{
+			description: "No topology key",
+		},
+		{
+			description:       "The affinity is preferred by default",
+			annotations:       map[string]string{tfv1.AnnotationTopologyKey: zoneKey},
+			expectedPreferred: 1,
+		},
+		{
+			description: "The affinity is required",
+			annotations: map[string]string{
+				tfv1.AnnotationTopologyKey:      zoneKey,
+				tfv1.AnnotationTopologyRequired: "true",
+			},
+			affinity: &v1.Affinity{
+				NodeAffinity: &v1.NodeAffinity{},
+				PodAffinity: &v1.PodAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{userTerm},
+				},
+			},
+			expectedRequired: 2,
+		},
+	}
+	for _, c := range testCases {
+		tfJob := testutil.NewTFJob(2, 1)
+		tfJob.Annotations = c.annotations
+		jobLabels := testutil.GenLabels(tfJob.Name)
+		podTemplate := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypePS].Template.DeepCopy()
+		podTemplate.Spec.Affinity = c.affinity
+		setTopologyAffinity(podTemplate, tfJob, jobLabels)
+
+		if c.expectedPreferred == 0 && c.expectedRequired == 0 {
+			if podTemplate.Spec.Affinity != nil {
+				t.Errorf("%s: expected no affinity, got %v", c.description, podTemplate.Spec.Affinity)
+			}
+			continue
+		}
+		affinity := podTemplate.Spec.Affinity.PodAffinity
+		preferred := affinity.PreferredDuringSchedulingIgnoredDuringExecution
+		required := affinity.RequiredDuringSchedulingIgnoredDuringExecution
+		if len(preferred) != c.expectedPreferred || len(required) != c.expectedRequired {
+			t.Fatalf("%s: expected %d preferred and %d required terms, got %v", c.description,
+				c.expectedPreferred, c.expectedRequired, affinity)
+		}
+		if c.affinity != nil && (podTemplate.Spec.Affinity.NodeAffinity == nil || !reflect.DeepEqual(required[0], userTerm)) {
+			t.Errorf("%s: expected the user provided affinity to be kept, got %v", c.description, podTemplate.Spec.Affinity)
+		}
+		var injected v1.PodAffinityTerm
+		if len(preferred) > 0 {
+			if preferred[0].Weight != topologyAffinityWeight {
+				t.Errorf("%s: expected weight %d, got %d", c.description, topologyAffinityWeight, preferred[0].Weight)
+			}
+			injected = preferred[0].PodAffinityTerm
+		} else {
+			injected = required[len(required)-1]
+		}
+		if injected.TopologyKey != zoneKey {
+			t.Errorf("%s: expected topology key %s, got %s", c.description, zoneKey, injected.TopologyKey)
+		}
+		if !reflect.DeepEqual(injected.LabelSelector.MatchLabels, jobLabels) {
+			t.Errorf("%s: expected the affinity to select the pods of the tfjob %v, got %v",
+				c.description, jobLabels, injected.LabelSelector.MatchLabels)
+		}
+	}
+}
+
+func TestGangSchedulerName(t *testing.T) {
+	for _, name := range []string{"", "volcano"} {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		ctr.Config.EnableGangScheduling = true
+		expected := jobcontroller.DefaultGangSchedulerName
+		if name != "" {
+			ctr.Config.GangSchedulerName = name
+			expected = name
+		}
+		tfJob := testutil.NewTFJob(1, 0)
+		spec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker]
+		if err := ctr.createNewPod(tfJob, testutil.LabelWorker, "0", spec, false); err != nil {
+			t.Fatalf("Unexpected error when creating the pod: %v", err)
+		}
+		if actual := fakePodControl.Templates[0].Spec.SchedulerName; actual != expected {
+			t.Errorf("Expected the pod to be scheduled by %q with the option %q, got %q", expected, name, actual)
+		}
+	}
+}
+
+func TestTopologyAffinityGangScheduling(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	ctr.Config.EnableGangScheduling = true
+	ctr.Config.GangSchedulerName = "kube-batch"
+	tfJob := testutil.NewTFJob(2, 1)
+	tfJob.Annotations = map[string]string{
+		tfv1.AnnotationTopologyKey:      "topology.kubernetes.io/zone",
+		tfv1.AnnotationTopologyRequired: "true",
+	}
+	spec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker]
+	if err := ctr.createNewPod(tfJob, testutil.LabelWorker, "0", spec, false); err != nil {
+		t.Fatalf("Unexpected error when creating the pod: %v", err)
+	}
+	template := fakePodControl.Templates[0]
+	if template.Spec.SchedulerName != "kube-batch" || template.Annotations[gangSchedulingPodGroupAnnotation] == "" {
+		t.Errorf("Expected the pod to be gang scheduled, got scheduler %q and annotations %v",
+			template.Spec.SchedulerName, template.Annotations)
+	}
+	if template.Spec.Affinity == nil || template.Spec.Affinity.PodAffinity == nil ||
+		len(template.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution) != 1 {
+		t.Errorf("Expected the required topology affinity, got %v", template.Spec.Affinity)
+	}
+}
+
+func TestPSAntiAffinity(t *testing.T) {
+	userTerm := v1.WeightedPodAffinityTerm{
+		Weight:          10,
+		PodAffinityTerm: v1.PodAffinityTerm{TopologyKey: "topology.kubernetes.io/zone"},
+	}
+	type testCase struct {
+		description       string
+		mode              string
+		ps                int
+		expectedPreferred int
+		expectedRequired  int
+	}
+	testCases := []testCase{
+		{"No anti-affinity by default", options.PSAntiAffinityNone, 2, 1, 0},
+		{"A soft anti-affinity is merged with the one of the user", options.PSAntiAffinityPreferred, 2, 2, 0},
+		{"A hard anti-affinity", options.PSAntiAffinityRequired, 2, 1, 1},
+		{"A single PS replica is skipped", options.PSAntiAffinityRequired, 1, 1, 0},
+	}
+	for _, c := range testCases {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		ctr.psAntiAffinity = c.mode
+		tfJob := testutil.NewTFJob(1, c.ps)
+		tfJob.Annotations = map[string]string{tfv1.AnnotationTopologyKey: "topology.kubernetes.io/zone"}
+		spec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypePS]
+		spec.Template.Spec.Affinity = &v1.Affinity{
+			PodAntiAffinity: &v1.PodAntiAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{userTerm},
+			},
+		}
+		if err := ctr.createNewPod(tfJob, testutil.LabelPS, "0", spec, false); err != nil {
+			t.Fatalf("%s: unexpected error when creating the pod: %v", c.description, err)
+		}
+		affinity := fakePodControl.Templates[0].Spec.Affinity
+		if affinity.PodAffinity == nil || len(affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution) != 1 {
+			t.Errorf("%s: expected the topology co-location to be kept, got %v", c.description, affinity.PodAffinity)
+		}
+		preferred := affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+		required := affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+		if len(preferred) != c.expectedPreferred || len(required) != c.expectedRequired {
+			t.Fatalf("%s: expected %d preferred and %d required anti-affinity terms, got %v", c.description,
+				c.expectedPreferred, c.expectedRequired, affinity.PodAntiAffinity)
+		}
+		if !reflect.DeepEqual(preferred[0], userTerm) {
+			t.Errorf("%s: expected the anti-affinity of the user to be kept, got %v", c.description, preferred[0])
+		}
+		var injected []v1.PodAffinityTerm
+		for _, term := range preferred[1:] {
+			injected = append(injected, term.PodAffinityTerm)
+		}
+		injected = append(injected, required...)
+		for _, term := range injected {
+			expected := map[string]string{labelTFJobName: tfJob.Name, tfReplicaTypeLabel: testutil.LabelPS}
+			if !reflect.DeepEqual(term.LabelSelector.MatchLabels, expected) || term.TopologyKey != hostnameTopologyKey {
+				t.Errorf("%s: expected the anti-affinity to select the PS pods of the tfjob by its name, got %v", c.description, term)
+			}
+		}
+	}
+}
+
+func TestDuplicatePods(t *testing.T) {
+	now := time.Now()
+	type testCase struct {
+		description string
+		phases      []v1.PodPhase
+		expected    []string
+	}
+	// The pods are created one minute apart, dup-0 being the oldest.
+	testCases := []testCase{
+		{
+			description: "The running pod is kept",
+			phases:      []v1.PodPhase{v1.PodPending, v1.PodRunning, v1.PodPending},
+			expected:    []string{"dup-2", "dup-0"},
+		},
+		{
+			description: "The newest pod is kept",
+			phases:      []v1.PodPhase{v1.PodPending, v1.PodPending, v1.PodFailed},
+			expected:    []string{"dup-1", "dup-0"},
+		},
+	}
+	for _, c := range testCases {
+		ctr, recorder := newPodIndexTestController()
+		fakePodControl := ctr.PodControl.(*controller.FakePodControl)
+		tfJob := testutil.NewTFJob(1, 0)
+
+		var pods []*v1.Pod
+		for i, phase := range c.phases {
+			pod := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+			pod.Name = fmt.Sprintf("dup-%d", i)
+			pod.CreationTimestamp = metav1.NewTime(now.Add(time.Duration(i) * time.Minute))
+			pod.Status.Phase = phase
+			pods = append(pods, pod)
+		}
+		if err := ctr.reconcileReplicaTypes(tfJob, map[string][]*v1.Pod{testutil.LabelWorker: pods}, nil); err != nil {
+			t.Errorf("%s: unexpected error when reconciling pods: %v", c.description, err)
+		}
+		if !reflect.DeepEqual(fakePodControl.DeletePodName, c.expected) {
+			t.Errorf("%s: expected the deletions %v, got %v", c.description, c.expected, fakePodControl.DeletePodName)
+		}
+		if len(fakePodControl.Templates) != 0 {
+			t.Errorf("%s: expected no pod creation, got %d", c.description, len(fakePodControl.Templates))
+		}
+		if events := countEvents(recorder, duplicatePodReason); events != len(c.expected) {
+			t.Errorf("%s: expected %d %s events, got %d", c.description, len(c.expected), duplicatePodReason, events)
+		}
+		key := jobcontroller.GenExpectationPodsKey(testutil.GetKey(tfJob, t), testutil.LabelWorker)
+		if exp, exists, err := ctr.Expectations.GetExpectations(key); err != nil || !exists {
+			t.Errorf("%s: expected the deletions to be expected: %v", c.description, err)
+		} else if _, del := exp.GetExpectations(); del != int64(len(c.expected)) {
+			t.Errorf("%s: expected %d deletions to be expected, got %d", c.description, len(c.expected), del)
+		}
+	}
+}
+
+func TestOutOfRangePods(t *testing.T) {
+	ctr, recorder := newPodIndexTestController()
+	fakePodControl := ctr.PodControl.(*controller.FakePodControl)
+	tfJob := testutil.NewTFJob(1, 0)
+
+	pods := []*v1.Pod{
+		testutil.NewPod(tfJob, testutil.LabelWorker, 0, t),
+		testutil.NewPod(tfJob, testutil.LabelWorker, 1, t),
+		testutil.NewPod(tfJob, testutil.LabelWorker, 3, t),
+	}
+	deleting := testutil.NewPod(tfJob, testutil.LabelWorker, 2, t)
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	pods = append(pods, deleting)
+
+	if err := ctr.reconcileReplicaTypes(tfJob, map[string][]*v1.Pod{testutil.LabelWorker: pods}, nil); err != nil {
+		t.Errorf("Unexpected error when reconciling pods: %v", err)
+	}
+	// The highest index is deleted first.
+	expected := []string{"worker-3", "worker-1"}
+	if !reflect.DeepEqual(fakePodControl.DeletePodName, expected) {
+		t.Errorf("Expected the deletions %v, got %v", expected, fakePodControl.DeletePodName)
+	}
+	if events := countEvents(recorder, outOfRangePodReason); events != len(expected) {
+		t.Errorf("Expected %d %s events, got %d", len(expected), outOfRangePodReason, events)
+	}
+}
+
+func TestPodDeletionCost(t *testing.T) {
+	ctr, _ := newPodIndexTestController()
+	fakePodControl := ctr.PodControl.(*controller.FakePodControl)
+	tfJob := testutil.NewTFJob(1, 0)
+
+	newPod := func(index int, cost string) *v1.Pod {
+		pod := testutil.NewPod(tfJob, testutil.LabelWorker, index, t)
+		if cost != "" {
+			pod.Annotations = map[string]string{podDeletionCostAnnotation: cost}
+		}
+		return pod
+	}
+	// Worker 0 has a duplicate of a higher cost, which is kept.
+	duplicate := newPod(0, "100")
+	duplicate.Name = "worker-0-duplicate"
+	pods := []*v1.Pod{
+		newPod(0, ""),
+		duplicate,
+		newPod(1, "10"),
+		newPod(2, ""),
+		newPod(3, "-5"),
+		newPod(4, "invalid"),
+	}
+
+	if err := ctr.reconcileReplicaTypes(tfJob, map[string][]*v1.Pod{testutil.LabelWorker: pods}, nil); err != nil {
+		t.Errorf("Unexpected error when reconciling pods: %v", err)
+	}
+	expected := []string{"worker-0", "worker-3", "worker-4", "worker-2", "worker-1"}
+	if !reflect.DeepEqual(fakePodControl.DeletePodName, expected) {
+		t.Errorf("Expected the deletions %v, got %v", expected, fakePodControl.DeletePodName)
+	}
+}
+
+// countEvents drains the events of the recorder and counts those with the reason.
+func countEvents(recorder *record.FakeRecorder, reason string) int {
+	count := 0
+	for {
+		select {
+		case event := <-recorder.Events:
+			if strings.Contains(event, " "+reason+" ") {
+				count++
+			}
+		default:
+			return count
+		}
+	}
+}
+
+func TestTerminationGracePeriod(t *testing.T) {
+	ctr, _ := newPodIndexTestController()
+	fakePodControl := ctr.PodControl.(*controller.FakePodControl)
+	tfJob := testutil.NewTFJob(1, 1)
+	workerGracePeriod := int64(10)
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template.Spec.TerminationGracePeriodSeconds = &workerGracePeriod
+	tfJob.Spec.TerminationGracePeriodSeconds = map[tfv1.TFReplicaType]int64{
+		tfv1.TFReplicaTypePS: 300,
+	}
+
+	if err := ctr.reconcileReplicaTypes(tfJob, nil, nil); err != nil {
+		t.Errorf("Unexpected error when reconciling pods: %v", err)
+	}
+	if len(fakePodControl.Templates) != 2 {
+		t.Fatalf("Expected 2 pod creations, got %d", len(fakePodControl.Templates))
+	}
+	// The PS pod gets the override, the worker pod keeps its template.
+	expected := map[string]int64{testutil.LabelPS: 300, testutil.LabelWorker: 10}
+	for _, template := range fakePodControl.Templates {
+		rt := template.Labels[tfReplicaTypeLabel]
+		actual := template.Spec.TerminationGracePeriodSeconds
+		if actual == nil || *actual != expected[rt] {
+			t.Errorf("Expected the %s pod to have a termination grace period of %d, got %v", rt, expected[rt], actual)
+		}
+	}
+}
+
+func TestPropagateMetadata(t *testing.T) {
+	type testCase struct {
+		description         string
+		labels              []string
+		annotations         []string
+		expectedLabels      map[string]string
+		expectedAnnotations map[string]string
+	}
+	testCases := []testCase{
+		{
+			description:         "Nothing is propagated by default",
+			expectedLabels:      map[string]string{"template": "label"},
+			expectedAnnotations: map[string]string{"team": "template"},
+		},
+		{
+			description:         "The listed keys are propagated",
+			labels:              []string{"cost-center", tfReplicaTypeLabel},
+			annotations:         []string{"team", "missing"},
+			expectedLabels:      map[string]string{"template": "label", "cost-center": "42"},
+			expectedAnnotations: map[string]string{"team": "template"},
+		},
+		{
+			description:         "All the keys outside of the reserved domains are propagated",
+			labels:              []string{options.PropagateAll},
+			annotations:         []string{options.PropagateAll},
+			expectedLabels:      map[string]string{"template": "label", "cost-center": "42", "example.com/owner": "me"},
+			expectedAnnotations: map[string]string{"team": "template", "chargeback": "yes"},
+		},
+	}
+	for _, c := range testCases {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		ctr.propagatedLabels = c.labels
+		ctr.propagatedAnnotations = c.annotations
+
+		tfJob := testutil.NewTFJob(1, 0)
+		tfJob.Labels = map[string]string{
+			"cost-center":         "42",
+			"example.com/owner":   "me",
+			tfReplicaTypeLabel:    "job",
+			labelTFJobName:        "other",
+			"app.kubernetes.io/x": "reserved",
+		}
+		tfJob.Annotations = map[string]string{
+			"team":                          "job",
+			"chargeback":                    "yes",
+			tfv1.AnnotationDefaultPortName:  "reserved",
+			"kubectl.kubernetes.io/applied": "reserved",
+		}
+		template := &tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template
+		template.Labels = map[string]string{"template": "label"}
+		template.Annotations = map[string]string{"team": "template"}
+
+		if err := ctr.createNewPod(tfJob, testutil.LabelWorker, "0", tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker], false); err != nil {
+			t.Fatalf("%s: unexpected error when creating the pod: %v", c.description, err)
+		}
+		pod := fakePodControl.Templates[0]
+
+		// The labels of the operator win over the propagated ones.
+		expectedLabels := ctr.genLabels(tfJob)
+		expectedLabels[tfReplicaTypeLabel] = testutil.LabelWorker
+		expectedLabels[tfReplicaIndexLabel] = "0"
+		for key, value := range c.expectedLabels {
+			expectedLabels[key] = value
+		}
+		if !reflect.DeepEqual(pod.Labels, expectedLabels) {
+			t.Errorf("%s: expected the labels %v, got %v", c.description, expectedLabels, pod.Labels)
+		}
+		for key, value := range c.expectedAnnotations {
+			if pod.Annotations[key] != value {
+				t.Errorf("%s: expected the annotation %s=%s, got %v", c.description, key, value, pod.Annotations)
+			}
+		}
+		for _, key := range []string{"chargeback", tfv1.AnnotationDefaultPortName, "kubectl.kubernetes.io/applied"} {
+			if _, ok := pod.Annotations[key]; ok && c.expectedAnnotations[key] == "" {
+				t.Errorf("%s: expected the annotation %s not to be propagated, got %v", c.description, key, pod.Annotations)
+			}
+		}
+	}
+}
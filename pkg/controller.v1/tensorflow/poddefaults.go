@@ -0,0 +1,268 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// PodDefaultsKey is the key of the pod defaults ConfigMap holding the partial
+// pod template merged into the pods of the tfjobs.
+const PodDefaultsKey = "podTemplate"
+
+// WatchPodDefaults sets the informer of the ConfigMap holding the pod
+// defaults, so that they are updated along with the ConfigMap. The caller is
+// responsible for starting the informer.
+func (tc *TFController) WatchPodDefaults(configMapInformer coreinformers.ConfigMapInformer, namespace, name string) {
+	configMapInformer.Informer().AddEventHandler(newConfigMapEventHandler(namespace, name, tc.setPodDefaults, func() {
+		log.Infof("Pod defaults ConfigMap %s/%s deleted, no pod defaults are applied", namespace, name)
+		tc.podDefaultsLock.Lock()
+		defer tc.podDefaultsLock.Unlock()
+		tc.podDefaults = nil
+	}))
+	tc.podDefaultsInformerSynced = configMapInformer.Informer().HasSynced
+}
+
+// newConfigMapEventHandler returns the event handler calling set when the
+// ConfigMap of the given namespace and name is added or updated, and deleted
+// when it is deleted.
+func newConfigMapEventHandler(namespace, name string, set func(*v1.ConfigMap), deleted func()) cache.ResourceEventHandler {
+	return cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			configMap, ok := obj.(*v1.ConfigMap)
+			return ok && configMap.Namespace == namespace && configMap.Name == name
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				set(obj.(*v1.ConfigMap))
+			},
+			UpdateFunc: func(old, cur interface{}) {
+				set(cur.(*v1.ConfigMap))
+			},
+			DeleteFunc: func(obj interface{}) {
+				deleted()
+			},
+		},
+	}
+}
+
+// setPodDefaults sets the pod defaults from the ConfigMap. The previous pod
+// defaults are kept if it cannot be parsed.
+func (tc *TFController) setPodDefaults(configMap *v1.ConfigMap) {
+	defaults, err := parsePodDefaults(configMap)
+	if err != nil {
+		log.Errorf("Failed to parse the pod defaults ConfigMap %s/%s, the previous pod defaults are kept: %v",
+			configMap.Namespace, configMap.Name, err)
+		return
+	}
+	log.Infof("Pod defaults updated from ConfigMap %s/%s", configMap.Namespace, configMap.Name)
+	tc.podDefaultsLock.Lock()
+	defer tc.podDefaultsLock.Unlock()
+	tc.podDefaults = defaults
+}
+
+// parsePodDefaults returns the partial pod template of the ConfigMap, or nil
+// if it is empty. The restart policy of the pods is set by the replica specs,
+// so it cannot be defaulted.
+func parsePodDefaults(configMap *v1.ConfigMap) (*v1.PodTemplateSpec, error) {
+	data, ok := configMap.Data[PodDefaultsKey]
+	if !ok || data == "" {
+		return nil, nil
+	}
+	defaults := &v1.PodTemplateSpec{}
+	if err := yaml.Unmarshal([]byte(data), defaults); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", PodDefaultsKey, err)
+	}
+	if defaults.Spec.RestartPolicy != "" {
+		return nil, fmt.Errorf("invalid %s: the restart policy cannot be defaulted", PodDefaultsKey)
+	}
+	return defaults, nil
+}
+
+// getPodDefaults returns the current pod defaults, or nil if there are none.
+func (tc *TFController) getPodDefaults() *v1.PodTemplateSpec {
+	tc.podDefaultsLock.Lock()
+	defer tc.podDefaultsLock.Unlock()
+	return tc.podDefaults
+}
+
+// applyPodDefaults merges the pod defaults into the pod template, keeping the
+// values the pod template specifies. The metadata, the scheduling fields and
+// the volumes are merged by key, and the defaults of a container are merged
+// into the container of the same name, or into every container if it has no
+// name.
+func applyPodDefaults(podTemplate, defaults *v1.PodTemplateSpec) {
+	if defaults == nil {
+		return
+	}
+	podTemplate.Labels = mergeStringMap(podTemplate.Labels, defaults.Labels)
+	podTemplate.Annotations = mergeStringMap(podTemplate.Annotations, defaults.Annotations)
+
+	spec, defaultSpec := &podTemplate.Spec, &defaults.Spec
+	if spec.SchedulerName == "" {
+		spec.SchedulerName = defaultSpec.SchedulerName
+	}
+	if spec.PriorityClassName == "" {
+		spec.PriorityClassName = defaultSpec.PriorityClassName
+	}
+	if spec.ServiceAccountName == "" {
+		spec.ServiceAccountName = defaultSpec.ServiceAccountName
+	}
+	if spec.Affinity == nil && defaultSpec.Affinity != nil {
+		spec.Affinity = defaultSpec.Affinity.DeepCopy()
+	}
+	if spec.SecurityContext == nil && defaultSpec.SecurityContext != nil {
+		spec.SecurityContext = defaultSpec.SecurityContext.DeepCopy()
+	}
+	spec.NodeSelector = mergeStringMap(spec.NodeSelector, defaultSpec.NodeSelector)
+
+	for _, secret := range defaultSpec.ImagePullSecrets {
+		if !hasImagePullSecret(spec.ImagePullSecrets, secret.Name) {
+			spec.ImagePullSecrets = append(spec.ImagePullSecrets, secret)
+		}
+	}
+	// A toleration of the pod template overrides the defaults with the
+	// same key and effect.
+	addTolerations(spec, defaultSpec.Tolerations...)
+	for _, volume := range defaultSpec.Volumes {
+		if !hasVolume(spec.Volumes, volume.Name) {
+			spec.Volumes = append(spec.Volumes, *volume.DeepCopy())
+		}
+	}
+
+	applyContainerDefaults(spec.InitContainers, defaultSpec.InitContainers)
+	applyContainerDefaults(spec.Containers, defaultSpec.Containers)
+}
+
+// applyContainerDefaults merges the default containers into the containers.
+func applyContainerDefaults(containers, defaults []v1.Container) {
+	for i := range containers {
+		for j := range defaults {
+			if defaults[j].Name == "" || defaults[j].Name == containers[i].Name {
+				applyContainerDefault(&containers[i], &defaults[j])
+			}
+		}
+	}
+}
+
+// applyContainerDefault merges the default container into the container,
+// keeping the values the container specifies.
+func applyContainerDefault(container, defaults *v1.Container) {
+	if container.ImagePullPolicy == "" {
+		container.ImagePullPolicy = defaults.ImagePullPolicy
+	}
+	for _, env := range defaults.Env {
+		if !hasEnvVar(container.Env, env.Name) {
+			container.Env = append(container.Env, *env.DeepCopy())
+		}
+	}
+	for _, mount := range defaults.VolumeMounts {
+		if !hasVolumeMount(container.VolumeMounts, mount.MountPath) {
+			container.VolumeMounts = append(container.VolumeMounts, mount)
+		}
+	}
+
+	for name, quantity := range defaults.Resources.Limits {
+		if _, ok := container.Resources.Limits[name]; !ok {
+			if container.Resources.Limits == nil {
+				container.Resources.Limits = make(v1.ResourceList)
+			}
+			container.Resources.Limits[name] = quantity.DeepCopy()
+		}
+	}
+	for name, quantity := range defaults.Resources.Requests {
+		if _, ok := container.Resources.Requests[name]; ok {
+			continue
+		}
+		// The request defaults to the limit the container specifies, which
+		// the default request may exceed.
+		if _, ok := container.Resources.Limits[name]; ok {
+			if _, isDefault := defaults.Resources.Limits[name]; !isDefault {
+				continue
+			}
+		}
+		if container.Resources.Requests == nil {
+			container.Resources.Requests = make(v1.ResourceList)
+		}
+		container.Resources.Requests[name] = quantity.DeepCopy()
+	}
+}
+
+// mergeStringMap adds the defaults whose key is missing from the map.
+func mergeStringMap(m, defaults map[string]string) map[string]string {
+	for key, value := range defaults {
+		if m == nil {
+			m = make(map[string]string)
+		}
+		if _, ok := m[key]; !ok {
+			m[key] = value
+		}
+	}
+	return m
+}
+
+func hasImagePullSecret(secrets []v1.LocalObjectReference, name string) bool {
+	for _, secret := range secrets {
+		if secret.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasToleration(tolerations []v1.Toleration, key string, effect v1.TaintEffect) bool {
+	for _, toleration := range tolerations {
+		if toleration.Key == key && toleration.Effect == effect {
+			return true
+		}
+	}
+	return false
+}
+
+func hasVolume(volumes []v1.Volume, name string) bool {
+	for _, volume := range volumes {
+		if volume.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasEnvVar(env []v1.EnvVar, name string) bool {
+	for _, e := range env {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasVolumeMount(mounts []v1.VolumeMount, mountPath string) bool {
+	for _, mount := range mounts {
+		if mount.MountPath == mountPath {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+const testPodDefaults = `
+spec:
+  priorityClassName: training-low
+  imagePullSecrets:
+  - name: registry
+  tolerations:
+  - key: dedicated
+    operator: Equal
+    value: training
+    effect: NoSchedule
+  - key: gpu
+    operator: Exists
+    effect: NoSchedule
+  containers:
+  - env:
+    - name: LOG_LEVEL
+      value: info
+    - name: HTTP_PROXY
+      value: proxy:3128
+    resources:
+      requests:
+        cpu: "1"
+        memory: 1Gi
+`
+
+func newPodDefaultsConfigMap(data string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-defaults", Namespace: "kubeflow"},
+		Data:       map[string]string{PodDefaultsKey: data},
+	}
+}
+
+func TestApplyPodDefaults(t *testing.T) {
+	defaults, err := parsePodDefaults(newPodDefaultsConfigMap(testPodDefaults))
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing the pod defaults: %v", err)
+	}
+
+	podTemplate := &v1.PodTemplateSpec{
+		Spec: v1.PodSpec{
+			Tolerations: []v1.Toleration{
+				{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "research", Effect: v1.TaintEffectNoSchedule},
+			},
+			Containers: []v1.Container{
+				{
+					Name: tfv1.DefaultContainerName,
+					Env:  []v1.EnvVar{{Name: "LOG_LEVEL", Value: "debug"}},
+					Resources: v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")},
+					},
+				},
+				{
+					Name: "sidecar",
+					Resources: v1.ResourceRequirements{
+						Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("512Mi")},
+					},
+				},
+			},
+		},
+	}
+	applyPodDefaults(podTemplate, defaults)
+
+	if podTemplate.Spec.PriorityClassName != "training-low" {
+		t.Errorf("Expected the default priority class, got %q", podTemplate.Spec.PriorityClassName)
+	}
+	if len(podTemplate.Spec.ImagePullSecrets) != 1 || podTemplate.Spec.ImagePullSecrets[0].Name != "registry" {
+		t.Errorf("Expected the default image pull secret, got %v", podTemplate.Spec.ImagePullSecrets)
+	}
+	// The toleration of the template overrides the default of the same key
+	// and effect.
+	expectedTolerations := []v1.Toleration{
+		{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "research", Effect: v1.TaintEffectNoSchedule},
+		{Key: "gpu", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule},
+	}
+	if !reflect.DeepEqual(podTemplate.Spec.Tolerations, expectedTolerations) {
+		t.Errorf("Expected tolerations %v, got %v", expectedTolerations, podTemplate.Spec.Tolerations)
+	}
+
+	// The env vars of the container override the defaults of the same name.
+	expectedEnv := []v1.EnvVar{{Name: "LOG_LEVEL", Value: "debug"}, {Name: "HTTP_PROXY", Value: "proxy:3128"}}
+	if env := podTemplate.Spec.Containers[0].Env; !reflect.DeepEqual(env, expectedEnv) {
+		t.Errorf("Expected env %v, got %v", expectedEnv, env)
+	}
+	expectedEnv = []v1.EnvVar{{Name: "LOG_LEVEL", Value: "info"}, {Name: "HTTP_PROXY", Value: "proxy:3128"}}
+	if env := podTemplate.Spec.Containers[1].Env; !reflect.DeepEqual(env, expectedEnv) {
+		t.Errorf("Expected the default env %v in the sidecar, got %v", expectedEnv, env)
+	}
+
+	// The requests of the container override the defaults, and a limit the
+	// container specifies prevents the default request from exceeding it.
+	tfContainer := podTemplate.Spec.Containers[0]
+	if cpu := tfContainer.Resources.Requests[v1.ResourceCPU]; cpu.String() != "4" {
+		t.Errorf("Expected the cpu request of the container, got %v", cpu.String())
+	}
+	if memory := tfContainer.Resources.Requests[v1.ResourceMemory]; memory.String() != "1Gi" {
+		t.Errorf("Expected the default memory request, got %v", memory.String())
+	}
+	sidecar := podTemplate.Spec.Containers[1]
+	if _, ok := sidecar.Resources.Requests[v1.ResourceMemory]; ok {
+		t.Errorf("Expected no default memory request above the memory limit, got %v", sidecar.Resources.Requests)
+	}
+	if cpu := sidecar.Resources.Requests[v1.ResourceCPU]; cpu.String() != "1" {
+		t.Errorf("Expected the default cpu request, got %v", cpu.String())
+	}
+}
+
+func TestParsePodDefaults(t *testing.T) {
+	type testCase struct {
+		description string
+		data        string
+		expectedErr bool
+		expectedNil bool
+	}
+	testCases := []testCase{
+		{"Empty pod defaults", "", false, true},
+		{"Valid pod defaults", testPodDefaults, false, false},
+		{"Malformed pod defaults", "spec: [", true, true},
+		{"Pod defaults setting the restart policy", "spec:\n  restartPolicy: Always\n", true, true},
+	}
+	for _, c := range testCases {
+		defaults, err := parsePodDefaults(newPodDefaultsConfigMap(c.data))
+		if (err != nil) != c.expectedErr {
+			t.Errorf("%s: expected error %v, got %v", c.description, c.expectedErr, err)
+		}
+		if (defaults == nil) != c.expectedNil {
+			t.Errorf("%s: expected nil pod defaults %v, got %v", c.description, c.expectedNil, defaults)
+		}
+	}
+}
+
+func TestCreatePodWithPodDefaults(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+	tfJob := testutil.NewTFJob(2, 0)
+
+	type step struct {
+		description      string
+		data             string
+		expectedPriority string
+		expectedLogLevel bool
+	}
+	steps := []step{
+		{"The pods get the pod defaults", testPodDefaults, "training-low", true},
+		{"The pod defaults are updated", "spec:\n  priorityClassName: training-high\n", "training-high", false},
+		{"The malformed pod defaults are ignored", "spec: [", "training-high", false},
+	}
+	for _, s := range steps {
+		ctr.setPodDefaults(newPodDefaultsConfigMap(s.data))
+		fakePodControl.Clear()
+		if err := ctr.reconcileTFJobs(tfJob.DeepCopy()); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", s.description, err)
+		}
+		if len(fakePodControl.Templates) != 2 {
+			t.Fatalf("%s: expected 2 pods, got %d", s.description, len(fakePodControl.Templates))
+		}
+		for _, template := range fakePodControl.Templates {
+			if template.Spec.PriorityClassName != s.expectedPriority {
+				t.Errorf("%s: expected priority class %q, got %q", s.description, s.expectedPriority, template.Spec.PriorityClassName)
+			}
+			// TF_CONFIG is set along with the default env vars.
+			container := findContainer(template.Spec.Containers, tfv1.DefaultContainerName)
+			if !hasEnvVar(container.Env, tfConfig) || hasEnvVar(container.Env, "LOG_LEVEL") != s.expectedLogLevel {
+				t.Errorf("%s: expected TF_CONFIG and the default env vars %v, got %v", s.description, s.expectedLogLevel, container.Env)
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/cache"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+// podDisruptionBudgetSyncFailedReason is the reason of the event emitted when
+// the PodDisruptionBudget of a tfjob cannot be applied.
+const podDisruptionBudgetSyncFailedReason = "PodDisruptionBudgetSyncFailed"
+
+// newPodDisruptionBudget returns the PodDisruptionBudget selecting the pods of
+// the tfjob. Its minAvailable defaults to the replicas whose failures are not
+// ignored, so that none of them is evicted voluntarily. An integer
+// minAvailable is used rather than a maxUnavailable of 0, which the disruption
+// controller cannot resolve for the pods of a custom resource without a scale
+// subresource.
+func (tc *TFController) newPodDisruptionBudget(tfjob *tfv1.TFJob) *policyv1beta1.PodDisruptionBudget {
+	labels := tc.genLabels(tfjob)
+	spec := policyv1beta1.PodDisruptionBudgetSpec{
+		Selector: &metav1.LabelSelector{MatchLabels: labels},
+	}
+	if tfjob.Spec.PodDisruptionBudget != nil {
+		spec.MinAvailable = tfjob.Spec.PodDisruptionBudget.MinAvailable
+		spec.MaxUnavailable = tfjob.Spec.PodDisruptionBudget.MaxUnavailable
+	}
+	if spec.MinAvailable == nil && spec.MaxUnavailable == nil {
+		// The total is bounded by maxReplicas, which fits in an int32.
+		minAvailable := intstr.FromInt(int(getTotalReplicas(tfjob) - getTotalIgnoredReplicas(tfjob)))
+		spec.MinAvailable = &minAvailable
+	}
+	return &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tfjob.Name,
+			Namespace: tfjob.Namespace,
+			Labels:    labels,
+		},
+		Spec: spec,
+	}
+}
+
+// podDisruptionBudgetEnabled returns true if the pods of the tfjob are
+// protected by a PodDisruptionBudget, set by its spec, its annotation or
+// --enable-pod-disruption-budget.
+func (tc *TFController) podDisruptionBudgetEnabled(tfjob *tfv1.TFJob) bool {
+	return tfjob.Spec.PodDisruptionBudget != nil || tc.enablePodDisruptionBudget ||
+		tfjob.Annotations[tfv1.AnnotationPodDisruptionBudget] == "true"
+}
+
+// getPodDisruptionBudget returns the PodDisruptionBudget of the tfjob from the
+// cache, or nil if there is none controlled by the tfjob.
+func (tc *TFController) getPodDisruptionBudget(tfjob *tfv1.TFJob) (*policyv1beta1.PodDisruptionBudget, error) {
+	pdb, err := tc.pdbLister.PodDisruptionBudgets(tfjob.Namespace).Get(tfjob.Name)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if owner := metav1.GetControllerOf(pdb); owner == nil || owner.UID != tfjob.UID {
+		return nil, nil
+	}
+	return pdb, nil
+}
+
+// syncPodDisruptionBudget creates or updates the PodDisruptionBudget of the
+// tfjob, so that it follows the changes of the replicas and is recreated if
+// it was deleted by others. The budget is only applied if the cached one
+// differs.
+func (tc *TFController) syncPodDisruptionBudget(tfjob *tfv1.TFJob) error {
+	if !tc.podDisruptionBudgetEnabled(tfjob) {
+		return nil
+	}
+	pdb := tc.newPodDisruptionBudget(tfjob)
+	existing, err := tc.getPodDisruptionBudget(tfjob)
+	if err != nil {
+		return err
+	}
+	if existing != nil && apiequality.Semantic.DeepEqual(existing.Spec, pdb.Spec) {
+		return nil
+	}
+	return tc.PDBControl.ApplyPodDisruptionBudget(tfjob.Namespace, pdb, tfjob, tc.GenOwnerReference(tfjob))
+}
+
+// deletePodDisruptionBudget deletes the PodDisruptionBudget of the terminated
+// tfjob, so that its remaining pods, e.g. the ones kept by the CleanPodPolicy,
+// do not block the drain of their nodes. It is deleted even if the budget is
+// not enabled anymore.
+func (tc *TFController) deletePodDisruptionBudget(tfjob *tfv1.TFJob) error {
+	existing, err := tc.getPodDisruptionBudget(tfjob)
+	if err != nil || existing == nil {
+		return err
+	}
+	tflogger.LoggerForJob(tfjob).Infof("Deleting the poddisruptionbudget %s", tfjob.Name)
+	return tc.PDBControl.DeletePodDisruptionBudget(tfjob.Namespace, tfjob.Name, tfjob)
+}
+
+// updatePodDisruptionBudget syncs the tfjob whose PodDisruptionBudget was
+// changed, so that its spec is applied again.
+func (tc *TFController) updatePodDisruptionBudget(old, cur interface{}) {
+	pdb, ok := cur.(*policyv1beta1.PodDisruptionBudget)
+	if !ok {
+		return
+	}
+	if key, ok := pdbTFJobKey(pdb); ok {
+		tc.WorkQueue.Add(key)
+	}
+}
+
+// handleDeletedPodDisruptionBudget syncs the tfjob whose PodDisruptionBudget
+// was deleted, so that it is recreated while the tfjob runs.
+func (tc *TFController) handleDeletedPodDisruptionBudget(obj interface{}) {
+	pdb, ok := obj.(*policyv1beta1.PodDisruptionBudget)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
+		}
+		if pdb, ok = tombstone.Obj.(*policyv1beta1.PodDisruptionBudget); !ok {
+			return
+		}
+	}
+	if key, ok := pdbTFJobKey(pdb); ok {
+		tc.WorkQueue.Add(key)
+	}
+}
+
+// pdbTFJobKey returns the key of the tfjob controlling the
+// PodDisruptionBudget.
+func pdbTFJobKey(pdb *policyv1beta1.PodDisruptionBudget) (string, bool) {
+	controllerRef := metav1.GetControllerOf(pdb)
+	if controllerRef == nil || controllerRef.Kind != tfv1.Kind {
+		return "", false
+	}
+	return pdb.Namespace + "/" + controllerRef.Name, true
+}
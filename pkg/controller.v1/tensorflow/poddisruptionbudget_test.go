@@ -0,0 +1,179 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	policylisters "k8s.io/client-go/listers/policy/v1beta1"
+	"k8s.io/client-go/tools/cache"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
+)
+
+// newPodDisruptionBudgetTestController returns a controller whose
+// PodDisruptionBudgets are listed from the returned indexer.
+func newPodDisruptionBudgetTestController() (*TFController, *control.FakePodDisruptionBudgetControl, cache.Indexer) {
+	ctr, _, _ := newErrorsTestController()
+	fakePDBControl := &control.FakePodDisruptionBudgetControl{}
+	ctr.PDBControl = fakePDBControl
+	pdbIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	ctr.pdbLister = policylisters.NewPodDisruptionBudgetLister(pdbIndexer)
+	return ctr, fakePDBControl, pdbIndexer
+}
+
+// observePodDisruptionBudgets adds the PodDisruptionBudgets applied by the
+// fake control to the indexer along with their owner references, as the
+// informer would observe them.
+func observePodDisruptionBudgets(t *testing.T, fakePDBControl *control.FakePodDisruptionBudgetControl, pdbIndexer cache.Indexer) {
+	for i := range fakePDBControl.Templates {
+		pdb := fakePDBControl.Templates[i].DeepCopy()
+		pdb.OwnerReferences = []metav1.OwnerReference{fakePDBControl.ControllerRefs[i]}
+		if err := pdbIndexer.Update(pdb); err != nil {
+			t.Fatalf("Failed to add the PodDisruptionBudget: %v", err)
+		}
+	}
+}
+
+func TestSyncPodDisruptionBudget(t *testing.T) {
+	ctr, fakePDBControl, pdbIndexer := newPodDisruptionBudgetTestController()
+	tfJob := testutil.NewTFJob(2, 1)
+	tfJob.Spec.PodDisruptionBudget = &tfv1.PodDisruptionBudgetSpec{}
+
+	maxUnavailable := intstr.FromString("50%")
+	type step struct {
+		description    string
+		workers        int32
+		maxUnavailable *intstr.IntOrString
+		deleted        bool
+		applied        bool
+		minAvailable   *intstr.IntOrString
+	}
+	three, four := intstr.FromInt(3), intstr.FromInt(4)
+	steps := []step{
+		{"The budget is created", 2, nil, false, true, &three},
+		{"The unchanged budget is not applied again", 2, nil, false, false, nil},
+		{"The budget deleted by others is recreated", 2, nil, true, true, &three},
+		{"The budget follows the replicas", 3, nil, false, true, &four},
+		{"The budget follows the spec", 3, &maxUnavailable, false, true, nil},
+	}
+	for _, s := range steps {
+		fakePDBControl.Clear()
+		if s.deleted {
+			if err := pdbIndexer.Delete(&policyv1beta1.PodDisruptionBudget{
+				ObjectMeta: metav1.ObjectMeta{Name: tfJob.Name, Namespace: tfJob.Namespace},
+			}); err != nil {
+				t.Fatalf("%s: failed to delete the PodDisruptionBudget: %v", s.description, err)
+			}
+		}
+		*tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Replicas = s.workers
+		tfJob.Spec.PodDisruptionBudget.MaxUnavailable = s.maxUnavailable
+		if err := ctr.syncPodDisruptionBudget(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error: %v", s.description, err)
+		}
+		if applied := len(fakePDBControl.Templates) == 1; applied != s.applied {
+			t.Fatalf("%s: expected the budget applied %v, got %d", s.description, s.applied, len(fakePDBControl.Templates))
+		}
+		if !s.applied {
+			continue
+		}
+		observePodDisruptionBudgets(t, fakePDBControl, pdbIndexer)
+		pdb := fakePDBControl.Templates[0]
+		if pdb.Name != tfJob.Name || fakePDBControl.ControllerRefs[0].UID != tfJob.UID {
+			t.Errorf("%s: expected the budget %s owned by the tfjob, got %s owned by %v", s.description,
+				tfJob.Name, pdb.Name, fakePDBControl.ControllerRefs[0])
+		}
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			t.Fatalf("%s: unexpected error when parsing the selector: %v", s.description, err)
+		}
+		pod := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+		if !selector.Matches(labels.Set(pod.Labels)) {
+			t.Errorf("%s: expected the budget to select the pods of the tfjob, got %v", s.description, pdb.Spec.Selector)
+		}
+		if !equalIntOrString(pdb.Spec.MinAvailable, s.minAvailable) || !equalIntOrString(pdb.Spec.MaxUnavailable, s.maxUnavailable) {
+			t.Errorf("%s: expected minAvailable %v and maxUnavailable %v, got %v and %v", s.description,
+				s.minAvailable, s.maxUnavailable, pdb.Spec.MinAvailable, pdb.Spec.MaxUnavailable)
+		}
+	}
+
+	// The budget is deleted when the tfjob is terminated, until it is
+	// observed deleted.
+	now := metav1.Now()
+	tfJob.Status.CompletionTime = &now
+	tfJob.Status.Conditions = []common.JobCondition{newCondition(common.JobSucceeded, tfJobSucceededReason, "")}
+	if err := ctr.cleanupTFJob(tfJob); err != nil {
+		t.Fatalf("Unexpected error when cleaning up the tfjob: %v", err)
+	}
+	if len(fakePDBControl.DeletePodDisruptionBudgetName) != 1 || fakePDBControl.DeletePodDisruptionBudgetName[0] != tfJob.Name {
+		t.Errorf("Expected the budget to be deleted, got %v", fakePDBControl.DeletePodDisruptionBudgetName)
+	}
+	if err := pdbIndexer.Delete(&fakePDBControl.Templates[0]); err != nil {
+		t.Fatalf("Failed to delete the PodDisruptionBudget: %v", err)
+	}
+	fakePDBControl.Clear()
+	if err := ctr.cleanupTFJob(tfJob); err != nil {
+		t.Fatalf("Unexpected error when cleaning up the tfjob: %v", err)
+	}
+	if len(fakePDBControl.DeletePodDisruptionBudgetName) != 0 {
+		t.Errorf("Expected the deleted budget not to be deleted again, got %v", fakePDBControl.DeletePodDisruptionBudgetName)
+	}
+}
+
+func TestPodDisruptionBudgetOptIn(t *testing.T) {
+	type testCase struct {
+		description string
+		enabled     bool
+		annotation  string
+		expected    bool
+	}
+	testCases := []testCase{
+		{"No budget by default", false, "", false},
+		{"The annotation opts in", false, "true", true},
+		{"The option enables the budgets of all the tfjobs", true, "", true},
+	}
+	three := intstr.FromInt(3)
+	for _, c := range testCases {
+		ctr, fakePDBControl, _ := newPodDisruptionBudgetTestController()
+		ctr.enablePodDisruptionBudget = c.enabled
+		tfJob := testutil.NewTFJob(2, 1)
+		if c.annotation != "" {
+			tfJob.Annotations = map[string]string{tfv1.AnnotationPodDisruptionBudget: c.annotation}
+		}
+		if err := ctr.syncPodDisruptionBudget(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.description, err)
+		}
+		if actual := len(fakePDBControl.Templates) == 1; actual != c.expected {
+			t.Fatalf("%s: expected a budget %v, got %v", c.description, c.expected, fakePDBControl.Templates)
+		}
+		if c.expected && !equalIntOrString(fakePDBControl.Templates[0].Spec.MinAvailable, &three) {
+			t.Errorf("%s: expected the budget to protect all the replicas, got %v", c.description, fakePDBControl.Templates[0].Spec)
+		}
+	}
+}
+
+func equalIntOrString(a, b *intstr.IntOrString) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,180 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+const (
+	// podReplicaTypeIndex is the name of the pod informer index keyed by
+	// namespace/job-name/replica-type.
+	podReplicaTypeIndex = "tfReplicaType"
+	// invalidReplicaIndexReason is added in a tfjob when one of its pods has a
+	// missing or malformed replica index label.
+	invalidReplicaIndexReason = "InvalidReplicaIndex"
+)
+
+// podIndexers returns the indexers added to the pod informers.
+func podIndexers() cache.Indexers {
+	return cache.Indexers{podReplicaTypeIndex: indexPodByReplicaType}
+}
+
+// indexPodByReplicaType indexes the pods which have a job name label by
+// namespace, job name and replica type. Pods controlled by a tfjob are also
+// indexed under the name of the tfjob, so that it can release them when their
+// labels no longer match. Pods without a replica type label are indexed under
+// an empty replica type.
+func indexPodByReplicaType(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return nil, nil
+	}
+	rt := pod.Labels[tfReplicaTypeLabel]
+	var keys []string
+	jobName, ok := pod.Labels[jobcontroller.JobNameLabel]
+	if ok {
+		keys = append(keys, podReplicaTypeKey(pod.Namespace, jobName, rt))
+	}
+	if ref := metav1.GetControllerOf(pod); ref != nil && ref.Kind == tfv1.Kind && ref.Name != jobName {
+		keys = append(keys, podReplicaTypeKey(pod.Namespace, ref.Name, rt))
+	}
+	return keys, nil
+}
+
+func podReplicaTypeKey(namespace, jobName, rt string) string {
+	return namespace + "/" + jobName + "/" + rt
+}
+
+// podIndexerFor returns the pod indexer of the informer watching the namespace.
+func (tc *TFController) podIndexerFor(namespace string) cache.Indexer {
+	if indexer, ok := tc.podIndexers[namespace]; ok {
+		return indexer
+	}
+	return tc.podIndexer
+}
+
+// getPodsForTFJob returns the pods of the tfjob, and the pods of each of its
+// replica types keyed by the lower case replica type. Only the pods labeled
+// with the replica types of the spec, or without any replica type, are
+// retrieved from the index instead of listing the whole namespace, and
+// ControllerRef is reconciled on them by adopting/orphaning: orphans matching
+// the labels of the tfjob are adopted, pods it controls which no longer match
+// are kept and reported, see claimPods, and pods controlled by another UID,
+// such as those of a deleted tfjob with the same name, are ignored.
+// Note that the returned Pods are pointers into the cache.
+func (tc *TFController) getPodsForTFJob(tfjob *tfv1.TFJob) ([]*v1.Pod, map[string][]*v1.Pod, error) {
+	cm, err := tc.NewPodControllerRefManager(tfjob)
+	if err != nil {
+		return nil, nil, err
+	}
+	indexer := tc.podIndexerFor(tfjob.Namespace)
+	if indexer == nil {
+		// List all pods to include those that don't match the selector
+		// anymore but have a ControllerRef pointing to this controller.
+		candidates, err := tc.PodLister.Pods(tfjob.Namespace).List(labels.Everything())
+		if err != nil {
+			return nil, nil, err
+		}
+		pods, stranded, err := claimPods(cm, tfjob, candidates)
+		if err != nil {
+			return nil, nil, err
+		}
+		tc.recordStrandedPods(tfjob, tc.excludeLegacyPods(tfjob, stranded))
+		return pods, groupPodsByReplicaType(pods), nil
+	}
+
+	rts := []string{""}
+	for rtype := range tfjob.Spec.TFReplicaSpecs {
+		rts = append(rts, strings.ToLower(string(rtype)))
+	}
+	sort.Strings(rts)
+
+	var pods, stranded []*v1.Pod
+	podsByType := make(map[string][]*v1.Pod)
+	for _, rt := range rts {
+		objs, err := indexer.ByIndex(podReplicaTypeIndex, podReplicaTypeKey(tfjob.Namespace, tfjob.Name, rt))
+		if err != nil {
+			return nil, nil, err
+		}
+		candidates := make([]*v1.Pod, 0, len(objs))
+		for _, obj := range objs {
+			candidates = append(candidates, obj.(*v1.Pod))
+		}
+		claimed, strandedOfType, err := claimPods(cm, tfjob, candidates)
+		if err != nil {
+			return nil, nil, err
+		}
+		if rt != "" {
+			podsByType[rt] = claimed
+		}
+		pods = append(pods, claimed...)
+		stranded = append(stranded, strandedOfType...)
+	}
+	tc.recordStrandedPods(tfjob, tc.excludeLegacyPods(tfjob, stranded))
+	return pods, podsByType, nil
+}
+
+// groupPodsByReplicaType groups the pods by their lower case replica type.
+func groupPodsByReplicaType(pods []*v1.Pod) map[string][]*v1.Pod {
+	podsByType := make(map[string][]*v1.Pod)
+	for _, pod := range pods {
+		if rt, ok := pod.Labels[tfReplicaTypeLabel]; ok && rt != "" {
+			podsByType[rt] = append(podsByType[rt], pod)
+		}
+	}
+	return podsByType
+}
+
+// bucketPodsByIndex buckets the pods of a replica type by their replica index.
+// Pods with a missing or malformed index label are skipped and reported in a
+// warning event. Pods with an index out of range are bucketed as well, so that
+// they can be deleted.
+func (tc *TFController) bucketPodsByIndex(tfjob *tfv1.TFJob, pods []*v1.Pod, rt string, replicas int) map[int][]*v1.Pod {
+	logger := tflogger.LoggerForReplica(tfjob, rt)
+	podsByIndex := make(map[int][]*v1.Pod, replicas)
+	for _, pod := range pods {
+		value, ok := pod.Labels[tfReplicaIndexLabel]
+		if !ok {
+			logger.Warningf("Pod %s/%s does not have the index label.", pod.Namespace, pod.Name)
+			tc.Recorder.Eventf(tfjob, v1.EventTypeWarning, invalidReplicaIndexReason,
+				"Pod %s/%s does not have the %s label", pod.Namespace, pod.Name, tfReplicaIndexLabel)
+			continue
+		}
+		index, err := strconv.Atoi(value)
+		if err != nil {
+			logger.Warningf("Error when strconv.Atoi: %v", err)
+			tc.Recorder.Eventf(tfjob, v1.EventTypeWarning, invalidReplicaIndexReason,
+				"Pod %s/%s has a malformed %s label %q", pod.Namespace, pod.Name, tfReplicaIndexLabel, value)
+			continue
+		}
+		if index < 0 || index >= replicas {
+			logger.Warningf("The label index is not expected: %d", index)
+		}
+		podsByIndex[index] = append(podsByIndex[index], pod)
+	}
+	return podsByIndex
+}
@@ -0,0 +1,251 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+	"testing"
+
+	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubeclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/kubernetes/pkg/controller"
+
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
+	tfjobfake "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned/fake"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func newPodIndexTestController() (*TFController, *record.FakeRecorder) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, _, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, options.ServerOption{})
+	ctr.PodControl = &controller.FakePodControl{}
+	recorder := record.NewFakeRecorder(10)
+	ctr.Recorder = recorder
+	return ctr, recorder
+}
+
+func TestGetPodsForTFJob(t *testing.T) {
+	ctr, _ := newPodIndexTestController()
+	tfJob := testutil.NewTFJob(2, 1)
+	if ctr.podIndexerFor(tfJob.Namespace) == nil {
+		t.Fatalf("Expected the pod informer to be indexed")
+	}
+	other := testutil.NewTFJob(1, 0)
+	other.Name = "other"
+	other.UID = types.UID("other")
+
+	untyped := testutil.NewBasePod("untyped", tfJob, t)
+	otherWorker := testutil.NewPod(other, testutil.LabelWorker, 0, t)
+	otherWorker.Name = "other-worker-0"
+	pods := []*v1.Pod{
+		testutil.NewPod(tfJob, testutil.LabelWorker, 0, t),
+		testutil.NewPod(tfJob, testutil.LabelWorker, 1, t),
+		testutil.NewPod(tfJob, testutil.LabelPS, 0, t),
+		untyped,
+		otherWorker,
+	}
+	for _, pod := range pods {
+		if err := ctr.podIndexer.Add(pod); err != nil {
+			t.Fatalf("Unexpected error when adding pod %v", err)
+		}
+	}
+
+	all, podsByType, err := ctr.getPodsForTFJob(tfJob)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(all) != 4 {
+		t.Errorf("Expected the 4 pods of the tfjob, got %d", len(all))
+	}
+	if len(podsByType[testutil.LabelWorker]) != 2 {
+		t.Errorf("Expected 2 worker pods, got %v", podsByType[testutil.LabelWorker])
+	}
+	if len(podsByType[testutil.LabelPS]) != 1 {
+		t.Errorf("Expected 1 PS pod, got %v", podsByType[testutil.LabelPS])
+	}
+	for _, pod := range all {
+		if pod.Name == otherWorker.Name {
+			t.Errorf("Unexpected pod %s of another tfjob", pod.Name)
+		}
+	}
+}
+
+func TestGetPodsForRecreatedTFJob(t *testing.T) {
+	ctr, _ := newPodIndexTestController()
+	fakePodControl := ctr.PodControl.(*controller.FakePodControl)
+	defer ctr.WorkQueue.ShutDown()
+
+	// The pods of a deleted tfjob, which are still terminating.
+	deleted := testutil.NewTFJob(1, 0)
+	deleted.UID = types.UID("deleted")
+	oldPod := testutil.NewPod(deleted, testutil.LabelWorker, 0, t)
+	if err := ctr.podIndexer.Add(oldPod); err != nil {
+		t.Fatalf("Unexpected error when adding pod %v", err)
+	}
+
+	// The tfjob recreated with the same name.
+	tfJob := testutil.NewTFJob(1, 0)
+	tfJob.UID = types.UID("recreated")
+	unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Fatalf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+		t.Fatalf("Failed to add tfjob to tfJobIndexer: %v", err)
+	}
+
+	ctr.AddPod(oldPod)
+	if ctr.WorkQueue.Len() != 0 {
+		t.Errorf("Expected the pod of the deleted tfjob not to sync the recreated one")
+	}
+	all, podsByType, err := ctr.getPodsForTFJob(tfJob)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(all) != 0 || len(podsByType[testutil.LabelWorker]) != 0 {
+		t.Errorf("Expected the pods of the deleted tfjob to be ignored, got %v", all)
+	}
+	if len(fakePodControl.Patches) != 0 {
+		t.Errorf("Expected the pods of the deleted tfjob not to be patched, got %d patches", len(fakePodControl.Patches))
+	}
+}
+
+func TestAdoptPodsAndKeepStrandedPods(t *testing.T) {
+	ctr, _ := newPodIndexTestController()
+	fakePodControl := ctr.PodControl.(*controller.FakePodControl)
+	defer ctr.WorkQueue.ShutDown()
+
+	tfJob := testutil.NewTFJob(2, 0)
+	tfJob.UID = types.UID("tfjob")
+	unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Fatalf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+		t.Fatalf("Failed to add tfjob to tfJobIndexer: %v", err)
+	}
+	// Adoption rereads the tfjob from the API server.
+	ctr.tfJobClientSet = tfjobfake.NewSimpleClientset(tfJob)
+
+	// A pod created before the operator crashed, without its ControllerRef.
+	orphan := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+	orphan.OwnerReferences = nil
+	// A pod of the tfjob whose labels were changed.
+	relabeled := testutil.NewPod(tfJob, testutil.LabelWorker, 1, t)
+	relabeled.Labels[jobcontroller.JobNameLabel] = "other"
+	for _, pod := range []*v1.Pod{orphan, relabeled} {
+		if err := ctr.podIndexer.Add(pod); err != nil {
+			t.Fatalf("Unexpected error when adding pod %v", err)
+		}
+	}
+
+	ctr.AddPod(orphan)
+	if ctr.WorkQueue.Len() != 1 {
+		t.Errorf("Expected the orphan pod to sync the tfjob, got %d keys queued", ctr.WorkQueue.Len())
+	}
+
+	all, podsByType, err := ctr.getPodsForTFJob(tfJob)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(all) != 2 || len(podsByType[testutil.LabelWorker]) != 2 {
+		t.Errorf("Expected the orphan and the relabeled pods to be claimed, got %v", all)
+	}
+	// One patch adopts the orphan pod, the relabeled pod is not released.
+	releases := 0
+	for _, patch := range fakePodControl.Patches {
+		if strings.Contains(string(patch), `"$patch":"delete"`) {
+			releases++
+		}
+	}
+	if len(fakePodControl.Patches) != 1 || releases != 0 {
+		t.Errorf("Expected one adoption and no release, got %d patches with %d releases", len(fakePodControl.Patches), releases)
+	}
+}
+
+func TestBucketPodsByIndex(t *testing.T) {
+	ctr, recorder := newPodIndexTestController()
+	tfJob := testutil.NewTFJob(2, 0)
+
+	missing := testutil.NewBasePod("missing", tfJob, t)
+	malformed := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+	malformed.Name = "malformed"
+	malformed.Labels[tfReplicaIndexLabel] = "zero"
+	outOfRange := testutil.NewPod(tfJob, testutil.LabelWorker, 2, t)
+	pods := []*v1.Pod{
+		testutil.NewPod(tfJob, testutil.LabelWorker, 0, t),
+		testutil.NewPod(tfJob, testutil.LabelWorker, 1, t),
+		missing,
+		malformed,
+		outOfRange,
+	}
+
+	podsByIndex := ctr.bucketPodsByIndex(tfJob, pods, testutil.LabelWorker, 2)
+	if len(podsByIndex) != 3 || len(podsByIndex[0]) != 1 || len(podsByIndex[1]) != 1 {
+		t.Errorf("Expected one pod for each of the 2 indexes, got %v", podsByIndex)
+	}
+	// The pod out of range is kept to be deleted.
+	if len(podsByIndex[2]) != 1 || podsByIndex[2][0] != outOfRange {
+		t.Errorf("Expected the pod out of range at index 2, got %v", podsByIndex[2])
+	}
+
+	// Only the pods with a missing or malformed index label are reported.
+	for _, name := range []string{missing.Name, malformed.Name} {
+		select {
+		case event := <-recorder.Events:
+			if !strings.Contains(event, invalidReplicaIndexReason) || !strings.Contains(event, name) {
+				t.Errorf("Expected an %s event for pod %s, got %q", invalidReplicaIndexReason, name, event)
+			}
+		default:
+			t.Errorf("Expected an %s event for pod %s", invalidReplicaIndexReason, name)
+		}
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("Unexpected event %q", event)
+	default:
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/apis/tensorflow/validation"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+const (
+	// tfJobMissingReferenceReason is added in a tfjob when it fails because a
+	// PodTemplate it references does not exist.
+	tfJobMissingReferenceReason = "MissingReference"
+	// podTemplateChangedReason is the warning reason when the pods of a tfjob
+	// are not recreated because their PodTemplate changed.
+	podTemplateChangedReason = "PodTemplateChanged"
+	// missingPodTemplateRecheckInterval is the period the tfjobs waiting for
+	// a PodTemplate they reference to exist are synced again.
+	missingPodTemplateRecheckInterval = 5 * time.Second
+)
+
+// resolvePodTemplates replaces the templates of the replica types of the
+// tfjob which reference a PodTemplate with the template of the PodTemplate,
+// and records the hash of the PodTemplates resolved for the first time in the
+// status of the tfjob. It returns the replica types whose PodTemplate
+// changed since then, and a message if a PodTemplate does not exist.
+func (tc *TFController) resolvePodTemplates(tfjob *tfv1.TFJob) (sets.String, string, error) {
+	changed := sets.NewString()
+	if len(tfjob.Spec.TemplateRefs) == 0 {
+		return changed, "", nil
+	}
+	rtypes := make([]tfv1.TFReplicaType, 0, len(tfjob.Spec.TemplateRefs))
+	for rtype := range tfjob.Spec.TemplateRefs {
+		rtypes = append(rtypes, rtype)
+	}
+	sort.Slice(rtypes, func(i, j int) bool { return rtypes[i] < rtypes[j] })
+
+	for _, rtype := range rtypes {
+		spec, ok := tfjob.Spec.TFReplicaSpecs[rtype]
+		if !ok || spec == nil {
+			continue
+		}
+		ref := tfjob.Spec.TemplateRefs[rtype]
+		podTemplate, err := tc.podTemplateLister.PodTemplates(tfjob.Namespace).Get(ref.Name)
+		if errors.IsNotFound(err) {
+			return changed, fmt.Sprintf("TFJob %s has failed because the PodTemplate %s referenced by %s does not exist.",
+				tfjob.Name, ref.Name, rtype), nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		hash, err := computePodTemplateHash(&podTemplate.Template)
+		if err != nil {
+			return nil, "", err
+		}
+		if recorded, ok := tfjob.Status.PodTemplateHashes[rtype]; !ok {
+			if tfjob.Status.PodTemplateHashes == nil {
+				tfjob.Status.PodTemplateHashes = make(map[tfv1.TFReplicaType]string)
+			}
+			tfjob.Status.PodTemplateHashes[rtype] = hash
+		} else if recorded != hash {
+			changed.Insert(string(rtype))
+		}
+		spec.Template = *podTemplate.Template.DeepCopy()
+	}
+	// Set the defaults of the resolved templates.
+	scheme.Scheme.Default(tfjob)
+	return changed, "", nil
+}
+
+// invalidPodTemplateRefs returns a message if the resolved template of a
+// replica type referencing a PodTemplate is invalid, or an empty string
+// otherwise.
+func invalidPodTemplateRefs(tfjob *tfv1.TFJob) string {
+	rtypes := make([]string, 0, len(tfjob.Spec.TemplateRefs))
+	for rtype := range tfjob.Spec.TemplateRefs {
+		rtypes = append(rtypes, string(rtype))
+	}
+	sort.Strings(rtypes)
+	for _, rt := range rtypes {
+		rtype := tfv1.TFReplicaType(rt)
+		spec, ok := tfjob.Spec.TFReplicaSpecs[rtype]
+		if !ok || spec == nil {
+			continue
+		}
+		if err := validation.ValidateV1PodTemplate(rtype, &spec.Template); err != nil {
+			return fmt.Sprintf("TFJob %s is invalid: the PodTemplate %s referenced by %s is invalid: %v",
+				tfjob.Name, tfjob.Spec.TemplateRefs[rtype].Name, rtype, err)
+		}
+	}
+	return ""
+}
+
+// computePodTemplateHash returns the hash of the pod template.
+func computePodTemplateHash(template *v1.PodTemplateSpec) (string, error) {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+	hasher := fnv.New32a()
+	hasher.Write(data)
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32())), nil
+}
+
+// setChangedPodTemplates records the replica types of the tfjob whose
+// PodTemplate changed, as last resolved. The wait for a missing PodTemplate is
+// over once none is missing.
+func (tc *TFController) setChangedPodTemplates(key string, changed sets.String, missing bool) {
+	tc.podTemplateLock.Lock()
+	defer tc.podTemplateLock.Unlock()
+	if !missing {
+		delete(tc.missingPodTemplates, key)
+	}
+	if changed.Len() == 0 {
+		delete(tc.changedPodTemplates, key)
+		return
+	}
+	tc.changedPodTemplates[key] = changed
+}
+
+// isPodTemplateChanged returns true if the PodTemplate referenced by the
+// replica type of the tfjob changed since it was first resolved, in which
+// case its missing pods must not be created.
+func (tc *TFController) isPodTemplateChanged(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType) bool {
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return false
+	}
+	tc.podTemplateLock.Lock()
+	defer tc.podTemplateLock.Unlock()
+	return tc.changedPodTemplates[key].Has(string(rtype))
+}
+
+// waitForMissingPodTemplate returns true if the tfjob, one of whose
+// PodTemplates does not exist, is still within missingPodTemplateTimeout of
+// first missing it, in which case it waits for the PodTemplate rather than
+// fails.
+func (tc *TFController) waitForMissingPodTemplate(tfjob *tfv1.TFJob, key string) bool {
+	tc.podTemplateLock.Lock()
+	defer tc.podTemplateLock.Unlock()
+	since, ok := tc.missingPodTemplates[key]
+	if !ok {
+		since = tc.clock.Now()
+		tc.missingPodTemplates[key] = since
+	}
+	if tc.clock.Since(since) >= tc.missingPodTemplateTimeout {
+		return false
+	}
+	tflogger.LoggerForJob(tfjob).Infof("Waiting up to %v for the PodTemplates referenced by TFJob %s to exist",
+		tc.missingPodTemplateTimeout, tfjob.Name)
+	return true
+}
+
+// forgetChangedPodTemplates forgets the changed and missing PodTemplates of
+// the tfjob.
+func (tc *TFController) forgetChangedPodTemplates(key string) {
+	tc.podTemplateLock.Lock()
+	defer tc.podTemplateLock.Unlock()
+	delete(tc.changedPodTemplates, key)
+	delete(tc.missingPodTemplates, key)
+}
@@ -0,0 +1,196 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes/scheme"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func newPodTemplate(name, image string) *v1.PodTemplate {
+	return &v1.PodTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault},
+		Template: v1.PodTemplateSpec{
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{{Name: tfv1.DefaultContainerName, Image: image}},
+			},
+		},
+	}
+}
+
+// newTFJobWithTemplateRef returns a tfjob whose workers reference the
+// PodTemplate of the given name.
+func newTFJobWithTemplateRef(worker, ps int, name string) *tfv1.TFJob {
+	tfJob := testutil.NewTFJob(worker, ps)
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template = v1.PodTemplateSpec{}
+	tfJob.Spec.TemplateRefs = map[tfv1.TFReplicaType]tfv1.PodTemplateRef{
+		tfv1.TFReplicaTypeWorker: {Name: name},
+	}
+	scheme.Scheme.Default(tfJob)
+	return tfJob
+}
+
+// countPodsWithImage returns the number of pods of the replica type created
+// with the given image.
+func countPodsWithImage(templates []v1.PodTemplateSpec, rt, image string) int {
+	count := 0
+	for _, template := range templates {
+		container := findContainer(template.Spec.Containers, tfv1.DefaultContainerName)
+		if template.Labels[tfReplicaTypeLabel] == rt && container != nil && container.Image == image {
+			count++
+		}
+	}
+	return count
+}
+
+func TestResolvePodTemplates(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	recorder := record.NewFakeRecorder(10)
+	ctr.Recorder = recorder
+	podTemplateIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	ctr.podTemplateLister = corelisters.NewPodTemplateLister(podTemplateIndexer)
+	var actual *tfv1.TFJob
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		actual = tfJob
+		return nil
+	}
+	if err := podTemplateIndexer.Add(newPodTemplate("trainer", "trainer:1.0")); err != nil {
+		t.Fatalf("Unexpected error when adding the PodTemplate: %v", err)
+	}
+
+	// The workers are created from the PodTemplate, whose hash is recorded.
+	tfJob := newTFJobWithTemplateRef(2, 1, "trainer")
+	if err := ctr.reconcileTFJobs(tfJob.DeepCopy()); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if actual == nil || actual.Status.PodTemplateHashes[tfv1.TFReplicaTypeWorker] == "" {
+		t.Fatalf("Expected the hash of the PodTemplate to be recorded in the tfjob status")
+	}
+	if count := countPodsWithImage(fakePodControl.Templates, testutil.LabelWorker, "trainer:1.0"); count != 2 {
+		t.Errorf("Expected 2 worker pods created from the PodTemplate, got %d", count)
+	}
+	for _, template := range fakePodControl.Templates {
+		if container := findContainer(template.Spec.Containers, tfv1.DefaultContainerName); len(container.Ports) != 1 {
+			t.Errorf("Expected the default port in the pods created from the PodTemplate, got %v", container.Ports)
+		}
+	}
+	tfJob.Annotations = actual.Annotations
+	tfJob.Status.PodTemplateHashes = actual.Status.PodTemplateHashes
+
+	type step struct {
+		description string
+		image       string
+		workerPods  int
+		events      int
+	}
+	steps := []step{
+		{"The workers are not recreated from the changed PodTemplate", "trainer:2.0", 0, 1},
+		{"The workers are recreated once the PodTemplate is restored", "trainer:1.0", 2, 0},
+	}
+	for _, s := range steps {
+		if err := podTemplateIndexer.Update(newPodTemplate("trainer", s.image)); err != nil {
+			t.Fatalf("%s: unexpected error when updating the PodTemplate: %v", s.description, err)
+		}
+		fakePodControl.Clear()
+		if err := ctr.reconcileTFJobs(tfJob.DeepCopy()); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", s.description, err)
+		}
+		if count := countPodsWithImage(fakePodControl.Templates, testutil.LabelWorker, "trainer:1.0"); count != s.workerPods {
+			t.Errorf("%s: expected %d worker pods, got %d", s.description, s.workerPods, count)
+		}
+		if count := countPodsWithImage(fakePodControl.Templates, testutil.LabelWorker, "trainer:2.0"); count != 0 {
+			t.Errorf("%s: expected no worker pod created from the changed PodTemplate, got %d", s.description, count)
+		}
+		if count := countPodsWithImage(fakePodControl.Templates, testutil.LabelPS, testutil.TestImageName); count != 1 {
+			t.Errorf("%s: expected the PS pod to be created from its inline template, got %d", s.description, count)
+		}
+		if events := countEvents(recorder, podTemplateChangedReason); events != s.events {
+			t.Errorf("%s: expected %d events, got %d", s.description, s.events, events)
+		}
+	}
+
+	// A tfjob referencing a missing PodTemplate waits for it, then fails
+	// without creating pods.
+	fakeClock := clock.NewFakeClock(time.Now())
+	ctr.clock = fakeClock
+	ctr.missingPodTemplateTimeout = time.Minute
+	fakePodControl.Clear()
+	missing := newTFJobWithTemplateRef(2, 1, "missing")
+	for _, waited := range []time.Duration{0, 30 * time.Second, 30 * time.Second} {
+		fakeClock.Step(waited)
+		actual = nil
+		if err := ctr.reconcileTFJobs(missing.DeepCopy()); err != nil {
+			t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+		}
+		if len(fakePodControl.Templates) != 0 {
+			t.Errorf("Expected no pod creation, got %d", len(fakePodControl.Templates))
+		}
+	}
+	if actual == nil || !testutil.CheckCondition(actual, common.JobFailed, tfJobMissingReferenceReason) {
+		t.Errorf("Expected the TFJob to fail with a missing reference once the timeout elapsed")
+	}
+}
+
+func TestWaitForMissingPodTemplate(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	fakeClock := clock.NewFakeClock(time.Now())
+	ctr.clock = fakeClock
+	ctr.missingPodTemplateTimeout = time.Minute
+	podTemplateIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	ctr.podTemplateLister = corelisters.NewPodTemplateLister(podTemplateIndexer)
+	var actual *tfv1.TFJob
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		actual = tfJob
+		return nil
+	}
+
+	// The PodTemplate is created right after the tfjob.
+	tfJob := newTFJobWithTemplateRef(2, 1, "trainer")
+	if err := ctr.reconcileTFJobs(tfJob.DeepCopy()); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if actual != nil && testutil.CheckCondition(actual, common.JobFailed, tfJobMissingReferenceReason) {
+		t.Errorf("Expected the TFJob to wait for its PodTemplate rather than fail")
+	}
+	if len(fakePodControl.Templates) != 0 {
+		t.Errorf("Expected no pod creation while the PodTemplate is missing, got %d", len(fakePodControl.Templates))
+	}
+	if err := podTemplateIndexer.Add(newPodTemplate("trainer", "trainer:1.0")); err != nil {
+		t.Fatalf("Unexpected error when adding the PodTemplate: %v", err)
+	}
+	fakeClock.Step(30 * time.Second)
+	if err := ctr.reconcileTFJobs(tfJob.DeepCopy()); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if count := countPodsWithImage(fakePodControl.Templates, testutil.LabelWorker, "trainer:1.0"); count != 2 {
+		t.Errorf("Expected 2 worker pods created from the PodTemplate, got %d", count)
+	}
+	key, _ := KeyFunc(tfJob)
+	if _, ok := ctr.missingPodTemplates[key]; ok {
+		t.Errorf("Expected the wait for the PodTemplate to be over")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+// recordDefaultPort records the default port of the tfjob in its annotations
+// if it has none yet, so that the pods and services recreated later keep the
+// port of the running ones when the default of the operator changes. The
+// tfjobs which already started before the default port was recorded get the
+// built-in default, which is the one their pods were created with.
+func (tc *TFController) recordDefaultPort(tfjob *tfv1.TFJob) {
+	if hasDefaultPort(tfjob) {
+		return
+	}
+	name, port := tc.defaultPortName, tc.defaultPort
+	if tfjob.Status.StartTime != nil {
+		name, port = tfv1.DefaultPortName, tfv1.DefaultPort
+	}
+	if tfjob.Annotations == nil {
+		tfjob.Annotations = make(map[string]string)
+	}
+	tfjob.Annotations[tfv1.AnnotationDefaultPortName] = name
+	tfjob.Annotations[tfv1.AnnotationDefaultPort] = strconv.Itoa(int(port))
+}
+
+// hasDefaultPort returns true if the default port of the tfjob is recorded.
+func hasDefaultPort(tfjob *tfv1.TFJob) bool {
+	_, hasName := tfjob.Annotations[tfv1.AnnotationDefaultPortName]
+	_, hasPort := tfjob.Annotations[tfv1.AnnotationDefaultPort]
+	return hasName && hasPort
+}
+
+// recordedAnnotations returns the annotations recorded in the tfjob by the
+// operator, i.e. its default port and its coordinator.
+func recordedAnnotations(tfjob *tfv1.TFJob) map[string]string {
+	recorded := make(map[string]string)
+	for key, value := range tfjob.Annotations {
+		if key == tfv1.AnnotationDefaultPortName || key == tfv1.AnnotationDefaultPort || key == tfv1.AnnotationCoordinator {
+			recorded[key] = value
+		}
+	}
+	return recorded
+}
+
+// persistRecordedAnnotations patches the annotations recorded in the tfjob
+// into the stored tfjob if they are not there yet or changed. It is called
+// before the status of the tfjob is updated, so that they are stored before
+// the tfjob is seen as started.
+func (tc *TFController) persistRecordedAnnotations(tfjob *tfv1.TFJob) error {
+	recorded := recordedAnnotations(tfjob)
+	if len(recorded) == 0 {
+		return nil
+	}
+	sharedTFJob, err := tc.getTFJobFromName(tfjob.Namespace, tfjob.Name)
+	if err != nil {
+		// A tfjob which is gone is reported by the status update.
+		return nil
+	}
+	for key, value := range recorded {
+		if stored, ok := sharedTFJob.Annotations[key]; ok && stored == value {
+			delete(recorded, key)
+		}
+	}
+	if len(recorded) == 0 {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": recorded,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	patched, err := tc.tfJobClientSet.KubeflowV1().TFJobs(tfjob.Namespace).Patch(tfjob.Name, types.MergePatchType, patch)
+	if err != nil {
+		return fmt.Errorf("unable to record the annotations of tfjob %s: %v", tfjob.Name, err)
+	}
+	tflogger.LoggerForJob(tfjob).Infof("Recorded the annotations %v", recorded)
+	tfjob.ResourceVersion = patched.ResourceVersion
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tfjobfake "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned/fake"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+// newTFJobWithoutPorts returns a tfjob whose tensorflow containers do not
+// declare their port, so that they get the default port.
+func newTFJobWithoutPorts(worker, ps int) *tfv1.TFJob {
+	tfJob := testutil.NewTFJob(worker, ps)
+	for _, spec := range tfJob.Spec.TFReplicaSpecs {
+		spec.Template.Spec.Containers[0].Ports = nil
+	}
+	return tfJob
+}
+
+func TestRecordDefaultPort(t *testing.T) {
+	type testCase struct {
+		description  string
+		tfJob        *tfv1.TFJob
+		expectedName string
+		expectedPort int32
+	}
+	started := newTFJobWithoutPorts(1, 1)
+	now := metav1.Now()
+	started.Status.StartTime = &now
+	recorded := newTFJobWithoutPorts(1, 1)
+	recorded.Annotations = map[string]string{
+		tfv1.AnnotationDefaultPortName: "legacy-port",
+		tfv1.AnnotationDefaultPort:     "4444",
+	}
+	testCases := []testCase{
+		{"A new tfjob gets the default port of the operator", newTFJobWithoutPorts(1, 1), "grpc", 3333},
+		{"A tfjob started before the default port was recorded keeps the built-in one", started, tfv1.DefaultPortName, tfv1.DefaultPort},
+		{"A tfjob keeps its recorded default port", recorded, "legacy-port", 4444},
+	}
+	for _, c := range testCases {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		// The default port of the operator was changed.
+		ctr.defaultPortName = "grpc"
+		ctr.defaultPort = 3333
+
+		tfJob := c.tfJob.DeepCopy()
+		ctr.recordDefaultPort(tfJob)
+		scheme.Scheme.Default(tfJob)
+
+		if err := ctr.createNewPod(tfJob, testutil.LabelWorker, "0", tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker], false); err != nil {
+			t.Fatalf("%s: unexpected error when creating the pod: %v", c.description, err)
+		}
+		container := findContainer(fakePodControl.Templates[0].Spec.Containers, tfv1.DefaultContainerName)
+		if len(container.Ports) != 1 || container.Ports[0].Name != c.expectedName || container.Ports[0].ContainerPort != c.expectedPort {
+			t.Errorf("%s: expected the port %s:%d, got %v", c.description, c.expectedName, c.expectedPort, container.Ports)
+		}
+		if port, err := GetPortFromTFJob(tfJob, tfv1.TFReplicaTypePS); err != nil || port != c.expectedPort {
+			t.Errorf("%s: expected the cluster spec port %d, got %d, %v", c.description, c.expectedPort, port, err)
+		}
+		service := ctr.newService(tfJob, tfv1.TFReplicaTypePS, "0")
+		if port := clusterServicePort(tfJob, service.Spec.Ports); port.Name != c.expectedName || port.Port != c.expectedPort {
+			t.Errorf("%s: expected the service port %s:%d, got %v", c.description, c.expectedName, c.expectedPort, port)
+		}
+	}
+}
+
+func TestPersistDefaultPort(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	tfJob := newTFJobWithoutPorts(1, 0)
+	unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Fatalf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+		t.Fatalf("Failed to add tfjob to tfJobIndexer: %v", err)
+	}
+	tfJobClientSet := tfjobfake.NewSimpleClientset(tfJob)
+	ctr.tfJobClientSet = tfJobClientSet
+
+	tfJob = tfJob.DeepCopy()
+	ctr.recordDefaultPort(tfJob)
+	if err := ctr.updateTFJobStatus(tfJob); err != nil {
+		t.Fatalf("Unexpected error when updating the status: %v", err)
+	}
+	stored, err := tfJobClientSet.KubeflowV1().TFJobs(tfJob.Namespace).Get(tfJob.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error when getting the tfjob: %v", err)
+	}
+	if name, port := tfv1.GetDefaultPort(stored); name != tfv1.DefaultPortName || port != tfv1.DefaultPort || !hasDefaultPort(stored) {
+		t.Errorf("Expected the default port to be stored in the tfjob, got %v", stored.Annotations)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	v1 "k8s.io/api/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+// podPreemptedReason is the warning reason when a pod evicted or preempted by
+// the cluster is recreated.
+const podPreemptedReason = "PodPreempted"
+
+// preemptionReasons are the reasons the kubelet, the scheduler and the
+// vertical pod autoscaler fail a pod with when they take its resources back.
+var preemptionReasons = map[string]bool{
+	"Evicted":      true,
+	"Preempting":   true,
+	"Preempted":    true,
+	"DeletedByVPA": true,
+}
+
+// preemptionReason returns the reason the cluster evicted or preempted the
+// failed pod, read from its status or the state of its tensorflow container,
+// or "" if the pod did not fail because of a preemption.
+func preemptionReason(pod *v1.Pod) string {
+	if pod.Status.Phase != v1.PodFailed {
+		return ""
+	}
+	if preemptionReasons[pod.Status.Reason] {
+		return pod.Status.Reason
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == tfv1.DefaultContainerName && status.State.Terminated != nil &&
+			preemptionReasons[status.State.Terminated.Reason] {
+			return status.State.Terminated.Reason
+		}
+	}
+	return ""
+}
+
+// excludePreemptedPods returns the pods which were not preempted, unless the
+// preemptions are not exempted from the backoff limit.
+func (tc *TFController) excludePreemptedPods(pods []*v1.Pod) []*v1.Pod {
+	if !tc.exemptPreemptions {
+		return pods
+	}
+	var kept []*v1.Pod
+	for _, pod := range pods {
+		if preemptionReason(pod) == "" {
+			kept = append(kept, pod)
+		}
+	}
+	return kept
+}
+
+// recreatePreemptedPod deletes the preempted pod of the replica for it to be
+// recreated. Unlike a failure, it is neither counted in the replica status
+// nor in the restarts of the tfjob, so that the preemptions of low priority
+// pods do not exhaust its backoff limit or fail it.
+func (tc *TFController) recreatePreemptedPod(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType, index int, pod *v1.Pod, reason string) error {
+	tflogger.LoggerForPod(pod, tfv1.Kind).Infof("Recreating pod %s/%s which was preempted: %s", pod.Namespace, pod.Name, reason)
+	tc.recordReplicaEvent(tfjob, v1.EventTypeWarning, podPreemptedReason, pod.Name,
+		"Recreating pod %s/%s of %s replica %d which was preempted on node %q: %s",
+		pod.Namespace, pod.Name, rtype, index, pod.Spec.NodeName, reason)
+	return tc.deletePod(tfjob, pod)
+}
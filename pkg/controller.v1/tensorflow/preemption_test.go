@@ -0,0 +1,94 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func TestRecreatePreemptedPods(t *testing.T) {
+	type testCase struct {
+		description     string
+		exempt          bool
+		podReason       string
+		containerReason string
+		expectedDeleted bool
+		expectedFailed  int32
+	}
+	testCases := []testCase{
+		{"The evicted pod is recreated", true, "Evicted", "", true, 0},
+		{"The pod whose container was preempted is recreated", true, "", "Preempted", true, 0},
+		{"The failed pod is counted", true, "", "Error", false, 1},
+		{"The evicted pod is counted without the exemption", false, "Evicted", "", false, 1},
+	}
+	for _, c := range testCases {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		ctr.exemptPreemptions = c.exempt
+		tfJob := testutil.NewTFJob(1, 0)
+		spec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker]
+		spec.RestartPolicy = common.RestartPolicyNever
+
+		pod := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+		pod.Status.Phase = v1.PodFailed
+		pod.Status.Reason = c.podReason
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+			Name: tfv1.DefaultContainerName,
+			State: v1.ContainerState{
+				Terminated: &v1.ContainerStateTerminated{ExitCode: 137, Reason: c.containerReason},
+			},
+		}}
+		if err := ctr.reconcileReplicaTypes(tfJob, map[string][]*v1.Pod{testutil.LabelWorker: {pod}}, nil); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling pods: %v", c.description, err)
+		}
+		if deleted := len(fakePodControl.DeletePodName) == 1; deleted != c.expectedDeleted {
+			t.Errorf("%s: expected the pod deleted %v, got %v", c.description, c.expectedDeleted, fakePodControl.DeletePodName)
+		}
+		status := tfJob.Status.ReplicaStatuses[common.ReplicaType(tfv1.TFReplicaTypeWorker)]
+		if status.Failed != c.expectedFailed {
+			t.Errorf("%s: expected %d failed replicas, got %d", c.description, c.expectedFailed, status.Failed)
+		}
+		if restarts := tfJob.Status.ReplicaRestarts[tfv1.TFReplicaTypeWorker]; restarts != 0 {
+			t.Errorf("%s: expected no restarts recorded, got %d", c.description, restarts)
+		}
+		if failed := testutil.CheckCondition(tfJob, common.JobFailed, tfJobFailedReason); failed == c.expectedDeleted {
+			t.Errorf("%s: expected the tfjob failed %v, got %v", c.description, !c.expectedDeleted, tfJob.Status.Conditions)
+		}
+	}
+}
+
+func TestExcludePreemptedPods(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	tfJob := testutil.NewTFJob(2, 0)
+	evicted := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+	evicted.Status.Phase = v1.PodFailed
+	evicted.Status.Reason = "Evicted"
+	failed := testutil.NewPod(tfJob, testutil.LabelWorker, 1, t)
+	failed.Status.Phase = v1.PodFailed
+	pods := []*v1.Pod{evicted, failed}
+
+	if kept := ctr.excludePreemptedPods(pods); len(kept) != 2 {
+		t.Errorf("Expected the preemptions to be counted without the exemption, got %d pods", len(kept))
+	}
+	ctr.exemptPreemptions = true
+	if kept := ctr.excludePreemptedPods(pods); len(kept) != 1 || kept[0] != failed {
+		t.Errorf("Expected only the failed pod to be counted, got %d pods", len(kept))
+	}
+}
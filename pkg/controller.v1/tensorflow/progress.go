@@ -0,0 +1,60 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"math"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// trainingProgress aggregates the progress the Worker pods report in the
+// progress annotation. The pods without it, or with a value which is not a
+// fraction between 0 and 1, are ignored. It returns nil if no pod reports its
+// progress.
+func (tc *TFController) trainingProgress(pods []*v1.Pod) *tfv1.TrainingProgress {
+	min, sum := 1.0, 0.0
+	reporting := 0
+	for _, pod := range pods {
+		value, ok := pod.Annotations[tc.progressAnnotation]
+		if !ok {
+			continue
+		}
+		progress, err := strconv.ParseFloat(value, 64)
+		if err != nil || progress < 0 || progress > 1 {
+			continue
+		}
+		min = math.Min(min, progress)
+		sum += progress
+		reporting++
+	}
+	if reporting == 0 {
+		return nil
+	}
+	return &tfv1.TrainingProgress{
+		Min:              formatProgress(min),
+		Average:          formatProgress(sum / float64(reporting)),
+		ReportingWorkers: int32(reporting),
+	}
+}
+
+// formatProgress formats the progress with up to 4 decimals, so that the
+// status does not change with insignificant digits.
+func formatProgress(progress float64) string {
+	return strconv.FormatFloat(math.Round(progress*1e4)/1e4, 'f', -1, 64)
+}
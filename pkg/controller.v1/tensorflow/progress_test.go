@@ -0,0 +1,80 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func TestTrainingProgress(t *testing.T) {
+	testCases := []struct {
+		description string
+		// progress is the annotation of each worker, empty if it has none.
+		progress []string
+		expected *tfv1.TrainingProgress
+	}{
+		{"No worker reports its progress", []string{"", ""}, nil},
+		{"The workers report their progress", []string{"0.5", "0.25", "1"},
+			&tfv1.TrainingProgress{Min: "0.25", Average: "0.5833", ReportingWorkers: 3}},
+		{"The invalid progress is ignored", []string{"0.4", "", "done", "1.5"},
+			&tfv1.TrainingProgress{Min: "0.4", Average: "0.4", ReportingWorkers: 1}},
+	}
+
+	for _, tc := range testCases {
+		ctr, _, _ := newErrorsTestController()
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			return nil
+		}
+		tfJob := testutil.NewTFJob(len(tc.progress), 0)
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			t.Fatalf("Failed to convert the TFJob to Unstructured: %v", err)
+		}
+		if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+			t.Fatalf("Failed to add tfjob to tfJobIndexer: %v", err)
+		}
+		pods := testutil.NewPodList(int32(len(tc.progress)), v1.PodRunning, tfJob, testutil.LabelWorker, 0, t)
+		for i, pod := range pods {
+			if tc.progress[i] != "" {
+				pod.Annotations = map[string]string{tfv1.AnnotationProgress: tc.progress[i]}
+			}
+			if err := ctr.podIndexer.Add(pod); err != nil {
+				t.Fatalf("%s: failed to add pod to podIndexer: %v", tc.description, err)
+			}
+		}
+
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", tc.description, err)
+		}
+		if !reflect.DeepEqual(tfJob.Status.TrainingProgress, tc.expected) {
+			t.Errorf("%s: expected the training progress %+v, got %+v", tc.description, tc.expected, tfJob.Status.TrainingProgress)
+		}
+	}
+}
+
+func TestTrainingProgressIsCounterOnlyUpdate(t *testing.T) {
+	tfJob := newRunningTFJob()
+	oldStatus := tfJob.Status.DeepCopy()
+	tfJob.Status.TrainingProgress = &tfv1.TrainingProgress{Min: "0.1", Average: "0.2", ReportingWorkers: 1}
+	if !isCounterOnlyUpdate(oldStatus, &tfJob.Status) {
+		t.Errorf("Expected a change of the training progress alone to be a counter-only update")
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"strings"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// tfJobPSFailedReason is added in a tfjob when it fails because a PS pod
+// failed with a non-retryable exit code.
+const tfJobPSFailedReason = "PSFailed"
+
+// failOnPSFailure fails the tfjob if some of its PS pods failed with a
+// non-retryable exit code, since the workers cannot make progress without
+// them. The failed PS pods are described by failedPS.
+func (tc *TFController) failOnPSFailure(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType, failedPS []string) error {
+	if rtype != tfv1.TFReplicaTypePS || len(failedPS) == 0 || ignoresFailures(tfjob, rtype) || isFailed(tfjob.Status.JobStatus) {
+		return nil
+	}
+	msg := fmt.Sprintf("TFJob %s has failed because the PS replica(s) %s failed with a non-retryable exit code.",
+		tfjob.Name, strings.Join(failedPS, ", "))
+	return tc.failWithReason(tfjob, tfJobPSFailedReason, msg)
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/tools/record"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func TestPSFailure(t *testing.T) {
+	type testCase struct {
+		description     string
+		policy          string
+		restartPolicy   common.RestartPolicy
+		exitCode        int32
+		expectedFailed  bool
+		expectedDeleted int
+	}
+	testCases := []testCase{
+		{"A PS failing fails the tfjob", options.PSFailurePolicyFail, common.RestartPolicyNever, 1, true, 0},
+		{"A PS failing with a non-retryable exit code fails the tfjob", "", common.RestartPolicyExitCode, 1, true, 0},
+		{"A PS failing with a retryable exit code is restarted", options.PSFailurePolicyFail, common.RestartPolicyExitCode, 130, false, 1},
+		{"A PS failing is restarted with the restart policy", options.PSFailurePolicyRestart, common.RestartPolicyNever, 1, false, 1},
+	}
+	for _, c := range testCases {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		ctr.psFailurePolicy = c.policy
+		podIndexer := ctr.podIndexer
+		var actual *tfv1.TFJob
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			actual = tfJob
+			return nil
+		}
+
+		tfJob := testutil.NewTFJob(1, 2)
+		tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypePS].RestartPolicy = c.restartPolicy
+		testutil.SetPodsStatuses(podIndexer, tfJob, testutil.LabelWorker, 0, 1, 0, 0, nil, t)
+		testutil.SetPodsStatuses(podIndexer, tfJob, testutil.LabelPS, 0, 1, 0, 0, nil, t)
+		pod := testutil.NewPod(tfJob, testutil.LabelPS, 1, t)
+		pod.Status.Phase = v1.PodFailed
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+			Name: tfv1.DefaultContainerName,
+			State: v1.ContainerState{
+				Terminated: &v1.ContainerStateTerminated{ExitCode: c.exitCode},
+			},
+		}}
+		if err := podIndexer.Add(pod); err != nil {
+			t.Fatalf("%s: unexpected error when adding the pod: %v", c.description, err)
+		}
+
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", c.description, err)
+		}
+		if actual == nil {
+			t.Fatalf("%s: expected the status to be updated", c.description)
+		}
+		if failed := testutil.CheckCondition(actual, common.JobFailed, tfJobPSFailedReason); failed != c.expectedFailed {
+			t.Errorf("%s: expected the tfjob failed %v, got %v", c.description, c.expectedFailed, actual.Status.Conditions)
+		}
+		if c.expectedFailed && !strings.Contains(actual.Status.Conditions[len(actual.Status.Conditions)-1].Message, "1 (pod "+pod.Name) {
+			t.Errorf("%s: expected the condition to name the PS index, got %v", c.description, actual.Status.Conditions)
+		}
+		if deleted := len(fakePodControl.DeletePodName); deleted != c.expectedDeleted {
+			t.Errorf("%s: expected %d deleted pods, got %d", c.description, c.expectedDeleted, deleted)
+		}
+	}
+}
+
+func TestPSGPURequestWarning(t *testing.T) {
+	testCases := []struct {
+		description     string
+		resources       v1.ResourceList
+		expectedWarning bool
+	}{
+		{"The default GPUs fanned out to the PS are warned about", v1.ResourceList{tfv1.ResourceGPU: resource.MustParse("1")}, true},
+		{"The default CPUs are not warned about", v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}, false},
+	}
+	for _, c := range testCases {
+		ctr, _, _ := newErrorsTestController()
+		recorder := record.NewFakeRecorder(10)
+		ctr.Recorder = recorder
+		tfJob := testutil.NewTFJob(1, 1)
+		tfJob.Spec.DefaultResources = &v1.ResourceRequirements{Limits: c.resources}
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			t.Fatalf("%s: failed to convert the TFJob to Unstructured: %v", c.description, err)
+		}
+		ctr.addTFJob(unstructured)
+		warned := false
+		for len(recorder.Events) > 0 {
+			if event := <-recorder.Events; strings.Contains(event, psGPURequestReason) {
+				warned = true
+			}
+		}
+		if warned != c.expectedWarning {
+			t.Errorf("%s: expected a %s event %v, got %v", c.description, psGPURequestReason, c.expectedWarning, warned)
+		}
+		ctr.WorkQueue.ShutDown()
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
+)
+
+const (
+	// psWaitInitContainerName is the name of the init container waiting for
+	// the PS of a tfjob.
+	psWaitInitContainerName = "tf-operator-wait-ps"
+	// psWaitHostsEnv is the env of the init container holding the PS
+	// endpoints of TF_CONFIG, separated by commas.
+	psWaitHostsEnv = "PS_HOSTS"
+	// psWaitScript waits until each endpoint of PS_HOSTS resolves and
+	// accepts TCP connections.
+	psWaitScript = `for endpoint in $(echo "$PS_HOSTS" | tr ',' ' '); do
+  host="${endpoint%:*}"
+  port="${endpoint##*:}"
+  until nslookup "$host" >/dev/null 2>&1 && nc -z -w 2 "$host" "$port"; do
+    echo "Waiting for PS $endpoint"
+    sleep 2
+  done
+done`
+)
+
+// newPSWaitInitContainer returns the init container waiting for the PS, with
+// the given image and tiny resources, both requested and limited.
+func newPSWaitInitContainer(image, cpu, memory string) (*v1.Container, error) {
+	resources := make(v1.ResourceList)
+	for name, value := range map[v1.ResourceName]string{v1.ResourceCPU: cpu, v1.ResourceMemory: memory} {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", name, value, err)
+		}
+		resources[name] = quantity
+	}
+	return &v1.Container{
+		Name:    psWaitInitContainerName,
+		Image:   image,
+		Command: []string{"sh", "-c", psWaitScript},
+		Resources: v1.ResourceRequirements{
+			Requests: resources,
+			Limits:   resources.DeepCopy(),
+		},
+	}, nil
+}
+
+// psEndpoints returns the endpoints of the PS of the tfjob, taken from the
+// cluster spec of TF_CONFIG.
+func psEndpoints(tfjob *tfv1.TFJob, nameTemplate jobcontroller.NameTemplate) ([]string, error) {
+	clusterSpec, err := genClusterSpec(tfjob, nameTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return clusterSpec[strings.ToLower(string(tfv1.TFReplicaTypePS))], nil
+}
+
+// injectPSWaitInitContainer appends the init container waiting for the PS to
+// the worker and chief pods of the tfjob, unless the tfjob has no PS or skips
+// it with AnnotationSkipPSWait. It runs after the init containers of the pod
+// template, which may prepare the data while the PS start, and an init
+// container of the same name in the template is kept.
+func (tc *TFController) injectPSWaitInitContainer(podTemplate *v1.PodTemplateSpec, tfjob *tfv1.TFJob, rt string) error {
+	if tc.psWaitInitContainer == nil || tfjob.Annotations[tfv1.AnnotationSkipPSWait] == "true" || !isDistributed(tfjob) {
+		return nil
+	}
+	switch rt {
+	case strings.ToLower(string(tfv1.TFReplicaTypeWorker)), strings.ToLower(string(tfv1.TFReplicaTypeChief)),
+		strings.ToLower(string(tfv1.TFReplicaTypeMaster)):
+	default:
+		return nil
+	}
+	for _, container := range podTemplate.Spec.InitContainers {
+		if container.Name == psWaitInitContainerName {
+			return nil
+		}
+	}
+	endpoints, err := psEndpoints(tfjob, tc.nameTemplate)
+	if err != nil {
+		return err
+	}
+	if len(endpoints) == 0 {
+		return nil
+	}
+	container := tc.psWaitInitContainer.DeepCopy()
+	container.Env = append(container.Env, v1.EnvVar{Name: psWaitHostsEnv, Value: strings.Join(endpoints, ",")})
+	podTemplate.Spec.InitContainers = append(podTemplate.Spec.InitContainers, *container)
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func TestInjectPSWaitInitContainer(t *testing.T) {
+	type testCase struct {
+		description string
+		ps          int
+		rtype       tfv1.TFReplicaType
+		annotation  string
+		// userWait is true if the pod template has an init container named
+		// like the one of the operator.
+		userWait bool
+		expected []string
+	}
+	testCases := []testCase{
+		{"The workers wait for the PS after the init containers of the template", 2, tfv1.TFReplicaTypeWorker, "", false,
+			[]string{"fetch-data", psWaitInitContainerName}},
+		{"The PS do not wait", 2, tfv1.TFReplicaTypePS, "", false, []string{"fetch-data"}},
+		{"The workers of the tfjobs without PS do not wait", 0, tfv1.TFReplicaTypeWorker, "", false, []string{"fetch-data"}},
+		{"The annotated tfjobs skip the wait", 2, tfv1.TFReplicaTypeWorker, "true", false, []string{"fetch-data"}},
+		{"The init container of the template is kept", 2, tfv1.TFReplicaTypeWorker, "", true,
+			[]string{"fetch-data", psWaitInitContainerName}},
+	}
+	for _, c := range testCases {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		container, err := newPSWaitInitContainer("busybox", "10m", "16Mi")
+		if err != nil {
+			t.Fatalf("%s: unexpected error when creating the init container: %v", c.description, err)
+		}
+		ctr.psWaitInitContainer = container
+		tfJob := testutil.NewTFJob(2, c.ps)
+		if c.annotation != "" {
+			tfJob.Annotations = map[string]string{tfv1.AnnotationSkipPSWait: c.annotation}
+		}
+		spec := tfJob.Spec.TFReplicaSpecs[c.rtype]
+		spec.Template.Spec.InitContainers = []v1.Container{{Name: "fetch-data", Image: "fetch-data"}}
+		if c.userWait {
+			spec.Template.Spec.InitContainers = append(spec.Template.Spec.InitContainers,
+				v1.Container{Name: psWaitInitContainerName, Image: "user"})
+		}
+
+		if err := ctr.createNewPod(tfJob, strings.ToLower(string(c.rtype)), "0", spec, false); err != nil {
+			t.Fatalf("%s: unexpected error when creating the pod: %v", c.description, err)
+		}
+		initContainers := fakePodControl.Templates[0].Spec.InitContainers
+		var names []string
+		for _, container := range initContainers {
+			names = append(names, container.Name)
+		}
+		if !reflect.DeepEqual(names, c.expected) {
+			t.Errorf("%s: expected the init containers %v, got %v", c.description, c.expected, names)
+			continue
+		}
+		if len(names) < 2 {
+			continue
+		}
+		wait := initContainers[1]
+		if c.userWait {
+			if wait.Image != "user" || len(wait.Env) != 0 {
+				t.Errorf("%s: expected the init container of the template to be kept, got %v", c.description, wait)
+			}
+			continue
+		}
+		endpoints, err := psEndpoints(tfJob, ctr.nameTemplate)
+		if err != nil {
+			t.Fatalf("%s: unexpected error when generating the PS endpoints: %v", c.description, err)
+		}
+		expectedEnv := []v1.EnvVar{{Name: psWaitHostsEnv, Value: strings.Join(endpoints, ",")}}
+		if len(endpoints) != 2 || !reflect.DeepEqual(wait.Env, expectedEnv) {
+			t.Errorf("%s: expected the env %v, got %v", c.description, expectedEnv, wait.Env)
+		}
+		if wait.Image != "busybox" || wait.Resources.Limits.Cpu().Cmp(resource.MustParse("10m")) != 0 ||
+			wait.Resources.Requests.Memory().Cmp(resource.MustParse("16Mi")) != 0 {
+			t.Errorf("%s: expected the configured image and resources, got %v", c.description, wait)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/util/workqueue"
+)
+
+var (
+	// queueLatencyWaits tracks the longest time a tfjob key waited in the
+	// work queue since the last scrape.
+	queueLatencyWaits = &maxSinceReset{}
+	queueLatencyMax   = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "tf_operator_queue_latency_max_seconds",
+		Help: "Longest time a tfjob waited in the work queue before its sync started, since the last scrape",
+	}, queueLatencyWaits.reset)
+)
+
+// syncLatencyQueue is a rate limiting work queue which records when each key
+// becomes ready, so that the time it waits until its sync starts can be
+// measured.
+type syncLatencyQueue struct {
+	workqueue.RateLimitingInterface
+
+	rateLimiter workqueue.RateLimiter
+	clock       clock.Clock
+
+	lock sync.Mutex
+	// readyTimes maps the queued keys to the earliest time they became ready.
+	readyTimes map[interface{}]time.Time
+}
+
+// newSyncLatencyQueue returns a named rate limiting queue which records the
+// time the keys wait in it.
+func newSyncLatencyQueue(rateLimiter workqueue.RateLimiter, name string, clock clock.Clock) *syncLatencyQueue {
+	return &syncLatencyQueue{
+		RateLimitingInterface: workqueue.NewNamedRateLimitingQueue(rateLimiter, name),
+		rateLimiter:           rateLimiter,
+		clock:                 clock,
+		readyTimes:            make(map[interface{}]time.Time),
+	}
+}
+
+func (q *syncLatencyQueue) Add(item interface{}) {
+	q.recordReady(item, q.clock.Now())
+	q.RateLimitingInterface.Add(item)
+}
+
+func (q *syncLatencyQueue) AddAfter(item interface{}, duration time.Duration) {
+	q.recordReady(item, q.clock.Now().Add(duration))
+	q.RateLimitingInterface.AddAfter(item, duration)
+}
+
+func (q *syncLatencyQueue) AddRateLimited(item interface{}) {
+	// The underlying queue shares the rate limiter, so this is what its
+	// AddRateLimited does.
+	q.AddAfter(item, q.rateLimiter.When(item))
+}
+
+// recordReady records the time the item becomes ready, unless it is
+// already queued with an earlier one.
+func (q *syncLatencyQueue) recordReady(item interface{}, ready time.Time) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if current, ok := q.readyTimes[item]; !ok || ready.Before(current) {
+		q.readyTimes[item] = ready
+	}
+}
+
+// waitTime returns how long the item has waited since it became ready, and
+// forgets it. It should be called once the item is got from the queue.
+func (q *syncLatencyQueue) waitTime(item interface{}) (time.Duration, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	ready, ok := q.readyTimes[item]
+	if !ok {
+		return 0, false
+	}
+	delete(q.readyTimes, item)
+	waited := q.clock.Since(ready)
+	if waited < 0 {
+		waited = 0
+	}
+	return waited, true
+}
+
+// observeQueueLatency reports the time the tfjob with the given key waited in
+// the work queue, and warns if it exceeds the threshold.
+func (tc *TFController) observeQueueLatency(key string, waited time.Duration) {
+	queueLatencyWaits.observe(waited.Seconds())
+	if tc.queueLatencyThreshold > 0 && waited > tc.queueLatencyThreshold {
+		log.Warnf("TFJob %s waited %v in the work queue before its sync started, exceeding the threshold of %v",
+			key, waited, tc.queueLatencyThreshold)
+	}
+}
+
+// maxSinceReset is the maximum value observed since it was last reset.
+type maxSinceReset struct {
+	lock sync.Mutex
+	max  float64
+}
+
+// observe records the value.
+func (m *maxSinceReset) observe(value float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if value > m.max {
+		m.max = value
+	}
+}
+
+// reset returns the maximum and resets it.
+func (m *maxSinceReset) reset() float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	max := m.max
+	m.max = 0
+	return max
+}
@@ -0,0 +1,171 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	kubeclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/kubernetes/pkg/controller"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func TestSyncLatencyQueue(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	q := newSyncLatencyQueue(workqueue.DefaultControllerRateLimiter(), "test", fakeClock)
+	defer q.ShutDown()
+
+	q.Add("key")
+	fakeClock.Step(time.Minute)
+	// The key is already queued, so it keeps waiting since the first add.
+	q.Add("key")
+	fakeClock.Step(time.Minute)
+
+	item, _ := q.Get()
+	waited, ok := q.waitTime(item)
+	if !ok || waited != 2*time.Minute {
+		t.Errorf("Expected the key to wait 2m, got %v", waited)
+	}
+	q.Done(item)
+	if _, ok := q.waitTime(item); ok {
+		t.Errorf("Expected the wait time to be forgotten")
+	}
+}
+
+func TestQueueLatencyWarning(t *testing.T) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	option := options.ServerOption{
+		QueueLatencyThreshold: time.Minute,
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, _, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, option)
+	fakeClock := clock.NewFakeClock(time.Now())
+	ctr.syncLatencyQueue = newSyncLatencyQueue(workqueue.DefaultControllerRateLimiter(), "test", fakeClock)
+	ctr.WorkQueue = ctr.syncLatencyQueue
+	defer ctr.WorkQueue.ShutDown()
+	ctr.syncHandler = func(tfJobKey string) (bool, error) {
+		return true, nil
+	}
+	tfJobIndexer := ctr.tfJobInformer.GetIndexer()
+
+	var buf bytes.Buffer
+	out := log.StandardLogger().Out
+	log.SetOutput(&buf)
+	defer log.SetOutput(out)
+
+	running := testutil.NewTFJob(1, 0)
+	running.Name = "running"
+	succeeded := testutil.NewTFJob(1, 0)
+	succeeded.Name = "succeeded"
+	if err := updateTFJobConditions(succeeded, common.JobSucceeded, tfJobSucceededReason, ""); err != nil {
+		t.Errorf("Unexpected error when updating conditions: %v", err)
+	}
+	for _, tfJob := range []*tfv1.TFJob{running, succeeded} {
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+		}
+		if err := tfJobIndexer.Add(unstructured); err != nil {
+			t.Errorf("Failed to add tfjob to tfJobIndexer: %v", err)
+		}
+	}
+
+	// Collect once to reset the gauge.
+	collectQueueLatencyMax(t)
+
+	// The terminal tfjob is not reported however long it waits.
+	ctr.WorkQueue.Add(testutil.GetKey(succeeded, t))
+	fakeClock.Step(10 * time.Minute)
+	ctr.processNextWorkItem()
+	if got := collectQueueLatencyMax(t); got != 0 {
+		t.Errorf("Expected the terminal tfjob to be excluded, got %v", got)
+	}
+
+	// The worker pool is slow to pick the running tfjob up.
+	ctr.WorkQueue.Add(testutil.GetKey(running, t))
+	fakeClock.Step(5 * time.Minute)
+	ctr.processNextWorkItem()
+	if got := collectQueueLatencyMax(t); got != 300 {
+		t.Errorf("Expected the gauge to report 300s, got %v", got)
+	}
+	if !strings.Contains(buf.String(), testutil.GetKey(running, t)) || strings.Contains(buf.String(), "succeeded waited") {
+		t.Errorf("Expected a warning naming the running tfjob, got %q", buf.String())
+	}
+
+	// A wait exceeding the threshold is reported even if it is not the
+	// longest one since the last scrape.
+	ctr.WorkQueue.Add(testutil.GetKey(running, t))
+	fakeClock.Step(10 * time.Minute)
+	ctr.processNextWorkItem()
+	buf.Reset()
+	ctr.WorkQueue.Add(testutil.GetKey(running, t))
+	fakeClock.Step(2 * time.Minute)
+	ctr.processNextWorkItem()
+	if !strings.Contains(buf.String(), testutil.GetKey(running, t)) {
+		t.Errorf("Expected a warning naming the running tfjob, got %q", buf.String())
+	}
+	if got := collectQueueLatencyMax(t); got != 600 {
+		t.Errorf("Expected the gauge to report 600s, got %v", got)
+	}
+}
+
+func collectQueueLatencyMax(t *testing.T) float64 {
+	ch := make(chan prometheus.Metric, 1)
+	queueLatencyMax.Collect(ch)
+	var m dto.Metric
+	if err := (<-ch).Write(&m); err != nil {
+		t.Fatalf("Failed to write the metric: %v", err)
+	}
+	return m.GetGauge().GetValue()
+}
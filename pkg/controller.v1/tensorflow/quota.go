@@ -0,0 +1,203 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"sort"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+	"github.com/kubeflow/tf-operator/pkg/util/k8sutil"
+)
+
+const (
+	// tfJobQueuedReason is added in a tfjob when it waits for GPU quota.
+	tfJobQueuedReason = "TFJobQueued"
+	// tfJobAdmittedReason is added in a tfjob when it leaves the GPU quota queue.
+	tfJobAdmittedReason = "TFJobAdmitted"
+)
+
+// admitByGPUQuota checks whether the tfjob fits in the GPU quota of its namespace.
+// TFJobs which have not created any pod yet are admitted in FIFO order of their
+// creation time, so a tfjob is only admitted once all the older queued tfjobs
+// of the namespace fit as well. If the tfjob is not admitted, the returned
+// message explains the shortfall. The admission is recorded in the queued
+// condition of the tfjob, so that it is not queued again while its pods are
+// recreated, and its GPUs stay reserved meanwhile.
+func (tc *TFController) admitByGPUQuota(tfjob *tfv1.TFJob, pods []*v1.Pod) (bool, string, error) {
+	quota, ok := tc.gpuQuotas[tfjob.Namespace]
+	if !ok || isAdmittedByGPUQuota(tfjob.Status.JobStatus) {
+		return true, "", nil
+	}
+	requested := getTotalGPURequests(tfjob)
+	if requested == 0 {
+		return true, "", nil
+	}
+	if len(pods) > 0 {
+		// TFJobs with pods have already been admitted.
+		setAdmittedCondition(tfjob)
+		return true, "", nil
+	}
+
+	// Count the GPUs requested by the active pods of all tfjobs in the namespace.
+	selector := labels.SelectorFromSet(labels.Set{
+		labelGroupName: tfv1.GroupName,
+	})
+	nsPods, err := tc.PodLister.Pods(tfjob.Namespace).List(selector)
+	if err != nil {
+		return false, "", err
+	}
+	used := int64(0)
+	jobsWithPods := make(map[string]bool)
+	for _, pod := range nsPods {
+		jobName, ok := pod.Labels[jobcontroller.JobNameLabel]
+		if !ok && tc.v1beta2Compatibility {
+			// The pods of the v1beta2 operator only have the deprecated label.
+			jobName = pod.Labels[labelTFJobName]
+		}
+		jobsWithPods[jobName] = true
+		if k8sutil.IsPodActive(pod) {
+			used += getPodGPURequests(&pod.Spec)
+		}
+	}
+
+	queued, reserved := tc.queuedTFJobs(tfjob.Namespace, jobsWithPods)
+	available := quota - used - reserved
+	for _, queued := range queued {
+		demand := getTotalGPURequests(queued)
+		if queued.UID == tfjob.UID {
+			break
+		}
+		if demand > available {
+			// An older tfjob does not fit yet; keep the order.
+			return false, fmt.Sprintf("TFJob %s is queued behind TFJob %s for the GPU quota of namespace %s.",
+				tfjob.Name, queued.Name, tfjob.Namespace), nil
+		}
+		available -= demand
+	}
+	if requested > available {
+		return false, fmt.Sprintf("TFJob %s is queued: it requests %d GPUs but only %d of the %d GPU quota of namespace %s are available, short of %d.",
+			tfjob.Name, requested, max64(available, 0), quota, tfjob.Namespace, requested-max64(available, 0)), nil
+	}
+	setAdmittedCondition(tfjob)
+	return true, "", nil
+}
+
+// queuedTFJobs returns the unfinished tfjobs of the namespace which request
+// GPUs but have no pods and have not been admitted, ordered by creation time
+// and then by name, along with the GPUs reserved by the admitted ones which
+// have no pods.
+func (tc *TFController) queuedTFJobs(namespace string, jobsWithPods map[string]bool) ([]*tfv1.TFJob, int64) {
+	var queued []*tfv1.TFJob
+	reserved := int64(0)
+	for _, obj := range tc.tfJobIndexerFor(namespace).List() {
+		tfjob, err := tfJobFromUnstructured(obj)
+		if err != nil || tfjob.Namespace != namespace {
+			continue
+		}
+		if isSucceeded(tfjob.Status.JobStatus) || isFailed(tfjob.Status.JobStatus) || tfjob.DeletionTimestamp != nil {
+			continue
+		}
+		// The GPUs of the referenced PodTemplates are counted. A tfjob whose
+		// PodTemplate is missing fails on its own sync.
+		if _, _, err := tc.resolvePodTemplates(tfjob); err != nil {
+			continue
+		}
+		if jobsWithPods[tfjob.Name] || getTotalGPURequests(tfjob) == 0 {
+			continue
+		}
+		if isAdmittedByGPUQuota(tfjob.Status.JobStatus) {
+			reserved += getTotalGPURequests(tfjob)
+			continue
+		}
+		queued = append(queued, tfjob)
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		ti, tj := queued[i].CreationTimestamp, queued[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		return queued[i].Name < queued[j].Name
+	})
+	return queued, reserved
+}
+
+// isAdmittedByGPUQuota returns true if the tfjob has been admitted by the GPU
+// quota of its namespace.
+func isAdmittedByGPUQuota(status common.JobStatus) bool {
+	condition := getCondition(status, tfv1.JobQueued)
+	return condition != nil && condition.Status == v1.ConditionFalse && condition.Reason == tfJobAdmittedReason
+}
+
+// setAdmittedCondition records that the tfjob is admitted by the GPU quota.
+func setAdmittedCondition(tfjob *tfv1.TFJob) {
+	msg := fmt.Sprintf("TFJob %s is admitted by the GPU quota.", tfjob.Name)
+	condition := newCondition(tfv1.JobQueued, tfJobAdmittedReason, msg)
+	condition.Status = v1.ConditionFalse
+	setCondition(&tfjob.Status.JobStatus, condition)
+}
+
+// updateQueuedCondition sets or clears the queued condition of the tfjob
+// according to the admission decision.
+func updateQueuedCondition(tfjob *tfv1.TFJob, admitted bool, msg string) {
+	if !admitted {
+		tflogger.LoggerForJob(tfjob).Info(msg)
+		setCondition(&tfjob.Status.JobStatus, newCondition(tfv1.JobQueued, tfJobQueuedReason, msg))
+		return
+	}
+	if hasCondition(tfjob.Status.JobStatus, tfv1.JobQueued) {
+		setAdmittedCondition(tfjob)
+	}
+}
+
+// getTotalGPURequests returns the number of GPUs requested by all replicas of the tfjob.
+func getTotalGPURequests(tfjob *tfv1.TFJob) int64 {
+	total := int64(0)
+	for _, spec := range tfjob.Spec.TFReplicaSpecs {
+		replicas := int64(1)
+		if spec.Replicas != nil {
+			replicas = int64(*spec.Replicas)
+		}
+		total += replicas * getPodGPURequests(&spec.Template.Spec)
+	}
+	return total
+}
+
+// getPodGPURequests returns the number of GPUs requested by the containers of a pod.
+// GPUs are only honored in limits, so limits take precedence over requests.
+func getPodGPURequests(spec *v1.PodSpec) int64 {
+	total := int64(0)
+	for _, container := range spec.Containers {
+		if q, ok := container.Resources.Limits[tfv1.ResourceGPU]; ok {
+			total += q.Value()
+		} else if q, ok := container.Resources.Requests[tfv1.ResourceGPU]; ok {
+			total += q.Value()
+		}
+	}
+	return total
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,210 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubeclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/kubernetes/pkg/controller"
+
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func newGPUTFJob(name string, gpus int64, created time.Time) *tfv1.TFJob {
+	tfJob := testutil.NewTFJob(1, 0)
+	tfJob.Name = name
+	tfJob.UID = types.UID(name)
+	tfJob.CreationTimestamp = metav1.NewTime(created)
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template.Spec.Containers[0].Resources = v1.ResourceRequirements{
+		Limits: v1.ResourceList{
+			tfv1.ResourceGPU: *resource.NewQuantity(gpus, resource.DecimalSI),
+		},
+	}
+	return tfJob
+}
+
+func TestGPUQuota(t *testing.T) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	option := options.ServerOption{
+		GPUQuotas: map[string]int64{metav1.NamespaceDefault: 3},
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, kubeInformerFactory, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, option)
+	fakePodControl := &controller.FakePodControl{}
+	ctr.PodControl = fakePodControl
+	ctr.Recorder = &record.FakeRecorder{}
+	tfJobIndexer := ctr.tfJobInformer.GetIndexer()
+	podIndexer := kubeInformerFactory.Core().V1().Pods().Informer().GetIndexer()
+
+	var actual *tfv1.TFJob
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		actual = tfJob
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			return err
+		}
+		return tfJobIndexer.Update(unstructured)
+	}
+
+	now := time.Now()
+	first := newGPUTFJob("first", 2, now)
+	second := newGPUTFJob("second", 2, now.Add(time.Second))
+	for _, tfJob := range []*tfv1.TFJob{second, first} {
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+		}
+		if err := tfJobIndexer.Add(unstructured); err != nil {
+			t.Errorf("Failed to add tfjob to tfJobIndexer: %v", err)
+		}
+	}
+
+	// The older tfjob is admitted first.
+	if _, err := ctr.syncTFJob(testutil.GetKey(first, t)); err != nil {
+		t.Errorf("Unexpected error when syncing %s: %v", first.Name, err)
+	}
+	if len(fakePodControl.Templates) != 1 {
+		t.Errorf("Expected 1 pod creation for %s, got %d", first.Name, len(fakePodControl.Templates))
+	}
+
+	// The younger tfjob does not fit next to the older one, even before its pods show up.
+	if _, err := ctr.syncTFJob(testutil.GetKey(second, t)); err != nil {
+		t.Errorf("Unexpected error when syncing %s: %v", second.Name, err)
+	}
+	if len(fakePodControl.Templates) != 1 {
+		t.Errorf("Expected %s to be queued, got %d pod creations", second.Name, len(fakePodControl.Templates))
+	}
+	if !testutil.CheckCondition(actual, tfv1.JobQueued, tfJobQueuedReason) {
+		t.Errorf("Expected %s to have a queued condition, got %v", second.Name, actual.Status.Conditions)
+	}
+
+	// The pod of the older tfjob is running and holds 2 of the 3 GPUs.
+	pod := testutil.NewPod(first, testutil.LabelWorker, 0, t)
+	pod.Spec = *first.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template.Spec.DeepCopy()
+	pod.Status.Phase = v1.PodRunning
+	if err := podIndexer.Add(pod); err != nil {
+		t.Errorf("Unexpected error when adding pod %v", err)
+	}
+	if _, err := ctr.syncTFJob(testutil.GetKey(second, t)); err != nil {
+		t.Errorf("Unexpected error when syncing %s: %v", second.Name, err)
+	}
+	if len(fakePodControl.Templates) != 1 {
+		t.Errorf("Expected %s to stay queued, got %d pod creations", second.Name, len(fakePodControl.Templates))
+	}
+	cond := getCondition(actual.Status.JobStatus, tfv1.JobQueued)
+	if cond == nil || !strings.Contains(cond.Message, "short of 1") {
+		t.Errorf("Expected the queued condition to report the shortfall, got %v", cond)
+	}
+
+	// Once the older tfjob completes, the younger one is promoted.
+	pod = pod.DeepCopy()
+	pod.Status.Phase = v1.PodSucceeded
+	if err := podIndexer.Update(pod); err != nil {
+		t.Errorf("Unexpected error when updating pod %v", err)
+	}
+	if _, err := ctr.syncTFJob(testutil.GetKey(second, t)); err != nil {
+		t.Errorf("Unexpected error when syncing %s: %v", second.Name, err)
+	}
+	if len(fakePodControl.Templates) != 2 {
+		t.Errorf("Expected %s to be admitted, got %d pod creations", second.Name, len(fakePodControl.Templates))
+	}
+	if hasCondition(actual.Status.JobStatus, tfv1.JobQueued) {
+		t.Errorf("Expected the queued condition of %s to be cleared, got %v", second.Name, actual.Status.Conditions)
+	}
+}
+
+func TestGPUQuotaAdmittedOnce(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	ctr.gpuQuotas = map[string]int64{metav1.NamespaceDefault: 3}
+	tfJobIndexer := ctr.tfJobInformer.GetIndexer()
+
+	now := time.Now()
+	older := newGPUTFJob("older", 2, now)
+	admitted := newGPUTFJob("admitted", 2, now.Add(time.Second))
+	setAdmittedCondition(admitted)
+	for _, tfJob := range []*tfv1.TFJob{older, admitted} {
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			t.Fatalf("Failed to convert the TFJob to Unstructured: %v", err)
+		}
+		if err := tfJobIndexer.Add(unstructured); err != nil {
+			t.Fatalf("Failed to add tfjob to tfJobIndexer: %v", err)
+		}
+	}
+
+	// The admitted tfjob whose pods are all being recreated is not queued
+	// again behind the older one.
+	ok, msg, err := ctr.admitByGPUQuota(admitted, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error when admitting %s: %v", admitted.Name, err)
+	}
+	if !ok {
+		t.Errorf("Expected %s to stay admitted, got %q", admitted.Name, msg)
+	}
+
+	// Its GPUs stay reserved meanwhile.
+	ok, _, err = ctr.admitByGPUQuota(older, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error when admitting %s: %v", older.Name, err)
+	}
+	if ok || isAdmittedByGPUQuota(older.Status.JobStatus) {
+		t.Errorf("Expected %s to be queued behind the GPUs reserved by %s", older.Name, admitted.Name)
+	}
+
+	// A tfjob is admitted once.
+	ctr.gpuQuotas[metav1.NamespaceDefault] = 4
+	if ok, _, err = ctr.admitByGPUQuota(older, nil); err != nil || !ok {
+		t.Fatalf("Expected %s to be admitted, got %v, %v", older.Name, ok, err)
+	}
+	if !isAdmittedByGPUQuota(older.Status.JobStatus) {
+		t.Errorf("Expected the admission of %s to be recorded, got %v", older.Name, older.Status.Conditions)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+// The tests of this file are meant to be run with -race, which reports the
+// accesses to the maps of the shared fixtures not ordered with the defaulting.
+
+// newLowerCaseTFJob returns a tfjob whose replica types are in lower case, so
+// that the defaulting rewrites the keys of its TFReplicaSpecs.
+func newLowerCaseTFJob() *tfv1.TFJob {
+	tfJob := testutil.NewTFJob(2, 1)
+	specs := make(map[tfv1.TFReplicaType]*common.ReplicaSpec)
+	for rtype, spec := range tfJob.Spec.TFReplicaSpecs {
+		specs[tfv1.TFReplicaType(strings.ToLower(string(rtype)))] = spec
+	}
+	tfJob.Spec.TFReplicaSpecs = specs
+	return tfJob
+}
+
+func replicaTypes(tfJob *tfv1.TFJob) []string {
+	var rtypes []string
+	for rtype := range tfJob.Spec.TFReplicaSpecs {
+		rtypes = append(rtypes, string(rtype))
+	}
+	sort.Strings(rtypes)
+	return rtypes
+}
+
+func TestConcurrentDefaultingAndReconcile(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+	tfJob := newLowerCaseTFJob()
+	unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Fatalf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+		t.Fatalf("Failed to add the tfjob: %v", err)
+	}
+	key := testutil.GetKey(tfJob, t)
+	expected := replicaTypes(tfJob)
+
+	// The syncs of the tfjob in the cache run alongside the exported helpers
+	// setting defaults on copies of the shared tfjob.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			ctr.deleteExpectations(key)
+			if _, err := ctr.syncTFJob(key); err != nil {
+				t.Errorf("Unexpected error when syncing the tfjob: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := GenClusterSpec(tfJob); err != nil {
+				t.Errorf("Unexpected error when generating the cluster spec: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if statuses := GetReplicaStatuses(tfJob, nil); len(statuses) != len(expected) {
+				t.Errorf("Expected %d replica statuses, got %v", len(expected), statuses)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if actual := replicaTypes(tfJob); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected the shared tfjob to keep its replica types %v, got %v", expected, actual)
+	}
+	cached, err := ctr.getTFJobFromKey(key)
+	if err != nil {
+		t.Fatalf("Failed to get the tfjob: %v", err)
+	}
+	if actual := replicaTypes(cached); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected the cached tfjob to keep its replica types %v, got %v", expected, actual)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+const (
+	// tfJobRampingUpReason is added in a tfjob whose pods are being created
+	// in batches.
+	tfJobRampingUpReason = "PodCreationRampingUp"
+	// tfJobRampedUpReason is added in a tfjob once the pods it created in
+	// batches are all created.
+	tfJobRampedUpReason = "PodCreationRampedUp"
+)
+
+// podCreationBudget bounds the pods of a tfjob created in one sync by its
+// pod creation ramp-up. It is shared by the replica types, which are
+// reconciled concurrently. A nil budget does not bound the creations.
+type podCreationBudget struct {
+	mu sync.Mutex
+	// remaining is the number of pods which may still be created.
+	remaining int
+	// granted is the number of pods allowed to be created.
+	granted int
+	// deferred is the number of missing pods left for the next batches.
+	deferred int
+}
+
+// take returns the indexes of the missing pods which may be created in this
+// sync, and counts the others as deferred to the next batches.
+func (b *podCreationBudget) take(missing []int) []int {
+	if b == nil {
+		return missing
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := minInt(len(missing), b.remaining)
+	b.remaining -= n
+	b.granted += n
+	b.deferred += len(missing) - n
+	return missing[:n]
+}
+
+// newPodCreationBudget returns the budget of the pods of the tfjob created in
+// this sync, which is nil if the tfjob does not ramp up. No pod is created
+// until the interval of the ramp-up has passed since the last batch.
+func (tc *TFController) newPodCreationBudget(tfjob *tfv1.TFJob) *podCreationBudget {
+	rampUp := tfjob.Spec.PodCreationRampUp
+	if rampUp == nil {
+		return nil
+	}
+	budget := &podCreationBudget{remaining: int(rampUp.BatchSize)}
+	if tc.nextRampUpBatchIn(tfjob) > 0 {
+		budget.remaining = 0
+	}
+	return budget
+}
+
+// nextRampUpBatchIn returns how long the tfjob has to wait before its next
+// batch of pods is created. It is not positive if the batch can be created.
+func (tc *TFController) nextRampUpBatchIn(tfjob *tfv1.TFJob) time.Duration {
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return 0
+	}
+	tc.rampUpLock.Lock()
+	defer tc.rampUpLock.Unlock()
+	last, ok := tc.lastRampUpBatches[key]
+	if !ok {
+		return 0
+	}
+	interval := time.Duration(tfjob.Spec.PodCreationRampUp.IntervalSeconds) * time.Second
+	return last.Add(interval).Sub(tc.clock.Now())
+}
+
+// finishPodCreationRampUp records the batch of pods created in this sync,
+// requeues the tfjob for its next batch, and reports the progress of the
+// ramp-up in the conditions of the tfjob.
+func (tc *TFController) finishPodCreationRampUp(tfjob *tfv1.TFJob, budget *podCreationBudget) {
+	if budget == nil {
+		return
+	}
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("couldn't get key for tfjob object %#v: %v", tfjob, err))
+		return
+	}
+
+	if budget.deferred == 0 {
+		tc.forgetPodCreationRampUp(key)
+		if hasCondition(tfjob.Status.JobStatus, tfv1.JobPodCreationRampUp) {
+			msg := fmt.Sprintf("TFJob %s has created all its pods.", tfjob.Name)
+			condition := newCondition(tfv1.JobPodCreationRampUp, tfJobRampedUpReason, msg)
+			condition.Status = v1.ConditionFalse
+			setCondition(&tfjob.Status.JobStatus, condition)
+		}
+		return
+	}
+
+	if budget.granted > 0 {
+		tc.rampUpLock.Lock()
+		tc.lastRampUpBatches[key] = tc.clock.Now()
+		tc.rampUpLock.Unlock()
+	}
+	rampUp := tfjob.Spec.PodCreationRampUp
+	msg := fmt.Sprintf("TFJob %s is creating its pods in batches of %d every %ds, %d pods are left to create.",
+		tfjob.Name, rampUp.BatchSize, rampUp.IntervalSeconds, budget.deferred)
+	tflogger.LoggerForJob(tfjob).Info(msg)
+	setCondition(&tfjob.Status.JobStatus, newCondition(tfv1.JobPodCreationRampUp, tfJobRampingUpReason, msg))
+
+	if wait := tc.nextRampUpBatchIn(tfjob); wait > 0 {
+		tc.WorkQueue.AddAfter(key, wait)
+	} else {
+		tc.WorkQueue.AddRateLimited(key)
+	}
+}
+
+// forgetPodCreationRampUp forgets the last batch of pods of the tfjob.
+func (tc *TFController) forgetPodCreationRampUp(key string) {
+	tc.rampUpLock.Lock()
+	defer tc.rampUpLock.Unlock()
+	delete(tc.lastRampUpBatches, key)
+}
+
+// invalidPodCreationRampUp returns why the tfjob is rejected if its pods are
+// created in batches while they are gang scheduled, or an empty string
+// otherwise. The PodGroup of the tfjob requires all its pods, so none of
+// them would be scheduled until the ramp-up is over.
+func (tc *TFController) invalidPodCreationRampUp(tfjob *tfv1.TFJob) string {
+	rampUp := tfjob.Spec.PodCreationRampUp
+	if !tc.Config.EnableGangScheduling || rampUp == nil {
+		return ""
+	}
+	if total := getTotalReplicas(tfjob); int64(rampUp.BatchSize) < total {
+		return fmt.Sprintf("TFJob %s is invalid: its %d pods are gang scheduled, they cannot be created in batches of %d.",
+			tfjob.Name, total, rampUp.BatchSize)
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func TestPodCreationRampUp(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	defer ctr.WorkQueue.ShutDown()
+	fakeClock := clock.NewFakeClock(time.Now())
+	ctr.clock = fakeClock
+
+	tfJob := testutil.NewTFJob(4, 1)
+	tfJob.Spec.PodCreationRampUp = &tfv1.PodCreationRampUp{BatchSize: 2, IntervalSeconds: 30}
+
+	type step struct {
+		description string
+		elapsed     time.Duration
+		created     int
+		rampingUp   bool
+	}
+	steps := []step{
+		{"The first batch is created right away", 0, 2, true},
+		{"No batch is created before the interval", 10 * time.Second, 0, true},
+		{"The second batch is created after the interval", 20 * time.Second, 2, true},
+		{"The last batch is smaller", 30 * time.Second, 1, false},
+		{"Nothing is left to create", 30 * time.Second, 0, false},
+	}
+	podsByType := make(map[string][]*v1.Pod)
+	for _, s := range steps {
+		fakeClock.Step(s.elapsed)
+		fakePodControl.Clear()
+		if err := ctr.reconcileReplicaTypes(tfJob, podsByType, nil); err != nil {
+			t.Fatalf("%s: unexpected error: %v", s.description, err)
+		}
+		if len(fakePodControl.Templates) != s.created {
+			t.Errorf("%s: expected %d pods to be created, got %d", s.description, s.created, len(fakePodControl.Templates))
+		}
+		if hasCondition(tfJob.Status.JobStatus, tfv1.JobPodCreationRampUp) != s.rampingUp {
+			t.Errorf("%s: expected the tfjob ramping up %v, got %v", s.description, s.rampingUp, tfJob.Status.Conditions)
+		}
+		// The created pods are observed by the next sync.
+		for _, template := range fakePodControl.Templates {
+			rt := template.Labels[tfReplicaTypeLabel]
+			pod := testutil.NewBasePod(rt+"-"+template.Labels[tfReplicaIndexLabel], tfJob, t)
+			pod.Labels = template.Labels
+			podsByType[rt] = append(podsByType[rt], pod)
+		}
+	}
+	if len(podsByType[testutil.LabelWorker]) != 4 || len(podsByType[testutil.LabelPS]) != 1 {
+		t.Errorf("Expected all the pods to be created, got %v", podsByType)
+	}
+	cond := getCondition(tfJob.Status.JobStatus, tfv1.JobPodCreationRampUp)
+	if cond == nil || cond.Reason != tfJobRampedUpReason {
+		t.Errorf("Expected the ramp-up to be reported as over, got %v", cond)
+	}
+}
+
+func TestPodCreationRampUpGangScheduling(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	tfJob := testutil.NewTFJob(4, 1)
+	tfJob.Spec.PodCreationRampUp = &tfv1.PodCreationRampUp{BatchSize: 2}
+
+	if msg := ctr.invalidPodCreationRampUp(tfJob); msg != "" {
+		t.Errorf("Expected the ramp-up to be valid without gang scheduling, got %q", msg)
+	}
+	ctr.Config.EnableGangScheduling = true
+	if msg := ctr.invalidPodCreationRampUp(tfJob); msg == "" {
+		t.Errorf("Expected the ramp-up to conflict with gang scheduling")
+	}
+	// A single batch creates all the pods of the PodGroup.
+	tfJob.Spec.PodCreationRampUp.BatchSize = 5
+	if msg := ctr.invalidPodCreationRampUp(tfJob); msg != "" {
+		t.Errorf("Expected a single batch to be valid with gang scheduling, got %q", msg)
+	}
+}
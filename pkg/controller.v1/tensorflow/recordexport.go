@@ -0,0 +1,248 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/export"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+// recordExportFailedReason is the warning reason when a tfjob is deleted
+// without its record after too many failed exports.
+const recordExportFailedReason = "RecordExportFailed"
+
+var recordExportFailuresCount = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "tf_operator_record_export_failures_total",
+	Help: "Counts number of failed exports of the records of the terminated TF jobs",
+})
+
+// recordExport is the export of the record of a terminated tfjob.
+type recordExport struct {
+	// tfjob is the tfjob the record is of.
+	tfjob *tfv1.TFJob
+	// record is the record exported.
+	record *export.Record
+	// attempts is the failed exports of the record.
+	attempts int
+	// done is true once the record is exported, or once its exports failed
+	// recordExportMaxAttempts times.
+	done bool
+}
+
+// ExportRecords sets the sink the records of the terminated tfjobs are
+// exported to before they are deleted after their TTL.
+func (tc *TFController) ExportRecords(sink export.Sink) {
+	tc.recordSink = sink
+}
+
+// exportRecord returns true once the record of the terminated tfjob is
+// exported, so that the tfjob can be deleted. The record is queued for the
+// record export workers, so that a slow sink does not hold the syncs, and the
+// tfjob is synced again once its export is done. The export is retried with a
+// backoff until recordExportMaxAttempts exports failed: the tfjob is then
+// deleted without its record, with a warning.
+func (tc *TFController) exportRecord(tfjob *tfv1.TFJob) (bool, error) {
+	if tc.recordSink == nil {
+		return true, nil
+	}
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return false, err
+	}
+	tc.recordExportsLock.Lock()
+	pending, ok := tc.recordExports[key]
+	tc.recordExportsLock.Unlock()
+	if ok && pending.tfjob.UID == tfjob.UID {
+		return pending.done, nil
+	}
+
+	pending = &recordExport{tfjob: tfjob.DeepCopy(), record: tc.newRecord(tfjob)}
+	tc.recordExportsLock.Lock()
+	tc.recordExports[key] = pending
+	tc.recordExportsLock.Unlock()
+	tc.recordExportQueue.Add(key)
+	return false, nil
+}
+
+// runRecordExportWorker exports the records of the record export queue.
+func (tc *TFController) runRecordExportWorker() {
+	for tc.processNextRecordExport() {
+	}
+}
+
+// processNextRecordExport exports the next record of the record export
+// queue. It returns false once the queue is shut down.
+func (tc *TFController) processNextRecordExport() bool {
+	obj, quit := tc.recordExportQueue.Get()
+	if quit {
+		return false
+	}
+	defer tc.recordExportQueue.Done(obj)
+	key := obj.(string)
+
+	tc.recordExportsLock.Lock()
+	pending, ok := tc.recordExports[key]
+	tc.recordExportsLock.Unlock()
+	if !ok || pending.done {
+		// The tfjob has been deleted meanwhile.
+		tc.recordExportQueue.Forget(key)
+		return true
+	}
+
+	err := tc.recordSink.Export(pending.record)
+	tc.recordExportsLock.Lock()
+	defer tc.recordExportsLock.Unlock()
+	if err == nil {
+		pending.done = true
+		tc.recordExportQueue.Forget(key)
+		tc.WorkQueue.Add(key)
+		return true
+	}
+	recordExportFailuresCount.Inc()
+	pending.attempts++
+	if tc.recordExportMaxAttempts > 0 && pending.attempts >= tc.recordExportMaxAttempts {
+		pending.done = true
+		msg := fmt.Sprintf("Deleting TFJob %s without its record, which failed to be exported %d times: %v", pending.tfjob.Name, pending.attempts, err)
+		tflogger.LoggerForJob(pending.tfjob).Error(msg)
+		tc.Recorder.Event(pending.tfjob, v1.EventTypeWarning, recordExportFailedReason, msg)
+		tc.recordExportQueue.Forget(key)
+		tc.WorkQueue.Add(key)
+		return true
+	}
+	tflogger.LoggerForJob(pending.tfjob).Warnf("Failed to export the record of TFJob %s (attempt %d): %v", pending.tfjob.Name, pending.attempts, err)
+	tc.recordExportQueue.AddRateLimited(key)
+	return true
+}
+
+// forgetRecordExports forgets the export of the record of the tfjob.
+func (tc *TFController) forgetRecordExports(key string) {
+	tc.recordExportsLock.Lock()
+	defer tc.recordExportsLock.Unlock()
+	delete(tc.recordExports, key)
+}
+
+// newRecord returns the record of the terminated tfjob. The digests of the
+// images are the ones reported by the pods of the tfjob which are left, and
+// the images of the replica types referencing a PodTemplate are the ones of
+// the PodTemplate.
+func (tc *TFController) newRecord(tfjob *tfv1.TFJob) *export.Record {
+	record := &export.Record{
+		Namespace:      tfjob.Namespace,
+		Name:           tfjob.Name,
+		UID:            tfjob.UID,
+		SpecHash:       specHash(tfjob),
+		ConfigHash:     tc.configHash,
+		Conditions:     tfjob.Status.Conditions,
+		CreationTime:   tfjob.CreationTimestamp,
+		StartTime:      tfjob.Status.StartTime,
+		CompletionTime: tfjob.Status.CompletionTime,
+		Replicas:       make(map[string]export.ReplicaRecord),
+	}
+	if start := tfjob.Status.StartTime; start != nil {
+		record.QueuedSeconds = start.Sub(tfjob.CreationTimestamp.Time).Seconds()
+		if completion := tfjob.Status.CompletionTime; completion != nil {
+			record.RunningSeconds = completion.Sub(start.Time).Seconds()
+		}
+	}
+
+	for rtype, spec := range tfjob.Spec.TFReplicaSpecs {
+		replica := export.ReplicaRecord{Restarts: tfjob.Status.ReplicaRestarts[rtype]}
+		if spec.Replicas != nil {
+			replica.Replicas = *spec.Replicas
+		}
+		if status := tfjob.Status.ReplicaStatuses[common.ReplicaType(rtype)]; status != nil {
+			replica.Succeeded = status.Succeeded
+			replica.Failed = status.Failed
+		}
+		record.Replicas[string(rtype)] = replica
+	}
+
+	resolved := tfjob.DeepCopy()
+	if _, msg, err := tc.resolvePodTemplates(resolved); err != nil {
+		tflogger.LoggerForJob(tfjob).Warnf("Failed to resolve the PodTemplates for the images: %v", err)
+	} else if msg != "" {
+		tflogger.LoggerForJob(tfjob).Warn(msg)
+	}
+	digests := tc.imageDigests(tfjob)
+	for rtype, spec := range resolved.Spec.TFReplicaSpecs {
+		rt := strings.ToLower(string(rtype))
+		for _, container := range spec.Template.Spec.Containers {
+			record.Images = append(record.Images, export.ImageRecord{
+				ReplicaType: string(rtype),
+				Container:   container.Name,
+				Image:       container.Image,
+				Digest:      digests[rt+"/"+container.Name],
+			})
+		}
+	}
+	sort.Slice(record.Images, func(i, j int) bool {
+		if record.Images[i].ReplicaType != record.Images[j].ReplicaType {
+			return record.Images[i].ReplicaType < record.Images[j].ReplicaType
+		}
+		return record.Images[i].Container < record.Images[j].Container
+	})
+	return record
+}
+
+// imageDigests returns the digests of the images the containers of the pods
+// of the tfjob ran, keyed by the lower case replica type and the name of the
+// container.
+func (tc *TFController) imageDigests(tfjob *tfv1.TFJob) map[string]string {
+	digests := make(map[string]string)
+	pods, err := tc.PodLister.Pods(tfjob.Namespace).List(labels.SelectorFromSet(tc.genLabels(tfjob)))
+	if err != nil {
+		tflogger.LoggerForJob(tfjob).Warnf("Failed to list the pods for the image digests: %v", err)
+		return digests
+	}
+	for _, pod := range pods {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.ImageID == "" {
+				continue
+			}
+			// The image IDs are prefixed by the runtime, e.g.
+			// docker-pullable://tensorflow/tensorflow@sha256:...
+			digest := status.ImageID
+			if i := strings.LastIndex(digest, "@"); i >= 0 {
+				digest = digest[i+1:]
+			}
+			digests[pod.Labels[tfReplicaTypeLabel]+"/"+status.Name] = digest
+		}
+	}
+	return digests
+}
+
+// specHash returns the hash of the spec of the tfjob.
+func specHash(tfjob *tfv1.TFJob) string {
+	data, err := json.Marshal(tfjob.Spec)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/export"
+)
+
+// newExpiredTFJob returns a succeeded tfjob past its TTL.
+func newExpiredTFJob(t *testing.T) *tfv1.TFJob {
+	ttl := int32(0)
+	tfJob := testutil.NewTFJobWithCleanupJobDelay(0, 1, 0, &ttl)
+	created := time.Now().Add(-time.Hour)
+	started := metav1.NewTime(created.Add(10 * time.Minute))
+	completed := metav1.NewTime(created.Add(40 * time.Minute))
+	tfJob.CreationTimestamp = metav1.NewTime(created)
+	tfJob.Status.StartTime = &started
+	tfJob.Status.CompletionTime = &completed
+	tfJob.Status.ReplicaStatuses = map[common.ReplicaType]*common.ReplicaStatus{
+		common.ReplicaType(tfv1.TFReplicaTypeWorker): {Succeeded: 1},
+	}
+	if err := updateTFJobConditions(tfJob, common.JobSucceeded, tfJobSucceededReason, ""); err != nil {
+		t.Fatalf("Unexpected error when updating the conditions: %v", err)
+	}
+	return tfJob
+}
+
+func recordExportFailures(t *testing.T) float64 {
+	var m dto.Metric
+	if err := recordExportFailuresCount.Write(&m); err != nil {
+		t.Fatalf("Failed to read the record export failures counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestExportRecordBeforeDeletion(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	sink := &export.FakeSink{}
+	ctr.ExportRecords(sink)
+	ctr.configHash = "0123456789abcdef"
+	tfJob := newExpiredTFJob(t)
+	pod := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+	pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+		Name:    tfv1.DefaultContainerName,
+		ImageID: "docker-pullable://tensorflow/tensorflow@sha256:0123",
+	}}
+	if err := ctr.podIndexer.Add(pod); err != nil {
+		t.Fatalf("Unexpected error when adding the pod: %v", err)
+	}
+	exported := -1
+	ctr.deleteTFJobHandler = func(*tfv1.TFJob) error {
+		exported = len(sink.Records)
+		return nil
+	}
+
+	// The record is exported by the record export workers, not by the sync.
+	if err := ctr.cleanupTFJob(tfJob); err != nil {
+		t.Fatalf("Unexpected error when cleaning up the tfjob: %v", err)
+	}
+	if exported != -1 || len(sink.Records) != 0 {
+		t.Fatalf("Expected the tfjob to wait for the export of its record, got %d records", len(sink.Records))
+	}
+	ctr.processNextRecordExport()
+	if err := ctr.cleanupTFJob(tfJob); err != nil {
+		t.Fatalf("Unexpected error when cleaning up the tfjob: %v", err)
+	}
+	if exported != 1 {
+		t.Fatalf("Expected the record to be exported before the tfjob is deleted, got %d records at deletion", exported)
+	}
+	actual := sink.Records[0]
+	if actual.Name != tfJob.Name || actual.SpecHash == "" || actual.ConfigHash != ctr.configHash {
+		t.Errorf("Expected the record to identify the tfjob, got %+v", actual)
+	}
+	if actual.QueuedSeconds != 600 || actual.RunningSeconds != 1800 {
+		t.Errorf("Expected 600s queued and 1800s running, got %v and %v", actual.QueuedSeconds, actual.RunningSeconds)
+	}
+	if len(actual.Conditions) != 1 || actual.Conditions[0].Type != common.JobSucceeded {
+		t.Errorf("Expected the conditions of the tfjob, got %v", actual.Conditions)
+	}
+	if worker := actual.Replicas[string(tfv1.TFReplicaTypeWorker)]; worker.Replicas != 1 || worker.Succeeded != 1 {
+		t.Errorf("Expected the outcome of the worker, got %+v", worker)
+	}
+	if len(actual.Images) != 1 || actual.Images[0].Digest != "sha256:0123" {
+		t.Errorf("Expected the digest of the worker image, got %+v", actual.Images)
+	}
+}
+
+func TestExportRecordFailure(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	recorder := record.NewFakeRecorder(10)
+	ctr.Recorder = recorder
+	sink := &export.FakeSink{Err: fmt.Errorf("fake error")}
+	ctr.ExportRecords(sink)
+	ctr.recordExportMaxAttempts = 3
+	deleted := false
+	ctr.deleteTFJobHandler = func(*tfv1.TFJob) error {
+		deleted = true
+		return nil
+	}
+	tfJob := newExpiredTFJob(t)
+	start := recordExportFailures(t)
+
+	if err := ctr.cleanupTFJob(tfJob); err != nil {
+		t.Fatalf("Unexpected error when cleaning up the tfjob: %v", err)
+	}
+	for attempt := 1; attempt <= 3; attempt++ {
+		if deleted {
+			t.Fatalf("Attempt %d: expected the tfjob not to be deleted before its record is exported", attempt)
+		}
+		ctr.processNextRecordExport()
+		if err := ctr.cleanupTFJob(tfJob); err != nil {
+			t.Fatalf("Attempt %d: unexpected error when cleaning up the tfjob: %v", attempt, err)
+		}
+	}
+	if !deleted {
+		t.Errorf("Expected the tfjob to be deleted after the last attempt")
+	}
+	if events := countEvents(recorder, recordExportFailedReason); events != 1 {
+		t.Errorf("Expected a warning event, got %d", events)
+	}
+	if failures := recordExportFailures(t) - start; failures != 3 {
+		t.Errorf("Expected 3 export failures, got %v", failures)
+	}
+	if ctr.recordExportQueue.Len() != 0 {
+		t.Errorf("Expected the export not to be retried after the last attempt, got %d queued", ctr.recordExportQueue.Len())
+	}
+}
+
+func TestExportRecordTemplateRefs(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	podTemplateIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	ctr.podTemplateLister = corelisters.NewPodTemplateLister(podTemplateIndexer)
+	if err := podTemplateIndexer.Add(newPodTemplate("trainer", "trainer:1.0")); err != nil {
+		t.Fatalf("Unexpected error when adding the PodTemplate: %v", err)
+	}
+	tfJob := newTFJobWithTemplateRef(1, 0, "trainer")
+
+	record := ctr.newRecord(tfJob)
+	if len(record.Images) != 1 || record.Images[0].Image != "trainer:1.0" {
+		t.Errorf("Expected the image of the referenced PodTemplate, got %+v", record.Images)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// initialRestartBackoff is the delay before recreating the pod of a replica
+// restarted once, which doubles with each consecutive restart.
+const initialRestartBackoff = 10 * time.Second
+
+// restartBackoffEnabled returns true if the recreation of the restarted pods
+// is backed off.
+func (tc *TFController) restartBackoffEnabled() bool {
+	return tc.maxRestartBackoff > 0
+}
+
+// restartBackoffDelay returns the delay before recreating the pod of a
+// replica restarted the given number of consecutive times, doubling from
+// initialRestartBackoff up to maxRestartBackoff.
+func (tc *TFController) restartBackoffDelay(restarts int32) time.Duration {
+	delay := initialRestartBackoff
+	for i := int32(1); i < restarts && delay < tc.maxRestartBackoff; i++ {
+		delay *= 2
+	}
+	if delay > tc.maxRestartBackoff {
+		delay = tc.maxRestartBackoff
+	}
+	return delay
+}
+
+// restartBackoffRemaining returns how much longer the recreation of the pod
+// of the replica, e.g. worker-0, is delayed by its restart backoff, 0 if it
+// may be recreated.
+func (tc *TFController) restartBackoffRemaining(tfjob *tfv1.TFJob, replica string) time.Duration {
+	if !tc.restartBackoffEnabled() {
+		return 0
+	}
+	backoff, ok := tfjob.Status.RestartBackoffs[replica]
+	if !ok || backoff.Restarts == 0 {
+		return 0
+	}
+	remaining := backoff.LastRestartTime.Add(tc.restartBackoffDelay(backoff.Restarts)).Sub(tc.clock.Now())
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// isRunningStably returns true if the tensorflow container of the pod has
+// been running for the restart backoff stability window.
+func (tc *TFController) isRunningStably(pod *v1.Pod) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == tfv1.DefaultContainerName && status.State.Running != nil {
+			return tc.clock.Since(status.State.Running.StartedAt.Time) >= tc.restartBackoffStabilityWindow
+		}
+	}
+	return false
+}
+
+// updateRestartBackoffs records the restarts of the replicas of the type in
+// the status of the tfjob, and resets the backoffs of the replicas whose pod
+// has been running stably. The tfjob is requeued once the first pod delayed
+// by its backoff may be recreated. The requeue is not rate limited, so that
+// it does not interfere with the backoff of the sync errors.
+func (tc *TFController) updateRestartBackoffs(tfjob *tfv1.TFJob, rt string, result *replicaPodsResult) {
+	if !tc.restartBackoffEnabled() {
+		return
+	}
+	for _, index := range result.stableIndexes {
+		delete(tfjob.Status.RestartBackoffs, genReplicaName(rt, strconv.Itoa(index)))
+	}
+	if len(tfjob.Status.RestartBackoffs) == 0 {
+		tfjob.Status.RestartBackoffs = nil
+	}
+	now := metav1.NewTime(tc.clock.Now())
+	for _, index := range result.restartedIndexes {
+		if tfjob.Status.RestartBackoffs == nil {
+			tfjob.Status.RestartBackoffs = make(map[string]tfv1.RestartBackoff)
+		}
+		replica := genReplicaName(rt, strconv.Itoa(index))
+		backoff := tfjob.Status.RestartBackoffs[replica]
+		backoff.Restarts++
+		backoff.LastRestartTime = now
+		tfjob.Status.RestartBackoffs[replica] = backoff
+	}
+	if result.restartDelay > 0 {
+		key, err := KeyFunc(tfjob)
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("couldn't get key for tfjob object %#v: %v", tfjob, err))
+			return
+		}
+		tc.WorkQueue.AddAfter(key, result.restartDelay)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func TestRestartBackoffDelay(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	ctr.maxRestartBackoff = time.Minute
+	expected := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, delay := range expected {
+		if actual := ctr.restartBackoffDelay(int32(i + 1)); actual != delay {
+			t.Errorf("Expected a delay of %v after %d restarts, got %v", delay, i+1, actual)
+		}
+	}
+}
+
+func TestRestartBackoff(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	fakeClock := clock.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctr.clock = fakeClock
+	ctr.maxRestartBackoff = time.Minute
+	ctr.restartBackoffStabilityWindow = 10 * time.Minute
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+	tfJob := testutil.NewTFJob(1, 0)
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].RestartPolicy = common.RestartPolicyExitCode
+
+	// setPod replaces the pod of worker 0 by one with the given state of the
+	// tensorflow container.
+	pod := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+	setPod := func(phase v1.PodPhase, state v1.ContainerState) {
+		pod = pod.DeepCopy()
+		pod.Status.Phase = phase
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{{Name: tfv1.DefaultContainerName, State: state}}
+		if err := ctr.podIndexer.Update(pod); err != nil {
+			t.Fatalf("Unexpected error when updating pod %v", err)
+		}
+	}
+	deletePod := func() {
+		if err := ctr.podIndexer.Delete(pod); err != nil {
+			t.Fatalf("Unexpected error when deleting pod %v", err)
+		}
+	}
+	// reconcile reconciles the tfjob and returns the number of pods created.
+	reconcile := func() int {
+		created := len(fakePodControl.Templates)
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+		}
+		return len(fakePodControl.Templates) - created
+	}
+	failed := v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 130}}
+
+	for restarts, delay := range []time.Duration{10 * time.Second, 20 * time.Second} {
+		setPod(v1.PodFailed, failed)
+		reconcile()
+		backoff := tfJob.Status.RestartBackoffs["worker-0"]
+		if backoff.Restarts != int32(restarts+1) || !backoff.LastRestartTime.Time.Equal(fakeClock.Now()) {
+			t.Errorf("Expected restart %d to be recorded, got %+v", restarts+1, backoff)
+		}
+		deletePod()
+
+		fakeClock.Step(delay - time.Second)
+		if created := reconcile(); created != 0 {
+			t.Errorf("Expected the pod not to be recreated before %v, got %d pods", delay, created)
+		}
+		fakeClock.Step(time.Second)
+		if created := reconcile(); created != 1 {
+			t.Errorf("Expected the pod to be recreated after %v, got %d pods", delay, created)
+		}
+	}
+
+	// The backoff is reset once the pod has been running for the stability
+	// window.
+	setPod(v1.PodRunning, v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: metav1.NewTime(fakeClock.Now())}})
+	reconcile()
+	if _, ok := tfJob.Status.RestartBackoffs["worker-0"]; !ok {
+		t.Errorf("Expected the backoff to be kept while the pod is running for less than the stability window")
+	}
+	fakeClock.Step(10 * time.Minute)
+	reconcile()
+	if tfJob.Status.RestartBackoffs != nil {
+		t.Errorf("Expected the backoff to be reset, got %v", tfJob.Status.RestartBackoffs)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"strings"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	v1 "k8s.io/api/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// updateRestartingCondition sets the Restarting condition of the tfjob when
+// its replicas are scaled once it started, until the pods of the indexes
+// scaled away are gone. The pods which exit with a retryable code set it when
+// the status is updated, so it is updated last not to be superseded by the
+// Running condition in the same sync. It is cleared by the Running condition
+// once all the replicas are running again, see restartSettled. The results
+// are the ones of the given replica types.
+func (tc *TFController) updateRestartingCondition(tfjob *tfv1.TFJob, rtypes []tfv1.TFReplicaType, results []*replicaPodsResult) {
+	scaled := tc.observeReplicas(tfjob, rtypes, results)
+	if isFailed(tfjob.Status.JobStatus) || isSucceeded(tfjob.Status.JobStatus) {
+		return
+	}
+	if !hasCondition(tfjob.Status.JobStatus, common.JobRunning) &&
+		!hasCondition(tfjob.Status.JobStatus, common.JobRestarting) {
+		// The replicas scaled before the tfjob runs are not restarts.
+		return
+	}
+
+	var changes []string
+	for i, rtype := range rtypes {
+		result := results[i]
+		if result == nil || result.released || ignoresFailures(tfjob, rtype) {
+			// The replicas whose failures are ignored do not restart the
+			// tfjob.
+			continue
+		}
+		if scaled[i] != "" {
+			changes = append(changes, scaled[i])
+		}
+		if len(result.scaledDown) > 0 {
+			changes = append(changes, fmt.Sprintf("%s pod(s) %s deleted by a scale-down", rtype, strings.Join(result.scaledDown, ", ")))
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	msg := fmt.Sprintf("TFJob %s is restarting: %s.", tfjob.Name, strings.Join(changes, "; "))
+	if !hasCondition(tfjob.Status.JobStatus, common.JobRestarting) {
+		tc.Recorder.Event(tfjob, v1.EventTypeWarning, tfJobRestartingReason, msg)
+	}
+	setCondition(&tfjob.Status.JobStatus, newCondition(common.JobRestarting, tfJobRestartingReason, msg))
+}
+
+// observeReplicas records the number of replicas of the given replica types
+// of the tfjob, and describes for each of them how it changed since the last
+// sync, "" if it did not. The replicas are not compared in the first sync
+// after the operator starts.
+func (tc *TFController) observeReplicas(tfjob *tfv1.TFJob, rtypes []tfv1.TFReplicaType, results []*replicaPodsResult) []string {
+	scaled := make([]string, len(rtypes))
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return scaled
+	}
+	tc.observedReplicasLock.Lock()
+	defer tc.observedReplicasLock.Unlock()
+	observed, ok := tc.observedReplicas[key]
+	if !ok {
+		observed = make(map[tfv1.TFReplicaType]int)
+		tc.observedReplicas[key] = observed
+	}
+	for i, rtype := range rtypes {
+		result := results[i]
+		if result == nil || result.released {
+			continue
+		}
+		if previous, ok := observed[rtype]; ok && previous != result.replicas {
+			scaled[i] = fmt.Sprintf("%s replicas scaled from %d to %d", rtype, previous, result.replicas)
+		}
+		observed[rtype] = result.replicas
+	}
+	return scaled
+}
+
+// forgetObservedReplicas forgets the replicas of the tfjob.
+func (tc *TFController) forgetObservedReplicas(key string) {
+	tc.observedReplicasLock.Lock()
+	defer tc.observedReplicasLock.Unlock()
+	delete(tc.observedReplicas, key)
+}
+
+// restartSettled returns true unless the tfjob is restarting and some of its
+// replicas are not running again yet, in which case it is not set back to
+// Running. The replica statuses must have been counted in this sync. The
+// replica types whose failures are ignored, the ones waiting for the training
+// and the ones released after it do not hold the tfjob back.
+func restartSettled(tfjob *tfv1.TFJob) bool {
+	if !hasCondition(tfjob.Status.JobStatus, common.JobRestarting) {
+		return true
+	}
+	for rtype, spec := range tfjob.Spec.TFReplicaSpecs {
+		if spec == nil || spec.Replicas == nil || ignoresFailures(tfjob, rtype) ||
+			isWaitingForTraining(tfjob, rtype) || isReleasedAfterTraining(tfjob, rtype) {
+			continue
+		}
+		status := tfjob.Status.ReplicaStatuses[common.ReplicaType(rtype)]
+		if status == nil {
+			// The replica type has not been reconciled in this sync.
+			continue
+		}
+		if status.Active+status.Succeeded < *spec.Replicas {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,206 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+	"testing"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+// newRestartingTestPod returns a worker pod of the tfjob in the given phase,
+// whose tensorflow container exited with the given code if it failed.
+func newRestartingTestPod(tfJob *tfv1.TFJob, index int, phase v1.PodPhase, exitCode int32, t *testing.T) *v1.Pod {
+	pod := testutil.NewPod(tfJob, testutil.LabelWorker, index, t)
+	pod.Status.Phase = phase
+	if phase == v1.PodFailed {
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+			Name: tfv1.DefaultContainerName,
+			State: v1.ContainerState{
+				Terminated: &v1.ContainerStateTerminated{ExitCode: exitCode},
+			},
+		}}
+	}
+	return pod
+}
+
+func TestRestartingCondition(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	defer ctr.WorkQueue.ShutDown()
+	tfJob := testutil.NewTFJob(2, 0)
+	spec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker]
+	spec.RestartPolicy = common.RestartPolicyExitCode
+	msg := "TFJob test-tfjob is running."
+	setCondition(&tfJob.Status.JobStatus, newCondition(common.JobRunning, tfJobRunningReason, msg))
+
+	terminating := newRestartingTestPod(tfJob, 2, v1.PodRunning, 0, t)
+	now := metav1.Now()
+	terminating.DeletionTimestamp = &now
+
+	type step struct {
+		description string
+		pods        []*v1.Pod
+		replicas    int32
+		// restarting is the expected status of the Restarting condition,
+		// whose message contains the given text when it is true.
+		restarting bool
+		message    string
+	}
+	steps := []step{
+		{
+			"The tfjob keeps running while its pods do",
+			[]*v1.Pod{
+				newRestartingTestPod(tfJob, 0, v1.PodRunning, 0, t),
+				newRestartingTestPod(tfJob, 1, v1.PodRunning, 0, t),
+			},
+			2, false, "",
+		},
+		{
+			"The tfjob restarts when a pod exits with a retryable code",
+			[]*v1.Pod{
+				newRestartingTestPod(tfJob, 0, v1.PodFailed, 130, t),
+				newRestartingTestPod(tfJob, 1, v1.PodRunning, 0, t),
+			},
+			2, true, "1 Worker replica(s) failed",
+		},
+		{
+			"The tfjob keeps restarting while the pod is recreated",
+			[]*v1.Pod{
+				newRestartingTestPod(tfJob, 1, v1.PodRunning, 0, t),
+			},
+			2, true, "1 Worker replica(s) failed",
+		},
+		{
+			"The tfjob keeps restarting while the recreated pod is pending",
+			[]*v1.Pod{
+				newRestartingTestPod(tfJob, 0, v1.PodPending, 0, t),
+				newRestartingTestPod(tfJob, 1, v1.PodRunning, 0, t),
+			},
+			2, true, "1 Worker replica(s) failed",
+		},
+		{
+			"The tfjob runs again once all its pods do",
+			[]*v1.Pod{
+				newRestartingTestPod(tfJob, 0, v1.PodRunning, 0, t),
+				newRestartingTestPod(tfJob, 1, v1.PodRunning, 0, t),
+			},
+			2, false, "",
+		},
+		{
+			"The tfjob restarts when it is scaled up",
+			[]*v1.Pod{
+				newRestartingTestPod(tfJob, 0, v1.PodRunning, 0, t),
+				newRestartingTestPod(tfJob, 1, v1.PodRunning, 0, t),
+			},
+			3, true, "Worker replicas scaled from 2 to 3",
+		},
+		{
+			"The tfjob keeps restarting while the new pod is pending",
+			[]*v1.Pod{
+				newRestartingTestPod(tfJob, 0, v1.PodRunning, 0, t),
+				newRestartingTestPod(tfJob, 1, v1.PodRunning, 0, t),
+				newRestartingTestPod(tfJob, 2, v1.PodPending, 0, t),
+			},
+			3, true, "Worker replicas scaled from 2 to 3",
+		},
+		{
+			"The tfjob runs again once the new pod does",
+			[]*v1.Pod{
+				newRestartingTestPod(tfJob, 0, v1.PodRunning, 0, t),
+				newRestartingTestPod(tfJob, 1, v1.PodRunning, 0, t),
+				newRestartingTestPod(tfJob, 2, v1.PodRunning, 0, t),
+			},
+			3, false, "",
+		},
+		{
+			"The tfjob restarts when it is scaled down",
+			[]*v1.Pod{
+				newRestartingTestPod(tfJob, 0, v1.PodRunning, 0, t),
+				newRestartingTestPod(tfJob, 1, v1.PodRunning, 0, t),
+				newRestartingTestPod(tfJob, 2, v1.PodRunning, 0, t),
+			},
+			2, true, "Worker replicas scaled from 3 to 2; Worker pod(s) worker-2 deleted by a scale-down",
+		},
+		{
+			"The tfjob keeps restarting while the pod scaled away terminates",
+			[]*v1.Pod{
+				newRestartingTestPod(tfJob, 0, v1.PodRunning, 0, t),
+				newRestartingTestPod(tfJob, 1, v1.PodRunning, 0, t),
+				terminating,
+			},
+			2, true, "Worker pod(s) worker-2 deleted by a scale-down",
+		},
+		{
+			"The tfjob runs again once the scale-down is done",
+			[]*v1.Pod{
+				newRestartingTestPod(tfJob, 0, v1.PodRunning, 0, t),
+				newRestartingTestPod(tfJob, 1, v1.PodRunning, 0, t),
+			},
+			2, false, "",
+		},
+	}
+	for _, s := range steps {
+		fakePodControl.Clear()
+		spec.Replicas = &s.replicas
+		if err := ctr.reconcileReplicaTypes(tfJob, map[string][]*v1.Pod{testutil.LabelWorker: s.pods}, nil); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling pods: %v", s.description, err)
+		}
+		if restarting := hasCondition(tfJob.Status.JobStatus, common.JobRestarting); restarting != s.restarting {
+			t.Fatalf("%s: expected the Restarting condition %v, got %v", s.description, s.restarting, tfJob.Status.Conditions)
+		}
+		if running := hasCondition(tfJob.Status.JobStatus, common.JobRunning); running == s.restarting {
+			t.Errorf("%s: expected the Running condition %v, got %v", s.description, !s.restarting, tfJob.Status.Conditions)
+		}
+		if !s.restarting {
+			continue
+		}
+		if condition := getCondition(tfJob.Status.JobStatus, common.JobRestarting); !strings.Contains(condition.Message, s.message) {
+			t.Errorf("%s: expected the Restarting condition message to contain %q, got %q", s.description, s.message, condition.Message)
+		}
+	}
+}
+
+func TestRestartingConditionBeforeRunning(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	defer ctr.WorkQueue.ShutDown()
+	tfJob := testutil.NewTFJob(2, 0)
+	spec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker]
+
+	// The replicas scaled before the tfjob runs do not restart it.
+	for _, replicas := range []int32{2, 3} {
+		spec.Replicas = &replicas
+		if err := ctr.reconcileReplicaTypes(tfJob, nil, nil); err != nil {
+			t.Fatalf("Unexpected error when reconciling pods: %v", err)
+		}
+	}
+	if len(fakePodControl.Templates) != 5 {
+		t.Fatalf("Expected 5 pods created, got %d", len(fakePodControl.Templates))
+	}
+	if hasCondition(tfJob.Status.JobStatus, common.JobRestarting) {
+		t.Errorf("Expected the tfjob not to be restarting, got %v", tfJob.Status.Conditions)
+	}
+
+	// The replicas observed by the deleted tfjob are forgotten.
+	ctr.forgetObservedReplicas(testutil.GetKey(tfJob, t))
+	if _, ok := ctr.observedReplicas[testutil.GetKey(tfJob, t)]; ok {
+		t.Errorf("Expected the replicas of the tfjob to be forgotten")
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+// tfJobInvalidSpecReason is added in a tfjob when it fails because its spec
+// is rejected by the operator.
+const tfJobInvalidSpecReason = "InvalidSpec"
+
+// respectsPodTemplateRestartPolicy returns true if the restart policy set in
+// the pod templates is kept instead of being overridden.
+func (tc *TFController) respectsPodTemplateRestartPolicy() bool {
+	return tc.podTemplateRestartPolicy == options.PodTemplateRestartPolicyRespect
+}
+
+// effectiveRestartPolicy returns the restart policy the pods of the replica
+// spec run with, from which their failures are interpreted. It is the one of
+// the replica spec, unless the pod template sets its own and it is respected.
+// ExitCode is kept with the Never template restart policy since the operator
+// recreates the failed pods as usual; with any other template restart policy
+// the kubelet restarts the containers in place and the exit codes are not
+// acted on.
+func (tc *TFController) effectiveRestartPolicy(spec *common.ReplicaSpec) common.RestartPolicy {
+	templatePolicy := spec.Template.Spec.RestartPolicy
+	if !tc.respectsPodTemplateRestartPolicy() || templatePolicy == v1.RestartPolicy("") {
+		return spec.RestartPolicy
+	}
+	if spec.RestartPolicy == common.RestartPolicyExitCode && templatePolicy == v1.RestartPolicyNever {
+		return common.RestartPolicyExitCode
+	}
+	return common.RestartPolicy(templatePolicy)
+}
+
+// restartPolicyPreventsCompletion returns why the pods of the replica type
+// keep the tfjob from ever completing with the given restart policy, or an
+// empty string otherwise. The kubelet restarts the containers of the pods with
+// the Always restart policy even once they have succeeded, so the replicas
+// whose success completes the tfjob, i.e. the ones of the leader, or all the
+// workers with the AllWorkers success policy, never succeed.
+func restartPolicyPreventsCompletion(tfjob *tfv1.TFJob, rt string, policy v1.RestartPolicy) string {
+	if policy != v1.RestartPolicyAlways {
+		return ""
+	}
+	completes := strings.EqualFold(string(leaderReplicaType(tfjob)), rt) ||
+		(requiresAllWorkers(tfjob) && strings.EqualFold(string(tfv1.TFReplicaTypeWorker), rt))
+	if !completes {
+		return ""
+	}
+	return fmt.Sprintf("The %s pods of TFJob %s restart with the %s restart policy even once they have succeeded, so the tfjob never completes. Use OnFailure, Never or ExitCode instead.",
+		rt, tfjob.Name, policy)
+}
+
+// invalidPodTemplateRestartPolicy returns why the tfjob is rejected if the
+// operator does not allow the pod templates to set a restart policy and some
+// do, or an empty string otherwise.
+func (tc *TFController) invalidPodTemplateRestartPolicy(tfjob *tfv1.TFJob) string {
+	if tc.podTemplateRestartPolicy != options.PodTemplateRestartPolicyError {
+		return ""
+	}
+	var rtypes []string
+	for rtype, spec := range tfjob.Spec.TFReplicaSpecs {
+		if spec.Template.Spec.RestartPolicy != v1.RestartPolicy("") {
+			rtypes = append(rtypes, string(rtype))
+		}
+	}
+	if len(rtypes) == 0 {
+		return ""
+	}
+	sort.Strings(rtypes)
+	return fmt.Sprintf("TFJob %s is invalid: the pod templates of %s set a restart policy, set it in the replica specs instead.",
+		tfjob.Name, strings.Join(rtypes, ", "))
+}
+
+// failInvalidSpec leaves a failed condition in the tfjob whose spec is invalid.
+func (tc *TFController) failInvalidSpec(tfjob *tfv1.TFJob, msg string) error {
+	return tc.failWithReason(tfjob, tfJobInvalidSpecReason, msg)
+}
+
+// failWithReason leaves a failed condition with the given reason in the tfjob
+// which cannot run.
+func (tc *TFController) failWithReason(tfjob *tfv1.TFJob, reason, msg string) error {
+	tflogger.LoggerForJob(tfjob).Warn(msg)
+	tc.Recorder.Event(tfjob, v1.EventTypeWarning, reason, msg)
+	if tfjob.Status.CompletionTime == nil {
+		now := metav1.Now()
+		tfjob.Status.CompletionTime = &now
+	}
+	if err := updateTFJobConditions(tfjob, common.JobFailed, reason, msg); err != nil {
+		tflogger.LoggerForJob(tfjob).Infof("Append tfjob condition error: %v", err)
+		return err
+	}
+	tfJobsFailureCount.Inc()
+	return nil
+}
@@ -0,0 +1,220 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+	"testing"
+
+	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
+	v1 "k8s.io/api/core/v1"
+	kubeclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/kubernetes/pkg/controller"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
+)
+
+func newRestartPolicyTestController(mode string) (*TFController, *controller.FakePodControl, *record.FakeRecorder) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	option := options.ServerOption{
+		PodTemplateRestartPolicy: mode,
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, _, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, option)
+	fakePodControl := &controller.FakePodControl{}
+	ctr.PodControl = fakePodControl
+	ctr.ServiceControl = &control.FakeServiceControl{}
+	recorder := record.NewFakeRecorder(10)
+	ctr.Recorder = recorder
+	return ctr, fakePodControl, recorder
+}
+
+// newTFJobWithTemplateRestartPolicy returns a tfjob whose worker pod template
+// sets the given restart policy.
+func newTFJobWithTemplateRestartPolicy(specPolicy common.RestartPolicy, templatePolicy v1.RestartPolicy) *tfv1.TFJob {
+	tfJob := testutil.NewTFJob(1, 0)
+	spec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker]
+	spec.RestartPolicy = specPolicy
+	spec.Template.Spec.RestartPolicy = templatePolicy
+	return tfJob
+}
+
+func TestPodTemplateRestartPolicy(t *testing.T) {
+	type testCase struct {
+		mode                  string
+		expectedRestartPolicy v1.RestartPolicy
+		expectedEvent         bool
+	}
+	testCases := []testCase{
+		{mode: options.PodTemplateRestartPolicyWarn, expectedRestartPolicy: v1.RestartPolicyOnFailure, expectedEvent: true},
+		{mode: options.PodTemplateRestartPolicyRespect, expectedRestartPolicy: v1.RestartPolicyNever, expectedEvent: false},
+	}
+	for _, c := range testCases {
+		ctr, fakePodControl, recorder := newRestartPolicyTestController(c.mode)
+		tfJob := newTFJobWithTemplateRestartPolicy(common.RestartPolicyOnFailure, v1.RestartPolicyNever)
+		spec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker]
+		if err := ctr.createNewPod(tfJob, testutil.LabelWorker, "0", spec, false); err != nil {
+			t.Errorf("%s: unexpected error when creating the pod: %v", c.mode, err)
+		}
+		if actual := fakePodControl.Templates[0].Spec.RestartPolicy; actual != c.expectedRestartPolicy {
+			t.Errorf("%s: expected restart policy %s, got %s", c.mode, c.expectedRestartPolicy, actual)
+		}
+		if actual := len(recorder.Events) == 1; actual != c.expectedEvent {
+			t.Errorf("%s: expected a warning event %v, got %d events", c.mode, c.expectedEvent, len(recorder.Events))
+		}
+	}
+
+	// The error mode fails the tfjob before creating any pod.
+	ctr, fakePodControl, _ := newRestartPolicyTestController(options.PodTemplateRestartPolicyError)
+	var actual *tfv1.TFJob
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		actual = tfJob
+		return nil
+	}
+	tfJob := newTFJobWithTemplateRestartPolicy(common.RestartPolicyOnFailure, v1.RestartPolicyNever)
+	unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+		t.Errorf("Failed to add tfjob to tfJobIndexer: %v", err)
+	}
+	if _, err := ctr.syncTFJob(testutil.GetKey(tfJob, t)); err != nil {
+		t.Errorf("Unexpected error when syncing the TFJob: %v", err)
+	}
+	if len(fakePodControl.Templates) != 0 {
+		t.Errorf("Expected no pod creation, got %d", len(fakePodControl.Templates))
+	}
+	if actual == nil || !testutil.CheckCondition(actual, common.JobFailed, tfJobInvalidSpecReason) {
+		t.Errorf("Expected the TFJob to fail with an invalid spec")
+	}
+}
+
+func TestRespectedRestartPolicyFailures(t *testing.T) {
+	// The kubelet restarts the containers of the pods in place, instead of
+	// the operator recreating them on ExitCode.
+	tfJob := newTFJobWithTemplateRestartPolicy(common.RestartPolicyExitCode, v1.RestartPolicyOnFailure)
+	backoffLimit := int32(2)
+	tfJob.Spec.BackoffLimit = &backoffLimit
+
+	restarted := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+	restarted.Status.Phase = v1.PodRunning
+	restarted.Status.ContainerStatuses = []v1.ContainerStatus{{
+		Name:         tfv1.DefaultContainerName,
+		RestartCount: 3,
+	}}
+	failed := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+	failed.Status.Phase = v1.PodFailed
+	failed.Status.ContainerStatuses = []v1.ContainerStatus{{
+		Name: tfv1.DefaultContainerName,
+		State: v1.ContainerState{
+			Terminated: &v1.ContainerStateTerminated{ExitCode: 130},
+		},
+	}}
+
+	type testCase struct {
+		mode                 string
+		expectedPastBackoff  bool
+		expectedPodDeletions int
+	}
+	testCases := []testCase{
+		{mode: options.PodTemplateRestartPolicyWarn, expectedPastBackoff: false, expectedPodDeletions: 1},
+		{mode: options.PodTemplateRestartPolicyRespect, expectedPastBackoff: true, expectedPodDeletions: 0},
+	}
+	for _, c := range testCases {
+		ctr, fakePodControl, _ := newRestartPolicyTestController(c.mode)
+		pastBackoff, err := ctr.pastBackoffLimit(tfJob, []*v1.Pod{restarted})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.mode, err)
+		}
+		if pastBackoff != c.expectedPastBackoff {
+			t.Errorf("%s: expected past backoff limit %v, got %v", c.mode, c.expectedPastBackoff, pastBackoff)
+		}
+
+		if err := ctr.reconcileReplicaTypes(tfJob, map[string][]*v1.Pod{testutil.LabelWorker: {failed}}, nil); err != nil {
+			t.Errorf("%s: unexpected error when reconciling pods: %v", c.mode, err)
+		}
+		if len(fakePodControl.DeletePodName) != c.expectedPodDeletions {
+			t.Errorf("%s: expected %d pod deletions, got %v", c.mode, c.expectedPodDeletions, fakePodControl.DeletePodName)
+		}
+	}
+}
+
+func TestRestartPolicyPreventsCompletion(t *testing.T) {
+	allWorkers := tfv1.SuccessPolicyAllWorkers
+	withChief := testutil.NewTFJobWithChief(2, 1)
+	chiefs := int32(1)
+	withChief.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeChief].Replicas = &chiefs
+	type testCase struct {
+		description   string
+		tfJob         *tfv1.TFJob
+		rtype         tfv1.TFReplicaType
+		successPolicy *tfv1.SuccessPolicy
+		expectedEvent bool
+	}
+	testCases := []testCase{
+		{"The workers complete the tfjob without a chief", testutil.NewTFJob(2, 1), tfv1.TFReplicaTypeWorker, nil, true},
+		{"The PS never complete the tfjob", testutil.NewTFJob(2, 1), tfv1.TFReplicaTypePS, nil, false},
+		{"The chief completes the tfjob", withChief, tfv1.TFReplicaTypeChief, nil, true},
+		{"The workers do not complete the tfjob with a chief", withChief, tfv1.TFReplicaTypeWorker, nil, false},
+		{"All the workers complete the tfjob with the AllWorkers success policy", withChief, tfv1.TFReplicaTypeWorker, &allWorkers, true},
+	}
+	for _, c := range testCases {
+		for _, policy := range []common.RestartPolicy{common.RestartPolicyAlways, common.RestartPolicyOnFailure} {
+			ctr, _, recorder := newRestartPolicyTestController(options.PodTemplateRestartPolicyWarn)
+			tfJob := c.tfJob.DeepCopy()
+			tfJob.Spec.SuccessPolicy = c.successPolicy
+			spec := tfJob.Spec.TFReplicaSpecs[c.rtype]
+			spec.RestartPolicy = policy
+			if err := ctr.createNewPod(tfJob, strings.ToLower(string(c.rtype)), "0", spec, false); err != nil {
+				t.Fatalf("%s: unexpected error when creating the pod: %v", c.description, err)
+			}
+			expected := c.expectedEvent && policy == common.RestartPolicyAlways
+			if actual := countEvents(recorder, restartPolicyPreventsCompletionReason) == 1; actual != expected {
+				t.Errorf("%s: expected a warning event %v with the %s restart policy, got %v", c.description, expected, policy, actual)
+			}
+		}
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// SecurityContextKey is the key of the security context ConfigMap holding
+// the security context defaults in YAML.
+const SecurityContextKey = "securityContext"
+
+// tfJobSecurityContextConflictReason is added in a tfjob rejected for setting
+// a security context which conflicts with the defaults enforced by the
+// operator.
+const tfJobSecurityContextConflictReason = "SecurityContextConflict"
+
+// securityContextDefaults is the pod and container security contexts merged
+// into the pods.
+type securityContextDefaults struct {
+	PodSecurityContext       *v1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	ContainerSecurityContext *v1.SecurityContext    `json:"containerSecurityContext,omitempty"`
+}
+
+// securityContextConfig is the security context defaults merged into the
+// pods of the tfjobs, e.g. to run them as non-root with a fixed fsGroup.
+type securityContextConfig struct {
+	securityContextDefaults
+	// ReplicaTypes is the defaults of the pods of the given replica types,
+	// whose fields take precedence over the defaults of all the pods.
+	ReplicaTypes map[string]securityContextDefaults `json:"replicaTypes,omitempty"`
+	// ExemptNamespaceSelector selects the namespaces whose tfjobs get no
+	// defaults.
+	ExemptNamespaceSelector *metav1.LabelSelector `json:"exemptNamespaceSelector,omitempty"`
+
+	exemptNamespaces labels.Selector
+}
+
+// WatchSecurityContext sets the informer of the ConfigMap holding the security
+// context defaults, so that they are updated along with the ConfigMap, and the
+// informer of the namespaces which may be exempted from them. The caller is
+// responsible for starting the informers.
+func (tc *TFController) WatchSecurityContext(configMapInformer coreinformers.ConfigMapInformer, namespaceInformer coreinformers.NamespaceInformer, namespace, name string) {
+	configMapInformer.Informer().AddEventHandler(newConfigMapEventHandler(namespace, name, tc.setSecurityContextConfig, func() {
+		log.Warnf("Security context ConfigMap %s/%s deleted, no security context defaults are applied", namespace, name)
+		tc.securityContextLock.Lock()
+		defer tc.securityContextLock.Unlock()
+		tc.securityContextConfig = nil
+	}))
+	tc.securityContextInformerSynced = configMapInformer.Informer().HasSynced
+	tc.namespaceLister = namespaceInformer.Lister()
+	tc.namespaceInformerSynced = namespaceInformer.Informer().HasSynced
+}
+
+// setSecurityContextConfig sets the security context defaults from the
+// ConfigMap. The previous defaults are kept if it cannot be parsed.
+func (tc *TFController) setSecurityContextConfig(configMap *v1.ConfigMap) {
+	config, err := parseSecurityContextConfig(configMap)
+	if err != nil {
+		log.Errorf("Failed to parse the security context ConfigMap %s/%s, the previous defaults are kept: %v",
+			configMap.Namespace, configMap.Name, err)
+		return
+	}
+	log.Infof("Security context defaults updated from ConfigMap %s/%s", configMap.Namespace, configMap.Name)
+	tc.securityContextLock.Lock()
+	defer tc.securityContextLock.Unlock()
+	tc.securityContextConfig = config
+}
+
+// parseSecurityContextConfig returns the security context defaults of the
+// ConfigMap, or nil if it is empty.
+func parseSecurityContextConfig(configMap *v1.ConfigMap) (*securityContextConfig, error) {
+	data, ok := configMap.Data[SecurityContextKey]
+	if !ok || data == "" {
+		return nil, nil
+	}
+	config := &securityContextConfig{}
+	if err := yaml.Unmarshal([]byte(data), config); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", SecurityContextKey, err)
+	}
+	if config.ExemptNamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(config.ExemptNamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: exemptNamespaceSelector: %v", SecurityContextKey, err)
+		}
+		config.exemptNamespaces = selector
+	}
+	return config, nil
+}
+
+// getSecurityContextDefaults returns the security context defaults of the
+// pods of the replica type of the tfjob, or false if there are none or its
+// namespace is exempted.
+func (tc *TFController) getSecurityContextDefaults(tfjob *tfv1.TFJob, rt string) (securityContextDefaults, bool) {
+	tc.securityContextLock.Lock()
+	config := tc.securityContextConfig
+	tc.securityContextLock.Unlock()
+	if config == nil || tc.isExemptNamespace(config, tfjob.Namespace) {
+		return securityContextDefaults{}, false
+	}
+
+	defaults := securityContextDefaults{
+		PodSecurityContext:       config.PodSecurityContext.DeepCopy(),
+		ContainerSecurityContext: config.ContainerSecurityContext.DeepCopy(),
+	}
+	for rtype, replicaDefaults := range config.ReplicaTypes {
+		if !strings.EqualFold(rtype, rt) {
+			continue
+		}
+		if replicaDefaults.PodSecurityContext != nil {
+			podSecurityContext := replicaDefaults.PodSecurityContext.DeepCopy()
+			mergePodSecurityContext(podSecurityContext, defaults.PodSecurityContext)
+			defaults.PodSecurityContext = podSecurityContext
+		}
+		if replicaDefaults.ContainerSecurityContext != nil {
+			containerSecurityContext := replicaDefaults.ContainerSecurityContext.DeepCopy()
+			mergeContainerSecurityContext(containerSecurityContext, defaults.ContainerSecurityContext)
+			defaults.ContainerSecurityContext = containerSecurityContext
+		}
+	}
+	return defaults, true
+}
+
+// isExemptNamespace returns true if the labels of the namespace match the
+// exempted namespaces of the security context defaults.
+func (tc *TFController) isExemptNamespace(config *securityContextConfig, namespace string) bool {
+	if tc.namespaceLister == nil || config.exemptNamespaces == nil {
+		return false
+	}
+	ns, err := tc.namespaceLister.Get(namespace)
+	if err != nil {
+		log.Warnf("Failed to get namespace %s, the security context defaults are applied: %v", namespace, err)
+		return false
+	}
+	return config.exemptNamespaces.Matches(labels.Set(ns.Labels))
+}
+
+// applySecurityContextDefaults merges the security context defaults of the
+// replica type into the pod template and all its containers. The values the
+// pod template specifies take precedence, the tfjobs setting conflicting
+// values are rejected beforehand in strict mode.
+func (tc *TFController) applySecurityContextDefaults(podTemplate *v1.PodTemplateSpec, tfjob *tfv1.TFJob, rt string) {
+	defaults, ok := tc.getSecurityContextDefaults(tfjob, rt)
+	if !ok {
+		return
+	}
+	mergeSecurityContextDefaults(podTemplate, defaults)
+}
+
+// mergeSecurityContextDefaults merges the defaults into the pod template and
+// returns the fields of the pod template set to a different value.
+func mergeSecurityContextDefaults(podTemplate *v1.PodTemplateSpec, defaults securityContextDefaults) []string {
+	var conflicts []string
+	if defaults.PodSecurityContext != nil {
+		if podTemplate.Spec.SecurityContext == nil {
+			podTemplate.Spec.SecurityContext = &v1.PodSecurityContext{}
+		}
+		for _, field := range mergePodSecurityContext(podTemplate.Spec.SecurityContext, defaults.PodSecurityContext) {
+			conflicts = append(conflicts, "securityContext."+field)
+		}
+	}
+	if defaults.ContainerSecurityContext != nil {
+		merge := func(containers []v1.Container) {
+			for i := range containers {
+				if containers[i].SecurityContext == nil {
+					containers[i].SecurityContext = &v1.SecurityContext{}
+				}
+				for _, field := range mergeContainerSecurityContext(containers[i].SecurityContext, defaults.ContainerSecurityContext) {
+					conflicts = append(conflicts, fmt.Sprintf("%s.securityContext.%s", containers[i].Name, field))
+				}
+			}
+		}
+		merge(podTemplate.Spec.InitContainers)
+		merge(podTemplate.Spec.Containers)
+	}
+	return conflicts
+}
+
+// securityContextConflicts returns why the tfjob is rejected if the security
+// context defaults are enforced and its pod templates or its sidecars set
+// different values.
+func (tc *TFController) securityContextConflicts(tfjob *tfv1.TFJob) string {
+	if !tc.securityContextStrict {
+		return ""
+	}
+	fields := sets.NewString()
+	for rtype, spec := range tfjob.Spec.TFReplicaSpecs {
+		defaults, ok := tc.getSecurityContextDefaults(tfjob, strings.ToLower(string(rtype)))
+		if !ok {
+			return ""
+		}
+		podTemplate := spec.Template.DeepCopy()
+		podTemplate.Spec.Containers = append(podTemplate.Spec.Containers, tfjob.Spec.Sidecars...)
+		for _, field := range mergeSecurityContextDefaults(podTemplate, defaults) {
+			fields.Insert(fmt.Sprintf("%s %s", rtype, field))
+		}
+	}
+	if fields.Len() == 0 {
+		return ""
+	}
+	return fmt.Sprintf("TFJob %s is rejected: %s conflict with the security context enforced by the operator.",
+		tfjob.Name, strings.Join(fields.List(), ", "))
+}
+
+// securityContextMerge records the fields of a security context set to a
+// different value than the default.
+type securityContextMerge struct {
+	conflicts []string
+}
+
+// unset returns true if the field is unset and takes the default value, and
+// records the field if it is set to a different value.
+func (m *securityContextMerge) unset(name string, current, value interface{}) bool {
+	if isUnsetField(value) {
+		return false
+	}
+	if isUnsetField(current) {
+		return true
+	}
+	if !apiequality.Semantic.DeepEqual(current, value) {
+		m.conflicts = append(m.conflicts, name)
+	}
+	return false
+}
+
+// isUnsetField returns true if the pointer or the slice field is unset.
+func isUnsetField(field interface{}) bool {
+	value := reflect.ValueOf(field)
+	return value.IsNil() || value.Kind() == reflect.Slice && value.Len() == 0
+}
+
+// mergePodSecurityContext fills the unset fields of the pod security context
+// with the defaults, and returns the fields set to a different value.
+func mergePodSecurityContext(sc, defaults *v1.PodSecurityContext) []string {
+	if defaults == nil {
+		return nil
+	}
+	m := &securityContextMerge{}
+	if m.unset("seLinuxOptions", sc.SELinuxOptions, defaults.SELinuxOptions) {
+		sc.SELinuxOptions = defaults.SELinuxOptions
+	}
+	if m.unset("runAsUser", sc.RunAsUser, defaults.RunAsUser) {
+		sc.RunAsUser = defaults.RunAsUser
+	}
+	if m.unset("runAsGroup", sc.RunAsGroup, defaults.RunAsGroup) {
+		sc.RunAsGroup = defaults.RunAsGroup
+	}
+	if m.unset("runAsNonRoot", sc.RunAsNonRoot, defaults.RunAsNonRoot) {
+		sc.RunAsNonRoot = defaults.RunAsNonRoot
+	}
+	if m.unset("supplementalGroups", sc.SupplementalGroups, defaults.SupplementalGroups) {
+		sc.SupplementalGroups = defaults.SupplementalGroups
+	}
+	if m.unset("fsGroup", sc.FSGroup, defaults.FSGroup) {
+		sc.FSGroup = defaults.FSGroup
+	}
+	if m.unset("sysctls", sc.Sysctls, defaults.Sysctls) {
+		sc.Sysctls = defaults.Sysctls
+	}
+	return m.conflicts
+}
+
+// mergeContainerSecurityContext fills the unset fields of the container
+// security context with the defaults, and returns the fields set to a
+// different value.
+func mergeContainerSecurityContext(sc, defaults *v1.SecurityContext) []string {
+	if defaults == nil {
+		return nil
+	}
+	m := &securityContextMerge{}
+	if m.unset("capabilities", sc.Capabilities, defaults.Capabilities) {
+		sc.Capabilities = defaults.Capabilities
+	}
+	if m.unset("privileged", sc.Privileged, defaults.Privileged) {
+		sc.Privileged = defaults.Privileged
+	}
+	if m.unset("seLinuxOptions", sc.SELinuxOptions, defaults.SELinuxOptions) {
+		sc.SELinuxOptions = defaults.SELinuxOptions
+	}
+	if m.unset("runAsUser", sc.RunAsUser, defaults.RunAsUser) {
+		sc.RunAsUser = defaults.RunAsUser
+	}
+	if m.unset("runAsGroup", sc.RunAsGroup, defaults.RunAsGroup) {
+		sc.RunAsGroup = defaults.RunAsGroup
+	}
+	if m.unset("runAsNonRoot", sc.RunAsNonRoot, defaults.RunAsNonRoot) {
+		sc.RunAsNonRoot = defaults.RunAsNonRoot
+	}
+	if m.unset("readOnlyRootFilesystem", sc.ReadOnlyRootFilesystem, defaults.ReadOnlyRootFilesystem) {
+		sc.ReadOnlyRootFilesystem = defaults.ReadOnlyRootFilesystem
+	}
+	if m.unset("allowPrivilegeEscalation", sc.AllowPrivilegeEscalation, defaults.AllowPrivilegeEscalation) {
+		sc.AllowPrivilegeEscalation = defaults.AllowPrivilegeEscalation
+	}
+	if m.unset("procMount", sc.ProcMount, defaults.ProcMount) {
+		sc.ProcMount = defaults.ProcMount
+	}
+	return m.conflicts
+}
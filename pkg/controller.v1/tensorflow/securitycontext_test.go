@@ -0,0 +1,182 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+	"testing"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/kubernetes/pkg/controller"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+const testSecurityContext = `
+podSecurityContext:
+  runAsNonRoot: true
+  fsGroup: 2000
+containerSecurityContext:
+  allowPrivilegeEscalation: false
+replicaTypes:
+  PS:
+    podSecurityContext:
+      fsGroup: 3000
+exemptNamespaceSelector:
+  matchLabels:
+    security/exempt: "true"
+`
+
+func newSecurityContextConfigMap(data string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "security-context", Namespace: "kubeflow"},
+		Data:       map[string]string{SecurityContextKey: data},
+	}
+}
+
+func newSecurityContextTestController(t *testing.T, strict bool, namespaces ...*v1.Namespace) (*TFController, *controller.FakePodControl) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+	ctr.securityContextStrict = strict
+	ctr.setSecurityContextConfig(newSecurityContextConfigMap(testSecurityContext))
+	if ctr.securityContextConfig == nil {
+		t.Fatalf("Expected the security context defaults to be parsed")
+	}
+	namespaceIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ns := range namespaces {
+		if err := namespaceIndexer.Add(ns); err != nil {
+			t.Fatalf("Failed to add the namespace: %v", err)
+		}
+	}
+	ctr.namespaceLister = corelisters.NewNamespaceLister(namespaceIndexer)
+	return ctr, fakePodControl
+}
+
+func TestMergeSecurityContextDefaults(t *testing.T) {
+	ctr, _ := newSecurityContextTestController(t, false)
+	tfJob := testutil.NewTFJob(1, 1)
+	runAsRoot := false
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template.Spec.SecurityContext = &v1.PodSecurityContext{RunAsNonRoot: &runAsRoot}
+
+	type testCase struct {
+		rtype                tfv1.TFReplicaType
+		expectedRunAsNonRoot bool
+		expectedFSGroup      int64
+	}
+	testCases := []testCase{
+		// The values of the pod template take precedence.
+		{tfv1.TFReplicaTypeWorker, false, 2000},
+		// The defaults of the replica type take precedence over the others.
+		{tfv1.TFReplicaTypePS, true, 3000},
+	}
+	for _, c := range testCases {
+		podTemplate := tfJob.Spec.TFReplicaSpecs[c.rtype].Template.DeepCopy()
+		ctr.applySecurityContextDefaults(podTemplate, tfJob, strings.ToLower(string(c.rtype)))
+		sc := podTemplate.Spec.SecurityContext
+		if sc == nil || sc.RunAsNonRoot == nil || *sc.RunAsNonRoot != c.expectedRunAsNonRoot || sc.FSGroup == nil || *sc.FSGroup != c.expectedFSGroup {
+			t.Errorf("%s: expected runAsNonRoot %v and fsGroup %d, got %+v", c.rtype, c.expectedRunAsNonRoot, c.expectedFSGroup, sc)
+		}
+		container := findContainer(podTemplate.Spec.Containers, tfv1.DefaultContainerName)
+		if container.SecurityContext == nil || container.SecurityContext.AllowPrivilegeEscalation == nil ||
+			*container.SecurityContext.AllowPrivilegeEscalation {
+			t.Errorf("%s: expected the container to disallow privilege escalation, got %+v", c.rtype, container.SecurityContext)
+		}
+	}
+	if sc := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template.Spec.SecurityContext; sc.FSGroup != nil {
+		t.Errorf("Expected the tfjob to be left unchanged, got %+v", sc)
+	}
+}
+
+func TestSecurityContextExemptNamespace(t *testing.T) {
+	ctr, _ := newSecurityContextTestController(t, true,
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "research", Labels: map[string]string{"security/exempt": "true"}}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "training"}})
+
+	type testCase struct {
+		namespace        string
+		expectedDefaults bool
+	}
+	testCases := []testCase{
+		{"research", false},
+		{"training", true},
+		// The defaults are applied when the namespace cannot be found.
+		{"unknown", true},
+	}
+	for _, c := range testCases {
+		tfJob := testutil.NewTFJobWithNamespace(1, 0, c.namespace)
+		podTemplate := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template.DeepCopy()
+		ctr.applySecurityContextDefaults(podTemplate, tfJob, testutil.LabelWorker)
+		if actual := podTemplate.Spec.SecurityContext != nil; actual != c.expectedDefaults {
+			t.Errorf("%s: expected the defaults applied %v, got %+v", c.namespace, c.expectedDefaults, podTemplate.Spec.SecurityContext)
+		}
+	}
+
+	// The tfjobs of the exempted namespaces are not rejected in strict mode.
+	tfJob := testutil.NewTFJobWithNamespace(1, 0, "research")
+	privileged := true
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template.Spec.Containers[0].SecurityContext = &v1.SecurityContext{
+		AllowPrivilegeEscalation: &privileged,
+	}
+	if msg := ctr.securityContextConflicts(tfJob); msg != "" {
+		t.Errorf("Expected the tfjob of the exempted namespace not to be rejected, got %q", msg)
+	}
+}
+
+func TestSecurityContextStrict(t *testing.T) {
+	privileged := true
+	fsGroup := int64(2000)
+
+	type testCase struct {
+		description      string
+		strict           bool
+		securityContext  *v1.PodSecurityContext
+		sidecar          bool
+		expectedRejected bool
+	}
+	testCases := []testCase{
+		{"The conflicts are kept without strict mode", false, nil, true, false},
+		{"The values equal to the defaults are accepted", true, &v1.PodSecurityContext{FSGroup: &fsGroup}, false, false},
+		{"A conflicting sidecar is rejected", true, nil, true, true},
+	}
+	for _, c := range testCases {
+		ctr, fakePodControl := newSecurityContextTestController(t, c.strict)
+		tfJob := testutil.NewTFJob(2, 0)
+		tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template.Spec.SecurityContext = c.securityContext
+		if c.sidecar {
+			tfJob.Spec.Sidecars = []v1.Container{{
+				Name:            "profiler",
+				Image:           "profiler:1.0",
+				SecurityContext: &v1.SecurityContext{AllowPrivilegeEscalation: &privileged},
+			}}
+		}
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", c.description, err)
+		}
+		rejected := testutil.CheckCondition(tfJob, common.JobFailed, tfJobSecurityContextConflictReason)
+		if rejected != c.expectedRejected {
+			t.Errorf("%s: expected the tfjob rejected %v, got %v", c.description, c.expectedRejected, tfJob.Status.Conditions)
+		}
+		if created := len(fakePodControl.Templates) == 2; created == c.expectedRejected {
+			t.Errorf("%s: expected the pods created %v, got %d pods", c.description, !c.expectedRejected, len(fakePodControl.Templates))
+		}
+	}
+}
@@ -17,12 +17,17 @@ package tensorflow
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	common "github.com/kubeflow/common/job_controller/api/v1"
 	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
@@ -30,6 +35,52 @@ import (
 	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
 )
 
+const (
+	// serviceConflictReason is the warning reason when a service which is not
+	// controlled by the tfjob has the name of one of its services.
+	serviceConflictReason = "ServiceConflict"
+	// serviceDriftedReason is the warning reason when a service of the tfjob
+	// no longer selects its pod or exposes its port, and is recreated.
+	serviceDriftedReason = "ServiceDrifted"
+	// outOfRangeServiceReason is the warning reason when a service is deleted
+	// because its index is out of the range of the replicas.
+	outOfRangeServiceReason = "OutOfRangeService"
+)
+
+// invalidServiceNames returns why the tfjob is rejected if the services of the
+// tfjobs are not created and the DNS names TF_CONFIG gives to its replicas
+// cannot be served by the DNS its users manage, or an empty string otherwise.
+// Each replica is addressed by the name its service would have, which must be
+// a valid service name, and the pods must not set a hostname or a subdomain
+// under which they would be reached instead.
+func (tc *TFController) invalidServiceNames(tfjob *tfv1.TFJob) string {
+	if !tc.disableServiceCreation {
+		return ""
+	}
+	rtypes := make([]string, 0, len(tfjob.Spec.TFReplicaSpecs))
+	for rtype := range tfjob.Spec.TFReplicaSpecs {
+		rtypes = append(rtypes, string(rtype))
+	}
+	sort.Strings(rtypes)
+	for _, rtype := range rtypes {
+		spec := tfjob.Spec.TFReplicaSpecs[tfv1.TFReplicaType(rtype)]
+		if spec.Template.Spec.Hostname != "" || spec.Template.Spec.Subdomain != "" {
+			return fmt.Sprintf("TFJob %s is invalid: the pod template of %s sets a hostname or a subdomain, "+
+				"but TF_CONFIG addresses its replicas as <tfjob>-<type>-<index>.<namespace>.svc.", tfjob.Name, rtype)
+		}
+		if spec.Replicas == nil || *spec.Replicas == 0 {
+			continue
+		}
+		// The name of the last replica is the longest.
+		name := tc.nameTemplate.GenName(tfjob.Name, strings.ToLower(rtype), strconv.Itoa(int(*spec.Replicas)-1))
+		if errs := validation.IsDNS1035Label(name); len(errs) > 0 {
+			return fmt.Sprintf("TFJob %s is invalid: the name %s TF_CONFIG gives to the replicas of %s is not a valid service name: %s.",
+				tfjob.Name, name, rtype, strings.Join(errs, ", "))
+		}
+	}
+	return ""
+}
+
 // reconcileServices checks and updates services for each given TFReplicaSpec.
 // It will requeue the tfjob in case of an error while creating/deleting services.
 func (tc *TFController) reconcileServices(
@@ -49,69 +100,201 @@ func (tc *TFController) reconcileServices(
 	}
 
 	serviceSlices := tc.GetServiceSlices(services, replicas, tflogger.LoggerForReplica(tfjob, rt))
+	// The indexes whose service needs to be created.
+	var missing []int
+	// The services which differ from the desired ones, and why.
+	var drifted []*v1.Service
+	var drifts []string
 
 	for index, serviceSlice := range serviceSlices {
 		if len(serviceSlice) > 1 {
 			tflogger.LoggerForReplica(tfjob, rt).Warningf("We have too many services for %s %d", rt, index)
 			// TODO(gaocegege): Kill some services.
 		} else if len(serviceSlice) == 0 {
+			if tc.hasConflictingService(tfjob, rt, index) {
+				continue
+			}
 			tflogger.LoggerForReplica(tfjob, rt).Infof("need to create new service: %s-%d", rt, index)
-			err = tc.createNewService(tfjob, rtype, strconv.Itoa(index), spec)
-			if err != nil {
-				return err
+			missing = append(missing, index)
+		} else {
+			desired := tc.newService(tfjob, rtype, strconv.Itoa(index))
+			desired.Spec.Selector = tc.desiredServiceSelector(tfjob, serviceSlice[0], desired)
+			if drift := tc.serviceDrift(tfjob, serviceSlice[0], desired); drift != "" {
+				drifted = append(drifted, serviceSlice[0])
+				drifts = append(drifts, drift)
 			}
 		}
 	}
 
-	return nil
+	err = tc.createReplicas(tfjob, rt, jobcontroller.GenExpectationServicesKey, missing, func(index int) error {
+		return tc.createNewService(tfjob, rtype, strconv.Itoa(index), spec)
+	})
+	if err != nil {
+		return newReconcileError(ErrServiceCreation, err)
+	}
+
+	// The drifted services are deleted, and recreated by the next sync once
+	// their deletion is observed. They are deleted after the creations, which
+	// reset the expectations.
+	for i, service := range drifted {
+		msg := fmt.Sprintf("Recreating service %s/%s whose %s no longer match the %s replica", service.Namespace, service.Name, drifts[i], rt)
+		if err := tc.deleteServiceWithExpectations(tfjob, rt, service, serviceDriftedReason, msg); err != nil {
+			return err
+		}
+	}
+
+	// Delete the services left behind by indexes which have been scaled away.
+	return tc.deleteOutOfRangeServices(tfjob, services, rt, replicas)
 }
 
-// createNewService creates a new service for the given index and type.
-func (tc *TFController) createNewService(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType, index string, spec *common.ReplicaSpec) error {
+// hasConflictingService returns true if a service which is not among the
+// services of the tfjob has the name of its service of the given index, in
+// which case the service cannot be created. A service controlled by another
+// owner is not adopted, a warning event is emitted instead.
+func (tc *TFController) hasConflictingService(tfjob *tfv1.TFJob, rt string, index int) bool {
+	name := tc.nameTemplate.GenName(tfjob.Name, rt, strconv.Itoa(index))
+	service, err := tc.ServiceLister.Services(tfjob.Namespace).Get(name)
+	if err != nil {
+		return false
+	}
+	if service.DeletionTimestamp != nil || metav1.IsControlledBy(service, tfjob) {
+		// The service is being deleted or released, it is created again once it is gone.
+		return true
+	}
+	owner := "no controller"
+	if controllerRef := metav1.GetControllerOf(service); controllerRef != nil {
+		owner = fmt.Sprintf("%s %s", controllerRef.Kind, controllerRef.Name)
+	}
+	msg := fmt.Sprintf("Service %s/%s of the %s replica %d already exists and is controlled by %s, not adopting it",
+		service.Namespace, service.Name, rt, index, owner)
+	tflogger.LoggerForReplica(tfjob, rt).Warn(msg)
+	tc.Recorder.Event(tfjob, v1.EventTypeWarning, serviceConflictReason, msg)
+	return true
+}
+
+// serviceDrift returns which parts of the service differ from the desired
+// service of its replica, or an empty string if none does. Only the fields
+// set by the operator are compared, the fields defaulted by the API server
+// and the shard labels in the selector are ignored.
+func (tc *TFController) serviceDrift(tfjob *tfv1.TFJob, service, desired *v1.Service) string {
+	var drifts []string
+	if service.Spec.ClusterIP != desired.Spec.ClusterIP {
+		drifts = append(drifts, "cluster IP")
+	}
+	if !labels.Equals(tc.withoutShardLabels(service.Spec.Selector), desired.Spec.Selector) {
+		drifts = append(drifts, "selector")
+	}
+	if !serviceExposesPort(service.Spec.Ports, clusterServicePort(tfjob, desired.Spec.Ports)) {
+		drifts = append(drifts, "ports")
+	}
+	return strings.Join(drifts, " and ")
+}
+
+// serviceExposesPort returns true if one of the ports exposes the desired
+// port. Only the port of the cluster spec is checked, so that the services
+// created before other ports were exposed are not recreated.
+func serviceExposesPort(ports []v1.ServicePort, desired v1.ServicePort) bool {
+	for _, port := range ports {
+		if port.Name != desired.Name || port.Port != desired.Port {
+			continue
+		}
+		if servicePortProtocol(port) != servicePortProtocol(desired) {
+			return false
+		}
+		// The target port defaults to the port.
+		return port.TargetPort == (intstr.IntOrString{}) || port.TargetPort == intstr.FromInt(int(port.Port))
+	}
+	return false
+}
+
+// servicePortProtocol returns the protocol of the port, which defaults to TCP.
+func servicePortProtocol(port v1.ServicePort) v1.Protocol {
+	if port.Protocol == "" {
+		return v1.ProtocolTCP
+	}
+	return port.Protocol
+}
+
+// deleteServiceWithExpectations deletes the service unless it is already
+// being deleted, raising the deletion expectations of its replica type on top
+// of the expectations already set in this sync.
+func (tc *TFController) deleteServiceWithExpectations(tfjob *tfv1.TFJob, rt string, service *v1.Service, reason, msg string) error {
+	if service.DeletionTimestamp != nil {
+		return nil
+	}
 	tfjobKey, err := KeyFunc(tfjob)
 	if err != nil {
 		utilruntime.HandleError(fmt.Errorf("couldn't get key for tfjob object %#v: %v", tfjob, err))
 		return err
 	}
-
-	// Convert TFReplicaType to lower string.
-	rt := strings.ToLower(string(rtype))
 	expectationServicesKey := jobcontroller.GenExpectationServicesKey(tfjobKey, rt)
-	err = tc.Expectations.ExpectCreations(expectationServicesKey, 1)
-	if err != nil {
+
+	tflogger.LoggerForReplica(tfjob, rt).Info(msg)
+	if _, exists, err := tc.Expectations.GetExpectations(expectationServicesKey); err != nil {
+		return err
+	} else if exists {
+		tc.Expectations.RaiseExpectations(expectationServicesKey, 0, 1)
+	} else if err := tc.Expectations.ExpectDeletions(expectationServicesKey, 1); err != nil {
 		return err
 	}
+	if err := tc.ServiceControl.DeleteService(service.Namespace, service.Name, tfjob); err != nil {
+		// The deletion is not going to be observed.
+		tc.Expectations.DeletionObserved(expectationServicesKey)
+		return err
+	}
+	tc.audit(tfjob, "delete service %s", service.Name)
+	tc.Recorder.Event(tfjob, v1.EventTypeWarning, reason, msg)
+	return nil
+}
 
-	// Create OwnerReference.
-	controllerRef := tc.GenOwnerReference(tfjob)
+// deleteOutOfRangeServices deletes the services of the given type whose
+// index is not lower than the current number of replicas.
+func (tc *TFController) deleteOutOfRangeServices(tfjob *tfv1.TFJob, services []*v1.Service, rt string, replicas int) error {
+	for _, service := range services {
+		index, err := strconv.Atoi(service.Labels[tfReplicaIndexLabel])
+		if err != nil || index < replicas {
+			continue
+		}
+		msg := fmt.Sprintf("Deleting orphaned service %s/%s with index %d, the replicas are %d",
+			service.Namespace, service.Name, index, replicas)
+		if err := tc.deleteServiceWithExpectations(tfjob, rt, service, outOfRangeServiceReason, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newService returns the desired headless service of the given index and type.
+func (tc *TFController) newService(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType, index string) *v1.Service {
+	// Convert TFReplicaType to lower string.
+	rt := strings.ToLower(string(rtype))
 
 	// Append tfReplicaTypeLabel and tfReplicaIndexLabel labels.
-	labels := tc.GenLabels(tfjob.Name)
+	labels := tc.genLabels(tfjob)
 	labels[tfReplicaTypeLabel] = rt
 	labels[tfReplicaIndexLabel] = index
 
-	port, err := GetPortFromTFJob(tfjob, rtype)
-	if err != nil {
-		return err
-	}
-
 	service := &v1.Service{
 		Spec: v1.ServiceSpec{
 			ClusterIP: "None",
-			Selector:  labels,
-			Ports: []v1.ServicePort{
-				{
-					Name: tfv1.DefaultPortName,
-					Port: port,
-				},
-			},
+			Selector:  tc.withoutShardLabels(labels),
+			Ports:     getServicePorts(tfjob, rtype),
 		},
 	}
 
-	service.Name = jobcontroller.GenGeneralName(tfjob.Name, rt, index)
+	service.Name = tc.nameTemplate.GenName(tfjob.Name, rt, index)
 	service.Labels = labels
+	return service
+}
+
+// createNewService creates a new service for the given index and type.
+// The caller is responsible for raising the creation expectations.
+func (tc *TFController) createNewService(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType, index string, spec *common.ReplicaSpec) error {
+	// Create OwnerReference.
+	controllerRef := tc.GenOwnerReference(tfjob)
 
-	err = tc.ServiceControl.CreateServicesWithControllerRef(tfjob.Namespace, service, tfjob, controllerRef)
+	service := tc.newService(tfjob, rtype, index)
+	err := tc.ServiceControl.CreateServicesWithControllerRef(tfjob.Namespace, service, tfjob, controllerRef)
 	if err != nil && errors.IsTimeout(err) {
 		// Service is created but its initialization has timed out.
 		// If the initialization is successful eventually, the
@@ -120,9 +303,11 @@ func (tc *TFController) createNewService(tfjob *tfv1.TFJob, rtype tfv1.TFReplica
 		// uninitialized for a long time, the informer will not
 		// receive any update, and the controller will create a new
 		// service when the expectation expires.
+		tc.audit(tfjob, "create service %s", service.Name)
 		return nil
 	} else if err != nil {
 		return err
 	}
+	tc.audit(tfjob, "create service %s", service.Name)
 	return nil
 }
@@ -16,18 +16,29 @@
 package tensorflow
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	kubeclientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/kubernetes/pkg/controller"
 
+	common "github.com/kubeflow/common/job_controller/api/v1"
 	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
 	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
 	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
 	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
 )
 
 func TestAddService(t *testing.T) {
@@ -96,3 +107,338 @@ func TestAddService(t *testing.T) {
 	}
 	close(stopCh)
 }
+
+func TestDeleteOutOfRangeServices(t *testing.T) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, _, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, options.ServerOption{})
+	fakeServiceControl := &control.FakeServiceControl{}
+	ctr.ServiceControl = fakeServiceControl
+
+	// The worker replicas have been scaled down from 3 to 1.
+	tfJob := testutil.NewTFJob(1, 0)
+	unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+		t.Errorf("Failed to add tfjob to tfJobIndexer: %v", err)
+	}
+	services := testutil.NewServiceList(3, tfJob, testutil.LabelWorker, t)
+	spec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker]
+	if err := ctr.reconcileServices(tfJob, services, tfv1.TFReplicaTypeWorker, spec); err != nil {
+		t.Errorf("Unexpected error when reconciling services: %v", err)
+	}
+
+	expected := []string{services[1].Name, services[2].Name}
+	if !reflect.DeepEqual(fakeServiceControl.DeleteServiceName, expected) {
+		t.Errorf("Expected deleted services %v, got %v", expected, fakeServiceControl.DeleteServiceName)
+	}
+	if len(fakeServiceControl.Templates) != 0 {
+		t.Errorf("Expected no service creations, got %d", len(fakeServiceControl.Templates))
+	}
+
+	// The deletions are expected until they are observed.
+	expectationServicesKey := jobcontroller.GenExpectationServicesKey(testutil.GetKey(tfJob, t), testutil.LabelWorker)
+	if ctr.Expectations.SatisfiedExpectations(expectationServicesKey) {
+		t.Errorf("Expected the service deletions to be pending")
+	}
+	for _, service := range services[1:] {
+		ctr.DeleteService(service)
+	}
+	if !ctr.Expectations.SatisfiedExpectations(expectationServicesKey) {
+		t.Errorf("Expected the service deletions to be observed")
+	}
+}
+
+func newServiceTestController() (*TFController, cache.Indexer, *control.FakeServiceControl, *record.FakeRecorder) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, kubeInformerFactory, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, options.ServerOption{})
+	fakeServiceControl := &control.FakeServiceControl{}
+	ctr.ServiceControl = fakeServiceControl
+	recorder := record.NewFakeRecorder(10)
+	ctr.Recorder = recorder
+	serviceIndexer := kubeInformerFactory.Core().V1().Services().Informer().GetIndexer()
+	return ctr, serviceIndexer, fakeServiceControl, recorder
+}
+
+// reconcileServicesFromLister reconciles the worker services of the tfjob
+// listed from the service informer.
+func reconcileServicesFromLister(ctr *TFController, serviceIndexer cache.Indexer, tfJob *tfv1.TFJob, services []*v1.Service, t *testing.T) {
+	for _, service := range services {
+		if err := serviceIndexer.Add(service); err != nil {
+			t.Fatalf("Unexpected error when adding service %v", err)
+		}
+	}
+	listed, err := ctr.GetServicesForJob(tfJob)
+	if err != nil {
+		t.Fatalf("Unexpected error when listing services: %v", err)
+	}
+	spec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker]
+	if err := ctr.reconcileServices(tfJob, listed, tfv1.TFReplicaTypeWorker, spec); err != nil {
+		t.Fatalf("Unexpected error when reconciling services: %v", err)
+	}
+}
+
+func TestRecreateDeletedService(t *testing.T) {
+	ctr, serviceIndexer, fakeServiceControl, _ := newServiceTestController()
+	tfJob := testutil.NewTFJob(3, 0)
+
+	// The service of worker 1 has been deleted.
+	services := testutil.NewServiceList(3, tfJob, testutil.LabelWorker, t)
+	reconcileServicesFromLister(ctr, serviceIndexer, tfJob, []*v1.Service{services[0], services[2]}, t)
+
+	if len(fakeServiceControl.Templates) != 1 {
+		t.Fatalf("Expected the deleted service to be created again, got %d creations", len(fakeServiceControl.Templates))
+	}
+	expected := jobcontroller.GenGeneralName(tfJob.Name, testutil.LabelWorker, "1")
+	if name := fakeServiceControl.Templates[0].Name; name != expected {
+		t.Errorf("Expected service %s to be created, got %s", expected, name)
+	}
+	if len(fakeServiceControl.DeleteServiceName) != 0 {
+		t.Errorf("Expected no service deletions, got %v", fakeServiceControl.DeleteServiceName)
+	}
+}
+
+func TestRecreateDriftedServices(t *testing.T) {
+	ctr, serviceIndexer, fakeServiceControl, recorder := newServiceTestController()
+	tfJob := testutil.NewTFJob(4, 0)
+
+	services := testutil.NewServiceList(4, tfJob, testutil.LabelWorker, t)
+	// The API server defaults the protocol and the target port.
+	services[0].Spec.Ports[0].Protocol = v1.ProtocolTCP
+	services[0].Spec.Ports[0].TargetPort = intstr.FromInt(int(tfv1.DefaultPort))
+	// An admission controller mutated the port.
+	services[1].Spec.Ports[0].Port = 8080
+	// The selector no longer selects the pod of the replica.
+	delete(services[2].Spec.Selector, tfReplicaIndexLabel)
+	// The service is not headless anymore.
+	services[3].Spec.ClusterIP = "10.0.0.1"
+	reconcileServicesFromLister(ctr, serviceIndexer, tfJob, services, t)
+
+	expected := []string{services[1].Name, services[2].Name, services[3].Name}
+	if !reflect.DeepEqual(fakeServiceControl.DeleteServiceName, expected) {
+		t.Errorf("Expected the drifted services %v to be deleted, got %v", expected, fakeServiceControl.DeleteServiceName)
+	}
+	if len(fakeServiceControl.Templates) != 0 {
+		t.Errorf("Expected no service creations before the deletions are observed, got %d", len(fakeServiceControl.Templates))
+	}
+	if count := countEvents(recorder, serviceDriftedReason); count != 3 {
+		t.Errorf("Expected 3 %s events, got %d", serviceDriftedReason, count)
+	}
+
+	// The services are recreated by the sync observing their deletions.
+	expectationServicesKey := jobcontroller.GenExpectationServicesKey(testutil.GetKey(tfJob, t), testutil.LabelWorker)
+	if ctr.Expectations.SatisfiedExpectations(expectationServicesKey) {
+		t.Errorf("Expected the service deletions to be pending")
+	}
+}
+
+func TestConflictingService(t *testing.T) {
+	ctr, serviceIndexer, fakeServiceControl, recorder := newServiceTestController()
+	tfJob := testutil.NewTFJob(2, 0)
+	other := testutil.NewTFJob(1, 0)
+	other.Name = "other"
+	other.UID = types.UID("other")
+
+	// A service of another tfjob has the name of the service of worker 0.
+	conflicting := testutil.NewService(other, testutil.LabelWorker, 0, t)
+	conflicting.Name = jobcontroller.GenGeneralName(tfJob.Name, testutil.LabelWorker, "0")
+	reconcileServicesFromLister(ctr, serviceIndexer, tfJob, []*v1.Service{conflicting}, t)
+
+	if len(fakeServiceControl.Templates) != 1 {
+		t.Fatalf("Expected only the service of worker 1 to be created, got %d creations", len(fakeServiceControl.Templates))
+	}
+	if name := fakeServiceControl.Templates[0].Name; strings.HasSuffix(name, "-0") {
+		t.Errorf("Expected the conflicting service not to be created, got %s", name)
+	}
+	if len(fakeServiceControl.Patches) != 0 || len(fakeServiceControl.DeleteServiceName) != 0 {
+		t.Errorf("Expected the conflicting service to be left alone, got %d patches and deletions %v",
+			len(fakeServiceControl.Patches), fakeServiceControl.DeleteServiceName)
+	}
+	if count := countEvents(recorder, serviceConflictReason); count != 1 {
+		t.Errorf("Expected 1 %s event, got %d", serviceConflictReason, count)
+	}
+	if !metav1.IsControlledBy(conflicting, other) {
+		t.Errorf("Expected the conflicting service to keep its controller")
+	}
+}
+
+func TestServicePorts(t *testing.T) {
+	grpc := v1.ContainerPort{Name: "grpc", ContainerPort: 5000}
+	tensorboard := v1.ContainerPort{Name: "tensorboard", ContainerPort: 6006}
+	tfJobPort := v1.ContainerPort{Name: tfv1.DefaultPortName, ContainerPort: 3333}
+	unnamed := v1.ContainerPort{ContainerPort: 7000}
+
+	type testCase struct {
+		description   string
+		ports         []v1.ContainerPort
+		expectedPorts []string
+		expectedPort  int32
+	}
+	testCases := []testCase{
+		{"A container without ports uses the default port", nil, []string{"tfjob-port:2222"}, tfv1.DefaultPort},
+		{"The unnamed ports are not exposed", []v1.ContainerPort{unnamed}, []string{"tfjob-port:2222"}, tfv1.DefaultPort},
+		{"The first port is used without tfjob-port", []v1.ContainerPort{grpc, tensorboard}, []string{"grpc:5000", "tensorboard:6006"}, 5000},
+		{"The tfjob-port is used", []v1.ContainerPort{tensorboard, tfJobPort}, []string{"tensorboard:6006", "tfjob-port:3333"}, 3333},
+	}
+	for _, c := range testCases {
+		ctr, _, _, _ := newServiceTestController()
+		tfJob := testutil.NewTFJob(2, 0)
+		tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template.Spec.Containers[0].Ports = c.ports
+
+		service := ctr.newService(tfJob, tfv1.TFReplicaTypeWorker, "0")
+		var ports []string
+		for _, port := range service.Spec.Ports {
+			ports = append(ports, fmt.Sprintf("%s:%d", port.Name, port.Port))
+		}
+		if !reflect.DeepEqual(ports, c.expectedPorts) {
+			t.Errorf("%s: expected the service ports %v, got %v", c.description, c.expectedPorts, ports)
+		}
+
+		clusterSpec, err := genClusterSpec(tfJob, "")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.description, err)
+		}
+		for _, endpoint := range clusterSpec[testutil.LabelWorker] {
+			if !strings.HasSuffix(endpoint, fmt.Sprintf(":%d", c.expectedPort)) {
+				t.Errorf("%s: expected the cluster spec to use the port %d, got %s", c.description, c.expectedPort, endpoint)
+			}
+		}
+	}
+}
+
+func TestServiceWithoutNewPortsIsNotDrifted(t *testing.T) {
+	ctr, serviceIndexer, fakeServiceControl, _ := newServiceTestController()
+	tfJob := testutil.NewTFJob(1, 0)
+	// The services were created before the tensorboard port was exposed.
+	services := testutil.NewServiceList(1, tfJob, testutil.LabelWorker, t)
+	container := &tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template.Spec.Containers[0]
+	container.Ports = append(container.Ports, v1.ContainerPort{Name: "tensorboard", ContainerPort: 6006})
+	reconcileServicesFromLister(ctr, serviceIndexer, tfJob, services, t)
+
+	if len(fakeServiceControl.DeleteServiceName) != 0 {
+		t.Errorf("Expected the service exposing the port of the cluster spec to be kept, got deletions %v", fakeServiceControl.DeleteServiceName)
+	}
+}
+
+func TestDisableServiceCreation(t *testing.T) {
+	testCases := []struct {
+		description string
+		// name is the name of the tfjob.
+		name           string
+		hostname       string
+		expectedPods   int
+		expectedFailed bool
+	}{
+		{"The pods are created without their services", "test-tfjob", "", 3, false},
+		{"A pod template setting a hostname is rejected", "test-tfjob", "trainer", 0, true},
+		{"A name too long for a service is rejected", strings.Repeat("a", 60), "", 0, true},
+	}
+
+	for _, tc := range testCases {
+		ctr, fakePodControl, fakeServiceControl := newErrorsTestController()
+		ctr.disableServiceCreation = true
+		var actual *tfv1.TFJob
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			actual = tfJob
+			return nil
+		}
+		tfJob := testutil.NewTFJob(2, 1)
+		tfJob.Name = tc.name
+		tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template.Spec.Hostname = tc.hostname
+
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", tc.description, err)
+		}
+		if len(fakePodControl.Templates) != tc.expectedPods {
+			t.Errorf("%s: expected %d pods, got %d", tc.description, tc.expectedPods, len(fakePodControl.Templates))
+		}
+		if len(fakeServiceControl.Templates) != 0 {
+			t.Errorf("%s: expected no service to be created, got %d", tc.description, len(fakeServiceControl.Templates))
+		}
+		if actual == nil {
+			t.Fatalf("%s: expected the status to be updated", tc.description)
+		}
+		if failed := testutil.CheckCondition(actual, common.JobFailed, tfJobInvalidSpecReason); failed != tc.expectedFailed {
+			t.Errorf("%s: expected the tfjob failed %v, got %v", tc.description, tc.expectedFailed, failed)
+		}
+		// TF_CONFIG still addresses the replicas by the names of their services.
+		expected := fmt.Sprintf("%s-ps-0.%s.svc", tfJob.Name, tfJob.Namespace)
+		for _, template := range fakePodControl.Templates {
+			for _, env := range template.Spec.Containers[0].Env {
+				if env.Name == tfConfig && !strings.Contains(env.Value, expected) {
+					t.Errorf("%s: expected TF_CONFIG to address the PS as %s, got %s", tc.description, expected, env.Value)
+				}
+			}
+		}
+	}
+}
+
+func TestNameTemplate(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	ctr.nameTemplate = "tf-{type}-{index}-{job}"
+	tfJob := testutil.NewTFJob(1, 1)
+	spec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker]
+	if err := ctr.createNewPod(tfJob, testutil.LabelWorker, "0", spec, false); err != nil {
+		t.Fatalf("Unexpected error when creating the pod: %v", err)
+	}
+	pod := fakePodControl.Templates[0]
+	if expected := "tf-worker-0-" + tfJob.Name; pod.Name != expected {
+		t.Errorf("Expected the pod to be named %s, got %s", expected, pod.Name)
+	}
+	if service := ctr.newService(tfJob, tfv1.TFReplicaTypePS, "0"); service.Name != "tf-ps-0-"+tfJob.Name {
+		t.Errorf("Expected the service to be named tf-ps-0-%s, got %s", tfJob.Name, service.Name)
+	}
+	tfConfig := findContainer(pod.Spec.Containers, tfv1.DefaultContainerName).Env[0].Value
+	if expected := fmt.Sprintf("tf-ps-0-%s.%s.svc", tfJob.Name, tfJob.Namespace); !strings.Contains(tfConfig, expected) {
+		t.Errorf("Expected TF_CONFIG to address the PS as %s, got %s", expected, tfConfig)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+const (
+	// serviceDNSTimeoutReason is the reason of the event when the workers of
+	// a tfjob are created before its services resolve.
+	serviceDNSTimeoutReason = "ServiceDNSTimeout"
+	// serviceDNSLookupTimeout bounds a lookup of the name of a service.
+	serviceDNSLookupTimeout = 5 * time.Second
+	// serviceDNSRecheckInterval is the period the tfjobs waiting for their
+	// services to resolve are synced again.
+	serviceDNSRecheckInterval = 2 * time.Second
+)
+
+// serviceResolver resolves the names of the services of the tfjobs.
+// *net.Resolver implements it.
+type serviceResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// newServiceResolver returns a resolver sending its queries to the DNS server
+// of the given address, with the default port 53 if it has none.
+func newServiceResolver(address string) serviceResolver {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, address)
+		},
+	}
+}
+
+// serviceDNSGate tracks the lookups of the services of a tfjob whose workers
+// wait for them to resolve.
+type serviceDNSGate struct {
+	// since is the time the workers started waiting.
+	since time.Time
+	// resolved is the names which resolved.
+	resolved sets.String
+	// pending is the names being looked up.
+	pending sets.String
+	// open is true once the workers no longer wait, because the names
+	// resolved or the timeout elapsed.
+	open bool
+}
+
+// serviceDNSNames returns the names of the PS and chief services of the tfjob,
+// as they appear in the cluster spec of its pods.
+func serviceDNSNames(tfjob *tfv1.TFJob, nameTemplate jobcontroller.NameTemplate) ([]string, error) {
+	clusterSpec, err := genClusterSpec(tfjob, nameTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, rtype := range []tfv1.TFReplicaType{tfv1.TFReplicaTypePS, tfv1.TFReplicaTypeChief, tfv1.TFReplicaTypeMaster} {
+		for _, endpoint := range clusterSpec[strings.ToLower(string(rtype))] {
+			host, _, err := net.SplitHostPort(endpoint)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, host)
+		}
+	}
+	return names, nil
+}
+
+// serviceDNSReady returns true if the workers of the tfjob may be created:
+// the names of its PS and chief services resolve, or they did not within
+// serviceDNSTimeout. Otherwise it looks up the names which did not resolve
+// yet in the background, and requeues the tfjob.
+func (tc *TFController) serviceDNSReady(tfjob *tfv1.TFJob) bool {
+	if tc.serviceResolver == nil {
+		return true
+	}
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("couldn't get key for tfjob object %#v: %v", tfjob, err))
+		return true
+	}
+	names, err := serviceDNSNames(tfjob, tc.nameTemplate)
+	if err != nil {
+		tflogger.LoggerForJob(tfjob).Warnf("Failed to get the names of the services to look up: %v", err)
+		return true
+	}
+
+	tc.serviceDNSLock.Lock()
+	defer tc.serviceDNSLock.Unlock()
+	gate, ok := tc.serviceDNSGates[key]
+	if !ok {
+		gate = &serviceDNSGate{since: tc.clock.Now(), resolved: sets.NewString(), pending: sets.NewString()}
+		tc.serviceDNSGates[key] = gate
+	}
+	if gate.open {
+		return true
+	}
+	unresolved := sets.NewString(names...).Difference(gate.resolved)
+	if unresolved.Len() == 0 {
+		gate.open = true
+		return true
+	}
+	if waited := tc.clock.Since(gate.since); waited >= tc.serviceDNSTimeout {
+		gate.open = true
+		msg := fmt.Sprintf("Creating the workers of TFJob %s although its services %s did not resolve within %v",
+			tfjob.Name, strings.Join(unresolved.List(), ", "), tc.serviceDNSTimeout)
+		tflogger.LoggerForJob(tfjob).Warn(msg)
+		tc.Recorder.Event(tfjob, v1.EventTypeWarning, serviceDNSTimeoutReason, msg)
+		return true
+	}
+	for _, name := range unresolved.Difference(gate.pending).List() {
+		gate.pending.Insert(name)
+		go tc.lookupServiceDNS(key, name)
+	}
+	tc.WorkQueue.AddAfter(key, serviceDNSRecheckInterval)
+	return false
+}
+
+// lookupServiceDNS looks up the name of a service of the tfjob with the given
+// key, and syncs the tfjob again once it resolves.
+func (tc *TFController) lookupServiceDNS(key, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), serviceDNSLookupTimeout)
+	defer cancel()
+	_, err := tc.serviceResolver.LookupHost(ctx, name)
+
+	tc.serviceDNSLock.Lock()
+	defer tc.serviceDNSLock.Unlock()
+	gate, ok := tc.serviceDNSGates[key]
+	if !ok {
+		return
+	}
+	gate.pending.Delete(name)
+	if err != nil {
+		tflogger.LoggerForKey(key).Infof("Service %s does not resolve yet: %v", name, err)
+		return
+	}
+	gate.resolved.Insert(name)
+	tc.WorkQueue.Add(key)
+}
+
+// forgetServiceDNS forgets the lookups of the services of the tfjob.
+func (tc *TFController) forgetServiceDNS(key string) {
+	tc.serviceDNSLock.Lock()
+	defer tc.serviceDNSLock.Unlock()
+	delete(tc.serviceDNSGates, key)
+}
@@ -0,0 +1,144 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/kubernetes/pkg/controller"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+// fakeServiceResolver resolves the names it has been told to.
+type fakeServiceResolver struct {
+	mu       sync.Mutex
+	resolved sets.String
+	lookups  sets.String
+}
+
+func (r *fakeServiceResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups.Insert(host)
+	if !r.resolved.Has(host) {
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+	return []string{"10.0.0.1"}, nil
+}
+
+func (r *fakeServiceResolver) resolve(host string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resolved.Insert(host)
+}
+
+// countWorkerPods returns the number of worker pods created.
+func countWorkerPods(fakePodControl *controller.FakePodControl) int {
+	count := 0
+	for _, template := range fakePodControl.Templates {
+		if template.Labels[tfReplicaTypeLabel] == "worker" {
+			count++
+		}
+	}
+	return count
+}
+
+func TestServiceDNSGate(t *testing.T) {
+	testCases := []struct {
+		description string
+		// resolveLater is true if the PS service resolves after the first
+		// lookup, otherwise it never resolves.
+		resolveLater bool
+	}{
+		{"The workers wait for the service to resolve", true},
+		{"The workers are created once the timeout elapses", false},
+	}
+
+	for _, tc := range testCases {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		recorder := record.NewFakeRecorder(100)
+		ctr.Recorder = recorder
+		fakeClock := clock.NewFakeClock(time.Now())
+		ctr.clock = fakeClock
+		resolver := &fakeServiceResolver{resolved: sets.NewString(), lookups: sets.NewString()}
+		ctr.serviceResolver = resolver
+		ctr.serviceDNSTimeout = time.Minute
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			return nil
+		}
+		tfJob := testutil.NewTFJob(2, 1)
+		key, err := KeyFunc(tfJob)
+		if err != nil {
+			t.Fatalf("%s: unexpected error when getting the key: %v", tc.description, err)
+		}
+		name := fmt.Sprintf("%s-ps-0.%s.svc", tfJob.Name, tfJob.Namespace)
+
+		// waitForLookups waits until the lookups of the tfjob are over.
+		waitForLookups := func() {
+			err := wait.Poll(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+				ctr.serviceDNSLock.Lock()
+				defer ctr.serviceDNSLock.Unlock()
+				return ctr.serviceDNSGates[key].pending.Len() == 0, nil
+			})
+			if err != nil {
+				t.Fatalf("%s: the lookups did not complete: %v", tc.description, err)
+			}
+		}
+
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", tc.description, err)
+		}
+		waitForLookups()
+		if count := countWorkerPods(fakePodControl); count != 0 {
+			t.Errorf("%s: expected no worker before the service resolves, got %d", tc.description, count)
+		}
+		if !resolver.lookups.Has(name) {
+			t.Errorf("%s: expected %s to be looked up, got %v", tc.description, name, resolver.lookups.List())
+		}
+
+		if tc.resolveLater {
+			resolver.resolve(name)
+			if err := ctr.reconcileTFJobs(tfJob); err != nil {
+				t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", tc.description, err)
+			}
+			waitForLookups()
+		} else {
+			fakeClock.Step(time.Minute)
+		}
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling the tfjob: %v", tc.description, err)
+		}
+		if count := countWorkerPods(fakePodControl); count != 2 {
+			t.Errorf("%s: expected the 2 workers to be created, got %d", tc.description, count)
+		}
+		expectedEvents := 1
+		if tc.resolveLater {
+			expectedEvents = 0
+		}
+		if count := countEvents(recorder, serviceDNSTimeoutReason); count != expectedEvents {
+			t.Errorf("%s: expected %d timeout events, got %d", tc.description, expectedEvents, count)
+		}
+	}
+}
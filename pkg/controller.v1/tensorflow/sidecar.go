@@ -0,0 +1,112 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// addSidecars adds the sidecars of the tfjob and their volumes to the pod
+// template, see injectSidecars.
+func addSidecars(podTemplateSpec *v1.PodTemplateSpec, tfjob *tfv1.TFJob) {
+	injectSidecars(podTemplateSpec, tfjob.Spec.Sidecars, tfjob.Spec.SidecarVolumes)
+}
+
+// injectSidecars adds the sidecars and their volumes to the pod template,
+// except those whose name is already used in the template. The names of the
+// added sidecars are recorded in an annotation of the pod, so that they are
+// told apart from the containers of the replica after the sidecars have
+// changed.
+func injectSidecars(podTemplateSpec *v1.PodTemplateSpec, sidecars []v1.Container, sidecarVolumes []v1.Volume) {
+	if len(sidecars) == 0 {
+		return
+	}
+	containers := make(map[string]bool, len(podTemplateSpec.Spec.Containers))
+	for _, container := range podTemplateSpec.Spec.Containers {
+		containers[container.Name] = true
+	}
+	var added []string
+	for _, sidecar := range sidecars {
+		if containers[sidecar.Name] {
+			continue
+		}
+		podTemplateSpec.Spec.Containers = append(podTemplateSpec.Spec.Containers, *sidecar.DeepCopy())
+		added = append(added, sidecar.Name)
+	}
+
+	volumes := make(map[string]bool, len(podTemplateSpec.Spec.Volumes))
+	for _, volume := range podTemplateSpec.Spec.Volumes {
+		volumes[volume.Name] = true
+	}
+	for _, volume := range sidecarVolumes {
+		if volumes[volume.Name] {
+			continue
+		}
+		podTemplateSpec.Spec.Volumes = append(podTemplateSpec.Spec.Volumes, *volume.DeepCopy())
+	}
+
+	if len(added) == 0 {
+		return
+	}
+	if podTemplateSpec.Annotations == nil {
+		podTemplateSpec.Annotations = make(map[string]string)
+	}
+	if recorded := podTemplateSpec.Annotations[tfv1.AnnotationSidecars]; recorded != "" {
+		added = append([]string{recorded}, added...)
+	}
+	podTemplateSpec.Annotations[tfv1.AnnotationSidecars] = strings.Join(added, ",")
+}
+
+// isSidecar returns true if the container of the pod is a sidecar added by
+// the tfjob.
+func isSidecar(pod *v1.Pod, container string) bool {
+	sidecars, ok := pod.Annotations[tfv1.AnnotationSidecars]
+	if !ok {
+		return false
+	}
+	for _, name := range strings.Split(sidecars, ",") {
+		if name == container {
+			return true
+		}
+	}
+	return false
+}
+
+// replicaPodPhase returns the phase of the pod of a replica. The sidecars of
+// a pod may keep running after its tensorflow container has terminated, so
+// the phase of such a pod is given by the exit code of its tensorflow
+// container.
+func replicaPodPhase(pod *v1.Pod) v1.PodPhase {
+	if pod.Status.Phase != v1.PodRunning || pod.Annotations[tfv1.AnnotationSidecars] == "" {
+		return pod.Status.Phase
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != tfv1.DefaultContainerName || status.State.Terminated == nil {
+			continue
+		}
+		// The kubelet restarts the container if the restart policy allows.
+		switch {
+		case status.State.Terminated.ExitCode == 0 && pod.Spec.RestartPolicy != v1.RestartPolicyAlways:
+			return v1.PodSucceeded
+		case status.State.Terminated.ExitCode != 0 && pod.Spec.RestartPolicy == v1.RestartPolicyNever:
+			return v1.PodFailed
+		}
+	}
+	return pod.Status.Phase
+}
@@ -0,0 +1,241 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+const exporterName = "exporter"
+
+func newTFJobWithSidecar(worker, ps int) *tfv1.TFJob {
+	tfJob := testutil.NewTFJob(worker, ps)
+	tfJob.Spec.Sidecars = []v1.Container{{Name: exporterName, Image: "exporter:1.0"}}
+	tfJob.Spec.SidecarVolumes = []v1.Volume{{Name: "metrics"}}
+	return tfJob
+}
+
+func findContainer(containers []v1.Container, name string) *v1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+func hasEnv(container *v1.Container, name string) bool {
+	for _, env := range container.Env {
+		if env.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSidecarInjection(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	tfJob := newTFJobWithSidecar(2, 1)
+	// The PS template has its own exporter.
+	psSpec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypePS]
+	psSpec.Template.Spec.Containers = append(psSpec.Template.Spec.Containers, v1.Container{Name: exporterName, Image: "ps-exporter:1.0"})
+
+	if err := ctr.createNewPod(tfJob, testutil.LabelWorker, "0", tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker], true); err != nil {
+		t.Fatalf("Unexpected error when creating the worker pod: %v", err)
+	}
+	if err := ctr.createNewPod(tfJob, testutil.LabelPS, "0", psSpec, false); err != nil {
+		t.Fatalf("Unexpected error when creating the PS pod: %v", err)
+	}
+	worker, ps := fakePodControl.Templates[0], fakePodControl.Templates[1]
+
+	exporter := findContainer(worker.Spec.Containers, exporterName)
+	if len(worker.Spec.Containers) != 2 || exporter == nil || exporter.Image != "exporter:1.0" {
+		t.Fatalf("Expected the sidecar to be added to the worker pod, got %v", worker.Spec.Containers)
+	}
+	if hasEnv(exporter, tfConfig) {
+		t.Errorf("Expected the sidecar not to get %s", tfConfig)
+	}
+	if !hasEnv(findContainer(worker.Spec.Containers, tfv1.DefaultContainerName), tfConfig) {
+		t.Errorf("Expected the tensorflow container to get %s", tfConfig)
+	}
+	if worker.Annotations[tfv1.AnnotationSidecars] != exporterName {
+		t.Errorf("Expected the sidecar to be recorded in the worker pod, got %v", worker.Annotations)
+	}
+	if len(worker.Spec.Volumes) != 1 || worker.Spec.Volumes[0].Name != "metrics" {
+		t.Errorf("Expected the sidecar volume to be added to the worker pod, got %v", worker.Spec.Volumes)
+	}
+
+	exporter = findContainer(ps.Spec.Containers, exporterName)
+	if len(ps.Spec.Containers) != 2 || exporter == nil || exporter.Image != "ps-exporter:1.0" {
+		t.Errorf("Expected the exporter of the PS template to be kept, got %v", ps.Spec.Containers)
+	}
+	if _, ok := ps.Annotations[tfv1.AnnotationSidecars]; ok {
+		t.Errorf("Expected no sidecar to be recorded in the PS pod, got %v", ps.Annotations)
+	}
+}
+
+func TestSidecarAccounting(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	tfJob := newTFJobWithSidecar(1, 0)
+	backoffLimit := int32(2)
+	tfJob.Spec.BackoffLimit = &backoffLimit
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].RestartPolicy = common.RestartPolicyOnFailure
+
+	pod := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+	pod.Annotations = map[string]string{tfv1.AnnotationSidecars: exporterName}
+	pod.Status.Phase = v1.PodRunning
+	pod.Status.ContainerStatuses = []v1.ContainerStatus{
+		{Name: tfv1.DefaultContainerName, RestartCount: 1},
+		{Name: exporterName, RestartCount: 5},
+	}
+
+	// Removing the sidecar from the tfjob does not change how the existing pods are accounted.
+	for _, sidecars := range [][]v1.Container{tfJob.Spec.Sidecars, nil} {
+		tfJob.Spec.Sidecars = sidecars
+		pastBackoff, err := ctr.pastBackoffLimit(tfJob, []*v1.Pod{pod})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if pastBackoff {
+			t.Errorf("Expected the restarts of the sidecar not to count in the backoff limit")
+		}
+	}
+	pod.Status.ContainerStatuses[0].RestartCount = 2
+	if msg := ctr.backoffLimitMessage(tfJob, []*v1.Pod{pod}); !strings.Contains(msg, "container "+tfv1.DefaultContainerName) {
+		t.Errorf("Expected the message to name the tensorflow container, got %q", msg)
+	}
+
+	type testCase struct {
+		description   string
+		restartPolicy v1.RestartPolicy
+		exitCode      int32
+		expected      v1.PodPhase
+	}
+	testCases := []testCase{
+		{"The tensorflow container succeeded", v1.RestartPolicyNever, 0, v1.PodSucceeded},
+		{"The tensorflow container failed", v1.RestartPolicyNever, 1, v1.PodFailed},
+		{"The failed tensorflow container is restarted", v1.RestartPolicyOnFailure, 1, v1.PodRunning},
+		{"The succeeded tensorflow container is restarted", v1.RestartPolicyAlways, 0, v1.PodRunning},
+	}
+	for _, c := range testCases {
+		pod.Spec.RestartPolicy = c.restartPolicy
+		pod.Status.ContainerStatuses[0].State = v1.ContainerState{
+			Terminated: &v1.ContainerStateTerminated{ExitCode: c.exitCode},
+		}
+		if phase := replicaPodPhase(pod); phase != c.expected {
+			t.Errorf("%s: expected the phase %s, got %s", c.description, c.expected, phase)
+		}
+	}
+	// The containers of a pod without sidecars do not change its phase.
+	delete(pod.Annotations, tfv1.AnnotationSidecars)
+	pod.Spec.RestartPolicy = v1.RestartPolicyNever
+	if phase := replicaPodPhase(pod); phase != v1.PodRunning {
+		t.Errorf("Expected the phase of the pod without sidecars to be kept, got %s", phase)
+	}
+}
+
+const testLogAgent = `
+container:
+  name: log-agent
+  image: log-agent:1.0
+  resources:
+    limits:
+      cpu: 100m
+  volumeMounts:
+  - name: logs
+    mountPath: /var/log/tensorflow
+volumes:
+- name: logs
+  emptyDir: {}
+replicaTypes: [Worker]
+`
+
+func TestOperatorSidecar(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	ctr.setOperatorSidecar(&v1.ConfigMap{Data: map[string]string{OperatorSidecarKey: testLogAgent}})
+	tfJob := newTFJobWithSidecar(2, 1)
+	workerSpec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker]
+
+	// The pods created again from the same template get the sidecar once.
+	for i := 0; i < 2; i++ {
+		if err := ctr.createNewPod(tfJob, testutil.LabelWorker, "0", workerSpec, true); err != nil {
+			t.Fatalf("Unexpected error when creating the worker pod: %v", err)
+		}
+	}
+	if err := ctr.createNewPod(tfJob, testutil.LabelPS, "0", tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypePS], false); err != nil {
+		t.Fatalf("Unexpected error when creating the PS pod: %v", err)
+	}
+	for _, worker := range fakePodControl.Templates[:2] {
+		agent := findContainer(worker.Spec.Containers, "log-agent")
+		if len(worker.Spec.Containers) != 3 || agent == nil || agent.Image != "log-agent:1.0" {
+			t.Fatalf("Expected the operator sidecar to be added to the worker pod, got %v", worker.Spec.Containers)
+		}
+		if hasEnv(agent, tfConfig) {
+			t.Errorf("Expected the operator sidecar not to get %s", tfConfig)
+		}
+		if worker.Annotations[tfv1.AnnotationSidecars] != exporterName+",log-agent" {
+			t.Errorf("Expected both sidecars to be recorded in the worker pod, got %v", worker.Annotations)
+		}
+		if len(worker.Spec.Volumes) != 2 {
+			t.Errorf("Expected the volumes of both sidecars, got %v", worker.Spec.Volumes)
+		}
+	}
+	if ps := fakePodControl.Templates[2]; findContainer(ps.Spec.Containers, "log-agent") != nil {
+		t.Errorf("Expected the operator sidecar not to be added to the PS pod, got %v", ps.Spec.Containers)
+	}
+	if len(workerSpec.Template.Spec.Containers) != 1 {
+		t.Errorf("Expected the template of the tfjob to be unchanged, got %v", workerSpec.Template.Spec.Containers)
+	}
+
+	// The sidecar of the tfjob takes precedence over the one of the operator.
+	ctr.setOperatorSidecar(&v1.ConfigMap{Data: map[string]string{OperatorSidecarKey: "container:\n  name: exporter\n  image: other:1.0\n"}})
+	if err := ctr.createNewPod(tfJob, testutil.LabelWorker, "1", workerSpec, false); err != nil {
+		t.Fatalf("Unexpected error when creating the worker pod: %v", err)
+	}
+	worker := fakePodControl.Templates[3]
+	if exporter := findContainer(worker.Spec.Containers, exporterName); len(worker.Spec.Containers) != 2 || exporter.Image != "exporter:1.0" {
+		t.Errorf("Expected the sidecar of the tfjob to be kept, got %v", worker.Spec.Containers)
+	}
+	if worker.Annotations[tfv1.AnnotationSidecars] != exporterName {
+		t.Errorf("Expected the sidecar of the tfjob to be recorded once, got %v", worker.Annotations)
+	}
+}
+
+func TestParseOperatorSidecar(t *testing.T) {
+	type testCase struct {
+		description string
+		data        string
+		expectedErr bool
+	}
+	testCases := []testCase{
+		{"A valid sidecar", testLogAgent, false},
+		{"A sidecar without name", "container:\n  image: log-agent:1.0\n", true},
+		{"A sidecar named after the tensorflow container", "container:\n  name: tensorflow\n  image: log-agent:1.0\n", true},
+		{"A sidecar without image", "container:\n  name: log-agent\n", true},
+	}
+	for _, c := range testCases {
+		_, err := parseOperatorSidecar(&v1.ConfigMap{Data: map[string]string{OperatorSidecarKey: c.data}})
+		if (err != nil) != c.expectedErr {
+			t.Errorf("%s: expected error %v, got %v", c.description, c.expectedErr, err)
+		}
+	}
+}
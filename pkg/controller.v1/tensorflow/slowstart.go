@@ -0,0 +1,114 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"sync"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+// slowStartInitialBatchSize is the size of the first batch of creations.
+// The following batches double in size, like in the Job controller.
+const slowStartInitialBatchSize = 1
+
+// createReplicas creates the pods or services of the given indexes, at most
+// creationLimit of them, in slow-start batches. The expectations are
+// only raised for the creations which are attempted, and the tfjob is
+// requeued when some creations are left for a later sync.
+func (tc *TFController) createReplicas(tfjob *tfv1.TFJob, rt string, genExpectationKey func(string, string) string,
+	indexes []int, create func(index int) error) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	tfjobKey, err := KeyFunc(tfjob)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("couldn't get key for tfjob object %#v: %v", tfjob, err))
+		return err
+	}
+	expectationKey := genExpectationKey(tfjobKey, rt)
+
+	attempted := len(indexes)
+	if limit := tc.creationLimit(); limit > 0 && attempted > limit {
+		attempted = limit
+	}
+	if err := tc.Expectations.ExpectCreations(expectationKey, attempted); err != nil {
+		return err
+	}
+	created, err := slowStartBatch(attempted, slowStartInitialBatchSize, func(i int) error {
+		return create(indexes[i])
+	})
+	// The creations which failed or were skipped are not going to be observed.
+	for i := created; i < attempted; i++ {
+		tc.Expectations.CreationObserved(expectationKey)
+	}
+	if err != nil {
+		if _, throttled := throttleDelay(err); throttled {
+			limit := tc.creationThrottle.throttle(tc.clock.Now(), attempted)
+			tflogger.LoggerForReplica(tfjob, rt).Warnf("The API server throttled the creations of the %s replicas, reducing the creations per sync to %d",
+				rt, limit)
+		}
+		return err
+	}
+
+	if attempted < len(indexes) {
+		tflogger.LoggerForReplica(tfjob, rt).Infof("Created %d of the %d missing %s replicas, requeueing the tfjob for the rest",
+			attempted, len(indexes), rt)
+		tc.WorkQueue.AddRateLimited(tfjobKey)
+	}
+	return nil
+}
+
+// slowStartBatch calls fn count times with the indexes from 0 to count-1.
+// The calls are made concurrently in batches which start at initialBatchSize
+// and double in size as long as all the calls of the previous batch succeeded,
+// so that a failing API call is not hammered. It returns the number of
+// successful calls and the first error.
+func slowStartBatch(count int, initialBatchSize int, fn func(int) error) (int, error) {
+	remaining := count
+	successes := 0
+	for batchSize := minInt(remaining, initialBatchSize); batchSize > 0; batchSize = minInt(2*batchSize, remaining) {
+		start := count - remaining
+		errCh := make(chan error, batchSize)
+		var wg sync.WaitGroup
+		wg.Add(batchSize)
+		for i := 0; i < batchSize; i++ {
+			go func(i int) {
+				defer wg.Done()
+				if err := fn(i); err != nil {
+					errCh <- err
+				}
+			}(start + i)
+		}
+		wg.Wait()
+		successes += batchSize - len(errCh)
+		if len(errCh) > 0 {
+			return successes, <-errCh
+		}
+		remaining -= batchSize
+	}
+	return successes, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
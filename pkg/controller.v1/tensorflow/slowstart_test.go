@@ -0,0 +1,141 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
+	v1 "k8s.io/api/core/v1"
+	kubeclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/kubernetes/pkg/controller"
+
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
+)
+
+func TestSlowStartBatch(t *testing.T) {
+	type testCase struct {
+		count         int
+		failFrom      int
+		expectedCalls int32
+		expectedOK    int
+	}
+	testCases := []testCase{
+		// Batches of 1, 2, 4 and 3.
+		{count: 10, failFrom: 10, expectedCalls: 10, expectedOK: 10},
+		// The batch of 4 from index 3 fails, no more batches are started.
+		{count: 10, failFrom: 3, expectedCalls: 7, expectedOK: 3},
+		{count: 10, failFrom: 0, expectedCalls: 1, expectedOK: 0},
+		{count: 0, failFrom: 0, expectedCalls: 0, expectedOK: 0},
+	}
+	for _, tc := range testCases {
+		var calls int32
+		ok, err := slowStartBatch(tc.count, slowStartInitialBatchSize, func(i int) error {
+			atomic.AddInt32(&calls, 1)
+			if i >= tc.failFrom {
+				return fmt.Errorf("fail %d", i)
+			}
+			return nil
+		})
+		if calls != tc.expectedCalls || ok != tc.expectedOK {
+			t.Errorf("Count %d failing from %d: expected %d calls and %d successes, got %d and %d",
+				tc.count, tc.failFrom, tc.expectedCalls, tc.expectedOK, calls, ok)
+		}
+		if (err != nil) != (tc.expectedOK < tc.count) {
+			t.Errorf("Count %d failing from %d: unexpected error %v", tc.count, tc.failFrom, err)
+		}
+	}
+}
+
+func TestMaxPodCreationsPerSync(t *testing.T) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	option := options.ServerOption{
+		MaxPodCreationsPerSync: 4,
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, _, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, option)
+	fakePodControl := &controller.FakePodControl{}
+	ctr.PodControl = fakePodControl
+	fakeServiceControl := &control.FakeServiceControl{}
+	ctr.ServiceControl = fakeServiceControl
+	ctr.Recorder = &record.FakeRecorder{}
+
+	tfJob := testutil.NewTFJob(10, 0)
+	key := testutil.GetKey(tfJob, t)
+	podsKey := jobcontroller.GenExpectationPodsKey(key, testutil.LabelWorker)
+	servicesKey := jobcontroller.GenExpectationServicesKey(key, testutil.LabelWorker)
+
+	// Only the first pods and services are created and expected.
+	if err := ctr.reconcileReplicaTypes(tfJob, nil, nil); err != nil {
+		t.Errorf("Unexpected error when reconciling pods and services: %v", err)
+	}
+	if len(fakePodControl.Templates) != 4 {
+		t.Errorf("Expected 4 pod creations, got %d", len(fakePodControl.Templates))
+	}
+	if len(fakeServiceControl.Templates) != 4 {
+		t.Errorf("Expected 4 service creations, got %d", len(fakeServiceControl.Templates))
+	}
+	for _, expectationKey := range []string{podsKey, servicesKey} {
+		exp, exists, err := ctr.Expectations.GetExpectations(expectationKey)
+		if err != nil || !exists {
+			t.Fatalf("Expected expectations for %s, got %v", expectationKey, err)
+		}
+		if add, _ := exp.GetExpectations(); add != 4 {
+			t.Errorf("Expected 4 creations to be expected for %s, got %d", expectationKey, add)
+		}
+	}
+
+	// The failed creations are not expected.
+	fakePodControl.Err = fmt.Errorf("fake error")
+	if err := ctr.reconcileReplicaTypes(tfJob, nil, nil); !errors.Is(err, ErrPodCreation) {
+		t.Errorf("Expected a pod creation error when the pod creations fail, got %v", err)
+	}
+	if !ctr.Expectations.SatisfiedExpectations(podsKey) {
+		t.Errorf("Expected the failed pod creations not to be expected")
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+const (
+	// staleServiceEndpointsReason is the reason of the event and of the
+	// condition when the services of a tfjob route to the pods of a previous
+	// tfjob of the same name.
+	staleServiceEndpointsReason = "StaleServiceEndpoints"
+	// staleServiceEndpointsDrainedReason is the reason of the condition once
+	// the stale endpoints have drained.
+	staleServiceEndpointsDrainedReason = "StaleServiceEndpointsDrained"
+)
+
+// handleStaleServiceEndpoints finds the services of the tfjob whose endpoints
+// reference the pods of a previous tfjob of the same name, which they select
+// since the services select the pods by labels, not by the UID of their
+// tfjob. Under the wait policy the StaleServiceEndpoints condition is set
+// until the endpoints drain, and the missing pods are not created meanwhile,
+// so that the new workers do not connect to the dying PS. Under the recreate
+// policy the services are deleted, and created again by the next sync once
+// their deletion is observed. It returns the services which are not deleted.
+func (tc *TFController) handleStaleServiceEndpoints(tfjob *tfv1.TFJob, services []*v1.Service) ([]*v1.Service, error) {
+	if tc.disableServiceCreation || tc.endpointsLister == nil {
+		return services, nil
+	}
+	var stale []*v1.Service
+	var descriptions []string
+	for _, service := range services {
+		if pods := tc.staleEndpointPods(tfjob, service); len(pods) > 0 {
+			stale = append(stale, service)
+			descriptions = append(descriptions, fmt.Sprintf("%s (%s)", service.Name, strings.Join(pods, ", ")))
+		}
+	}
+	if tc.staleServiceEndpointsPolicy != options.StaleServiceEndpointsPolicyRecreate {
+		tc.updateStaleServiceEndpointsCondition(tfjob, descriptions)
+		return services, nil
+	}
+
+	tc.updateStaleServiceEndpointsCondition(tfjob, nil)
+	deleted := make(map[*v1.Service]bool)
+	for i, service := range stale {
+		rt := service.Labels[tfReplicaTypeLabel]
+		msg := fmt.Sprintf("Recreating service %s/%s which routes to the pods %s of a previous TFJob %s",
+			service.Namespace, service.Name, descriptions[i], tfjob.Name)
+		if err := tc.deleteServiceWithExpectations(tfjob, rt, service, staleServiceEndpointsReason, msg); err != nil {
+			return nil, err
+		}
+		deleted[service] = true
+	}
+	var kept []*v1.Service
+	for _, service := range services {
+		if !deleted[service] {
+			kept = append(kept, service)
+		}
+	}
+	return kept, nil
+}
+
+// staleEndpointPods returns the names of the pods the endpoints of the
+// service reference, which are not controlled by the tfjob. The pods which
+// are gone or were recreated under the same name are skipped, the endpoints
+// controller removes them shortly.
+func (tc *TFController) staleEndpointPods(tfjob *tfv1.TFJob, service *v1.Service) []string {
+	if service.DeletionTimestamp != nil {
+		return nil
+	}
+	endpoints, err := tc.endpointsLister.Endpoints(service.Namespace).Get(service.Name)
+	if err != nil {
+		return nil
+	}
+	pods := sets.NewString()
+	for _, subset := range endpoints.Subsets {
+		for _, addresses := range [][]v1.EndpointAddress{subset.Addresses, subset.NotReadyAddresses} {
+			for _, address := range addresses {
+				ref := address.TargetRef
+				if ref == nil || ref.Kind != "Pod" {
+					continue
+				}
+				pod, err := tc.PodLister.Pods(service.Namespace).Get(ref.Name)
+				if err != nil || (ref.UID != "" && pod.UID != ref.UID) {
+					continue
+				}
+				if !metav1.IsControlledBy(pod, tfjob) {
+					pods.Insert(pod.Name)
+				}
+			}
+		}
+	}
+	return pods.List()
+}
+
+// updateStaleServiceEndpointsCondition sets the StaleServiceEndpoints
+// condition of the tfjob while it waits for the stale endpoints of the
+// described services to drain, and sets it to false once they have.
+func (tc *TFController) updateStaleServiceEndpointsCondition(tfjob *tfv1.TFJob, descriptions []string) {
+	if len(descriptions) > 0 {
+		sort.Strings(descriptions)
+		msg := fmt.Sprintf("The services of TFJob %s route to the pods of a previous TFJob of the same name: %s. "+
+			"Its missing pods are not created until their endpoints drain.", tfjob.Name, strings.Join(descriptions, "; "))
+		if !hasCondition(tfjob.Status.JobStatus, tfv1.JobStaleServiceEndpoints) {
+			tflogger.LoggerForJob(tfjob).Warn(msg)
+			tc.Recorder.Event(tfjob, v1.EventTypeWarning, staleServiceEndpointsReason, msg)
+		}
+		setCondition(&tfjob.Status.JobStatus, newCondition(tfv1.JobStaleServiceEndpoints, staleServiceEndpointsReason, msg))
+		return
+	}
+	if hasCondition(tfjob.Status.JobStatus, tfv1.JobStaleServiceEndpoints) {
+		msg := fmt.Sprintf("The stale endpoints of the services of TFJob %s have drained.", tfjob.Name)
+		condition := newCondition(tfv1.JobStaleServiceEndpoints, staleServiceEndpointsDrainedReason, msg)
+		condition.Status = v1.ConditionFalse
+		setCondition(&tfjob.Status.JobStatus, condition)
+	}
+}
+
+// addEndpoints syncs the tfjob whose service the endpoints belong to.
+func (tc *TFController) addEndpoints(obj interface{}) {
+	if endpoints, ok := obj.(*v1.Endpoints); ok {
+		tc.enqueueEndpointsTFJob(endpoints)
+	}
+}
+
+// updateEndpoints syncs the tfjob whose service the endpoints belong to when
+// the addresses change, e.g. when the stale ones drain.
+func (tc *TFController) updateEndpoints(old, cur interface{}) {
+	oldEndpoints, ok := old.(*v1.Endpoints)
+	if !ok {
+		return
+	}
+	curEndpoints, ok := cur.(*v1.Endpoints)
+	if !ok || reflect.DeepEqual(oldEndpoints.Subsets, curEndpoints.Subsets) {
+		return
+	}
+	tc.enqueueEndpointsTFJob(curEndpoints)
+}
+
+// enqueueEndpointsTFJob syncs the tfjob controlling the service of the same
+// name as the endpoints.
+func (tc *TFController) enqueueEndpointsTFJob(endpoints *v1.Endpoints) {
+	service, err := tc.ServiceLister.Services(endpoints.Namespace).Get(endpoints.Name)
+	if err != nil {
+		return
+	}
+	controllerRef := metav1.GetControllerOf(service)
+	if controllerRef == nil || controllerRef.Kind != tfv1.Kind {
+		return
+	}
+	tc.WorkQueue.Add(endpoints.Namespace + "/" + controllerRef.Name)
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+// newStaleEndpoints returns the endpoints of the service routing to the pod.
+func newStaleEndpoints(service *v1.Service, pod *v1.Pod) *v1.Endpoints {
+	return &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: service.Namespace},
+		Subsets: []v1.EndpointSubset{{
+			NotReadyAddresses: []v1.EndpointAddress{{
+				IP:        "10.0.0.1",
+				TargetRef: &v1.ObjectReference{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID},
+			}},
+		}},
+	}
+}
+
+func TestStaleServiceEndpoints(t *testing.T) {
+	for _, policy := range []string{options.StaleServiceEndpointsPolicyWait, options.StaleServiceEndpointsPolicyRecreate} {
+		ctr, fakePodControl, fakeServiceControl := newErrorsTestController()
+		endpointsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		ctr.endpointsLister = corelisters.NewEndpointsLister(endpointsIndexer)
+		ctr.staleServiceEndpointsPolicy = policy
+
+		tfJob := testutil.NewTFJob(1, 1)
+		tfJob.UID = types.UID("current")
+		service := testutil.NewService(tfJob, testutil.LabelPS, 0, t)
+		services := []*v1.Service{service, testutil.NewService(tfJob, testutil.LabelWorker, 0, t)}
+
+		// The terminating PS pod of the previous tfjob of the same name.
+		previous := testutil.NewTFJob(1, 1)
+		previous.UID = types.UID("previous")
+		pod := testutil.NewPod(previous, testutil.LabelPS, 0, t)
+		pod.UID = types.UID("previous-ps-0")
+		now := metav1.Now()
+		pod.DeletionTimestamp = &now
+		if err := ctr.podIndexer.Add(pod); err != nil {
+			t.Fatalf("Failed to add the pod: %v", err)
+		}
+		if err := endpointsIndexer.Add(newStaleEndpoints(service, pod)); err != nil {
+			t.Fatalf("Failed to add the endpoints: %v", err)
+		}
+
+		kept, err := ctr.handleStaleServiceEndpoints(tfJob, services)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", policy, err)
+		}
+		if policy == options.StaleServiceEndpointsPolicyRecreate {
+			// The service is deleted, and created again by the next sync.
+			if len(fakeServiceControl.DeleteServiceName) != 1 || fakeServiceControl.DeleteServiceName[0] != service.Name {
+				t.Errorf("%s: expected the service %s deleted, got %v", policy, service.Name, fakeServiceControl.DeleteServiceName)
+			}
+			if len(kept) != 1 || kept[0] == service {
+				t.Errorf("%s: expected the deleted service not to be reconciled, got %v", policy, kept)
+			}
+			if hasCondition(tfJob.Status.JobStatus, tfv1.JobStaleServiceEndpoints) {
+				t.Errorf("%s: expected the tfjob not to wait, got %v", policy, tfJob.Status.Conditions)
+			}
+			continue
+		}
+
+		// The tfjob waits without creating its missing pods.
+		if len(fakeServiceControl.DeleteServiceName) != 0 || len(kept) != len(services) {
+			t.Errorf("%s: expected the services kept, got %v deleted", policy, fakeServiceControl.DeleteServiceName)
+		}
+		if !hasCondition(tfJob.Status.JobStatus, tfv1.JobStaleServiceEndpoints) {
+			t.Fatalf("%s: expected the tfjob to wait for the endpoints to drain, got %v", policy, tfJob.Status.Conditions)
+		}
+		if err := ctr.reconcileReplicaTypes(tfJob, nil, nil); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling pods: %v", policy, err)
+		}
+		if len(fakePodControl.Templates) != 0 {
+			t.Errorf("%s: expected no pods created while waiting, got %d", policy, len(fakePodControl.Templates))
+		}
+
+		// The pod of the previous tfjob is gone, the tfjob proceeds.
+		if err := ctr.podIndexer.Delete(pod); err != nil {
+			t.Fatalf("Failed to delete the pod: %v", err)
+		}
+		if _, err := ctr.handleStaleServiceEndpoints(tfJob, services); err != nil {
+			t.Fatalf("%s: unexpected error: %v", policy, err)
+		}
+		if condition := getCondition(tfJob.Status.JobStatus, tfv1.JobStaleServiceEndpoints); condition == nil || condition.Status != v1.ConditionFalse {
+			t.Errorf("%s: expected the stale endpoints drained, got %v", policy, tfJob.Status.Conditions)
+		}
+		if err := ctr.reconcileReplicaTypes(tfJob, nil, nil); err != nil {
+			t.Fatalf("%s: unexpected error when reconciling pods: %v", policy, err)
+		}
+		if len(fakePodControl.Templates) != 2 {
+			t.Errorf("%s: expected the PS and worker pods created once the endpoints drained, got %d", policy, len(fakePodControl.Templates))
+		}
+	}
+}
+
+func TestStaleServiceEndpointsIgnoresCurrentPods(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	endpointsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	ctr.endpointsLister = corelisters.NewEndpointsLister(endpointsIndexer)
+	tfJob := testutil.NewTFJob(1, 1)
+	tfJob.UID = types.UID("current")
+	service := testutil.NewService(tfJob, testutil.LabelPS, 0, t)
+
+	// The endpoints still reference the previous pod of the replica, which
+	// was recreated under the same name.
+	pod := testutil.NewPod(tfJob, testutil.LabelPS, 0, t)
+	pod.UID = types.UID("current-ps-0")
+	if err := ctr.podIndexer.Add(pod); err != nil {
+		t.Fatalf("Failed to add the pod: %v", err)
+	}
+	endpoints := newStaleEndpoints(service, pod)
+	endpoints.Subsets[0].NotReadyAddresses[0].TargetRef.UID = types.UID("restarted-ps-0")
+	if err := endpointsIndexer.Add(endpoints); err != nil {
+		t.Fatalf("Failed to add the endpoints: %v", err)
+	}
+	if pods := ctr.staleEndpointPods(tfJob, service); len(pods) != 0 {
+		t.Errorf("Expected no stale pods for a recreated pod, got %v", pods)
+	}
+
+	// The endpoints of the pods of the tfjob are not stale.
+	endpoints = newStaleEndpoints(service, pod)
+	if err := endpointsIndexer.Update(endpoints); err != nil {
+		t.Fatalf("Failed to update the endpoints: %v", err)
+	}
+	if pods := ctr.staleEndpointPods(tfJob, service); len(pods) != 0 {
+		t.Errorf("Expected no stale pods for the pods of the tfjob, got %v", pods)
+	}
+}
@@ -17,6 +17,8 @@ package tensorflow
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	common "github.com/kubeflow/common/job_controller/api/v1"
@@ -38,10 +40,27 @@ const (
 	tfJobRunningReason = "TFJobRunning"
 	// tfJobFailedReason is added in a tfjob when it is failed.
 	tfJobFailedReason = "TFJobFailed"
+	// tfJobBackoffLimitExceededReason is added in a tfjob when it is failed
+	// because its containers restarted in place past the backoff limit.
+	tfJobBackoffLimitExceededReason = "TFJobBackoffLimitExceeded"
 	// tfJobRestarting is added in a tfjob when it is restarting.
 	tfJobRestartingReason = "TFJobRestarting"
+	// tfJobTrainingSucceededReason is added in a tfjob when its training is
+	// succeeded and its evaluator starts after training.
+	tfJobTrainingSucceededReason = "TFJobTrainingSucceeded"
+	// tfJobEvaluatorFailedReason is added in a tfjob when its evaluator which
+	// starts after training is failed.
+	tfJobEvaluatorFailedReason = "TFJobEvaluatorFailed"
+	// podGroupSyncFailedReason is added in a tfjob when its PodGroup cannot be synced.
+	podGroupSyncFailedReason = "PodGroupSyncFailed"
+	// podGroupSyncedReason is added in a tfjob when its PodGroup is synced again.
+	podGroupSyncedReason = "PodGroupSynced"
 )
 
+// maxConditions is the maximum number of conditions of a tfjob, past which
+// the least recently updated false ones are dropped.
+const maxConditions = 10
+
 var (
 	tfJobsSuccessCount = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "tf_operator_jobs_successful_total",
@@ -84,11 +103,13 @@ func (tc *TFController) updateStatusSingle(tfjob *tfv1.TFJob, rtype tfv1.TFRepli
 		}
 	}
 
-	// If the TFJob contains Chief or Master spec, then we will update the status
-	// according to the Chief/Master spec.
-	if ContainChieforMasterSpec(tfjob) {
-		if tfv1.IsChieforMaster(rtype) {
-			if running > 0 {
+	// If the coordinator of the TFJob is a Chief or Master, then we will update
+	// the status according to its replica type only: the Master is preferred
+	// over the Chief if the TFJob defines both, see electCoordinator.
+	if leader := leaderReplicaType(tfjob); tfv1.IsChieforMaster(leader) {
+		if rtype == leader {
+			// A restarting tfjob runs again once all its replicas do.
+			if running > 0 && restartSettled(tfjob) {
 				msg := fmt.Sprintf("TFJob %s is running.", tfjob.Name)
 				err := updateTFJobConditions(tfjob, common.JobRunning, tfJobRunningReason, msg)
 				if err != nil {
@@ -97,38 +118,22 @@ func (tc *TFController) updateStatusSingle(tfjob *tfv1.TFJob, rtype tfv1.TFRepli
 				}
 			}
 			if expected == 0 {
-				msg := fmt.Sprintf("TFJob %s successfully completed.", tfjob.Name)
-				tc.Recorder.Event(tfjob, v1.EventTypeNormal, tfJobSucceededReason, msg)
-				if tfjob.Status.CompletionTime == nil {
-					now := metav1.Now()
-					tfjob.Status.CompletionTime = &now
-				}
-				err := updateTFJobConditions(tfjob, common.JobSucceeded, tfJobSucceededReason, msg)
-				if err != nil {
-					tflogger.LoggerForJob(tfjob).Infof("Append tfjob condition error: %v", err)
+				if err := tc.succeedTraining(tfjob); err != nil {
 					return err
 				}
-				tfJobsSuccessCount.Inc()
 			}
 		}
 	} else {
 		if rtype == tfv1.TFReplicaTypeWorker {
 			// All workers are succeeded or worker 0 completed, leave a succeeded condition.
-			if expected == 0 || worker0Completed {
-				msg := fmt.Sprintf("TFJob %s successfully completed.", tfjob.Name)
-				tc.Recorder.Event(tfjob, v1.EventTypeNormal, tfJobSucceededReason, msg)
-				if tfjob.Status.CompletionTime == nil {
-					now := metav1.Now()
-					tfjob.Status.CompletionTime = &now
-				}
-				err := updateTFJobConditions(tfjob, common.JobSucceeded, tfJobSucceededReason, msg)
-				if err != nil {
-					tflogger.LoggerForJob(tfjob).Infof("Append tfjob condition error: %v", err)
+			// Worker 0 completing is ignored when all the workers are required to succeed.
+			if expected == 0 || (worker0Completed && !requiresAllWorkers(tfjob)) {
+				if err := tc.succeedTraining(tfjob); err != nil {
 					return err
 				}
-				tfJobsSuccessCount.Inc()
-			} else if running > 0 {
+			} else if running > 0 && restartSettled(tfjob) {
 				// Some workers are still running, leave a running condition.
+				// A restarting tfjob runs again once all its replicas do.
 				msg := fmt.Sprintf("TFJob %s is running.", tfjob.Name)
 				err := updateTFJobConditions(tfjob, common.JobRunning, tfJobRunningReason, msg)
 				if err != nil {
@@ -139,6 +144,31 @@ func (tc *TFController) updateStatusSingle(tfjob *tfv1.TFJob, rtype tfv1.TFRepli
 		}
 	}
 
+	// The evaluator which starts after training completes the tfjob.
+	if tfv1.IsEvaluator(rtype) && evaluatorStartsAfterTraining(tfjob) &&
+		isTrainingSucceeded(tfjob.Status.JobStatus) && expected == 0 {
+		if err := tc.succeedTFJob(tfjob); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 && ignoresFailures(tfjob, rtype) {
+		// The failures of the best-effort replicas, and of the replicas with
+		// the Ignore failure policy, neither fail nor restart the tfjob.
+		return nil
+	}
+
+	if failed > 0 && isIgnoredForSuccess(tfjob, rtype) && isSucceeded(tfjob.Status.JobStatus) {
+		// The replicas deleted once the tfjob succeeded do not fail it.
+		return nil
+	}
+
+	if failed > 0 && isFailed(tfjob.Status.JobStatus) {
+		// The tfjob already failed with a more specific reason, e.g. a PS
+		// pod failed.
+		return nil
+	}
+
 	if failed > 0 {
 		if restart {
 			msg := fmt.Sprintf("TFJob %s is restarting because %d %s replica(s) failed.",
@@ -154,12 +184,16 @@ func (tc *TFController) updateStatusSingle(tfjob *tfv1.TFJob, rtype tfv1.TFRepli
 		} else {
 			msg := fmt.Sprintf("TFJob %s has failed because %d %s replica(s) failed.",
 				tfjob.Name, failed, rtype)
-			tc.Recorder.Event(tfjob, v1.EventTypeNormal, tfJobFailedReason, msg)
+			reason := tfJobFailedReason
+			if tfv1.IsEvaluator(rtype) && evaluatorStartsAfterTraining(tfjob) {
+				reason = tfJobEvaluatorFailedReason
+			}
+			tc.Recorder.Event(tfjob, v1.EventTypeNormal, reason, msg)
 			if tfjob.Status.CompletionTime == nil {
 				now := metav1.Now()
 				tfjob.Status.CompletionTime = &now
 			}
-			err := updateTFJobConditions(tfjob, common.JobFailed, tfJobFailedReason, msg)
+			err := updateTFJobConditions(tfjob, common.JobFailed, reason, msg)
 			if err != nil {
 				tflogger.LoggerForJob(tfjob).Infof("Append tfjob condition error: %v", err)
 				return err
@@ -177,17 +211,80 @@ func (tc *TFController) updateTFJobStatus(tfjob *tfv1.TFJob) error {
 		tflogger.LoggerForJob(tfjob).Infof("Finished updating TFJobs Status %q (%v)",
 			tfjob.Name, time.Since(startTime))
 	}()
+	if err := tc.persistRecordedAnnotations(tfjob); err != nil {
+		return err
+	}
+	tfjob.Status.State = jobState(tfjob.Status.JobStatus)
+	tfjob.Status.Phase = jobPhase(tfjob.Status)
 	_, err := tc.tfJobClientSet.KubeflowV1().TFJobs(tfjob.Namespace).UpdateStatus(tfjob)
 	return err
 }
 
+// requiresAllWorkers returns true if the tfjob only succeeds once all its
+// workers have succeeded.
+func requiresAllWorkers(tfjob *tfv1.TFJob) bool {
+	return tfjob.Spec.SuccessPolicy != nil && *tfjob.Spec.SuccessPolicy == tfv1.SuccessPolicyAllWorkers
+}
+
+// succeedTraining leaves a succeeded condition once the training replicas
+// have completed, unless the evaluator has yet to run after the training.
+func (tc *TFController) succeedTraining(tfjob *tfv1.TFJob) error {
+	if !evaluatorStartsAfterTraining(tfjob) {
+		return tc.succeedTFJob(tfjob)
+	}
+	if isTrainingSucceeded(tfjob.Status.JobStatus) {
+		return nil
+	}
+	msg := fmt.Sprintf("TFJob %s training successfully completed, starting the evaluator.", tfjob.Name)
+	tc.Recorder.Event(tfjob, v1.EventTypeNormal, tfJobTrainingSucceededReason, msg)
+	err := updateTFJobConditions(tfjob, tfv1.JobTrainingSucceeded, tfJobTrainingSucceededReason, msg)
+	if err != nil {
+		tflogger.LoggerForJob(tfjob).Infof("Append tfjob condition error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// succeedTFJob leaves a succeeded condition in the tfjob.
+func (tc *TFController) succeedTFJob(tfjob *tfv1.TFJob) error {
+	msg := fmt.Sprintf("TFJob %s successfully completed.", tfjob.Name)
+	tc.Recorder.Event(tfjob, v1.EventTypeNormal, tfJobSucceededReason, msg)
+	if tfjob.Status.CompletionTime == nil {
+		now := metav1.Now()
+		tfjob.Status.CompletionTime = &now
+	}
+	err := updateTFJobConditions(tfjob, common.JobSucceeded, tfJobSucceededReason, msg)
+	if err != nil {
+		tflogger.LoggerForJob(tfjob).Infof("Append tfjob condition error: %v", err)
+		return err
+	}
+	tfJobsSuccessCount.Inc()
+	return nil
+}
+
 // updateTFJobConditions updates the conditions of the given tfjob.
 func updateTFJobConditions(tfjob *tfv1.TFJob, conditionType common.JobConditionType, reason, message string) error {
 	condition := newCondition(conditionType, reason, message)
-	setCondition(&tfjob.Status, condition)
+	setCondition(&tfjob.Status.JobStatus, condition)
 	return nil
 }
 
+// updatePodGroupSyncCondition sets the PodGroupSyncFailed condition of the
+// tfjob if the PodGroup could not be synced, and clears it once it is.
+func updatePodGroupSyncCondition(tfjob *tfv1.TFJob, syncErr error) {
+	if syncErr != nil {
+		msg := fmt.Sprintf("Failed to sync the PodGroup of TFJob %s: %v", tfjob.Name, syncErr)
+		setCondition(&tfjob.Status.JobStatus, newCondition(tfv1.JobPodGroupSyncFailed, podGroupSyncFailedReason, msg))
+		return
+	}
+	if hasCondition(tfjob.Status.JobStatus, tfv1.JobPodGroupSyncFailed) {
+		msg := fmt.Sprintf("The PodGroup of TFJob %s is synced.", tfjob.Name)
+		condition := newCondition(tfv1.JobPodGroupSyncFailed, podGroupSyncedReason, msg)
+		condition.Status = v1.ConditionFalse
+		setCondition(&tfjob.Status.JobStatus, condition)
+	}
+}
+
 // initializeTFReplicaStatuses initializes the ReplicaStatuses for replica.
 func initializeTFReplicaStatuses(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType) {
 	commonType := common.ReplicaType(rtype)
@@ -200,17 +297,60 @@ func initializeTFReplicaStatuses(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType) {
 
 // updateTFJobReplicaStatuses updates the TFJobReplicaStatuses according to the pod.
 func updateTFJobReplicaStatuses(tfjob *tfv1.TFJob, rtype tfv1.TFReplicaType, pod *v1.Pod) {
-	commonType := common.ReplicaType(rtype)
-	switch pod.Status.Phase {
+	countReplicaPod(tfjob.Status.ReplicaStatuses[common.ReplicaType(rtype)], pod)
+}
+
+// countReplicaPod counts the pod in the status of its replica type.
+func countReplicaPod(status *common.ReplicaStatus, pod *v1.Pod) {
+	switch replicaPodPhase(pod) {
 	case v1.PodRunning:
-		tfjob.Status.ReplicaStatuses[commonType].Active++
+		status.Active++
 	case v1.PodSucceeded:
-		tfjob.Status.ReplicaStatuses[commonType].Succeeded++
+		status.Succeeded++
 	case v1.PodFailed:
-		tfjob.Status.ReplicaStatuses[commonType].Failed++
+		status.Failed++
 	}
 }
 
+// GetReplicaStatuses returns the replica statuses of the tfjob computed from
+// its pods with the semantics of the operator, so that other controllers can
+// aggregate them without approximating them. The pods must be the ones of the
+// tfjob, e.g. listed with the labels and the controller reference the
+// operator sets. For each replica index, only the pod the operator keeps is
+// counted, and the phase of the pods with sidecars is the one of their
+// tensorflow container. The replica types released after training are not
+// counted. The tfjob is not modified.
+func GetReplicaStatuses(tfjob *tfv1.TFJob, pods []*v1.Pod) map[common.ReplicaType]*common.ReplicaStatus {
+	tfjob = tfjob.DeepCopy()
+	tfv1.SetObjectDefaults_TFJob(tfjob)
+
+	statuses := make(map[common.ReplicaType]*common.ReplicaStatus, len(tfjob.Spec.TFReplicaSpecs))
+	for rtype, spec := range tfjob.Spec.TFReplicaSpecs {
+		status := &common.ReplicaStatus{}
+		statuses[common.ReplicaType(rtype)] = status
+		if isReleasedAfterTraining(tfjob, rtype) {
+			continue
+		}
+		rt := strings.ToLower(string(rtype))
+		replicas := int(*spec.Replicas)
+		podsByIndex := make(map[int][]*v1.Pod, replicas)
+		for _, pod := range pods {
+			if pod.Labels[tfReplicaTypeLabel] != rt {
+				continue
+			}
+			index, err := strconv.Atoi(pod.Labels[tfReplicaIndexLabel])
+			if err != nil || index < 0 || index >= replicas {
+				continue
+			}
+			podsByIndex[index] = append(podsByIndex[index], pod)
+		}
+		for _, podSlice := range podsByIndex {
+			countReplicaPod(status, sortDuplicatePods(podSlice)[0])
+		}
+	}
+	return statuses
+}
+
 // newCondition creates a new tfjob condition.
 func newCondition(conditionType common.JobConditionType, reason, message string) common.JobCondition {
 	return common.JobCondition{
@@ -250,15 +390,66 @@ func isFailed(status common.JobStatus) bool {
 	return hasCondition(status, common.JobFailed)
 }
 
+// jobState returns the type of the most recently updated true condition
+// among the lifecycle conditions, or an empty type if there is none.
+func jobState(status common.JobStatus) common.JobConditionType {
+	var state common.JobConditionType
+	for _, condition := range status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case common.JobCreated, common.JobRunning, common.JobRestarting, common.JobSucceeded, common.JobFailed:
+			state = condition.Type
+		}
+	}
+	return state
+}
+
+// jobPhase returns the phase summarizing the conditions of the status. A
+// terminal phase is kept whatever the conditions. If the tfjob both failed
+// and succeeded, the most recent of the two wins.
+func jobPhase(status tfv1.TFJobStatus) tfv1.TFJobPhase {
+	if status.Phase == tfv1.TFJobPhaseSucceeded || status.Phase == tfv1.TFJobPhaseFailed {
+		return status.Phase
+	}
+	state := jobState(status.JobStatus)
+	switch {
+	case state == common.JobFailed || state != common.JobSucceeded && isFailed(status.JobStatus):
+		return tfv1.TFJobPhaseFailed
+	case isSucceeded(status.JobStatus):
+		return tfv1.TFJobPhaseSucceeded
+	case hasCondition(status.JobStatus, tfv1.JobPaused):
+		return tfv1.TFJobPhaseSuspended
+	}
+	switch state {
+	case common.JobCreated:
+		return tfv1.TFJobPhaseCreated
+	case common.JobRunning:
+		return tfv1.TFJobPhaseRunning
+	case common.JobRestarting:
+		return tfv1.TFJobPhaseRestarting
+	}
+	return ""
+}
+
 // setCondition updates the tfjob to include the provided condition.
 // If the condition that we are about to add already exists
 // and has the same status and reason then we are not going to update.
+// The updated condition is moved last, so that the conditions are ordered
+// from the least to the most recently updated, and its LastTransitionTime
+// only changes with its status.
 func setCondition(status *common.JobStatus, condition common.JobCondition) {
 	// Do nothing if TFJobStatus is completed.
 	if isFailed(*status) || isSucceeded(*status) {
 		return
 	}
+	replaceCondition(status, condition)
+}
 
+// replaceCondition replaces the condition of the same type in the status
+// with the provided one, even if the tfjob is completed.
+func replaceCondition(status *common.JobStatus, condition common.JobCondition) {
 	currentCond := getCondition(*status, condition.Type)
 
 	if currentCond != nil {
@@ -275,30 +466,64 @@ func setCondition(status *common.JobStatus, condition common.JobCondition) {
 
 	// Append the updated condition to the status.Conditions.
 	newConditions := filterOutCondition(status.Conditions, condition.Type)
-	status.Conditions = append(newConditions, condition)
+	status.Conditions = capConditions(append(newConditions, condition))
 }
 
 // filterOutCondition returns a new slice of tfjob conditions without conditions with the provided type.
+// The conditions the provided type supersedes, e.g. Running for Restarting,
+// are kept with their status set to false, so that the tfjob keeps the
+// history of its transitions.
 func filterOutCondition(conditions []common.JobCondition, condType common.JobConditionType) []common.JobCondition {
 	var newConditions []common.JobCondition
 	for _, c := range conditions {
-		if condType == common.JobRestarting && c.Type == common.JobRunning {
-			continue
-		}
-		if condType == common.JobRunning && c.Type == common.JobRestarting {
-			continue
-		}
-
 		if c.Type == condType {
 			continue
 		}
 
-		// Set the running condition status to be false when current condition failed or succeeded
-		if (condType == common.JobFailed || condType == common.JobSucceeded) && c.Type == common.JobRunning {
+		// Set the running condition status to be false when current condition failed or succeeded,
+		// and the running and restarting conditions to be false when the other one is set.
+		if supersedesCondition(condType, c.Type) && c.Status == v1.ConditionTrue {
+			now := metav1.Now()
 			c.Status = v1.ConditionFalse
+			c.LastUpdateTime = now
+			c.LastTransitionTime = now
 		}
 
 		newConditions = append(newConditions, c)
 	}
 	return newConditions
 }
+
+// supersedesCondition returns true if the condition of the given type is no
+// longer true once the condition of the new type is.
+func supersedesCondition(newType, condType common.JobConditionType) bool {
+	switch newType {
+	case common.JobRestarting:
+		return condType == common.JobRunning
+	case common.JobRunning:
+		return condType == common.JobRestarting
+	case common.JobFailed, common.JobSucceeded:
+		return condType == common.JobRunning || condType == common.JobRestarting
+	case tfv1.JobHookSucceeded, tfv1.JobHookFailed:
+		return condType == tfv1.JobHookRunning
+	}
+	return false
+}
+
+// capConditions drops the least recently updated false conditions past
+// maxConditions. The true conditions are always kept.
+func capConditions(conditions []common.JobCondition) []common.JobCondition {
+	excess := len(conditions) - maxConditions
+	if excess <= 0 {
+		return conditions
+	}
+	var capped []common.JobCondition
+	for _, c := range conditions {
+		if excess > 0 && c.Status != v1.ConditionTrue {
+			excess--
+			continue
+		}
+		capped = append(capped, c)
+	}
+	return capped
+}
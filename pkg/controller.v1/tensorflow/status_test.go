@@ -16,10 +16,14 @@
 package tensorflow
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
+	"time"
 
 	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeclientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/record"
@@ -29,6 +33,7 @@ import (
 	common "github.com/kubeflow/common/job_controller/api/v1"
 	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
 	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
+	tfjobfake "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned/fake"
 	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
 )
 
@@ -270,6 +275,54 @@ func TestStatus(t *testing.T) {
 			worker0Completed:        true,
 			expectedType:            common.JobSucceeded,
 		},
+		testCase{
+			description:             "(Default success policy) worker-0 are succeeded, 3 workers are active",
+			tfJob:                   newTFJobWithSuccessPolicy(4, 2, tfv1.SuccessPolicyDefault),
+			expectedFailedPS:        0,
+			expectedSucceededPS:     0,
+			expectedActivePS:        2,
+			expectedFailedWorker:    0,
+			expectedSucceededWorker: 1,
+			expectedActiveWorker:    3,
+			expectedFailedChief:     0,
+			expectedSucceededChief:  0,
+			expectedActiveChief:     0,
+			restart:                 false,
+			worker0Completed:        true,
+			expectedType:            common.JobSucceeded,
+		},
+		testCase{
+			description:             "(AllWorkers success policy) worker-0 are succeeded, 3 workers are active",
+			tfJob:                   newTFJobWithSuccessPolicy(4, 2, tfv1.SuccessPolicyAllWorkers),
+			expectedFailedPS:        0,
+			expectedSucceededPS:     0,
+			expectedActivePS:        2,
+			expectedFailedWorker:    0,
+			expectedSucceededWorker: 1,
+			expectedActiveWorker:    3,
+			expectedFailedChief:     0,
+			expectedSucceededChief:  0,
+			expectedActiveChief:     0,
+			restart:                 false,
+			worker0Completed:        true,
+			expectedType:            common.JobRunning,
+		},
+		testCase{
+			description:             "(AllWorkers success policy) all workers are succeeded",
+			tfJob:                   newTFJobWithSuccessPolicy(4, 2, tfv1.SuccessPolicyAllWorkers),
+			expectedFailedPS:        0,
+			expectedSucceededPS:     0,
+			expectedActivePS:        2,
+			expectedFailedWorker:    0,
+			expectedSucceededWorker: 4,
+			expectedActiveWorker:    0,
+			expectedFailedChief:     0,
+			expectedSucceededChief:  0,
+			expectedActiveChief:     0,
+			restart:                 false,
+			worker0Completed:        true,
+			expectedType:            common.JobSucceeded,
+		},
 		testCase{
 			description:             "Chief is running, workers are failed",
 			tfJob:                   testutil.NewTFJobWithChief(4, 2),
@@ -450,7 +503,7 @@ func TestStatus(t *testing.T) {
 		}
 
 		// Test filterOutCondition
-		filterOutConditionTest(c.tfJob.Status, t)
+		filterOutConditionTest(c.tfJob.Status.JobStatus, t)
 
 		found := false
 		for _, condition := range c.tfJob.Status.Conditions {
@@ -464,6 +517,12 @@ func TestStatus(t *testing.T) {
 	}
 }
 
+func newTFJobWithSuccessPolicy(worker, ps int, policy tfv1.SuccessPolicy) *tfv1.TFJob {
+	tfJob := testutil.NewTFJob(worker, ps)
+	tfJob.Spec.SuccessPolicy = &policy
+	return tfJob
+}
+
 func setStatusForTest(tfJob *tfv1.TFJob, typ tfv1.TFReplicaType, failed, succeeded, active int32, t *testing.T) {
 	pod := testutil.NewBasePod("pod", tfJob, t)
 	var i int32
@@ -489,3 +548,221 @@ func filterOutConditionTest(status common.JobStatus, t *testing.T) {
 		}
 	}
 }
+
+func TestGetReplicaStatuses(t *testing.T) {
+	ctr, _ := newPodIndexTestController()
+	tfJob := testutil.NewTFJob(3, 1)
+
+	newPod := func(typ string, index int, phase v1.PodPhase) *v1.Pod {
+		pod := testutil.NewPod(tfJob, typ, index, t)
+		pod.Status.Phase = phase
+		return pod
+	}
+	// Worker 1 has a duplicate, of which the running pod is kept.
+	duplicate := newPod(testutil.LabelWorker, 1, v1.PodFailed)
+	duplicate.Name += "-duplicate"
+	pods := []*v1.Pod{
+		newPod(testutil.LabelWorker, 0, v1.PodRunning),
+		newPod(testutil.LabelWorker, 1, v1.PodRunning),
+		duplicate,
+		newPod(testutil.LabelWorker, 2, v1.PodSucceeded),
+		// Out of the range of the replicas.
+		newPod(testutil.LabelWorker, 3, v1.PodFailed),
+		newPod(testutil.LabelPS, 0, v1.PodFailed),
+	}
+
+	statuses := GetReplicaStatuses(tfJob, pods)
+	expected := map[common.ReplicaType]*common.ReplicaStatus{
+		common.ReplicaType(tfv1.TFReplicaTypeWorker): {Active: 2, Succeeded: 1},
+		common.ReplicaType(tfv1.TFReplicaTypePS):     {Failed: 1},
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected the replica statuses %v, got %v", expected, statuses)
+	}
+	if tfJob.Status.ReplicaStatuses != nil {
+		t.Errorf("Expected the tfjob not to be modified, got %v", tfJob.Status.ReplicaStatuses)
+	}
+
+	// The statuses are the ones the operator computes when reconciling.
+	podsByType := make(map[string][]*v1.Pod)
+	for _, pod := range pods {
+		rt := pod.Labels[tfReplicaTypeLabel]
+		podsByType[rt] = append(podsByType[rt], pod)
+	}
+	if err := ctr.reconcileReplicaTypes(tfJob, podsByType, nil); err != nil {
+		t.Fatalf("Unexpected error when reconciling the pods: %v", err)
+	}
+	if !reflect.DeepEqual(tfJob.Status.ReplicaStatuses, statuses) {
+		t.Errorf("Expected the replica statuses of the operator %v, got %v", tfJob.Status.ReplicaStatuses, statuses)
+	}
+}
+
+func TestConditionHistory(t *testing.T) {
+	tfJob := testutil.NewTFJob(1, 0)
+	conditionTypes := func() []common.JobConditionType {
+		var types []common.JobConditionType
+		for _, condition := range tfJob.Status.Conditions {
+			types = append(types, condition.Type)
+		}
+		return types
+	}
+
+	if err := updateTFJobConditions(tfJob, common.JobCreated, tfJobCreatedReason, "created"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := updateTFJobConditions(tfJob, common.JobRunning, tfJobRunningReason, "running"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The transition is in the past, to tell it from the updates below.
+	transition := metav1.NewTime(time.Now().Add(-time.Hour))
+	tfJob.Status.Conditions[1].LastTransitionTime = transition
+
+	if err := updateTFJobConditions(tfJob, common.JobRunning, tfJobRunningReason, "still running"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	running := getCondition(tfJob.Status.JobStatus, common.JobRunning)
+	if running.Message != "still running" || !running.LastTransitionTime.Equal(&transition) {
+		t.Errorf("Expected only the message of the running condition to change, got %v", running)
+	}
+
+	// The tfjob flaps between running and restarting.
+	if err := updateTFJobConditions(tfJob, common.JobRestarting, tfJobRestartingReason, "restarting"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	running = getCondition(tfJob.Status.JobStatus, common.JobRunning)
+	if running == nil || running.Status != v1.ConditionFalse || running.LastTransitionTime.Equal(&transition) {
+		t.Errorf("Expected the running condition to be kept as false, got %v", running)
+	}
+	if expected := []common.JobConditionType{common.JobCreated, common.JobRunning, common.JobRestarting}; !reflect.DeepEqual(conditionTypes(), expected) {
+		t.Errorf("Expected the conditions %v, got %v", expected, conditionTypes())
+	}
+	if err := updateTFJobConditions(tfJob, common.JobRunning, tfJobRunningReason, "running again"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if restarting := getCondition(tfJob.Status.JobStatus, common.JobRestarting); restarting == nil || restarting.Status != v1.ConditionFalse {
+		t.Errorf("Expected the restarting condition to be kept as false, got %v", restarting)
+	}
+	if expected := []common.JobConditionType{common.JobCreated, common.JobRestarting, common.JobRunning}; !reflect.DeepEqual(conditionTypes(), expected) {
+		t.Errorf("Expected the most recent condition last in %v, got %v", expected, conditionTypes())
+	}
+
+	// The false conditions are dropped first past the maximum.
+	for i := 0; i < maxConditions; i++ {
+		condition := newCondition(common.JobConditionType(fmt.Sprintf("Custom%d", i)), "Reason", "message")
+		condition.Status = v1.ConditionFalse
+		setCondition(&tfJob.Status.JobStatus, condition)
+	}
+	if len(tfJob.Status.Conditions) != maxConditions {
+		t.Errorf("Expected %d conditions, got %d", maxConditions, len(tfJob.Status.Conditions))
+	}
+	if !hasCondition(tfJob.Status.JobStatus, common.JobCreated) || !hasCondition(tfJob.Status.JobStatus, common.JobRunning) {
+		t.Errorf("Expected the true conditions to be kept, got %v", conditionTypes())
+	}
+	if getCondition(tfJob.Status.JobStatus, common.JobRestarting) != nil {
+		t.Errorf("Expected the oldest false condition to be dropped, got %v", conditionTypes())
+	}
+}
+
+func TestJobState(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	tfJob := testutil.NewTFJob(1, 0)
+	tfJobClientSet := tfjobfake.NewSimpleClientset(tfJob)
+	ctr.tfJobClientSet = tfJobClientSet
+	tfJob = tfJob.DeepCopy()
+
+	storedState := func() common.JobConditionType {
+		if err := ctr.updateTFJobStatus(tfJob); err != nil {
+			t.Fatalf("Unexpected error when updating the status: %v", err)
+		}
+		stored, err := tfJobClientSet.KubeflowV1().TFJobs(tfJob.Namespace).Get(tfJob.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error when getting the tfjob: %v", err)
+		}
+		return stored.Status.State
+	}
+
+	if state := storedState(); state != "" {
+		t.Errorf("Expected no state without conditions, got %q", state)
+	}
+	for _, condType := range []common.JobConditionType{common.JobCreated, common.JobRunning, common.JobRestarting, common.JobRunning} {
+		if err := updateTFJobConditions(tfJob, condType, "Reason", "message"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if state := storedState(); state != condType {
+			t.Errorf("Expected the state %q, got %q", condType, state)
+		}
+	}
+	// The other conditions do not change the state.
+	tfJob.Annotations = map[string]string{tfv1.AnnotationPaused: "true"}
+	updatePausedCondition(tfJob)
+	if state := storedState(); state != common.JobRunning {
+		t.Errorf("Expected the paused tfjob to stay %q, got %q", common.JobRunning, state)
+	}
+	if err := updateTFJobConditions(tfJob, common.JobFailed, tfJobFailedReason, "failed"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state := storedState(); state != common.JobFailed {
+		t.Errorf("Expected the state %q, got %q", common.JobFailed, state)
+	}
+	if tfJob.Status.Phase != tfv1.TFJobPhaseFailed {
+		t.Errorf("Expected the phase %q, got %q", tfv1.TFJobPhaseFailed, tfJob.Status.Phase)
+	}
+}
+
+func TestJobPhase(t *testing.T) {
+	// cond returns a condition of the given type, false if negated.
+	cond := func(condType common.JobConditionType, status bool) common.JobCondition {
+		condition := newCondition(condType, "Reason", "message")
+		if !status {
+			condition.Status = v1.ConditionFalse
+		}
+		return condition
+	}
+	testCases := []struct {
+		description string
+		// conditions are ordered from the least to the most recently updated.
+		conditions    []common.JobCondition
+		oldPhase      tfv1.TFJobPhase
+		expectedPhase tfv1.TFJobPhase
+	}{
+		{"No condition", nil, "", ""},
+		{"Created", []common.JobCondition{cond(common.JobCreated, true)}, "", tfv1.TFJobPhaseCreated},
+		{"Running", []common.JobCondition{cond(common.JobCreated, true), cond(common.JobRunning, true)}, tfv1.TFJobPhaseCreated, tfv1.TFJobPhaseRunning},
+		{"Restarting", []common.JobCondition{cond(common.JobCreated, true), cond(common.JobRunning, false), cond(common.JobRestarting, true)},
+			tfv1.TFJobPhaseRunning, tfv1.TFJobPhaseRestarting},
+		{"Running again", []common.JobCondition{cond(common.JobCreated, true), cond(common.JobRestarting, false), cond(common.JobRunning, true)},
+			tfv1.TFJobPhaseRestarting, tfv1.TFJobPhaseRunning},
+		{"Paused", []common.JobCondition{cond(common.JobCreated, true), cond(common.JobRunning, true), cond(tfv1.JobPaused, true)},
+			tfv1.TFJobPhaseRunning, tfv1.TFJobPhaseSuspended},
+		{"Paused before running", []common.JobCondition{cond(common.JobCreated, true), cond(tfv1.JobPaused, true)}, "", tfv1.TFJobPhaseSuspended},
+		{"Resumed", []common.JobCondition{cond(common.JobCreated, true), cond(common.JobRunning, true), cond(tfv1.JobPaused, false)},
+			tfv1.TFJobPhaseSuspended, tfv1.TFJobPhaseRunning},
+		{"Other conditions", []common.JobCondition{cond(common.JobCreated, true), cond(tfv1.JobQueued, true), cond(tfv1.JobPodCreationRampUp, true)},
+			"", tfv1.TFJobPhaseCreated},
+		{"Succeeded", []common.JobCondition{cond(common.JobCreated, true), cond(common.JobRunning, false), cond(common.JobSucceeded, true)},
+			tfv1.TFJobPhaseRunning, tfv1.TFJobPhaseSucceeded},
+		{"Failed", []common.JobCondition{cond(common.JobCreated, true), cond(common.JobRunning, false), cond(common.JobFailed, true)},
+			tfv1.TFJobPhaseRunning, tfv1.TFJobPhaseFailed},
+		{"Failed while paused", []common.JobCondition{cond(common.JobCreated, true), cond(tfv1.JobPaused, true), cond(common.JobFailed, true)},
+			tfv1.TFJobPhaseSuspended, tfv1.TFJobPhaseFailed},
+		{"Succeeded while paused", []common.JobCondition{cond(common.JobCreated, true), cond(common.JobSucceeded, true), cond(tfv1.JobPaused, true)},
+			"", tfv1.TFJobPhaseSucceeded},
+		{"Failed after succeeding", []common.JobCondition{cond(common.JobCreated, true), cond(common.JobSucceeded, true), cond(common.JobFailed, true)},
+			"", tfv1.TFJobPhaseFailed},
+		{"Succeeded after failing", []common.JobCondition{cond(common.JobCreated, true), cond(common.JobFailed, true), cond(common.JobSucceeded, true)},
+			"", tfv1.TFJobPhaseSucceeded},
+		{"Failed then running", []common.JobCondition{cond(common.JobCreated, true), cond(common.JobFailed, true), cond(common.JobRunning, true)},
+			"", tfv1.TFJobPhaseFailed},
+		{"Succeeded is terminal", []common.JobCondition{cond(common.JobCreated, true), cond(common.JobRunning, true)},
+			tfv1.TFJobPhaseSucceeded, tfv1.TFJobPhaseSucceeded},
+		{"Failed is terminal", nil, tfv1.TFJobPhaseFailed, tfv1.TFJobPhaseFailed},
+		{"Failed is not superseded", []common.JobCondition{cond(common.JobSucceeded, true)}, tfv1.TFJobPhaseFailed, tfv1.TFJobPhaseFailed},
+	}
+
+	for _, c := range testCases {
+		status := tfv1.TFJobStatus{JobStatus: common.JobStatus{Conditions: c.conditions}, Phase: c.oldPhase}
+		if phase := jobPhase(status); phase != c.expectedPhase {
+			t.Errorf("%s: expected the phase %q, got %q", c.description, c.expectedPhase, phase)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+const (
+	// statusAPIPrefix is the path under which the status API serves the
+	// tfjobs of a namespace: <prefix><namespace>/tfjobs[/<name>].
+	statusAPIPrefix = "/api/v1/namespaces/"
+	// defaultStatusAPILimit is the number of tfjobs in a page of the status
+	// API if the request does not set limit.
+	defaultStatusAPILimit = 100
+	// maxStatusAPILimit bounds the number of tfjobs in a page of the status
+	// API.
+	maxStatusAPILimit = 500
+)
+
+// tfJobSummaryList is a page of the tfjobs of a namespace served by the
+// status API.
+type tfJobSummaryList struct {
+	Items []tfJobSummary `json:"items"`
+	// Continue is the name of the last tfjob of the page, to pass as the
+	// continue parameter to get the next page. It is empty on the last page.
+	Continue string `json:"continue,omitempty"`
+}
+
+// tfJobSummary is the spec summary and the live pods of a tfjob served by
+// the status API.
+type tfJobSummary struct {
+	Name              string                                       `json:"name"`
+	Namespace         string                                       `json:"namespace"`
+	CreationTimestamp metav1.Time                                  `json:"creationTimestamp"`
+	State             common.JobConditionType                      `json:"state,omitempty"`
+	Phase             tfv1.TFJobPhase                              `json:"phase,omitempty"`
+	Replicas          map[tfv1.TFReplicaType]int32                 `json:"replicas"`
+	ReplicaStatuses   map[common.ReplicaType]*common.ReplicaStatus `json:"replicaStatuses,omitempty"`
+	Pods              []podSummary                                 `json:"pods"`
+}
+
+// podSummary is the live status of a pod of a tfjob served by the status API.
+type podSummary struct {
+	Name         string      `json:"name"`
+	ReplicaType  string      `json:"replicaType"`
+	ReplicaIndex string      `json:"replicaIndex"`
+	Phase        v1.PodPhase `json:"phase"`
+	NodeName     string      `json:"nodeName,omitempty"`
+	RestartCount int32       `json:"restartCount"`
+}
+
+// StatusAPIHandler returns the handler of the read-only status API, which
+// serves the tfjobs of a namespace with the live status of their pods, e.g.
+// for dashboards:
+//
+//	GET /api/v1/namespaces/<namespace>/tfjobs?limit=<n>&continue=<name>
+//	GET /api/v1/namespaces/<namespace>/tfjobs/<name>
+//
+// It only reads the informer caches, so that it does not call the API server
+// nor hold the locks of the controller workers.
+func (tc *TFController) StatusAPIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(statusAPIPrefix, tc.serveStatusAPI)
+	return mux
+}
+
+// serveStatusAPI serves a request of the status API.
+func (tc *TFController) serveStatusAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeStatusAPIError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", r.Method))
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, statusAPIPrefix), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] != "tfjobs" {
+		writeStatusAPIError(w, http.StatusNotFound, fmt.Sprintf("no such resource %s", r.URL.Path))
+		return
+	}
+	namespace := parts[0]
+	if len(parts) == 3 && parts[2] != "" {
+		tc.serveTFJobSummary(w, namespace, parts[2])
+		return
+	}
+	tc.serveTFJobSummaryList(w, r, namespace)
+}
+
+// serveTFJobSummary serves the tfjob of the given name.
+func (tc *TFController) serveTFJobSummary(w http.ResponseWriter, namespace, name string) {
+	tfjob, err := tc.getTFJobFromName(namespace, name)
+	if err == errNotExists {
+		writeStatusAPIError(w, http.StatusNotFound, fmt.Sprintf("tfjob %s/%s not found", namespace, name))
+		return
+	}
+	if err != nil {
+		writeStatusAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	summary, err := tc.tfJobSummary(tfjob)
+	if err != nil {
+		writeStatusAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeStatusAPIResponse(w, summary)
+}
+
+// serveTFJobSummaryList serves a page of the tfjobs of the namespace, sorted
+// by name.
+func (tc *TFController) serveTFJobSummaryList(w http.ResponseWriter, r *http.Request, namespace string) {
+	limit := defaultStatusAPILimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeStatusAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit %q", value))
+			return
+		}
+		limit = n
+	}
+	if limit > maxStatusAPILimit {
+		limit = maxStatusAPILimit
+	}
+	after := r.URL.Query().Get("continue")
+
+	var tfjobs []*tfv1.TFJob
+	for _, obj := range tc.tfJobIndexerFor(namespace).List() {
+		tfjob, err := tfJobFromUnstructured(obj)
+		if err != nil || tfjob.Namespace != namespace || tfjob.Name <= after {
+			continue
+		}
+		tfjobs = append(tfjobs, tfjob)
+	}
+	sort.Slice(tfjobs, func(i, j int) bool { return tfjobs[i].Name < tfjobs[j].Name })
+
+	list := tfJobSummaryList{Items: []tfJobSummary{}}
+	if len(tfjobs) > limit {
+		tfjobs = tfjobs[:limit]
+		list.Continue = tfjobs[limit-1].Name
+	}
+	for _, tfjob := range tfjobs {
+		summary, err := tc.tfJobSummary(tfjob)
+		if err != nil {
+			writeStatusAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		list.Items = append(list.Items, *summary)
+	}
+	writeStatusAPIResponse(w, list)
+}
+
+// tfJobSummary returns the spec summary of the tfjob and the live status of
+// the pods it controls.
+func (tc *TFController) tfJobSummary(tfjob *tfv1.TFJob) (*tfJobSummary, error) {
+	summary := &tfJobSummary{
+		Name:              tfjob.Name,
+		Namespace:         tfjob.Namespace,
+		CreationTimestamp: tfjob.CreationTimestamp,
+		State:             tfjob.Status.State,
+		Phase:             tfjob.Status.Phase,
+		Replicas:          make(map[tfv1.TFReplicaType]int32),
+		ReplicaStatuses:   tfjob.Status.ReplicaStatuses,
+		Pods:              []podSummary{},
+	}
+	for rtype, spec := range tfjob.Spec.TFReplicaSpecs {
+		if spec.Replicas != nil {
+			summary.Replicas[rtype] = *spec.Replicas
+		}
+	}
+
+	selector := labels.SelectorFromSet(tc.GenLabels(tfjob.Name))
+	pods, err := tc.PodLister.Pods(tfjob.Namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		if !metav1.IsControlledBy(pod, tfjob) {
+			continue
+		}
+		var restarts int32
+		for _, status := range pod.Status.ContainerStatuses {
+			restarts += status.RestartCount
+		}
+		summary.Pods = append(summary.Pods, podSummary{
+			Name:         pod.Name,
+			ReplicaType:  pod.Labels[tfReplicaTypeLabel],
+			ReplicaIndex: pod.Labels[tfReplicaIndexLabel],
+			Phase:        pod.Status.Phase,
+			NodeName:     pod.Spec.NodeName,
+			RestartCount: restarts,
+		})
+	}
+	sort.Slice(summary.Pods, func(i, j int) bool { return summary.Pods[i].Name < summary.Pods[j].Name })
+	return summary, nil
+}
+
+// writeStatusAPIResponse writes the JSON response of the status API.
+func writeStatusAPIResponse(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Warnf("Failed to write the status API response: %v", err)
+	}
+}
+
+// writeStatusAPIError writes the JSON error of the status API.
+func writeStatusAPIError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(map[string]string{"error": msg}); err != nil {
+		log.Warnf("Failed to write the status API error: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+// getStatusAPI serves the request of the status API and decodes its response.
+func getStatusAPI(ctr *TFController, path string, response interface{}, t *testing.T) int {
+	recorder := httptest.NewRecorder()
+	ctr.StatusAPIHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+		t.Fatalf("Failed to decode the response %q of %s: %v", recorder.Body.String(), path, err)
+	}
+	return recorder.Code
+}
+
+func TestStatusAPI(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	for i := 0; i < 3; i++ {
+		tfJob := testutil.NewTFJob(2, 0)
+		tfJob.Name = fmt.Sprintf("tfjob-%d", i)
+		tfJob.UID = types.UID(tfJob.Name)
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			t.Fatalf("Failed to convert the TFJob to Unstructured: %v", err)
+		}
+		if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+			t.Fatalf("Failed to add tfjob to tfJobIndexer: %v", err)
+		}
+		if i == 0 {
+			testutil.SetPodsStatuses(ctr.podIndexer, tfJob, testutil.LabelWorker, 0, 2, 0, 0, []int32{3, 0}, t)
+		}
+	}
+
+	var page tfJobSummaryList
+	if code := getStatusAPI(ctr, "/api/v1/namespaces/default/tfjobs?limit=2", &page, t); code != http.StatusOK {
+		t.Fatalf("Expected the status %d, got %d", http.StatusOK, code)
+	}
+	if len(page.Items) != 2 || page.Items[0].Name != "tfjob-0" || page.Continue != "tfjob-1" {
+		t.Fatalf("Expected the first page to hold tfjob-0 and tfjob-1, got %+v", page)
+	}
+	summary := page.Items[0]
+	if summary.Replicas[tfv1.TFReplicaTypeWorker] != 2 || len(summary.Pods) != 2 {
+		t.Fatalf("Expected 2 worker replicas and pods, got %+v", summary)
+	}
+	if pod := summary.Pods[0]; pod.Phase != v1.PodRunning || pod.ReplicaType != testutil.LabelWorker || pod.RestartCount != 3 {
+		t.Errorf("Expected the running worker 0 restarted 3 times, got %+v", pod)
+	}
+
+	page = tfJobSummaryList{}
+	getStatusAPI(ctr, "/api/v1/namespaces/default/tfjobs?limit=2&continue=tfjob-1", &page, t)
+	if len(page.Items) != 1 || page.Items[0].Name != "tfjob-2" || page.Continue != "" {
+		t.Errorf("Expected the last page to hold tfjob-2, got %+v", page)
+	}
+
+	var single tfJobSummary
+	if code := getStatusAPI(ctr, "/api/v1/namespaces/default/tfjobs/tfjob-1", &single, t); code != http.StatusOK || single.Name != "tfjob-1" {
+		t.Errorf("Expected tfjob-1, got %d %+v", code, single)
+	}
+	var errResponse map[string]string
+	if code := getStatusAPI(ctr, "/api/v1/namespaces/default/tfjobs/missing", &errResponse, t); code != http.StatusNotFound || errResponse["error"] == "" {
+		t.Errorf("Expected a not found error, got %d %v", code, errResponse)
+	}
+	if code := getStatusAPI(ctr, "/api/v1/namespaces/default/tfjobs?limit=x", &errResponse, t); code != http.StatusBadRequest {
+		t.Errorf("Expected a bad request error for an invalid limit, got %d", code)
+	}
+}
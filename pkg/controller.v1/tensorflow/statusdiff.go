@@ -0,0 +1,192 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+const (
+	// tfJobStatusChangedReason is the reason of the events recording the
+	// status transitions of a tfjob.
+	tfJobStatusChangedReason = "TFJobStatusChanged"
+	// maxStatusDiffSize is the maximum size in bytes of the status diff of
+	// an event.
+	maxStatusDiffSize = 1024
+)
+
+// statusDiff is the change of the status of a tfjob recorded in an event.
+// It leaves out the messages of the conditions, which may hold arbitrary
+// details of the pods.
+type statusDiff struct {
+	Conditions []conditionDiff `json:"conditions,omitempty"`
+	// Replicas is the changed counters of each replica type, each as its
+	// old and new values.
+	Replicas map[string]map[string][2]int32 `json:"replicas,omitempty"`
+	// StartTime and CompletionTime are the old and new times, empty if
+	// unset.
+	StartTime      *[2]string `json:"startTime,omitempty"`
+	CompletionTime *[2]string `json:"completionTime,omitempty"`
+	// Truncated is true if some changes are left out to cap the size of the
+	// diff.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// conditionDiff is the change of a condition, from and to status/reason,
+// empty if the condition is absent.
+type conditionDiff struct {
+	Type string `json:"type"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// recordStatusTransition emits an event on the tfjob whose status has been
+// written, if its conditions or its times changed from the old status.
+func (tc *TFController) recordStatusTransition(tfjob *tfv1.TFJob, oldStatus *tfv1.TFJobStatus) {
+	// The echo of a sync request is not a transition either.
+	status := tfjob.Status.DeepCopy()
+	status.LastSyncRequest = oldStatus.LastSyncRequest
+	if isCounterOnlyUpdate(oldStatus, status) {
+		return
+	}
+	annotations, msg := statusTransitionEvent(tfjob, oldStatus)
+	tc.Recorder.AnnotatedEventf(tfjob, annotations, v1.EventTypeNormal, tfJobStatusChangedReason, "%s", msg)
+	tc.audit(tfjob, "%s", msg)
+}
+
+// statusTransitionEvent returns the annotations and the message of the event
+// recording the status transition of the tfjob.
+func statusTransitionEvent(tfjob *tfv1.TFJob, oldStatus *tfv1.TFJobStatus) (map[string]string, string) {
+	diff := newStatusDiff(&oldStatus.JobStatus, &tfjob.Status.JobStatus)
+	var changes []string
+	for _, c := range diff.Conditions {
+		if c.To != "" {
+			changes = append(changes, fmt.Sprintf("%s=%s", c.Type, strings.SplitN(c.To, "/", 2)[0]))
+		}
+	}
+	msg := fmt.Sprintf("TFJob %s status changed", tfjob.Name)
+	if len(changes) > 0 {
+		msg += ": " + strings.Join(changes, ", ")
+	}
+	return map[string]string{tfv1.AnnotationStatusDiff: diff.marshal()}, msg
+}
+
+// newStatusDiff returns the changes from the old to the new status.
+func newStatusDiff(oldStatus, newStatus *common.JobStatus) *statusDiff {
+	diff := &statusDiff{}
+	// The conditions are listed in the order of the new status, the most
+	// recent last, after the removed ones.
+	for _, old := range oldStatus.Conditions {
+		if getCondition(*newStatus, old.Type) == nil {
+			diff.Conditions = append(diff.Conditions, conditionDiff{Type: string(old.Type), From: conditionState(&old)})
+		}
+	}
+	for _, cur := range newStatus.Conditions {
+		from, to := conditionState(getCondition(*oldStatus, cur.Type)), conditionState(&cur)
+		if from != to {
+			diff.Conditions = append(diff.Conditions, conditionDiff{Type: string(cur.Type), From: from, To: to})
+		}
+	}
+
+	rtypes := make(map[common.ReplicaType]bool)
+	for rtype := range oldStatus.ReplicaStatuses {
+		rtypes[rtype] = true
+	}
+	for rtype := range newStatus.ReplicaStatuses {
+		rtypes[rtype] = true
+	}
+	for rtype := range rtypes {
+		var old, cur common.ReplicaStatus
+		if status := oldStatus.ReplicaStatuses[rtype]; status != nil {
+			old = *status
+		}
+		if status := newStatus.ReplicaStatuses[rtype]; status != nil {
+			cur = *status
+		}
+		counters := make(map[string][2]int32)
+		for name, values := range map[string][2]int32{
+			"active":    {old.Active, cur.Active},
+			"succeeded": {old.Succeeded, cur.Succeeded},
+			"failed":    {old.Failed, cur.Failed},
+		} {
+			if values[0] != values[1] {
+				counters[name] = values
+			}
+		}
+		if len(counters) > 0 {
+			if diff.Replicas == nil {
+				diff.Replicas = make(map[string]map[string][2]int32)
+			}
+			diff.Replicas[string(rtype)] = counters
+		}
+	}
+
+	diff.StartTime = timeDiff(oldStatus.StartTime, newStatus.StartTime)
+	diff.CompletionTime = timeDiff(oldStatus.CompletionTime, newStatus.CompletionTime)
+	return diff
+}
+
+// conditionState returns the status and the reason of the condition, empty
+// if it is nil.
+func conditionState(condition *common.JobCondition) string {
+	if condition == nil {
+		return ""
+	}
+	return string(condition.Status) + "/" + condition.Reason
+}
+
+// timeDiff returns the old and new times, or nil if they are equal.
+func timeDiff(old, cur *metav1.Time) *[2]string {
+	format := func(t *metav1.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	values := [2]string{format(old), format(cur)}
+	if values[0] == values[1] {
+		return nil
+	}
+	return &values
+}
+
+// marshal returns the diff as compact JSON of at most maxStatusDiffSize
+// bytes. The replica counters are left out first, then the oldest condition
+// changes.
+func (diff *statusDiff) marshal() string {
+	data, _ := json.Marshal(diff)
+	if len(data) <= maxStatusDiffSize {
+		return string(data)
+	}
+	capped := *diff
+	capped.Truncated = true
+	capped.Replicas = nil
+	for {
+		data, _ = json.Marshal(&capped)
+		if len(data) <= maxStatusDiffSize || len(capped.Conditions) == 0 {
+			return string(data)
+		}
+		capped.Conditions = capped.Conditions[1:]
+	}
+}
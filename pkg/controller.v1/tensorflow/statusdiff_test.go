@@ -0,0 +1,153 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+// newRunningTFJob returns a tfjob whose single worker is running.
+func newRunningTFJob() *tfv1.TFJob {
+	tfJob := testutil.NewTFJob(1, 0)
+	startTime := metav1.NewTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	tfJob.Status.JobStatus = common.JobStatus{
+		Conditions: []common.JobCondition{
+			newCondition(common.JobCreated, tfJobCreatedReason, "created"),
+			newCondition(common.JobRunning, tfJobRunningReason, "running"),
+		},
+		ReplicaStatuses: map[common.ReplicaType]*common.ReplicaStatus{
+			common.ReplicaType(tfv1.TFReplicaTypeWorker): {Active: 1},
+		},
+		StartTime: &startTime,
+	}
+	return tfJob
+}
+
+// failTFJob fails the running tfjob.
+func failTFJob(tfJob *tfv1.TFJob, t *testing.T) {
+	if err := updateTFJobConditions(tfJob, common.JobFailed, tfJobFailedReason, "worker 0 failed with exit code 1"); err != nil {
+		t.Fatalf("Unexpected error when failing the tfjob: %v", err)
+	}
+	tfJob.Status.ReplicaStatuses[common.ReplicaType(tfv1.TFReplicaTypeWorker)] = &common.ReplicaStatus{Failed: 1}
+	completionTime := metav1.NewTime(time.Date(2020, 1, 1, 1, 0, 0, 0, time.UTC))
+	tfJob.Status.CompletionTime = &completionTime
+}
+
+func TestStatusTransitionEvent(t *testing.T) {
+	tfJob := newRunningTFJob()
+	oldStatus := tfJob.Status.DeepCopy()
+	failTFJob(tfJob, t)
+
+	annotations, msg := statusTransitionEvent(tfJob, oldStatus)
+	if expected := fmt.Sprintf("TFJob %s status changed: Running=False, Failed=True", tfJob.Name); msg != expected {
+		t.Errorf("Expected the message %q, got %q", expected, msg)
+	}
+	var diff statusDiff
+	if err := json.Unmarshal([]byte(annotations[tfv1.AnnotationStatusDiff]), &diff); err != nil {
+		t.Fatalf("Failed to parse the status diff %q: %v", annotations[tfv1.AnnotationStatusDiff], err)
+	}
+	expected := statusDiff{
+		Conditions: []conditionDiff{
+			{Type: "Running", From: "True/" + tfJobRunningReason, To: "False/" + tfJobRunningReason},
+			{Type: "Failed", To: "True/" + tfJobFailedReason},
+		},
+		Replicas: map[string]map[string][2]int32{
+			"Worker": {"active": {1, 0}, "failed": {0, 1}},
+		},
+		CompletionTime: &[2]string{"", "2020-01-01T01:00:00Z"},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Expected the status diff %+v, got %+v", expected, diff)
+	}
+	if strings.Contains(annotations[tfv1.AnnotationStatusDiff], "exit code") {
+		t.Errorf("Expected the status diff to leave out the messages, got %s", annotations[tfv1.AnnotationStatusDiff])
+	}
+}
+
+func TestStatusDiffCap(t *testing.T) {
+	oldStatus := &common.JobStatus{}
+	newStatus := &common.JobStatus{ReplicaStatuses: make(map[common.ReplicaType]*common.ReplicaStatus)}
+	for i := 0; i < 30; i++ {
+		condType := common.JobConditionType(fmt.Sprintf("Condition%d", i))
+		newStatus.Conditions = append(newStatus.Conditions, newCondition(condType, strings.Repeat("Reason", 5), ""))
+		newStatus.ReplicaStatuses[common.ReplicaType(condType)] = &common.ReplicaStatus{Active: 1}
+	}
+
+	data := newStatusDiff(oldStatus, newStatus).marshal()
+	if len(data) > maxStatusDiffSize {
+		t.Errorf("Expected the status diff to be capped to %d bytes, got %d", maxStatusDiffSize, len(data))
+	}
+	var diff statusDiff
+	if err := json.Unmarshal([]byte(data), &diff); err != nil {
+		t.Fatalf("Failed to parse the status diff %q: %v", data, err)
+	}
+	if !diff.Truncated || diff.Replicas != nil || len(diff.Conditions) == 0 {
+		t.Errorf("Expected the status diff to be truncated, got %+v", diff)
+	}
+	if last := diff.Conditions[len(diff.Conditions)-1]; last.Type != "Condition29" {
+		t.Errorf("Expected the most recent condition change to be kept, got %v", last)
+	}
+}
+
+func TestRecordStatusTransitionOnWrite(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	recorder := record.NewFakeRecorder(10)
+	ctr.Recorder = recorder
+	var writeErr error
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return writeErr
+	}
+
+	tfJob := newRunningTFJob()
+	oldStatus := tfJob.Status.DeepCopy()
+	failTFJob(tfJob, t)
+	writeErr = fmt.Errorf("conflict")
+	if err := ctr.updateStatus(tfJob, oldStatus); err == nil {
+		t.Errorf("Expected the failed status write to return an error")
+	}
+	if count := countEvents(recorder, tfJobStatusChangedReason); count != 0 {
+		t.Errorf("Expected no event when the status write fails, got %d", count)
+	}
+
+	writeErr = nil
+	if err := ctr.updateStatus(tfJob, oldStatus); err != nil {
+		t.Errorf("Unexpected error when writing the status: %v", err)
+	}
+	if count := countEvents(recorder, tfJobStatusChangedReason); count != 1 {
+		t.Errorf("Expected 1 event once the status is written, got %d", count)
+	}
+
+	// The counters alone are not a transition.
+	oldStatus = tfJob.Status.DeepCopy()
+	tfJob.Status.ReplicaStatuses[common.ReplicaType(tfv1.TFReplicaTypeWorker)].Failed = 2
+	if err := ctr.updateStatus(tfJob, oldStatus); err != nil {
+		t.Errorf("Unexpected error when writing the status: %v", err)
+	}
+	if count := countEvents(recorder, tfJobStatusChangedReason); count != 0 {
+		t.Errorf("Expected no event for a counter-only update, got %d", count)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// statusUpdateRetryPeriod is the base delay after which a deferred status
+// update is retried. It is jittered so that deferred tfjobs do not retry together.
+const statusUpdateRetryPeriod = 5 * time.Second
+
+var statusUpdatesDeferredCount = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "tf_operator_status_updates_deferred_total",
+	Help: "Counts number of counter-only TFJob status updates deferred by the status update rate limit",
+})
+
+// updateStatus writes the changed status of the tfjob. Status updates which
+// only change the replica counters share a token bucket across tfjobs; when
+// it is exhausted, the update is deferred and coalesced with the following
+// changes by a later sync. Any other update, e.g. a terminal condition,
+// bypasses the token bucket so that no transition is delayed.
+func (tc *TFController) updateStatus(tfjob *tfv1.TFJob, oldStatus *tfv1.TFJobStatus) error {
+	if tc.statusUpdateLimiter == nil || !isCounterOnlyUpdate(oldStatus, &tfjob.Status) ||
+		tc.statusUpdateLimiter.TryAccept() {
+		if err := tc.updateStatusHandler(tfjob); err != nil {
+			return newReconcileError(ErrStatusUpdate, err)
+		}
+		// The transition is only recorded once it is written.
+		tc.recordStatusTransition(tfjob, oldStatus)
+		return nil
+	}
+
+	tfjobKey, err := KeyFunc(tfjob)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("couldn't get key for tfjob object %#v: %v", tfjob, err))
+		return err
+	}
+	statusUpdatesDeferredCount.Inc()
+	tc.WorkQueue.AddAfter(tfjobKey, wait.Jitter(statusUpdateRetryPeriod, 1.0))
+	return nil
+}
+
+// isCounterOnlyUpdate returns true if the new status only differs from the
+// old one by its replica statuses, training progress and first running time.
+// A deferred first running time is recorded again, slightly later, by the
+// next sync.
+func isCounterOnlyUpdate(oldStatus, newStatus *tfv1.TFJobStatus) bool {
+	status := newStatus.DeepCopy()
+	status.ReplicaStatuses = oldStatus.ReplicaStatuses
+	status.TrainingProgress = oldStatus.TrainingProgress
+	status.FirstRunningTime = oldStatus.FirstRunningTime
+	return apiequality.Semantic.DeepEqual(*oldStatus, *status)
+}
+
+// cleanupDelay returns how much longer the deletion of the pods and services
+// of a terminal tfjob is postponed. Each tfjob gets a stable delay within the
+// cleanup jitter, derived from its UID, so that the deletions of tfjobs which
+// complete together are spread over the jitter.
+func (tc *TFController) cleanupDelay(tfjob *tfv1.TFJob) time.Duration {
+	if tc.cleanupJitter <= 0 || tfjob.Status.CompletionTime == nil {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(tfjob.UID))
+	delay := time.Duration(float64(tc.cleanupJitter) * float64(h.Sum32()) / math.MaxUint32)
+	return tfjob.Status.CompletionTime.Add(delay).Sub(tc.clock.Now())
+}
@@ -0,0 +1,201 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	kubebatchclient "github.com/kubernetes-sigs/kube-batch/pkg/client/clientset/versioned"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	kubeclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/kubernetes/pkg/controller"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	"github.com/kubeflow/tf-operator/cmd/tf-operator.v1/app/options"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tfjobclientset "github.com/kubeflow/tf-operator/pkg/client/clientset/versioned"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
+)
+
+func TestStatusUpdateRateLimit(t *testing.T) {
+	// Prepare the clientset and controller for the test.
+	kubeClientSet := kubeclientset.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	// Prepare the kube-batch clientset and controller for the test.
+	kubeBatchClientSet := kubebatchclient.NewForConfigOrDie(&rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &v1.SchemeGroupVersion,
+		},
+	},
+	)
+
+	config := &rest.Config{
+		Host: "",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion: &tfv1.SchemeGroupVersion,
+		},
+	}
+	option := options.ServerOption{
+		// The bucket does not refill during the test.
+		StatusUpdateQPS:   0.001,
+		StatusUpdateBurst: 10,
+	}
+	tfJobClientSet := tfjobclientset.NewForConfigOrDie(config)
+	ctr, kubeInformerFactory, _ := newTFController(config, kubeClientSet, kubeBatchClientSet, tfJobClientSet, controller.NoResyncPeriodFunc, option)
+	ctr.PodControl = &controller.FakePodControl{}
+	ctr.ServiceControl = &control.FakeServiceControl{}
+	ctr.Recorder = &record.FakeRecorder{}
+	tfJobIndexer := ctr.tfJobInformer.GetIndexer()
+	podIndexer := kubeInformerFactory.Core().V1().Pods().Informer().GetIndexer()
+
+	updates := map[string]*tfv1.TFJob{}
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		updates[tfJob.Name] = tfJob
+		return nil
+	}
+
+	// syncJobs syncs 100 running tfjobs whose worker is in the given phase.
+	syncJobs := func(prefix string, phase v1.PodPhase) {
+		for i := 0; i < 100; i++ {
+			tfJob := testutil.NewTFJob(1, 0)
+			tfJob.Name = fmt.Sprintf("%s-%d", prefix, i)
+			tfJob.UID = types.UID(tfJob.Name)
+			now := metav1.Now()
+			tfJob.Status.StartTime = &now
+			msg := fmt.Sprintf("TFJob %s is running.", tfJob.Name)
+			if err := updateTFJobConditions(tfJob, common.JobRunning, tfJobRunningReason, msg); err != nil {
+				t.Errorf("Failed to update the conditions: %v", err)
+			}
+			unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+			if err != nil {
+				t.Errorf("Failed to convert the TFJob to Unstructured: %v", err)
+			}
+			if err := tfJobIndexer.Add(unstructured); err != nil {
+				t.Errorf("Failed to add tfjob to tfJobIndexer: %v", err)
+			}
+
+			pod := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+			pod.Name = tfJob.Name + "-worker-0"
+			pod.Status.Phase = phase
+			if err := podIndexer.Add(pod); err != nil {
+				t.Errorf("Unexpected error when adding pod %v", err)
+			}
+
+			if _, err := ctr.syncTFJob(testutil.GetKey(tfJob, t)); err != nil {
+				t.Errorf("Unexpected error when syncing %s: %v", tfJob.Name, err)
+			}
+		}
+	}
+
+	// The counter-only updates are bounded by the token bucket.
+	syncJobs("running", v1.PodRunning)
+	if len(updates) != 10 {
+		t.Errorf("Expected 10 counter-only status updates, got %d", len(updates))
+	}
+
+	// The terminal transitions bypass the exhausted token bucket.
+	updates = map[string]*tfv1.TFJob{}
+	syncJobs("succeeded", v1.PodSucceeded)
+	if len(updates) != 100 {
+		t.Errorf("Expected 100 terminal status updates, got %d", len(updates))
+	}
+	for name, tfJob := range updates {
+		if !isSucceeded(tfJob.Status.JobStatus) {
+			t.Errorf("Expected %s to succeed, got %v", name, tfJob.Status.Conditions)
+		}
+	}
+}
+
+func TestCleanupJitter(t *testing.T) {
+	now := metav1.Now()
+	fakeClock := clock.NewFakeClock(now.Time)
+	ctr := &TFController{cleanupJitter: time.Hour, clock: fakeClock}
+	tfJob := testutil.NewTFJob(1, 0)
+	tfJob.Status.CompletionTime = &now
+
+	delay := ctr.cleanupDelay(tfJob)
+	if delay <= 0 || delay > time.Hour {
+		t.Errorf("Expected a cleanup delay within the jitter, got %v", delay)
+	}
+	if again := ctr.cleanupDelay(tfJob); again != delay {
+		t.Errorf("Expected a stable cleanup delay, got %v then %v", delay, again)
+	}
+
+	// The delays of the tfjobs completing together are spread.
+	other := tfJob.DeepCopy()
+	other.UID = types.UID("other")
+	if ctr.cleanupDelay(other) == delay {
+		t.Errorf("Expected the cleanup delays of tfjobs to differ")
+	}
+
+	fakeClock.Step(time.Hour)
+	if delay := ctr.cleanupDelay(tfJob); delay > 0 {
+		t.Errorf("Expected the cleanup not to be delayed past the jitter, got %v", delay)
+	}
+}
+
+func TestCleanupJitterPostponesTTLDeletion(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	ctr.cleanupJitter = time.Hour
+	deleted := false
+	ctr.deleteTFJobHandler = func(tfJob *tfv1.TFJob) error {
+		deleted = true
+		return nil
+	}
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+
+	tfJob := testutil.NewTFJob(1, 0)
+	ttl := int32(0)
+	tfJob.Spec.TTLSecondsAfterFinished = &ttl
+	completionTime := metav1.NewTime(time.Now().Add(-time.Minute))
+	tfJob.Status.CompletionTime = &completionTime
+	if err := updateTFJobConditions(tfJob, common.JobSucceeded, tfJobSucceededReason, ""); err != nil {
+		t.Fatalf("Failed to update the conditions: %v", err)
+	}
+	fakeClock := clock.NewFakeClock(completionTime.Time)
+	ctr.clock = fakeClock
+
+	if err := ctr.reconcileTFJobs(tfJob.DeepCopy()); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if deleted {
+		t.Errorf("Expected the TTL deletion to wait for the cleanup delay")
+	}
+
+	fakeClock.Step(time.Hour)
+	if err := ctr.reconcileTFJobs(tfJob.DeepCopy()); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if !deleted {
+		t.Errorf("Expected the tfjob to be deleted once the cleanup delay elapsed")
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/kubernetes/pkg/controller"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+const (
+	// labelStrandedPodsReason is the warning reason when pods controlled by a
+	// tfjob do not match its selector.
+	labelStrandedPodsReason = "LabelStrandedPods"
+	// maxStrandedPodNames is the number of stranded pods named in the event.
+	maxStrandedPodNames = 5
+)
+
+var labelStrandedPodsCount = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "tf_operator_label_stranded_pods",
+	Help: "Number of pods controlled by a TF job whose labels do not match its selector",
+})
+
+// claimPods reconciles ControllerRef on the candidate pods of the tfjob. The
+// pods controlled by the tfjob whose labels do not match its selector, e.g.
+// the pods created by another version of the operator during a partial
+// upgrade, are not released: they are kept by their ControllerRef, so that
+// their indexes are not created twice, and returned as stranded as well.
+func claimPods(cm *controller.PodControllerRefManager, tfjob *tfv1.TFJob, candidates []*v1.Pod) ([]*v1.Pod, []*v1.Pod, error) {
+	var stranded []*v1.Pod
+	matching := make([]*v1.Pod, 0, len(candidates))
+	for _, pod := range candidates {
+		if metav1.IsControlledBy(pod, tfjob) && !cm.Selector.Matches(labels.Set(pod.Labels)) {
+			stranded = append(stranded, pod)
+			continue
+		}
+		matching = append(matching, pod)
+	}
+	claimed, err := cm.ClaimPods(matching)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(claimed, stranded...), stranded, nil
+}
+
+// recordStrandedPods logs and emits a warning event when the number of pods
+// controlled by the tfjob which do not match its selector changes.
+func (tc *TFController) recordStrandedPods(tfjob *tfv1.TFJob, stranded []*v1.Pod) {
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return
+	}
+	tc.strandedPodsLock.Lock()
+	defer tc.strandedPodsLock.Unlock()
+	last := tc.strandedPods[key]
+	if len(stranded) == last {
+		return
+	}
+	labelStrandedPodsCount.Add(float64(len(stranded) - last))
+	if len(stranded) == 0 {
+		delete(tc.strandedPods, key)
+		return
+	}
+	tc.strandedPods[key] = len(stranded)
+
+	names := make([]string, 0, maxStrandedPodNames)
+	for _, pod := range stranded {
+		if len(names) == maxStrandedPodNames {
+			names = append(names, "...")
+			break
+		}
+		names = append(names, pod.Name)
+	}
+	msg := fmt.Sprintf("%d pod(s) of TFJob %s do not match its selector, e.g. after a partial upgrade of the operator, they are kept by their ControllerRef: %s",
+		len(stranded), tfjob.Name, strings.Join(names, ", "))
+	tflogger.LoggerForJob(tfjob).Warn(msg)
+	tc.Recorder.Event(tfjob, v1.EventTypeWarning, labelStrandedPodsReason, msg)
+}
+
+// forgetStrandedPods forgets the stranded pods of the tfjob.
+func (tc *TFController) forgetStrandedPods(key string) {
+	tc.strandedPodsLock.Lock()
+	defer tc.strandedPodsLock.Unlock()
+	labelStrandedPodsCount.Sub(float64(tc.strandedPods[key]))
+	delete(tc.strandedPods, key)
+}
+
+// checkStrandedPods logs the pods controlled by a tfjob which do not match
+// its selector when the operator starts. They are reported for each tfjob
+// when it is synced.
+func (tc *TFController) checkStrandedPods() {
+	pods, err := tc.PodLister.List(labels.Everything())
+	if err != nil {
+		log.Warnf("Failed to list the pods to check their labels: %v", err)
+		return
+	}
+	stranded := 0
+	for _, pod := range pods {
+		ref := metav1.GetControllerOf(pod)
+		if ref == nil || ref.Kind != tfv1.Kind {
+			continue
+		}
+		if !labels.SelectorFromSet(tc.GenLabels(ref.Name)).Matches(labels.Set(pod.Labels)) {
+			stranded++
+		}
+	}
+	if stranded > 0 {
+		log.Warnf("Found %d pod(s) controlled by TFJobs which do not match their selector, e.g. after a partial upgrade of the operator", stranded)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/client-go/tools/record"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+// strandedPodsGauge returns the value of the stranded pods gauge.
+func strandedPodsGauge(t *testing.T) float64 {
+	metric := &dto.Metric{}
+	if err := labelStrandedPodsCount.(prometheus.Metric).Write(metric); err != nil {
+		t.Fatalf("Failed to read the stranded pods gauge: %v", err)
+	}
+	return metric.GetGauge().GetValue()
+}
+
+func TestStrandedPods(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	recorder := record.NewFakeRecorder(10)
+	ctr.Recorder = recorder
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+	start := strandedPodsGauge(t)
+
+	tfJob := testutil.NewTFJob(2, 0)
+	// The pods of worker 0 were created by another version of the operator
+	// with other labels.
+	stranded := testutil.NewPod(tfJob, testutil.LabelWorker, 0, t)
+	stranded.Labels[jobcontroller.JobNameLabel] = "renamed"
+	delete(stranded.Labels, jobcontroller.ControllerNameLabel)
+	if err := ctr.podIndexer.Add(stranded); err != nil {
+		t.Fatalf("Unexpected error when adding pod %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := ctr.reconcileTFJobs(tfJob); err != nil {
+			t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+		}
+	}
+	// Only worker 1 is created.
+	if count := countWorkerPods(fakePodControl); count != 2 {
+		t.Errorf("Expected worker 1 to be created once per reconcile, got %d pods", count)
+	}
+	for _, template := range fakePodControl.Templates {
+		if template.Labels[tfReplicaIndexLabel] == "0" {
+			t.Errorf("Expected no duplicate of the stranded pod, got %s", template.Name)
+		}
+	}
+	if len(fakePodControl.Patches) != 0 {
+		t.Errorf("Expected the stranded pod not to be released, got %d patches", len(fakePodControl.Patches))
+	}
+	if count := countEvents(recorder, labelStrandedPodsReason); count != 1 {
+		t.Errorf("Expected 1 event for the stranded pod, got %d", count)
+	}
+	if value := strandedPodsGauge(t) - start; value != 1 {
+		t.Errorf("Expected 1 stranded pod to be counted, got %v", value)
+	}
+
+	ctr.forgetStrandedPods(testutil.GetKey(tfJob, t))
+	if value := strandedPodsGauge(t) - start; value != 0 {
+		t.Errorf("Expected the stranded pod to be forgotten, got %v", value)
+	}
+}
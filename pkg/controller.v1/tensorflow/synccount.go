@@ -0,0 +1,96 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strconv"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+var (
+	syncsToRunning = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tf_operator_syncs_to_running",
+		Help:    "Number of syncs TF jobs needed to run, by whether they were created before the operator restarted",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+	}, []string{"restarted"})
+	syncsToTerminal = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tf_operator_syncs_to_terminal",
+		Help:    "Number of syncs TF jobs needed to succeed or fail, by whether they were created before the operator restarted",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"restarted"})
+)
+
+// syncCount counts the syncs of a tfjob until it terminates.
+type syncCount struct {
+	// key is the key of the tfjob, for the count to be forgotten once the
+	// tfjob is deleted.
+	key   string
+	syncs int
+	// restarted is true if the tfjob was created before the operator
+	// started, in which case the syncs of the previous operator are missing.
+	restarted bool
+	// running and terminal are true once the syncs to the transition have
+	// been observed.
+	running  bool
+	terminal bool
+}
+
+// countSync counts the sync of the tfjob, and observes the syncs it needed
+// when it is first seen running, then terminated. The tfjob is the one
+// reconciled by the sync. The counts are kept in memory, so the operator
+// restarts reset them.
+func (tc *TFController) countSync(tfjob *tfv1.TFJob) {
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return
+	}
+	tc.syncCountsLock.Lock()
+	defer tc.syncCountsLock.Unlock()
+	count, ok := tc.syncCounts[tfjob.UID]
+	if !ok {
+		count = &syncCount{key: key, restarted: tfjob.CreationTimestamp.Time.Before(tc.operatorStartTime)}
+		tc.syncCounts[tfjob.UID] = count
+	}
+	if count.terminal {
+		return
+	}
+	count.syncs++
+	restarted := strconv.FormatBool(count.restarted)
+	if !count.running && hasCondition(tfjob.Status.JobStatus, common.JobRunning) {
+		count.running = true
+		syncsToRunning.WithLabelValues(restarted).Observe(float64(count.syncs))
+	}
+	if isSucceeded(tfjob.Status.JobStatus) || isFailed(tfjob.Status.JobStatus) {
+		count.terminal = true
+		syncsToTerminal.WithLabelValues(restarted).Observe(float64(count.syncs))
+	}
+}
+
+// forgetSyncCounts forgets the sync counts of the deleted tfjob, along with
+// the ones of the previous tfjobs of the same name.
+func (tc *TFController) forgetSyncCounts(key string) {
+	tc.syncCountsLock.Lock()
+	defer tc.syncCountsLock.Unlock()
+	for uid, count := range tc.syncCounts {
+		if count.key == key {
+			delete(tc.syncCounts, uid)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+	"time"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+// collectSyncCounts returns the count and sum of the syncs observed by the
+// histogram for the restarted label.
+func collectSyncCounts(t *testing.T, histogram *prometheus.HistogramVec, restarted string) (uint64, float64) {
+	var m dto.Metric
+	if err := histogram.WithLabelValues(restarted).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("Failed to write the metric: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestCountSyncs(t *testing.T) {
+	type testCase struct {
+		description string
+		// created is when the tfjob was created relative to the start of
+		// the operator.
+		created   time.Duration
+		restarted string
+	}
+	testCases := []testCase{
+		{"The syncs of a new tfjob are counted", time.Second, "false"},
+		{"The syncs of a tfjob created before the operator restarted are marked", -time.Hour, "true"},
+	}
+	for _, c := range testCases {
+		ctr, _ := newNoOpTestController()
+		ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+			return nil
+		}
+		tfJob := testutil.NewTFJob(1, 0)
+		tfJob.CreationTimestamp = metav1.NewTime(ctr.operatorStartTime.Add(c.created))
+		runningBefore, runningSumBefore := collectSyncCounts(t, syncsToRunning, c.restarted)
+		terminalBefore, terminalSumBefore := collectSyncCounts(t, syncsToTerminal, c.restarted)
+
+		// The tfjob runs after 3 syncs and succeeds after 5 syncs, after
+		// which its syncs are no longer counted.
+		conditions := []common.JobConditionType{common.JobCreated, common.JobCreated, common.JobRunning,
+			common.JobRunning, common.JobSucceeded, common.JobSucceeded}
+		for _, condition := range conditions {
+			if condition == common.JobSucceeded {
+				now := metav1.Now()
+				tfJob.Status.CompletionTime = &now
+			}
+			if err := updateTFJobConditions(tfJob, condition, "test", ""); err != nil {
+				t.Fatalf("%s: unexpected error when setting the condition: %v", c.description, err)
+			}
+			unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+			if err != nil {
+				t.Fatalf("%s: failed to convert the TFJob to Unstructured: %v", c.description, err)
+			}
+			if err := ctr.tfJobInformer.GetIndexer().Update(unstructured); err != nil {
+				t.Fatalf("%s: failed to update the tfjob: %v", c.description, err)
+			}
+			if _, err := ctr.syncTFJob(testutil.GetKey(tfJob, t)); err != nil {
+				t.Fatalf("%s: unexpected error when syncing the tfjob: %v", c.description, err)
+			}
+		}
+
+		running, runningSum := collectSyncCounts(t, syncsToRunning, c.restarted)
+		if running-runningBefore != 1 || runningSum-runningSumBefore != 3 {
+			t.Errorf("%s: expected 3 syncs to running to be observed once, got %d observations of %v syncs",
+				c.description, running-runningBefore, runningSum-runningSumBefore)
+		}
+		terminal, terminalSum := collectSyncCounts(t, syncsToTerminal, c.restarted)
+		if terminal-terminalBefore != 1 || terminalSum-terminalSumBefore != 5 {
+			t.Errorf("%s: expected 5 syncs to terminal to be observed once, got %d observations of %v syncs",
+				c.description, terminal-terminalBefore, terminalSum-terminalSumBefore)
+		}
+
+		// The counts are forgotten once the tfjob is deleted.
+		unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+		if err != nil {
+			t.Fatalf("%s: failed to convert the TFJob to Unstructured: %v", c.description, err)
+		}
+		if err := ctr.tfJobInformer.GetIndexer().Delete(unstructured); err != nil {
+			t.Fatalf("%s: failed to delete the tfjob: %v", c.description, err)
+		}
+		if _, err := ctr.syncTFJob(testutil.GetKey(tfJob, t)); err != nil {
+			t.Fatalf("%s: unexpected error when syncing the deleted tfjob: %v", c.description, err)
+		}
+		if len(ctr.syncCounts) != 0 {
+			t.Errorf("%s: expected the sync counts to be forgotten, got %v", c.description, ctr.syncCounts)
+		}
+	}
+}
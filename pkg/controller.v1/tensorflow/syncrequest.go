@@ -0,0 +1,42 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	log "github.com/sirupsen/logrus"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// isSyncRequested returns true if the sync request annotation of the tfjob
+// changed to a new value.
+func isSyncRequested(oldTFJob, curTFJob *tfv1.TFJob) bool {
+	value := curTFJob.Annotations[tfv1.AnnotationSyncRequest]
+	return value != "" && value != oldTFJob.Annotations[tfv1.AnnotationSyncRequest]
+}
+
+// requestSync syncs the tfjob with the given key right away, regardless of
+// the backoff of its previous failed syncs.
+func (tc *TFController) requestSync(key, value string) {
+	log.Infof("Sync of tfjob %s requested: %s", key, value)
+	tc.WorkQueue.Forget(key)
+	tc.WorkQueue.Add(key)
+}
+
+// echoSyncRequest records the sync request annotation of the tfjob being
+// synced in its status.
+func echoSyncRequest(tfjob *tfv1.TFJob) {
+	tfjob.Status.LastSyncRequest = tfjob.Annotations[tfv1.AnnotationSyncRequest]
+}
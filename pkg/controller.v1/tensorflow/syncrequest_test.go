@@ -0,0 +1,75 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+func TestSyncRequest(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	recorder := record.NewFakeRecorder(100)
+	ctr.Recorder = recorder
+	var actual *tfv1.TFJob
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		actual = tfJob.DeepCopy()
+		return nil
+	}
+	tfJob := testutil.NewTFJob(1, 0)
+	key := testutil.GetKey(tfJob, t)
+	if err := ctr.reconcileTFJobs(tfJob); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	// The previous syncs of the tfjob failed.
+	ctr.WorkQueue.AddRateLimited(key)
+	ctr.WorkQueue.AddRateLimited(key)
+
+	old, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Fatalf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	tfJob.Annotations = map[string]string{tfv1.AnnotationSyncRequest: "fixed-by-hand"}
+	cur, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Fatalf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	ctr.updateTFJob(old, cur)
+	if ctr.WorkQueue.Len() != 1 || ctr.WorkQueue.NumRequeues(key) != 0 {
+		t.Errorf("Expected the tfjob to be queued right away without backoff, got %d queued and %d requeues",
+			ctr.WorkQueue.Len(), ctr.WorkQueue.NumRequeues(key))
+	}
+
+	countEvents(recorder, tfJobStatusChangedReason)
+	actual = nil
+	if err := ctr.reconcileTFJobs(tfJob); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	if actual == nil || actual.Status.LastSyncRequest != "fixed-by-hand" {
+		t.Fatalf("Expected the sync request to be echoed in the status, got %v", actual)
+	}
+	if count := countEvents(recorder, tfJobStatusChangedReason); count != 0 {
+		t.Errorf("Expected the echo not to be recorded as a status transition, got %d events", count)
+	}
+
+	// The same value does not request another sync.
+	if isSyncRequested(tfJob, tfJob) {
+		t.Errorf("Expected an unchanged sync request not to request a sync")
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+)
+
+// teardownOrder is the order the replica types of a tfjob are deleted in
+// with OrderedTeardown: the workers stop updating the PS before the PS stop,
+// and the chief, which usually exports the model, goes last.
+var teardownOrder = [][]tfv1.TFReplicaType{
+	{tfv1.TFReplicaTypeWorker, tfv1.TFReplicaTypeEval},
+	{tfv1.TFReplicaTypePS},
+	{tfv1.TFReplicaTypeChief, tfv1.TFReplicaTypeMaster},
+}
+
+// teardownStage returns the position of the replica type in teardownOrder.
+// The unknown replica types are deleted first.
+func teardownStage(rt string) int {
+	for stage, rtypes := range teardownOrder {
+		for _, rtype := range rtypes {
+			if strings.EqualFold(string(rtype), rt) {
+				return stage
+			}
+		}
+	}
+	return 0
+}
+
+// podsToTearDown returns the pods of the terminated tfjob to delete according
+// to its cleanPodPolicy. With OrderedTeardown, they are only the ones of the
+// first stage of teardownOrder whose pods are not all gone, the pods already
+// terminating excepted. The deletion of the last of them syncs the tfjob,
+// which then deletes the pods of the next stage.
+func podsToTearDown(tfJob *tfv1.TFJob, pods []*v1.Pod) []*v1.Pod {
+	var cleaned []*v1.Pod
+	for _, pod := range pods {
+		if shouldCleanPod(tfJob, pod) {
+			cleaned = append(cleaned, pod)
+		}
+	}
+	if tfJob.Spec.OrderedTeardown == nil || !*tfJob.Spec.OrderedTeardown || len(cleaned) == 0 {
+		return cleaned
+	}
+	stage := len(teardownOrder)
+	for _, pod := range cleaned {
+		if s := teardownStage(pod.Labels[tfReplicaTypeLabel]); s < stage {
+			stage = s
+		}
+	}
+	var deleted []*v1.Pod
+	for _, pod := range cleaned {
+		if teardownStage(pod.Labels[tfReplicaTypeLabel]) == stage && pod.DeletionTimestamp == nil {
+			deleted = append(deleted, pod)
+		}
+	}
+	return deleted
+}
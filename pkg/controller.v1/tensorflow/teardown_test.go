@@ -0,0 +1,112 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
+)
+
+func TestTeardown(t *testing.T) {
+	type step struct {
+		description string
+		// terminating is the pods being deleted, gone the pods deleted since
+		// the previous step.
+		terminating []string
+		gone        []string
+		// expectedDeleted is the pods deleted without a grace period,
+		// expectedGraceful the ones deleted with the one of the PS.
+		expectedDeleted  []string
+		expectedGraceful []string
+	}
+	type testCase struct {
+		description string
+		ordered     bool
+		steps       []step
+	}
+	testCases := []testCase{
+		{"All the pods are deleted at once by default", false, []step{
+			{"", nil, nil,
+				[]string{"chief-0", "worker-0", "worker-1"}, []string{"ps-0"}},
+		}},
+		{"The pods are deleted in order", true, []step{
+			{"The workers are deleted first", nil, nil,
+				[]string{"worker-0", "worker-1"}, nil},
+			{"The PS wait for the workers to terminate", []string{"worker-0"}, []string{"worker-1"},
+				nil, nil},
+			{"The PS are deleted with their grace period", nil, []string{"worker-0"},
+				nil, []string{"ps-0"}},
+			{"The chief is deleted last", nil, []string{"ps-0"},
+				[]string{"chief-0"}, nil},
+		}},
+	}
+	for _, c := range testCases {
+		ctr, fakePodControl, _ := newErrorsTestController()
+		fakeGracefulDeleteControl := &control.FakePodGracefulDeleteControl{}
+		ctr.GracefulDeleteControl = fakeGracefulDeleteControl
+		tfJob := testutil.NewTFJobWithCleanPolicy(1, 2, 1, common.CleanPodPolicyAll)
+		tfJob.Spec.OrderedTeardown = &c.ordered
+		tfJob.Spec.TerminationGracePeriodSeconds = map[tfv1.TFReplicaType]int64{tfv1.TFReplicaTypePS: 60}
+		pods := map[string]*v1.Pod{}
+		for i, rt := range []string{"chief", testutil.LabelPS, testutil.LabelWorker, testutil.LabelWorker} {
+			pod := testutil.NewPod(tfJob, rt, i/3, t)
+			pod.Status.Phase = v1.PodRunning
+			pods[pod.Name] = pod
+		}
+
+		for _, s := range c.steps {
+			fakePodControl.Clear()
+			fakeGracefulDeleteControl.Clear()
+			now := metav1.Now()
+			for _, name := range s.terminating {
+				pods[name].DeletionTimestamp = &now
+			}
+			for _, name := range s.gone {
+				delete(pods, name)
+			}
+			var remaining []*v1.Pod
+			for _, pod := range pods {
+				remaining = append(remaining, pod)
+			}
+			if err := ctr.deletePodsAndServices(tfJob, remaining); err != nil {
+				t.Fatalf("%s: %s: unexpected error: %v", c.description, s.description, err)
+			}
+			deleted := append([]string{}, fakePodControl.DeletePodName...)
+			sort.Strings(deleted)
+			if len(deleted) != len(s.expectedDeleted) || (len(deleted) > 0 && !reflect.DeepEqual(deleted, s.expectedDeleted)) {
+				t.Errorf("%s: %s: expected the pods %v deleted, got %v", c.description, s.description, s.expectedDeleted, deleted)
+			}
+			if len(fakeGracefulDeleteControl.DeletePodName) != len(s.expectedGraceful) ||
+				(len(s.expectedGraceful) > 0 && !reflect.DeepEqual(fakeGracefulDeleteControl.DeletePodName, s.expectedGraceful)) {
+				t.Errorf("%s: %s: expected the pods %v deleted gracefully, got %v", c.description, s.description,
+					s.expectedGraceful, fakeGracefulDeleteControl.DeletePodName)
+			}
+			for _, seconds := range fakeGracefulDeleteControl.GracePeriodSeconds {
+				if seconds != 60 {
+					t.Errorf("%s: %s: expected a grace period of 60s, got %d", c.description, s.description, seconds)
+				}
+			}
+		}
+	}
+}
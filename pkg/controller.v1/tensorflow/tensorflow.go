@@ -22,6 +22,8 @@ import (
 	"strconv"
 	"strings"
 
+	"k8s.io/apimachinery/pkg/util/sets"
+
 	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
 	"github.com/kubeflow/tf-operator/pkg/common/jobcontroller"
 )
@@ -32,6 +34,10 @@ const (
 	EnvCustomClusterDomain = "CUSTOM_CLUSTER_DOMAIN"
 )
 
+// tfConfigReservedFields are the fields of TF_CONFIG generated by the
+// operator, which the extra fields of the tfjob do not override.
+var tfConfigReservedFields = sets.NewString("cluster", "task", "environment")
+
 // TFConfig is a struct representing the distributed TensorFlow config.
 // This struct is turned into an environment variable TF_CONFIG
 // which is used by TensorFlow processes to configure themselves.
@@ -40,7 +46,8 @@ const (
 type TFConfig struct {
 	// Cluster represents a TensorFlow ClusterSpec.
 	// See: https://www.tensorflow.org/api_docs/python/tf/train/ClusterSpec
-	Cluster ClusterSpec `json:"cluster"`
+	// It is omitted when the cluster spec is passed via a ConfigMap.
+	Cluster ClusterSpec `json:"cluster,omitempty"`
 	Task    TaskSpec    `json:"task"`
 	// Environment is used by tensorflow.contrib.learn.python.learn in versions <= 1.3
 	// TODO(jlewi): I don't think it is used in versions TF >- 1.4. So we can eventually get rid of it.
@@ -70,14 +77,14 @@ type TaskSpec struct {
 //         },
 //     }
 // }
-func genTFConfigJSONStr(tfjob *tfv1.TFJob, rtype, index string) (string, error) {
+func genTFConfigJSONStr(tfjob *tfv1.TFJob, nameTemplate jobcontroller.NameTemplate, rtype, index string) (string, error) {
 	// Configure the TFCONFIG environment variable.
 	i, err := strconv.ParseInt(index, 0, 32)
 	if err != nil {
 		return "", err
 	}
 
-	cluster, err := genClusterSpec(tfjob)
+	cluster, err := genClusterSpec(tfjob, nameTemplate)
 	if err != nil {
 		return "", err
 	}
@@ -94,16 +101,78 @@ func genTFConfigJSONStr(tfjob *tfv1.TFJob, rtype, index string) (string, error)
 		Environment: "cloud",
 	}
 
+	return marshalTFConfig(tfConfig, tfjob.Spec.TFConfigExtra)
+}
+
+// genTaskTFConfigJSONStr generates TF_CONFIG without the cluster spec, which
+// is passed via a ConfigMap.
+func genTaskTFConfigJSONStr(tfjob *tfv1.TFJob, rtype, index string) (string, error) {
+	i, err := strconv.ParseInt(index, 0, 32)
+	if err != nil {
+		return "", err
+	}
+
+	return marshalTFConfig(TFConfig{
+		Task: TaskSpec{
+			Type:  rtype,
+			Index: int(i),
+		},
+		Environment: "cloud",
+	}, tfjob.Spec.TFConfigExtra)
+}
+
+// marshalTFConfig marshals TF_CONFIG with the extra fields of the tfjob, e.g.
+// rpc_layer, merged into it. The extra fields never override the fields
+// generated by the operator.
+func marshalTFConfig(tfConfig TFConfig, extra map[string]string) (string, error) {
 	tfConfigJSONStr, err := json.Marshal(tfConfig)
 	if err != nil {
 		return "", err
 	}
+	if len(extra) == 0 {
+		return string(tfConfigJSONStr), nil
+	}
 
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(tfConfigJSONStr, &fields); err != nil {
+		return "", err
+	}
+	for field, value := range extra {
+		if tfConfigReservedFields.Has(field) {
+			continue
+		}
+		if fields[field], err = json.Marshal(value); err != nil {
+			return "", err
+		}
+	}
+	tfConfigJSONStr, err = json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
 	return string(tfConfigJSONStr), nil
 }
 
-// genClusterSpec will generate ClusterSpec.
-func genClusterSpec(tfjob *tfv1.TFJob) (ClusterSpec, error) {
+// GenClusterSpec returns the cluster spec of the tfjob, which is passed to its
+// pods in TF_CONFIG: the host:port of each task keyed by the lower case
+// replica type, e.g. "ps" and "worker". Evaluators are not part of it. It
+// lets external tools show the topology of a tfjob without reimplementing
+// the naming of its services, as long as the operator uses the default name
+// template. The defaults are applied on a copy of the tfjob, so it can be
+// called with a tfjob read from the API server.
+func GenClusterSpec(tfjob *tfv1.TFJob) (ClusterSpec, error) {
+	for rtype, spec := range tfjob.Spec.TFReplicaSpecs {
+		if spec == nil || len(spec.Template.Spec.Containers) == 0 {
+			return nil, fmt.Errorf("containers definition expected in %v", rtype)
+		}
+	}
+	tfjob = tfjob.DeepCopy()
+	tfv1.SetObjectDefaults_TFJob(tfjob)
+	return genClusterSpec(tfjob, "")
+}
+
+// genClusterSpec will generate ClusterSpec, naming the services with the
+// template.
+func genClusterSpec(tfjob *tfv1.TFJob, nameTemplate jobcontroller.NameTemplate) (ClusterSpec, error) {
 	clusterSpec := make(ClusterSpec)
 
 	for rtype, spec := range tfjob.Spec.TFReplicaSpecs {
@@ -124,7 +193,7 @@ func genClusterSpec(tfjob *tfv1.TFJob) (ClusterSpec, error) {
 			// Headless service assigned a DNS A record for a name of the form "my-svc.my-namespace.svc.cluster.local".
 			// And the last part "svc.cluster.local" is called cluster domain
 			// which maybe different between kubernetes clusters.
-			hostName := jobcontroller.GenGeneralName(tfjob.Name, rt, fmt.Sprintf("%d", i))
+			hostName := nameTemplate.GenName(tfjob.Name, rt, fmt.Sprintf("%d", i))
 			svcName := hostName + "." + tfjob.Namespace + "." + "svc"
 			cluserDomain := os.Getenv(EnvCustomClusterDomain)
 			if len(cluserDomain) > 0 {
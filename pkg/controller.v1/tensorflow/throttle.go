@@ -0,0 +1,133 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// minThrottleDelay is the delay before a tfjob is synced again after the
+	// API server throttled it without suggesting a delay.
+	minThrottleDelay = time.Second
+	// throttleRecoveryPeriod is the period without throttling after which the
+	// reduced creations per sync double back.
+	throttleRecoveryPeriod = 30 * time.Second
+)
+
+var throttledOperationsCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "tf_operator_throttled_operations_total",
+	Help: "Counts number of tfjob syncs throttled by the API server with 429, by category",
+}, []string{"category"})
+
+// throttleDelay returns the delay the API server asks for before retrying if
+// err is a 429 rejection, e.g. by API priority and fairness, and false
+// otherwise. It is at least minThrottleDelay.
+func throttleDelay(err error) (time.Duration, bool) {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		return 0, false
+	}
+	s := status.Status()
+	if s.Code != http.StatusTooManyRequests && s.Reason != metav1.StatusReasonTooManyRequests {
+		return 0, false
+	}
+	delay := minThrottleDelay
+	if s.Details != nil {
+		if retryAfter := time.Duration(s.Details.RetryAfterSeconds) * time.Second; retryAfter > delay {
+			delay = retryAfter
+		}
+	}
+	return delay, true
+}
+
+// creationThrottle reduces the creations per sync of all the tfjobs while the
+// API server throttles them. The limit is halved on each 429, and doubles back
+// for each throttleRecoveryPeriod without one, until it exceeds the creations
+// per sync which were throttled first and it is lifted. The zero value does
+// not limit the creations.
+type creationThrottle struct {
+	lock sync.Mutex
+	// limit is the creations per sync when the throttle was last reduced,
+	// zero if the creations are not throttled.
+	limit int
+	// ceiling is the creations per sync which were throttled first.
+	ceiling int
+	// since is when the throttle was last reduced.
+	since time.Time
+}
+
+// current returns the creations allowed per sync at now, zero if they are
+// not limited.
+func (t *creationThrottle) current(now time.Time) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.currentLocked(now)
+}
+
+func (t *creationThrottle) currentLocked(now time.Time) int {
+	if t.limit == 0 {
+		return 0
+	}
+	limit := t.limit
+	for elapsed := now.Sub(t.since); elapsed >= throttleRecoveryPeriod && limit <= t.ceiling; elapsed -= throttleRecoveryPeriod {
+		limit *= 2
+	}
+	if limit > t.ceiling {
+		t.limit = 0
+		t.ceiling = 0
+		return 0
+	}
+	return limit
+}
+
+// throttle halves the creations allowed per sync after a sync attempting the
+// given number of creations was throttled, and returns the new limit.
+func (t *creationThrottle) throttle(now time.Time, attempted int) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	current := t.currentLocked(now)
+	if current == 0 || current > attempted {
+		current = attempted
+	}
+	if attempted > t.ceiling {
+		t.ceiling = attempted
+	}
+	t.limit = current / 2
+	if t.limit < 1 {
+		t.limit = 1
+	}
+	t.since = now
+	return t.limit
+}
+
+// creationLimit returns the creations allowed per sync of a replica type, the
+// lowest of maxCreationsPerSync and of the throttle, zero if they are not
+// limited.
+func (tc *TFController) creationLimit() int {
+	limit := tc.maxCreationsPerSync
+	if throttled := tc.creationThrottle.current(tc.clock.Now()); throttled > 0 && (limit <= 0 || throttled < limit) {
+		limit = throttled
+	}
+	return limit
+}
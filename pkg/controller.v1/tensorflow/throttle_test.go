@@ -0,0 +1,138 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/util/workqueue"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+// delayRecordingQueue records the delays of the items added after a while.
+type delayRecordingQueue struct {
+	workqueue.RateLimitingInterface
+	delays map[interface{}]time.Duration
+}
+
+func (q *delayRecordingQueue) AddAfter(item interface{}, duration time.Duration) {
+	q.delays[item] = duration
+}
+
+func TestThrottleDelay(t *testing.T) {
+	type testCase struct {
+		description       string
+		err               error
+		expectedDelay     time.Duration
+		expectedThrottled bool
+	}
+	testCases := []testCase{
+		{"The Retry-After of a 429 is the delay", newReconcileError(ErrPodCreation, apierrors.NewTooManyRequests("throttled", 5)), 5 * time.Second, true},
+		{"A 429 without Retry-After waits for the minimum delay", apierrors.NewTooManyRequests("throttled", 0), minThrottleDelay, true},
+		{"Other errors are not throttled", newReconcileError(ErrPodCreation, fmt.Errorf("fake error")), 0, false},
+		{"A conflict is not throttled", apierrors.NewConflict(tfv1.Resource("tfjobs"), "test", fmt.Errorf("fake error")), 0, false},
+	}
+	for _, c := range testCases {
+		delay, throttled := throttleDelay(c.err)
+		if delay != c.expectedDelay || throttled != c.expectedThrottled {
+			t.Errorf("%s: expected %v, %v, got %v, %v", c.description, c.expectedDelay, c.expectedThrottled, delay, throttled)
+		}
+	}
+}
+
+func TestThrottledSyncIsRequeuedAfterDelay(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	defer ctr.WorkQueue.ShutDown()
+	queue := &delayRecordingQueue{RateLimitingInterface: ctr.WorkQueue, delays: make(map[interface{}]time.Duration)}
+	ctr.WorkQueue = queue
+	tfJob := testutil.NewTFJob(1, 0)
+	unstructured, err := testutil.ConvertTFJobToUnstructured(tfJob)
+	if err != nil {
+		t.Fatalf("Failed to convert the TFJob to Unstructured: %v", err)
+	}
+	if err := ctr.tfJobInformer.GetIndexer().Add(unstructured); err != nil {
+		t.Fatalf("Failed to add tfjob to tfJobIndexer: %v", err)
+	}
+	ctr.syncHandler = func(string) (bool, error) {
+		return false, newReconcileError(ErrStatusUpdate, apierrors.NewTooManyRequests("throttled", 7))
+	}
+
+	key := testutil.GetKey(tfJob, t)
+	ctr.WorkQueue.Add(key)
+	ctr.processNextWorkItem()
+	if delay := queue.delays[key]; delay != 7*time.Second {
+		t.Errorf("Expected the tfjob to be requeued after the Retry-After, got %v", delay)
+	}
+	if requeues := ctr.WorkQueue.NumRequeues(key); requeues != 0 {
+		t.Errorf("Expected the throttled sync not to be rate limited, got %d requeues", requeues)
+	}
+}
+
+func TestCreationThrottle(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	defer ctr.WorkQueue.ShutDown()
+	fakeClock := clock.NewFakeClock(time.Now())
+	ctr.clock = fakeClock
+	tfJob := testutil.NewTFJob(8, 0)
+
+	// The first creation of the 8 attempted is throttled.
+	fakePodControl.Err = apierrors.NewTooManyRequests("throttled", 3)
+	if err := ctr.reconcileReplicaTypes(tfJob, nil, nil); err == nil {
+		t.Fatalf("Expected the throttled creation to fail")
+	}
+	if limit := ctr.creationLimit(); limit != 4 {
+		t.Errorf("Expected the creations per sync to be halved to 4, got %d", limit)
+	}
+
+	// The creations are bounded by the throttle once the API server recovers.
+	fakePodControl.Clear()
+	fakePodControl.Err = nil
+	if err := ctr.reconcileReplicaTypes(tfJob, nil, nil); err != nil {
+		t.Fatalf("Unexpected error when reconciling the pods: %v", err)
+	}
+	if created := len(fakePodControl.Templates); created != 4 {
+		t.Errorf("Expected 4 creations, got %d", created)
+	}
+
+	type step struct {
+		description   string
+		elapsed       time.Duration
+		expectedLimit int
+	}
+	steps := []step{
+		{"The limit is kept before the recovery period", throttleRecoveryPeriod / 2, 4},
+		{"The limit doubles after the recovery period", throttleRecoveryPeriod / 2, 8},
+		{"The limit is lifted once it exceeds the throttled creations", throttleRecoveryPeriod, 0},
+	}
+	for _, s := range steps {
+		fakeClock.Step(s.elapsed)
+		if limit := ctr.creationLimit(); limit != s.expectedLimit {
+			t.Errorf("%s: expected a limit of %d, got %d", s.description, s.expectedLimit, limit)
+		}
+	}
+
+	// The throttle does not raise maxCreationsPerSync.
+	ctr.maxCreationsPerSync = 2
+	ctr.creationThrottle.throttle(fakeClock.Now(), 8)
+	if limit := ctr.creationLimit(); limit != 2 {
+		t.Errorf("Expected maxCreationsPerSync to bound the throttle, got %d", limit)
+	}
+}
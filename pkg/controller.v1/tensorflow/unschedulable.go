@@ -0,0 +1,289 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+const (
+	// tfJobUnschedulableReason is the warning reason when the pods of a
+	// replica type of a tfjob have been unschedulable for too long.
+	tfJobUnschedulableReason = "TFJobUnschedulable"
+)
+
+// WatchNodes sets the node informer the unschedulable pods of the tfjobs are
+// compared with, and the failed nodes are detected with. The caller is responsible for starting the informer.
+func (tc *TFController) WatchNodes(nodeInformer coreinformers.NodeInformer) {
+	tc.nodeLister = nodeInformer.Lister()
+	tc.nodeInformerSynced = nodeInformer.Informer().HasSynced
+}
+
+// reportUnschedulablePods emits an event for each replica type of the tfjob
+// whose pods have been unschedulable for longer than the threshold, which
+// sums up the reasons of the scheduler and suggests how to schedule them. The
+// events of a tfjob are refreshed at most once per interval, and the tfjob is
+// requeued for the pods which are yet to cross the threshold.
+func (tc *TFController) reportUnschedulablePods(tfjob *tfv1.TFJob, pods []*v1.Pod) {
+	if tc.nodeLister == nil || tc.unschedulableEventThreshold <= 0 {
+		return
+	}
+	key, err := KeyFunc(tfjob)
+	if err != nil {
+		return
+	}
+	logger := tflogger.LoggerForJob(tfjob)
+	now := tc.clock.Now()
+
+	unschedulableByType := make(map[string][]*v1.Pod)
+	var nextCheck time.Duration
+	for _, pod := range pods {
+		since, ok := unschedulableSince(pod)
+		if !ok {
+			continue
+		}
+		if remaining := tc.unschedulableEventThreshold - now.Sub(since); remaining > 0 {
+			if nextCheck == 0 || remaining < nextCheck {
+				nextCheck = remaining
+			}
+			continue
+		}
+		rt := pod.Labels[tfReplicaTypeLabel]
+		unschedulableByType[rt] = append(unschedulableByType[rt], pod)
+	}
+	if len(unschedulableByType) > 0 {
+		nextCheck = tc.unschedulableEventInterval
+	}
+	if nextCheck > 0 {
+		tc.WorkQueue.AddAfter(key, nextCheck)
+	}
+	if len(unschedulableByType) == 0 {
+		return
+	}
+
+	tc.unschedulableLock.Lock()
+	last, ok := tc.lastUnschedulableEvents[key]
+	tc.unschedulableLock.Unlock()
+	if ok && now.Sub(last) < tc.unschedulableEventInterval {
+		return
+	}
+
+	nodes, err := tc.nodeLister.List(labels.Everything())
+	if err != nil {
+		logger.Warnf("Failed to list the nodes to report the unschedulable pods: %v", err)
+		return
+	}
+	rts := make([]string, 0, len(unschedulableByType))
+	for rt := range unschedulableByType {
+		rts = append(rts, rt)
+	}
+	sort.Strings(rts)
+	for _, rt := range rts {
+		annotations, msg := unschedulableSummary(tfjob, rt, unschedulableByType[rt], nodes)
+		logger.Info(msg)
+		tc.Recorder.AnnotatedEventf(tfjob, annotations, v1.EventTypeWarning, tfJobUnschedulableReason, "%s", msg)
+	}
+
+	tc.unschedulableLock.Lock()
+	tc.lastUnschedulableEvents[key] = now
+	tc.unschedulableLock.Unlock()
+}
+
+// forgetUnschedulablePods forgets the last unschedulable event of the tfjob.
+func (tc *TFController) forgetUnschedulablePods(key string) {
+	tc.unschedulableLock.Lock()
+	defer tc.unschedulableLock.Unlock()
+	delete(tc.lastUnschedulableEvents, key)
+}
+
+// unschedulableSince returns since when the pod is unschedulable, and false
+// if the scheduler has not reported it unschedulable.
+func unschedulableSince(pod *v1.Pod) (time.Time, bool) {
+	if pod.Status.Phase != v1.PodPending || pod.DeletionTimestamp != nil {
+		return time.Time{}, false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type != v1.PodScheduled || condition.Status != v1.ConditionFalse ||
+			condition.Reason != v1.PodReasonUnschedulable {
+			continue
+		}
+		if condition.LastTransitionTime.IsZero() {
+			return pod.CreationTimestamp.Time, true
+		}
+		return condition.LastTransitionTime.Time, true
+	}
+	return time.Time{}, false
+}
+
+// unschedulableSummary returns the annotations and the message of the event
+// reporting the unschedulable pods of a replica type. The requests of the
+// pods are compared with the allocatable resources of the schedulable nodes
+// matching their node selector. The resources in use on the nodes, their
+// taints and the affinities of the pods are not taken into account.
+func unschedulableSummary(tfjob *tfv1.TFJob, rt string, pods []*v1.Pod, nodes []*v1.Node) (map[string]string, string) {
+	// The scheduler reports the same reason for the pods which only
+	// differ by their index.
+	counts := make(map[string]int)
+	for _, pod := range pods {
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == v1.PodScheduled {
+				counts[strings.TrimSuffix(condition.Message, ".")]++
+			}
+		}
+	}
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if counts[reasons[i]] != counts[reasons[j]] {
+			return counts[reasons[i]] > counts[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	for i, reason := range reasons {
+		reasons[i] = fmt.Sprintf("%s (%d pod(s))", reason, counts[reason])
+	}
+
+	// The pods of a replica type share their template.
+	spec := &pods[0].Spec
+	requests := getPodResourceRequests(spec)
+	selector := labels.SelectorFromSet(spec.NodeSelector)
+	var eligible []*v1.Node
+	for _, node := range nodes {
+		if !node.Spec.Unschedulable && selector.Matches(labels.Set(node.Labels)) {
+			eligible = append(eligible, node)
+		}
+	}
+	largest := make(v1.ResourceList, len(requests))
+	fitting := 0
+	for _, node := range eligible {
+		fits := true
+		for name, requested := range requests {
+			allocatable := node.Status.Allocatable[name]
+			if current, ok := largest[name]; !ok || allocatable.Cmp(current) > 0 {
+				largest[name] = allocatable.DeepCopy()
+			}
+			if requested.Cmp(allocatable) > 0 {
+				fits = false
+			}
+		}
+		if fits {
+			fitting++
+		}
+	}
+
+	var suggestion, advice string
+	var tooLarge []string
+	for _, name := range sortedResourceNames(requests) {
+		requested, available := requests[name], largest[name]
+		if requested.Cmp(available) > 0 {
+			tooLarge = append(tooLarge, fmt.Sprintf("requested %sx %s per pod; largest allocatable on any node: %s",
+				requested.String(), name, available.String()))
+		}
+	}
+	switch {
+	case len(eligible) == 0:
+		suggestion = tfv1.SchedulingSuggestionChangeNodeSelector
+		advice = "no schedulable node matches the node selector of the pods, pick a different node pool"
+	case len(tooLarge) > 0:
+		suggestion = tfv1.SchedulingSuggestionReduceRequests
+		advice = strings.Join(tooLarge, "; ") + "; reduce the requests or pick a node pool with larger nodes"
+	default:
+		suggestion = tfv1.SchedulingSuggestionWaitForCapacity
+		advice = fmt.Sprintf("the pods fit on %d of the %d nodes once their resources are freed, wait for capacity",
+			fitting, len(nodes))
+	}
+
+	annotations := map[string]string{
+		tfv1.AnnotationUnschedulableReplicaType: rt,
+		tfv1.AnnotationUnschedulablePods:        strconv.Itoa(len(pods)),
+		tfv1.AnnotationUnschedulableReasons:     strings.Join(reasons, "; "),
+		tfv1.AnnotationRequestedResources:       formatResourceList(requests),
+		tfv1.AnnotationLargestAllocatable:       formatResourceList(largest),
+		tfv1.AnnotationSchedulingSuggestion:     suggestion,
+	}
+	msg := fmt.Sprintf("%d %s pod(s) of TFJob %s are unschedulable: %s. Suggestion: %s.",
+		len(pods), rt, tfjob.Name, strings.Join(reasons, "; "), advice)
+	return annotations, msg
+}
+
+// getPodResourceRequests returns the resources requested by a pod, as the
+// scheduler computes them: the sum of the requests of its containers, or the
+// largest requests of its init containers if they are larger. The limits of
+// a container stand for the requests it does not set.
+func getPodResourceRequests(spec *v1.PodSpec) v1.ResourceList {
+	requests := make(v1.ResourceList)
+	for _, container := range spec.Containers {
+		for name, quantity := range getContainerResourceRequests(container) {
+			total := requests[name]
+			total.Add(quantity)
+			requests[name] = total
+		}
+	}
+	for _, container := range spec.InitContainers {
+		for name, quantity := range getContainerResourceRequests(container) {
+			if current, ok := requests[name]; !ok || quantity.Cmp(current) > 0 {
+				requests[name] = quantity.DeepCopy()
+			}
+		}
+	}
+	return requests
+}
+
+// getContainerResourceRequests returns the requests of the container,
+// defaulted to its limits.
+func getContainerResourceRequests(container v1.Container) v1.ResourceList {
+	requests := make(v1.ResourceList)
+	for name, quantity := range container.Resources.Limits {
+		requests[name] = quantity.DeepCopy()
+	}
+	for name, quantity := range container.Resources.Requests {
+		requests[name] = quantity.DeepCopy()
+	}
+	return requests
+}
+
+// sortedResourceNames returns the names of the resources in order.
+func sortedResourceNames(list v1.ResourceList) []v1.ResourceName {
+	names := make([]v1.ResourceName, 0, len(list))
+	for name := range list {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// formatResourceList formats the resources as comma separated name=quantity
+// pairs, in order.
+func formatResourceList(list v1.ResourceList) string {
+	pairs := make([]string, 0, len(list))
+	for _, name := range sortedResourceNames(list) {
+		quantity := list[name]
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, quantity.String()))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+)
+
+const insufficientGPUMessage = "0/3 nodes are available: 3 Insufficient nvidia.com/gpu."
+
+func newUnschedulableTestNode(name string, gpus int64, labels map[string]string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Status: v1.NodeStatus{
+			Allocatable: v1.ResourceList{
+				v1.ResourceCPU:   resource.MustParse("32"),
+				tfv1.ResourceGPU: *resource.NewQuantity(gpus, resource.DecimalSI),
+			},
+		},
+	}
+}
+
+// newUnschedulablePod returns a pod of the tfjob which has been reported
+// unschedulable at the given time.
+func newUnschedulablePod(tfJob *tfv1.TFJob, rtype tfv1.TFReplicaType, index int, since time.Time, t *testing.T) *v1.Pod {
+	pod := testutil.NewPod(tfJob, strings.ToLower(string(rtype)), index, t)
+	pod.Spec = *tfJob.Spec.TFReplicaSpecs[rtype].Template.Spec.DeepCopy()
+	pod.Status.Phase = v1.PodPending
+	pod.Status.Conditions = []v1.PodCondition{{
+		Type:               v1.PodScheduled,
+		Status:             v1.ConditionFalse,
+		Reason:             v1.PodReasonUnschedulable,
+		Message:            insufficientGPUMessage,
+		LastTransitionTime: metav1.NewTime(since),
+	}}
+	return pod
+}
+
+// newTFJobRequestingGPUs returns a tfjob whose workers request the given
+// number of GPUs on the gpu node pool.
+func newTFJobRequestingGPUs(workers int, gpus int64) *tfv1.TFJob {
+	tfJob := testutil.NewTFJob(workers, 1)
+	spec := &tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template.Spec
+	spec.NodeSelector = map[string]string{"pool": "gpu"}
+	spec.Containers[0].Resources.Limits = v1.ResourceList{
+		tfv1.ResourceGPU: *resource.NewQuantity(gpus, resource.DecimalSI),
+	}
+	tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypePS].Template.Spec.NodeSelector = map[string]string{"pool": "missing"}
+	return tfJob
+}
+
+func TestUnschedulableSummary(t *testing.T) {
+	nodes := []*v1.Node{
+		newUnschedulableTestNode("gpu-large", 4, map[string]string{"pool": "gpu"}),
+		newUnschedulableTestNode("gpu-small", 2, map[string]string{"pool": "gpu"}),
+		newUnschedulableTestNode("cpu", 0, nil),
+	}
+	since := time.Now().Add(-time.Hour)
+
+	type testCase struct {
+		description     string
+		tfJob           *tfv1.TFJob
+		rtype           tfv1.TFReplicaType
+		pods            int
+		expected        map[string]string
+		expectedMessage string
+	}
+	testCases := []testCase{
+		{
+			description: "The pods request more GPUs than any node has",
+			tfJob:       newTFJobRequestingGPUs(2, 8),
+			rtype:       tfv1.TFReplicaTypeWorker,
+			pods:        2,
+			expected: map[string]string{
+				tfv1.AnnotationUnschedulableReplicaType: testutil.LabelWorker,
+				tfv1.AnnotationUnschedulablePods:        "2",
+				tfv1.AnnotationUnschedulableReasons:     "0/3 nodes are available: 3 Insufficient nvidia.com/gpu (2 pod(s))",
+				tfv1.AnnotationRequestedResources:       "nvidia.com/gpu=8",
+				tfv1.AnnotationLargestAllocatable:       "nvidia.com/gpu=4",
+				tfv1.AnnotationSchedulingSuggestion:     tfv1.SchedulingSuggestionReduceRequests,
+			},
+			expectedMessage: "requested 8x nvidia.com/gpu per pod; largest allocatable on any node: 4",
+		},
+		{
+			description: "The pods fit once the GPUs are freed",
+			tfJob:       newTFJobRequestingGPUs(1, 2),
+			rtype:       tfv1.TFReplicaTypeWorker,
+			pods:        1,
+			expected: map[string]string{
+				tfv1.AnnotationUnschedulablePods:    "1",
+				tfv1.AnnotationRequestedResources:   "nvidia.com/gpu=2",
+				tfv1.AnnotationLargestAllocatable:   "nvidia.com/gpu=4",
+				tfv1.AnnotationSchedulingSuggestion: tfv1.SchedulingSuggestionWaitForCapacity,
+			},
+			expectedMessage: "the pods fit on 2 of the 3 nodes",
+		},
+		{
+			description: "No node matches the node selector",
+			tfJob:       newTFJobRequestingGPUs(1, 2),
+			rtype:       tfv1.TFReplicaTypePS,
+			pods:        1,
+			expected: map[string]string{
+				tfv1.AnnotationUnschedulableReplicaType: testutil.LabelPS,
+				tfv1.AnnotationRequestedResources:       "",
+				tfv1.AnnotationSchedulingSuggestion:     tfv1.SchedulingSuggestionChangeNodeSelector,
+			},
+			expectedMessage: "pick a different node pool",
+		},
+	}
+	for _, c := range testCases {
+		var pods []*v1.Pod
+		for i := 0; i < c.pods; i++ {
+			pods = append(pods, newUnschedulablePod(c.tfJob, c.rtype, i, since, t))
+		}
+		annotations, msg := unschedulableSummary(c.tfJob, strings.ToLower(string(c.rtype)), pods, nodes)
+		for key, value := range c.expected {
+			if annotations[key] != value {
+				t.Errorf("%s: expected the annotation %s=%q, got %q", c.description, key, value, annotations[key])
+			}
+		}
+		if !strings.Contains(msg, c.expectedMessage) || !strings.Contains(msg, insufficientGPUMessage[:len(insufficientGPUMessage)-1]) {
+			t.Errorf("%s: expected the message to contain %q and the reason, got %q", c.description, c.expectedMessage, msg)
+		}
+	}
+}
+
+func TestReportUnschedulablePods(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	defer ctr.WorkQueue.ShutDown()
+	fakeClock := clock.NewFakeClock(time.Now())
+	ctr.clock = fakeClock
+	recorder := record.NewFakeRecorder(10)
+	ctr.Recorder = recorder
+	ctr.unschedulableEventThreshold = 10 * time.Minute
+	ctr.unschedulableEventInterval = 5 * time.Minute
+	nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := nodeIndexer.Add(newUnschedulableTestNode("gpu", 4, map[string]string{"pool": "gpu"})); err != nil {
+		t.Fatalf("Unexpected error when adding the node: %v", err)
+	}
+	ctr.nodeLister = corelisters.NewNodeLister(nodeIndexer)
+
+	tfJob := newTFJobRequestingGPUs(2, 8)
+	// Worker 0 is unschedulable for longer than the threshold, worker 1 and
+	// the PS are not yet.
+	pods := []*v1.Pod{
+		newUnschedulablePod(tfJob, tfv1.TFReplicaTypeWorker, 0, fakeClock.Now().Add(-15*time.Minute), t),
+		newUnschedulablePod(tfJob, tfv1.TFReplicaTypeWorker, 1, fakeClock.Now().Add(-time.Minute), t),
+		newUnschedulablePod(tfJob, tfv1.TFReplicaTypePS, 0, fakeClock.Now().Add(-time.Minute), t),
+	}
+
+	type step struct {
+		description string
+		elapsed     time.Duration
+		events      int
+	}
+	steps := []step{
+		{"Only the worker pods past the threshold are reported", 0, 1},
+		{"The report is not refreshed before the interval", 2 * time.Minute, 0},
+		{"The report of both replica types is refreshed after the interval", 8 * time.Minute, 2},
+	}
+	for _, s := range steps {
+		fakeClock.Step(s.elapsed)
+		ctr.reportUnschedulablePods(tfJob, pods)
+		if events := countEvents(recorder, tfJobUnschedulableReason); events != s.events {
+			t.Errorf("%s: expected %d events, got %d", s.description, s.events, events)
+		}
+	}
+
+	// The report is refreshed right away for a recreated tfjob.
+	ctr.forgetUnschedulablePods(testutil.GetKey(tfJob, t))
+	ctr.reportUnschedulablePods(tfJob, pods)
+	if events := countEvents(recorder, tfJobUnschedulableReason); events != 2 {
+		t.Errorf("Expected the forgotten tfjob to be reported again, got %d events", events)
+	}
+}
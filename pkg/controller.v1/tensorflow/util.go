@@ -15,37 +15,64 @@
 package tensorflow
 
 import (
-	"fmt"
+	v1 "k8s.io/api/core/v1"
 
 	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
 )
 
-var (
-	errPortNotFound = fmt.Errorf("failed to found the port")
-)
-
-// GetPortFromTFJob gets the port of tensorflow container.
+// GetPortFromTFJob gets the port of tensorflow container used in the cluster
+// spec: the port named as the default port of the tfjob, or the first named
+// port of the container. It falls back to the default port if the container
+// has no named port.
 func GetPortFromTFJob(tfJob *tfv1.TFJob, rtype tfv1.TFReplicaType) (int32, error) {
-	containers := tfJob.Spec.TFReplicaSpecs[rtype].Template.Spec.Containers
-	for _, container := range containers {
-		if container.Name == tfv1.DefaultContainerName {
-			ports := container.Ports
-			for _, port := range ports {
-				if port.Name == tfv1.DefaultPortName {
-					return port.ContainerPort, nil
-				}
+	return clusterServicePort(tfJob, getServicePorts(tfJob, rtype)).Port, nil
+}
+
+// getServicePorts returns the ports exposed by the services of the replica
+// type, which are the named ports of its tensorflow container, or the default
+// port if the container has none.
+func getServicePorts(tfJob *tfv1.TFJob, rtype tfv1.TFReplicaType) []v1.ServicePort {
+	var ports []v1.ServicePort
+	for _, container := range tfJob.Spec.TFReplicaSpecs[rtype].Template.Spec.Containers {
+		if container.Name != tfv1.DefaultContainerName {
+			continue
+		}
+		for _, port := range container.Ports {
+			if port.Name == "" {
+				continue
 			}
+			ports = append(ports, v1.ServicePort{
+				Name:     port.Name,
+				Port:     port.ContainerPort,
+				Protocol: port.Protocol,
+			})
 		}
+		break
+	}
+	if len(ports) == 0 {
+		name, port := tfv1.GetDefaultPort(tfJob)
+		ports = append(ports, v1.ServicePort{
+			Name: name,
+			Port: port,
+		})
 	}
-	return -1, errPortNotFound
+	return ports
 }
 
-// ContainChieforMasterSpec returns true if the tfjob contains chief or master spec.
-func ContainChieforMasterSpec(tfJob *tfv1.TFJob) bool {
-	if _, ok := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeChief]; ok {
-		return true
-	} else if _, ok := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeMaster]; ok {
-		return true
+// clusterServicePort returns the port of the cluster spec among the service
+// ports of the tfjob: the one named as its default port, or the first one.
+func clusterServicePort(tfJob *tfv1.TFJob, ports []v1.ServicePort) v1.ServicePort {
+	name, _ := tfv1.GetDefaultPort(tfJob)
+	for _, port := range ports {
+		if port.Name == name {
+			return port
+		}
 	}
-	return false
+	return ports[0]
+}
+
+// ContainChieforMasterSpec returns true if the coordinator of the tfjob is a
+// Chief or Master, see leaderReplicaType.
+func ContainChieforMasterSpec(tfJob *tfv1.TFJob) bool {
+	return tfv1.IsChieforMaster(leaderReplicaType(tfJob))
 }
@@ -0,0 +1,106 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	tflogger "github.com/kubeflow/tf-operator/pkg/logger"
+)
+
+// volumeClaimTemplates returns the volume claim templates of the replica type
+// of the tfjob, given in lower case.
+func volumeClaimTemplates(tfjob *tfv1.TFJob, rt string) []v1.PersistentVolumeClaim {
+	for rtype, claims := range tfjob.Spec.VolumeClaimTemplates {
+		if strings.EqualFold(string(rtype), rt) {
+			return claims
+		}
+	}
+	return nil
+}
+
+// genVolumeClaimName returns the name of the claim of the pod created from
+// the volume claim template, as a StatefulSet names it.
+func genVolumeClaimName(claim *v1.PersistentVolumeClaim, podName string) string {
+	return claim.Name + "-" + podName
+}
+
+// createVolumeClaims creates the claims of the pod from the volume claim
+// templates of its replica type, controlled by the tfjob, and mounts each of
+// them as the volume named after its template. The claims which already exist
+// are kept, so that a recreated pod gets the claims of the pod it replaces.
+func (tc *TFController) createVolumeClaims(podTemplate *v1.PodTemplateSpec, tfjob *tfv1.TFJob, rt, index string) error {
+	templates := volumeClaimTemplates(tfjob, rt)
+	if len(templates) == 0 {
+		return nil
+	}
+	labels := tc.genLabels(tfjob)
+	labels[tfReplicaTypeLabel] = rt
+	labels[tfReplicaIndexLabel] = index
+
+	for i := range templates {
+		template := &templates[i]
+		claim := &v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        genVolumeClaimName(template, podTemplate.Name),
+				Namespace:   tfjob.Namespace,
+				Labels:      mergeStringMap(labels, template.Labels),
+				Annotations: template.Annotations,
+			},
+			Spec: *template.Spec.DeepCopy(),
+		}
+		if err := tc.PVCControl.CreatePVC(tfjob.Namespace, claim, tfjob, tc.GenOwnerReference(tfjob)); err != nil {
+			return err
+		}
+		setVolumeClaim(&podTemplate.Spec, template.Name, claim.Name)
+	}
+	return nil
+}
+
+// setVolumeClaim sets the volume of the given name to the claim, replacing
+// the volume of the same name of the pod spec if any.
+func setVolumeClaim(spec *v1.PodSpec, name, claimName string) {
+	volume := v1.Volume{
+		Name: name,
+		VolumeSource: v1.VolumeSource{
+			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+		},
+	}
+	for i := range spec.Volumes {
+		if spec.Volumes[i].Name == name {
+			spec.Volumes[i] = volume
+			return
+		}
+	}
+	spec.Volumes = append(spec.Volumes, volume)
+}
+
+// deleteVolumeClaims deletes the claims created for the pod from the volume
+// claim templates of its replica type.
+func (tc *TFController) deleteVolumeClaims(tfjob *tfv1.TFJob, pod *v1.Pod) error {
+	templates := volumeClaimTemplates(tfjob, pod.Labels[tfReplicaTypeLabel])
+	for i := range templates {
+		name := genVolumeClaimName(&templates[i], pod.Name)
+		tflogger.LoggerForJob(tfjob).Infof("Deleting the persistentvolumeclaim %s of pod %s", name, pod.Name)
+		if err := tc.PVCControl.DeletePVC(pod.Namespace, name, tfjob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
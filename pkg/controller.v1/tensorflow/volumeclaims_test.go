@@ -0,0 +1,116 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tensorflow
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	tfv1 "github.com/kubeflow/tf-operator/pkg/apis/tensorflow/v1"
+	"github.com/kubeflow/tf-operator/pkg/common/util/v1/testutil"
+	"github.com/kubeflow/tf-operator/pkg/control"
+)
+
+func newTFJobWithVolumeClaimTemplates() *tfv1.TFJob {
+	tfJob := testutil.NewTFJobWithCleanPolicy(0, 2, 1, common.CleanPodPolicyAll)
+	tfJob.Spec.VolumeClaimTemplates = map[tfv1.TFReplicaType][]v1.PersistentVolumeClaim{
+		tfv1.TFReplicaTypeWorker: {{
+			ObjectMeta: metav1.ObjectMeta{Name: "scratch"},
+			Spec: v1.PersistentVolumeClaimSpec{
+				AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("10Gi")},
+				},
+			},
+		}},
+	}
+	// The volume of the template is replaced by the claim.
+	workerSpec := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker]
+	workerSpec.Template.Spec.Volumes = []v1.Volume{{Name: "scratch", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}}
+	return tfJob
+}
+
+func TestCreateVolumeClaims(t *testing.T) {
+	ctr, fakePodControl, _ := newErrorsTestController()
+	fakePVCControl := &control.FakePVCControl{}
+	ctr.PVCControl = fakePVCControl
+	ctr.updateStatusHandler = func(tfJob *tfv1.TFJob) error {
+		return nil
+	}
+	tfJob := newTFJobWithVolumeClaimTemplates()
+
+	if err := ctr.reconcileTFJobs(tfJob); err != nil {
+		t.Fatalf("Unexpected error when reconciling the tfjob: %v", err)
+	}
+	var claims []string
+	for i, claim := range fakePVCControl.Templates {
+		claims = append(claims, claim.Name)
+		if claim.Labels[tfReplicaTypeLabel] != testutil.LabelWorker || len(claim.Spec.AccessModes) != 1 {
+			t.Errorf("Expected the claim %s to be created from the template, got %v", claim.Name, claim)
+		}
+		if ref := fakePVCControl.ControllerRefs[i]; ref.UID != tfJob.UID || ref.Controller == nil || !*ref.Controller {
+			t.Errorf("Expected the claim %s to be controlled by the tfjob, got %v", claim.Name, ref)
+		}
+	}
+	sort.Strings(claims)
+	expected := []string{"scratch-" + testutil.TestTFJobName + "-worker-0", "scratch-" + testutil.TestTFJobName + "-worker-1"}
+	if !reflect.DeepEqual(claims, expected) {
+		t.Errorf("Expected the claims %v, got %v", expected, claims)
+	}
+
+	for _, template := range fakePodControl.Templates {
+		var claimName string
+		for _, volume := range template.Spec.Volumes {
+			if volume.Name == "scratch" && volume.PersistentVolumeClaim != nil {
+				claimName = volume.PersistentVolumeClaim.ClaimName
+			}
+		}
+		rt := template.Labels[tfReplicaTypeLabel]
+		if rt == testutil.LabelWorker && claimName != "scratch-"+template.Name {
+			t.Errorf("Expected the worker pod %s to mount its claim, got %v", template.Name, template.Spec.Volumes)
+		}
+		if rt == testutil.LabelPS && claimName != "" {
+			t.Errorf("Expected the PS pod %s to mount no claim, got %v", template.Name, template.Spec.Volumes)
+		}
+	}
+	if volumes := tfJob.Spec.TFReplicaSpecs[tfv1.TFReplicaTypeWorker].Template.Spec.Volumes; volumes[0].EmptyDir == nil {
+		t.Errorf("Expected the template of the tfjob to be unchanged, got %v", volumes)
+	}
+}
+
+func TestDeleteVolumeClaims(t *testing.T) {
+	ctr, _, _ := newErrorsTestController()
+	fakePVCControl := &control.FakePVCControl{}
+	ctr.PVCControl = fakePVCControl
+	tfJob := newTFJobWithVolumeClaimTemplates()
+	pods := []*v1.Pod{
+		testutil.NewPod(tfJob, testutil.LabelWorker, 0, t),
+		testutil.NewPod(tfJob, testutil.LabelPS, 0, t),
+	}
+
+	if err := ctr.deletePodsAndServices(tfJob, pods); err != nil {
+		t.Fatalf("Unexpected error when deleting the pods: %v", err)
+	}
+	expected := []string{"scratch-" + pods[0].Name}
+	if !reflect.DeepEqual(fakePVCControl.DeletePVCName, expected) {
+		t.Errorf("Expected the claims %v to be deleted, got %v", expected, fakePVCControl.DeletePVCName)
+	}
+}
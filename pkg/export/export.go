@@ -0,0 +1,120 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package export delivers the records of the terminated TFJobs to an external
+// store, so that they are kept after the TFJobs are deleted.
+package export
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	common "github.com/kubeflow/common/job_controller/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Record is the compact record of a terminated TFJob.
+type Record struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid"`
+	// SpecHash is the hash of the spec of the TFJob.
+	SpecHash string `json:"specHash"`
+	// ConfigHash is the hash of the options of the operator which ran the
+	// TFJob.
+	ConfigHash string                `json:"configHash"`
+	Conditions []common.JobCondition `json:"conditions"`
+
+	CreationTime   metav1.Time  `json:"creationTime"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// QueuedSeconds is the time from the creation of the TFJob to its start,
+	// and RunningSeconds the time from its start to its completion.
+	QueuedSeconds  float64 `json:"queuedSeconds"`
+	RunningSeconds float64 `json:"runningSeconds"`
+
+	// Replicas is the outcome of each replica type, keyed by replica type.
+	Replicas map[string]ReplicaRecord `json:"replicas"`
+	// Images is the images the containers of the replicas ran.
+	Images []ImageRecord `json:"images"`
+}
+
+// ReplicaRecord is the outcome of the replicas of a type of a TFJob.
+type ReplicaRecord struct {
+	Replicas  int32 `json:"replicas"`
+	Succeeded int32 `json:"succeeded"`
+	Failed    int32 `json:"failed"`
+	// Restarts is the number of pods of the type which were recreated.
+	Restarts int32 `json:"restarts"`
+}
+
+// ImageRecord is the image of a container of a replica type of a TFJob.
+type ImageRecord struct {
+	ReplicaType string `json:"replicaType"`
+	Container   string `json:"container"`
+	Image       string `json:"image"`
+	// Digest is the digest of the image the container ran, if a pod of the
+	// replica type reported it.
+	Digest string `json:"digest,omitempty"`
+}
+
+// FileName returns the name the record is stored as. The namespaces and names
+// of the TFJobs do not contain underscores, so the names are unique.
+func (r *Record) FileName() string {
+	return fmt.Sprintf("%s_%s_%s.json", r.Namespace, r.Name, r.UID)
+}
+
+// Sink stores the records of the terminated TFJobs.
+type Sink interface {
+	// Export stores the record, overwriting the one of the same TFJob.
+	Export(record *Record) error
+}
+
+// NewSink returns the sink of the URL: file:///path stores the records in a
+// directory, e.g. a mounted PVC, and s3://bucket/prefix?endpoint=...&region=...
+// in an S3-compatible bucket with the credentials of the AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY environment variables.
+func NewSink(rawURL string) (Sink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("missing directory in %q", rawURL)
+		}
+		return &DirectorySink{Dir: u.Path}, nil
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("missing bucket in %q", rawURL)
+		}
+		accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if accessKey == "" || secretKey == "" {
+			return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required by %q", rawURL)
+		}
+		region := u.Query().Get("region")
+		if region == "" {
+			region = defaultS3Region
+		}
+		endpoint := u.Query().Get("endpoint")
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+		}
+		return NewS3Sink(endpoint, region, u.Host, u.Path, accessKey, secretKey)
+	}
+	return nil, fmt.Errorf("unsupported scheme %q in %q, expected file or s3", u.Scheme, rawURL)
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRecord() *Record {
+	return &Record{Namespace: "default", Name: "mnist", UID: "1234", SpecHash: "abcd"}
+}
+
+func TestNewSink(t *testing.T) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "access")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	type testCase struct {
+		url           string
+		expectedError bool
+	}
+	testCases := []testCase{
+		{"file:///var/lib/tfjob-records", false},
+		{"s3://records/tfjobs?endpoint=http://minio:9000", false},
+		{"s3://records", false},
+		{"file://", true},
+		{"s3:///tfjobs", true},
+		{"s3://records?endpoint=minio:9000", true},
+		{"gs://records", true},
+	}
+	for _, c := range testCases {
+		if _, err := NewSink(c.url); (err != nil) != c.expectedError {
+			t.Errorf("%s: expected an error %v, got %v", c.url, c.expectedError, err)
+		}
+	}
+}
+
+func TestDirectorySink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "records")
+	if err != nil {
+		t.Fatalf("Failed to create the directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	sink := &DirectorySink{Dir: filepath.Join(dir, "tfjobs")}
+	record := newTestRecord()
+	if err := sink.Export(record); err != nil {
+		t.Fatalf("Unexpected error when exporting the record: %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "tfjobs", "default_mnist_1234.json"))
+	if err != nil {
+		t.Fatalf("Failed to read the record: %v", err)
+	}
+	var actual Record
+	if err := json.Unmarshal(data, &actual); err != nil || actual.SpecHash != record.SpecHash {
+		t.Errorf("Expected the record to be stored, got %s, %v", data, err)
+	}
+	files, _ := ioutil.ReadDir(filepath.Join(dir, "tfjobs"))
+	if len(files) != 1 {
+		t.Errorf("Expected no temporary file left, got %d files", len(files))
+	}
+}
+
+func TestS3Sink(t *testing.T) {
+	var path, authorization string
+	var body []byte
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("Expected a PUT, got %s", r.Method)
+		}
+		path, authorization = r.URL.Path, r.Header.Get("Authorization")
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink, err := NewS3Sink(server.URL, "eu-west-1", "records", "/tfjobs/", "access", "secret")
+	if err != nil {
+		t.Fatalf("Unexpected error when creating the sink: %v", err)
+	}
+	sink.now = func() time.Time { return time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC) }
+	if err := sink.Export(newTestRecord()); err != nil {
+		t.Fatalf("Unexpected error when exporting the record: %v", err)
+	}
+	if path != "/records/tfjobs/default_mnist_1234.json" {
+		t.Errorf("Unexpected object path %s", path)
+	}
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=access/20190301/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=") {
+		t.Errorf("Unexpected authorization %q", authorization)
+	}
+	var actual Record
+	if err := json.Unmarshal(body, &actual); err != nil || actual.Name != "mnist" {
+		t.Errorf("Expected the record to be uploaded, got %s, %v", body, err)
+	}
+
+	status = http.StatusForbidden
+	if err := sink.Export(newTestRecord()); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected the rejected upload to fail, got %v", err)
+	}
+}
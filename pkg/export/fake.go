@@ -0,0 +1,36 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import "sync"
+
+// FakeSink keeps the records in memory, created as a Sink to allow testing.
+type FakeSink struct {
+	sync.Mutex
+	// Records is the records exported.
+	Records []Record
+	// Err is returned by Export instead of keeping the record if set.
+	Err error
+}
+
+func (f *FakeSink) Export(record *Record) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	f.Records = append(f.Records, *record)
+	return nil
+}
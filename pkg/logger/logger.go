@@ -23,58 +23,85 @@ import (
 	metav1unstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-func LoggerForReplica(job metav1.Object, rtype string) *log.Entry {
-	return log.WithFields(log.Fields{
+const (
+	// The labels of the pods naming their replica type and index.
+	replicaTypeLabel  = "tf-replica-type"
+	replicaIndexLabel = "tf-replica-index"
+)
+
+// jobFields returns the fields identifying the job of the given namespace and
+// name.
+func jobFields(namespace, name string) log.Fields {
+	job := ""
+	if name != "" {
 		// We use job to match the key used in controller.go
 		// Its more common in K8s to use a period to indicate namespace.name. So that's what we use.
-		"job":          job.GetNamespace() + "." + job.GetName(),
-		"uid":          job.GetUID(),
-		"replica-type": rtype,
-	})
+		job = namespace + "." + name
+	}
+	return log.Fields{
+		"job":       job,
+		"namespace": namespace,
+		"tfjob":     name,
+	}
+}
+
+func LoggerForReplica(job metav1.Object, rtype string) *log.Entry {
+	fields := jobFields(job.GetNamespace(), job.GetName())
+	fields["uid"] = job.GetUID()
+	fields["replica-type"] = rtype
+	return log.WithFields(fields)
+}
+
+// LoggerForReplicaIndex returns the logger of the replica of the job with
+// the given type and index.
+func LoggerForReplicaIndex(job metav1.Object, rtype, index string) *log.Entry {
+	return LoggerForReplica(job, rtype).WithField("replica-index", index)
 }
 
 func LoggerForJob(job metav1.Object) *log.Entry {
-	return log.WithFields(log.Fields{
-		// We use job to match the key used in controller.go
-		// Its more common in K8s to use a period to indicate namespace.name. So that's what we use.
-		"job": job.GetNamespace() + "." + job.GetName(),
-		"uid": job.GetUID(),
-	})
+	fields := jobFields(job.GetNamespace(), job.GetName())
+	fields["uid"] = job.GetUID()
+	return log.WithFields(fields)
 }
 
 func LoggerForPod(pod *v1.Pod, kind string) *log.Entry {
-	job := ""
+	name := ""
 	if controllerRef := metav1.GetControllerOf(pod); controllerRef != nil {
 		if controllerRef.Kind == kind {
-			job = pod.Namespace + "." + controllerRef.Name
+			name = controllerRef.Name
 		}
 	}
-	return log.WithFields(log.Fields{
-		// We use job to match the key used in controller.go
-		// In controller.go we log the key used with the workqueue.
-		"job": job,
-		"pod": pod.Namespace + "." + pod.Name,
-		"uid": pod.ObjectMeta.UID,
-	})
+	// We use job to match the key used in controller.go
+	// In controller.go we log the key used with the workqueue.
+	fields := jobFields(pod.Namespace, name)
+	fields["pod"] = pod.Namespace + "." + pod.Name
+	fields["uid"] = pod.ObjectMeta.UID
+	if rtype, ok := pod.Labels[replicaTypeLabel]; ok {
+		fields["replica-type"] = rtype
+	}
+	if index, ok := pod.Labels[replicaIndexLabel]; ok {
+		fields["replica-index"] = index
+	}
+	return log.WithFields(fields)
 }
 
 func LoggerForKey(key string) *log.Entry {
-	return log.WithFields(log.Fields{
-		// The key used by the workQueue should be namespace + "/" + name.
-		// Its more common in K8s to use a period to indicate namespace.name. So that's what we use.
-		"job": strings.Replace(key, "/", ".", -1),
-	})
+	// The key used by the workQueue should be namespace + "/" + name.
+	namespace, name := "", key
+	if i := strings.Index(key, "/"); i >= 0 {
+		namespace, name = key[:i], key[i+1:]
+	}
+	return log.WithFields(jobFields(namespace, name))
 }
 
 func LoggerForUnstructured(obj *metav1unstructured.Unstructured, kind string) *log.Entry {
-	job := ""
+	name := ""
 	if obj.GetKind() == kind {
-		job = obj.GetNamespace() + "." + obj.GetName()
+		name = obj.GetName()
 	}
-	return log.WithFields(log.Fields{
-		// We use job to match the key used in controller.go
-		// In controller.go we log the key used with the workqueue.
-		"job": job,
-		"uid": obj.GetUID(),
-	})
+	// We use job to match the key used in controller.go
+	// In controller.go we log the key used with the workqueue.
+	fields := jobFields(obj.GetNamespace(), name)
+	fields["uid"] = obj.GetUID()
+	return log.WithFields(fields)
 }
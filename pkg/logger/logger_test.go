@@ -0,0 +1,104 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// logFields returns the fields of the JSON log line written by the entry.
+func logFields(t *testing.T, entry *log.Entry) map[string]interface{} {
+	var buf bytes.Buffer
+	logger := log.New()
+	logger.Out = &buf
+	logger.Formatter = &log.JSONFormatter{}
+	// The entry is written by a logger of the test, with its fields.
+	logger.WithFields(entry.Data).Info("message")
+
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatalf("Failed to parse the log line %q: %v", buf.String(), err)
+	}
+	return fields
+}
+
+func TestLoggerFields(t *testing.T) {
+	job := &metav1.ObjectMeta{Namespace: "ns", Name: "job", UID: types.UID("job-uid")}
+	isController := true
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns",
+			Name:      "job-worker-1",
+			UID:       types.UID("pod-uid"),
+			Labels:    map[string]string{replicaTypeLabel: "worker", replicaIndexLabel: "1"},
+			OwnerReferences: []metav1.OwnerReference{{
+				Kind:       "TFJob",
+				Name:       "job",
+				Controller: &isController,
+			}},
+		},
+	}
+
+	testCases := []struct {
+		description string
+		entry       *log.Entry
+		expected    map[string]interface{}
+	}{
+		{
+			"The logger of a job",
+			LoggerForJob(job),
+			map[string]interface{}{"job": "ns.job", "namespace": "ns", "tfjob": "job", "uid": "job-uid"},
+		},
+		{
+			"The logger of a replica type",
+			LoggerForReplica(job, "worker"),
+			map[string]interface{}{"job": "ns.job", "namespace": "ns", "tfjob": "job", "uid": "job-uid", "replica-type": "worker"},
+		},
+		{
+			"The logger of a replica",
+			LoggerForReplicaIndex(job, "worker", "1"),
+			map[string]interface{}{"job": "ns.job", "namespace": "ns", "tfjob": "job", "uid": "job-uid", "replica-type": "worker", "replica-index": "1"},
+		},
+		{
+			"The logger of a pod",
+			LoggerForPod(pod, "TFJob"),
+			map[string]interface{}{"job": "ns.job", "namespace": "ns", "tfjob": "job", "pod": "ns.job-worker-1", "uid": "pod-uid",
+				"replica-type": "worker", "replica-index": "1"},
+		},
+		{
+			"The logger of a key",
+			LoggerForKey("ns/job"),
+			map[string]interface{}{"job": "ns.job", "namespace": "ns", "tfjob": "job"},
+		},
+	}
+	for _, tc := range testCases {
+		fields := logFields(t, tc.entry)
+		for key, value := range tc.expected {
+			if fields[key] != value {
+				t.Errorf("%s: expected the field %s to be %v, got %v", tc.description, key, value, fields[key])
+			}
+		}
+		if fields["msg"] != "message" {
+			t.Errorf("%s: expected the message to be kept as is, got %v", tc.description, fields["msg"])
+		}
+	}
+}
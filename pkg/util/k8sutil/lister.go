@@ -0,0 +1,342 @@
+// Copyright 2018 The Kubeflow Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	policylisters "k8s.io/client-go/listers/policy/v1beta1"
+)
+
+// multiNamespacePodLister merges the pod listers of several
+// namespace-scoped informer factories behind a single PodLister.
+type multiNamespacePodLister struct {
+	listers map[string]corelisters.PodLister
+}
+
+// NewMultiNamespacePodLister returns a PodLister which dispatches to the
+// lister of the namespace being queried. Namespaces without a lister
+// are treated as empty.
+func NewMultiNamespacePodLister(listers map[string]corelisters.PodLister) corelisters.PodLister {
+	return &multiNamespacePodLister{listers: listers}
+}
+
+func (l *multiNamespacePodLister) List(selector labels.Selector) ([]*v1.Pod, error) {
+	var result []*v1.Pod
+	for _, lister := range l.listers {
+		pods, err := lister.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, pods...)
+	}
+	return result, nil
+}
+
+func (l *multiNamespacePodLister) Pods(namespace string) corelisters.PodNamespaceLister {
+	if lister, ok := l.listers[namespace]; ok {
+		return lister.Pods(namespace)
+	}
+	return emptyPodNamespaceLister{}
+}
+
+type emptyPodNamespaceLister struct{}
+
+func (emptyPodNamespaceLister) List(selector labels.Selector) ([]*v1.Pod, error) {
+	return nil, nil
+}
+
+func (emptyPodNamespaceLister) Get(name string) (*v1.Pod, error) {
+	return nil, errors.NewNotFound(v1.Resource("pod"), name)
+}
+
+// multiNamespaceServiceLister merges the service listers of several
+// namespace-scoped informer factories behind a single ServiceLister.
+type multiNamespaceServiceLister struct {
+	listers map[string]corelisters.ServiceLister
+}
+
+// NewMultiNamespaceServiceLister returns a ServiceLister which dispatches to
+// the lister of the namespace being queried. Namespaces without a lister
+// are treated as empty.
+func NewMultiNamespaceServiceLister(listers map[string]corelisters.ServiceLister) corelisters.ServiceLister {
+	return &multiNamespaceServiceLister{listers: listers}
+}
+
+func (l *multiNamespaceServiceLister) List(selector labels.Selector) ([]*v1.Service, error) {
+	var result []*v1.Service
+	for _, lister := range l.listers {
+		services, err := lister.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, services...)
+	}
+	return result, nil
+}
+
+func (l *multiNamespaceServiceLister) Services(namespace string) corelisters.ServiceNamespaceLister {
+	if lister, ok := l.listers[namespace]; ok {
+		return lister.Services(namespace)
+	}
+	return emptyServiceNamespaceLister{}
+}
+
+func (l *multiNamespaceServiceLister) GetPodServices(pod *v1.Pod) ([]*v1.Service, error) {
+	if lister, ok := l.listers[pod.Namespace]; ok {
+		return lister.GetPodServices(pod)
+	}
+	return nil, nil
+}
+
+type emptyServiceNamespaceLister struct{}
+
+func (emptyServiceNamespaceLister) List(selector labels.Selector) ([]*v1.Service, error) {
+	return nil, nil
+}
+
+func (emptyServiceNamespaceLister) Get(name string) (*v1.Service, error) {
+	return nil, errors.NewNotFound(v1.Resource("service"), name)
+}
+
+// multiNamespaceEndpointsLister merges the endpoints listers of several
+// namespace-scoped informer factories behind a single EndpointsLister.
+type multiNamespaceEndpointsLister struct {
+	listers map[string]corelisters.EndpointsLister
+}
+
+// NewMultiNamespaceEndpointsLister returns an EndpointsLister which
+// dispatches to the lister of the namespace being queried. Namespaces
+// without a lister are treated as empty.
+func NewMultiNamespaceEndpointsLister(listers map[string]corelisters.EndpointsLister) corelisters.EndpointsLister {
+	return &multiNamespaceEndpointsLister{listers: listers}
+}
+
+func (l *multiNamespaceEndpointsLister) List(selector labels.Selector) ([]*v1.Endpoints, error) {
+	var result []*v1.Endpoints
+	for _, lister := range l.listers {
+		endpoints, err := lister.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, endpoints...)
+	}
+	return result, nil
+}
+
+func (l *multiNamespaceEndpointsLister) Endpoints(namespace string) corelisters.EndpointsNamespaceLister {
+	if lister, ok := l.listers[namespace]; ok {
+		return lister.Endpoints(namespace)
+	}
+	return emptyEndpointsNamespaceLister{}
+}
+
+type emptyEndpointsNamespaceLister struct{}
+
+func (emptyEndpointsNamespaceLister) List(selector labels.Selector) ([]*v1.Endpoints, error) {
+	return nil, nil
+}
+
+func (emptyEndpointsNamespaceLister) Get(name string) (*v1.Endpoints, error) {
+	return nil, errors.NewNotFound(v1.Resource("endpoints"), name)
+}
+
+// multiNamespacePodTemplateLister merges the PodTemplate listers of several
+// namespace-scoped informer factories behind a single PodTemplateLister.
+type multiNamespacePodTemplateLister struct {
+	listers map[string]corelisters.PodTemplateLister
+}
+
+// NewMultiNamespacePodTemplateLister returns a PodTemplateLister which
+// dispatches to the lister of the namespace being queried. Namespaces
+// without a lister are treated as empty.
+func NewMultiNamespacePodTemplateLister(listers map[string]corelisters.PodTemplateLister) corelisters.PodTemplateLister {
+	return &multiNamespacePodTemplateLister{listers: listers}
+}
+
+func (l *multiNamespacePodTemplateLister) List(selector labels.Selector) ([]*v1.PodTemplate, error) {
+	var result []*v1.PodTemplate
+	for _, lister := range l.listers {
+		templates, err := lister.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, templates...)
+	}
+	return result, nil
+}
+
+func (l *multiNamespacePodTemplateLister) PodTemplates(namespace string) corelisters.PodTemplateNamespaceLister {
+	if lister, ok := l.listers[namespace]; ok {
+		return lister.PodTemplates(namespace)
+	}
+	return emptyPodTemplateNamespaceLister{}
+}
+
+type emptyPodTemplateNamespaceLister struct{}
+
+func (emptyPodTemplateNamespaceLister) List(selector labels.Selector) ([]*v1.PodTemplate, error) {
+	return nil, nil
+}
+
+func (emptyPodTemplateNamespaceLister) Get(name string) (*v1.PodTemplate, error) {
+	return nil, errors.NewNotFound(v1.Resource("podtemplate"), name)
+}
+
+// multiNamespaceJobLister merges the Job listers of several namespace-scoped
+// informer factories behind a single JobLister.
+type multiNamespaceJobLister struct {
+	listers map[string]batchlisters.JobLister
+}
+
+// NewMultiNamespaceJobLister returns a JobLister which dispatches to the
+// lister of the namespace being queried. Namespaces without a lister are
+// treated as empty.
+func NewMultiNamespaceJobLister(listers map[string]batchlisters.JobLister) batchlisters.JobLister {
+	return &multiNamespaceJobLister{listers: listers}
+}
+
+func (l *multiNamespaceJobLister) List(selector labels.Selector) ([]*batchv1.Job, error) {
+	var result []*batchv1.Job
+	for _, lister := range l.listers {
+		jobs, err := lister.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, jobs...)
+	}
+	return result, nil
+}
+
+func (l *multiNamespaceJobLister) Jobs(namespace string) batchlisters.JobNamespaceLister {
+	if lister, ok := l.listers[namespace]; ok {
+		return lister.Jobs(namespace)
+	}
+	return emptyJobNamespaceLister{}
+}
+
+func (l *multiNamespaceJobLister) GetPodJobs(pod *v1.Pod) ([]batchv1.Job, error) {
+	if lister, ok := l.listers[pod.Namespace]; ok {
+		return lister.GetPodJobs(pod)
+	}
+	return nil, nil
+}
+
+type emptyJobNamespaceLister struct{}
+
+func (emptyJobNamespaceLister) List(selector labels.Selector) ([]*batchv1.Job, error) {
+	return nil, nil
+}
+
+func (emptyJobNamespaceLister) Get(name string) (*batchv1.Job, error) {
+	return nil, errors.NewNotFound(batchv1.Resource("job"), name)
+}
+
+// multiNamespacePodDisruptionBudgetLister merges the PodDisruptionBudget
+// listers of several namespace-scoped informer factories behind a single
+// PodDisruptionBudgetLister.
+type multiNamespacePodDisruptionBudgetLister struct {
+	listers map[string]policylisters.PodDisruptionBudgetLister
+}
+
+// NewMultiNamespacePodDisruptionBudgetLister returns a
+// PodDisruptionBudgetLister which dispatches to the lister of the namespace
+// being queried. Namespaces without a lister are treated as empty.
+func NewMultiNamespacePodDisruptionBudgetLister(listers map[string]policylisters.PodDisruptionBudgetLister) policylisters.PodDisruptionBudgetLister {
+	return &multiNamespacePodDisruptionBudgetLister{listers: listers}
+}
+
+func (l *multiNamespacePodDisruptionBudgetLister) List(selector labels.Selector) ([]*policyv1beta1.PodDisruptionBudget, error) {
+	var result []*policyv1beta1.PodDisruptionBudget
+	for _, lister := range l.listers {
+		pdbs, err := lister.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, pdbs...)
+	}
+	return result, nil
+}
+
+func (l *multiNamespacePodDisruptionBudgetLister) PodDisruptionBudgets(namespace string) policylisters.PodDisruptionBudgetNamespaceLister {
+	if lister, ok := l.listers[namespace]; ok {
+		return lister.PodDisruptionBudgets(namespace)
+	}
+	return emptyPodDisruptionBudgetNamespaceLister{}
+}
+
+func (l *multiNamespacePodDisruptionBudgetLister) GetPodPodDisruptionBudgets(pod *v1.Pod) ([]*policyv1beta1.PodDisruptionBudget, error) {
+	if lister, ok := l.listers[pod.Namespace]; ok {
+		return lister.GetPodPodDisruptionBudgets(pod)
+	}
+	return nil, nil
+}
+
+type emptyPodDisruptionBudgetNamespaceLister struct{}
+
+func (emptyPodDisruptionBudgetNamespaceLister) List(selector labels.Selector) ([]*policyv1beta1.PodDisruptionBudget, error) {
+	return nil, nil
+}
+
+func (emptyPodDisruptionBudgetNamespaceLister) Get(name string) (*policyv1beta1.PodDisruptionBudget, error) {
+	return nil, errors.NewNotFound(policyv1beta1.Resource("poddisruptionbudget"), name)
+}
+
+// multiNamespaceConfigMapLister merges the ConfigMap listers of several
+// namespace-scoped informer factories behind a single ConfigMapLister.
+type multiNamespaceConfigMapLister struct {
+	listers map[string]corelisters.ConfigMapLister
+}
+
+// NewMultiNamespaceConfigMapLister returns a ConfigMapLister which
+// dispatches to the lister of the namespace being queried. Namespaces
+// without a lister are treated as empty.
+func NewMultiNamespaceConfigMapLister(listers map[string]corelisters.ConfigMapLister) corelisters.ConfigMapLister {
+	return &multiNamespaceConfigMapLister{listers: listers}
+}
+
+func (l *multiNamespaceConfigMapLister) List(selector labels.Selector) ([]*v1.ConfigMap, error) {
+	var result []*v1.ConfigMap
+	for _, lister := range l.listers {
+		configMaps, err := lister.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, configMaps...)
+	}
+	return result, nil
+}
+
+func (l *multiNamespaceConfigMapLister) ConfigMaps(namespace string) corelisters.ConfigMapNamespaceLister {
+	if lister, ok := l.listers[namespace]; ok {
+		return lister.ConfigMaps(namespace)
+	}
+	return emptyConfigMapNamespaceLister{}
+}
+
+type emptyConfigMapNamespaceLister struct{}
+
+func (emptyConfigMapNamespaceLister) List(selector labels.Selector) ([]*v1.ConfigMap, error) {
+	return nil, nil
+}
+
+func (emptyConfigMapNamespaceLister) Get(name string) (*v1.ConfigMap, error) {
+	return nil, errors.NewNotFound(v1.Resource("configmap"), name)
+}